@@ -214,9 +214,10 @@ func verifyReality(waitTime time.Duration, consulID types.PodID, agentID types.P
 }
 
 func scheduleForThisHost(manifest manifest.Manifest, alsoReality bool) error {
-	store := consul.NewConsulStore(consul.NewConsulClient(consul.Options{
-		Token: *consulToken,
-	}))
+	store := consul.NewConsulStoreFromOptions(consul.Options{
+		Token:     *consulToken,
+		AuditUser: "p2-bootstrap",
+	})
 	hostname, err := os.Hostname()
 	if err != nil {
 		return err
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"time"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+type store interface {
+	Pod(podPrefix consul.PodPrefix, nodename types.NodeName, podId types.PodID) (manifest.Manifest, time.Duration, error)
+	SetPod(podPrefix consul.PodPrefix, nodename types.NodeName, manifest manifest.Manifest) (time.Duration, error)
+	SetSchedulingMetadata(podPrefix consul.PodPrefix, nodename types.NodeName, podId types.PodID, metadata consul.SchedulingMetadata) (time.Duration, error)
+	DeletePod(podPrefix consul.PodPrefix, nodename types.NodeName, podId types.PodID) (time.Duration, error)
+}
+
+type cloner struct {
+	store store
+
+	// If true, the pod is removed from the source node after it has been
+	// written to the destination
+	alsoUnschedule bool
+}
+
+// clone copies the intent manifest of a legacy pod from one node to another,
+// recording the source node in the destination's scheduling metadata.
+func (c cloner) clone(from types.NodeName, to types.NodeName, podID types.PodID) error {
+	if from == to {
+		return util.Errorf("Source and destination nodes are both %s", from)
+	}
+
+	podManifest, _, err := c.store.Pod(consul.INTENT_TREE, from, podID)
+	if err != nil {
+		return util.Errorf("Could not read %s from %s: %s", podID, from, err)
+	}
+
+	_, err = c.store.SetPod(consul.INTENT_TREE, to, podManifest)
+	if err != nil {
+		return util.Errorf("Could not write %s to %s: %s", podID, to, err)
+	}
+
+	metadata := consul.SchedulingMetadata{
+		ScheduledAt: time.Now(),
+		ClonedFrom:  from,
+	}
+	_, err = c.store.SetSchedulingMetadata(consul.INTENT_TREE, to, podID, metadata)
+	if err != nil {
+		return util.Errorf("Copied %s to %s but could not write its scheduling metadata: %s", podID, to, err)
+	}
+
+	if c.alsoUnschedule {
+		_, err = c.store.DeletePod(consul.INTENT_TREE, from, podID)
+		if err != nil {
+			return util.Errorf("Copied %s to %s but could not remove it from %s: %s", podID, to, from, err)
+		}
+	}
+	return nil
+}
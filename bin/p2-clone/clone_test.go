@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/consultest"
+)
+
+func storeWithPod() *consultest.FakePodStore {
+	builder := manifest.NewBuilder()
+	builder.SetID("bar")
+	return consultest.NewFakePodStore(map[consultest.FakePodStoreKey]manifest.Manifest{
+		consultest.FakePodStoreKeyFor(consul.INTENT_TREE, "old", "bar"): builder.GetManifest(),
+	}, nil)
+}
+
+func TestClone(t *testing.T) {
+	store := storeWithPod()
+	c := cloner{store: store}
+
+	err := c.clone("old", "new", "bar")
+	if err != nil {
+		t.Fatalf("unexpected error cloning: %s", err)
+	}
+
+	cloned, _, err := store.Pod(consul.INTENT_TREE, "new", "bar")
+	if err != nil {
+		t.Fatalf("expected bar to be written to new: %s", err)
+	}
+	if cloned.ID() != "bar" {
+		t.Errorf("expected cloned pod to be bar, was %s", cloned.ID())
+	}
+
+	_, _, err = store.Pod(consul.INTENT_TREE, "old", "bar")
+	if err != nil {
+		t.Errorf("expected bar to still be scheduled on old: %s", err)
+	}
+
+	metadata, ok := store.SchedulingMetadata(consul.INTENT_TREE, "new", "bar")
+	if !ok {
+		t.Fatal("expected scheduling metadata to be written for the clone")
+	}
+	if metadata.ClonedFrom != "old" {
+		t.Errorf("expected metadata to record the clone from old, got %q", metadata.ClonedFrom)
+	}
+}
+
+func TestCloneAlsoUnschedule(t *testing.T) {
+	store := storeWithPod()
+	c := cloner{store: store, alsoUnschedule: true}
+
+	err := c.clone("old", "new", "bar")
+	if err != nil {
+		t.Fatalf("unexpected error cloning: %s", err)
+	}
+
+	_, _, err = store.Pod(consul.INTENT_TREE, "new", "bar")
+	if err != nil {
+		t.Fatalf("expected bar to be written to new: %s", err)
+	}
+	_, _, err = store.Pod(consul.INTENT_TREE, "old", "bar")
+	if err != pods.NoCurrentManifest {
+		t.Errorf("expected bar to be removed from old, got %v", err)
+	}
+}
+
+func TestCloneMissingPod(t *testing.T) {
+	store := storeWithPod()
+	c := cloner{store: store}
+
+	err := c.clone("old", "new", "missing")
+	if err == nil {
+		t.Fatal("expected an error cloning a pod that isn't scheduled")
+	}
+}
@@ -0,0 +1,52 @@
+// p2-clone copies a legacy pod's intent from one node to another, for example
+// when replacing a decommissioned node.
+package main
+
+import (
+	"fmt"
+	"log"
+	"os/user"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/flags"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/version"
+)
+
+var (
+	fromNode       = kingpin.Flag("from-node", "The node to copy the pod from").Required().String()
+	toNode         = kingpin.Flag("to-node", "The node to copy the pod to").Required().String()
+	podID          = kingpin.Flag("pod", "The ID of the pod to copy").Required().String()
+	alsoUnschedule = kingpin.Flag("also-unschedule", "Remove the pod from --from-node once it has been copied").Bool()
+)
+
+func main() {
+	kingpin.Version(version.VERSION)
+	_, opts, _ := flags.ParseWithConsulOptions()
+	client := consul.NewConsulClient(opts)
+	// The copy, and the removal with --also-unschedule, are recorded in
+	// the audit log
+	opts.AuditUser = currentUsername()
+	store := consul.NewConsulStoreWithOptions(client, opts)
+
+	c := cloner{
+		store:          store,
+		alsoUnschedule: *alsoUnschedule,
+	}
+	err := c.clone(types.NodeName(*fromNode), types.NodeName(*toNode), types.PodID(*podID))
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	fmt.Printf("%s: successfully copied %s from %s\n", *toNode, *podID, *fromNode)
+}
+
+func currentUsername() string {
+	currentUser, err := user.Current()
+	if err != nil {
+		return "unknown"
+	}
+	return currentUser.Username
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// Subset of consulutil.ConsulKVClient used to read the intent tree
+type kvLister interface {
+	List(prefix string, q *api.QueryOptions) (api.KVPairs, *api.QueryMeta, error)
+}
+
+// entry is a raw consul key and value, along with the error decoding the
+// value as a pod manifest, if any
+type entry struct {
+	Key      string `json:"key"`
+	Value    []byte `json:"value"`
+	ParseErr string `json:"parse_error,omitempty"`
+}
+
+// listIntent returns every key under the node's intent tree in lexical order,
+// without assuming that the values are valid manifests.
+func listIntent(kv kvLister, node types.NodeName) ([]entry, error) {
+	prefix := fmt.Sprintf("%s/%s/", consul.INTENT_TREE, node)
+	pairs, _, err := kv.List(prefix, nil)
+	if err != nil {
+		return nil, consulutil.NewKVError("list", prefix, err)
+	}
+
+	entries := make([]entry, 0, len(pairs))
+	for _, pair := range pairs {
+		e := entry{
+			Key:   pair.Key,
+			Value: pair.Value,
+		}
+		_, err := manifest.FromBytes(pair.Value)
+		if err != nil {
+			e.ParseErr = err.Error()
+		}
+		entries = append(entries, e)
+	}
+	sort.Sort(entriesByKey(entries))
+	return entries, nil
+}
+
+type entriesByKey []entry
+
+func (e entriesByKey) Len() int           { return len(e) }
+func (e entriesByKey) Less(i, j int) bool { return e[i].Key < e[j].Key }
+func (e entriesByKey) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+
+// dumpText writes each key followed by a hex and ASCII dump of its value and
+// either VALID or the error decoding it.
+func dumpText(w io.Writer, entries []entry) error {
+	for _, e := range entries {
+		status := "VALID"
+		if e.ParseErr != "" {
+			status = "INVALID: " + e.ParseErr
+		}
+		_, err := fmt.Fprintf(w, "%s (%d bytes)\n%s%s\n\n", e.Key, len(e.Value), hex.Dump(e.Value), status)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dumpJSON writes a JSON object of each key to its raw value (base64
+// encoded, as JSON has no way to represent arbitrary bytes) and parse error.
+func dumpJSON(w io.Writer, entries []entry) error {
+	byKey := make(map[string]entry, len(entries))
+	for _, e := range entries {
+		byKey[e.Key] = e
+	}
+	out, err := json.MarshalIndent(byKey, "", "    ")
+	if err != nil {
+		return util.Errorf("Could not marshal JSON output: %s", err)
+	}
+	_, err = fmt.Fprintln(w, string(out))
+	return err
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+
+	"github.com/hashicorp/consul/api"
+)
+
+func testKV(t *testing.T) *consulutil.FakeKV {
+	builder := manifest.NewBuilder()
+	builder.SetID("good")
+	manifestBytes, err := builder.GetManifest().Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return consulutil.NewKVWithEntries(map[string]*api.KVPair{
+		"intent/node1/good":  {Key: "intent/node1/good", Value: manifestBytes},
+		"intent/node1/bad":   {Key: "intent/node1/bad", Value: []byte{0xff, 0x00, '{', ':', 0x7f}},
+		"intent/node2/other": {Key: "intent/node2/other", Value: manifestBytes},
+	})
+}
+
+func TestDumpTextReportsParseErrors(t *testing.T) {
+	entries, err := listIntent(testKV(t), "node1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected the 2 keys under node1, got %d", len(entries))
+	}
+
+	var out bytes.Buffer
+	err = dumpText(&out, entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sections := strings.Split(strings.TrimSpace(out.String()), "\n\n")
+	if len(sections) != 2 {
+		t.Fatalf("expected a section per key, got:\n%s", out.String())
+	}
+	bad, good := sections[0], sections[1]
+	if !strings.HasPrefix(bad, "intent/node1/bad") || !strings.Contains(bad, "INVALID: ") {
+		t.Errorf("expected the corrupted value to be reported as invalid, got:\n%s", bad)
+	}
+	if !strings.Contains(bad, "ff 00 7b 3a 7f") {
+		t.Errorf("expected a hex dump of the corrupted value, got:\n%s", bad)
+	}
+	if !strings.HasPrefix(good, "intent/node1/good") || !strings.HasSuffix(good, "VALID") || strings.Contains(good, "INVALID") {
+		t.Errorf("expected the manifest to be reported as valid, got:\n%s", good)
+	}
+}
+
+func TestDumpJSON(t *testing.T) {
+	entries, err := listIntent(testKV(t), "node1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	err = dumpJSON(&out, entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded map[string]entry
+	err = json.Unmarshal(out.Bytes(), &decoded)
+	if err != nil {
+		t.Fatalf("could not decode JSON output: %s", err)
+	}
+	bad, ok := decoded["intent/node1/bad"]
+	if !ok {
+		t.Fatalf("expected the corrupted key in the output, got %v", decoded)
+	}
+	if !bytes.Equal(bad.Value, []byte{0xff, 0x00, '{', ':', 0x7f}) {
+		t.Errorf("expected the raw value to round trip, got %v", bad.Value)
+	}
+	if bad.ParseErr == "" {
+		t.Error("expected a parse error for the corrupted value")
+	}
+	if decoded["intent/node1/good"].ParseErr != "" {
+		t.Errorf("unexpected parse error for the manifest: %s", decoded["intent/node1/good"].ParseErr)
+	}
+}
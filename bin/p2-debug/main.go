@@ -0,0 +1,39 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/flags"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/version"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	nodeName = kingpin.Flag("node", "The node whose intent keys should be dumped.").Required().String()
+	format   = kingpin.Flag("format", "Display format. text shows a hex dump of each value, json a JSON object of keys to values.").Default("text").Enum("text", "json")
+)
+
+func main() {
+	kingpin.Version(version.VERSION)
+	_, opts, _ := flags.ParseWithConsulOptions()
+	client := consul.NewConsulClient(opts)
+
+	entries, err := listIntent(client.KV(), types.NodeName(*nodeName))
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	switch *format {
+	case "json":
+		err = dumpJSON(os.Stdout, entries)
+	default:
+		err = dumpText(os.Stdout, entries)
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/flags"
+	"github.com/square/p2/pkg/version"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// p2-diff-cluster prints every legacy pod whose intent does not match its
+// reality, i.e. pods that preparers have yet to converge.
+func main() {
+	kingpin.Version(version.VERSION)
+	_, opts, _ := flags.ParseWithConsulOptions()
+	client := consul.NewConsulClient(opts)
+	store := consul.NewConsulStore(client)
+
+	intent, err := store.ListIntentTree()
+	if err != nil {
+		log.Fatalf("Could not list intent tree: %s", err)
+	}
+	reality, err := store.ListRealityTree()
+	if err != nil {
+		log.Fatalf("Could not list reality tree: %s", err)
+	}
+
+	// Diffing reality against intent reports pods that should be added to
+	// or removed from each node
+	for _, diff := range reality.Diff(intent) {
+		fmt.Printf("%s\t%s\t%s\n", diff.Node, diff.PodID, diff.Type)
+	}
+}
@@ -45,7 +45,10 @@ func main() {
 	client := consul.NewConsulClient(consulOpts)
 	logger := logging.NewLogger(logrus.Fields{})
 	dsStore := dsstore.NewConsul(client, 3, &logger)
-	consulStore := consul.NewConsulStore(client)
+	// Pods scheduled and unscheduled by the farm are recorded in the audit
+	// log
+	consulOpts.AuditUser = "p2-ds-farm"
+	consulStore := consul.NewConsulStoreWithOptions(client, consulOpts)
 	healthChecker := checker.NewHealthChecker(client)
 
 	rawStatusStore := statusstore.NewConsul(client)
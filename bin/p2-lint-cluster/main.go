@@ -0,0 +1,35 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/square/p2/pkg/lint"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/flags"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/version"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	nodeName      = kingpin.Flag("node", "The node whose scheduled manifests should be linted.").Required().String()
+	failOnWarning = kingpin.Flag("fail-on-warning", "Exit 1 if there are any warnings, not just errors.").Bool()
+)
+
+func main() {
+	kingpin.Version(version.VERSION)
+	_, opts, _ := flags.ParseWithConsulOptions()
+	store := consul.NewConsulStore(consul.NewConsulClient(opts))
+
+	reports, err := lintNode(store, types.NodeName(*nodeName), lint.Linters())
+	if err != nil {
+		log.Fatalln(err)
+	}
+	err = printReports(os.Stdout, reports)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	os.Exit(exitCode(reports, *failOnWarning))
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/square/p2/pkg/lint"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// Subset of consul.Store used to find the manifests scheduled on a node
+type podLister interface {
+	ListPods(podPrefix consul.PodPrefix, nodename types.NodeName) ([]consul.ManifestResult, time.Duration, error)
+}
+
+// podReport is the result of linting a single scheduled pod
+type podReport struct {
+	PodID        types.PodID
+	PodUniqueKey types.PodUniqueKey
+	Violations   []lint.Violation
+}
+
+type podReports []podReport
+
+func (r podReports) Len() int      { return len(r) }
+func (r podReports) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+func (r podReports) Less(i, j int) bool {
+	if r[i].PodID != r[j].PodID {
+		return r[i].PodID < r[j].PodID
+	}
+	return r[i].PodUniqueKey < r[j].PodUniqueKey
+}
+
+// lintNode runs the linters against every pod in the node's intent tree.
+// Reports are sorted by pod ID.
+func lintNode(lister podLister, node types.NodeName, linters []lint.Linter) ([]podReport, error) {
+	results, _, err := lister.ListPods(consul.INTENT_TREE, node)
+	if err != nil {
+		return nil, util.Errorf("Could not list the pods scheduled on %s: %s", node, err)
+	}
+
+	reports := make(podReports, 0, len(results))
+	for _, result := range results {
+		reports = append(reports, podReport{
+			PodID:        result.Manifest.ID(),
+			PodUniqueKey: result.PodUniqueKey,
+			Violations:   lint.Lint(result.Manifest, linters),
+		})
+	}
+	sort.Sort(reports)
+	return reports, nil
+}
+
+// printReports writes the violations of each pod, e.g.
+//
+//	hello: 1 violation
+//	  error    artifact-verification: artifact verification is disabled
+//	world: ok
+func printReports(w io.Writer, reports []podReport) error {
+	for _, report := range reports {
+		name := report.PodID.String()
+		if report.PodUniqueKey != "" {
+			name = fmt.Sprintf("%s (%s)", name, report.PodUniqueKey)
+		}
+
+		var lines []string
+		switch len(report.Violations) {
+		case 0:
+			lines = append(lines, fmt.Sprintf("%s: ok", name))
+		case 1:
+			lines = append(lines, fmt.Sprintf("%s: 1 violation", name))
+		default:
+			lines = append(lines, fmt.Sprintf("%s: %d violations", name, len(report.Violations)))
+		}
+		for _, v := range report.Violations {
+			lines = append(lines, fmt.Sprintf("  %-8s %s: %s", v.Severity, v.Rule, v.Message))
+		}
+
+		_, err := fmt.Fprintln(w, strings.Join(lines, "\n"))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exitCode is 1 if any pod has an error, or a warning when failOnWarning is
+// set, and 0 otherwise.
+func exitCode(reports []podReport, failOnWarning bool) int {
+	threshold := lint.SeverityError
+	if failOnWarning {
+		threshold = lint.SeverityWarning
+	}
+	for _, report := range reports {
+		if lint.HasSeverity(report.Violations, threshold) {
+			return 1
+		}
+	}
+	return 0
+}
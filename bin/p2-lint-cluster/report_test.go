@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/auth"
+	"github.com/square/p2/pkg/lint"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+)
+
+type fakeLister map[types.NodeName][]consul.ManifestResult
+
+func (f fakeLister) ListPods(podPrefix consul.PodPrefix, nodename types.NodeName) ([]consul.ManifestResult, time.Duration, error) {
+	return f[nodename], 0, nil
+}
+
+func twoPodCluster() fakeLister {
+	good := manifest.NewBuilder()
+	good.SetID("good")
+	good.SetStatusPort(8000)
+
+	bad := manifest.NewBuilder()
+	bad.SetID("bad")
+	bad.SetStatusPort(8001)
+	bad.SetArtifactVerification(auth.VerifyNone)
+
+	return fakeLister{
+		"node1": {
+			{Manifest: good.GetManifest()},
+			{Manifest: bad.GetManifest()},
+		},
+	}
+}
+
+func TestLintNodeReportsViolations(t *testing.T) {
+	reports, err := lintNode(twoPodCluster(), "node1", lint.Linters())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 2 {
+		t.Fatalf("expected a report for each of the 2 pods, got %d", len(reports))
+	}
+
+	var out bytes.Buffer
+	err = printReports(&out, reports)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "bad: 1 violation\n  error    artifact-verification: artifact verification is disabled\ngood: ok\n"
+	if out.String() != expected {
+		t.Errorf("expected the report:\n%s\ngot:\n%s", expected, out.String())
+	}
+
+	if code := exitCode(reports, false); code != 1 {
+		t.Errorf("expected exit code 1 with a lint error, got %d", code)
+	}
+}
+
+func TestExitCodeFailOnWarning(t *testing.T) {
+	builder := manifest.NewBuilder()
+	builder.SetID("hello")
+	builder.SetRunAsUser("root")
+	builder.SetStatusPort(8000)
+	lister := fakeLister{"node1": {{Manifest: builder.GetManifest()}}}
+
+	reports, err := lintNode(lister, "node1", lint.Linters())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	err = printReports(&out, reports)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "run-as-root") {
+		t.Errorf("expected the warning in the report, got %q", out.String())
+	}
+
+	if code := exitCode(reports, false); code != 0 {
+		t.Errorf("expected warnings alone to exit 0, got %d", code)
+	}
+	if code := exitCode(reports, true); code != 1 {
+		t.Errorf("expected warnings to exit 1 with --fail-on-warning, got %d", code)
+	}
+}
@@ -87,12 +87,31 @@ func main() {
 
 	go prep.WatchForPodManifestsForNode(quitMainUpdate)
 
+	quitPrefetch := make(chan struct{})
+	quitChans = append(quitChans, quitPrefetch)
+	go prep.WatchForPrefetchManifests(quitPrefetch)
+
 	if prep.PodProcessReporter != nil {
 		quitPodProcessReporter := make(chan struct{})
 		quitChans = append(quitChans, quitPodProcessReporter)
 		go prep.PodProcessReporter.Run(quitPodProcessReporter)
 	}
 
+	if prep.InstallGC != nil {
+		quitInstallGC := make(chan struct{})
+		quitChans = append(quitChans, quitInstallGC)
+		go prep.InstallGC.Run(quitInstallGC)
+	}
+
+	if prep.ArtifactCache != nil {
+		go func() {
+			err := prep.ArtifactCache.ListenAndServe()
+			if err != nil {
+				logger.WithError(err).Errorln("Artifact cache server stopped")
+			}
+		}()
+	}
+
 	// Launch health checking watch. This watch tracks health of
 	// all pods on this host and writes the information to consul
 	quitMonitorPodHealth := make(chan struct{})
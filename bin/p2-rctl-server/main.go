@@ -77,7 +77,10 @@ func main() {
 	httpClient := cleanhttp.DefaultClient()
 	client := consul.NewConsulClient(opts)
 	statusStoreClient := statusstore.NewConsul(client)
-	consulStore := consul.NewConsulStore(client)
+	// Pods scheduled and unscheduled by the farms are recorded in the
+	// audit log
+	opts.AuditUser = "p2-rctl-server"
+	consulStore := consul.NewConsulStoreWithOptions(client, opts)
 	rcStore := rcstore.NewConsul(client, labeler, RetryCount)
 	rcStatusStore := rcstatus.NewConsul(statusStoreClient, consul.RCStatusNamespace)
 
@@ -49,7 +49,6 @@ func main() {
 	kingpin.Version(version.VERSION)
 	_, opts, labeler := flags.ParseWithConsulOptions()
 	client := consul.NewConsulClient(opts)
-	store := consul.NewConsulStore(client)
 	healthChecker := checker.NewHealthChecker(client)
 
 	manifest, err := manifest.FromURI(*manifestURI)
@@ -75,6 +74,10 @@ func main() {
 	if err != nil {
 		log.Fatalf("Could not retrieve user: %s", err)
 	}
+	// Every pod the replicator schedules is recorded in the audit log
+	opts.AuditUser = thisUser.Username
+	opts.AuditHostname = thisHost
+	store := consul.NewConsulStoreWithOptions(client, opts)
 
 	nodes := make([]types.NodeName, len(*hosts))
 	for i, host := range *hosts {
@@ -99,11 +99,13 @@ func handlePodRemoval(consulClient consulutil.ConsulClient, labeler Labeler) err
 }
 
 func sessionName(rcID fields.ID) string {
+	return fmt.Sprintf("p2-rm:user:%s:rcID:%s", currentUsername(), rcID)
+}
+
+func currentUsername() string {
 	currentUser, err := user.Current()
-	username := "unknown"
-	if err == nil {
-		username = currentUser.Username
+	if err != nil {
+		return "unknown"
 	}
-
-	return fmt.Sprintf("p2-rm:user:%s:rcID:%s", username, rcID)
+	return currentUser.Username
 }
@@ -78,7 +78,8 @@ func NewUUIDP2RM(client consulutil.ConsulClient, podUniqueKey types.PodUniqueKey
 
 func (rm *P2RM) configureStorage(client consulutil.ConsulClient, labeler Labeler) {
 	rm.Client = client
-	rm.Store = consul.NewConsulStore(client)
+	// Removing a pod from the intent tree is recorded in the audit log
+	rm.Store = consul.NewConsulStoreWithOptions(client, consul.Options{AuditUser: currentUsername()})
 	consulStore := rcstore.NewConsul(client, labeler, 5)
 
 	// one day these might have different implementations
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/square/p2/pkg/version"
+)
+
+var (
+	keyringPath = kingpin.Flag("keyring", "The PGP keyring to rotate keys in. It is rewritten in place.").Required().ExistingFile()
+	addPath     = kingpin.Flag("add", "A file containing the new public key(s) to add to the keyring.").ExistingFile()
+	removeKeyID = kingpin.Flag("remove", "The ID of the old key to remove once the grace period has passed, e.g. 0x1234ABCD5678EF90 or 0x5678EF90.").String()
+	gracePeriod = kingpin.Flag("grace-period", "How long to keep the old key after adding the new one, so that artifacts and manifests signed by either are accepted while signers switch over.").Default("24h").Duration()
+)
+
+func main() {
+	kingpin.Version(version.VERSION)
+	kingpin.Parse()
+
+	if *addPath == "" && *removeKeyID == "" {
+		kingpin.Usage()
+		log.Fatalln("At least one of --add and --remove must be given")
+	}
+
+	r := rotation{
+		keyringPath: *keyringPath,
+		addPath:     *addPath,
+		removeKeyID: *removeKeyID,
+		gracePeriod: *gracePeriod,
+		sleep:       time.Sleep,
+		logf:        log.Printf,
+	}
+	err := r.run()
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
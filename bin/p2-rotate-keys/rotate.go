@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+
+	"github.com/square/p2/pkg/auth"
+	"github.com/square/p2/pkg/util"
+)
+
+// rotation replaces a key in a keyring in two steps: the new key is added
+// immediately, and the old key is only removed after the grace period.
+// Keyring consumers that reload the file when it changes (e.g. the preparer's
+// keyring auth policy) accept signatures from both keys in between, so
+// nothing has to be restarted and nothing signed with the old key is rejected
+// while signers switch over.
+type rotation struct {
+	keyringPath string
+	// If empty, no key is added
+	addPath string
+	// If empty, no key is removed
+	removeKeyID string
+	gracePeriod time.Duration
+
+	sleep func(time.Duration)
+	logf  func(format string, args ...interface{})
+}
+
+func (r rotation) run() error {
+	var removeID keyID
+	if r.removeKeyID != "" {
+		var err error
+		removeID, err = parseKeyID(r.removeKeyID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if r.addPath != "" {
+		newKeys, err := auth.LoadKeyring(r.addPath)
+		if err != nil {
+			return util.Errorf("Could not read new key from %s: %s", r.addPath, err)
+		}
+		err = r.update(func(ring openpgp.EntityList) (openpgp.EntityList, error) {
+			return addKeys(ring, newKeys), nil
+		})
+		if err != nil {
+			return err
+		}
+		r.logf("Added %d key(s) from %s to %s", len(newKeys), r.addPath, r.keyringPath)
+	}
+
+	if r.removeKeyID == "" {
+		return nil
+	}
+
+	if r.addPath != "" && r.gracePeriod > 0 {
+		r.logf("Waiting %s before removing %s", r.gracePeriod, r.removeKeyID)
+		r.sleep(r.gracePeriod)
+	}
+
+	err := r.update(func(ring openpgp.EntityList) (openpgp.EntityList, error) {
+		return removeKey(ring, removeID)
+	})
+	if err != nil {
+		return err
+	}
+	r.logf("Removed %s from %s", r.removeKeyID, r.keyringPath)
+	return nil
+}
+
+// update rereads the keyring, so that changes made during the grace period
+// are not lost, and atomically replaces it with the result of mutate.
+func (r rotation) update(mutate func(openpgp.EntityList) (openpgp.EntityList, error)) error {
+	contents, err := ioutil.ReadFile(r.keyringPath)
+	if err != nil {
+		return util.Errorf("Could not read keyring %s: %s", r.keyringPath, err)
+	}
+	ring, err := auth.LoadKeyring(r.keyringPath)
+	if err != nil {
+		return util.Errorf("Could not parse keyring %s: %s", r.keyringPath, err)
+	}
+
+	ring, err = mutate(ring)
+	if err != nil {
+		return err
+	}
+	if len(ring) == 0 {
+		return util.Errorf("Refusing to leave %s without any keys", r.keyringPath)
+	}
+
+	return writeKeyring(r.keyringPath, ring, isArmored(contents))
+}
+
+// keyID identifies a key either by its 64-bit long ID or by its 32-bit short
+// ID
+type keyID struct {
+	id    uint64
+	short bool
+}
+
+func parseKeyID(s string) (keyID, error) {
+	hex := strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	if len(hex) != 8 && len(hex) != 16 {
+		return keyID{}, util.Errorf("%s is not an 8 or 16 digit hex key ID", s)
+	}
+	id, err := strconv.ParseUint(hex, 16, 64)
+	if err != nil {
+		return keyID{}, util.Errorf("%s is not an 8 or 16 digit hex key ID", s)
+	}
+	return keyID{id: id, short: len(hex) == 8}, nil
+}
+
+func (k keyID) matches(entity *openpgp.Entity) bool {
+	if entity.PrimaryKey == nil {
+		return false
+	}
+	if k.short {
+		return entity.PrimaryKey.KeyId&0xFFFFFFFF == k.id
+	}
+	return entity.PrimaryKey.KeyId == k.id
+}
+
+// addKeys returns ring with every key in newKeys that it does not already
+// contain appended
+func addKeys(ring openpgp.EntityList, newKeys openpgp.EntityList) openpgp.EntityList {
+	present := make(map[uint64]bool, len(ring))
+	for _, entity := range ring {
+		if entity.PrimaryKey != nil {
+			present[entity.PrimaryKey.KeyId] = true
+		}
+	}
+
+	for _, entity := range newKeys {
+		if entity.PrimaryKey == nil || present[entity.PrimaryKey.KeyId] {
+			continue
+		}
+		present[entity.PrimaryKey.KeyId] = true
+		ring = append(ring, entity)
+	}
+	return ring
+}
+
+// removeKey returns ring without the key with the given ID. It is an error
+// for no key, or more than one key, to match.
+func removeKey(ring openpgp.EntityList, id keyID) (openpgp.EntityList, error) {
+	var kept openpgp.EntityList
+	removed := 0
+	for _, entity := range ring {
+		if id.matches(entity) {
+			removed++
+			continue
+		}
+		kept = append(kept, entity)
+	}
+
+	switch removed {
+	case 0:
+		return nil, util.Errorf("No key with ID %X is in the keyring", id.id)
+	case 1:
+		return kept, nil
+	default:
+		return nil, util.Errorf("%d keys match the short ID %X, use the long ID instead", removed, id.id)
+	}
+}
+
+func isArmored(contents []byte) bool {
+	_, err := armor.Decode(bytes.NewReader(contents))
+	return err == nil
+}
+
+// writeKeyring replaces the keyring at path by renaming a new file over it,
+// so that readers never see a partially written keyring.
+func writeKeyring(path string, ring openpgp.EntityList, armored bool) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return util.Errorf("Could not create temporary keyring: %s", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	err = serializeKeyring(tmp, ring, armored)
+	if err != nil {
+		return util.Errorf("Could not write keyring: %s", err)
+	}
+	err = tmp.Chmod(info.Mode())
+	if err != nil {
+		return util.Errorf("Could not set keyring permissions: %s", err)
+	}
+	err = tmp.Close()
+	if err != nil {
+		return util.Errorf("Could not write keyring: %s", err)
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func serializeKeyring(out io.Writer, ring openpgp.EntityList, armored bool) error {
+	if !armored {
+		return serializeEntities(out, ring)
+	}
+
+	w, err := armor.Encode(out, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return err
+	}
+	err = serializeEntities(w, ring)
+	if err != nil {
+		_ = w.Close()
+		return err
+	}
+	// Close writes the armor footer
+	return w.Close()
+}
+
+func serializeEntities(out io.Writer, ring openpgp.EntityList) error {
+	for _, entity := range ring {
+		err := entity.Serialize(out)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+
+	"github.com/square/p2/pkg/auth"
+)
+
+func newTestKey(t *testing.T, name string) *openpgp.Entity {
+	entity, err := openpgp.NewEntity(name, "", name+"@example.com", &packet.Config{RSABits: 1024})
+	if err != nil {
+		t.Fatalf("Could not generate test key: %s", err)
+	}
+	// NewEntity leaves the subkey binding signature unsigned, and only
+	// SerializePrivate signs it
+	err = entity.SerializePrivate(ioutil.Discard, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entity
+}
+
+func writeTestKeyring(t *testing.T, path string, ring openpgp.EntityList, armored bool) {
+	var buf bytes.Buffer
+	err := serializeKeyring(&buf, ring, armored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(path, buf.Bytes(), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// verifies checks whether the keyring at path accepts a signature made by
+// signer
+func verifies(t *testing.T, path string, signer *openpgp.Entity) bool {
+	ring, err := auth.LoadKeyring(path)
+	if err != nil {
+		t.Fatalf("Could not load keyring: %s", err)
+	}
+	data := []byte("some artifact")
+	var sig bytes.Buffer
+	err = openpgp.DetachSign(&sig, signer, bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = openpgp.CheckDetachedSignature(ring, bytes.NewReader(data), &sig)
+	return err == nil
+}
+
+func TestRotation(t *testing.T) {
+	for _, armored := range []bool{false, true} {
+		t.Run(fmt.Sprintf("armored=%t", armored), func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "rotate-keys")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			oldKey := newTestKey(t, "old")
+			otherKey := newTestKey(t, "other")
+			newKey := newTestKey(t, "new")
+
+			keyringPath := filepath.Join(dir, "keyring.gpg")
+			writeTestKeyring(t, keyringPath, openpgp.EntityList{oldKey, otherKey}, armored)
+			addPath := filepath.Join(dir, "new-key.gpg")
+			writeTestKeyring(t, addPath, openpgp.EntityList{newKey}, armored)
+
+			slept := false
+			r := rotation{
+				keyringPath: keyringPath,
+				addPath:     addPath,
+				removeKeyID: fmt.Sprintf("0x%X", oldKey.PrimaryKey.KeyId),
+				gracePeriod: 24 * time.Hour,
+				sleep: func(d time.Duration) {
+					slept = true
+					if d != 24*time.Hour {
+						t.Errorf("Expected to wait for the 24h grace period, waited %s", d)
+					}
+					// During the grace period both keys must be accepted
+					if !verifies(t, keyringPath, oldKey) {
+						t.Error("Expected the old key to be accepted during the grace period")
+					}
+					if !verifies(t, keyringPath, newKey) {
+						t.Error("Expected the new key to be accepted during the grace period")
+					}
+				},
+				logf: t.Logf,
+			}
+
+			err = r.run()
+			if err != nil {
+				t.Fatalf("Unexpected error rotating keys: %s", err)
+			}
+			if !slept {
+				t.Fatal("Expected rotation to wait for the grace period")
+			}
+
+			if verifies(t, keyringPath, oldKey) {
+				t.Error("Expected the old key to be rejected after rotation")
+			}
+			if !verifies(t, keyringPath, newKey) {
+				t.Error("Expected the new key to be accepted after rotation")
+			}
+			if !verifies(t, keyringPath, otherKey) {
+				t.Error("Expected unrelated keys to be kept")
+			}
+		})
+	}
+}
+
+func TestRemoveUnknownKeyFails(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotate-keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	keyringPath := filepath.Join(dir, "keyring.gpg")
+	writeTestKeyring(t, keyringPath, openpgp.EntityList{newTestKey(t, "a"), newTestKey(t, "b")}, false)
+	before, err := ioutil.ReadFile(keyringPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := rotation{
+		keyringPath: keyringPath,
+		removeKeyID: "0x0123456789ABCDEF",
+		sleep:       func(time.Duration) { t.Error("Should not wait when only removing a key") },
+		logf:        t.Logf,
+	}
+	err = r.run()
+	if err == nil {
+		t.Fatal("Expected an error removing a key that is not in the keyring")
+	}
+
+	after, err := ioutil.ReadFile(keyringPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Error("Expected a failed removal to leave the keyring untouched")
+	}
+}
+
+func TestParseKeyID(t *testing.T) {
+	key := newTestKey(t, "a")
+	long := fmt.Sprintf("0x%016X", key.PrimaryKey.KeyId)
+	short := fmt.Sprintf("%08X", key.PrimaryKey.KeyId&0xFFFFFFFF)
+
+	for _, s := range []string{long, short} {
+		id, err := parseKeyID(s)
+		if err != nil {
+			t.Fatalf("Unexpected error parsing %s: %s", s, err)
+		}
+		if !id.matches(key) {
+			t.Errorf("Expected %s to match the key", s)
+		}
+	}
+
+	for _, s := range []string{"", "0x123", "0xZZZZZZZZ"} {
+		_, err := parseKeyID(s)
+		if err == nil {
+			t.Errorf("Expected an error parsing %q", s)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"os/user"
+	"path"
+	"time"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+const (
+	approvalPending  = "pending"
+	approvalApproved = "approved"
+	approvalDenied   = "denied"
+
+	defaultApprovalPollInterval = 5 * time.Second
+)
+
+// The body POSTed to the approval backend for each manifest
+type approvalRequest struct {
+	PodID          types.PodID    `json:"pod_id"`
+	Node           types.NodeName `json:"node"`
+	ManifestDigest string         `json:"manifest_digest"`
+	Operator       string         `json:"operator"`
+}
+
+// The approval backend responds to both the initial POST and subsequent polls
+// with this structure. Polls are made with a GET to <backend>/<id>
+type approvalResponse struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// approver asks a release approval system whether a manifest may be
+// scheduled, blocking until the request is approved, denied, or times out
+type approver struct {
+	client       *http.Client
+	backend      *url.URL
+	timeout      time.Duration
+	pollInterval time.Duration
+	operator     string
+}
+
+func newApprover(backend *url.URL, timeout time.Duration) *approver {
+	return &approver{
+		client:       http.DefaultClient,
+		backend:      backend,
+		timeout:      timeout,
+		pollInterval: defaultApprovalPollInterval,
+		operator:     operatorIdentity(),
+	}
+}
+
+// operatorIdentity returns the name of the user running p2-schedule
+func operatorIdentity() string {
+	if current, err := user.Current(); err == nil {
+		return current.Username
+	}
+	return os.Getenv("USER")
+}
+
+// approve returns nil if the manifest was approved for scheduling to the node,
+// or an error containing the denial reason otherwise.
+func (a *approver) approve(node types.NodeName, podManifest manifest.Manifest) error {
+	digest, err := podManifest.SHA()
+	if err != nil {
+		return util.Errorf("Could not compute digest of %s for approval: %s", podManifest.ID(), err)
+	}
+
+	reqBytes, err := json.Marshal(approvalRequest{
+		PodID:          podManifest.ID(),
+		Node:           node,
+		ManifestDigest: digest,
+		Operator:       a.operator,
+	})
+	if err != nil {
+		return util.Errorf("Could not marshal approval request: %s", err)
+	}
+
+	resp, err := a.do(a.client.Post(a.backend.String(), "application/json", bytes.NewReader(reqBytes)))
+	if err != nil {
+		return err
+	}
+
+	pollURL := *a.backend
+	pollURL.Path = path.Join(pollURL.Path, resp.ID)
+
+	deadline := time.After(a.timeout)
+	for {
+		switch resp.Status {
+		case approvalApproved:
+			return nil
+		case approvalDenied:
+			return util.Errorf("Scheduling %s on %s was denied: %s", podManifest.ID(), node, resp.Reason)
+		case approvalPending:
+		default:
+			return util.Errorf("Unexpected approval status %q for %s on %s", resp.Status, podManifest.ID(), node)
+		}
+
+		select {
+		case <-deadline:
+			return util.Errorf("Timed out after %s waiting for approval of %s on %s", a.timeout, podManifest.ID(), node)
+		case <-time.After(a.pollInterval):
+		}
+
+		resp, err = a.do(a.client.Get(pollURL.String()))
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (a *approver) do(resp *http.Response, err error) (approvalResponse, error) {
+	var approval approvalResponse
+	if err != nil {
+		return approval, util.Errorf("Could not contact approval backend: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return approval, util.Errorf("Approval backend returned status: %s", resp.Status)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&approval)
+	if err != nil {
+		return approval, util.Errorf("Could not decode approval backend response: %s", err)
+	}
+	return approval, nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/store/consul"
+)
+
+// approvalServer approves a request on the second poll attempt, or denies it
+// if deny is set.
+type approvalServer struct {
+	mu       sync.Mutex
+	polls    int
+	deny     bool
+	requests []approvalRequest
+}
+
+func (a *approvalServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	resp := approvalResponse{ID: "req1", Status: approvalPending}
+	switch r.Method {
+	case "POST":
+		var req approvalRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		a.requests = append(a.requests, req)
+	case "GET":
+		if r.URL.Path != "/approvals/req1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		a.polls++
+		if a.deny {
+			resp.Status = approvalDenied
+			resp.Reason = "change freeze"
+		} else if a.polls == 2 {
+			resp.Status = approvalApproved
+		}
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func testApprover(t *testing.T, server *httptest.Server) *approver {
+	backend, err := url.Parse(server.URL + "/approvals")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := newApprover(backend, time.Second)
+	a.pollInterval = time.Millisecond
+	a.operator = "tester"
+	return a
+}
+
+func TestApprovalOnSecondPoll(t *testing.T) {
+	backend := &approvalServer{}
+	server := httptest.NewServer(backend)
+	defer server.Close()
+
+	store := newFakeIntentStore()
+	s := scheduler{
+		store:     store,
+		podPrefix: consul.INTENT_TREE,
+		approver:  testApprover(t, server),
+	}
+
+	podManifest := testManifest("foo")
+	_, err := s.schedule("node1", podManifest)
+	if err != nil {
+		t.Fatalf("expected approved manifest to be scheduled: %s", err)
+	}
+	if len(store.writes("node1")) != 1 {
+		t.Fatalf("expected manifest to be written once after approval, got %d writes", len(store.writes("node1")))
+	}
+	if backend.polls != 2 {
+		t.Errorf("expected 2 polls, got %d", backend.polls)
+	}
+
+	if len(backend.requests) != 1 {
+		t.Fatalf("expected one approval request, got %d", len(backend.requests))
+	}
+	req := backend.requests[0]
+	digest, _ := podManifest.SHA()
+	if req.PodID != "foo" || req.Node != "node1" || req.ManifestDigest != digest || req.Operator != "tester" {
+		t.Errorf("unexpected approval request: %+v", req)
+	}
+}
+
+func TestApprovalDenied(t *testing.T) {
+	backend := &approvalServer{deny: true}
+	server := httptest.NewServer(backend)
+	defer server.Close()
+
+	store := newFakeIntentStore()
+	s := scheduler{
+		store:     store,
+		podPrefix: consul.INTENT_TREE,
+		approver:  testApprover(t, server),
+	}
+
+	_, err := s.schedule("node1", testManifest("foo"))
+	if err == nil {
+		t.Fatal("expected denied manifest to return an error")
+	}
+	if len(store.writes("node1")) != 0 {
+		t.Errorf("denied manifest should not have been written")
+	}
+}
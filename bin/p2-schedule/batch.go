@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/schedule"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// batchRow is a single scheduling operation read from a --batch-csv file,
+// which has the columns node,manifest_path,tag. The tag column is optional
+// and holds a single KEY=VALUE pair.
+type batchRow struct {
+	// The line of the file the row was read from, for error messages
+	line         int
+	node         types.NodeName
+	manifestPath string
+	tags         map[string]string
+}
+
+type batchResult struct {
+	row batchRow
+	// Empty if the row's manifest could not be read
+	podID types.PodID
+	out   schedule.Output
+	err   error
+}
+
+// readBatchCSV parses a batch file. Rows that cannot be parsed are returned
+// as errors rather than aborting the whole batch.
+func readBatchCSV(r io.Reader, hasHeader bool) ([]batchRow, []error) {
+	reader := csv.NewReader(r)
+	// column counts are validated per row
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var rows []batchRow
+	var errs []error
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if hasHeader && line == 1 {
+			continue
+		}
+		if err != nil {
+			if _, ok := err.(*csv.ParseError); ok {
+				errs = append(errs, util.Errorf("line %d: %s", line, err))
+				continue
+			}
+			return rows, append(errs, util.Errorf("could not read batch file: %s", err))
+		}
+
+		row, err := parseBatchRecord(line, record)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return rows, errs
+}
+
+func parseBatchRecord(line int, record []string) (batchRow, error) {
+	if len(record) < 2 || len(record) > 3 {
+		return batchRow{}, util.Errorf("line %d: expected node,manifest_path[,tag] but found %d columns", line, len(record))
+	}
+
+	row := batchRow{
+		line:         line,
+		node:         types.NodeName(strings.TrimSpace(record[0])),
+		manifestPath: strings.TrimSpace(record[1]),
+	}
+	if row.node == "" {
+		return batchRow{}, util.Errorf("line %d: node is empty", line)
+	}
+	if row.manifestPath == "" {
+		return batchRow{}, util.Errorf("line %d: manifest_path is empty", line)
+	}
+
+	if len(record) == 3 && strings.TrimSpace(record[2]) != "" {
+		tag := strings.SplitN(strings.TrimSpace(record[2]), "=", 2)
+		if len(tag) != 2 || tag[0] == "" {
+			return batchRow{}, util.Errorf("line %d: tag %q is not in KEY=VALUE form", line, record[2])
+		}
+		row.tags = map[string]string{tag[0]: tag[1]}
+	}
+	return row, nil
+}
+
+// scheduleBatch schedules every row in parallel, updating s.progress as each
+// finishes. Results are returned in the order of the rows.
+func (s scheduler) scheduleBatch(rows []batchRow) []batchResult {
+	results := make([]batchResult, len(rows))
+	var wg sync.WaitGroup
+	for i, row := range rows {
+		wg.Add(1)
+		go func(i int, row batchRow) {
+			defer wg.Done()
+			results[i] = s.scheduleRow(row)
+			if s.progress != nil {
+				s.progress.add(results[i].err)
+			}
+		}(i, row)
+	}
+	wg.Wait()
+	return results
+}
+
+func (s scheduler) scheduleRow(row batchRow) batchResult {
+	result := batchResult{row: row}
+	s, podManifest, err := s.prepareRow(row)
+	if podManifest != nil {
+		result.podID = podManifest.ID()
+	}
+	if err != nil {
+		result.err = err
+		return result
+	}
+
+	result.out, err = s.schedule(row.node, podManifest)
+	if err != nil {
+		result.err = wrapError(err, "line %d: %s", row.line, err)
+	}
+	return result
+}
+
+// prepareRow reads the manifest of row, returning it along with a copy of s
+// that schedules it with the row's tags. The manifest is nil if it could not
+// be read.
+func (s scheduler) prepareRow(row batchRow) (scheduler, manifest.Manifest, error) {
+	// Rows are scheduled concurrently, so each gets its own request ID to
+	// keep its log entries distinguishable
+	s.requestID = fmt.Sprintf("%s-%d", s.requestID, row.line)
+
+	podManifest, err := s.readManifest(row.manifestPath)
+	if err != nil {
+		return s, nil, validationError(util.Errorf("line %d: could not read manifest at %s: %s", row.line, row.manifestPath, err))
+	}
+
+	if s.requireIDMatchesFilename {
+		err = checkIDMatchesFilename(row.manifestPath, podManifest)
+		if err != nil {
+			return s, podManifest, wrapError(err, "line %d: %s", row.line, err)
+		}
+	}
+
+	if len(row.tags) > 0 {
+		// s is a copy, so the row's tags don't affect other rows
+		tags := make(map[string]string, len(s.tags)+len(row.tags))
+		for k, v := range s.tags {
+			tags[k] = v
+		}
+		for k, v := range row.tags {
+			tags[k] = v
+		}
+		s.tags = tags
+	}
+	return s, podManifest, nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+)
+
+func writeTestManifest(t *testing.T, dir string, id types.PodID) string {
+	manifestBytes, err := testManifest(id).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, id.String()+".yaml")
+	err = ioutil.WriteFile(path, manifestBytes, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestBatchCSV(t *testing.T) {
+	dir, err := ioutil.TempDir("", "batch-csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	foo := writeTestManifest(t, dir, "foo")
+	bar := writeTestManifest(t, dir, "bar")
+	csv := strings.Join([]string{
+		"node,manifest_path,tag",
+		fmt.Sprintf("node1,%s,release=x", foo),
+		fmt.Sprintf("node2,%s,", foo),
+		fmt.Sprintf("node3,%s", bar),
+		fmt.Sprintf(",%s,release=x", bar),
+	}, "\n")
+
+	rows, parseErrs := readBatchCSV(strings.NewReader(csv), true)
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 valid rows, got %d", len(rows))
+	}
+	if len(parseErrs) != 1 {
+		t.Fatalf("expected 1 invalid row, got %d: %v", len(parseErrs), parseErrs)
+	}
+
+	store := newFakeIntentStore()
+	s := scheduler{
+		store:     store,
+		podPrefix: consul.INTENT_TREE,
+	}
+	for _, result := range s.scheduleBatch(rows) {
+		if result.err != nil {
+			t.Errorf("unexpected error scheduling line %d: %s", result.row.line, result.err)
+		}
+	}
+
+	for _, node := range []types.NodeName{"node1", "node2", "node3"} {
+		if len(store.writes(node)) != 1 {
+			t.Errorf("expected one write to %s, got %d", node, len(store.writes(node)))
+		}
+	}
+	if store.metadata["node1"].Tags["release"] != "x" {
+		t.Errorf("expected the row's tag to be written for node1, got %+v", store.metadata["node1"])
+	}
+	if _, ok := store.metadata["node2"]; ok {
+		t.Error("expected no scheduling metadata for an untagged row")
+	}
+}
+
+func TestBatchCSVNoHeader(t *testing.T) {
+	rows, parseErrs := readBatchCSV(strings.NewReader("node1,/tmp/foo.yaml\nnode2,/tmp/bar.yaml,bad-tag\n"), false)
+	if len(rows) != 1 || rows[0].node != "node1" {
+		t.Errorf("expected only the first row to be valid, got %+v", rows)
+	}
+	if len(parseErrs) != 1 {
+		t.Errorf("expected the malformed tag to be an error, got %v", parseErrs)
+	}
+}
+
+func TestRequireIDMatchesFilename(t *testing.T) {
+	dir, err := ioutil.TempDir("", "id-matches-filename")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// foo.yaml contains the pod bar
+	mismatched := filepath.Join(dir, "foo.yaml")
+	err = os.Rename(writeTestManifest(t, dir, "bar"), mismatched)
+	if err != nil {
+		t.Fatal(err)
+	}
+	matched := writeTestManifest(t, dir, "baz")
+
+	store := newFakeIntentStore()
+	s := scheduler{
+		store:     store,
+		podPrefix: consul.INTENT_TREE,
+
+		requireIDMatchesFilename: true,
+	}
+	results := s.scheduleBatch([]batchRow{
+		{line: 1, node: "node1", manifestPath: mismatched},
+		{line: 2, node: "node2", manifestPath: matched},
+	})
+	if results[0].err == nil {
+		t.Error("expected foo.yaml containing the pod bar to be rejected")
+	} else if exitCodeFor(results[0].err) != ExitCodeValidationError {
+		t.Errorf("expected a mismatched filename to be a validation error, got %s", results[0].err)
+	}
+	if len(store.writes("node1")) != 0 {
+		t.Error("expected the mismatched manifest not to be written")
+	}
+	if results[1].err != nil {
+		t.Errorf("unexpected error scheduling baz.yaml: %s", results[1].err)
+	}
+	if len(store.writes("node2")) != 1 {
+		t.Error("expected the matching manifest to be written")
+	}
+
+	code := run([]string{"--consul", closedAddress(t), "--node", "node1", "--require-id-matches-filename", mismatched})
+	if code != ExitCodeValidationError {
+		t.Errorf("expected exit code %d for a mismatched filename, got %d", ExitCodeValidationError, code)
+	}
+}
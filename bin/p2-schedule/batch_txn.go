@@ -0,0 +1,125 @@
+package main
+
+import (
+	"time"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/transaction"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// podTxn is the subset of *consul.Txn used by --atomic-batch
+type podTxn interface {
+	SetPod(podPrefix consul.PodPrefix, nodename types.NodeName, manifest manifest.Manifest) error
+	Commit() (time.Duration, error)
+	Cancel()
+}
+
+// txnWriteLimit returns how many legacy pods can be written in one
+// transaction.
+func (s scheduler) txnWriteLimit() int {
+	if s.maxTxnWrites > 0 {
+		return s.maxTxnWrites
+	}
+	return transaction.MaxOperations
+}
+
+// scheduleBatchTxn schedules every row in a single consul transaction, so
+// that either every row is written or none are. The checks for every row are
+// run first, and nothing is written if any of them fail or if parseErr, the
+// failure to parse some rows of the batch file, is non-nil. Scheduling
+// metadata is written once the transaction commits. Results are returned in
+// the order of the rows.
+func (s scheduler) scheduleBatchTxn(rows []batchRow, parseErr error) ([]batchResult, error) {
+	if s.uuidPod {
+		return nil, util.Errorf("uuid pods cannot be scheduled transactionally")
+	}
+	if s.plan != nil || s.dryRun != nil {
+		// Nothing is written, so there is nothing to make atomic
+		return s.scheduleBatch(rows), nil
+	}
+	if len(rows) > s.txnWriteLimit() {
+		return nil, validationError(util.Errorf("Cannot schedule %d rows in one transaction, the limit is %d", len(rows), s.txnWriteLimit()))
+	}
+
+	results := make([]batchResult, len(rows))
+	schedulers := make([]scheduler, len(rows))
+	manifests := make([]manifest.Manifest, len(rows))
+	failure := parseErr
+	for i, row := range rows {
+		results[i] = batchResult{row: row}
+		rowScheduler, podManifest, err := s.prepareRow(row)
+		if podManifest != nil {
+			results[i].podID = podManifest.ID()
+			results[i].out.PodID = podManifest.ID()
+		}
+		if err == nil {
+			podManifest, err = rowScheduler.check(row.node, podManifest)
+		}
+		if err == nil {
+			results[i].out.Unchanged, err = rowScheduler.checkLegacy(row.node, podManifest)
+		}
+		if err != nil {
+			results[i].err = wrapError(err, "line %d: %s", row.line, err)
+			if failure == nil {
+				failure = results[i].err
+			}
+			continue
+		}
+		schedulers[i] = rowScheduler
+		manifests[i] = podManifest
+	}
+
+	if failure == nil {
+		failure = s.commitBatch(results, manifests)
+	}
+
+	for i := range results {
+		switch {
+		case results[i].err != nil:
+		case failure != nil:
+			// The exit code is that of the failure that stopped the write
+			results[i].err = wrapError(failure, "line %d: not written because the batch failed: %s", results[i].row.line, failure)
+		case !results[i].out.Unchanged:
+			err := schedulers[i].writeSchedulingMetadata(results[i].row.node, manifests[i])
+			if err != nil {
+				results[i].err = wrapError(err, "line %d: %s", results[i].row.line, err)
+			}
+		}
+		if manifests[i] != nil {
+			schedulers[i].recordOutcome(results[i].row.node, manifests[i], results[i].out, results[i].err)
+		}
+	}
+	return results, nil
+}
+
+// commitBatch writes the manifest of every changed row in one transaction.
+// If the transaction fails the error is set on every row that would have been
+// written, and returned.
+func (s scheduler) commitBatch(results []batchResult, manifests []manifest.Manifest) error {
+	txn := s.newTxn()
+	defer txn.Cancel()
+	for i, result := range results {
+		if result.out.Unchanged {
+			continue
+		}
+		err := txn.SetPod(s.podPrefix, result.row.node, manifests[i])
+		if err != nil {
+			return util.Errorf("line %d: could not add %s to the transaction: %s", result.row.line, result.podID, err)
+		}
+	}
+
+	_, err := txn.Commit()
+	if err == nil {
+		return nil
+	}
+	err = storeError(util.Errorf("Could not write the batch: %s", err))
+	for i := range results {
+		if !results[i].out.Unchanged {
+			results[i].err = err
+		}
+	}
+	return err
+}
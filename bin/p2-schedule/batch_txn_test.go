@@ -0,0 +1,114 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// fakeTxn makes its writes to store when committed, unless fail is set
+type fakeTxn struct {
+	store  *fakeIntentStore
+	fail   bool
+	writes map[types.NodeName]manifest.Manifest
+}
+
+func (f *fakeTxn) SetPod(podPrefix consul.PodPrefix, nodename types.NodeName, podManifest manifest.Manifest) error {
+	f.writes[nodename] = podManifest
+	return nil
+}
+
+func (f *fakeTxn) Commit() (time.Duration, error) {
+	if f.fail {
+		return 0, util.Errorf("transaction was rolled back")
+	}
+	for node, podManifest := range f.writes {
+		_, err := f.store.SetPod(consul.INTENT_TREE, node, podManifest)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return 0, nil
+}
+
+func (f *fakeTxn) Cancel() {}
+
+func txnScheduler(store *fakeIntentStore, fail bool) scheduler {
+	return scheduler{
+		store:     store,
+		podPrefix: consul.INTENT_TREE,
+		newTxn: func() podTxn {
+			return &fakeTxn{store: store, fail: fail, writes: make(map[types.NodeName]manifest.Manifest)}
+		},
+	}
+}
+
+func TestScheduleBatchTxn(t *testing.T) {
+	dir, err := ioutil.TempDir("", "batch-txn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	rows := []batchRow{
+		{line: 1, node: "node1", manifestPath: writeTestManifest(t, dir, "foo"), tags: map[string]string{"release": "x"}},
+		{line: 2, node: "node2", manifestPath: writeTestManifest(t, dir, "bar")},
+	}
+
+	store := newFakeIntentStore()
+	results, err := txnScheduler(store, false).scheduleBatchTxn(rows, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, result := range results {
+		if result.err != nil {
+			t.Errorf("unexpected error scheduling line %d: %s", result.row.line, result.err)
+		}
+		if len(store.writes(result.row.node)) != 1 {
+			t.Errorf("expected one write to %s, got %d", result.row.node, len(store.writes(result.row.node)))
+		}
+	}
+	if store.metadata["node1"].Tags["release"] != "x" {
+		t.Errorf("expected the row's tag to be written for node1, got %+v", store.metadata["node1"])
+	}
+}
+
+func TestScheduleBatchTxnWritesNothingOnFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "batch-txn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	foo := writeTestManifest(t, dir, "foo")
+	good := batchRow{line: 1, node: "node1", manifestPath: foo}
+	missing := batchRow{line: 2, node: "node2", manifestPath: filepath.Join(dir, "missing.yaml")}
+
+	store := newFakeIntentStore()
+	results, err := txnScheduler(store, false).scheduleBatchTxn([]batchRow{good, missing}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, result := range results {
+		if exitCodeFor(result.err) != ExitCodeValidationError {
+			t.Errorf("expected line %d to fail with the validation error of line 2, got %v", result.row.line, result.err)
+		}
+	}
+
+	results, err = txnScheduler(store, true).scheduleBatchTxn([]batchRow{good}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if exitCodeFor(results[0].err) != ExitCodeStoreError {
+		t.Errorf("expected a store error when the transaction fails, got %v", results[0].err)
+	}
+
+	if len(store.writes("node1")) != 0 {
+		t.Errorf("expected nothing to be written to node1, got %v", store.writes("node1"))
+	}
+}
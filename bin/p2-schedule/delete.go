@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// unschedule removes a legacy pod from a node's intent. Unless force is set,
+// the operator is asked to confirm on in, with the prompt written to out.
+// Pods managed by a replication controller should be removed with p2-rm
+// instead, since the RC would reschedule them.
+func (s scheduler) unschedule(node types.NodeName, podID types.PodID, force bool, in io.Reader, out io.Writer) error {
+	_, _, err := s.store.Pod(s.podPrefix, node, podID)
+	switch {
+	case err == pods.NoCurrentManifest:
+		return util.Errorf("%s is not scheduled on %s", podID, node)
+	case err != nil:
+		return storeError(util.Errorf("Could not read the current manifest for %s on %s: %s", podID, node, err))
+	}
+
+	if !force && !confirm(in, out, fmt.Sprintf("Remove %s from the %s of %s?", podID, s.podPrefix, node)) {
+		return util.Errorf("Not removing %s from %s", podID, node)
+	}
+
+	_, err = s.store.DeletePod(s.podPrefix, node, podID)
+	if err != nil {
+		return storeError(util.Errorf("Could not remove %s from %s: %s", podID, node, err))
+	}
+	return nil
+}
+
+// confirm asks a yes or no question, returning true only if the answer is
+// yes. Reaching the end of in, e.g. when stdin is not a terminal, is a no.
+func confirm(in io.Reader, out io.Writer, prompt string) bool {
+	fmt.Fprintf(out, "%s [y/N] ", prompt)
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && answer == "" {
+		fmt.Fprintln(out)
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	default:
+		return false
+	}
+}
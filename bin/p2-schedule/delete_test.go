@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/square/p2/pkg/store/consul"
+)
+
+func TestUnschedule(t *testing.T) {
+	store := newFakeIntentStore()
+	_, _ = store.SetPod(consul.INTENT_TREE, "node1", testManifest("foo"))
+	s := scheduler{
+		store:     store,
+		podPrefix: consul.INTENT_TREE,
+	}
+
+	var prompt bytes.Buffer
+	err := s.unschedule("node1", "foo", false, strings.NewReader("n\n"), &prompt)
+	if err == nil {
+		t.Error("expected declining the confirmation to be an error")
+	}
+	if !strings.Contains(prompt.String(), "Remove foo") {
+		t.Errorf("expected to be asked to confirm, got %q", prompt.String())
+	}
+	if len(store.writes("node1")) != 1 {
+		t.Fatal("expected the pod not to be removed without confirmation")
+	}
+
+	// stdin that isn't a terminal is a no
+	err = s.unschedule("node1", "foo", false, strings.NewReader(""), &prompt)
+	if err == nil || len(store.writes("node1")) != 1 {
+		t.Fatal("expected the pod not to be removed without an answer")
+	}
+
+	err = s.unschedule("node1", "foo", false, strings.NewReader("yes\n"), &prompt)
+	if err != nil {
+		t.Fatalf("unexpected error removing the pod: %s", err)
+	}
+	if len(store.writes("node1")) != 0 {
+		t.Error("expected the pod to be removed once confirmed")
+	}
+}
+
+func TestUnscheduleForce(t *testing.T) {
+	store := newFakeIntentStore()
+	_, _ = store.SetPod(consul.INTENT_TREE, "node1", testManifest("foo"))
+	s := scheduler{
+		store:     store,
+		podPrefix: consul.INTENT_TREE,
+	}
+
+	var prompt bytes.Buffer
+	err := s.unschedule("node1", "foo", true, strings.NewReader(""), &prompt)
+	if err != nil {
+		t.Fatalf("unexpected error removing the pod: %s", err)
+	}
+	if prompt.Len() != 0 {
+		t.Errorf("expected --force not to ask for confirmation, got %q", prompt.String())
+	}
+	if len(store.writes("node1")) != 0 {
+		t.Error("expected the pod to be removed")
+	}
+
+	err = s.unschedule("node1", "foo", true, strings.NewReader(""), &prompt)
+	if err == nil {
+		t.Error("expected an error removing a pod that isn't scheduled")
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// dryRun is where --dry-run writes the diff of each legacy pod that would
+// have been written.
+type dryRun struct {
+	out io.Writer
+	// Pods of a batch are diffed concurrently
+	mu sync.Mutex
+}
+
+func newDryRun(out io.Writer) *dryRun {
+	return &dryRun{out: out}
+}
+
+// diffPod writes the differences between podManifest and the manifest
+// currently scheduled for its pod on node to s.dryRun instead of writing it.
+// It is called by write() once every check has passed, in place of setPod().
+// It returns true if there are no differences.
+func (s scheduler) diffPod(node types.NodeName, podManifest manifest.Manifest) (bool, error) {
+	action := "update"
+	current, _, err := s.store.Pod(s.podPrefix, node, podManifest.ID())
+	switch {
+	case err == pods.NoCurrentManifest:
+		action = "create"
+		current = nil
+	case err != nil:
+		return false, storeError(util.Errorf("Could not read the current manifest for %s on %s: %s", podManifest.ID(), node, err))
+	}
+
+	changes, err := manifest.Diff(current, podManifest)
+	if err != nil {
+		return false, util.Errorf("Could not diff %s on %s: %s", podManifest.ID(), node, err)
+	}
+
+	s.dryRun.mu.Lock()
+	defer s.dryRun.mu.Unlock()
+	if len(changes) == 0 {
+		fmt.Fprintf(s.dryRun.out, "%s/%s: no changes\n", node, podManifest.ID())
+		return true, nil
+	}
+	fmt.Fprintf(s.dryRun.out, "%s/%s: would %s\n", node, podManifest.ID(), action)
+	for _, change := range changes {
+		fmt.Fprintf(s.dryRun.out, "  %s\n", change)
+	}
+	return false, nil
+}
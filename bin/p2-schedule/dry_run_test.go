@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/square/p2/pkg/store/consul"
+)
+
+func TestDryRunPrintsDiffWithoutWriting(t *testing.T) {
+	store := newFakeIntentStore()
+	_, err := store.SetPod(consul.INTENT_TREE, "node1", testManifest("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	s := scheduler{
+		store:     store,
+		podPrefix: consul.INTENT_TREE,
+		dryRun:    newDryRun(&out),
+	}
+
+	builder := testManifest("foo").GetBuilder()
+	builder.SetRunAsUser("foo")
+	_, err = s.schedule("node1", builder.GetManifest())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	_, err = s.schedule("node2", testManifest("foo"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	outcome, err := s.schedule("node1", testManifest("foo"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !outcome.Unchanged {
+		t.Error("expected the pod to be reported unchanged when there is no diff")
+	}
+
+	expected := "node1/foo: would update\n  + run_as: foo\nnode2/foo: would create\n  + id: foo\nnode1/foo: no changes\n"
+	if out.String() != expected {
+		t.Errorf("expected the diffs:\n%s\ngot:\n%s", expected, out.String())
+	}
+	if writes := store.writes("node1"); len(writes) != 1 {
+		t.Errorf("expected only the original write to node1, got %v", writes)
+	}
+	if writes := store.writes("node2"); len(writes) != 0 {
+		t.Errorf("expected nothing to be written to node2, got %v", writes)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+const (
+	errorFormatText = "text"
+	errorFormatJSON = "json"
+)
+
+// scheduleError is a single entry of the --format-errors=json output
+type scheduleError struct {
+	PodID types.PodID    `json:"pod_id"`
+	Node  types.NodeName `json:"node"`
+	Error string         `json:"error"`
+}
+
+// errorReporter reports the pods that could not be scheduled. By default
+// each error is logged as it happens. With --format-errors=json the errors
+// are collected instead and written to stderr as a single JSON array by
+// flush(), and no other prose is logged, so that CI jobs can parse stderr.
+type errorReporter struct {
+	json bool
+	out  io.Writer
+
+	mu     sync.Mutex
+	errors []scheduleError
+}
+
+func newErrorReporter(format string) (*errorReporter, error) {
+	switch format {
+	case errorFormatText, "":
+		return &errorReporter{out: os.Stderr}, nil
+	case errorFormatJSON:
+		return &errorReporter{json: true, out: os.Stderr}, nil
+	default:
+		return nil, util.Errorf("Unknown error format %q, expected %s or %s", format, errorFormatText, errorFormatJSON)
+	}
+}
+
+// report reports that podID could not be scheduled to node. Either may be
+// empty if it isn't known, e.g. when a manifest could not be read. Unless
+// errors are JSON formatted, message is logged; it should describe err. It
+// is safe to call concurrently.
+func (r *errorReporter) report(podID types.PodID, node types.NodeName, err error, message string) {
+	if r == nil || !r.json {
+		log.Println(message)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errors = append(r.errors, scheduleError{
+		PodID: podID,
+		Node:  node,
+		Error: err.Error(),
+	})
+}
+
+// logf logs prose such as a summary of the pods scheduled. It is dropped when
+// errors are JSON formatted.
+func (r *errorReporter) logf(format string, args ...interface{}) {
+	if r != nil && r.json {
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// flush writes the JSON array of every error reported, which is empty if
+// there were none. It does nothing unless errors are JSON formatted.
+func (r *errorReporter) flush() {
+	if r == nil || !r.json {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	errors := r.errors
+	if errors == nil {
+		errors = []scheduleError{}
+	}
+	errBytes, err := json.Marshal(errors)
+	if err != nil {
+		log.Printf("Could not marshal errors as JSON: %s", err)
+		return
+	}
+	fmt.Fprintln(r.out, string(errBytes))
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// failingIntentStore fails to write the pods in failPods
+type failingIntentStore struct {
+	*fakeIntentStore
+	failPods map[types.PodID]bool
+}
+
+func (s failingIntentStore) SetPod(podPrefix consul.PodPrefix, nodename types.NodeName, podManifest manifest.Manifest) (time.Duration, error) {
+	if s.failPods[podManifest.ID()] {
+		return 0, util.Errorf("consul is unavailable")
+	}
+	return s.fakeIntentStore.SetPod(podPrefix, nodename, podManifest)
+}
+
+func TestFormatErrorsJSON(t *testing.T) {
+	dir, err := ioutil.TempDir("", "format-errors")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	csv := strings.Join([]string{
+		fmt.Sprintf("node1,%s", writeTestManifest(t, dir, "foo")),
+		fmt.Sprintf("node2,%s", writeTestManifest(t, dir, "bar")),
+		fmt.Sprintf("node3,%s", writeTestManifest(t, dir, "baz")),
+	}, "\n")
+	csvPath := filepath.Join(dir, "batch.csv")
+	err = ioutil.WriteFile(csvPath, []byte(csv), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stderr bytes.Buffer
+	s := scheduler{
+		store: failingIntentStore{
+			fakeIntentStore: newFakeIntentStore(),
+			failPods:        map[types.PodID]bool{"bar": true, "baz": true},
+		},
+		podPrefix: consul.INTENT_TREE,
+		errors:    &errorReporter{json: true, out: &stderr},
+	}
+	code := runBatch(s, csvPath, false, false)
+	s.errors.flush()
+	if code != ExitCodePartialSuccess {
+		t.Errorf("expected exit code %d when some pods fail, got %d", ExitCodePartialSuccess, code)
+	}
+
+	var reported []scheduleError
+	err = json.Unmarshal(stderr.Bytes(), &reported)
+	if err != nil {
+		t.Fatalf("expected stderr to be only a JSON array, got %q: %s", stderr.String(), err)
+	}
+	if len(reported) != 2 {
+		t.Fatalf("expected the 2 failed pods to be reported, got %+v", reported)
+	}
+	failed := make(map[types.PodID]types.NodeName)
+	for _, e := range reported {
+		failed[e.PodID] = e.Node
+		if !strings.Contains(e.Error, "consul is unavailable") {
+			t.Errorf("expected the store error to be reported for %s, got %q", e.PodID, e.Error)
+		}
+	}
+	if failed["bar"] != "node2" || failed["baz"] != "node3" {
+		t.Errorf("expected bar on node2 and baz on node3 to be reported, got %+v", reported)
+	}
+}
+
+func TestFormatErrorsJSONWithoutErrors(t *testing.T) {
+	var stderr bytes.Buffer
+	r := &errorReporter{json: true, out: &stderr}
+	r.logf("Wrote %d pods", 1)
+	r.flush()
+	if stderr.String() != "[]\n" {
+		t.Errorf("expected an empty JSON array and no prose, got %q", stderr.String())
+	}
+}
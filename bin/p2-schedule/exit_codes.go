@@ -0,0 +1,88 @@
+package main
+
+import (
+	"github.com/square/p2/pkg/util"
+)
+
+// exitCode is the status p2-schedule exits with. Build scripts use it to
+// decide whether a failure is worth retrying.
+type exitCode int
+
+const (
+	ExitCodeSuccess exitCode = 0
+	// Any failure not covered below, e.g. a rejected manifest
+	ExitCodeError exitCode = 1
+	// The manifest is invalid and retrying will not help
+	ExitCodeValidationError exitCode = 2
+	// Consul could not be reached or failed the request, so retrying may
+	// succeed
+	ExitCodeStoreError exitCode = 3
+	// Some but not all of several pods were scheduled
+	ExitCodePartialSuccess exitCode = 4
+	// The pods were scheduled but did not all become healthy before
+	// --health-timeout
+	ExitCodeUnhealthy exitCode = 5
+)
+
+// codedError is an error that causes p2-schedule to exit with a code other
+// than ExitCodeError
+type codedError struct {
+	code exitCode
+	err  error
+}
+
+func (e codedError) Error() string {
+	return e.err.Error()
+}
+
+func validationError(err error) error {
+	return codedError{code: ExitCodeValidationError, err: err}
+}
+
+func storeError(err error) error {
+	return codedError{code: ExitCodeStoreError, err: err}
+}
+
+// exitCodeFor returns the code p2-schedule should exit with after err.
+func exitCodeFor(err error) exitCode {
+	if err == nil {
+		return ExitCodeSuccess
+	}
+	if coded, ok := err.(codedError); ok {
+		return coded.code
+	}
+	return ExitCodeError
+}
+
+// wrapError returns an error with the message util.Errorf(format, args...)
+// and the same exit code as err.
+func wrapError(err error, format string, args ...interface{}) error {
+	wrapped := util.Errorf(format, args...)
+	if code := exitCodeFor(err); code != ExitCodeError {
+		return codedError{code: code, err: wrapped}
+	}
+	return wrapped
+}
+
+// resultsExitCode returns the exit code after scheduling several pods, of
+// which succeeded were scheduled and errs are the failures. If every pod
+// failed for the same kind of reason, that reason's code is used.
+func resultsExitCode(succeeded int, errs []error) exitCode {
+	if len(errs) == 0 {
+		if succeeded == 0 {
+			return ExitCodeError
+		}
+		return ExitCodeSuccess
+	}
+	if succeeded > 0 {
+		return ExitCodePartialSuccess
+	}
+
+	code := exitCodeFor(errs[0])
+	for _, err := range errs[1:] {
+		if exitCodeFor(err) != code {
+			return ExitCodeError
+		}
+	}
+	return code
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// closedAddress returns an address that refuses connections, to simulate an
+// unreachable consul agent
+func closedAddress(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	return addr
+}
+
+func TestRunExitsWithValidationErrorForInvalidManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exit-codes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// launchables must have a launchable_type
+	path := filepath.Join(dir, "invalid.yaml")
+	err = ioutil.WriteFile(path, []byte("id: foo\nlaunchables:\n  app:\n    location: https://localhost/app_abc123.tar.gz\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code := run([]string{"--consul", closedAddress(t), "--node", "node1", path})
+	if code != ExitCodeValidationError {
+		t.Errorf("expected exit code %d for an invalid manifest, got %d", ExitCodeValidationError, code)
+	}
+}
+
+func TestRunExitsWithStoreErrorWhenConsulIsUnreachable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exit-codes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeTestManifest(t, dir, "foo")
+	code := run([]string{"--consul", closedAddress(t), "--node", "node1", path})
+	if code != ExitCodeStoreError {
+		t.Errorf("expected exit code %d when consul is unreachable, got %d", ExitCodeStoreError, code)
+	}
+}
+
+func TestResultsExitCode(t *testing.T) {
+	other := errors.New("rejected")
+	store := storeError(errors.New("consul is down"))
+	validation := validationError(errors.New("too big"))
+
+	for _, test := range []struct {
+		name      string
+		succeeded int
+		errs      []error
+		expected  exitCode
+	}{
+		{"all succeeded", 2, nil, ExitCodeSuccess},
+		{"nothing scheduled", 0, nil, ExitCodeError},
+		{"some failed", 1, []error{store}, ExitCodePartialSuccess},
+		{"all failed on the store", 0, []error{store, wrapError(store, "line 2: %s", store)}, ExitCodeStoreError},
+		{"all failed validation", 0, []error{validation}, ExitCodeValidationError},
+		{"all failed differently", 0, []error{store, validation}, ExitCodeError},
+		{"all failed otherwise", 0, []error{other}, ExitCodeError},
+	} {
+		code := resultsExitCode(test.succeeded, test.errs)
+		if code != test.expected {
+			t.Errorf("%s: expected exit code %d, got %d", test.name, test.expected, code)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+const defaultHealthPollInterval = 5 * time.Second
+
+// healthTarget is a pod that was scheduled and must become healthy
+type healthTarget struct {
+	node     types.NodeName
+	manifest manifest.Manifest
+}
+
+// statusURL returns the status endpoint described by the pod's manifest, or
+// the empty string if it does not have one.
+func (t healthTarget) statusURL() string {
+	port := t.manifest.GetStatusPort()
+	if port == 0 {
+		return ""
+	}
+	scheme := "https"
+	if t.manifest.GetStatusHTTP() {
+		scheme = "http"
+	}
+	return fmt.Sprintf("%s://%s:%d%s", scheme, t.node, port, t.manifest.GetStatusPath())
+}
+
+// healthWaiter records every pod that is scheduled so that p2-schedule can
+// wait for them to become healthy before exiting. It is shared by every copy
+// of a scheduler.
+type healthWaiter struct {
+	client       *http.Client
+	timeout      time.Duration
+	pollInterval time.Duration
+
+	mu      sync.Mutex
+	targets []healthTarget
+}
+
+func newHealthWaiter(timeout time.Duration) *healthWaiter {
+	return &healthWaiter{
+		client:       http.DefaultClient,
+		timeout:      timeout,
+		pollInterval: defaultHealthPollInterval,
+	}
+}
+
+func (w *healthWaiter) add(node types.NodeName, podManifest manifest.Manifest) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.targets = append(w.targets, healthTarget{node: node, manifest: podManifest})
+}
+
+// wait polls the status endpoint of every scheduled pod until all of them are
+// healthy, logging a line per pod each time one is checked. An error is
+// returned if any pod is still unhealthy after the timeout. Pods without a
+// status port cannot be checked and are skipped.
+func (w *healthWaiter) wait() error {
+	w.mu.Lock()
+	targets := make([]healthTarget, len(w.targets))
+	copy(targets, w.targets)
+	w.mu.Unlock()
+
+	pending := make(map[int]health.HTTPHealthChecker)
+	for i, target := range targets {
+		url := target.statusURL()
+		if url == "" {
+			log.Printf("%s on %s has no status port, not waiting for it to be healthy", target.manifest.ID(), target.node)
+			continue
+		}
+		pending[i] = health.HTTPHealthChecker{Client: w.client, URL: url}
+	}
+
+	start := time.Now()
+	deadline := start.Add(w.timeout)
+	for {
+		for i, checker := range pending {
+			target := targets[i]
+			state, err := checker.Check()
+			elapsed := time.Since(start) / time.Millisecond * time.Millisecond
+			if err != nil {
+				log.Printf("%s on %s: %s after %s: %s", target.manifest.ID(), target.node, state, elapsed, err)
+				continue
+			}
+			log.Printf("%s on %s: %s after %s", target.manifest.ID(), target.node, state, elapsed)
+			delete(pending, i)
+		}
+
+		if len(pending) == 0 {
+			return nil
+		}
+		if !time.Now().Add(w.pollInterval).Before(deadline) {
+			return util.Errorf("%d pods were not healthy after %s", len(pending), w.timeout)
+		}
+		time.Sleep(w.pollInterval)
+	}
+}
+
+// finish waits for the scheduled pods to become healthy if --wait-for-health
+// was given and anything was scheduled. code is the exit code after
+// scheduling, and the exit code after waiting is returned.
+func (s scheduler) finish(code exitCode) exitCode {
+	if s.plan != nil {
+		// Nothing was written, so there is nothing to wait for
+		return s.plan.save(code)
+	}
+	if s.healthWaiter == nil || (code != ExitCodeSuccess && code != ExitCodePartialSuccess) {
+		return code
+	}
+	err := s.healthWaiter.wait()
+	if err != nil {
+		log.Println(err)
+		return ExitCodeUnhealthy
+	}
+	return code
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/types"
+)
+
+// flakyStatusServer returns 503 from its status endpoint the first unhealthy
+// times it is checked, then 200
+type flakyStatusServer struct {
+	mu        sync.Mutex
+	unhealthy int
+	checks    int
+}
+
+func (f *flakyStatusServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.checks++
+	if r.URL.Path != "/_status" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if f.checks <= f.unhealthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// statusManifest returns a manifest whose status endpoint is served by
+// server, along with the node it should be scheduled to
+func statusManifest(t *testing.T, server *httptest.Server) (types.NodeName, manifest.Manifest) {
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	portNum, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder := manifest.NewBuilder()
+	builder.SetID("hello")
+	builder.SetStatusHTTP(true)
+	builder.SetStatusPort(portNum)
+	return types.NodeName(host), builder.GetManifest()
+}
+
+func testHealthScheduler(timeout time.Duration) scheduler {
+	waiter := newHealthWaiter(timeout)
+	waiter.pollInterval = 10 * time.Millisecond
+	return scheduler{
+		store:        newFakeIntentStore(),
+		podPrefix:    "intent",
+		healthWaiter: waiter,
+	}
+}
+
+func TestWaitForHealthWaitsUntilHealthy(t *testing.T) {
+	status := &flakyStatusServer{unhealthy: 2}
+	server := httptest.NewServer(status)
+	defer server.Close()
+
+	s := testHealthScheduler(time.Second)
+	node, podManifest := statusManifest(t, server)
+	_, err := s.schedule(node, podManifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code := s.finish(ExitCodeSuccess)
+	if code != ExitCodeSuccess {
+		t.Errorf("expected exit code %d once the pod was healthy, got %d", ExitCodeSuccess, code)
+	}
+	if status.checks != 3 {
+		t.Errorf("expected the status endpoint to be checked 3 times, was checked %d times", status.checks)
+	}
+}
+
+func TestWaitForHealthTimesOut(t *testing.T) {
+	status := &flakyStatusServer{unhealthy: 1000}
+	server := httptest.NewServer(status)
+	defer server.Close()
+
+	s := testHealthScheduler(50 * time.Millisecond)
+	node, podManifest := statusManifest(t, server)
+	_, err := s.schedule(node, podManifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code := s.finish(ExitCodeSuccess)
+	if code != ExitCodeUnhealthy {
+		t.Errorf("expected exit code %d for a pod that never became healthy, got %d", ExitCodeUnhealthy, code)
+	}
+}
+
+func TestWaitForHealthSkipsFailedScheduling(t *testing.T) {
+	s := testHealthScheduler(time.Second)
+	s.healthWaiter.add("node1", testManifest("hello"))
+
+	code := s.finish(ExitCodeStoreError)
+	if code != ExitCodeStoreError {
+		t.Errorf("expected the scheduling exit code to be kept, got %d", code)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// rejectedError is returned when a pre-schedule hook refuses a manifest. The
+// manifest is skipped rather than treated as a scheduling failure.
+type rejectedError struct {
+	podID  types.PodID
+	node   types.NodeName
+	reason string
+}
+
+func (r rejectedError) Error() string {
+	return fmt.Sprintf("pre-schedule hook rejected %s on %s: %s", r.podID, r.node, r.reason)
+}
+
+func isRejected(err error) bool {
+	_, ok := err.(rejectedError)
+	return ok
+}
+
+// runPreScheduleHook executes the hook binary at hookPath with the manifest's
+// YAML on stdin and the target node in the P2_NODE environment variable. A zero
+// exit status approves the manifest. Any other exit status rejects it, with
+// the hook's stderr used as the reason.
+func runPreScheduleHook(hookPath string, node types.NodeName, podManifest manifest.Manifest) error {
+	manifestBytes, err := podManifest.Marshal()
+	if err != nil {
+		return util.Errorf("Could not marshal %s for pre-schedule hook: %s", podManifest.ID(), err)
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(hookPath)
+	cmd.Stdin = bytes.NewReader(manifestBytes)
+	cmd.Stderr = &stderr
+	cmd.Env = append(os.Environ(), "P2_NODE="+node.String())
+
+	err = cmd.Run()
+	if _, ok := err.(*exec.ExitError); ok {
+		reason := strings.TrimSpace(stderr.String())
+		if reason == "" {
+			reason = err.Error()
+		}
+		return rejectedError{
+			podID:  podManifest.ID(),
+			node:   node,
+			reason: reason,
+		}
+	}
+	if err != nil {
+		return util.Errorf("Could not run pre-schedule hook %s: %s", hookPath, err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul"
+)
+
+// Rejects manifests with env.ALLOW=false, and anything not targeted at a node
+const policyHook = `#!/bin/sh
+if [ -z "$P2_NODE" ]; then
+	echo "P2_NODE not set" >&2
+	exit 1
+fi
+if grep -q 'ALLOW: "false"'; then
+	echo "ALLOW=false is not permitted on $P2_NODE" >&2
+	exit 1
+fi
+exit 0
+`
+
+func writePolicyHook(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "pre_schedule_hook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hookPath := filepath.Join(dir, "hook")
+	err = ioutil.WriteFile(hookPath, []byte(policyHook), 0755)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return hookPath, func() { os.RemoveAll(dir) }
+}
+
+func manifestWithAllow(t *testing.T, allow string) manifest.Manifest {
+	builder := manifest.NewBuilder()
+	builder.SetID("foo")
+	err := builder.SetConfig(map[interface{}]interface{}{
+		"env": map[interface{}]interface{}{
+			"ALLOW": allow,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return builder.GetManifest()
+}
+
+func TestPreScheduleHookRejects(t *testing.T) {
+	hookPath, cleanup := writePolicyHook(t)
+	defer cleanup()
+
+	store := newFakeIntentStore()
+	s := scheduler{
+		store:           store,
+		podPrefix:       consul.INTENT_TREE,
+		preScheduleHook: hookPath,
+	}
+
+	_, err := s.schedule("node1", manifestWithAllow(t, "false"))
+	if !isRejected(err) {
+		t.Fatalf("expected manifest with ALLOW=false to be rejected, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "ALLOW=false is not permitted on node1") {
+		t.Errorf("expected rejection reason from hook stderr, got %q", err.Error())
+	}
+	if len(store.writes("node1")) != 0 {
+		t.Error("rejected manifest should not have been written")
+	}
+}
+
+func TestPreScheduleHookApproves(t *testing.T) {
+	hookPath, cleanup := writePolicyHook(t)
+	defer cleanup()
+
+	store := newFakeIntentStore()
+	s := scheduler{
+		store:           store,
+		podPrefix:       consul.INTENT_TREE,
+		preScheduleHook: hookPath,
+	}
+
+	_, err := s.schedule("node1", manifestWithAllow(t, "true"))
+	if err != nil {
+		t.Fatalf("expected manifest to be approved: %s", err)
+	}
+	if len(store.writes("node1")) != 1 {
+		t.Error("approved manifest should have been written")
+	}
+}
@@ -6,74 +6,455 @@ import (
 	"log"
 	"os"
 
-	"github.com/square/p2/pkg/manifest"
-	"github.com/square/p2/pkg/schedule"
+	"github.com/square/p2/pkg/artifact"
+	"github.com/square/p2/pkg/auth"
 	"github.com/square/p2/pkg/store/consul"
 	"github.com/square/p2/pkg/store/consul/flags"
 	"github.com/square/p2/pkg/store/consul/podstore"
 	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/uri"
+	"github.com/square/p2/pkg/util"
 	"github.com/square/p2/pkg/version"
 
+	"github.com/pborman/uuid"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
-var (
-	manifestPath = kingpin.Arg("manifest", "a manifest file to schedule in the intent store").String()
-	nodeName     = kingpin.Flag("node", "The node to do the scheduling on. Uses the hostname by default.").String()
-	hookGlobal   = kingpin.Flag("hook", "Schedule as a global hook.").Bool()
-	uuidPod      = kingpin.Flag("uuid-pod", "Schedule the pod using the new UUID scheme").Bool()
-)
-
 func main() {
-	kingpin.Version(version.VERSION)
-	_, opts, _ := flags.ParseWithConsulOptions()
+	os.Exit(int(run(os.Args[1:])))
+}
+
+// run schedules according to the command line args and returns the code the
+// process should exit with.
+func run(args []string) exitCode {
+	app := kingpin.New("p2-schedule", "Schedule pod manifests in the intent store")
+	app.Version(version.VERSION)
+
+	manifestPath := app.Arg("manifest", "a manifest file to schedule in the intent store").String()
+	nodeName := app.Flag("node", "The node to do the scheduling on. Uses the hostname by default.").String()
+	hookGlobal := app.Flag("hook", "Schedule as a global hook.").Bool()
+	uuidPod := app.Flag("uuid-pod", "Schedule the pod using the new UUID scheme").Bool()
+	prefetchOnly := app.Flag("prefetch-only", "Stage legacy pods in the prefetch tree instead of the intent tree: the preparer installs them without launching, and removes them once installed. Scheduling the same manifest without this flag then launches them quickly. With --delete, unstages the pod.").Bool()
+
+	requireApproval := app.Flag("require-approval", "Require approval from --approval-backend before writing each intent.").Bool()
+	approvalBackend := app.Flag("approval-backend", "The URL of the release approval system, e.g. https://approvals.example.com/requests").URL()
+	approvalTimeout := app.Flag("approval-timeout", "How long to wait for an approval decision before giving up.").Default("10m").Duration()
+
+	tags := app.Flag("tag", "A tag, in KEY=VALUE form, to record in the scheduling metadata of each pod. Can be specified multiple times.").StringMap()
+
+	preScheduleHook := app.Flag("pre-schedule-hook", "A binary that receives each manifest on stdin (and the node as P2_NODE) and must exit 0 for it to be scheduled.").ExistingFile()
+
+	maxManifestSize := app.Flag("max-manifest-size", "Refuse to schedule manifests larger than this many bytes, including any signature. Consul rejects values over 512KB.").Default("512000").Int()
+
+	requireCurrentVersion := app.Flag("require-current-version", "Only replace a legacy pod if the manifest currently scheduled has this SHA, e.g. to enforce an upgrade path.").String()
+
+	batchCSV := app.Flag("batch-csv", "Schedule every row of a CSV file with the columns node,manifest_path,tag instead of a single manifest. tag is optional and in KEY=VALUE form.").ExistingFile()
+	noHeader := app.Flag("no-header", "The --batch-csv file has no header row").Bool()
+	atomicBatch := app.Flag("atomic-batch", "Write every row of --batch-csv in a single consul transaction: either every row is written or none are. Limited to 64 rows.").Bool()
+
+	consulQuery := app.Flag("consul-query", "Schedule the manifest to every node returned by this consul prepared query (name or ID) instead of a single node.").String()
+
+	nodeGlob := app.Flag("node-glob", "Schedule the manifest to a node for each file matching this glob, named after the file without its extension, e.g. '/etc/p2/nodes/web-*.yaml'.").String()
+	nodeSelector := app.Flag("selector", "Schedule the manifest to every node whose labels match this selector, e.g. 'az=us-east-1,role=api' or 'role in (api, worker)'.").String()
+	nodeList := app.Flag("nodes", "Schedule the manifest to every node in this comma separated list, or in this file of one node per line, in a single consul transaction: either every node is written or none are.").String()
+
+	requireIDMatchesFilename := app.Flag("require-id-matches-filename", "Refuse to schedule a manifest unless its pod ID matches its filename without the extension, e.g. myapp.yaml must contain the pod myapp.").Bool()
+
+	idempotent := app.Flag("idempotent", "Skip writing legacy pods whose manifest is already scheduled with the same SHA, avoiding needless consul writes and redeploys.").Bool()
+
+	waitForHealth := app.Flag("wait-for-health", "After scheduling, wait until every scheduled pod's status endpoint reports healthy.").Bool()
+	healthTimeout := app.Flag("health-timeout", "How long --wait-for-health waits for the pods to become healthy.").Default("10m").Duration()
+
+	podTimeout := app.Flag("pod-timeout", "How long to wait for each pod to be written to consul before reporting it as failed.").Default("10s").Duration()
+
+	formatErrors := app.Flag("format-errors", "How to write scheduling errors to stderr: text, or json for a single JSON array of {pod_id, node, error} objects with no other prose.").Default(errorFormatText).Enum(errorFormatText, errorFormatJSON)
+
+	savePlan := app.Flag("save-plan", "Write the legacy pod writes that would be made to this file as a JSON plan, instead of making them. See --apply-plan.").String()
+	applyPlan := app.Flag("apply-plan", "Make the writes of a plan saved with --save-plan instead of scheduling a manifest.").ExistingFile()
+	maxPlanAge := app.Flag("max-plan-age", "Refuse to apply plans saved longer ago than this, since the pods they were planned against have likely changed.").Default("1h").Duration()
+
+	setValues := app.Flag("set", "A value, in KEY=VALUE form, to render manifests with, e.g. for {{ .Values.KEY }}. Can be specified multiple times, and overrides --values.").StringMap()
+	valuesPath := app.Flag("values", "A YAML file of values to render manifests and overlays with. Deploy time variables, {{ .Var \"NAME\" }}, are left alone.").ExistingFile()
+
+	artifactIndex := app.Flag("artifact-index", "Pin launchables that name a version, or id: latest with a channel tag, to the location and digest listed in this index: an HTTP index of <name>.json files, or a gs://bucket/prefix listing.").URL()
+	gcsAccessToken := app.Flag("gcs-access-token", "An OAuth access token to read a private gs:// --artifact-index with, e.g. from 'gcloud auth print-access-token'. Set it in the environment rather than on the command line.").Envar("GOOGLE_OAUTH_ACCESS_TOKEN").String()
+	gcsMetadataAuth := app.Flag("gcs-metadata-auth", "Read a private gs:// --artifact-index as the service account of this VM, with tokens from the GCE metadata server.").Bool()
+
+	overlayDir := app.Flag("overlay-dir", "A directory of partial manifests, e.g. for an environment. A file with the same basename as a manifest being scheduled is merged on top of it.").ExistingDir()
+
+	deletePod := app.Flag("delete", "Remove the legacy pod with this ID from --node instead of scheduling a manifest. Asks for confirmation unless --force is given. Use p2-rm for pods managed by a replication controller.").String()
+	force := app.Flag("force", "Remove the --delete pod without asking for confirmation.").Bool()
+
+	dryRunFlag := app.Flag("dry-run", "Print how each legacy pod's manifest differs from the one currently scheduled instead of writing it.").Bool()
+
+	noValidate := app.Flag("no-validate", "Skip the strict checks of each manifest, e.g. for unknown keys and port collisions, that are made before it is scheduled.").Bool()
+	signWithKeyring := app.Flag("sign-with-keyring", "Clearsign each manifest with the secret key in this keyring before it is written, for preparers using keyring or user auth.").ExistingFileOrDir()
+	signingKeyID := app.Flag("signing-key", "The fingerprint or key ID of the --sign-with-keyring key to sign with, if the keyring has several secret keys.").String()
+	signingPassphrase := app.Flag("signing-passphrase", "The passphrase of an encrypted signing key. Set it in the environment rather than on the command line.").Envar("P2_SIGNING_PASSPHRASE").String()
+	noVerify := app.Flag("no-verify", "Skip artifact verification for this pod. For development only: refused on nodes labeled environment=production, and ignored by preparers unless the pod is in their no_verify_whitelist.").Bool()
+
+	_, opts, labeler, err := flags.ParseAppWithConsulOptions(app, args)
+	if err != nil {
+		log.Println(err)
+		return ExitCodeError
+	}
+	errorReporter, err := newErrorReporter(*formatErrors)
+	if err != nil {
+		log.Println(err)
+		return ExitCodeError
+	}
+	defer errorReporter.flush()
+
 	client := consul.NewConsulClient(opts)
-	store := consul.NewConsulStore(client)
+	// Every change to the intent tree is recorded in the audit log
+	opts.AuditUser = operatorIdentity()
+	store := consul.NewConsulStoreWithOptions(client, opts)
 	podStore := podstore.NewConsul(client.KV())
 
-	if *nodeName == "" {
-		hostname, err := os.Hostname()
+	// Legacy pod
+	podPrefix := consul.INTENT_TREE
+	if *hookGlobal {
+		podPrefix = consul.HOOK_TREE
+	}
+	if *prefetchOnly {
+		if *hookGlobal || *uuidPod || *waitForHealth {
+			log.Println("--prefetch-only can only be used with legacy pods, and not with --hook or --wait-for-health")
+			return ExitCodeError
+		}
+		podPrefix = consul.PREFETCH_TREE
+	}
+
+	s := scheduler{
+		store:     store,
+		podStore:  podStore,
+		podPrefix: podPrefix,
+		uuidPod:   *uuidPod,
+		newTxn:    func() podTxn { return store.Txn() },
+		tags:      *tags,
+
+		maxTxnWrites: store.MaxTxnPodWrites(podPrefix),
+
+		preScheduleHook: *preScheduleHook,
+
+		noVerify: *noVerify,
+		labeler:  labeler,
+
+		noValidate: *noValidate,
+
+		maxManifestSize: *maxManifestSize,
+
+		requireCurrentVersion: *requireCurrentVersion,
+
+		requireIDMatchesFilename: *requireIDMatchesFilename,
+		idempotent:               *idempotent,
+
+		podTimeout: *podTimeout,
+
+		overlayDir: *overlayDir,
+
+		errors: errorReporter,
+
+		requestID: uuid.New(),
+	}
+
+	if *signWithKeyring != "" {
+		s.signingKey, err = auth.LoadSigningKey(*signWithKeyring, *signingKeyID, []byte(*signingPassphrase))
+		if err != nil {
+			log.Println(err)
+			return ExitCodeError
+		}
+	}
+
+	if *valuesPath != "" || len(*setValues) > 0 {
+		s.values, err = loadValues(*valuesPath, *setValues)
+		if err != nil {
+			log.Println(err)
+			return ExitCodeValidationError
+		}
+	}
+
+	if *artifactIndex != nil {
+		fetcher, err := artifactIndexFetcher(*gcsAccessToken, *gcsMetadataAuth)
+		if err != nil {
+			log.Println(err)
+			return ExitCodeError
+		}
+		s.resolver = artifact.NewResolver(artifact.NewVersionIndex(*artifactIndex, fetcher))
+	}
+
+	if *waitForHealth {
+		s.healthWaiter = newHealthWaiter(*healthTimeout)
+	}
+
+	if *requireApproval {
+		if *approvalBackend == nil {
+			log.Println("--approval-backend must be set when --require-approval is used")
+			return ExitCodeError
+		}
+		s.approver = newApprover(*approvalBackend, *approvalTimeout)
+	}
+
+	if *dryRunFlag {
+		if *uuidPod || *savePlan != "" || *applyPlan != "" || *deletePod != "" || *waitForHealth {
+			log.Println("--dry-run can only be used to schedule legacy pods, and not with --save-plan, --apply-plan, --delete or --wait-for-health")
+			return ExitCodeError
+		}
+		s.dryRun = newDryRun(os.Stdout)
+	}
+
+	if *applyPlan != "" {
+		if *savePlan != "" {
+			log.Println("Only one of --save-plan and --apply-plan may be used")
+			return ExitCodeError
+		}
+		plan, err := readPlan(*applyPlan, *maxPlanAge)
 		if err != nil {
-			log.Fatalf("Could not get the hostname to do scheduling: %s", err)
+			log.Println(err)
+			return exitCodeFor(err)
 		}
-		*nodeName = hostname
+		return s.finish(s.applyPlan(plan))
+	}
+
+	if *savePlan != "" {
+		if *uuidPod {
+			log.Println("--save-plan can only be used with legacy pods")
+			return ExitCodeError
+		}
+		s.plan = newSchedulePlan(*savePlan)
+	}
+
+	if *deletePod != "" {
+		if *uuidPod {
+			log.Println("--delete can only remove legacy pods, use p2-rm --pod-unique-key for uuid pods")
+			return ExitCodeError
+		}
+		node, err := defaultNode(*nodeName)
+		if err != nil {
+			log.Println(err)
+			return ExitCodeError
+		}
+		err = s.unschedule(node, types.PodID(*deletePod), *force, os.Stdin, os.Stderr)
+		if err != nil {
+			s.errors.report(types.PodID(*deletePod), node, err, err.Error())
+			return exitCodeFor(err)
+		}
+		s.errors.logf("%s: removed %s", node, *deletePod)
+		return ExitCodeSuccess
+	}
+
+	if *batchCSV != "" {
+		return s.finish(runBatch(s, *batchCSV, !*noHeader, *atomicBatch))
 	}
 
 	if *manifestPath == "" {
-		kingpin.Usage()
-		log.Fatalln("No manifest given")
+		app.Usage(args)
+		log.Println("No manifest given")
+		return ExitCodeError
 	}
 
-	podManifest, err := manifest.FromPath(*manifestPath)
+	podManifest, err := s.readManifest(*manifestPath)
 	if err != nil {
-		log.Fatalf("Could not read manifest at %s: %s\n", *manifestPath, err)
+		log.Printf("Could not read manifest at %s: %s\n", *manifestPath, err)
+		return ExitCodeValidationError
 	}
 
-	out := schedule.Output{
-		PodID: podManifest.ID(),
-	}
-	if *uuidPod {
-		out.PodUniqueKey, err = podStore.Schedule(podManifest, types.NodeName(*nodeName))
+	if *requireIDMatchesFilename {
+		err = checkIDMatchesFilename(*manifestPath, podManifest)
 		if err != nil {
-			log.Fatalf("Could not schedule pod: %s", err)
+			s.errors.report(podManifest.ID(), types.NodeName(*nodeName), err, fmt.Sprintf("Skipping %s: %s", podManifest.ID(), err))
+			return exitCodeFor(err)
 		}
-	} else {
+	}
+
+	targets := 0
+	for _, target := range []string{*nodeName, *consulQuery, *nodeGlob, *nodeSelector, *nodeList} {
+		if target != "" {
+			targets++
+		}
+	}
+	if targets > 1 {
+		log.Println("Only one of --node, --consul-query, --node-glob, --selector and --nodes may be used")
+		return ExitCodeError
+	}
 
-		// Legacy pod
-		podPrefix := consul.INTENT_TREE
-		if *hookGlobal {
-			podPrefix = consul.HOOK_TREE
+	if *consulQuery != "" || *nodeGlob != "" || *nodeSelector != "" || *nodeList != "" {
+		var results []nodeResult
+		switch {
+		case *consulQuery != "":
+			results, err = s.scheduleToQuery(consul.NewAPIClient(opts).PreparedQuery(), *consulQuery, podManifest)
+		case *nodeGlob != "":
+			results, err = s.scheduleToGlob(*nodeGlob, podManifest)
+		case *nodeSelector != "":
+			results, err = s.scheduleToSelector(labeler, *nodeSelector, podManifest)
+		default:
+			var nodes []types.NodeName
+			nodes, err = parseNodeList(*nodeList)
+			if err == nil {
+				results, err = s.scheduleNodesTxn(nodes, podManifest)
+			}
 		}
-		_, err := store.SetPod(podPrefix, types.NodeName(*nodeName), podManifest)
 		if err != nil {
-			log.Fatalf("Could not write manifest %s to intent store: %s\n", podManifest.ID(), err)
+			log.Println(err)
+			return exitCodeFor(err)
 		}
+		return s.finish(printNodeResults(results, s.errors))
+	}
+
+	node, err := defaultNode(*nodeName)
+	if err != nil {
+		log.Println(err)
+		return ExitCodeError
+	}
+
+	out, err := s.schedule(node, podManifest)
+	if isRejected(err) {
+		s.errors.report(podManifest.ID(), node, err, fmt.Sprintf("Skipping %s: %s", podManifest.ID(), err))
+		return ExitCodeError
+	}
+	if err != nil {
+		s.errors.report(podManifest.ID(), node, err, err.Error())
+		return exitCodeFor(err)
 	}
 
 	outBytes, err := json.Marshal(out)
 	if err != nil {
-		log.Fatalf("Successfully scheduled manifest but couldn't marshal JSON output")
+		log.Printf("Successfully scheduled manifest but couldn't marshal JSON output")
+		return ExitCodeError
 	}
 
 	fmt.Println(string(outBytes))
+	return s.finish(ExitCodeSuccess)
+}
+
+// defaultNode returns nodeName, or the hostname if it is empty.
+func defaultNode(nodeName string) (types.NodeName, error) {
+	if nodeName != "" {
+		return types.NodeName(nodeName), nil
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", util.Errorf("Could not get the hostname to do scheduling, use --node: %s", err)
+	}
+	return types.NodeName(hostname), nil
+}
+
+// printNodeResults prints one line of JSON output per pod scheduled to one of
+// several nodes, reporting those that failed to errs. It returns the process
+// exit code.
+// artifactIndexFetcher returns the fetcher to read --artifact-index with.
+// Unless GCS credentials are given, only public buckets can be listed.
+func artifactIndexFetcher(gcsAccessToken string, gcsMetadataAuth bool) (uri.Fetcher, error) {
+	var opts uri.GCSFetcherOptions
+	switch {
+	case gcsMetadataAuth:
+		opts.UseMetadataServer = true
+	case gcsAccessToken != "":
+		opts.AccessToken = gcsAccessToken
+	default:
+		return uri.DefaultFetcher, nil
+	}
+	return uri.NewGCSFetcher(opts)
+}
+
+func printNodeResults(results []nodeResult, errs *errorReporter) exitCode {
+	if len(results) == 0 {
+		err := util.Errorf("No nodes to schedule to")
+		errs.report("", "", err, err.Error())
+		return ExitCodeError
+	}
+
+	var failed []error
+	unchanged := 0
+	for _, result := range results {
+		if result.err != nil {
+			errs.report(result.podID, result.node, result.err, fmt.Sprintf("%s: %s", result.node, result.err))
+			failed = append(failed, result.err)
+			continue
+		}
+		if result.out.Unchanged {
+			unchanged++
+		}
+		outBytes, err := json.Marshal(result.out)
+		if err != nil {
+			log.Printf("Successfully scheduled to %s but couldn't marshal JSON output", result.node)
+			continue
+		}
+		fmt.Println(string(outBytes))
+	}
+
+	succeeded := len(results) - len(failed)
+	logSummary(errs, succeeded-unchanged, unchanged, len(failed))
+	return resultsExitCode(succeeded, failed)
+}
+
+// runBatch schedules every row of a batch file in parallel, printing one line
+// of JSON output per scheduled pod. It returns the process exit code.
+func runBatch(s scheduler, path string, hasHeader bool, atomic bool) exitCode {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Printf("Could not open batch file %s: %s", path, err)
+		return ExitCodeError
+	}
+	defer f.Close()
+
+	rows, parseErrs := readBatchCSV(f, hasHeader)
+	// Rows that can't be parsed will never be scheduled
+	var errs []error
+	for _, err := range parseErrs {
+		s.errors.report("", "", err, fmt.Sprintf("Skipping row: %s", err))
+		errs = append(errs, validationError(err))
+	}
+
+	var results []batchResult
+	if atomic {
+		var parseErr error
+		if len(parseErrs) > 0 {
+			parseErr = validationError(util.Errorf("%d rows could not be parsed", len(parseErrs)))
+		}
+		results, err = s.scheduleBatchTxn(rows, parseErr)
+		if err != nil {
+			log.Println(err)
+			return exitCodeFor(err)
+		}
+	} else {
+		// Progress is prose on stderr, which must only hold the JSON
+		// array of errors with --format-errors=json
+		if s.errors == nil || !s.errors.json {
+			s.progress = newProgress(len(rows))
+		}
+		results = s.scheduleBatch(rows)
+		if s.progress != nil {
+			s.progress.finish()
+		}
+	}
+
+	succeeded := 0
+	unchanged := 0
+	for _, result := range results {
+		if result.err != nil {
+			s.errors.report(result.podID, result.row.node, result.err, result.err.Error())
+			errs = append(errs, result.err)
+			continue
+		}
+		succeeded++
+		if result.out.Unchanged {
+			unchanged++
+		}
+		outBytes, err := json.Marshal(result.out)
+		if err != nil {
+			log.Printf("Successfully scheduled line %d but couldn't marshal JSON output", result.row.line)
+			continue
+		}
+		fmt.Println(string(outBytes))
+	}
+
+	logSummary(s.errors, succeeded-unchanged, unchanged, len(errs))
+	return resultsExitCode(succeeded, errs)
+}
+
+// logSummary logs the outcome of scheduling several pods. written and
+// unchanged are counted separately so that --idempotent runs show how much
+// actually changed.
+func logSummary(errs *errorReporter, written int, unchanged int, failed int) {
+	errs.logf("Wrote %d pods, %d unchanged, %d failed", written, unchanged, failed)
 }
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/schedule"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// nodeResult is the outcome of scheduling to one of several nodes
+type nodeResult struct {
+	node  types.NodeName
+	podID types.PodID
+	out   schedule.Output
+	err   error
+}
+
+// scheduleNodes schedules the manifest to each node in turn
+func (s scheduler) scheduleNodes(nodes []types.NodeName, podManifest manifest.Manifest) []nodeResult {
+	results := make([]nodeResult, 0, len(nodes))
+	for _, node := range nodes {
+		out, err := s.schedule(node, podManifest)
+		results = append(results, nodeResult{
+			node:  node,
+			podID: podManifest.ID(),
+			out:   out,
+			err:   err,
+		})
+	}
+	return results
+}
+
+// globNodes returns a node for each file matching pattern, named after the
+// file's basename without its extension, e.g. /etc/p2/nodes/web-1.yaml is
+// the node web-1. Nodes are returned in lexical order of their files.
+func globNodes(pattern string) ([]types.NodeName, error) {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, util.Errorf("Invalid node glob %s: %s", pattern, err)
+	}
+
+	var nodes []types.NodeName
+	seen := make(map[types.NodeName]bool)
+	for _, path := range paths {
+		base := filepath.Base(path)
+		node := types.NodeName(strings.TrimSuffix(base, filepath.Ext(base)))
+		if node == "" || seen[node] {
+			continue
+		}
+		seen[node] = true
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+// scheduleToGlob schedules the manifest to every node named by a file
+// matching pattern (see globNodes).
+func (s scheduler) scheduleToGlob(pattern string, podManifest manifest.Manifest) ([]nodeResult, error) {
+	nodes, err := globNodes(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return s.scheduleNodes(nodes, podManifest), nil
+}
+
+// parseNodeList parses --nodes, which is either the path to a file with one
+// node per line or a comma separated list of nodes. Blank lines and lines
+// starting with # are ignored in files.
+func parseNodeList(value string) ([]types.NodeName, error) {
+	var names []string
+	if info, err := os.Stat(value); err == nil && info.Mode().IsRegular() {
+		content, err := ioutil.ReadFile(value)
+		if err != nil {
+			return nil, util.Errorf("Could not read nodes from %s: %s", value, err)
+		}
+		for _, line := range strings.Split(string(content), "\n") {
+			if strings.HasPrefix(strings.TrimSpace(line), "#") {
+				continue
+			}
+			names = append(names, line)
+		}
+	} else {
+		names = strings.Split(value, ",")
+	}
+
+	var nodes []types.NodeName
+	seen := make(map[types.NodeName]bool)
+	for _, name := range names {
+		node := types.NodeName(strings.TrimSpace(name))
+		if node == "" || seen[node] {
+			continue
+		}
+		seen[node] = true
+		nodes = append(nodes, node)
+	}
+	if len(nodes) == 0 {
+		return nil, validationError(util.Errorf("No nodes given in --nodes %s", value))
+	}
+	return nodes, nil
+}
+
+// scheduleNodesTxn schedules the manifest to every node in a single consul
+// transaction, so that either every node is written or none are. The checks
+// for every node are run first, and nothing is written if any of them fail.
+// Nodes where the manifest is unchanged (see --idempotent) are left out of the
+// transaction. Scheduling metadata is written once the transaction commits.
+func (s scheduler) scheduleNodesTxn(nodes []types.NodeName, podManifest manifest.Manifest) ([]nodeResult, error) {
+	if s.uuidPod {
+		return nil, util.Errorf("uuid pods cannot be scheduled transactionally")
+	}
+	if s.plan != nil || s.dryRun != nil {
+		// Nothing is written, so there is nothing to make atomic
+		return s.scheduleNodes(nodes, podManifest), nil
+	}
+	if len(nodes) > s.txnWriteLimit() {
+		return nil, validationError(util.Errorf("Cannot schedule to %d nodes in one transaction, the limit is %d. Use --batch-csv instead", len(nodes), s.txnWriteLimit()))
+	}
+
+	results := make([]nodeResult, len(nodes))
+	var toWrite []types.NodeName
+	var checked manifest.Manifest
+	var failure error
+	for i, node := range nodes {
+		results[i] = nodeResult{node: node, podID: podManifest.ID()}
+		results[i].out.PodID = podManifest.ID()
+
+		nodeManifest, err := s.check(node, podManifest)
+		if err == nil {
+			results[i].out.Unchanged, err = s.checkLegacy(node, nodeManifest)
+		}
+		if err != nil {
+			results[i].err = err
+			if failure == nil {
+				failure = err
+			}
+			continue
+		}
+		if !results[i].out.Unchanged {
+			toWrite = append(toWrite, node)
+			// The checks make the same changes to the manifest for every
+			// node, e.g. --no-verify
+			checked = nodeManifest
+		}
+	}
+
+	if failure == nil && len(toWrite) > 0 {
+		_, err := s.store.SetManyNodes(s.podPrefix, toWrite, checked)
+		if err != nil {
+			failure = storeError(util.Errorf("Could not write %s to %d nodes: %s", podManifest.ID(), len(toWrite), err))
+			for i := range results {
+				if !results[i].out.Unchanged {
+					results[i].err = failure
+				}
+			}
+		}
+	}
+
+	for i := range results {
+		switch {
+		case results[i].err != nil:
+		case failure != nil:
+			// The exit code is that of the failure that stopped the write
+			results[i].err = wrapError(failure, "%s was not written to %s because another node failed: %s", podManifest.ID(), results[i].node, failure)
+		case !results[i].out.Unchanged:
+			results[i].err = s.writeSchedulingMetadata(results[i].node, checked)
+		}
+		s.recordOutcome(results[i].node, podManifest, results[i].out, results[i].err)
+	}
+	return results, nil
+}
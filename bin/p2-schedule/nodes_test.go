@@ -0,0 +1,152 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+)
+
+func TestScheduleToGlob(t *testing.T) {
+	dir, err := ioutil.TempDir("", "node-glob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"web-1.yaml", "web-2.yaml", "web-3.yaml", "db-1.yaml"} {
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte("{}"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store := newFakeIntentStore()
+	s := scheduler{
+		store:     store,
+		podPrefix: consul.INTENT_TREE,
+	}
+
+	results, err := s.scheduleToGlob(filepath.Join(dir, "web-*.yaml"), testManifest("foo"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("expected 3 scheduling results, got %d", len(results))
+	}
+	for _, result := range results {
+		if result.err != nil {
+			t.Errorf("unexpected error scheduling to %s: %s", result.node, result.err)
+		}
+	}
+
+	for _, node := range []types.NodeName{"web-1", "web-2", "web-3"} {
+		writes := store.writes(node)
+		if len(writes) != 1 || writes[0].ID() != "foo" {
+			t.Errorf("expected foo to be scheduled once on %s, got %v", node, writes)
+		}
+	}
+	if writes := store.writes("db-1"); len(writes) != 0 {
+		t.Errorf("expected nothing to be scheduled on db-1, got %v", writes)
+	}
+}
+
+func TestGlobNodesRejectsBadPattern(t *testing.T) {
+	_, err := globNodes("[")
+	if err == nil {
+		t.Error("expected an error for a malformed glob")
+	}
+}
+
+func TestParseNodeList(t *testing.T) {
+	nodes, err := parseNodeList("web-1, web-2,,web-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 2 || nodes[0] != "web-1" || nodes[1] != "web-2" {
+		t.Errorf("expected [web-1 web-2], got %v", nodes)
+	}
+
+	f, err := ioutil.TempFile("", "nodes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString("# web tier\nweb-1\n\nweb-2\n")
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes, err = parseNodeList(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 2 || nodes[0] != "web-1" || nodes[1] != "web-2" {
+		t.Errorf("expected [web-1 web-2] from the file, got %v", nodes)
+	}
+
+	_, err = parseNodeList(",")
+	if exitCodeFor(err) != ExitCodeValidationError {
+		t.Errorf("expected a validation error for an empty list, got %v", err)
+	}
+}
+
+func TestScheduleNodesTxn(t *testing.T) {
+	store := newFakeIntentStore()
+	s := scheduler{
+		store:     store,
+		podPrefix: consul.INTENT_TREE,
+	}
+
+	results, err := s.scheduleNodesTxn([]types.NodeName{"node1", "node2"}, testManifest("foo"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, result := range results {
+		if result.err != nil {
+			t.Errorf("unexpected error scheduling to %s: %s", result.node, result.err)
+		}
+		if writes := store.writes(result.node); len(writes) != 1 {
+			t.Errorf("expected foo to be scheduled once on %s, got %v", result.node, writes)
+		}
+	}
+}
+
+func TestScheduleNodesTxnWritesNothingIfANodeFails(t *testing.T) {
+	store := newFakeIntentStore()
+	labeler := labels.NewFakeApplicator()
+	err := labeler.SetLabel(labels.NODE, "dev1", "environment", "development")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = labeler.SetLabel(labels.NODE, "prod1", "environment", "production")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := scheduler{
+		store:     store,
+		podPrefix: consul.INTENT_TREE,
+		noVerify:  true,
+		labeler:   labeler,
+	}
+
+	results, err := s.scheduleNodesTxn([]types.NodeName{"dev1", "prod1"}, testManifest("foo"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, result := range results {
+		if result.err == nil {
+			t.Errorf("expected an error for %s since prod1 rejects --no-verify", result.node)
+		}
+		if exitCodeFor(result.err) != exitCodeFor(results[1].err) {
+			t.Errorf("expected %s to fail with the exit code of prod1's error, got %s", result.node, result.err)
+		}
+		if writes := store.writes(result.node); len(writes) != 0 {
+			t.Errorf("expected nothing to be written to %s, got %v", result.node, writes)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/util"
+)
+
+// readManifest reads the manifest at path. If s.overlayDir is set and has a
+// file with the same basename, e.g. manifests/prod/myapp.yaml for
+// manifests/base/myapp.yaml, it is merged on top of the manifest. See
+// manifest.Merge()
+//
+// If s.values is set, the manifest and overlay are rendered with them first.
+// See renderManifestFile()
+//
+// If s.resolver is set, the launchables of the merged manifest that name a
+// version are pinned to what it resolves to. See resolveVersions()
+func (s scheduler) readManifest(path string) (manifest.Manifest, error) {
+	podManifest, err := s.readOverlaidManifest(path)
+	if err != nil || s.resolver == nil {
+		return podManifest, err
+	}
+	return s.resolveVersions(podManifest)
+}
+
+func (s scheduler) readOverlaidManifest(path string) (manifest.Manifest, error) {
+	contents, err := s.readManifestFile(path)
+	if err != nil {
+		return nil, err
+	}
+	podManifest, err := manifest.FromBytes(contents)
+	if err != nil {
+		return nil, err
+	}
+	if s.overlayDir == "" {
+		return podManifest, nil
+	}
+
+	overlayPath := filepath.Join(s.overlayDir, filepath.Base(path))
+	overlay, err := s.readManifestFile(overlayPath)
+	switch {
+	case os.IsNotExist(err):
+		return podManifest, nil
+	case err != nil:
+		return nil, util.Errorf("Could not read overlay %s: %s", overlayPath, err)
+	}
+
+	merged, err := podManifest.Merge(overlay)
+	if err != nil {
+		return nil, util.Errorf("Could not merge overlay %s: %s", overlayPath, err)
+	}
+	return merged, nil
+}
+
+func (s scheduler) readManifestFile(path string) ([]byte, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil || s.values == nil {
+		return contents, err
+	}
+	return renderManifestFile(path, contents, s.values)
+}
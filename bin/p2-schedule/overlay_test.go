@@ -0,0 +1,82 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul"
+)
+
+func TestOverlayDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "overlay-dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	baseDir := filepath.Join(dir, "base")
+	prodDir := filepath.Join(dir, "prod")
+	for _, d := range []string{baseDir, prodDir} {
+		err = os.Mkdir(d, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	builder := manifest.NewBuilder()
+	builder.SetID("myapp")
+	builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{
+		"app": {
+			LaunchableType: "hoist",
+			Location:       "https://localhost/myapp_abc123.tar.gz",
+			Env:            map[string]string{"DATABASE": "dev-db", "PORT": "8080"},
+		},
+	})
+	manifestBytes, err := builder.GetManifest().Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	basePath := filepath.Join(baseDir, "myapp.yaml")
+	err = ioutil.WriteFile(basePath, manifestBytes, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	overlay := "launchables:\n  app:\n    env:\n      DATABASE: prod-db\n"
+	err = ioutil.WriteFile(filepath.Join(prodDir, "myapp.yaml"), []byte(overlay), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := newFakeIntentStore()
+	s := scheduler{
+		store:      store,
+		podPrefix:  consul.INTENT_TREE,
+		overlayDir: prodDir,
+	}
+	result := s.scheduleRow(batchRow{line: 1, node: "node1", manifestPath: basePath})
+	if result.err != nil {
+		t.Fatalf("unexpected error scheduling: %s", result.err)
+	}
+
+	writes := store.writes("node1")
+	if len(writes) != 1 {
+		t.Fatalf("expected one write, got %d", len(writes))
+	}
+	env := writes[0].GetLaunchableStanzas()["app"].Env
+	if env["DATABASE"] != "prod-db" {
+		t.Errorf("expected the overlay's DATABASE to be written, got %q", env["DATABASE"])
+	}
+	if env["PORT"] != "8080" {
+		t.Errorf("expected the base's PORT to be kept, got %q", env["PORT"])
+	}
+
+	// Manifests without an overlay are scheduled as they are
+	otherPath := writeTestManifest(t, baseDir, "other")
+	result = s.scheduleRow(batchRow{line: 2, node: "node2", manifestPath: otherPath})
+	if result.err != nil {
+		t.Fatalf("unexpected error scheduling a manifest without an overlay: %s", result.err)
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/schedule"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// planSchemaVersion is incremented whenever the plan format changes, so that
+// --apply-plan refuses plans written by an incompatible p2-schedule.
+const planSchemaVersion = 1
+
+type planAction string
+
+const (
+	planCreate planAction = "create"
+	planUpdate planAction = "update"
+	planNoop   planAction = "noop"
+)
+
+// schedulePlan is the file written by --save-plan: every legacy pod write
+// p2-schedule would have made, to be made later by --apply-plan.
+type schedulePlan struct {
+	SchemaVersion int         `json:"schema_version"`
+	CreatedAt     time.Time   `json:"created_at"`
+	Writes        []planWrite `json:"writes"`
+
+	// Where --save-plan writes the plan
+	path string
+	// Pods of a batch are planned concurrently
+	mu sync.Mutex
+}
+
+type planWrite struct {
+	// The consul key the manifest is written to
+	Path      string           `json:"path"`
+	PodPrefix consul.PodPrefix `json:"pod_prefix"`
+	Node      types.NodeName   `json:"node"`
+	PodID     types.PodID      `json:"pod_id"`
+
+	ManifestYAML string `json:"manifest_yaml"`
+	// What writing the manifest would do to the pod as it was scheduled
+	// when the plan was made
+	Action planAction `json:"action"`
+
+	// Written to the pod's scheduling metadata, if any
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+func newSchedulePlan(path string) *schedulePlan {
+	return &schedulePlan{
+		SchemaVersion: planSchemaVersion,
+		CreatedAt:     time.Now(),
+		path:          path,
+	}
+}
+
+// planWrite records the write of a legacy pod in s.plan instead of making it.
+// It is called by write() once every check has passed, in place of setPod().
+func (s scheduler) planWrite(node types.NodeName, podManifest manifest.Manifest) (planAction, error) {
+	path, err := consul.PodPathForManifest(s.podPrefix, node, podManifest)
+	if err != nil {
+		return "", err
+	}
+	manifestBytes, err := podManifest.Marshal()
+	if err != nil {
+		return "", util.Errorf("Could not marshal manifest %s: %s", podManifest.ID(), err)
+	}
+
+	action := planUpdate
+	current, _, err := s.store.Pod(s.podPrefix, node, podManifest.ID())
+	switch {
+	case err == pods.NoCurrentManifest:
+		action = planCreate
+	case err != nil:
+		return "", storeError(util.Errorf("Could not read the current manifest for %s on %s: %s", podManifest.ID(), node, err))
+	default:
+		currentSHA, err := current.SHA()
+		if err != nil {
+			return "", util.Errorf("Could not compute the SHA of the current manifest for %s on %s: %s", podManifest.ID(), node, err)
+		}
+		sha, err := podManifest.SHA()
+		if err != nil {
+			return "", util.Errorf("Could not compute the SHA of %s: %s", podManifest.ID(), err)
+		}
+		if currentSHA == sha {
+			action = planNoop
+		}
+	}
+
+	s.plan.mu.Lock()
+	defer s.plan.mu.Unlock()
+	s.plan.Writes = append(s.plan.Writes, planWrite{
+		Path:         path,
+		PodPrefix:    s.podPrefix,
+		Node:         node,
+		PodID:        podManifest.ID(),
+		ManifestYAML: string(manifestBytes),
+		Action:       action,
+		Tags:         s.tags,
+	})
+	return action, nil
+}
+
+// save writes the plan to its file, unless planning failed outright. It
+// returns the process exit code.
+func (p *schedulePlan) save(code exitCode) exitCode {
+	if code != ExitCodeSuccess && code != ExitCodePartialSuccess {
+		return code
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	planBytes, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		log.Printf("Could not marshal the plan: %s", err)
+		return ExitCodeError
+	}
+	err = ioutil.WriteFile(p.path, planBytes, 0644)
+	if err != nil {
+		log.Printf("Could not write the plan to %s: %s", p.path, err)
+		return ExitCodeError
+	}
+	return code
+}
+
+// readPlan reads a plan written by --save-plan, refusing plans with a
+// different schema version or made more than maxAge ago, since the pods they
+// were planned against have likely changed since.
+func readPlan(path string, maxAge time.Duration) (*schedulePlan, error) {
+	planBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, util.Errorf("Could not read plan %s: %s", path, err)
+	}
+	plan := &schedulePlan{}
+	err = json.Unmarshal(planBytes, plan)
+	if err != nil {
+		return nil, validationError(util.Errorf("Could not parse plan %s: %s", path, err))
+	}
+
+	if plan.SchemaVersion != planSchemaVersion {
+		return nil, validationError(util.Errorf("Plan %s has schema version %d, but this p2-schedule supports %d", path, plan.SchemaVersion, planSchemaVersion))
+	}
+	if maxAge > 0 && time.Since(plan.CreatedAt) > maxAge {
+		return nil, validationError(util.Errorf("Plan %s was created at %s, more than %s ago", path, plan.CreatedAt.Format(time.RFC3339), maxAge))
+	}
+	return plan, nil
+}
+
+// applyPlan makes every write of the plan that changes a pod, printing one
+// line of JSON output per pod written. The pod checks were made when the
+// plan was saved and are not repeated. It returns the process exit code.
+func (s scheduler) applyPlan(plan *schedulePlan) exitCode {
+	var errs []error
+	written := 0
+	unchanged := 0
+	for _, w := range plan.Writes {
+		if w.Action == planNoop {
+			unchanged++
+			continue
+		}
+		out, err := s.applyPlanWrite(w)
+		if err != nil {
+			s.errors.report(w.PodID, w.Node, err, err.Error())
+			errs = append(errs, err)
+			continue
+		}
+		written++
+
+		outBytes, err := json.Marshal(out)
+		if err != nil {
+			s.errors.logf("Successfully wrote %s but couldn't marshal JSON output", w.Path)
+			continue
+		}
+		fmt.Println(string(outBytes))
+	}
+
+	logSummary(s.errors, written, unchanged, len(errs))
+	if written == 0 && len(errs) == 0 {
+		// A plan of nothing but noops was applied successfully
+		return ExitCodeSuccess
+	}
+	return resultsExitCode(written, errs)
+}
+
+func (s scheduler) applyPlanWrite(w planWrite) (schedule.Output, error) {
+	out := schedule.Output{PodID: w.PodID}
+	podManifest, err := manifest.FromBytes([]byte(w.ManifestYAML))
+	if err != nil {
+		return out, validationError(util.Errorf("Could not parse the planned manifest for %s: %s", w.Path, err))
+	}
+	path, err := consul.PodPathForManifest(w.PodPrefix, w.Node, podManifest)
+	if err != nil {
+		return out, validationError(err)
+	}
+	if path != w.Path {
+		return out, validationError(util.Errorf("The planned manifest for %s would be written to %s", w.Path, path))
+	}
+
+	s.podPrefix = w.PodPrefix
+	err = s.setPod(w.Node, podManifest)
+	if err != nil {
+		return out, err
+	}
+	if len(w.Tags) > 0 {
+		metadata := consul.SchedulingMetadata{
+			Tags:        w.Tags,
+			ScheduledAt: time.Now(),
+		}
+		_, err = s.store.SetSchedulingMetadata(w.PodPrefix, w.Node, w.PodID, metadata)
+		if err != nil {
+			return out, storeError(util.Errorf("Wrote manifest %s but could not write its scheduling metadata: %s", w.PodID, err))
+		}
+	}
+	if s.healthWaiter != nil {
+		s.healthWaiter.add(w.Node, podManifest)
+	}
+	return out, nil
+}
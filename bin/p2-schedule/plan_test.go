@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+)
+
+func manifestRunningAs(id types.PodID, user string) manifest.Manifest {
+	builder := testManifest(id).GetBuilder()
+	builder.SetRunAsUser(user)
+	return builder.GetManifest()
+}
+
+func TestSaveAndApplyPlan(t *testing.T) {
+	dir, err := ioutil.TempDir("", "schedule-plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	planPath := filepath.Join(dir, "plan.json")
+
+	store := newFakeIntentStore()
+	_, _ = store.SetPod(consul.INTENT_TREE, "node2", testManifest("bar"))
+	_, _ = store.SetPod(consul.INTENT_TREE, "node3", manifestRunningAs("baz", "old"))
+
+	s := scheduler{
+		store:     store,
+		podPrefix: consul.INTENT_TREE,
+		plan:      newSchedulePlan(planPath),
+	}
+	for node, podManifest := range map[types.NodeName]manifest.Manifest{
+		"node1": testManifest("foo"),
+		"node2": testManifest("bar"),
+		"node3": manifestRunningAs("baz", "new"),
+	} {
+		_, err := s.schedule(node, podManifest)
+		if err != nil {
+			t.Fatalf("unexpected error planning %s: %s", podManifest.ID(), err)
+		}
+	}
+	if code := s.finish(ExitCodeSuccess); code != ExitCodeSuccess {
+		t.Fatalf("expected the plan to be saved, got exit code %d", code)
+	}
+	if len(store.writes("node1")) != 0 || len(store.writes("node3")) != 1 {
+		t.Fatal("expected saving a plan not to write any pods")
+	}
+
+	plan, err := readPlan(planPath, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actions := make(map[types.PodID]planAction)
+	for _, w := range plan.Writes {
+		actions[w.PodID] = w.Action
+	}
+	expected := map[types.PodID]planAction{"foo": planCreate, "bar": planNoop, "baz": planUpdate}
+	for podID, action := range expected {
+		if actions[podID] != action {
+			t.Errorf("expected %s to be planned as %s, was %q", podID, action, actions[podID])
+		}
+	}
+
+	// bar is changed after the plan was made. It was a noop, so applying
+	// the plan must leave it alone
+	_, _ = store.SetPod(consul.INTENT_TREE, "node2", manifestRunningAs("bar", "changed"))
+
+	s = scheduler{
+		store:     store,
+		podPrefix: consul.INTENT_TREE,
+	}
+	if code := s.finish(s.applyPlan(plan)); code != ExitCodeSuccess {
+		t.Fatalf("expected the plan to be applied, got exit code %d", code)
+	}
+
+	if writes := store.writes("node1"); len(writes) != 1 || writes[0].ID() != "foo" {
+		t.Errorf("expected foo to be created on node1, got %v", writes)
+	}
+	if writes := store.writes("node3"); len(writes) != 2 || writes[1].RunAsUser() != "new" {
+		t.Errorf("expected the planned baz to be written to node3, got %v", writes)
+	}
+	if writes := store.writes("node2"); len(writes) != 2 || writes[1].RunAsUser() != "changed" {
+		t.Errorf("expected bar on node2 to be left alone, got %v", writes)
+	}
+}
+
+func TestReadPlanRefusesStalePlans(t *testing.T) {
+	dir, err := ioutil.TempDir("", "schedule-plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, plan := range map[string]*schedulePlan{
+		"old":            {SchemaVersion: planSchemaVersion, CreatedAt: time.Now().Add(-2 * time.Hour)},
+		"future version": {SchemaVersion: planSchemaVersion + 1, CreatedAt: time.Now()},
+	} {
+		planBytes, err := json.Marshal(plan)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, "plan.json")
+		err = ioutil.WriteFile(path, planBytes, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = readPlan(path, time.Hour)
+		if err == nil {
+			t.Errorf("expected the %s plan to be refused", name)
+		} else if exitCodeFor(err) != ExitCodeValidationError {
+			t.Errorf("expected the %s plan to be a validation error, got %s", name, err)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/mattn/go-isatty"
+)
+
+// progress reports how many pods of a batch have been scheduled. On a
+// terminal it is a single line that is redrawn in place as pods are
+// scheduled. Otherwise, e.g. when output is piped to a file, it prints a plain
+// summary line each time another tenth of the batch is done.
+type progress struct {
+	out         io.Writer
+	interactive bool
+	total       int
+
+	mu        sync.Mutex
+	done      int
+	errors    int
+	lastPrint int
+}
+
+func newProgress(total int) *progress {
+	return &progress{
+		out:         os.Stderr,
+		interactive: isatty.IsTerminal(os.Stdout.Fd()) && isatty.IsTerminal(os.Stderr.Fd()),
+		total:       total,
+	}
+}
+
+// add records that another pod was scheduled, or failed to be if err is
+// non-nil. It is safe to call concurrently.
+func (p *progress) add(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.done++
+	if err != nil {
+		p.errors++
+	}
+
+	if p.interactive {
+		fmt.Fprintf(p.out, "\r\033[K%s", p.summary())
+		return
+	}
+	step := p.total / 10
+	if step < 1 {
+		step = 1
+	}
+	if p.done-p.lastPrint >= step || p.done == p.total {
+		p.lastPrint = p.done
+		fmt.Fprintln(p.out, p.summary())
+	}
+}
+
+// finish ends the in-place line on a terminal, so that later output starts
+// on a line of its own.
+func (p *progress) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.interactive && p.done > 0 {
+		fmt.Fprintln(p.out)
+	}
+}
+
+func (p *progress) summary() string {
+	return fmt.Sprintf("scheduled %d/%d pods (%d errors)", p.done, p.total, p.errors)
+}
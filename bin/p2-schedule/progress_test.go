@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestProgressNonInteractive(t *testing.T) {
+	var out bytes.Buffer
+	p := &progress{out: &out, total: 20}
+
+	for i := 0; i < 20; i++ {
+		var err error
+		if i%5 == 0 {
+			err = errors.New("could not schedule")
+		}
+		p.add(err)
+	}
+	p.finish()
+
+	if strings.Contains(out.String(), "\r") || strings.Contains(out.String(), "\033") {
+		t.Errorf("expected plain output without terminal control characters, got %q", out.String())
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	// one line per tenth of the batch
+	if len(lines) != 10 {
+		t.Fatalf("expected 10 summary lines, got %d: %q", len(lines), lines)
+	}
+	if lines[0] != "scheduled 2/20 pods (1 errors)" {
+		t.Errorf("unexpected first summary line %q", lines[0])
+	}
+	if lines[9] != "scheduled 20/20 pods (4 errors)" {
+		t.Errorf("unexpected last summary line %q", lines[9])
+	}
+}
+
+func TestProgressNonInteractiveSmallBatch(t *testing.T) {
+	var out bytes.Buffer
+	p := &progress{out: &out, total: 3}
+
+	p.add(nil)
+	p.add(nil)
+	p.add(nil)
+	p.finish()
+
+	expected := "scheduled 1/3 pods (0 errors)\nscheduled 2/3 pods (0 errors)\nscheduled 3/3 pods (0 errors)\n"
+	if out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// Subset of *api.PreparedQuery used to discover nodes
+type preparedQuerier interface {
+	Execute(queryIDOrName string, q *api.QueryOptions) (*api.PreparedQueryExecuteResponse, *api.QueryMeta, error)
+}
+
+// queryNodes executes the named consul prepared query and returns the nodes
+// it selected, in the order consul returned them. A node that runs more than
+// one matching service instance is only returned once.
+func queryNodes(querier preparedQuerier, queryName string) ([]types.NodeName, error) {
+	resp, _, err := querier.Execute(queryName, nil)
+	if err != nil {
+		return nil, storeError(util.Errorf("Could not execute prepared query %s: %s", queryName, err))
+	}
+	if resp == nil {
+		return nil, util.Errorf("Prepared query %s returned no response", queryName)
+	}
+
+	var nodes []types.NodeName
+	seen := make(map[types.NodeName]bool)
+	for _, entry := range resp.Nodes {
+		if entry.Node == nil || entry.Node.Node == "" {
+			continue
+		}
+		node := types.NodeName(entry.Node.Node)
+		if seen[node] {
+			continue
+		}
+		seen[node] = true
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+// scheduleToQuery schedules the manifest to every node returned by the named
+// prepared query. The error is only non-nil if the query itself failed;
+// failures to schedule to individual nodes are reported in the results.
+func (s scheduler) scheduleToQuery(querier preparedQuerier, queryName string, podManifest manifest.Manifest) ([]nodeResult, error) {
+	nodes, err := queryNodes(querier, queryName)
+	if err != nil {
+		return nil, err
+	}
+	return s.scheduleNodes(nodes, podManifest), nil
+}
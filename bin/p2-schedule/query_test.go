@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+
+	"github.com/hashicorp/consul/api"
+)
+
+type fakeQuerier struct {
+	queries  []string
+	response *api.PreparedQueryExecuteResponse
+	err      error
+}
+
+func (f *fakeQuerier) Execute(queryIDOrName string, q *api.QueryOptions) (*api.PreparedQueryExecuteResponse, *api.QueryMeta, error) {
+	f.queries = append(f.queries, queryIDOrName)
+	return f.response, &api.QueryMeta{}, f.err
+}
+
+func serviceEntry(node string) api.ServiceEntry {
+	return api.ServiceEntry{
+		Node:    &api.Node{Node: node},
+		Service: &api.AgentService{Service: "web"},
+	}
+}
+
+func TestScheduleToQuerySchedulesEveryNode(t *testing.T) {
+	querier := &fakeQuerier{
+		response: &api.PreparedQueryExecuteResponse{
+			Service: "web",
+			Nodes: []api.ServiceEntry{
+				serviceEntry("node1"),
+				serviceEntry("node2"),
+				// a second instance on the same node
+				serviceEntry("node1"),
+			},
+		},
+	}
+	store := newFakeIntentStore()
+	s := scheduler{
+		store:     store,
+		podPrefix: consul.INTENT_TREE,
+	}
+
+	results, err := s.scheduleToQuery(querier, "healthy-web", testManifest("foo"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(querier.queries) != 1 || querier.queries[0] != "healthy-web" {
+		t.Errorf("expected the healthy-web query to be executed once, got %v", querier.queries)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	for _, result := range results {
+		if result.err != nil {
+			t.Errorf("unexpected error scheduling to %s: %s", result.node, result.err)
+		}
+	}
+
+	for _, node := range []string{"node1", "node2"} {
+		writes := store.writes(types.NodeName(node))
+		if len(writes) != 1 || writes[0].ID() != "foo" {
+			t.Errorf("expected foo to be scheduled once on %s, got %v", node, writes)
+		}
+	}
+}
+
+func TestScheduleToQueryReportsQueryErrors(t *testing.T) {
+	querier := &fakeQuerier{
+		err: errors.New("query not found"),
+	}
+	store := newFakeIntentStore()
+	s := scheduler{
+		store:     store,
+		podPrefix: consul.INTENT_TREE,
+	}
+
+	_, err := s.scheduleToQuery(querier, "missing", testManifest("foo"))
+	if err == nil {
+		t.Fatal("expected an error when the query fails")
+	}
+}
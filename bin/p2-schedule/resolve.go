@@ -0,0 +1,33 @@
+package main
+
+import (
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/manifest"
+)
+
+// Subset of artifact.Resolver used to pin launchable versions
+type versionResolver interface {
+	Resolve(launchableID launch.LaunchableID, stanza launch.LaunchableStanza) (launch.LaunchableStanza, error)
+}
+
+// resolveVersions returns the manifest with every launchable that names a
+// version pinned to the location and artifact_digest it resolves to. This is
+// done once per manifest file, so that every node it is scheduled to runs the
+// same artifact.
+func (s scheduler) resolveVersions(podManifest manifest.Manifest) (manifest.Manifest, error) {
+	for _, launchableID := range podManifest.LaunchableIDs() {
+		stanza, err := podManifest.LaunchableByID(launchableID)
+		if err != nil {
+			return nil, err
+		}
+		if stanza.Location != "" || stanza.Version.ID == "" {
+			continue
+		}
+		resolved, err := s.resolver.Resolve(launchableID, stanza)
+		if err != nil {
+			return nil, err
+		}
+		podManifest = podManifest.WithLaunchable(launchableID, resolved)
+	}
+	return podManifest, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/store/consul"
+)
+
+type fakeResolver map[launch.LaunchableVersionID]string
+
+func (f fakeResolver) Resolve(launchableID launch.LaunchableID, stanza launch.LaunchableStanza) (launch.LaunchableStanza, error) {
+	stanza.Location = f[stanza.Version.ID]
+	stanza.ArtifactDigest = "abc123"
+	stanza.Version = launch.LaunchableVersion{}
+	return stanza, nil
+}
+
+func TestReadManifestResolvesVersions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resolve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	manifestPath := filepath.Join(dir, "myapp.yaml")
+	err = ioutil.WriteFile(manifestPath, []byte(`id: myapp
+launchables:
+  app:
+    launchable_type: hoist
+    version:
+      id: latest
+      tags:
+        channel: stable
+  sidecar:
+    launchable_type: hoist
+    location: https://localhost/sidecar_def456.tar.gz
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := scheduler{
+		store:     newFakeIntentStore(),
+		podPrefix: consul.INTENT_TREE,
+		resolver:  fakeResolver{"latest": "https://localhost/myapp_abc123.tar.gz"},
+	}
+	podManifest, err := s.readManifest(manifestPath)
+	if err != nil {
+		t.Fatalf("Unexpected error reading manifest: %s", err)
+	}
+	app, err := podManifest.LaunchableByID("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if app.Location != "https://localhost/myapp_abc123.tar.gz" || app.ArtifactDigest != "abc123" || app.Version.ID != "" {
+		t.Errorf("Expected the app version to be pinned to a location and digest, got %+v", app)
+	}
+	sidecar, err := podManifest.LaunchableByID("sidecar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sidecar.Location != "https://localhost/sidecar_def456.tar.gz" || sidecar.ArtifactDigest != "" {
+		t.Errorf("Expected the sidecar location to be left alone, got %+v", sidecar)
+	}
+}
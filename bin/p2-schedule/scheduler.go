@@ -0,0 +1,510 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/square/p2/pkg/auth"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/schedule"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+
+	"github.com/Sirupsen/logrus"
+	"golang.org/x/crypto/openpgp"
+)
+
+// Subset of consul.Store used to write and remove legacy pods
+type intentStore interface {
+	Pod(podPrefix consul.PodPrefix, nodename types.NodeName, podId types.PodID) (manifest.Manifest, time.Duration, error)
+	SetPod(podPrefix consul.PodPrefix, nodename types.NodeName, manifest manifest.Manifest) (time.Duration, error)
+	DeletePod(podPrefix consul.PodPrefix, nodename types.NodeName, podId types.PodID) (time.Duration, error)
+	SetManyNodes(podPrefix consul.PodPrefix, nodes []types.NodeName, manifest manifest.Manifest) (time.Duration, error)
+	SetSchedulingMetadata(podPrefix consul.PodPrefix, nodename types.NodeName, podId types.PodID, metadata consul.SchedulingMetadata) (time.Duration, error)
+	DeleteSchedulingMetadata(podPrefix consul.PodPrefix, nodename types.NodeName, podId types.PodID) (time.Duration, error)
+}
+
+// Subset of podstore.Store used to write uuid pods
+type uuidScheduler interface {
+	Schedule(manifest manifest.Manifest, node types.NodeName) (types.PodUniqueKey, error)
+}
+
+// ErrNodeLabelMismatch is returned when a node does not have the labels
+// listed in a manifest's node_requirements
+type ErrNodeLabelMismatch struct {
+	PodID types.PodID
+	Node  types.NodeName
+	// One entry per missing or mismatched label, in label order
+	Problems []string
+}
+
+func (e ErrNodeLabelMismatch) Error() string {
+	return fmt.Sprintf("%s cannot be scheduled on %s: %s", e.PodID, e.Node, strings.Join(e.Problems, ", "))
+}
+
+// versionMismatchError is returned when the currently scheduled manifest is
+// not the one required by --require-current-version
+type versionMismatchError struct {
+	podID    types.PodID
+	node     types.NodeName
+	expected string
+	// Empty if the pod is not currently scheduled
+	actual string
+}
+
+func (e versionMismatchError) Error() string {
+	actual := e.actual
+	if actual == "" {
+		actual = "nothing"
+	}
+	return fmt.Sprintf("%s on %s must be at version %s to be replaced, but %s is scheduled", e.podID, e.node, e.expected, actual)
+}
+
+// Subset of labels.Applicator used to look up node labels
+type nodeLabeler interface {
+	GetLabels(labelType labels.Type, id string) (labels.Labeled, error)
+}
+
+// Nodes with this environment label may never run unverified artifacts
+const (
+	environmentLabel      = "environment"
+	productionEnvironment = "production"
+)
+
+// scheduler writes manifests to the intent store, running any configured
+// checks beforehand
+type scheduler struct {
+	store    intentStore
+	podStore uuidScheduler
+
+	// The tree legacy pods are written to, e.g. intent or hooks
+	podPrefix consul.PodPrefix
+
+	// Set to true to schedule using the uuid pod scheme
+	uuidPod bool
+
+	// If non-nil, each manifest must be approved before it is written
+	approver *approver
+
+	// Tags written to the scheduling metadata of each legacy pod
+	tags map[string]string
+
+	// If non-empty, the path to a binary that must approve each manifest
+	// before it is written. See runPreScheduleHook()
+	preScheduleHook string
+
+	// Set to true to disable artifact verification for the scheduled pod.
+	// Refused for nodes labeled environment=production
+	noVerify bool
+	labeler  nodeLabeler
+
+	// Set to true to skip the strict checks of manifest.Validate(), e.g. to
+	// schedule a manifest with keys this version of p2 doesn't know
+	noValidate bool
+
+	// If non-nil, every manifest is signed with this key once it has
+	// passed the other checks, for preparers that require signed manifests
+	signingKey *openpgp.Entity
+
+	// If positive, manifests that serialize to more than this many bytes
+	// are refused rather than failing obscurely when written to consul
+	maxManifestSize int
+
+	// If non-empty, the SHA of the manifest that must currently be
+	// scheduled for a legacy pod to be replaced
+	requireCurrentVersion string
+
+	// Set to true to refuse manifests read from files not named after
+	// their pod ID. See checkIDMatchesFilename()
+	requireIDMatchesFilename bool
+
+	// Set to true to skip writing legacy pods whose manifest is already
+	// scheduled with the same SHA
+	idempotent bool
+
+	// If positive, how long each write of a legacy pod may take before
+	// the pod is reported as failed. See setPod()
+	podTimeout time.Duration
+
+	// If non-empty, a directory of overlays to merge on top of manifests
+	// read from files with the same basename. See readManifest()
+	overlayDir string
+
+	// If non-nil, manifest files and overlays are rendered as templates
+	// with these values. See readManifest()
+	values map[string]interface{}
+
+	// If non-nil, launchables that name a version rather than a location
+	// are pinned to the location and digest it resolves to. See
+	// resolveVersions()
+	resolver versionResolver
+
+	// If non-nil, updated as each row of a batch is scheduled
+	progress *progress
+
+	// If non-nil, every pod that is scheduled is recorded so that
+	// p2-schedule can wait for it to become healthy
+	healthWaiter *healthWaiter
+
+	// If non-nil, legacy pod writes are recorded in the plan rather than
+	// made, see planWrite()
+	plan *schedulePlan
+
+	// Starts a transaction of legacy pod writes, for --atomic-batch
+	newTxn func() podTxn
+
+	// The most legacy pod writes one transaction can hold, which is fewer
+	// than transaction.MaxOperations when writes are audited. Zero means
+	// transaction.MaxOperations
+	maxTxnWrites int
+
+	// If non-nil, legacy pods are diffed against the manifest currently
+	// scheduled rather than written, see diffPod()
+	dryRun *dryRun
+
+	// Reports the pods that could not be scheduled. A nil reporter logs
+	// each error
+	errors *errorReporter
+
+	// Every schedule attempt is logged with a request logger for
+	// requestID. A nil logger uses logging.DefaultLogger
+	logger    *logging.Logger
+	requestID string
+}
+
+// schedule writes a single manifest to the given node.
+func (s scheduler) schedule(node types.NodeName, podManifest manifest.Manifest) (schedule.Output, error) {
+	out, err := s.write(node, podManifest)
+	s.recordOutcome(node, podManifest, out, err)
+	return out, err
+}
+
+// recordOutcome logs the outcome of scheduling a pod to node and passes it on
+// to the health waiter, if any.
+func (s scheduler) recordOutcome(node types.NodeName, podManifest manifest.Manifest, out schedule.Output, err error) {
+	logger := logging.NewRequestLogger(s.logger, s.requestID).SubLogger(logrus.Fields{
+		"node":   node,
+		"pod_id": podManifest.ID(),
+	})
+	if err != nil {
+		logger.WithError(err).Errorln("Could not schedule pod")
+	} else if out.Unchanged {
+		logger.Infoln("No change, the manifest is already scheduled")
+	} else {
+		logger.WithField("pod_unique_key", out.PodUniqueKey).Infoln("Scheduled pod")
+	}
+
+	if err == nil && s.healthWaiter != nil {
+		s.healthWaiter.add(node, podManifest)
+	}
+}
+
+func (s scheduler) write(node types.NodeName, podManifest manifest.Manifest) (schedule.Output, error) {
+	out := schedule.Output{
+		PodID: podManifest.ID(),
+	}
+
+	podManifest, err := s.check(node, podManifest)
+	if err != nil {
+		return out, err
+	}
+
+	if s.uuidPod {
+		key, err := s.podStore.Schedule(podManifest, node)
+		if err != nil {
+			return out, storeError(util.Errorf("Could not schedule pod: %s", err))
+		}
+		out.PodUniqueKey = key
+		return out, nil
+	}
+
+	unchanged, err := s.checkLegacy(node, podManifest)
+	if err != nil {
+		return out, err
+	}
+	if unchanged {
+		out.Unchanged = true
+		return out, nil
+	}
+
+	if s.dryRun != nil {
+		out.Unchanged, err = s.diffPod(node, podManifest)
+		return out, err
+	}
+
+	if s.plan != nil {
+		action, err := s.planWrite(node, podManifest)
+		if err != nil {
+			return out, err
+		}
+		out.Unchanged = action == planNoop
+		return out, nil
+	}
+
+	err = s.setPod(node, podManifest)
+	if err != nil {
+		return out, err
+	}
+	return out, s.writeSchedulingMetadata(node, podManifest)
+}
+
+// check runs the checks that apply to every pod before it is written to
+// node, returning the manifest to write.
+func (s scheduler) check(node types.NodeName, podManifest manifest.Manifest) (manifest.Manifest, error) {
+	if !s.noValidate {
+		err := podManifest.Validate()
+		if err != nil {
+			return nil, validationError(util.Errorf("Invalid manifest for %s, use --no-validate to schedule it anyway:\n%s", podManifest.ID(), err))
+		}
+	}
+
+	if s.noVerify {
+		err := s.checkNoVerifyAllowed(node)
+		if err != nil {
+			return nil, err
+		}
+		builder := podManifest.GetBuilder()
+		builder.SetArtifactVerification(auth.VerifyNone)
+		podManifest = builder.GetManifest()
+	}
+
+	if len(podManifest.GetNodeRequirements()) > 0 {
+		err := s.checkNodeRequirements(node, podManifest)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if s.preScheduleHook != "" {
+		err := runPreScheduleHook(s.preScheduleHook, node, podManifest)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if s.approver != nil {
+		err := s.approver.approve(node, podManifest)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if s.signingKey != nil {
+		signed, err := manifest.Sign(podManifest, s.signingKey.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		podManifest = signed
+	}
+
+	// Last, so that the limit applies to the bytes written to consul,
+	// including any signature
+	if s.maxManifestSize > 0 {
+		err := checkManifestSize(podManifest, s.maxManifestSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return podManifest, nil
+}
+
+// checkLegacy runs the checks that only apply to legacy pods. It returns true
+// if the pod should not be written because it is unchanged.
+func (s scheduler) checkLegacy(node types.NodeName, podManifest manifest.Manifest) (bool, error) {
+	if s.requireCurrentVersion != "" {
+		err := s.checkCurrentVersion(node, podManifest.ID())
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if s.idempotent {
+		return s.manifestUnchanged(node, podManifest)
+	}
+	return false, nil
+}
+
+// writeSchedulingMetadata records s.tags for a legacy pod that was written.
+// Without tags, the tags of an earlier schedule are removed.
+func (s scheduler) writeSchedulingMetadata(node types.NodeName, podManifest manifest.Manifest) error {
+	if len(s.tags) == 0 {
+		_, err := s.store.DeleteSchedulingMetadata(s.podPrefix, node, podManifest.ID())
+		if err != nil {
+			return storeError(util.Errorf("Wrote manifest %s but could not remove its old scheduling metadata: %s", podManifest.ID(), err))
+		}
+		return nil
+	}
+	metadata := consul.SchedulingMetadata{
+		Tags:        s.tags,
+		ScheduledAt: time.Now(),
+	}
+	_, err := s.store.SetSchedulingMetadata(s.podPrefix, node, podManifest.ID(), metadata)
+	if err != nil {
+		return storeError(util.Errorf("Wrote manifest %s but could not write its scheduling metadata: %s", podManifest.ID(), err))
+	}
+	return nil
+}
+
+// setPod writes a legacy pod, giving up after s.podTimeout so that one slow
+// write does not hold up the rest. The store does not accept a context, so a
+// write that times out is abandoned rather than cancelled and may still
+// complete later.
+func (s scheduler) setPod(node types.NodeName, podManifest manifest.Manifest) error {
+	ctx := context.Background()
+	if s.podTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.podTimeout)
+		defer cancel()
+	}
+
+	// buffered so that an abandoned write does not leak its goroutine
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := s.store.SetPod(s.podPrefix, node, podManifest)
+		errCh <- err
+	}()
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			return storeError(util.Errorf("Could not write manifest %s to intent store: %s", podManifest.ID(), err))
+		}
+		return nil
+	case <-ctx.Done():
+		return storeError(util.Errorf("Timed out after %s writing manifest %s to intent store", s.podTimeout, podManifest.ID()))
+	}
+}
+
+// manifestUnchanged returns true if the manifest currently scheduled for the
+// pod on node has the same SHA as podManifest.
+func (s scheduler) manifestUnchanged(node types.NodeName, podManifest manifest.Manifest) (bool, error) {
+	current, _, err := s.store.Pod(s.podPrefix, node, podManifest.ID())
+	switch {
+	case err == pods.NoCurrentManifest:
+		return false, nil
+	case err != nil:
+		return false, storeError(util.Errorf("Could not read the current manifest for %s on %s: %s", podManifest.ID(), node, err))
+	}
+
+	currentSHA, err := current.SHA()
+	if err != nil {
+		return false, util.Errorf("Could not compute the SHA of the current manifest for %s on %s: %s", podManifest.ID(), node, err)
+	}
+	sha, err := podManifest.SHA()
+	if err != nil {
+		return false, util.Errorf("Could not compute the SHA of %s: %s", podManifest.ID(), err)
+	}
+	return currentSHA == sha, nil
+}
+
+// checkNoVerifyAllowed returns an error if the node is a production node,
+// where artifact verification may not be skipped.
+func (s scheduler) checkNoVerifyAllowed(node types.NodeName) error {
+	nodeLabels, err := s.labeler.GetLabels(labels.NODE, node.String())
+	if err != nil {
+		return storeError(util.Errorf("Could not check labels of %s for --no-verify: %s", node, err))
+	}
+	if nodeLabels.Labels.Get(environmentLabel) == productionEnvironment {
+		return util.Errorf("--no-verify may not be used on %s because it is labeled %s=%s", node, environmentLabel, productionEnvironment)
+	}
+	return nil
+}
+
+func checkManifestSize(podManifest manifest.Manifest, maxSize int) error {
+	manifestBytes, err := podManifest.Marshal()
+	if err != nil {
+		return util.Errorf("Could not marshal %s to check its size: %s", podManifest.ID(), err)
+	}
+	if len(manifestBytes) > maxSize {
+		return validationError(util.Errorf(
+			"Manifest %s is %d bytes, which exceeds the limit of %d bytes. Consider moving large config or environment values out of the manifest",
+			podManifest.ID(),
+			len(manifestBytes),
+			maxSize,
+		))
+	}
+	return nil
+}
+
+// checkIDMatchesFilename returns an error unless the manifest at path is for
+// the pod named by the file's basename without its extension, e.g. myapp.yaml
+// must contain the pod myapp.
+func checkIDMatchesFilename(path string, podManifest manifest.Manifest) error {
+	base := filepath.Base(path)
+	expected := types.PodID(strings.TrimSuffix(base, filepath.Ext(base)))
+	if podManifest.ID() != expected {
+		return validationError(util.Errorf("Manifest %s contains the pod %s, but must contain %s to match its filename", path, podManifest.ID(), expected))
+	}
+	return nil
+}
+
+// checkNodeRequirements returns an ErrNodeLabelMismatch if the node is
+// missing any of the labels in the manifest's node_requirements, or has a
+// different value for one of them.
+func (s scheduler) checkNodeRequirements(node types.NodeName, podManifest manifest.Manifest) error {
+	nodeLabels, err := s.labeler.GetLabels(labels.NODE, node.String())
+	if err != nil {
+		return storeError(util.Errorf("Could not check labels of %s against node_requirements: %s", node, err))
+	}
+
+	required := podManifest.GetNodeRequirements()
+	keys := make([]string, 0, len(required))
+	for key := range required {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var problems []string
+	for _, key := range keys {
+		actual, ok := nodeLabels.Labels[key]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("missing label %s=%s", key, required[key]))
+		case actual != required[key]:
+			problems = append(problems, fmt.Sprintf("label %s is %q, required %q", key, actual, required[key]))
+		}
+	}
+	if len(problems) > 0 {
+		return ErrNodeLabelMismatch{
+			PodID:    podManifest.ID(),
+			Node:     node,
+			Problems: problems,
+		}
+	}
+	return nil
+}
+
+// checkCurrentVersion returns a versionMismatchError unless the manifest
+// currently scheduled for the pod has the SHA given by requireCurrentVersion.
+func (s scheduler) checkCurrentVersion(node types.NodeName, podID types.PodID) error {
+	var actual string
+	current, _, err := s.store.Pod(s.podPrefix, node, podID)
+	switch {
+	case err == pods.NoCurrentManifest:
+	case err != nil:
+		return storeError(util.Errorf("Could not read the current manifest for %s on %s: %s", podID, node, err))
+	default:
+		actual, err = current.SHA()
+		if err != nil {
+			return util.Errorf("Could not compute the SHA of the current manifest for %s on %s: %s", podID, node, err)
+		}
+	}
+
+	if actual != s.requireCurrentVersion {
+		return versionMismatchError{
+			podID:    podID,
+			node:     node,
+			expected: s.requireCurrentVersion,
+			actual:   actual,
+		}
+	}
+	return nil
+}
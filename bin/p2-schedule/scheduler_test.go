@@ -0,0 +1,506 @@
+package main
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/auth"
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+type fakeIntentStore struct {
+	mu       sync.Mutex
+	written  map[types.NodeName][]manifest.Manifest
+	metadata map[types.NodeName]consul.SchedulingMetadata
+}
+
+func newFakeIntentStore() *fakeIntentStore {
+	return &fakeIntentStore{
+		written:  make(map[types.NodeName][]manifest.Manifest),
+		metadata: make(map[types.NodeName]consul.SchedulingMetadata),
+	}
+}
+
+func (f *fakeIntentStore) SetSchedulingMetadata(podPrefix consul.PodPrefix, nodename types.NodeName, podId types.PodID, metadata consul.SchedulingMetadata) (time.Duration, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.metadata[nodename] = metadata
+	return 0, nil
+}
+
+func (f *fakeIntentStore) DeleteSchedulingMetadata(podPrefix consul.PodPrefix, nodename types.NodeName, podId types.PodID) (time.Duration, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.metadata, nodename)
+	return 0, nil
+}
+
+func (f *fakeIntentStore) SetPod(podPrefix consul.PodPrefix, nodename types.NodeName, podManifest manifest.Manifest) (time.Duration, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.written[nodename] = append(f.written[nodename], podManifest)
+	return 0, nil
+}
+
+func (f *fakeIntentStore) Pod(podPrefix consul.PodPrefix, nodename types.NodeName, podId types.PodID) (manifest.Manifest, time.Duration, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	written := f.written[nodename]
+	for i := len(written) - 1; i >= 0; i-- {
+		if written[i].ID() == podId {
+			return written[i], 0, nil
+		}
+	}
+	return nil, 0, pods.NoCurrentManifest
+}
+
+func (f *fakeIntentStore) DeletePod(podPrefix consul.PodPrefix, nodename types.NodeName, podId types.PodID) (time.Duration, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var kept []manifest.Manifest
+	for _, written := range f.written[nodename] {
+		if written.ID() != podId {
+			kept = append(kept, written)
+		}
+	}
+	f.written[nodename] = kept
+	delete(f.metadata, nodename)
+	return 0, nil
+}
+
+func (f *fakeIntentStore) SetManyNodes(podPrefix consul.PodPrefix, nodes []types.NodeName, podManifest manifest.Manifest) (time.Duration, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, node := range nodes {
+		f.written[node] = append(f.written[node], podManifest)
+	}
+	return 0, nil
+}
+
+func (f *fakeIntentStore) writes(node types.NodeName) []manifest.Manifest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.written[node]
+}
+
+func testManifest(id types.PodID) manifest.Manifest {
+	builder := manifest.NewBuilder()
+	builder.SetID(id)
+	return builder.GetManifest()
+}
+
+func TestScheduleWritesLegacyPod(t *testing.T) {
+	store := newFakeIntentStore()
+	s := scheduler{
+		store:     store,
+		podPrefix: consul.INTENT_TREE,
+	}
+
+	out, err := s.schedule("node1", testManifest("foo"))
+	if err != nil {
+		t.Fatalf("unexpected error scheduling: %s", err)
+	}
+	if out.PodID != "foo" {
+		t.Errorf("expected output pod ID to be foo, was %s", out.PodID)
+	}
+	if len(store.writes("node1")) != 1 {
+		t.Errorf("expected one write to node1, got %d", len(store.writes("node1")))
+	}
+}
+
+func TestScheduleWritesTags(t *testing.T) {
+	store := newFakeIntentStore()
+	s := scheduler{
+		store:     store,
+		podPrefix: consul.INTENT_TREE,
+		tags:      map[string]string{"release": "x"},
+	}
+
+	for _, node := range []types.NodeName{"node1", "node2"} {
+		_, err := s.schedule(node, testManifest("foo"))
+		if err != nil {
+			t.Fatalf("unexpected error scheduling: %s", err)
+		}
+		if store.metadata[node].Tags["release"] != "x" {
+			t.Errorf("expected %s to have scheduling metadata tagged release=x, got %+v", node, store.metadata[node])
+		}
+	}
+}
+
+func TestRescheduleWithoutTagsClearsTags(t *testing.T) {
+	store := newFakeIntentStore()
+	s := scheduler{
+		store:     store,
+		podPrefix: consul.INTENT_TREE,
+		tags:      map[string]string{"release": "x"},
+	}
+	_, err := s.schedule("node1", testManifest("foo"))
+	if err != nil {
+		t.Fatalf("unexpected error scheduling: %s", err)
+	}
+
+	s.tags = nil
+	_, err = s.schedule("node1", testManifest("foo"))
+	if err != nil {
+		t.Fatalf("unexpected error rescheduling: %s", err)
+	}
+	if metadata, ok := store.metadata["node1"]; ok {
+		t.Errorf("expected the old tags to be removed, got %+v", metadata)
+	}
+}
+
+func TestScheduleValidatesManifest(t *testing.T) {
+	podManifest, err := manifest.FromBytes([]byte("id: foo\nstatus_prot: 8080\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := newFakeIntentStore()
+	s := scheduler{
+		store:     store,
+		podPrefix: consul.INTENT_TREE,
+	}
+	_, err = s.schedule("node1", podManifest)
+	if err == nil {
+		t.Fatal("expected a manifest with an unknown key to be refused")
+	}
+	if exitCodeFor(err) != ExitCodeValidationError {
+		t.Errorf("expected exit code %d for an invalid manifest, got %d", ExitCodeValidationError, exitCodeFor(err))
+	}
+	if len(store.writes("node1")) != 0 {
+		t.Errorf("expected nothing to be written to node1, got %d writes", len(store.writes("node1")))
+	}
+
+	s.noValidate = true
+	_, err = s.schedule("node1", podManifest)
+	if err != nil {
+		t.Fatalf("expected --no-validate to schedule the manifest, got %s", err)
+	}
+	if len(store.writes("node1")) != 1 {
+		t.Errorf("expected one write to node1, got %d", len(store.writes("node1")))
+	}
+}
+
+func TestScheduleSignsManifest(t *testing.T) {
+	signer, err := openpgp.NewEntity("p2", "test", "p2@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := newFakeIntentStore()
+	s := scheduler{
+		store:      store,
+		podPrefix:  consul.INTENT_TREE,
+		signingKey: signer,
+	}
+
+	_, err = s.schedule("node1", testManifest("foo"))
+	if err != nil {
+		t.Fatalf("unexpected error scheduling: %s", err)
+	}
+	written := store.writes("node1")
+	if len(written) != 1 {
+		t.Fatalf("expected one write to node1, got %d", len(written))
+	}
+	plaintext, signature := written[0].SignatureData()
+	if signature == nil {
+		t.Fatal("expected the written manifest to be signed")
+	}
+	_, err = openpgp.CheckDetachedSignature(openpgp.EntityList{signer}, bytes.NewReader(plaintext), bytes.NewReader(signature))
+	if err != nil {
+		t.Errorf("expected the written manifest to be signed by the signing key, got %s", err)
+	}
+}
+
+func TestNoVerifyAllowedOnDevNodes(t *testing.T) {
+	store := newFakeIntentStore()
+	labeler := labels.NewFakeApplicator()
+	err := labeler.SetLabel(labels.NODE, "dev1", "environment", "development")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := scheduler{
+		store:     store,
+		podPrefix: consul.INTENT_TREE,
+		noVerify:  true,
+		labeler:   labeler,
+	}
+
+	_, err = s.schedule("dev1", testManifest("foo"))
+	if err != nil {
+		t.Fatalf("expected --no-verify to be accepted for a dev node, got %s", err)
+	}
+	written := store.writes("dev1")
+	if len(written) != 1 {
+		t.Fatalf("expected one write to dev1, got %d", len(written))
+	}
+	if written[0].GetArtifactVerification() != auth.VerifyNone {
+		t.Errorf("expected written manifest to have artifact verification %q, was %q", auth.VerifyNone, written[0].GetArtifactVerification())
+	}
+}
+
+func TestNoVerifyRejectedOnProductionNodes(t *testing.T) {
+	store := newFakeIntentStore()
+	labeler := labels.NewFakeApplicator()
+	err := labeler.SetLabel(labels.NODE, "prod1", "environment", "production")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := scheduler{
+		store:     store,
+		podPrefix: consul.INTENT_TREE,
+		noVerify:  true,
+		labeler:   labeler,
+	}
+
+	_, err = s.schedule("prod1", testManifest("foo"))
+	if err == nil {
+		t.Fatal("expected --no-verify to be rejected for a production node")
+	}
+	if len(store.writes("prod1")) != 0 {
+		t.Errorf("expected nothing to be written to prod1, got %d writes", len(store.writes("prod1")))
+	}
+}
+
+func TestMaxManifestSize(t *testing.T) {
+	podManifest := testManifest("foo")
+	manifestBytes, err := podManifest.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := len(manifestBytes)
+
+	store := newFakeIntentStore()
+	s := scheduler{
+		store:           store,
+		podPrefix:       consul.INTENT_TREE,
+		maxManifestSize: size,
+	}
+	_, err = s.schedule("node1", podManifest)
+	if err != nil {
+		t.Fatalf("expected a manifest exactly at the size limit to be scheduled, got %s", err)
+	}
+
+	s.maxManifestSize = size - 1
+	_, err = s.schedule("node2", podManifest)
+	if err == nil {
+		t.Fatal("expected a manifest over the size limit to be refused")
+	}
+	if len(store.writes("node2")) != 0 {
+		t.Errorf("expected nothing to be written for an oversized manifest, got %d writes", len(store.writes("node2")))
+	}
+}
+
+func TestMaxManifestSizeIncludesSignature(t *testing.T) {
+	signer, err := openpgp.NewEntity("p2", "test", "p2@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	podManifest := testManifest("foo")
+	manifestBytes, err := podManifest.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := newFakeIntentStore()
+	s := scheduler{
+		store:           store,
+		podPrefix:       consul.INTENT_TREE,
+		maxManifestSize: len(manifestBytes),
+		signingKey:      signer,
+	}
+	_, err = s.schedule("node1", podManifest)
+	if err == nil {
+		t.Fatal("expected a manifest that only exceeds the size limit once signed to be refused")
+	}
+	if len(store.writes("node1")) != 0 {
+		t.Errorf("expected nothing to be written for an oversized manifest, got %d writes", len(store.writes("node1")))
+	}
+}
+
+func TestNodeRequirements(t *testing.T) {
+	labeler := labels.NewFakeApplicator()
+	err := labeler.SetLabels(labels.NODE, "gpu1", map[string]string{"gpu": "true", "zone": "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = labeler.SetLabel(labels.NODE, "gpu2", "gpu", "false")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builder := testManifest("foo").GetBuilder()
+	builder.SetNodeRequirements(map[string]string{"gpu": "true"})
+	podManifest := builder.GetManifest()
+
+	for _, test := range []struct {
+		node    types.NodeName
+		matches bool
+	}{
+		{node: "gpu1", matches: true},
+		{node: "gpu2", matches: false},
+		{node: "plain", matches: false},
+	} {
+		store := newFakeIntentStore()
+		s := scheduler{
+			store:     store,
+			podPrefix: consul.INTENT_TREE,
+			labeler:   labeler,
+		}
+		_, err := s.schedule(test.node, podManifest)
+		if test.matches {
+			if err != nil {
+				t.Errorf("expected %s to satisfy the node requirements, got %s", test.node, err)
+			}
+			continue
+		}
+
+		mismatch, ok := err.(ErrNodeLabelMismatch)
+		if !ok {
+			t.Errorf("expected a label mismatch error for %s, got %v", test.node, err)
+		} else if mismatch.Node != test.node || len(mismatch.Problems) == 0 {
+			t.Errorf("expected the mismatch error to name %s and its problems, got %+v", test.node, mismatch)
+		}
+		if len(store.writes(test.node)) != 0 {
+			t.Errorf("expected nothing to be written to %s", test.node)
+		}
+	}
+}
+
+func versionedManifest(t *testing.T, version string) (manifest.Manifest, string) {
+	builder := testManifest("foo").GetBuilder()
+	err := builder.SetConfig(map[interface{}]interface{}{"version": version})
+	if err != nil {
+		t.Fatal(err)
+	}
+	podManifest := builder.GetManifest()
+	sha, err := podManifest.SHA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return podManifest, sha
+}
+
+func TestRequireCurrentVersion(t *testing.T) {
+	v1, v1SHA := versionedManifest(t, "v1")
+	v2, _ := versionedManifest(t, "v2")
+	v3, _ := versionedManifest(t, "v3")
+
+	store := newFakeIntentStore()
+	s := scheduler{
+		store:     store,
+		podPrefix: consul.INTENT_TREE,
+	}
+	_, err := s.schedule("node1", v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.requireCurrentVersion = v1SHA
+	_, err = s.schedule("node1", v2)
+	if err != nil {
+		t.Fatalf("expected v2 to replace v1, got %s", err)
+	}
+
+	_, err = s.schedule("node1", v3)
+	mismatch, ok := err.(versionMismatchError)
+	if !ok {
+		t.Fatalf("expected a version mismatch replacing v2 while requiring v1, got %v", err)
+	}
+	if mismatch.expected != v1SHA {
+		t.Errorf("expected mismatch to report expected SHA %s, got %s", v1SHA, mismatch.expected)
+	}
+	if len(store.writes("node1")) != 2 {
+		t.Errorf("expected v3 not to be written, got %d writes", len(store.writes("node1")))
+	}
+}
+
+func TestIdempotentSkipsUnchangedManifest(t *testing.T) {
+	store := newFakeIntentStore()
+	s := scheduler{
+		store:      store,
+		podPrefix:  consul.INTENT_TREE,
+		idempotent: true,
+	}
+
+	out, err := s.schedule("node1", testManifest("foo"))
+	if err != nil {
+		t.Fatalf("unexpected error scheduling: %s", err)
+	}
+	if out.Unchanged {
+		t.Error("expected the first schedule to write the manifest")
+	}
+
+	out, err = s.schedule("node1", testManifest("foo"))
+	if err != nil {
+		t.Fatalf("unexpected error scheduling again: %s", err)
+	}
+	if !out.Unchanged {
+		t.Error("expected the second schedule to be reported as unchanged")
+	}
+	if len(store.writes("node1")) != 1 {
+		t.Errorf("expected SetPod to be called once, was called %d times", len(store.writes("node1")))
+	}
+
+	changed, _ := versionedManifest(t, "2")
+	out, err = s.schedule("node1", changed)
+	if err != nil {
+		t.Fatalf("unexpected error scheduling a changed manifest: %s", err)
+	}
+	if out.Unchanged || len(store.writes("node1")) != 2 {
+		t.Error("expected a changed manifest to be written")
+	}
+}
+
+// slowIntentStore delays writes of pods to slowNode
+type slowIntentStore struct {
+	*fakeIntentStore
+	slowNode types.NodeName
+	delay    time.Duration
+}
+
+func (s slowIntentStore) SetPod(podPrefix consul.PodPrefix, nodename types.NodeName, podManifest manifest.Manifest) (time.Duration, error) {
+	if nodename == s.slowNode {
+		time.Sleep(s.delay)
+	}
+	return s.fakeIntentStore.SetPod(podPrefix, nodename, podManifest)
+}
+
+func TestPodTimeoutFailsSlowWrites(t *testing.T) {
+	store := slowIntentStore{
+		fakeIntentStore: newFakeIntentStore(),
+		slowNode:        "node2",
+		delay:           200 * time.Millisecond,
+	}
+	s := scheduler{
+		store:      store,
+		podPrefix:  consul.INTENT_TREE,
+		podTimeout: 100 * time.Millisecond,
+	}
+
+	results := s.scheduleNodes([]types.NodeName{"node1", "node2", "node3"}, testManifest("foo"))
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(results))
+	}
+	for _, result := range results {
+		switch result.node {
+		case "node2":
+			if result.err == nil {
+				t.Error("expected the slow write to node2 to time out")
+			} else if exitCodeFor(result.err) != ExitCodeStoreError {
+				t.Errorf("expected a timeout to be a store error, got exit code %d", exitCodeFor(result.err))
+			}
+		default:
+			if result.err != nil {
+				t.Errorf("expected %s to be scheduled, got %s", result.node, result.err)
+			}
+		}
+	}
+}
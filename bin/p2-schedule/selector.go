@@ -0,0 +1,53 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+
+	klabels "k8s.io/kubernetes/pkg/labels"
+)
+
+// Subset of labels.Applicator used to discover nodes with --selector
+type nodeMatcher interface {
+	GetMatches(selector klabels.Selector, labelType labels.Type) ([]labels.Labeled, error)
+}
+
+// selectNodes returns the nodes whose labels match selector, e.g.
+// "az=us-east-1,role=api" or "role in (api, worker),!draining", sorted by
+// name.
+func selectNodes(matcher nodeMatcher, selector string) ([]types.NodeName, error) {
+	parsed, err := klabels.Parse(selector)
+	if err != nil {
+		return nil, validationError(util.Errorf("Invalid node selector %q: %s", selector, err))
+	}
+	matches, err := matcher.GetMatches(parsed, labels.NODE)
+	if err != nil {
+		return nil, storeError(util.Errorf("Could not find nodes matching %q: %s", selector, err))
+	}
+
+	names := make([]string, 0, len(matches))
+	for _, match := range matches {
+		names = append(names, match.ID)
+	}
+	sort.Strings(names)
+	nodes := make([]types.NodeName, 0, len(names))
+	for _, name := range names {
+		nodes = append(nodes, types.NodeName(name))
+	}
+	return nodes, nil
+}
+
+// scheduleToSelector schedules the manifest to every node matching selector.
+// The error is only non-nil if the nodes could not be found; failures to
+// schedule to individual nodes are reported in the results.
+func (s scheduler) scheduleToSelector(matcher nodeMatcher, selector string, podManifest manifest.Manifest) ([]nodeResult, error) {
+	nodes, err := selectNodes(matcher, selector)
+	if err != nil {
+		return nil, err
+	}
+	return s.scheduleNodes(nodes, podManifest), nil
+}
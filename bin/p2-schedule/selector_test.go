@@ -0,0 +1,65 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+)
+
+func TestScheduleToSelector(t *testing.T) {
+	labeler := labels.NewFakeApplicator()
+	for node, nodeLabels := range map[string]map[string]string{
+		"api2":    {"az": "us-east-1", "role": "api"},
+		"api1":    {"az": "us-east-1", "role": "api"},
+		"api3":    {"az": "us-west-2", "role": "api"},
+		"worker1": {"az": "us-east-1", "role": "worker"},
+	} {
+		for key, value := range nodeLabels {
+			err := labeler.SetLabel(labels.NODE, node, key, value)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	store := newFakeIntentStore()
+	s := scheduler{
+		store:     store,
+		podPrefix: consul.INTENT_TREE,
+	}
+	results, err := s.scheduleToSelector(labeler, "az=us-east-1,role=api", testManifest("foo"))
+	if err != nil {
+		t.Fatalf("unexpected error scheduling to selector: %s", err)
+	}
+	var nodes []types.NodeName
+	for _, result := range results {
+		if result.err != nil {
+			t.Errorf("unexpected error scheduling to %s: %s", result.node, result.err)
+		}
+		nodes = append(nodes, result.node)
+	}
+	expected := []types.NodeName{"api1", "api2"}
+	if !reflect.DeepEqual(nodes, expected) {
+		t.Errorf("expected to schedule to %v, got %v", expected, nodes)
+	}
+	if len(store.writes("worker1")) != 0 || len(store.writes("api3")) != 0 {
+		t.Error("expected nodes that don't match the selector to be left alone")
+	}
+
+	nodes, err = selectNodes(labeler, "role in (api, worker),az notin (us-west-2)")
+	if err != nil {
+		t.Fatalf("unexpected error selecting nodes: %s", err)
+	}
+	expected = []types.NodeName{"api1", "api2", "worker1"}
+	if !reflect.DeepEqual(nodes, expected) {
+		t.Errorf("expected a set-based selector to match %v, got %v", expected, nodes)
+	}
+
+	_, err = selectNodes(labeler, "role in (api")
+	if exitCodeFor(err) != ExitCodeValidationError {
+		t.Errorf("expected an invalid selector to be a validation error, got %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"text/template"
+
+	"github.com/square/p2/pkg/util"
+
+	"golang.org/x/crypto/openpgp/clearsign"
+	"gopkg.in/yaml.v2"
+)
+
+// scheduleValues is the data manifest files are rendered with by --set and
+// --values, so that {{ .Values.version }} looks up the value of "version".
+// Deploy time variables, {{ .Var "NAME" }}, are left for the preparer to
+// render. See manifest.RenderTemplate()
+type scheduleValues struct {
+	Values map[string]interface{}
+}
+
+// Var reproduces a reference to a deploy time variable, so that rendering a
+// manifest at schedule time leaves it intact.
+func (scheduleValues) Var(name string) string {
+	return fmt.Sprintf("{{ .Var %q }}", name)
+}
+
+// loadValues returns the values in the YAML file at valuesPath, if it is
+// non-empty, overridden by those given with --set.
+func loadValues(valuesPath string, set map[string]string) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	if valuesPath != "" {
+		valuesBytes, err := ioutil.ReadFile(valuesPath)
+		if err != nil {
+			return nil, util.Errorf("Could not read values from %s: %s", valuesPath, err)
+		}
+		err = yaml.Unmarshal(valuesBytes, &values)
+		if err != nil {
+			return nil, util.Errorf("Could not parse values from %s: %s", valuesPath, err)
+		}
+	}
+	for key, value := range set {
+		values[key] = value
+	}
+	return values, nil
+}
+
+// renderManifestFile renders the contents of a manifest file, or of an
+// overlay, as a text/template with values. Referring to a value that wasn't
+// given is an error. Signed manifests can't be rendered, since their
+// signature would no longer match.
+func renderManifestFile(path string, contents []byte, values map[string]interface{}) ([]byte, error) {
+	if signed, _ := clearsign.Decode(contents); signed != nil {
+		return nil, util.Errorf("%s is signed, so it cannot be rendered with --set or --values", path)
+	}
+	tmpl, err := template.New(path).Option("missingkey=error").Parse(string(contents))
+	if err != nil {
+		return nil, util.Errorf("Could not parse %s as a template: %s", path, err)
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, scheduleValues{Values: values})
+	if err != nil {
+		return nil, util.Errorf("Could not render %s: %s", path, err)
+	}
+	return buf.Bytes(), nil
+}
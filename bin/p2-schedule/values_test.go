@@ -0,0 +1,91 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/store/consul"
+)
+
+const templatedManifest = `id: myapp
+launchables:
+  app:
+    launchable_type: hoist
+    location: https://localhost/myapp_{{ .Values.version }}.tar.gz
+    env:
+      CONFIG_ENDPOINT: {{ .Values.config.endpoint }}
+      NODE_IP: '{{ .Var "NODE_IP" }}'
+`
+
+func TestLoadValues(t *testing.T) {
+	dir, err := ioutil.TempDir("", "values")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	valuesPath := filepath.Join(dir, "prod.yaml")
+	err = ioutil.WriteFile(valuesPath, []byte("version: abc123\nconfig:\n  endpoint: https://config.prod\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values, err := loadValues(valuesPath, map[string]string{"version": "def456"})
+	if err != nil {
+		t.Fatalf("Unexpected error loading values: %s", err)
+	}
+	if values["version"] != "def456" {
+		t.Errorf("Expected --set to override the values file, got version %v", values["version"])
+	}
+	if _, ok := values["config"]; !ok {
+		t.Errorf("Expected nested values to be loaded, got %v", values)
+	}
+}
+
+func TestReadManifestRendersValues(t *testing.T) {
+	dir, err := ioutil.TempDir("", "values")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	manifestPath := filepath.Join(dir, "myapp.yaml")
+	err = ioutil.WriteFile(manifestPath, []byte(templatedManifest), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := newFakeIntentStore()
+	s := scheduler{
+		store:     store,
+		podPrefix: consul.INTENT_TREE,
+		values: map[string]interface{}{
+			"version": "abc123",
+			"config":  map[interface{}]interface{}{"endpoint": "https://config.prod"},
+		},
+	}
+	podManifest, err := s.readManifest(manifestPath)
+	if err != nil {
+		t.Fatalf("Unexpected error reading manifest: %s", err)
+	}
+	stanza, err := podManifest.LaunchableByID(launch.LaunchableID("app"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stanza.Location != "https://localhost/myapp_abc123.tar.gz" {
+		t.Errorf("Expected the version to be rendered into the location, got %s", stanza.Location)
+	}
+	if stanza.Env["CONFIG_ENDPOINT"] != "https://config.prod" {
+		t.Errorf("Expected the config endpoint to be rendered, got %s", stanza.Env["CONFIG_ENDPOINT"])
+	}
+	if stanza.Env["NODE_IP"] != `{{ .Var "NODE_IP" }}` {
+		t.Errorf("Expected the deploy time variable to be left alone, got %s", stanza.Env["NODE_IP"])
+	}
+
+	delete(s.values, "version")
+	_, err = s.readManifest(manifestPath)
+	if err == nil {
+		t.Error("Expected a manifest referring to a missing value to be refused")
+	}
+}
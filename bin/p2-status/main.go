@@ -0,0 +1,46 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/square/p2/pkg/health/checker"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/flags"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/version"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	nodeArg = kingpin.Flag("node", "The node to show. By default, all nodes are shown.").String()
+	podArg  = kingpin.Flag("pod", "The pod manifest ID to show. By default, all pods are shown.").String()
+	jsonOut = kingpin.Flag("json", "Print the statuses as JSON rather than a table.").Bool()
+)
+
+func main() {
+	kingpin.Version(version.VERSION)
+	_, opts, _ := flags.ParseWithConsulOptions()
+	client := consul.NewConsulClient(opts)
+	store := consul.NewConsulStore(client)
+
+	statuses, err := collectStatuses(
+		store,
+		checker.NewHealthChecker(client),
+		types.NodeName(*nodeArg),
+		types.PodID(*podArg),
+	)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if *jsonOut {
+		err = printJSON(os.Stdout, statuses)
+	} else {
+		err = printTable(os.Stdout, statuses)
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/inspect"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// The number of characters of a manifest SHA shown in the table
+const shortSHALength = 12
+
+// Subset of consul.Store used to read the intent and reality trees
+type podLister interface {
+	ListPods(podPrefix consul.PodPrefix, nodename types.NodeName) ([]consul.ManifestResult, time.Duration, error)
+	AllPods(podPrefix consul.PodPrefix) ([]consul.ManifestResult, time.Duration, error)
+}
+
+// Subset of checker.HealthChecker used to read the health tree
+type healthChecker interface {
+	Service(serviceID string) (map[types.NodeName]health.Result, error)
+}
+
+type podStatuses []inspect.NodePodStatus
+
+func (s podStatuses) Len() int      { return len(s) }
+func (s podStatuses) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s podStatuses) Less(i, j int) bool {
+	if s[i].NodeName != s[j].NodeName {
+		return s[i].NodeName < s[j].NodeName
+	}
+	return s[i].PodId < s[j].PodId
+}
+
+// collectStatuses returns the scheduled SHA, running SHA and health of every
+// pod, optionally limited to one node and/or pod ID. Statuses are sorted by
+// node, then pod ID. Like p2-inspect, pods with a unique key are not shown.
+func collectStatuses(
+	lister podLister,
+	checker healthChecker,
+	filterNode types.NodeName,
+	filterPod types.PodID,
+) ([]inspect.NodePodStatus, error) {
+	statusMap := make(map[types.PodID]map[types.NodeName]inspect.NodePodStatus)
+	trees := []struct {
+		prefix consul.PodPrefix
+		source int
+	}{
+		{consul.INTENT_TREE, inspect.INTENT_SOURCE},
+		{consul.REALITY_TREE, inspect.REALITY_SOURCE},
+	}
+	for _, tree := range trees {
+		var results []consul.ManifestResult
+		var err error
+		if filterNode != "" {
+			results, _, err = lister.ListPods(tree.prefix, filterNode)
+		} else {
+			results, _, err = lister.AllPods(tree.prefix)
+		}
+		if err != nil {
+			return nil, util.Errorf("Could not list the %s tree: %s", tree.prefix, err)
+		}
+		for _, result := range results {
+			err = inspect.AddKVPToMap(result, tree.source, filterNode, filterPod, statusMap)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var statuses podStatuses
+	for podID, nodes := range statusMap {
+		results, err := checker.Service(podID.String())
+		if err != nil {
+			return nil, util.Errorf("Could not retrieve health checks for pod %s: %s", podID, err)
+		}
+		for node, status := range nodes {
+			status.NodeName = node
+			status.PodId = podID
+			if result, ok := results[node]; ok {
+				status.Health = result.Status
+			}
+			statuses = append(statuses, status)
+		}
+	}
+	sort.Sort(statuses)
+	return statuses, nil
+}
+
+// printTable writes one row per node and pod, e.g.
+//
+//	NODE              POD   INTENT        REALITY       HEALTH
+//	aws1.example.com  isup  717cc0d58df2  717cc0d58df2  passing
+//	aws2.example.com  isup  b56d3c3fd3c2  -             -
+func printTable(w io.Writer, statuses []inspect.NodePodStatus) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NODE\tPOD\tINTENT\tREALITY\tHEALTH")
+	for _, status := range statuses {
+		fmt.Fprintf(
+			tw,
+			"%s\t%s\t%s\t%s\t%s\n",
+			status.NodeName,
+			status.PodId,
+			orDash(shortSHA(status.IntentManifestSHA)),
+			orDash(shortSHA(status.RealityManifestSHA)),
+			orDash(string(status.Health)),
+		)
+	}
+	return tw.Flush()
+}
+
+// printJSON writes the statuses as a JSON list, in the format of
+// `p2-inspect --format list`
+func printJSON(w io.Writer, statuses []inspect.NodePodStatus) error {
+	if statuses == nil {
+		statuses = []inspect.NodePodStatus{}
+	}
+	return json.NewEncoder(w).Encode(statuses)
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > shortSHALength {
+		return sha[:shortSHALength]
+	}
+	return sha
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/health"
+	"github.com/square/p2/pkg/inspect"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+)
+
+type fakeLister map[consul.PodPrefix][]consul.ManifestResult
+
+func (f fakeLister) ListPods(podPrefix consul.PodPrefix, nodename types.NodeName) ([]consul.ManifestResult, time.Duration, error) {
+	var results []consul.ManifestResult
+	for _, result := range f[podPrefix] {
+		if result.PodLocation.Node == nodename {
+			results = append(results, result)
+		}
+	}
+	return results, 0, nil
+}
+
+func (f fakeLister) AllPods(podPrefix consul.PodPrefix) ([]consul.ManifestResult, time.Duration, error) {
+	return f[podPrefix], 0, nil
+}
+
+type fakeChecker map[string]map[types.NodeName]health.Result
+
+func (f fakeChecker) Service(serviceID string) (map[types.NodeName]health.Result, error) {
+	return f[serviceID], nil
+}
+
+func testResult(t *testing.T, node types.NodeName, id types.PodID, statusPort int) (consul.ManifestResult, string) {
+	builder := manifest.NewBuilder()
+	builder.SetID(id)
+	builder.SetStatusPort(statusPort)
+	m := builder.GetManifest()
+	sha, err := m.SHA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return consul.ManifestResult{
+		Manifest:    m,
+		PodLocation: types.PodLocation{Node: node, PodID: id},
+	}, sha
+}
+
+func TestCollectStatuses(t *testing.T) {
+	oldIsup, oldSHA := testResult(t, "node2", "isup", 8000)
+	newIsup, newSHA := testResult(t, "node2", "isup", 8001)
+	isup1, isup1SHA := testResult(t, "node1", "isup", 8001)
+	lister := fakeLister{
+		consul.INTENT_TREE:  {newIsup, isup1},
+		consul.REALITY_TREE: {oldIsup},
+	}
+	checker := fakeChecker{
+		"isup": {"node2": {Status: health.Critical}},
+	}
+
+	statuses, err := collectStatuses(lister, checker, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 2 {
+		t.Fatalf("expected a status for each of the 2 nodes, got %d", len(statuses))
+	}
+	if statuses[0].NodeName != "node1" || statuses[0].IntentManifestSHA != isup1SHA || statuses[0].RealityManifestSHA != "" || statuses[0].Health != "" {
+		t.Errorf("expected node1 to be scheduled but not running, got %+v", statuses[0])
+	}
+	if statuses[1].NodeName != "node2" || statuses[1].IntentManifestSHA != newSHA || statuses[1].RealityManifestSHA != oldSHA || statuses[1].Health != health.Critical {
+		t.Errorf("expected node2 to be running an old, critical manifest, got %+v", statuses[1])
+	}
+
+	statuses, err = collectStatuses(lister, checker, "node2", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 || statuses[0].NodeName != "node2" {
+		t.Errorf("expected only node2 with --node node2, got %+v", statuses)
+	}
+}
+
+func TestPrintTable(t *testing.T) {
+	statuses := []inspect.NodePodStatus{
+		{
+			NodeName:           "aws1.example.com",
+			PodId:              "isup",
+			IntentManifestSHA:  "717cc0d58df240e2668c865cdc063d715446e6db09ad4b64f7a2f0f4e361ea8f",
+			RealityManifestSHA: "717cc0d58df240e2668c865cdc063d715446e6db09ad4b64f7a2f0f4e361ea8f",
+			Health:             health.Passing,
+		},
+		{
+			NodeName:          "aws2.example.com",
+			PodId:             "isup",
+			IntentManifestSHA: "b56d3c3fd3c264841c8aad6a9ce6f06271a62dc6daffeef0efb6b50d86424bc6",
+		},
+	}
+
+	var out bytes.Buffer
+	err := printTable(&out, statuses)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "NODE              POD   INTENT        REALITY       HEALTH\n" +
+		"aws1.example.com  isup  717cc0d58df2  717cc0d58df2  passing\n" +
+		"aws2.example.com  isup  b56d3c3fd3c2  -             -\n"
+	if out.String() != expected {
+		t.Errorf("expected the table:\n%s\ngot:\n%s", expected, out.String())
+	}
+
+	out.Reset()
+	err = printJSON(&out, statuses)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed []inspect.NodePodStatus
+	err = json.Unmarshal(out.Bytes(), &parsed)
+	if err != nil {
+		t.Fatalf("expected --json to print a JSON list, got %s: %s", out.String(), err)
+	}
+	if len(parsed) != 2 || parsed[1].IntentManifestSHA != statuses[1].IntentManifestSHA {
+		t.Errorf("expected the statuses to round trip through JSON, got %+v", parsed)
+	}
+}
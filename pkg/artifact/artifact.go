@@ -16,7 +16,7 @@ import (
 )
 
 var (
-	tarAppNameParse = regexp.MustCompile(`^([\w\-]+)_([a-zA-Z0-9]+)\.tar(\.gz)?$`)
+	tarAppNameParse = regexp.MustCompile(`^([\w\-]+)_([a-zA-Z0-9]+)\.tar(\.gz|\.xz|\.zst)?$`)
 )
 
 type Artifact struct {
@@ -1,11 +1,14 @@
 package artifact
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"io"
 	"io/ioutil"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/square/p2/pkg/auth"
 	"github.com/square/p2/pkg/gzip"
@@ -20,11 +23,24 @@ type Downloader interface {
 	Download(location *url.URL, verificationData auth.VerificationData, destination string, owner string) error
 }
 
-// Implements the Downloader interface. Simply fetches a .tar.gz file from a
-// configured URL and extracts it to the location passed to DownloadTo
+// Implements the Downloader interface. Simply fetches a tarball, which may be
+// compressed with gzip, xz or zstd, from a configured URL and extracts it to
+// the location passed to DownloadTo
 type downloader struct {
 	fetcher  uri.Fetcher
 	verifier auth.ArtifactVerifier
+	cache    PeerCache
+}
+
+// PeerCache is a source of artifacts, named by their digest, that is tried
+// before an artifact's location, e.g. other nodes that have already downloaded
+// it. See the artifactcache package
+type PeerCache interface {
+	// Open returns the artifact with the given hex-encoded SHA-256 digest,
+	// or an error if no peer has it
+	Open(digest string) (io.ReadCloser, error)
+	// Add offers a verified artifact to peers
+	Add(digest string, artifactFile *os.File) error
 }
 
 func NewLocationDownloader(fetcher uri.Fetcher, verifier auth.ArtifactVerifier) Downloader {
@@ -35,27 +51,57 @@ func NewLocationDownloader(fetcher uri.Fetcher, verifier auth.ArtifactVerifier)
 }
 
 func (l *downloader) Download(location *url.URL, verificationData auth.VerificationData, dst string, owner string) error {
+	artifactFile, err := l.fetchVerified(location, verificationData, nil)
+	if err != nil {
+		return err
+	}
+	defer removeArtifactFile(artifactFile)
+	return l.extract(artifactFile, dst, owner)
+}
+
+// fetchVerified copies the artifact at location to a temporary file and
+// verifies it. The caller must remove the file with removeArtifactFile(). If
+// abort is closed before the artifact is copied, the copy is stopped by
+// closing the remote artifact.
+func (l *downloader) fetchVerified(location *url.URL, verificationData auth.VerificationData, abort <-chan struct{}) (*os.File, error) {
 	// Write to a temporary file for easy cleanup if the network transfer fails
 	// TODO: the end of the artifact URL may not always be suitable as a directory
 	// name
 	artifactFile, err := ioutil.TempFile("", filepath.Base(location.Path))
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer os.Remove(artifactFile.Name())
-	defer artifactFile.Close()
-
-	remoteData, err := l.fetcher.Open(location)
+	err = l.copyVerified(artifactFile, location, verificationData, abort)
 	if err != nil {
-		return err
+		removeArtifactFile(artifactFile)
+		return nil, err
 	}
-	defer remoteData.Close()
-	_, err = io.Copy(artifactFile, remoteData)
-	if err != nil {
-		return util.Errorf("Could not copy artifact locally: %v", err)
+	return artifactFile, nil
+}
+
+func (l *downloader) copyVerified(artifactFile *os.File, location *url.URL, verificationData auth.VerificationData, abort <-chan struct{}) error {
+	// A digest pinned in the manifest, e.g. by a Resolver at schedule
+	// time, must match whichever verifier is configured
+	digest := strings.ToLower(strings.TrimSpace(verificationData.ArtifactDigest))
+
+	// Only artifacts with a pinned digest can be taken from peers, since
+	// that is the only proof a peer didn't tamper with them
+	fromPeer := false
+	if l.cache != nil && digest != "" {
+		fromPeer = l.copyFromPeer(artifactFile, digest, abort) == nil
+	}
+	if !fromPeer {
+		remoteData, err := l.fetcher.Open(location)
+		if err != nil {
+			return err
+		}
+		err = copyDigest(artifactFile, remoteData, digest, abort)
+		if err != nil {
+			return err
+		}
 	}
 	// rewind once so we can ask the verifier
-	_, err = artifactFile.Seek(0, os.SEEK_SET)
+	_, err := artifactFile.Seek(0, os.SEEK_SET)
 	if err != nil {
 		return util.Errorf("Could not reset artifact file position for verification: %v", err)
 	}
@@ -64,16 +110,79 @@ func (l *downloader) Download(location *url.URL, verificationData auth.Verificat
 	if err != nil {
 		return err
 	}
+	if l.cache != nil && digest != "" {
+		// Best effort: failing to share the artifact doesn't stop
+		// this node from using it
+		_ = l.cache.Add(digest, artifactFile)
+	}
+	return nil
+}
+
+// copyFromPeer copies the artifact with the given digest from the peer
+// cache. If that fails the artifact file is emptied, ready to be copied from
+// the artifact's location instead.
+func (l *downloader) copyFromPeer(artifactFile *os.File, digest string, abort <-chan struct{}) error {
+	peerData, err := l.cache.Open(digest)
+	if err == nil {
+		err = copyDigest(artifactFile, peerData, digest, abort)
+	}
+	if err == nil {
+		return nil
+	}
+	if truncErr := artifactFile.Truncate(0); truncErr != nil {
+		return truncErr
+	}
+	if _, seekErr := artifactFile.Seek(0, os.SEEK_SET); seekErr != nil {
+		return seekErr
+	}
+	return err
+}
+
+// copyDigest copies and closes remoteData, checking the copy against digest
+// unless it is empty.
+func copyDigest(artifactFile *os.File, remoteData io.ReadCloser, digest string, abort <-chan struct{}) error {
+	defer remoteData.Close()
+	if abort != nil {
+		copied := make(chan struct{})
+		defer close(copied)
+		go func() {
+			select {
+			case <-abort:
+				_ = remoteData.Close()
+			case <-copied:
+			}
+		}()
+	}
+	hasher := sha256.New()
+	_, err := io.Copy(io.MultiWriter(artifactFile, hasher), remoteData)
+	if err != nil {
+		return util.Errorf("Could not copy artifact locally: %v", err)
+	}
+	if digest != "" {
+		realDigest := hex.EncodeToString(hasher.Sum(nil))
+		if realDigest != digest {
+			return util.Errorf("Artifact hex digest did not match the manifest: expected %v, was actually %v", digest, realDigest)
+		}
+	}
+	return nil
+}
 
-	err = artifactFile.Chmod(0644)
+// extract unpacks a verified artifact to dst.
+func (l *downloader) extract(artifactFile *os.File, dst string, owner string) error {
+	err := artifactFile.Chmod(0644)
 	if err != nil {
 		return err
 	}
 
-	err = gzip.ExtractTarGz(owner, artifactFile.Name(), dst)
+	err = gzip.ExtractTarball(owner, artifactFile.Name(), dst)
 	if err != nil {
 		_ = os.RemoveAll(dst)
 		return util.Errorf("error while extracting artifact: %s", err)
 	}
 	return err
 }
+
+func removeArtifactFile(artifactFile *os.File) {
+	_ = artifactFile.Close()
+	_ = os.Remove(artifactFile.Name())
+}
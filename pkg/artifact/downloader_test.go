@@ -0,0 +1,95 @@
+package artifact
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/square/p2/pkg/auth"
+)
+
+func TestFetchVerifiedChecksPinnedDigest(t *testing.T) {
+	data := []byte("not really a tarball")
+	sum := sha256.Sum256(data)
+	location, err := url.Parse(testLocation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &downloader{fetcher: &FakeFetcher{Data: data}, verifier: auth.NopVerifier()}
+
+	artifactFile, err := l.fetchVerified(location, auth.VerificationData{ArtifactDigest: strings.ToUpper(hex.EncodeToString(sum[:]))}, nil)
+	if err != nil {
+		t.Fatalf("expected an artifact matching its pinned digest to be accepted, got %s", err)
+	}
+	removeArtifactFile(artifactFile)
+
+	artifactFile, err = l.fetchVerified(location, auth.VerificationData{ArtifactDigest: strings.Repeat("0", 64)}, nil)
+	if err == nil {
+		removeArtifactFile(artifactFile)
+		t.Fatal("expected an artifact not matching its pinned digest to be refused, even without a verifier")
+	}
+}
+
+type fakePeerCache struct {
+	data  []byte
+	added string
+}
+
+func (c *fakePeerCache) Open(digest string) (io.ReadCloser, error) {
+	return ioutil.NopCloser(bytes.NewReader(c.data)), nil
+}
+
+func (c *fakePeerCache) Add(digest string, artifactFile *os.File) error {
+	c.added = digest
+	return nil
+}
+
+func TestFetchVerifiedPrefersPeers(t *testing.T) {
+	data := []byte("not really a tarball")
+	sum := sha256.Sum256(data)
+	digest := hex.EncodeToString(sum[:])
+	location, err := url.Parse(testLocation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fetcher := &FakeFetcher{Data: data}
+	cache := &fakePeerCache{data: data}
+	l := &downloader{fetcher: fetcher, verifier: auth.NopVerifier(), cache: cache}
+	artifactFile, err := l.fetchVerified(location, auth.VerificationData{ArtifactDigest: digest}, nil)
+	if err != nil {
+		t.Fatalf("expected the artifact to be fetched from a peer, got %s", err)
+	}
+	removeArtifactFile(artifactFile)
+	if fetcher.FetchedURL != nil {
+		t.Error("expected the artifact's location not to be fetched when a peer has it")
+	}
+	if cache.added != digest {
+		t.Errorf("expected the verified artifact to be added to the cache, got %q", cache.added)
+	}
+
+	// A peer serving the wrong artifact is ignored
+	cache = &fakePeerCache{data: []byte("tampered with, and longer than the real artifact")}
+	l.cache = cache
+	artifactFile, err = l.fetchVerified(location, auth.VerificationData{ArtifactDigest: digest}, nil)
+	if err != nil {
+		t.Fatalf("expected a bad peer copy to fall back to the artifact's location, got %s", err)
+	}
+	defer removeArtifactFile(artifactFile)
+	if fetcher.FetchedURL == nil {
+		t.Error("expected the artifact's location to be fetched")
+	}
+	contents, err := ioutil.ReadAll(artifactFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(contents, data) {
+		t.Errorf("expected the artifact file to hold only the real artifact, got %q", contents)
+	}
+}
@@ -0,0 +1,141 @@
+package artifact
+
+import (
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/square/p2/pkg/auth"
+	"github.com/square/p2/pkg/uri"
+	"github.com/square/p2/pkg/util"
+)
+
+// DefaultDownloadConcurrency is the number of artifacts a DownloadPool
+// fetches and verifies at once when no concurrency is configured.
+const DefaultDownloadConcurrency = 4
+
+// A DownloadPool bounds how many artifacts are fetched and verified at once,
+// e.g. across every pod a preparer is installing, and how long each may take.
+// Artifacts are downloaded through the Downloaders it returns, concurrently
+// with DownloadAll().
+type DownloadPool struct {
+	slots chan struct{}
+	// The longest an artifact may take to be fetched and verified. Zero
+	// means no limit. Extraction is not limited.
+	timeout time.Duration
+	// If set, artifacts with a pinned digest are fetched from peers before
+	// their location
+	cache PeerCache
+}
+
+// NewDownloadPool returns a pool that downloads at most concurrency
+// artifacts at once, DefaultDownloadConcurrency if it isn't positive.
+func NewDownloadPool(concurrency int, timeout time.Duration) *DownloadPool {
+	if concurrency <= 0 {
+		concurrency = DefaultDownloadConcurrency
+	}
+	return &DownloadPool{
+		slots:   make(chan struct{}, concurrency),
+		timeout: timeout,
+	}
+}
+
+// SetPeerCache makes the pool's downloaders try cache for artifacts whose
+// digest is pinned before fetching them from their location, and offer it
+// every such artifact they download. It must be called before the pool is
+// used.
+func (p *DownloadPool) SetPeerCache(cache PeerCache) {
+	p.cache = cache
+}
+
+// Downloader returns a Downloader that fetches and verifies artifacts with
+// fetcher and verifier, waiting for a free slot in the pool first.
+func (p *DownloadPool) Downloader(fetcher uri.Fetcher, verifier auth.ArtifactVerifier) Downloader {
+	return pooledDownloader{
+		pool: p,
+		downloader: &downloader{
+			fetcher:  fetcher,
+			verifier: verifier,
+			cache:    p.cache,
+		},
+	}
+}
+
+type pooledDownloader struct {
+	pool       *DownloadPool
+	downloader *downloader
+}
+
+type fetchResult struct {
+	artifactFile *os.File
+	err          error
+}
+
+// Download holds a slot in the pool until the artifact is extracted or fails.
+// If fetching and verifying the artifact times out an error is returned
+// right away, but the slot is only released once the fetch has stopped.
+func (d pooledDownloader) Download(location *url.URL, verificationData auth.VerificationData, dst string, owner string) error {
+	d.pool.slots <- struct{}{}
+	release := func() { <-d.pool.slots }
+
+	fetched := make(chan fetchResult, 1)
+	abort := make(chan struct{})
+	go func() {
+		artifactFile, err := d.downloader.fetchVerified(location, verificationData, abort)
+		fetched <- fetchResult{artifactFile, err}
+	}()
+
+	var timeout <-chan time.Time
+	if d.pool.timeout > 0 {
+		timer := time.NewTimer(d.pool.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case result := <-fetched:
+		defer release()
+		if result.err != nil {
+			return result.err
+		}
+		defer removeArtifactFile(result.artifactFile)
+		return d.downloader.extract(result.artifactFile, dst, owner)
+	case <-timeout:
+		close(abort)
+		go func() {
+			result := <-fetched
+			if result.artifactFile != nil {
+				removeArtifactFile(result.artifactFile)
+			}
+			release()
+		}()
+		return util.Errorf("Timed out after %s fetching and verifying %s", d.pool.timeout, location)
+	}
+}
+
+// A DownloadRequest is one artifact for DownloadAll() to download.
+type DownloadRequest struct {
+	Location         *url.URL
+	VerificationData auth.VerificationData
+	Destination      string
+	Owner            string
+}
+
+// DownloadAll downloads every requested artifact concurrently with
+// downloader and waits for them all. A pooled downloader bounds the
+// concurrency. The returned errors are in the order of the requests, nil for
+// each artifact that was downloaded.
+func DownloadAll(downloader Downloader, requests []DownloadRequest) []error {
+	errs := make([]error, len(requests))
+	var wg sync.WaitGroup
+	for i, request := range requests {
+		wg.Add(1)
+		go func(i int, request DownloadRequest) {
+			defer wg.Done()
+			errs[i] = downloader.Download(request.Location, request.VerificationData, request.Destination, request.Owner)
+		}(i, request)
+	}
+	wg.Wait()
+	return errs
+}
@@ -0,0 +1,127 @@
+package artifact
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/auth"
+)
+
+// blockingFetcher's artifacts can't be read until release is closed, and can
+// never be read if it is nil. Reading one fails once it is released.
+type blockingFetcher struct {
+	release chan struct{}
+
+	mu     sync.Mutex
+	open   int
+	peak   int
+	closed int
+}
+
+type blockingReader struct {
+	fetcher *blockingFetcher
+	closed  chan struct{}
+	once    sync.Once
+}
+
+func (f *blockingFetcher) Open(u *url.URL) (io.ReadCloser, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.open++
+	if f.open > f.peak {
+		f.peak = f.open
+	}
+	return &blockingReader{fetcher: f, closed: make(chan struct{})}, nil
+}
+
+func (f *blockingFetcher) Head(u *url.URL) (*http.Response, error) {
+	return nil, errors.New("Head not implemented on blocking fetcher")
+}
+
+func (f *blockingFetcher) CopyLocal(u *url.URL, dstPath string) error {
+	return errors.New("CopyLocal not implemented on blocking fetcher")
+}
+
+func (r *blockingReader) Read(p []byte) (int, error) {
+	select {
+	case <-r.fetcher.release:
+		return 0, errors.New("artifact not found")
+	case <-r.closed:
+		return 0, errors.New("artifact closed")
+	}
+}
+
+func (r *blockingReader) Close() error {
+	r.once.Do(func() {
+		close(r.closed)
+		r.fetcher.mu.Lock()
+		defer r.fetcher.mu.Unlock()
+		r.fetcher.open--
+		r.fetcher.closed++
+	})
+	return nil
+}
+
+func downloadRequests(t *testing.T, n int) []DownloadRequest {
+	location, err := url.Parse(testLocation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests := make([]DownloadRequest, n)
+	for i := range requests {
+		requests[i] = DownloadRequest{Location: location, Destination: "/nonexistent"}
+	}
+	return requests
+}
+
+func TestDownloadPoolConcurrency(t *testing.T) {
+	fetcher := &blockingFetcher{release: make(chan struct{})}
+	pool := NewDownloadPool(2, 0)
+
+	done := make(chan []error)
+	go func() {
+		done <- DownloadAll(pool.Downloader(fetcher, auth.NopVerifier()), downloadRequests(t, 5))
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(fetcher.release)
+
+	errs := <-done
+	if len(errs) != 5 {
+		t.Fatalf("Expected an error for each of 5 requests, got %d", len(errs))
+	}
+	for i, err := range errs {
+		if err == nil || !strings.Contains(err.Error(), "artifact not found") {
+			t.Errorf("Expected request %d to fail with the fetch error, got %v", i, err)
+		}
+	}
+	if fetcher.peak != 2 {
+		t.Errorf("Expected 2 artifacts to be fetched at once, but %d were", fetcher.peak)
+	}
+}
+
+func TestDownloadPoolTimeout(t *testing.T) {
+	// Never released, so every fetch hangs until it is aborted
+	fetcher := &blockingFetcher{}
+	pool := NewDownloadPool(1, 10*time.Millisecond)
+
+	errs := DownloadAll(pool.Downloader(fetcher, auth.NopVerifier()), downloadRequests(t, 2))
+	for i, err := range errs {
+		if err == nil || !strings.Contains(err.Error(), "Timed out") {
+			t.Errorf("Expected request %d to time out, got %v", i, err)
+		}
+	}
+
+	// The second download only starts once the first fetch stops, so the
+	// first was aborted by the time DownloadAll returns
+	fetcher.mu.Lock()
+	defer fetcher.mu.Unlock()
+	if fetcher.closed < 1 {
+		t.Error("Expected a timed out fetch to be aborted")
+	}
+}
@@ -66,6 +66,9 @@ func NewRegistry(registryURL *url.URL, fetcher uri.Fetcher, osVersionDetector os
 // manifest: ".manifest"
 // manifest signature: ".manifest.sig"
 // build signature: ".sig"
+//
+// In both cases the pod ID and the stanza's artifact_digest and
+// artifact_signature, if any, are included in the returned verification data.
 func (a registry) LocationDataForLaunchable(podID types.PodID, launchableID launch.LaunchableID, stanza launch.LaunchableStanza) (*url.URL, auth.VerificationData, error) {
 	if stanza.Location == "" && stanza.Version.ID == "" {
 		return nil, auth.VerificationData{}, util.Errorf("Launchable must provide either \"location\" or \"version\" fields")
@@ -77,12 +80,15 @@ func (a registry) LocationDataForLaunchable(podID types.PodID, launchableID laun
 
 	// infer the verification data using magical suffixes
 	if stanza.Location != "" {
-		location, err := url.Parse(stanza.Location)
+		location, err := stanza.ArtifactURL()
 		if err != nil {
-			return nil, auth.VerificationData{}, util.Errorf("Couldn't parse launchable url '%s': %s", stanza.Location, err)
+			return nil, auth.VerificationData{}, err
 		}
 
 		verificationData := VerificationDataForLocation(location)
+		verificationData.PodID = podID
+		verificationData.ArtifactDigest = stanza.ArtifactDigest
+		verificationData.ArtifactSignature = stanza.ArtifactSignature
 		return location, verificationData, nil
 	}
 
@@ -90,7 +96,14 @@ func (a registry) LocationDataForLaunchable(podID types.PodID, launchableID laun
 		return nil, auth.VerificationData{}, util.Errorf("No artifact registry configured and location field not present on launchable %s", launchableID)
 	}
 
-	return a.fetchRegistryData(podID, launchableID, stanza.Version)
+	location, verificationData, err := a.fetchRegistryData(podID, launchableID, stanza.Version)
+	if err != nil {
+		return nil, auth.VerificationData{}, err
+	}
+	verificationData.PodID = podID
+	verificationData.ArtifactDigest = stanza.ArtifactDigest
+	verificationData.ArtifactSignature = stanza.ArtifactSignature
+	return location, verificationData, nil
 }
 
 func (a registry) CheckArtifactExists(u *url.URL) (bool, error) {
@@ -110,7 +123,7 @@ func (a registry) CheckArtifactExists(u *url.URL) (bool, error) {
 			return false, err
 		}
 		return true, nil
-	case "http", "https":
+	case "http", "https", "s3":
 		resp, err := a.fetcher.Head(u)
 		if err != nil {
 			return false, err
@@ -129,6 +142,7 @@ type RegistryResponse struct {
 	ManifestLocation          string `json:"manifest_location"`
 	ManifestSignatureLocation string `json:"manifest_signature_location"`
 	BuildSignatureLocation    string `json:"signature_location"`
+	ChecksumLocation          string `json:"checksum_location"`
 }
 
 func (a registry) fetchRegistryData(podID types.PodID, launchableID launch.LaunchableID, version launch.LaunchableVersion) (*url.URL, auth.VerificationData, error) {
@@ -226,6 +240,14 @@ func (a registry) authDataFromRegistryResponse(registryResponse RegistryResponse
 		verificationData.BuildSignatureLocation = buildSignatureURL
 	}
 
+	if registryResponse.ChecksumLocation != "" {
+		checksumURL, err := url.Parse(registryResponse.ChecksumLocation)
+		if err != nil {
+			return verificationData, util.Errorf("Couldn't parse checksum URL from registry response: %s", err)
+		}
+		verificationData.ChecksumLocation = checksumURL
+	}
+
 	return verificationData, nil
 }
 
@@ -241,9 +263,15 @@ func VerificationDataForLocation(location *url.URL) auth.VerificationData {
 	buildSignatureLocation := &url.URL{}
 	*buildSignatureLocation = *location
 	buildSignatureLocation.Path = location.Path + ".sig"
+
+	checksumLocation := &url.URL{}
+	*checksumLocation = *location
+	checksumLocation.Path = location.Path + ".sha256"
 	return auth.VerificationData{
+		ArtifactLocation:          location,
 		ManifestLocation:          manifestLocation,
 		ManifestSignatureLocation: manifestSignatureLocation,
 		BuildSignatureLocation:    buildSignatureLocation,
+		ChecksumLocation:          checksumLocation,
 	}
 }
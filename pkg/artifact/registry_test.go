@@ -104,6 +104,15 @@ func TestLocationDataForLaunchableWithLocation(t *testing.T) {
 			artifactData.BuildSignatureLocation.String(),
 		)
 	}
+
+	expectedChecksumLocation := testLocation + ".sha256"
+	if artifactData.ChecksumLocation.String() != expectedChecksumLocation {
+		t.Errorf(
+			"Didn't properly compute checksum location: wanted '%s' was '%s'",
+			expectedChecksumLocation,
+			artifactData.ChecksumLocation.String(),
+		)
+	}
 }
 
 func TestNeitherVersionNorLocationInvalid(t *testing.T) {
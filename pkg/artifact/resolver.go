@@ -0,0 +1,250 @@
+package artifact
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/uri"
+	"github.com/square/p2/pkg/util"
+)
+
+// LatestVersion is the version ID that resolves to the newest version published
+// to the channel named by the launchable's "channel" version tag, e.g.
+//
+//	version:
+//	  id: latest
+//	  tags:
+//	    channel: stable
+const LatestVersion launch.LaunchableVersionID = "latest"
+
+const channelTag = "channel"
+
+var (
+	digestRegex           = regexp.MustCompile(`^[a-fA-F0-9]{64}$`)
+	tarballExtensionRegex = regexp.MustCompile(`\.tar(\.gz|\.xz|\.zst)?$`)
+)
+
+// IndexedVersion is a version of an artifact listed by a VersionIndex.
+type IndexedVersion struct {
+	Version   launch.LaunchableVersionID `json:"version"`
+	Location  string                     `json:"location"`
+	Digest    string                     `json:"digest"` // The hex-encoded SHA-256 digest of the artifact
+	Channels  []string                   `json:"channels,omitempty"`
+	Published time.Time                  `json:"published"`
+}
+
+func (v IndexedVersion) inChannel(channel string) bool {
+	for _, c := range v.Channels {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// VersionIndex lists the published versions of artifacts.
+type VersionIndex interface {
+	Versions(name launch.ArtifactName) ([]IndexedVersion, error)
+}
+
+// NewVersionIndex returns the index at indexURL: a GCS bucket listing for
+// gs://bucket/prefix URLs, and otherwise an HTTP index. See NewHTTPIndex and
+// NewGCSIndex
+func NewVersionIndex(indexURL *url.URL, fetcher uri.Fetcher) VersionIndex {
+	if indexURL.Scheme == "gs" {
+		return NewGCSIndex(indexURL.Host, strings.TrimPrefix(indexURL.Path, "/"), fetcher)
+	}
+	return NewHTTPIndex(indexURL, fetcher)
+}
+
+type httpIndex struct {
+	baseURL *url.URL
+	fetcher uri.Fetcher
+}
+
+// NewHTTPIndex returns an index that reads the versions of each artifact from
+// <baseURL>/<name>.json, a JSON object of the form {"versions": [...]} listing
+// IndexedVersions.
+func NewHTTPIndex(baseURL *url.URL, fetcher uri.Fetcher) VersionIndex {
+	return httpIndex{baseURL: baseURL, fetcher: fetcher}
+}
+
+func (h httpIndex) Versions(name launch.ArtifactName) ([]IndexedVersion, error) {
+	indexURL := *h.baseURL
+	indexURL.Path = path.Join(indexURL.Path, name.String()+".json")
+	var index struct {
+		Versions []IndexedVersion `json:"versions"`
+	}
+	err := fetchJSON(h.fetcher, &indexURL, &index)
+	if err != nil {
+		return nil, util.Errorf("Could not read the index of %s: %s", name, err)
+	}
+	return index.Versions, nil
+}
+
+// The GCS JSON API, see https://cloud.google.com/storage/docs/json_api/v1/objects/list
+const gcsAPIBase = "https://storage.googleapis.com"
+
+type gcsIndex struct {
+	bucket  string
+	prefix  string
+	fetcher uri.Fetcher
+	apiBase string
+}
+
+// NewGCSIndex returns an index that lists the objects in bucket named
+// <prefix>/<name>_<version>.tar.gz (or any other artifact extension). Since
+// GCS only records MD5 hashes, an object's SHA-256 digest must be set as its
+// "sha256" metadata, and its channels as comma separated "channels" metadata.
+// Objects without a digest are not listed. The listing is requested from the
+// GCS JSON API with fetcher, so private buckets need a fetcher that
+// authenticates, such as a uri.GCSFetcher.
+func NewGCSIndex(bucket string, prefix string, fetcher uri.Fetcher) VersionIndex {
+	return gcsIndex{bucket: bucket, prefix: prefix, fetcher: fetcher, apiBase: gcsAPIBase}
+}
+
+type gcsObjects struct {
+	NextPageToken string `json:"nextPageToken"`
+	Items         []struct {
+		Name        string            `json:"name"`
+		TimeCreated time.Time         `json:"timeCreated"`
+		Metadata    map[string]string `json:"metadata"`
+	} `json:"items"`
+}
+
+func (g gcsIndex) Versions(name launch.ArtifactName) ([]IndexedVersion, error) {
+	listURL, err := url.Parse(fmt.Sprintf("%s/storage/v1/b/%s/o", g.apiBase, g.bucket))
+	if err != nil {
+		return nil, util.Errorf("Could not build the listing URL of bucket %s: %s", g.bucket, err)
+	}
+
+	var versions []IndexedVersion
+	pageToken := ""
+	for {
+		listURL.RawQuery = "prefix=" + url.QueryEscape(path.Join(g.prefix, name.String()+"_"))
+		if pageToken != "" {
+			listURL.RawQuery += "&pageToken=" + url.QueryEscape(pageToken)
+		}
+
+		var objects gcsObjects
+		err = fetchJSON(g.fetcher, listURL, &objects)
+		if err != nil {
+			return nil, util.Errorf("Could not list the versions of %s in bucket %s: %s", name, g.bucket, err)
+		}
+		for _, object := range objects.Items {
+			digest := object.Metadata["sha256"]
+			if digest == "" {
+				continue
+			}
+			base := strings.TrimPrefix(path.Base(object.Name), name.String()+"_")
+			version := tarballExtensionRegex.ReplaceAllString(base, "")
+			if version == base || version == "" {
+				continue
+			}
+			var channels []string
+			for _, channel := range strings.Split(object.Metadata["channels"], ",") {
+				if channel = strings.TrimSpace(channel); channel != "" {
+					channels = append(channels, channel)
+				}
+			}
+			versions = append(versions, IndexedVersion{
+				Version:   launch.LaunchableVersionID(version),
+				Location:  fmt.Sprintf("%s/%s/%s", g.apiBase, g.bucket, object.Name),
+				Digest:    digest,
+				Channels:  channels,
+				Published: object.TimeCreated,
+			})
+		}
+
+		if objects.NextPageToken == "" {
+			return versions, nil
+		}
+		pageToken = objects.NextPageToken
+	}
+}
+
+func fetchJSON(fetcher uri.Fetcher, u *url.URL, v interface{}) error {
+	data, err := fetcher.Open(u)
+	if err != nil {
+		return err
+	}
+	defer data.Close()
+	respBytes, err := ioutil.ReadAll(data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(respBytes, v)
+}
+
+// Resolver pins launchables that name an artifact version to the location and
+// digest of that version. Resolving at schedule time, rather than having each
+// preparer query the registry, means every node runs exactly the same
+// artifact even if "latest" moves in the meantime.
+type Resolver struct {
+	index VersionIndex
+}
+
+func NewResolver(index VersionIndex) Resolver {
+	return Resolver{index: index}
+}
+
+// Resolve returns the stanza with its version replaced by the location and
+// artifact_digest it resolves to. Stanzas with a location are returned
+// unchanged.
+func (r Resolver) Resolve(launchableID launch.LaunchableID, stanza launch.LaunchableStanza) (launch.LaunchableStanza, error) {
+	if stanza.Location != "" || stanza.Version.ID == "" {
+		return stanza, nil
+	}
+
+	name := stanza.Version.ArtifactOverride
+	if name == "" {
+		name = launch.ArtifactName(launchableID)
+	}
+	versions, err := r.index.Versions(name)
+	if err != nil {
+		return stanza, err
+	}
+
+	var resolved *IndexedVersion
+	if stanza.Version.ID == LatestVersion {
+		channel := stanza.Version.Tags[channelTag]
+		if channel == "" {
+			return stanza, util.Errorf("%s: version %q must have a %q tag", launchableID, LatestVersion, channelTag)
+		}
+		for i, version := range versions {
+			if version.inChannel(channel) && (resolved == nil || !version.Published.Before(resolved.Published)) {
+				resolved = &versions[i]
+			}
+		}
+		if resolved == nil {
+			return stanza, util.Errorf("%s: no version of %s has been published to channel %s", launchableID, name, channel)
+		}
+	} else {
+		for i, version := range versions {
+			if version.Version == stanza.Version.ID {
+				resolved = &versions[i]
+			}
+		}
+		if resolved == nil {
+			return stanza, util.Errorf("%s: version %s of %s is not in the index", launchableID, stanza.Version.ID, name)
+		}
+	}
+
+	if resolved.Location == "" {
+		return stanza, util.Errorf("%s: version %s of %s has no location", launchableID, resolved.Version, name)
+	}
+	if !digestRegex.MatchString(resolved.Digest) {
+		return stanza, util.Errorf("%s: version %s of %s has no SHA-256 digest to pin", launchableID, resolved.Version, name)
+	}
+	stanza.Location = resolved.Location
+	stanza.ArtifactDigest = strings.ToLower(resolved.Digest)
+	stanza.Version = launch.LaunchableVersion{}
+	return stanza, nil
+}
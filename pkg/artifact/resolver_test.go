@@ -0,0 +1,103 @@
+package artifact
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/square/p2/pkg/launch"
+)
+
+var (
+	digest1 = strings.Repeat("a", 64)
+	digest2 = strings.Repeat("b", 64)
+	digest3 = strings.Repeat("c", 64)
+)
+
+var testIndex = `{"versions": [
+	{"version": "1", "location": "https://artifacts.example.com/myapp_1.tar.gz", "digest": "` + strings.Repeat("a", 64) + `", "channels": ["stable"], "published": "2017-01-01T00:00:00Z"},
+	{"version": "3", "location": "https://artifacts.example.com/myapp_3.tar.gz", "digest": "` + strings.Repeat("c", 64) + `", "channels": ["canary"], "published": "2017-03-01T00:00:00Z"},
+	{"version": "2", "location": "https://artifacts.example.com/myapp_2.tar.gz", "digest": "` + strings.Repeat("b", 64) + `", "channels": ["stable", "canary"], "published": "2017-02-01T00:00:00Z"},
+	{"version": "4", "location": "https://artifacts.example.com/myapp_4.tar.gz", "channels": ["nightly"], "published": "2017-04-01T00:00:00Z"}
+]}`
+
+func TestResolve(t *testing.T) {
+	fetcher := &FakeFetcher{Data: []byte(testIndex)}
+	baseURL, err := url.Parse("https://index.example.com/artifacts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver := NewResolver(NewVersionIndex(baseURL, fetcher))
+
+	for _, test := range []struct {
+		version  launch.LaunchableVersion
+		location string
+		digest   string
+	}{
+		{launch.LaunchableVersion{ID: "1"}, "https://artifacts.example.com/myapp_1.tar.gz", digest1},
+		{launch.LaunchableVersion{ID: LatestVersion, Tags: map[string]string{"channel": "stable"}}, "https://artifacts.example.com/myapp_2.tar.gz", digest2},
+		{launch.LaunchableVersion{ID: LatestVersion, Tags: map[string]string{"channel": "canary"}}, "https://artifacts.example.com/myapp_3.tar.gz", digest3},
+	} {
+		resolved, err := resolver.Resolve("myapp", launch.LaunchableStanza{LaunchableType: "hoist", Version: test.version})
+		if err != nil {
+			t.Errorf("unexpected error resolving %+v: %s", test.version, err)
+			continue
+		}
+		if resolved.Location != test.location || resolved.ArtifactDigest != test.digest {
+			t.Errorf("expected %+v to resolve to %s with digest %s, got %s with digest %s", test.version, test.location, test.digest, resolved.Location, resolved.ArtifactDigest)
+		}
+		if resolved.Version.ID != "" {
+			t.Errorf("expected the version of a resolved stanza to be cleared, got %+v", resolved.Version)
+		}
+	}
+	if fetcher.FetchedURL.String() != "https://index.example.com/artifacts/myapp.json" {
+		t.Errorf("expected the index of myapp to be fetched, got %s", fetcher.FetchedURL)
+	}
+
+	for _, version := range []launch.LaunchableVersion{
+		{ID: "5"},
+		{ID: "4"}, // no digest to pin
+		{ID: LatestVersion},
+		{ID: LatestVersion, Tags: map[string]string{"channel": "nightly"}},
+		{ID: LatestVersion, Tags: map[string]string{"channel": "beta"}},
+	} {
+		_, err := resolver.Resolve("myapp", launch.LaunchableStanza{LaunchableType: "hoist", Version: version})
+		if err == nil {
+			t.Errorf("expected an error resolving %+v", version)
+		}
+	}
+
+	stanza := launch.LaunchableStanza{LaunchableType: "hoist", Location: "https://artifacts.example.com/myapp_9.tar.gz"}
+	resolved, err := resolver.Resolve("myapp", stanza)
+	if err != nil || resolved.Location != stanza.Location {
+		t.Errorf("expected a stanza with a location to be left alone, got %+v, %v", resolved, err)
+	}
+}
+
+func TestGCSIndex(t *testing.T) {
+	fetcher := &FakeFetcher{Data: []byte(`{"items": [
+		{"name": "apps/myapp_1.tar.gz", "timeCreated": "2017-01-01T00:00:00Z", "metadata": {"sha256": "` + digest1 + `", "channels": "stable, canary"}},
+		{"name": "apps/myapp_2.tar.gz", "timeCreated": "2017-02-01T00:00:00Z"}
+	]}`)}
+	indexURL, err := url.Parse("gs://artifacts/apps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions, err := NewVersionIndex(indexURL, fetcher).Versions("myapp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fetcher.FetchedURL.String() != "https://storage.googleapis.com/storage/v1/b/artifacts/o?prefix=apps%2Fmyapp_" {
+		t.Errorf("expected the bucket to be listed by prefix, got %s", fetcher.FetchedURL)
+	}
+	if len(versions) != 1 {
+		t.Fatalf("expected only the object with a digest to be listed, got %+v", versions)
+	}
+	version := versions[0]
+	if version.Version != "1" || version.Location != "https://storage.googleapis.com/artifacts/apps/myapp_1.tar.gz" || version.Digest != digest1 {
+		t.Errorf("unexpected version listed: %+v", version)
+	}
+	if !version.inChannel("stable") || !version.inChannel("canary") {
+		t.Errorf("expected the version to be in the stable and canary channels, got %v", version.Channels)
+	}
+}
@@ -0,0 +1,273 @@
+// Package artifactcache lets nodes download artifacts from each other rather
+// than all at once from the artifact server. Each node keeps a copy of the
+// artifacts it has downloaded and verified, named by their SHA-256 digest,
+// serves them over HTTP and advertises them in consul. Artifacts are only
+// fetched from peers when the manifest pins their digest, and the digest is
+// checked after every peer download. See artifact.PeerCache
+package artifactcache
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/square/p2/pkg/artifact"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/store/consul/artifactcachestore"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// The number of peers tried for an artifact before falling back to its
+// location, if Config.MaxPeers isn't set
+const DefaultMaxPeers = 3
+
+const artifactsPath = "/artifacts/"
+
+var digestRegex = regexp.MustCompile(`^[a-f0-9]{64}$`)
+
+// Config is the "artifact_cache" section of the preparer config, e.g.
+//
+//	artifact_cache:
+//	  dir: /data/pods/.artifact_cache
+//	  listen_address: ":4141"
+//	  max_bytes: 10737418240
+type Config struct {
+	// The directory cached artifacts are kept in
+	Dir string `yaml:"dir"`
+	// The address cached artifacts are served to peers on
+	ListenAddress string `yaml:"listen_address"`
+	// The base URL peers fetch artifacts from. Defaults to
+	// http://<node name>:<listen port>
+	AdvertiseURL string `yaml:"advertise_url,omitempty"`
+	// If positive, the least recently added artifacts are evicted once the
+	// cache holds more than this many bytes
+	MaxBytes int64 `yaml:"max_bytes,omitempty"`
+	// How many peers to try before downloading from the artifact's location.
+	// Defaults to DefaultMaxPeers
+	MaxPeers int `yaml:"max_peers,omitempty"`
+}
+
+// Subset of artifactcachestore.ConsulStore used to find and advertise peers
+type peerStore interface {
+	Advertise(digest string, node types.NodeName, url string) error
+	Withdraw(digest string, node types.NodeName) error
+	Peers(digest string) ([]artifactcachestore.Peer, error)
+}
+
+// Cache is an artifact.PeerCache that shares artifacts between nodes.
+type Cache struct {
+	config Config
+	node   types.NodeName
+	store  peerStore
+	client *http.Client
+	logger logging.Logger
+
+	// Serializes adding and evicting artifacts
+	mu sync.Mutex
+}
+
+var _ artifact.PeerCache = &Cache{}
+
+func New(config Config, node types.NodeName, store peerStore, client *http.Client, logger logging.Logger) (*Cache, error) {
+	if config.Dir == "" {
+		return nil, util.Errorf("The artifact cache must have a dir")
+	}
+	if config.ListenAddress == "" {
+		return nil, util.Errorf("The artifact cache must have a listen_address")
+	}
+	if config.AdvertiseURL == "" {
+		_, port, err := net.SplitHostPort(config.ListenAddress)
+		if err != nil {
+			return nil, util.Errorf("Invalid artifact cache listen_address %q: %s", config.ListenAddress, err)
+		}
+		config.AdvertiseURL = fmt.Sprintf("http://%s:%s", node, port)
+	}
+	config.AdvertiseURL = strings.TrimRight(config.AdvertiseURL, "/")
+	if config.MaxPeers <= 0 {
+		config.MaxPeers = DefaultMaxPeers
+	}
+
+	err := os.MkdirAll(config.Dir, 0755)
+	if err != nil {
+		return nil, util.Errorf("Could not create the artifact cache dir: %s", err)
+	}
+	return &Cache{
+		config: config,
+		node:   node,
+		store:  store,
+		client: client,
+		logger: logger,
+	}, nil
+}
+
+func (c *Cache) artifactPath(digest string) string {
+	return filepath.Join(c.config.Dir, digest)
+}
+
+// Open implements artifact.PeerCache. Peers are tried in a random order so
+// that the nodes being deployed to spread their downloads across every node
+// that already has the artifact.
+func (c *Cache) Open(digest string) (io.ReadCloser, error) {
+	digest = strings.ToLower(digest)
+	if !digestRegex.MatchString(digest) {
+		return nil, util.Errorf("Invalid artifact digest %q", digest)
+	}
+	peers, err := c.store.Peers(digest)
+	if err != nil {
+		return nil, err
+	}
+
+	tried := 0
+	for _, i := range rand.Perm(len(peers)) {
+		peer := peers[i]
+		if peer.Node == c.node {
+			continue
+		}
+		if tried == c.config.MaxPeers {
+			break
+		}
+		tried++
+
+		logger := c.logger.SubLogger(map[string]interface{}{"digest": digest, "peer": peer.Node})
+		resp, err := c.client.Get(peer.URL)
+		if err != nil {
+			logger.WithError(err).Warnln("Could not fetch artifact from peer")
+			continue
+		}
+		if resp.StatusCode == http.StatusOK {
+			return resp.Body, nil
+		}
+		_ = resp.Body.Close()
+		logger.WithField("status", resp.Status).Warnln("Could not fetch artifact from peer")
+		if resp.StatusCode == http.StatusNotFound {
+			// The peer evicted it without withdrawing, e.g. because
+			// its pod root was wiped
+			_ = c.store.Withdraw(digest, peer.Node)
+		}
+	}
+	return nil, util.Errorf("No peer has artifact %s", digest)
+}
+
+// Add implements artifact.PeerCache. The artifact is copied into the cache
+// and advertised to peers, evicting older artifacts if the cache is full.
+func (c *Cache) Add(digest string, artifactFile *os.File) error {
+	digest = strings.ToLower(digest)
+	if !digestRegex.MatchString(digest) {
+		return util.Errorf("Invalid artifact digest %q", digest)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	dst := c.artifactPath(digest)
+	if _, err := os.Stat(dst); os.IsNotExist(err) {
+		err = c.copyIn(artifactFile.Name(), dst)
+		if err != nil {
+			return err
+		}
+	}
+	err := c.store.Advertise(digest, c.node, c.config.AdvertiseURL+artifactsPath+digest)
+	if err != nil {
+		return err
+	}
+	return c.evict(digest)
+}
+
+func (c *Cache) copyIn(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp, err := ioutil.TempFile(c.config.Dir, ".tmp")
+	if err != nil {
+		return util.Errorf("Could not add artifact to the cache: %s", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, in)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return util.Errorf("Could not add artifact to the cache: %s", err)
+	}
+	err = os.Chmod(tmp.Name(), 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+type cachedFiles []os.FileInfo
+
+func (f cachedFiles) Len() int           { return len(f) }
+func (f cachedFiles) Swap(i, j int)      { f[i], f[j] = f[j], f[i] }
+func (f cachedFiles) Less(i, j int) bool { return f[i].ModTime().Before(f[j].ModTime()) }
+
+// evict removes the oldest artifacts other than keep until the cache is no
+// larger than MaxBytes.
+func (c *Cache) evict(keep string) error {
+	if c.config.MaxBytes <= 0 {
+		return nil
+	}
+	infos, err := ioutil.ReadDir(c.config.Dir)
+	if err != nil {
+		return err
+	}
+	var files cachedFiles
+	var total int64
+	for _, info := range infos {
+		if !digestRegex.MatchString(info.Name()) {
+			continue
+		}
+		files = append(files, info)
+		total += info.Size()
+	}
+	sort.Sort(files)
+	for _, info := range files {
+		if total <= c.config.MaxBytes {
+			break
+		}
+		if info.Name() == keep {
+			continue
+		}
+		err = c.store.Withdraw(info.Name(), c.node)
+		if err != nil {
+			return err
+		}
+		err = os.Remove(c.artifactPath(info.Name()))
+		if err != nil {
+			return err
+		}
+		total -= info.Size()
+	}
+	return nil
+}
+
+// Handler serves cached artifacts to peers at /artifacts/<digest>.
+func (c *Cache) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(artifactsPath, func(w http.ResponseWriter, r *http.Request) {
+		digest := strings.TrimPrefix(r.URL.Path, artifactsPath)
+		if !digestRegex.MatchString(digest) {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeFile(w, r, c.artifactPath(digest))
+	})
+	return mux
+}
+
+// ListenAndServe serves cached artifacts on the configured listen address.
+func (c *Cache) ListenAndServe() error {
+	return http.ListenAndServe(c.config.ListenAddress, c.Handler())
+}
@@ -0,0 +1,164 @@
+package artifactcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/store/consul/artifactcachestore"
+	"github.com/square/p2/pkg/types"
+)
+
+type fakeStore struct {
+	peers map[string]map[types.NodeName]string
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{peers: make(map[string]map[types.NodeName]string)}
+}
+
+func (s *fakeStore) Advertise(digest string, node types.NodeName, url string) error {
+	if s.peers[digest] == nil {
+		s.peers[digest] = make(map[types.NodeName]string)
+	}
+	s.peers[digest][node] = url
+	return nil
+}
+
+func (s *fakeStore) Withdraw(digest string, node types.NodeName) error {
+	delete(s.peers[digest], node)
+	return nil
+}
+
+func (s *fakeStore) Peers(digest string) ([]artifactcachestore.Peer, error) {
+	var peers []artifactcachestore.Peer
+	for node, url := range s.peers[digest] {
+		peers = append(peers, artifactcachestore.Peer{Node: node, URL: url})
+	}
+	return peers, nil
+}
+
+func newTestCache(t *testing.T, node types.NodeName, store peerStore, maxBytes int64) (*Cache, func()) {
+	dir, err := ioutil.TempDir("", "artifactcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache, err := New(Config{
+		Dir:           dir,
+		ListenAddress: ":0",
+		MaxBytes:      maxBytes,
+	}, node, store, http.DefaultClient, logging.TestLogger())
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return cache, func() { os.RemoveAll(dir) }
+}
+
+// addArtifact adds an artifact with the given contents to cache, returning its
+// digest.
+func addArtifact(t *testing.T, cache *Cache, contents string) string {
+	sum := sha256.Sum256([]byte(contents))
+	digest := hex.EncodeToString(sum[:])
+	artifactFile, err := ioutil.TempFile("", "artifact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(artifactFile.Name())
+	defer artifactFile.Close()
+	_, err = artifactFile.WriteString(contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cache.Add(digest, artifactFile)
+	if err != nil {
+		t.Fatalf("could not add artifact: %s", err)
+	}
+	return digest
+}
+
+func TestOpenFetchesFromPeer(t *testing.T) {
+	store := newFakeStore()
+	peer, cleanup := newTestCache(t, "peer", store, 0)
+	defer cleanup()
+	server := httptest.NewServer(peer.Handler())
+	defer server.Close()
+	peer.config.AdvertiseURL = server.URL
+
+	digest := addArtifact(t, peer, "artifact contents")
+	if store.peers[digest]["peer"] != server.URL+"/artifacts/"+digest {
+		t.Fatalf("expected the artifact to be advertised, got %v", store.peers[digest])
+	}
+
+	node, cleanup := newTestCache(t, "node", store, 0)
+	defer cleanup()
+	body, err := node.Open(digest)
+	if err != nil {
+		t.Fatalf("expected the artifact to be fetched from the peer, got %s", err)
+	}
+	defer body.Close()
+	contents, err := ioutil.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != "artifact contents" {
+		t.Errorf("unexpected artifact contents %q", contents)
+	}
+
+	// Peers that no longer have the artifact are withdrawn
+	err = os.Remove(peer.artifactPath(digest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = node.Open(digest)
+	if err == nil {
+		t.Fatal("expected an error when no peer has the artifact")
+	}
+	if len(store.peers[digest]) != 0 {
+		t.Errorf("expected the stale advertisement to be withdrawn, got %v", store.peers[digest])
+	}
+}
+
+func TestOpenSkipsSelf(t *testing.T) {
+	store := newFakeStore()
+	node, cleanup := newTestCache(t, "node", store, 0)
+	defer cleanup()
+	digest := addArtifact(t, node, "artifact contents")
+
+	_, err := node.Open(digest)
+	if err == nil {
+		t.Fatal("expected a node not to fetch artifacts from itself")
+	}
+}
+
+func TestAddEvictsOldest(t *testing.T) {
+	store := newFakeStore()
+	cache, cleanup := newTestCache(t, "node", store, 10)
+	defer cleanup()
+
+	first := addArtifact(t, cache, "123456")
+	// Modification times may be too coarse to tell the artifacts apart
+	longAgo := time.Now().Add(-time.Hour)
+	err := os.Chtimes(cache.artifactPath(first), longAgo, longAgo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := addArtifact(t, cache, "abcdef")
+
+	if _, err := os.Stat(filepath.Join(cache.config.Dir, first)); !os.IsNotExist(err) {
+		t.Error("expected the oldest artifact to be evicted")
+	}
+	if len(store.peers[first]) != 0 {
+		t.Error("expected the evicted artifact to be withdrawn")
+	}
+	if _, err := os.Stat(filepath.Join(cache.config.Dir, second)); err != nil {
+		t.Errorf("expected the newest artifact to be kept: %s", err)
+	}
+}
@@ -0,0 +1,59 @@
+package audit
+
+import (
+	"encoding/json"
+
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+const (
+	// PodScheduledEvent signifies that a pod manifest was written to a
+	// node's intent tree, either scheduling the pod on the node or
+	// updating it
+	PodScheduledEvent EventType = "POD_SCHEDULED"
+
+	// PodUnscheduledEvent signifies that a pod was deleted from a node's
+	// intent tree, which will remove it from the node
+	PodUnscheduledEvent EventType = "POD_UNSCHEDULED"
+)
+
+// PodEventDetails defines a JSON structure for the details related to a
+// change to the intent tree
+type PodEventDetails struct {
+	PodID types.PodID    `json:"pod_id"`
+	Node  types.NodeName `json:"node"`
+
+	// ManifestSHA is the SHA of the manifest that was written. It is
+	// empty for PodUnscheduledEvent
+	ManifestSHA string `json:"manifest_sha,omitempty"`
+
+	// User represents the name of the user who executed the action to
+	// which the event record pertains, and Hostname the machine they
+	// executed it from
+	User     string `json:"user"`
+	Hostname string `json:"hostname"`
+}
+
+func NewPodEventDetails(
+	podID types.PodID,
+	node types.NodeName,
+	manifestSHA string,
+	user string,
+	hostname string,
+) (json.RawMessage, error) {
+	details := PodEventDetails{
+		PodID:       podID,
+		Node:        node,
+		ManifestSHA: manifestSHA,
+		User:        user,
+		Hostname:    hostname,
+	}
+
+	bytes, err := json.Marshal(details)
+	if err != nil {
+		return nil, util.Errorf("could not marshal pod event details as json: %s", err)
+	}
+
+	return json.RawMessage(bytes), nil
+}
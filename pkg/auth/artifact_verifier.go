@@ -2,19 +2,26 @@ package auth
 
 import (
 	"bytes"
-	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
 	"io/ioutil"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
 
 	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/uri"
 	"github.com/square/p2/pkg/util"
 
 	"golang.org/x/crypto/openpgp"
 	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
 	"gopkg.in/yaml.v2"
 )
 
@@ -22,16 +29,35 @@ const VerifyNone = "none"
 const VerifyManifest = "manifest"
 const VerifyBuild = "build"
 const VerifyEither = "either"
+const VerifyEmbedded = "embedded"
+const VerifyChecksum = "checksum"
+const VerifySigstore = "sigstore"
 
 // Contains URLs to extra files needed to verify the artifact. Not all verification
 // strategies make use of each field.
 type VerificationData struct {
+	// The pod whose launchable the artifact belongs to, used to apply a
+	// SignerPolicy
+	PodID types.PodID
+
+	// The artifact's own URL. Only set when the other locations are
+	// inferred from it by suffix, see BuildManifestVerifier.ManifestURLTemplate
+	ArtifactLocation *url.URL
+
 	// Used by BuildManifestVerifier
 	ManifestLocation          *url.URL
 	ManifestSignatureLocation *url.URL
 
-	// Used by BuildVerifier
+	// Used by BuildVerifier and CosignVerifier
 	BuildSignatureLocation *url.URL
+
+	// Used by ChecksumVerifier
+	ChecksumLocation *url.URL
+
+	// Used by ManifestEmbeddedVerifier. These are copied from the
+	// launchable stanza's artifact_digest and artifact_signature fields
+	ArtifactDigest    string
+	ArtifactSignature string
 }
 
 // The artifact verifier is responsible for checking that the artifact
@@ -40,23 +66,78 @@ type ArtifactVerifier interface {
 	VerifyHoistArtifact(localCopy *os.File, verificationData VerificationData) error
 }
 
-type nopVerifier struct{}
+// nopVerifier accepts every artifact. Outside of tests it warns each time it
+// does, since skipping verification in production is dangerous.
+type nopVerifier struct {
+	logger logging.Logger
+	// The name of the running binary, i.e. os.Args[0]
+	program string
+}
 
-func (n *nopVerifier) VerifyHoistArtifact(_ *os.File, _ VerificationData) error {
+func (n *nopVerifier) VerifyHoistArtifact(localCopy *os.File, _ VerificationData) error {
+	if !runningInTest(n.program) {
+		n.logger.WithField("artifact", localCopy.Name()).
+			Warnln("artifact verification is disabled; configure a proper verifier for production")
+	}
 	return nil
 }
 
 func NopVerifier() ArtifactVerifier {
-	return &nopVerifier{}
+	return &nopVerifier{
+		logger:  logging.DefaultLogger,
+		program: os.Args[0],
+	}
 }
 
-type CompositeVerifier struct {
-	manVerifier   *BuildManifestVerifier
-	buildVerifier *BuildVerifier
+// runningInTest returns true if program is a test binary built by go test, or
+// P2_TEST is set in the environment.
+func runningInTest(program string) bool {
+	return strings.HasSuffix(program, ".test") || os.Getenv("P2_TEST") != ""
+}
+
+// ChainVerifier tries each of its verifiers in order until one passes. The
+// artifact is rewound before each attempt.
+type ChainVerifier struct {
+	verifiers []ArtifactVerifier
+}
+
+func NewChainVerifier(verifiers ...ArtifactVerifier) *ChainVerifier {
+	return &ChainVerifier{
+		verifiers: verifiers,
+	}
+}
+
+// Add appends a verifier to be tried after the existing ones.
+func (c *ChainVerifier) Add(v ArtifactVerifier) {
+	c.verifiers = append(c.verifiers, v)
+}
+
+// Returns nil as soon as one verifier passes, otherwise the error from the
+// last verifier. A chain with no verifiers always fails.
+func (c *ChainVerifier) VerifyHoistArtifact(localCopy *os.File, verificationData VerificationData) error {
+	err := util.Errorf("No artifact verifiers configured")
+	for i, verifier := range c.verifiers {
+		if i > 0 {
+			_, seekErr := localCopy.Seek(0, os.SEEK_SET)
+			if seekErr != nil {
+				return util.Errorf("Could not rewind localCopy %v back to start of file: %v", localCopy.Name(), seekErr)
+			}
+		}
+		err = verifier.VerifyHoistArtifact(localCopy, verificationData)
+		if err == nil {
+			return nil
+		}
+	}
+	return err
 }
 
 // The composite verifier executes verification for both the BuildManifestVerifier and the BuildVerifier.
-// Only one of the two need to pas for verification to pass.
+// Only one of the two need to pas for verification to pass. Manifest
+// verification is attempted first, falling back to the build verifier.
+type CompositeVerifier struct {
+	*ChainVerifier
+}
+
 func NewCompositeVerifier(keyringPath string, fetcher uri.Fetcher, logger *logging.Logger) (*CompositeVerifier, error) {
 	manV, err := NewBuildManifestVerifier(keyringPath, fetcher, logger)
 	if err != nil {
@@ -67,22 +148,21 @@ func NewCompositeVerifier(keyringPath string, fetcher uri.Fetcher, logger *loggi
 		return nil, err
 	}
 	return &CompositeVerifier{
-		manVerifier:   manV,
-		buildVerifier: buildV,
+		ChainVerifier: NewChainVerifier(manV, buildV),
 	}, nil
 }
 
-// Attempt manifest verification. If it fails, fallback to the build verifier.
-func (b *CompositeVerifier) VerifyHoistArtifact(localCopy *os.File, verificationData VerificationData) error {
-	err := b.manVerifier.VerifyHoistArtifact(localCopy, verificationData)
-	if err != nil {
-		_, err = localCopy.Seek(0, os.SEEK_SET)
-		if err != nil {
-			return util.Errorf("Could not rewind localCopy %v back to start of file: %v", localCopy.Name(), err)
+// SetSignerPolicy sets the SignerPolicy of both the manifest and the build
+// verifier.
+func (c *CompositeVerifier) SetSignerPolicy(policy *SignerPolicy) {
+	for _, verifier := range c.verifiers {
+		switch verifier := verifier.(type) {
+		case *BuildManifestVerifier:
+			verifier.SignerPolicy = policy
+		case *BuildVerifier:
+			verifier.SignerPolicy = policy
 		}
-		err = b.buildVerifier.VerifyHoistArtifact(localCopy, verificationData)
 	}
-	return err
 }
 
 // BuildManifestVerifier ensures that the given LaunchableStanza's location
@@ -100,20 +180,43 @@ func (b *CompositeVerifier) VerifyHoistArtifact(localCopy *os.File, verification
 // Then its build manifest is located here:
 // https://foo.bar.baz/artifacts/myapp_abc123.tar.gz.manifest
 //
-// The contents of the manifest should be a YAML file with one key -
+// The contents of the manifest should be a YAML file with at least one digest
+// key registered in the DigestRegistry, e.g. the SHA-256 digest -
 //
 // 	artifact_sha: abc23456
 //
+// artifact_sha512 is also recognized, and others may be added with
+// RegisterDigestAlgorithm().
+//
 // And its signature file is located here:
 // https://foo.bar.baz/artifacts/myapp_abc123.tar.gz.manifest.sig
+//
+// Artifact servers that keep build manifests elsewhere can set
+// ManifestURLTemplate.
 type BuildManifestVerifier struct {
 	keyring openpgp.KeyRing
 	fetcher uri.Fetcher
 	logger  *logging.Logger
+
+	// If non-empty, a text/template executed with the artifact's URL as
+	// .ArtifactURL to produce the manifest's URL, e.g.
+	// "https://meta.example.com/manifest?artifact={{ .ArtifactURL | urlquery }}".
+	// The signature is expected at the manifest's path plus ".sig". The
+	// template is only used when the verification data was inferred from
+	// the artifact's URL; locations returned by an artifact registry are
+	// used as they are. See DefaultManifestURLTemplate
+	ManifestURLTemplate string
+
+	// If non-nil, restricts which keys may sign the manifests of each pod
+	SignerPolicy *SignerPolicy
 }
 
+// DefaultManifestURLTemplate is the BuildManifestVerifier.ManifestURLTemplate
+// equivalent to the usual ".manifest" suffix convention.
+const DefaultManifestURLTemplate = "{{ .ArtifactURL }}.manifest"
+
 func NewBuildManifestVerifier(keyringPath string, fetcher uri.Fetcher, logger *logging.Logger) (*BuildManifestVerifier, error) {
-	keyring, err := LoadKeyring(keyringPath)
+	keyring, err := newReloadingKeyring(keyringPath, logger)
 	if err != nil {
 		return nil, util.Errorf("Could not load artifact verification keyring from %v: %v", keyringPath, err)
 	}
@@ -127,6 +230,19 @@ func NewBuildManifestVerifier(keyringPath string, fetcher uri.Fetcher, logger *l
 // Returns an error if the stanza's artifact is not signed appropriately. Note that this
 // implementation does not use the pod manifest digest location options.
 func (b *BuildManifestVerifier) VerifyHoistArtifact(localCopy *os.File, verificationData VerificationData) error {
+	if b.ManifestURLTemplate != "" && verificationData.ArtifactLocation != nil {
+		manifestLocation, err := b.templatedManifestLocation(verificationData.ArtifactLocation)
+		if err != nil {
+			return err
+		}
+		manifestSignatureLocation := &url.URL{}
+		*manifestSignatureLocation = *manifestLocation
+		manifestSignatureLocation.Path = manifestLocation.Path + ".sig"
+
+		verificationData.ManifestLocation = manifestLocation
+		verificationData.ManifestSignatureLocation = manifestSignatureLocation
+	}
+
 	manifestLocation := verificationData.ManifestLocation
 	if manifestLocation == nil {
 		return util.Errorf("Manifest verification failed: manifest location not provided")
@@ -163,48 +279,108 @@ func (b *BuildManifestVerifier) VerifyHoistArtifact(localCopy *os.File, verifica
 		return err
 	}
 
-	if err = verifySigned(b.keyring, manifestBytes, signatureBytes); err != nil {
+	err = verifySigned(b.keyring, b.SignerPolicy, verificationData.PodID, bytes.NewReader(manifestBytes), signatureBytes)
+	if err != nil {
 		return err
 	}
 
 	return b.checkMatchingDigest(localCopy, manifestBytes)
 }
 
-func verifySigned(keyring openpgp.KeyRing, signedBytes, signatureBytes []byte) error {
-	// permit an armored detached signature
-	block, err := armor.Decode(bytes.NewBuffer(signatureBytes))
-	if err == nil {
-		signatureBytes, err = ioutil.ReadAll(block.Body)
-		if err != nil {
-			return util.Errorf("Discovered an armored signature but could not read the body: %v", err)
-		}
+// templatedManifestLocation executes ManifestURLTemplate for the artifact.
+func (b *BuildManifestVerifier) templatedManifestLocation(artifactLocation *url.URL) (*url.URL, error) {
+	tmpl, err := template.New("manifest_url").Parse(b.ManifestURLTemplate)
+	if err != nil {
+		return nil, util.Errorf("Invalid manifest URL template %q: %v", b.ManifestURLTemplate, err)
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, struct{ ArtifactURL string }{artifactLocation.String()})
+	if err != nil {
+		return nil, util.Errorf("Could not execute manifest URL template %q: %v", b.ManifestURLTemplate, err)
+	}
+	manifestLocation, err := url.Parse(buf.String())
+	if err != nil {
+		return nil, util.Errorf("Manifest URL template %q produced an invalid URL %q: %v", b.ManifestURLTemplate, buf.String(), err)
+	}
+	return manifestLocation, nil
+}
+
+// verifySigned checks that signatureBytes is a signature of the contents of
+// signed by a key in the keyring that policy authorizes for the pod podID.
+// signed is streamed, so it may be arbitrarily large.
+func verifySigned(keyring openpgp.KeyRing, policy *SignerPolicy, podID types.PodID, signed io.Reader, signatureBytes []byte) error {
+	signatureBytes, err := dearmorSignature(signatureBytes)
+	if err != nil {
+		return err
 	}
 	// check that the manifest was adequately signed by our signer
-	_, err = checkDetachedSignature(keyring, signedBytes, signatureBytes)
+	signer, err := checkDetachedSignature(keyring, signed, signatureBytes)
 	if err != nil {
 		return util.Errorf("Could not verify data against the signature: %v", err)
 	}
-	return nil
+	return policy.AuthorizeSigner(podID, signer)
 }
 
-func (b *BuildManifestVerifier) checkMatchingDigest(localCopy *os.File, manifestBytes []byte) error {
-	realTarBytes, err := ioutil.ReadAll(localCopy)
+// dearmorSignature returns the binary form of a detached signature, which
+// may be armored.
+func dearmorSignature(signatureBytes []byte) ([]byte, error) {
+	block, err := armor.Decode(bytes.NewBuffer(signatureBytes))
 	if err != nil {
-		return util.Errorf("Could not read given local copy of the artifact: %v", err)
+		// not armored
+		return signatureBytes, nil
+	}
+	signatureBytes, err = ioutil.ReadAll(block.Body)
+	if err != nil {
+		return nil, util.Errorf("Discovered an armored signature but could not read the body: %v", err)
 	}
-	digestBytes := sha256.Sum256(realTarBytes)
-	realDigest := hex.EncodeToString(digestBytes[:])
+	return signatureBytes, nil
+}
 
-	manifest := struct {
-		ArtifactDigest string `yaml:"artifact_sha"`
-	}{}
-	err = yaml.Unmarshal(manifestBytes, &manifest)
+// checkMatchingDigest checks every digest in the build manifest whose key is
+// registered in the DigestRegistry. At least one must be present. The
+// artifact is read once, through every digest, rather than into memory.
+// Other keys of the build manifest may hold any value.
+func (b *BuildManifestVerifier) checkMatchingDigest(localCopy *os.File, manifestBytes []byte) error {
+	manifest := make(map[string]interface{})
+	err := yaml.Unmarshal(manifestBytes, &manifest)
 	if err != nil {
 		return util.Errorf("Could not unmarshal manifest bytes: %v", err)
 	}
 
-	if realDigest != manifest.ArtifactDigest {
-		return util.Errorf("Artifact hex digest did not match the given manifest: expected %v, was actually %v", realDigest, manifest.ArtifactDigest)
+	keys, registry := registeredDigestKeys()
+	var checkedKeys, expectedDigests []string
+	var hashers []hash.Hash
+	var writers []io.Writer
+	for _, key := range keys {
+		value, ok := manifest[key]
+		if !ok {
+			continue
+		}
+		expectedDigest, ok := value.(string)
+		if !ok {
+			return util.Errorf("Manifest's %s must be a string, was %v", key, value)
+		}
+		hasher := registry[key]()
+		checkedKeys = append(checkedKeys, key)
+		expectedDigests = append(expectedDigests, expectedDigest)
+		hashers = append(hashers, hasher)
+		writers = append(writers, hasher)
+	}
+	if len(checkedKeys) == 0 {
+		return util.Errorf("Manifest did not contain any recognized artifact digest, expected one of %v", keys)
+	}
+
+	_, err = io.Copy(io.MultiWriter(writers...), localCopy)
+	if err != nil {
+		return util.Errorf("Could not read given local copy of the artifact: %v", err)
+	}
+
+	for i, key := range checkedKeys {
+		expectedDigest := expectedDigests[i]
+		realDigest := hex.EncodeToString(hashers[i].Sum(nil))
+		if realDigest != expectedDigest {
+			return util.Errorf("Artifact hex digest (%s) did not match the given manifest: expected %v, was actually %v", key, realDigest, expectedDigest)
+		}
 	}
 	return nil
 }
@@ -218,14 +394,42 @@ func (b *BuildManifestVerifier) checkMatchingDigest(localCopy *os.File, manifest
 //
 // Then its signature is located here:
 // https://foo.bar.baz/artifacts/myapp_abc123.tar.gz.sig
+//
+// If ClockSkewTolerance is positive, the signature must also have been created
+// within that long of the current time, otherwise
+// ErrSignatureTimestampOutOfRange is returned.
 type BuildVerifier struct {
 	keyring openpgp.KeyRing
 	fetcher uri.Fetcher
 	logger  *logging.Logger
+
+	ClockSkewTolerance time.Duration
+
+	// If non-nil, restricts which keys may sign the artifacts of each pod
+	SignerPolicy *SignerPolicy
+}
+
+// ErrSignatureTimestampOutOfRange is returned by BuildVerifier when a valid
+// signature was created further from the current time than the verifier's
+// ClockSkewTolerance allows.
+type ErrSignatureTimestampOutOfRange struct {
+	CreationTime time.Time
+	// The absolute difference between CreationTime and the current time
+	Skew      time.Duration
+	Tolerance time.Duration
+}
+
+func (e ErrSignatureTimestampOutOfRange) Error() string {
+	return fmt.Sprintf(
+		"signature created at %s is %s from the current time, outside the allowed window of %s",
+		e.CreationTime.Format(time.RFC3339),
+		e.Skew,
+		e.Tolerance,
+	)
 }
 
 func NewBuildVerifier(keyringPath string, fetcher uri.Fetcher, logger *logging.Logger) (*BuildVerifier, error) {
-	keyring, err := LoadKeyring(keyringPath)
+	keyring, err := newReloadingKeyring(keyringPath, logger)
 	if err != nil {
 		return nil, util.Errorf("Could not load artifact verification keyring from %v: %v", keyringPath, err)
 	}
@@ -261,10 +465,53 @@ func (b *BuildVerifier) VerifyHoistArtifact(localCopy *os.File, verificationData
 		return util.Errorf("Could not read downloaded signature at %v: %v", sigPath, err)
 	}
 
-	signedBytes, err := ioutil.ReadAll(localCopy)
+	err = verifySigned(b.keyring, b.SignerPolicy, verificationData.PodID, localCopy, sigData)
+	if err != nil {
+		return err
+	}
+
+	return b.checkSignatureTime(sigData, time.Now())
+}
+
+func (b *BuildVerifier) checkSignatureTime(signatureBytes []byte, now time.Time) error {
+	if b.ClockSkewTolerance <= 0 {
+		return nil
+	}
+
+	creationTime, err := signatureCreationTime(signatureBytes)
 	if err != nil {
-		return util.Errorf("Could not read the artifact into memory: %v", err)
+		return util.Errorf("Could not read signature creation time: %v", err)
 	}
 
-	return verifySigned(b.keyring, signedBytes, sigData)
+	skew := now.Sub(creationTime)
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > b.ClockSkewTolerance {
+		return ErrSignatureTimestampOutOfRange{
+			CreationTime: creationTime,
+			Skew:         skew,
+			Tolerance:    b.ClockSkewTolerance,
+		}
+	}
+	return nil
+}
+
+func signatureCreationTime(signatureBytes []byte) (time.Time, error) {
+	signatureBytes, err := dearmorSignature(signatureBytes)
+	if err != nil {
+		return time.Time{}, err
+	}
+	p, err := packet.Read(bytes.NewReader(signatureBytes))
+	if err != nil {
+		return time.Time{}, err
+	}
+	switch sig := p.(type) {
+	case *packet.Signature:
+		return sig.CreationTime, nil
+	case *packet.SignatureV3:
+		return sig.CreationTime, nil
+	default:
+		return time.Time{}, util.Errorf("non signature packet found")
+	}
 }
@@ -1,16 +1,26 @@
 package auth
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
 	"io/ioutil"
+	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/uri"
 	"github.com/square/p2/pkg/util"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
 )
 
 type testFile string
@@ -52,10 +62,16 @@ func VerificationDataForLocation(location *url.URL) VerificationData {
 	buildSignatureLocation := &url.URL{}
 	*buildSignatureLocation = *location
 	buildSignatureLocation.Path = location.Path + ".sig"
+
+	checksumLocation := &url.URL{}
+	*checksumLocation = *location
+	checksumLocation.Path = location.Path + ".sha256"
 	return VerificationData{
+		ArtifactLocation:          location,
 		ManifestLocation:          manifestLocation,
 		ManifestSignatureLocation: manifestSignatureLocation,
 		BuildSignatureLocation:    buildSignatureLocation,
+		ChecksumLocation:          checksumLocation,
 	}
 }
 
@@ -162,3 +178,361 @@ func TestCompositeVerifierFailsBuildWithoutSigs(t *testing.T) {
 	}
 	testNotVerifiedWithFiles(t, []testFile{testArtifact, testManifest}, verifier)
 }
+
+func TestBuildVerifierClockSkewTolerance(t *testing.T) {
+	now := time.Now()
+	signer := newTestEntity(t, "signer", now.Add(-48*time.Hour), 365*24*time.Hour)
+
+	tempDir, err := ioutil.TempDir("", "test-clock-skew")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	artifactPath := filepath.Join(tempDir, "artifact.tar.gz")
+	artifact := []byte("artifact contents")
+	err = ioutil.WriteFile(artifactPath, artifact, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sign the artifact as of 25 hours ago
+	var signature bytes.Buffer
+	err = openpgp.DetachSign(&signature, signer, bytes.NewReader(artifact), &packet.Config{
+		Time: func() time.Time { return now.Add(-25 * time.Hour) },
+	})
+	if err != nil {
+		t.Fatalf("Could not sign artifact: %s", err)
+	}
+	err = ioutil.WriteFile(artifactPath+".sig", signature.Bytes(), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verify := func(tolerance time.Duration) error {
+		verifier := &BuildVerifier{
+			keyring:            openpgp.EntityList{signer},
+			fetcher:            uri.DefaultFetcher,
+			logger:             &logging.DefaultLogger,
+			ClockSkewTolerance: tolerance,
+		}
+		localCopy, err := os.Open(artifactPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer localCopy.Close()
+		return verifier.VerifyHoistArtifact(localCopy, VerificationDataForLocation(&url.URL{
+			Scheme: "file",
+			Path:   artifactPath,
+		}))
+	}
+
+	err = verify(24 * time.Hour)
+	rangeErr, ok := err.(ErrSignatureTimestampOutOfRange)
+	if !ok {
+		t.Fatalf("Expected ErrSignatureTimestampOutOfRange with a 24h tolerance, got %v", err)
+	}
+	if rangeErr.Tolerance != 24*time.Hour {
+		t.Errorf("Expected the error to report a 24h tolerance, got %s", rangeErr.Tolerance)
+	}
+	if rangeErr.Skew < 25*time.Hour {
+		t.Errorf("Expected the error to report a skew of at least 25h, got %s", rangeErr.Skew)
+	}
+
+	err = verify(26 * time.Hour)
+	if err != nil {
+		t.Errorf("Expected verification to pass with a 26h tolerance, got %v", err)
+	}
+
+	// A zero tolerance disables the check
+	err = verify(0)
+	if err != nil {
+		t.Errorf("Expected verification to pass with no tolerance, got %v", err)
+	}
+}
+
+type countingVerifier struct {
+	err   error
+	calls int
+}
+
+func (c *countingVerifier) VerifyHoistArtifact(_ *os.File, _ VerificationData) error {
+	c.calls++
+	return c.err
+}
+
+func TestChainVerifier(t *testing.T) {
+	localCopy, err := ioutil.TempFile("", "chain-verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(localCopy.Name())
+	defer localCopy.Close()
+
+	failing := &countingVerifier{err: util.Errorf("first")}
+	passing := &countingVerifier{}
+	unreached := &countingVerifier{}
+	chain := NewChainVerifier(failing, passing)
+	chain.Add(unreached)
+
+	err = chain.VerifyHoistArtifact(localCopy, VerificationData{})
+	if err != nil {
+		t.Errorf("Expected the chain to pass when one verifier passes, got %v", err)
+	}
+	if failing.calls != 1 || passing.calls != 1 {
+		t.Errorf("Expected each verifier up to the passing one to be called once, got %d and %d", failing.calls, passing.calls)
+	}
+	if unreached.calls != 0 {
+		t.Error("Expected verifiers after the passing one not to be called")
+	}
+
+	last := &countingVerifier{err: util.Errorf("last")}
+	chain = NewChainVerifier(&countingVerifier{err: util.Errorf("first")}, last)
+	err = chain.VerifyHoistArtifact(localCopy, VerificationData{})
+	if err != last.err {
+		t.Errorf("Expected the last verifier's error when all fail, got %v", err)
+	}
+
+	err = NewChainVerifier().VerifyHoistArtifact(localCopy, VerificationData{})
+	if err == nil {
+		t.Error("Expected an empty chain to fail")
+	}
+}
+
+func nopVerifyWithLog(t *testing.T, program string) string {
+	artifact, err := ioutil.TempFile("", "nop-verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(artifact.Name())
+	defer artifact.Close()
+
+	var out bytes.Buffer
+	logger := logging.TestLogger()
+	logger.SetLogOut(&out)
+	verifier := &nopVerifier{logger: logger, program: program}
+	err = verifier.VerifyHoistArtifact(artifact, VerificationData{})
+	if err != nil {
+		t.Fatalf("Expected the nop verifier to accept every artifact, got %s", err)
+	}
+	return out.String()
+}
+
+func TestNopVerifierWarnsOutsideTests(t *testing.T) {
+	os.Unsetenv("P2_TEST")
+	logged := nopVerifyWithLog(t, "/usr/local/bin/p2-preparer")
+	if !strings.Contains(logged, "artifact verification is disabled") {
+		t.Errorf("Expected a warning outside of tests, got %q", logged)
+	}
+}
+
+func TestNopVerifierQuietInTests(t *testing.T) {
+	os.Unsetenv("P2_TEST")
+	if logged := nopVerifyWithLog(t, "/tmp/go-build/auth.test"); logged != "" {
+		t.Errorf("Expected no warning in a test binary, got %q", logged)
+	}
+
+	os.Setenv("P2_TEST", "1")
+	defer os.Unsetenv("P2_TEST")
+	if logged := nopVerifyWithLog(t, "/usr/local/bin/p2-preparer"); logged != "" {
+		t.Errorf("Expected no warning with P2_TEST set, got %q", logged)
+	}
+}
+
+// recordingFetcher records the URLs it copies, delegating to
+// uri.DefaultFetcher
+type recordingFetcher struct {
+	copied []string
+}
+
+func (f *recordingFetcher) Open(u *url.URL) (io.ReadCloser, error) {
+	return uri.DefaultFetcher.Open(u)
+}
+
+func (f *recordingFetcher) Head(u *url.URL) (*http.Response, error) {
+	return uri.DefaultFetcher.Head(u)
+}
+
+func (f *recordingFetcher) CopyLocal(srcUri *url.URL, dstPath string) error {
+	f.copied = append(f.copied, srcUri.String())
+	return uri.DefaultFetcher.CopyLocal(srcUri, dstPath)
+}
+
+func TestManifestVerifierURLTemplate(t *testing.T) {
+	testDir := buildTestFileTree(t, []testFile{testArtifact})
+	defer os.RemoveAll(testDir)
+
+	// The manifest and signature are kept apart from the artifact, as a
+	// metadata service would
+	metaDir := filepath.Join(testDir, "meta")
+	err := os.Mkdir(metaDir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	artifactDir := util.From(runtime.Caller(0)).ExpandPath(testdata)
+	for name, file := range map[string]testFile{"manifest": testManifest, "manifest.sig": testManifestSig} {
+		err = os.Link(filepath.Join(artifactDir, string(file)), filepath.Join(metaDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fetcher := &recordingFetcher{}
+	verifier, err := NewBuildManifestVerifier(testKeyringPath(), fetcher, &logging.DefaultLogger)
+	if err != nil {
+		t.Fatalf("Error getting public key: %v", err)
+	}
+	verifier.ManifestURLTemplate = "file://" + metaDir + "/manifest?artifact={{ .ArtifactURL | urlquery }}"
+
+	filePath := filepath.Join(testDir, string(testArtifact))
+	localCopy, err := os.Open(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer localCopy.Close()
+	location := &url.URL{Scheme: "file", Path: filePath}
+
+	err = verifier.VerifyHoistArtifact(localCopy, VerificationDataForLocation(location))
+	if err != nil {
+		t.Fatalf("Expected the manifest at the templated URL to verify the artifact, got: %v", err)
+	}
+
+	query := "?artifact=" + url.QueryEscape(location.String())
+	expected := []string{
+		"file://" + metaDir + "/manifest" + query,
+		"file://" + metaDir + "/manifest.sig" + query,
+	}
+	if len(fetcher.copied) != len(expected) {
+		t.Fatalf("Expected the verifier to fetch %v, fetched %v", expected, fetcher.copied)
+	}
+	for i := range expected {
+		if fetcher.copied[i] != expected[i] {
+			t.Errorf("Expected the verifier to fetch %s, fetched %s", expected[i], fetcher.copied[i])
+		}
+	}
+}
+
+// writeBenchmarkArtifact writes an artifact of the given size to dir,
+// returning its path.
+func writeBenchmarkArtifact(b *testing.B, dir string, size int64) string {
+	path := filepath.Join(dir, "artifact.tar.gz")
+	f, err := os.Create(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer f.Close()
+	_, err = io.CopyN(f, zeroReader{}, size)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return path
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+var benchmarkArtifactSizes = []struct {
+	name string
+	size int64
+}{
+	{"1MB", 1 << 20},
+	{"64MB", 64 << 20},
+}
+
+// The bytes allocated per op should not grow with the size of the artifact,
+// which is streamed through the digests
+func BenchmarkBuildManifestVerifierDigest(b *testing.B) {
+	for _, size := range benchmarkArtifactSizes {
+		b.Run(size.name, func(b *testing.B) {
+			tempDir, err := ioutil.TempDir("", "benchmark_digest")
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer os.RemoveAll(tempDir)
+			artifactPath := writeBenchmarkArtifact(b, tempDir, size.size)
+
+			f, err := os.Open(artifactPath)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer f.Close()
+			hasher := sha256.New()
+			_, err = io.Copy(hasher, f)
+			if err != nil {
+				b.Fatal(err)
+			}
+			manifestBytes := []byte("artifact_sha: " + hex.EncodeToString(hasher.Sum(nil)) + "\n")
+
+			verifier := &BuildManifestVerifier{}
+			b.SetBytes(size.size)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, err = f.Seek(0, os.SEEK_SET)
+				if err != nil {
+					b.Fatal(err)
+				}
+				err = verifier.checkMatchingDigest(f, manifestBytes)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// The bytes allocated per op should not grow with the size of the artifact,
+// which is streamed through the signature check
+func BenchmarkBuildVerifierSignature(b *testing.B) {
+	signer := newBenchmarkEntity(b)
+	for _, size := range benchmarkArtifactSizes {
+		b.Run(size.name, func(b *testing.B) {
+			tempDir, err := ioutil.TempDir("", "benchmark_signature")
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer os.RemoveAll(tempDir)
+			artifactPath := writeBenchmarkArtifact(b, tempDir, size.size)
+
+			f, err := os.Open(artifactPath)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer f.Close()
+			var signature bytes.Buffer
+			err = openpgp.DetachSign(&signature, signer, f, nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			keyring := openpgp.EntityList{signer}
+			b.SetBytes(size.size)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, err = f.Seek(0, os.SEEK_SET)
+				if err != nil {
+					b.Fatal(err)
+				}
+				err = verifySigned(keyring, nil, "", f, signature.Bytes())
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func newBenchmarkEntity(b *testing.B) *openpgp.Entity {
+	entity, err := openpgp.NewEntity("benchmark", "", "benchmark@example.com", nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return entity
+}
@@ -3,8 +3,11 @@ package auth
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"golang.org/x/crypto/openpgp"
 	"golang.org/x/crypto/openpgp/errors"
@@ -133,7 +136,7 @@ func (p FixedKeyringPolicy) AuthorizeApp(manifest Manifest, logger logging.Logge
 	if signature == nil {
 		return Error{util.Errorf("received unsigned manifest (expected signature)"), nil}
 	}
-	signer, err := checkDetachedSignature(p.Keyring, plaintext, signature)
+	signer, err := checkDetachedSignature(p.Keyring, bytes.NewReader(plaintext), signature)
 	if err != nil {
 		return err
 	}
@@ -171,7 +174,7 @@ func (p FixedKeyringPolicy) CheckDigest(digest Digest) error {
 	if signature == nil {
 		return nil
 	}
-	_, err := checkDetachedSignature(p.Keyring, plaintext, signature)
+	_, err := checkDetachedSignature(p.Keyring, bytes.NewReader(plaintext), signature)
 	return err
 }
 
@@ -203,12 +206,12 @@ func signerKeyID(signature []byte) (uint64, error) {
 // the error messages.
 func checkDetachedSignature(
 	keyring openpgp.KeyRing,
-	signed []byte,
+	signed io.Reader,
 	signature []byte,
 ) (*openpgp.Entity, error) {
 	signer, err := openpgp.CheckDetachedSignature(
 		keyring,
-		bytes.NewReader(signed),
+		signed,
 		bytes.NewReader(signature),
 	)
 	if err == errors.ErrUnknownIssuer {
@@ -224,10 +227,53 @@ func checkDetachedSignature(
 	return signer, nil
 }
 
+// LoadKeyring reads an ASCII-armored or binary keyring. If path is a
+// directory, every keyring file in it is read and the keys merged, in file
+// name order. Hidden files are skipped.
 func LoadKeyring(path string) (openpgp.EntityList, error) {
 	if path == "" {
 		return nil, util.Errorf("no keyring configured")
 	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return loadKeyringFile(path)
+	}
+
+	files, err := keyringFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	var keyring openpgp.EntityList
+	for _, file := range files {
+		fileKeyring, err := loadKeyringFile(file)
+		if err != nil {
+			return nil, util.Errorf("could not load keyring %s: %s", file, err)
+		}
+		keyring = append(keyring, fileKeyring...)
+	}
+	return keyring, nil
+}
+
+// keyringFiles returns the keyring files in a keyring directory, sorted.
+func keyringFiles(dir string) ([]string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, info := range infos {
+		if strings.HasPrefix(info.Name(), ".") || !info.Mode().IsRegular() {
+			continue
+		}
+		files = append(files, filepath.Join(dir, info.Name()))
+	}
+	return files, nil
+}
+
+func loadKeyringFile(path string) (openpgp.EntityList, error) {
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, err
@@ -473,7 +519,7 @@ func (p UserPolicy) AuthorizePod(podUser string, manifest Signed, logger logging
 	keyring := (<-keyringChan).(openpgp.EntityList)
 	dpol := (<-dpolChan).(DeployPol)
 
-	signer, err := checkDetachedSignature(keyring, plaintext, signature)
+	signer, err := checkDetachedSignature(keyring, bytes.NewReader(plaintext), signature)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/uri"
+	"github.com/square/p2/pkg/util"
+)
+
+// ChecksumVerifier checks the artifact against a SHA-256 digest published
+// alongside it, without any signature. It protects against corrupted
+// downloads but not against a compromised artifact server, so it is meant for
+// environments that can't manage PGP keyrings.
+//
+// If the artifact is located here:
+// https://foo.bar.baz/artifacts/myapp_abc123.tar.gz
+//
+// Then its digest is located here:
+// https://foo.bar.baz/artifacts/myapp_abc123.tar.gz.sha256
+//
+// The digest file holds the hex digest, optionally followed by whitespace and
+// the file name as written by sha256sum.
+type ChecksumVerifier struct {
+	fetcher uri.Fetcher
+	logger  *logging.Logger
+}
+
+func NewChecksumVerifier(fetcher uri.Fetcher, logger *logging.Logger) *ChecksumVerifier {
+	return &ChecksumVerifier{
+		fetcher: fetcher,
+		logger:  logger,
+	}
+}
+
+func (c *ChecksumVerifier) VerifyHoistArtifact(localCopy *os.File, verificationData VerificationData) error {
+	checksumLocation := verificationData.ChecksumLocation
+	if checksumLocation == nil {
+		return util.Errorf("Checksum verification failed: checksum location not provided")
+	}
+
+	dir, err := ioutil.TempDir("", "artifact_verification")
+	if err != nil {
+		return util.Errorf("Could not create temporary directory for checksum file: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	checksumPath := filepath.Join(dir, "sha256")
+	err = c.fetcher.CopyLocal(checksumLocation, checksumPath)
+	if err != nil {
+		return util.Errorf("Could not fetch artifact checksum from %v: %v", checksumLocation.String(), err)
+	}
+	checksumBytes, err := ioutil.ReadFile(checksumPath)
+	if err != nil {
+		return util.Errorf("Could not read downloaded checksum at %v: %v", checksumPath, err)
+	}
+	fields := strings.Fields(string(checksumBytes))
+	if len(fields) == 0 {
+		return util.Errorf("Checksum file at %v is empty", checksumLocation.String())
+	}
+	expectedDigest := strings.ToLower(fields[0])
+
+	hasher := sha256.New()
+	_, err = io.Copy(hasher, localCopy)
+	if err != nil {
+		return util.Errorf("Could not read given local copy of the artifact: %v", err)
+	}
+	realDigest := hex.EncodeToString(hasher.Sum(nil))
+	if realDigest != expectedDigest {
+		return util.Errorf("Artifact SHA-256 digest did not match the checksum file: expected %v, was actually %v", expectedDigest, realDigest)
+	}
+	return nil
+}
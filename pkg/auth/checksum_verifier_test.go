@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/uri"
+)
+
+func writeChecksum(t *testing.T, dir string, contents string) {
+	err := ioutil.WriteFile(filepath.Join(dir, string(testArtifact)+".sha256"), []byte(contents), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChecksumVerifier(t *testing.T) {
+	verifier := NewChecksumVerifier(uri.DefaultFetcher, &logging.DefaultLogger)
+	testDir := buildTestFileTree(t, []testFile{testArtifact})
+	defer os.RemoveAll(testDir)
+	artifactBytes, err := ioutil.ReadFile(filepath.Join(testDir, string(testArtifact)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(artifactBytes)
+	hexDigest := hex.EncodeToString(digest[:])
+
+	for _, test := range []struct {
+		checksum string
+		valid    bool
+	}{
+		{hexDigest + "\n", true},
+		{hexDigest + "  " + string(testArtifact) + "\n", true},
+		{"0000" + hexDigest[4:], false},
+		{"", false},
+	} {
+		writeChecksum(t, testDir, test.checksum)
+		localCopy, err := os.Open(filepath.Join(testDir, string(testArtifact)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		verificationData := VerificationDataForLocation(&url.URL{Scheme: "file", Path: localCopy.Name()})
+		err = verifier.VerifyHoistArtifact(localCopy, verificationData)
+		localCopy.Close()
+		if test.valid && err != nil {
+			t.Errorf("Expected checksum %q to pass verification, got: %v", test.checksum, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("Expected checksum %q to fail verification", test.checksum)
+		}
+	}
+}
+
+func TestChecksumVerifierFailsWithoutChecksum(t *testing.T) {
+	testNotVerifiedWithFiles(t, []testFile{testArtifact}, NewChecksumVerifier(uri.DefaultFetcher, &logging.DefaultLogger))
+}
@@ -0,0 +1,323 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/uri"
+	"github.com/square/p2/pkg/util"
+)
+
+// CosignVerifier checks artifacts against signatures made with a cosign key
+// pair, i.e. by "cosign sign-blob --key cosign.key", instead of a PGP
+// keyring. The signature is the base64 encoded signature of the artifact's
+// SHA-256 digest and is located at the same place as a BuildVerifier's:
+//
+// If the artifact is located here:
+// https://foo.bar.baz/artifacts/myapp_abc123.tar.gz
+//
+// Then its signature is located here:
+// https://foo.bar.baz/artifacts/myapp_abc123.tar.gz.sig
+//
+// ECDSA and RSA public keys are supported. Keyless signatures, whose keys are
+// certified by Fulcio, are not.
+//
+// If Rekor is set, the signature must also have been uploaded to that
+// transparency log (i.e. signed with --tlog-upload). Inclusion is established
+// by the log's signed entry timestamp, as cosign does when verifying offline.
+type CosignVerifier struct {
+	keys    []crypto.PublicKey
+	fetcher uri.Fetcher
+	logger  *logging.Logger
+
+	Rekor *RekorLog
+}
+
+// RekorLog is a Rekor transparency log that a CosignVerifier checks
+// signatures were uploaded to.
+type RekorLog struct {
+	// e.g. https://rekor.sigstore.dev
+	URL *url.URL
+	// The log's public key, which signs the timestamp of every entry
+	PublicKey crypto.PublicKey
+	// Used to query the log. Defaults to http.DefaultClient
+	Client *http.Client
+}
+
+// NewCosignVerifier verifies signatures by any of the PEM encoded public keys
+// in the file at publicKeyPath, e.g. a cosign.pub.
+func NewCosignVerifier(publicKeyPath string, fetcher uri.Fetcher, logger *logging.Logger) (*CosignVerifier, error) {
+	keys, err := LoadPublicKeys(publicKeyPath)
+	if err != nil {
+		return nil, util.Errorf("Could not load cosign public keys from %v: %v", publicKeyPath, err)
+	}
+	return &CosignVerifier{
+		keys:    keys,
+		fetcher: fetcher,
+		logger:  logger,
+	}, nil
+}
+
+// LoadPublicKeys reads every PEM encoded PKIX public key in a file. At least
+// one is required.
+func LoadPublicKeys(path string) ([]crypto.PublicKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys []crypto.PublicKey
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "PUBLIC KEY" {
+			continue
+		}
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, util.Errorf("could not parse public key: %v", err)
+		}
+		switch key.(type) {
+		case *ecdsa.PublicKey, *rsa.PublicKey:
+		default:
+			return nil, util.Errorf("unsupported public key type %T", key)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, util.Errorf("no PEM encoded public keys found in %v", path)
+	}
+	return keys, nil
+}
+
+func (c *CosignVerifier) VerifyHoistArtifact(localCopy *os.File, verificationData VerificationData) error {
+	signatureLocation := verificationData.BuildSignatureLocation
+	if signatureLocation == nil {
+		return util.Errorf("Cosign verification failed: signature location not provided")
+	}
+
+	dir, err := ioutil.TempDir("", "artifact_verification")
+	if err != nil {
+		return util.Errorf("Could not create temporary directory for signature file: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	sigPath := filepath.Join(dir, "sig")
+	err = c.fetcher.CopyLocal(signatureLocation, sigPath)
+	if err != nil {
+		return util.Errorf("Could not fetch artifact signature from %v: %v", signatureLocation.String(), err)
+	}
+	encodedSignature, err := ioutil.ReadFile(sigPath)
+	if err != nil {
+		return util.Errorf("Could not read downloaded signature at %v: %v", sigPath, err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encodedSignature)))
+	if err != nil {
+		return util.Errorf("Could not decode cosign signature from %v: %v", signatureLocation.String(), err)
+	}
+
+	hasher := sha256.New()
+	_, err = io.Copy(hasher, localCopy)
+	if err != nil {
+		return util.Errorf("Could not read given local copy of the artifact: %v", err)
+	}
+	digest := hasher.Sum(nil)
+
+	verified := false
+	for _, key := range c.keys {
+		if verifyDigestSignature(key, digest, signature) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return util.Errorf("Artifact signature from %v was not made by a trusted cosign key", signatureLocation.String())
+	}
+
+	if c.Rekor != nil {
+		return c.Rekor.checkLogged(digest, signature)
+	}
+	return nil
+}
+
+// verifyDigestSignature returns true if signature is key's signature of a
+// SHA-256 digest. ECDSA signatures are ASN.1 encoded and RSA signatures are
+// PKCS #1 v1.5, as cosign makes them.
+func verifyDigestSignature(key crypto.PublicKey, digest []byte, signature []byte) bool {
+	switch key := key.(type) {
+	case *ecdsa.PublicKey:
+		var ecdsaSignature struct {
+			R, S *big.Int
+		}
+		rest, err := asn1.Unmarshal(signature, &ecdsaSignature)
+		if err != nil || len(rest) != 0 {
+			return false
+		}
+		return ecdsa.Verify(key, digest, ecdsaSignature.R, ecdsaSignature.S)
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest, signature) == nil
+	default:
+		return false
+	}
+}
+
+// rekorEntry is a Rekor log entry, as returned by /api/v1/log/entries/{uuid}
+type rekorEntry struct {
+	Body           string `json:"body"`
+	IntegratedTime int64  `json:"integratedTime"`
+	LogID          string `json:"logID"`
+	LogIndex       int64  `json:"logIndex"`
+	Verification   struct {
+		SignedEntryTimestamp string `json:"signedEntryTimestamp"`
+	} `json:"verification"`
+}
+
+// rekorHashedRekord is the body of a hashedrekord entry, which records a
+// signature of an artifact's digest
+type rekorHashedRekord struct {
+	Kind string `json:"kind"`
+	Spec struct {
+		Data struct {
+			Hash struct {
+				Algorithm string `json:"algorithm"`
+				Value     string `json:"value"`
+			} `json:"hash"`
+		} `json:"data"`
+		Signature struct {
+			Content string `json:"content"`
+		} `json:"signature"`
+	} `json:"spec"`
+}
+
+// checkLogged returns an error unless the log has an entry for signature of
+// the artifact with the given digest, with a valid signed entry timestamp.
+func (r *RekorLog) checkLogged(digest []byte, signature []byte) error {
+	hexDigest := hex.EncodeToString(digest)
+	uuids, err := r.searchByDigest(hexDigest)
+	if err != nil {
+		return err
+	}
+	for _, uuid := range uuids {
+		entry, err := r.entry(uuid)
+		if err != nil {
+			return err
+		}
+		if r.entryRecords(entry, hexDigest, signature) {
+			return nil
+		}
+	}
+	return util.Errorf("Artifact signature was not found in the Rekor transparency log at %v", r.URL)
+}
+
+// entryRecords returns true if entry is a hashedrekord of signature of the
+// artifact digest signed by the log.
+func (r *RekorLog) entryRecords(entry rekorEntry, hexDigest string, signature []byte) bool {
+	bodyBytes, err := base64.StdEncoding.DecodeString(entry.Body)
+	if err != nil {
+		return false
+	}
+	var body rekorHashedRekord
+	err = json.Unmarshal(bodyBytes, &body)
+	if err != nil || body.Kind != "hashedrekord" {
+		return false
+	}
+	if body.Spec.Data.Hash.Algorithm != "sha256" || body.Spec.Data.Hash.Value != hexDigest {
+		return false
+	}
+	loggedSignature, err := base64.StdEncoding.DecodeString(body.Spec.Signature.Content)
+	if err != nil || !bytes.Equal(loggedSignature, signature) {
+		return false
+	}
+
+	set, err := base64.StdEncoding.DecodeString(entry.Verification.SignedEntryTimestamp)
+	if err != nil {
+		return false
+	}
+	// The log signs the canonical JSON of these fields, whose keys are
+	// sorted
+	payload, err := json.Marshal(struct {
+		Body           string `json:"body"`
+		IntegratedTime int64  `json:"integratedTime"`
+		LogID          string `json:"logID"`
+		LogIndex       int64  `json:"logIndex"`
+	}{entry.Body, entry.IntegratedTime, entry.LogID, entry.LogIndex})
+	if err != nil {
+		return false
+	}
+	payloadDigest := sha256.Sum256(payload)
+	return verifyDigestSignature(r.PublicKey, payloadDigest[:], set)
+}
+
+func (r *RekorLog) client() *http.Client {
+	if r.Client == nil {
+		return http.DefaultClient
+	}
+	return r.Client
+}
+
+func (r *RekorLog) endpoint(path string) string {
+	return strings.TrimSuffix(r.URL.String(), "/") + path
+}
+
+// searchByDigest returns the UUIDs of the entries for an artifact digest.
+func (r *RekorLog) searchByDigest(hexDigest string) ([]string, error) {
+	query, err := json.Marshal(map[string]string{"hash": "sha256:" + hexDigest})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.client().Post(r.endpoint("/api/v1/index/retrieve"), "application/json", bytes.NewReader(query))
+	if err != nil {
+		return nil, util.Errorf("Could not search the Rekor transparency log: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, util.Errorf("Could not search the Rekor transparency log: %s", resp.Status)
+	}
+	var uuids []string
+	err = json.NewDecoder(resp.Body).Decode(&uuids)
+	if err != nil {
+		return nil, util.Errorf("Could not decode Rekor search results: %v", err)
+	}
+	return uuids, nil
+}
+
+func (r *RekorLog) entry(uuid string) (rekorEntry, error) {
+	resp, err := r.client().Get(r.endpoint("/api/v1/log/entries/" + url.QueryEscape(uuid)))
+	if err != nil {
+		return rekorEntry{}, util.Errorf("Could not fetch Rekor entry %s: %v", uuid, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return rekorEntry{}, util.Errorf("Could not fetch Rekor entry %s: %s", uuid, resp.Status)
+	}
+	// The entry is keyed by its UUID
+	var entries map[string]rekorEntry
+	err = json.NewDecoder(resp.Body).Decode(&entries)
+	if err != nil {
+		return rekorEntry{}, util.Errorf("Could not decode Rekor entry %s: %v", uuid, err)
+	}
+	for _, entry := range entries {
+		return entry, nil
+	}
+	return rekorEntry{}, util.Errorf("Rekor returned no entry for %s", uuid)
+}
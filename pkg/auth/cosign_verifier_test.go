@@ -0,0 +1,221 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/uri"
+)
+
+func newCosignKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func signDigest(t *testing.T, key *ecdsa.PrivateKey, digest []byte) []byte {
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signature
+}
+
+func writePublicKey(t *testing.T, path string, key *ecdsa.PrivateKey) {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// cosignFixture is an artifact and its cosign signature written to disk
+type cosignFixture struct {
+	dir          string
+	artifactPath string
+	digest       []byte
+}
+
+func newCosignFixture(t *testing.T, signer *ecdsa.PrivateKey) (cosignFixture, []byte) {
+	dir, err := ioutil.TempDir("", "cosign_verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixture := cosignFixture{
+		dir:          dir,
+		artifactPath: filepath.Join(dir, "app_abc123.tar.gz"),
+	}
+	artifact := []byte("artifact contents")
+	err = ioutil.WriteFile(fixture.artifactPath, artifact, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(artifact)
+	fixture.digest = sum[:]
+
+	signature := signDigest(t, signer, fixture.digest)
+	err = ioutil.WriteFile(fixture.artifactPath+".sig", []byte(base64.StdEncoding.EncodeToString(signature)+"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fixture, signature
+}
+
+func (f cosignFixture) verify(t *testing.T, verifier ArtifactVerifier) error {
+	localCopy, err := os.Open(f.artifactPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer localCopy.Close()
+	return verifier.VerifyHoistArtifact(localCopy, VerificationData{
+		BuildSignatureLocation: &url.URL{Scheme: "file", Path: f.artifactPath + ".sig"},
+	})
+}
+
+func TestCosignVerifier(t *testing.T) {
+	trusted := newCosignKey(t)
+	untrusted := newCosignKey(t)
+
+	fixture, _ := newCosignFixture(t, trusted)
+	defer os.RemoveAll(fixture.dir)
+	keyPath := filepath.Join(fixture.dir, "cosign.pub")
+	writePublicKey(t, keyPath, trusted)
+
+	verifier, err := NewCosignVerifier(keyPath, uri.DefaultFetcher, &logging.DefaultLogger)
+	if err != nil {
+		t.Fatalf("Could not create cosign verifier: %s", err)
+	}
+	if err = fixture.verify(t, verifier); err != nil {
+		t.Errorf("Expected an artifact signed by the trusted key to pass verification, got: %s", err)
+	}
+
+	untrustedFixture, _ := newCosignFixture(t, untrusted)
+	defer os.RemoveAll(untrustedFixture.dir)
+	if err = untrustedFixture.verify(t, verifier); err == nil {
+		t.Error("Expected an artifact signed by an untrusted key to fail verification")
+	}
+
+	err = ioutil.WriteFile(fixture.artifactPath, []byte("tampered contents"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = fixture.verify(t, verifier); err == nil {
+		t.Error("Expected a tampered artifact to fail verification")
+	}
+}
+
+// fakeRekor serves a single hashedrekord entry signed with key
+func fakeRekor(t *testing.T, key *ecdsa.PrivateKey, digest []byte, signature []byte) *httptest.Server {
+	var body rekorHashedRekord
+	body.Kind = "hashedrekord"
+	body.Spec.Data.Hash.Algorithm = "sha256"
+	body.Spec.Data.Hash.Value = hex.EncodeToString(digest)
+	body.Spec.Signature.Content = base64.StdEncoding.EncodeToString(signature)
+	bodyBytes, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry := rekorEntry{
+		Body:           base64.StdEncoding.EncodeToString(bodyBytes),
+		IntegratedTime: 1600000000,
+		LogID:          "c0d23d6ad406973f9559f3ba2d1ca01f84147d8ffc5b8445c224f98b9591801d",
+		LogIndex:       42,
+	}
+	payload, err := json.Marshal(map[string]interface{}{
+		"body":           entry.Body,
+		"integratedTime": entry.IntegratedTime,
+		"logID":          entry.LogID,
+		"logIndex":       entry.LogIndex,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payloadDigest := sha256.Sum256(payload)
+	entry.Verification.SignedEntryTimestamp = base64.StdEncoding.EncodeToString(signDigest(t, key, payloadDigest[:]))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/index/retrieve", func(w http.ResponseWriter, r *http.Request) {
+		var query map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&query)
+		uuids := []string{}
+		if query["hash"] == "sha256:"+hex.EncodeToString(digest) {
+			uuids = append(uuids, "abc123")
+		}
+		_ = json.NewEncoder(w).Encode(uuids)
+	})
+	mux.HandleFunc("/api/v1/log/entries/abc123", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]rekorEntry{"abc123": entry})
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestCosignVerifierRekor(t *testing.T) {
+	signer := newCosignKey(t)
+	rekorKey := newCosignKey(t)
+
+	fixture, signature := newCosignFixture(t, signer)
+	defer os.RemoveAll(fixture.dir)
+	keyPath := filepath.Join(fixture.dir, "cosign.pub")
+	writePublicKey(t, keyPath, signer)
+
+	verifier, err := NewCosignVerifier(keyPath, uri.DefaultFetcher, &logging.DefaultLogger)
+	if err != nil {
+		t.Fatalf("Could not create cosign verifier: %s", err)
+	}
+
+	server := fakeRekor(t, rekorKey, fixture.digest, signature)
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier.Rekor = &RekorLog{URL: serverURL, PublicKey: &rekorKey.PublicKey}
+	if err = fixture.verify(t, verifier); err != nil {
+		t.Errorf("Expected a logged signature to pass verification, got: %s", err)
+	}
+
+	// An entry signed by a different log doesn't count
+	verifier.Rekor.PublicKey = &newCosignKey(t).PublicKey
+	if err = fixture.verify(t, verifier); err == nil {
+		t.Error("Expected an entry with an invalid signed entry timestamp to fail verification")
+	}
+
+	// Nor does an entry for a different signature of the same artifact
+	otherServer := fakeRekor(t, rekorKey, fixture.digest, signDigest(t, signer, fixture.digest))
+	defer otherServer.Close()
+	otherURL, err := url.Parse(otherServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier.Rekor = &RekorLog{URL: otherURL, PublicKey: &rekorKey.PublicKey}
+	if err = fixture.verify(t, verifier); err == nil {
+		t.Error("Expected a signature that wasn't logged to fail verification")
+	}
+}
@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+	"sort"
+	"sync"
+)
+
+// DigestRegistry maps a key in an artifact's build manifest, such as
+// artifact_sha, to the hash algorithm whose hex digest that key holds.
+type DigestRegistry map[string]func() hash.Hash
+
+var (
+	digestRegistryMu sync.RWMutex
+	digestRegistry   = DigestRegistry{
+		"artifact_sha":    sha256.New,
+		"artifact_sha512": sha512.New,
+	}
+)
+
+// RegisterDigestAlgorithm makes BuildManifestVerifier check the digest stored
+// under yamlKey in build manifests using newHash. Registering an existing key
+// replaces its algorithm.
+func RegisterDigestAlgorithm(yamlKey string, newHash func() hash.Hash) {
+	digestRegistryMu.Lock()
+	defer digestRegistryMu.Unlock()
+	digestRegistry[yamlKey] = newHash
+}
+
+// registeredDigestKeys returns the registered manifest keys in sorted order,
+// along with a snapshot of the registry
+func registeredDigestKeys() ([]string, DigestRegistry) {
+	digestRegistryMu.RLock()
+	defer digestRegistryMu.RUnlock()
+	registry := make(DigestRegistry, len(digestRegistry))
+	keys := make([]string, 0, len(digestRegistry))
+	for key, newHash := range digestRegistry {
+		registry[key] = newHash
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, registry
+}
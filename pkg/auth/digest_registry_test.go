@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func artifactFile(t *testing.T, content []byte) *os.File {
+	f, err := ioutil.TempFile("", "digest-registry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Write(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Seek(0, os.SEEK_SET)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestCheckMatchingDigestUsesRegisteredAlgorithms(t *testing.T) {
+	// MD5 is registered here for testing only, it must not be used to
+	// verify real artifacts
+	RegisterDigestAlgorithm("artifact_md5_test", md5.New)
+
+	content := []byte("some artifact")
+	md5Sum := md5.Sum(content)
+	sha256Sum := sha256.Sum256(content)
+	b := &BuildManifestVerifier{}
+
+	f := artifactFile(t, content)
+	defer os.Remove(f.Name())
+	manifest := fmt.Sprintf("artifact_md5_test: %s\n", hex.EncodeToString(md5Sum[:]))
+	err := b.checkMatchingDigest(f, []byte(manifest))
+	if err != nil {
+		t.Errorf("expected a matching md5 digest to pass, got %s", err)
+	}
+
+	f = artifactFile(t, content)
+	defer os.Remove(f.Name())
+	manifest = fmt.Sprintf("artifact_sha: %s\nartifact_md5_test: %s\n", hex.EncodeToString(sha256Sum[:]), "0123456789abcdef0123456789abcdef")
+	err = b.checkMatchingDigest(f, []byte(manifest))
+	if err == nil {
+		t.Error("expected a mismatched md5 digest to fail even though the sha256 digest matched")
+	}
+}
+
+func TestCheckMatchingDigestRequiresAKnownDigest(t *testing.T) {
+	f := artifactFile(t, []byte("some artifact"))
+	defer os.Remove(f.Name())
+
+	b := &BuildManifestVerifier{}
+	err := b.checkMatchingDigest(f, []byte("artifact_unknown: abc\n"))
+	if err == nil {
+		t.Error("expected a manifest without a recognized digest to fail")
+	}
+}
+
+func TestCheckMatchingDigestAllowsOtherValues(t *testing.T) {
+	content := []byte("some artifact")
+	sha256Sum := sha256.Sum256(content)
+	b := &BuildManifestVerifier{}
+
+	f := artifactFile(t, content)
+	defer os.Remove(f.Name())
+	manifest := fmt.Sprintf("artifact_sha: %s\nbuild_number: 42\nbuild:\n  commit: abc123\n  tags: [release]\n", hex.EncodeToString(sha256Sum[:]))
+	err := b.checkMatchingDigest(f, []byte(manifest))
+	if err != nil {
+		t.Errorf("expected nested and non-string values of other keys to be ignored, got %s", err)
+	}
+
+	f = artifactFile(t, content)
+	defer os.Remove(f.Name())
+	err = b.checkMatchingDigest(f, []byte("artifact_sha: [abc]\n"))
+	if err == nil {
+		t.Error("expected a digest that isn't a string to fail")
+	}
+}
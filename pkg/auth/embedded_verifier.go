@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/util"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+// ManifestEmbeddedVerifier verifies artifacts using a digest and signature
+// carried in the pod manifest itself, rather than fetching a build manifest and
+// its signature from the artifact server. The launchable stanza should contain:
+//
+// 	artifact_digest: <hex SHA-256 digest of the artifact>
+// 	artifact_signature: |
+// 	  -----BEGIN PGP SIGNATURE-----
+// 	  ...
+//
+// where artifact_signature is a detached signature of the artifact_digest
+// string made by a key in the keyring. Since the manifest is already at hand
+// no network requests are made.
+type ManifestEmbeddedVerifier struct {
+	keyring openpgp.KeyRing
+	logger  *logging.Logger
+
+	// If non-nil, restricts which keys may sign the digests of each pod
+	SignerPolicy *SignerPolicy
+}
+
+func NewManifestEmbeddedVerifier(keyringPath string, logger *logging.Logger) (*ManifestEmbeddedVerifier, error) {
+	keyring, err := newReloadingKeyring(keyringPath, logger)
+	if err != nil {
+		return nil, util.Errorf("Could not load artifact verification keyring from %v: %v", keyringPath, err)
+	}
+	return &ManifestEmbeddedVerifier{
+		keyring: keyring,
+		logger:  logger,
+	}, nil
+}
+
+// Returns an error if the digest embedded in the manifest is not signed by a
+// key in the keyring or if the local copy of the artifact does not match it.
+func (m *ManifestEmbeddedVerifier) VerifyHoistArtifact(localCopy *os.File, verificationData VerificationData) error {
+	digest := strings.TrimSpace(verificationData.ArtifactDigest)
+	if digest == "" {
+		return util.Errorf("Embedded verification failed: manifest does not contain an artifact_digest")
+	}
+	if verificationData.ArtifactSignature == "" {
+		return util.Errorf("Embedded verification failed: manifest does not contain an artifact_signature")
+	}
+
+	err := verifySigned(m.keyring, m.SignerPolicy, verificationData.PodID, strings.NewReader(digest), []byte(verificationData.ArtifactSignature))
+	if err != nil {
+		return err
+	}
+
+	hasher := sha256.New()
+	_, err = io.Copy(hasher, localCopy)
+	if err != nil {
+		return util.Errorf("Could not read given local copy of the artifact: %v", err)
+	}
+	realDigest := hex.EncodeToString(hasher.Sum(nil))
+	if !strings.EqualFold(realDigest, digest) {
+		return util.Errorf("Artifact hex digest did not match the manifest: expected %v, was actually %v", digest, realDigest)
+	}
+	return nil
+}
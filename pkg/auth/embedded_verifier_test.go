@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/logging"
+
+	"golang.org/x/crypto/openpgp"
+	"gopkg.in/yaml.v2"
+)
+
+// embeddedStanza builds the YAML of a launchable stanza that embeds digest
+// and signature, parsed the same way a pod manifest would be
+func embeddedStanza(t *testing.T, digest string, signature string) launch.LaunchableStanza {
+	indented := "    " + strings.Replace(strings.TrimSpace(signature), "\n", "\n    ", -1)
+	stanzaYAML := fmt.Sprintf(`launchable_type: hoist
+location: https://localhost/app_abc123.tar.gz
+artifact_digest: %s
+artifact_signature: |
+%s
+`, digest, indented)
+
+	var stanza launch.LaunchableStanza
+	err := yaml.Unmarshal([]byte(stanzaYAML), &stanza)
+	if err != nil {
+		t.Fatalf("Could not unmarshal launchable stanza: %s", err)
+	}
+	return stanza
+}
+
+func TestManifestEmbeddedVerifier(t *testing.T) {
+	signer := newTestEntity(t, "signer", time.Now().Add(-time.Hour), 365*24*time.Hour)
+	verifier := &ManifestEmbeddedVerifier{
+		keyring: openpgp.EntityList{signer},
+		logger:  &logging.DefaultLogger,
+	}
+
+	tempDir, err := ioutil.TempDir("", "test-embedded-verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	artifact := []byte("artifact contents")
+	artifactPath := filepath.Join(tempDir, "app_abc123.tar.gz")
+	err = ioutil.WriteFile(artifactPath, artifact, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sum := sha256.Sum256(artifact)
+	digest := hex.EncodeToString(sum[:])
+	var signature bytes.Buffer
+	err = openpgp.ArmoredDetachSign(&signature, signer, strings.NewReader(digest), nil)
+	if err != nil {
+		t.Fatalf("Could not sign digest: %s", err)
+	}
+
+	verify := func(stanza launch.LaunchableStanza) error {
+		localCopy, err := os.Open(artifactPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer localCopy.Close()
+		return verifier.VerifyHoistArtifact(localCopy, VerificationData{
+			ArtifactDigest:    stanza.ArtifactDigest,
+			ArtifactSignature: stanza.ArtifactSignature,
+		})
+	}
+
+	err = verify(embeddedStanza(t, digest, signature.String()))
+	if err != nil {
+		t.Errorf("Expected the embedded signature to pass verification, got: %v", err)
+	}
+
+	// Sign a different digest and embed that signature instead
+	var tampered bytes.Buffer
+	err = openpgp.ArmoredDetachSign(&tampered, signer, strings.NewReader(strings.Repeat("0", len(digest))), nil)
+	if err != nil {
+		t.Fatalf("Could not sign digest: %s", err)
+	}
+	err = verify(embeddedStanza(t, digest, tampered.String()))
+	if err == nil {
+		t.Error("Expected a tampered signature to fail verification")
+	}
+
+	// A validly signed digest that doesn't match the artifact
+	otherSum := sha256.Sum256([]byte("other contents"))
+	otherDigest := hex.EncodeToString(otherSum[:])
+	var otherSignature bytes.Buffer
+	err = openpgp.ArmoredDetachSign(&otherSignature, signer, strings.NewReader(otherDigest), nil)
+	if err != nil {
+		t.Fatalf("Could not sign digest: %s", err)
+	}
+	err = verify(embeddedStanza(t, otherDigest, otherSignature.String()))
+	if err == nil {
+		t.Error("Expected a digest that doesn't match the artifact to fail verification")
+	}
+
+	err = verify(launch.LaunchableStanza{})
+	if err == nil {
+		t.Error("Expected a manifest without an embedded digest to fail verification")
+	}
+}
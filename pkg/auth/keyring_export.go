@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"bytes"
+	"io"
+	"os"
+
+	"github.com/square/p2/pkg/util"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+// ExportPublicKeyring writes the public keys in ring to a new file at path,
+// in the binary format accepted by LoadKeyring. Private keys are never
+// written. It is an error for the file to already exist.
+func ExportPublicKeyring(ring openpgp.KeyRing, path string) error {
+	entities, err := exportableEntities(ring)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return util.Errorf("could not create keyring %s: %s", path, err)
+	}
+	err = serializePublicKeys(f, entities)
+	if err != nil {
+		f.Close()
+		os.Remove(path)
+		return util.Errorf("could not write keyring %s: %s", path, err)
+	}
+	return f.Close()
+}
+
+// ExportPublicKeyringArmored returns the public keys in ring as an
+// ASCII-armored public key block, e.g. for publishing to artifact servers.
+func ExportPublicKeyringArmored(ring openpgp.KeyRing) (string, error) {
+	entities, err := exportableEntities(ring)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return "", util.Errorf("could not armor keyring: %s", err)
+	}
+	err = serializePublicKeys(w, entities)
+	if err != nil {
+		return "", util.Errorf("could not serialize keyring: %s", err)
+	}
+	// Close writes the armor footer
+	err = w.Close()
+	if err != nil {
+		return "", util.Errorf("could not armor keyring: %s", err)
+	}
+	return buf.String(), nil
+}
+
+// exportableEntities returns the keys in ring. Only an EntityList can be
+// enumerated, which is what LoadKeyring returns.
+func exportableEntities(ring openpgp.KeyRing) (openpgp.EntityList, error) {
+	entities, ok := ring.(openpgp.EntityList)
+	if !ok {
+		return nil, util.Errorf("cannot export a %T keyring, only an openpgp.EntityList can be enumerated", ring)
+	}
+	return entities, nil
+}
+
+func serializePublicKeys(w io.Writer, entities openpgp.EntityList) error {
+	for _, entity := range entities {
+		// Serialize only writes the public parts of the entity
+		err := entity.Serialize(w)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+func fingerprints(ring openpgp.EntityList) []string {
+	var ret []string
+	for _, entity := range ring {
+		ret = append(ret, fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint))
+	}
+	return ret
+}
+
+func checkExportedKeyring(t *testing.T, original, exported openpgp.EntityList) {
+	if len(exported) != len(original) {
+		t.Fatalf("expected %d keys after exporting, got %d", len(original), len(exported))
+	}
+	expected := fingerprints(original)
+	for i, fingerprint := range fingerprints(exported) {
+		if fingerprint != expected[i] {
+			t.Errorf("expected key %d to have fingerprint %s, got %s", i, expected[i], fingerprint)
+		}
+	}
+	for _, entity := range exported {
+		if entity.PrivateKey != nil {
+			t.Errorf("expected only public keys to be exported, but %X has a private key", entity.PrimaryKey.Fingerprint)
+		}
+	}
+}
+
+func TestExportPublicKeyring(t *testing.T) {
+	original, err := openpgp.ReadArmoredKeyRing(bytes.NewBufferString(testUsers))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tempDir, err := ioutil.TempDir("", "keyring_export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	path := filepath.Join(tempDir, "public.keyring")
+
+	err = ExportPublicKeyring(original, path)
+	if err != nil {
+		t.Fatalf("could not export keyring: %s", err)
+	}
+	exported, err := LoadKeyring(path)
+	if err != nil {
+		t.Fatalf("could not load exported keyring: %s", err)
+	}
+	checkExportedKeyring(t, original, exported)
+
+	err = ExportPublicKeyring(original, path)
+	if err == nil {
+		t.Error("expected an error exporting over an existing file")
+	}
+}
+
+func TestExportPublicKeyringArmored(t *testing.T) {
+	original, err := openpgp.ReadArmoredKeyRing(bytes.NewBufferString(testUsers))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	armored, err := ExportPublicKeyringArmored(original)
+	if err != nil {
+		t.Fatalf("could not export keyring: %s", err)
+	}
+	if !strings.HasPrefix(armored, "-----BEGIN PGP PUBLIC KEY BLOCK-----") {
+		t.Errorf("expected an armored public key block, got %q", armored)
+	}
+	exported, err := openpgp.ReadArmoredKeyRing(strings.NewReader(armored))
+	if err != nil {
+		t.Fatalf("could not read exported keyring: %s", err)
+	}
+	checkExportedKeyring(t, original, exported)
+}
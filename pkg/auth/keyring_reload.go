@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/util"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+// reloadingKeyring is an openpgp.KeyRing read from a keyring file or
+// directory (see LoadKeyring) that is re-read whenever it changes, so that
+// keys can be rotated without restarting the process. Changes are found by
+// comparing the modification times and sizes of the files each time the keys
+// are needed. If the keyring can no longer be read the last keys read are
+// used, as with util.FileWatcher.
+type reloadingKeyring struct {
+	path   string
+	logger *logging.Logger
+
+	mu      sync.Mutex
+	state   string
+	keyring openpgp.EntityList
+}
+
+var _ openpgp.KeyRing = &reloadingKeyring{}
+
+// newReloadingKeyring reads the keyring at path, failing if it can't be read.
+// The keyring's stats are logged to logger, if non-nil, each time it is read.
+func newReloadingKeyring(path string, logger *logging.Logger) (*reloadingKeyring, error) {
+	k := &reloadingKeyring{
+		path:   path,
+		logger: logger,
+	}
+	err := k.reload()
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// reload re-reads the keyring if it has changed since it was last read. The
+// caller must hold mu, except from newReloadingKeyring.
+func (k *reloadingKeyring) reload() error {
+	state, err := keyringState(k.path)
+	if err != nil {
+		return err
+	}
+	if state == k.state {
+		return nil
+	}
+	keyring, err := LoadKeyring(k.path)
+	if err != nil {
+		return err
+	}
+	k.state = state
+	k.keyring = keyring
+	logKeyringStats(keyring, k.path, k.logger)
+	return nil
+}
+
+// current returns the keys, re-reading them first if the keyring changed.
+func (k *reloadingKeyring) current() openpgp.EntityList {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	err := k.reload()
+	if err != nil && k.logger != nil {
+		k.logger.WithError(err).WithField("keyring", k.path).Errorln("Could not reload artifact verification keyring, using the keys last read")
+	}
+	return k.keyring
+}
+
+func (k *reloadingKeyring) KeysById(id uint64) []openpgp.Key {
+	return k.current().KeysById(id)
+}
+
+func (k *reloadingKeyring) KeysByIdUsage(id uint64, requiredUsage byte) []openpgp.Key {
+	return k.current().KeysByIdUsage(id, requiredUsage)
+}
+
+func (k *reloadingKeyring) DecryptionKeys() []openpgp.Key {
+	return k.current().DecryptionKeys()
+}
+
+// keyringState summarizes the modification time and size of every file of
+// the keyring at path, so that a change to any of them can be detected.
+func keyringState(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return fileState(info), nil
+	}
+
+	files, err := keyringFiles(path)
+	if err != nil {
+		return "", err
+	}
+	state := ""
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return "", util.Errorf("could not stat keyring %s: %s", file, err)
+		}
+		state += file + ":" + fileState(info) + "\n"
+	}
+	return state, nil
+}
+
+func fileState(info os.FileInfo) string {
+	return fmt.Sprintf("%d/%d", info.ModTime().UnixNano(), info.Size())
+}
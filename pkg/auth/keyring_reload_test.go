@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+func writeArmoredKeyring(t *testing.T, path string, ring openpgp.EntityList) {
+	armored, err := ExportPublicKeyringArmored(ring)
+	if err != nil {
+		t.Fatalf("could not export keyring: %s", err)
+	}
+	err = ioutil.WriteFile(path, []byte(armored), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadKeyringDirectory(t *testing.T) {
+	users, err := openpgp.ReadArmoredKeyRing(bytes.NewBufferString(testUsers))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) < 2 {
+		t.Fatalf("expected at least 2 test users, got %d", len(users))
+	}
+
+	tempDir, err := ioutil.TempDir("", "keyring_dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	writeArmoredKeyring(t, filepath.Join(tempDir, "a.keyring"), users[:1])
+	writeArmoredKeyring(t, filepath.Join(tempDir, "b.keyring"), users[1:])
+	err = ioutil.WriteFile(filepath.Join(tempDir, ".hidden"), []byte("not a keyring"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadKeyring(tempDir)
+	if err != nil {
+		t.Fatalf("could not load keyring directory: %s", err)
+	}
+	checkExportedKeyring(t, users, loaded)
+}
+
+func TestReloadingKeyring(t *testing.T) {
+	users, err := openpgp.ReadArmoredKeyRing(bytes.NewBufferString(testUsers))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tempDir, err := ioutil.TempDir("", "keyring_reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	writeArmoredKeyring(t, filepath.Join(tempDir, "a.keyring"), users[:1])
+
+	keyring, err := newReloadingKeyring(tempDir, nil)
+	if err != nil {
+		t.Fatalf("could not load keyring: %s", err)
+	}
+	newKeyID := users[1].PrimaryKey.KeyId
+	if len(keyring.KeysById(newKeyID)) != 0 {
+		t.Fatal("expected the second user's key to be missing before it was added")
+	}
+
+	writeArmoredKeyring(t, filepath.Join(tempDir, "b.keyring"), users[1:])
+	if len(keyring.KeysById(newKeyID)) == 0 {
+		t.Error("expected the keyring to be reloaded after a keyring file was added")
+	}
+
+	// A keyring that can't be read is ignored until it is fixed
+	badPath := filepath.Join(tempDir, "c.keyring")
+	err = ioutil.WriteFile(badPath, []byte("not a keyring"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keyring.KeysById(newKeyID)) == 0 {
+		t.Error("expected the last keys read to be used when the keyring can't be reloaded")
+	}
+
+	err = os.Remove(badPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Remove(filepath.Join(tempDir, "b.keyring"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keyring.KeysById(newKeyID)) != 0 {
+		t.Error("expected the second user's key to be gone after its keyring file was removed")
+	}
+}
+
+func TestReloadingKeyringFile(t *testing.T) {
+	users, err := openpgp.ReadArmoredKeyRing(bytes.NewBufferString(testUsers))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tempDir, err := ioutil.TempDir("", "keyring_reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	path := filepath.Join(tempDir, "public.keyring")
+	writeArmoredKeyring(t, path, users[:1])
+
+	keyring, err := newReloadingKeyring(path, nil)
+	if err != nil {
+		t.Fatalf("could not load keyring: %s", err)
+	}
+
+	writeArmoredKeyring(t, path, users)
+	// Make sure the modification time changes even on coarse filesystems
+	later := time.Now().Add(time.Minute)
+	err = os.Chtimes(path, later, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keyring.KeysById(users[len(users)-1].PrimaryKey.KeyId)) == 0 {
+		t.Error("expected the keyring to be reloaded after the file changed")
+	}
+}
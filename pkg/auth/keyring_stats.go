@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/square/p2/pkg/logging"
+
+	"github.com/Sirupsen/logrus"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// Keys expiring within this window are counted in
+// KeyringReport.ExpiringWithin30Days
+const keyExpiryWarningWindow = 30 * 24 * time.Hour
+
+// KeyringReport summarizes the keys in a keyring so that operators can tell
+// which keys are loaded and when they will stop being usable.
+type KeyringReport struct {
+	TotalKeys            int
+	ExpiredKeys          int
+	ExpiringWithin30Days int
+	KeyDetails           []KeyDetail
+}
+
+type KeyDetail struct {
+	KeyID       string
+	Fingerprint string
+	Algorithm   string
+	// nil if the key never expires
+	ExpiresAt *time.Time
+}
+
+// KeyringStats reports on the primary keys in a keyring. The ring is an
+// EntityList rather than an openpgp.KeyRing because the latter cannot be
+// enumerated.
+func KeyringStats(ring openpgp.EntityList) KeyringReport {
+	return keyringStatsAt(ring, time.Now())
+}
+
+func logKeyringStats(ring openpgp.EntityList, keyringPath string, logger *logging.Logger) {
+	if logger == nil {
+		return
+	}
+	report := KeyringStats(ring)
+	logger.WithFields(logrus.Fields{
+		"keyring":                 keyringPath,
+		"total_keys":              report.TotalKeys,
+		"expired_keys":            report.ExpiredKeys,
+		"expiring_within_30_days": report.ExpiringWithin30Days,
+	}).Infoln("Loaded artifact verification keyring")
+	for _, detail := range report.KeyDetails {
+		expiresAt := "never"
+		if detail.ExpiresAt != nil {
+			expiresAt = detail.ExpiresAt.Format(time.RFC3339)
+		}
+		logger.WithFields(logrus.Fields{
+			"key_id":      detail.KeyID,
+			"fingerprint": detail.Fingerprint,
+			"algorithm":   detail.Algorithm,
+			"expires_at":  expiresAt,
+		}).Infoln("Artifact verification key")
+	}
+}
+
+func keyringStatsAt(ring openpgp.EntityList, now time.Time) KeyringReport {
+	report := KeyringReport{}
+	for _, entity := range ring {
+		if entity.PrimaryKey == nil {
+			continue
+		}
+
+		detail := KeyDetail{
+			KeyID:       entity.PrimaryKey.KeyIdString(),
+			Fingerprint: fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint),
+			Algorithm:   algorithmName(entity.PrimaryKey.PubKeyAlgo),
+			ExpiresAt:   keyExpiry(entity),
+		}
+
+		report.TotalKeys++
+		if detail.ExpiresAt != nil {
+			switch {
+			case !now.Before(*detail.ExpiresAt):
+				report.ExpiredKeys++
+			case detail.ExpiresAt.Sub(now) <= keyExpiryWarningWindow:
+				report.ExpiringWithin30Days++
+			}
+		}
+		report.KeyDetails = append(report.KeyDetails, detail)
+	}
+	return report
+}
+
+// keyExpiry returns the earliest expiry of the entity's primary key according
+// to its identity self-signatures, or nil if none of them set a lifetime.
+func keyExpiry(entity *openpgp.Entity) *time.Time {
+	var expiry *time.Time
+	for _, identity := range entity.Identities {
+		sig := identity.SelfSignature
+		if sig == nil || sig.KeyLifetimeSecs == nil || *sig.KeyLifetimeSecs == 0 {
+			continue
+		}
+		expiresAt := entity.PrimaryKey.CreationTime.Add(time.Duration(*sig.KeyLifetimeSecs) * time.Second)
+		if expiry == nil || expiresAt.Before(*expiry) {
+			expiry = &expiresAt
+		}
+	}
+	return expiry
+}
+
+func algorithmName(algo packet.PublicKeyAlgorithm) string {
+	switch algo {
+	case packet.PubKeyAlgoRSA, packet.PubKeyAlgoRSAEncryptOnly, packet.PubKeyAlgoRSASignOnly:
+		return "RSA"
+	case packet.PubKeyAlgoDSA:
+		return "DSA"
+	case packet.PubKeyAlgoElGamal:
+		return "ElGamal"
+	case packet.PubKeyAlgoECDSA:
+		return "ECDSA"
+	case packet.PubKeyAlgoECDH:
+		return "ECDH"
+	default:
+		return fmt.Sprintf("unknown (%d)", algo)
+	}
+}
@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+func newTestEntity(t *testing.T, name string, created time.Time, lifetime time.Duration) *openpgp.Entity {
+	config := &packet.Config{
+		RSABits: 1024,
+		Time:    func() time.Time { return created },
+	}
+	entity, err := openpgp.NewEntity(name, "", name+"@example.com", config)
+	if err != nil {
+		t.Fatalf("Could not generate test key: %s", err)
+	}
+	secs := uint32(lifetime.Seconds())
+	for _, identity := range entity.Identities {
+		identity.SelfSignature.KeyLifetimeSecs = &secs
+	}
+	return entity
+}
+
+func TestKeyringStats(t *testing.T) {
+	now := time.Now()
+	active := newTestEntity(t, "active", now.Add(-24*time.Hour), 365*24*time.Hour)
+	expired := newTestEntity(t, "expired", now.Add(-48*time.Hour), 24*time.Hour)
+
+	report := keyringStatsAt(openpgp.EntityList{active, expired}, now)
+	if report.TotalKeys != 2 {
+		t.Errorf("expected 2 total keys, got %d", report.TotalKeys)
+	}
+	if report.ExpiredKeys != 1 {
+		t.Errorf("expected 1 expired key, got %d", report.ExpiredKeys)
+	}
+	if report.ExpiringWithin30Days != 0 {
+		t.Errorf("expected no keys expiring soon, got %d", report.ExpiringWithin30Days)
+	}
+	if len(report.KeyDetails) != 2 {
+		t.Fatalf("expected 2 key details, got %d", len(report.KeyDetails))
+	}
+
+	detail := report.KeyDetails[0]
+	if detail.KeyID != active.PrimaryKey.KeyIdString() {
+		t.Errorf("expected first key ID to be %s, was %s", active.PrimaryKey.KeyIdString(), detail.KeyID)
+	}
+	if detail.Algorithm != "RSA" {
+		t.Errorf("expected RSA key, got %s", detail.Algorithm)
+	}
+	if detail.ExpiresAt == nil || !detail.ExpiresAt.After(now) {
+		t.Errorf("expected active key to expire in the future, got %v", detail.ExpiresAt)
+	}
+}
+
+func TestKeyringStatsExpiringSoon(t *testing.T) {
+	now := time.Now()
+	expiring := newTestEntity(t, "expiring", now.Add(-24*time.Hour), 7*24*time.Hour)
+
+	report := keyringStatsAt(openpgp.EntityList{expiring}, now)
+	if report.ExpiringWithin30Days != 1 {
+		t.Errorf("expected 1 key expiring within 30 days, got %d", report.ExpiringWithin30Days)
+	}
+	if report.ExpiredKeys != 0 {
+		t.Errorf("expected no expired keys, got %d", report.ExpiredKeys)
+	}
+}
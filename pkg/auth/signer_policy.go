@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+
+	"golang.org/x/crypto/openpgp"
+	"gopkg.in/yaml.v2"
+)
+
+// A SignerPolicy restricts which keys of an artifact verifier's keyring may
+// sign the artifacts of each pod, so that each team can sign its own pods'
+// artifacts with its own keys. Pods are listed by ID or by a glob of IDs, as
+// understood by filepath.Match, and each has a list of the fingerprints of
+// the keys authorized to sign its artifacts. If a pod matches several
+// entries, a key on any of their lists is authorized. An artifact of a pod
+// that matches no entry may be signed by any key on the keyring.
+//
+// The policy file should be a YAML-serialized object that conforms to the
+// layout of the `RawSignerPolicy` type. Example policy file:
+//   ---
+//   pods:
+//     web:
+//     - 5D7A2F4E0C2B8A1D3F6E9B0A1C2D3E4F5A6B7C8D
+//     "billing-*":
+//     - 0A1B2C3D4E5F60718293A4B5C6D7E8F901234567
+//
+// A nil *SignerPolicy authorizes every key.
+type SignerPolicy struct {
+	// Each pod ID or glob has a *set* of key fingerprints
+	pods map[string]map[string]bool
+}
+
+type RawSignerPolicy struct {
+	Pods map[string][]string `yaml:"pods"`
+}
+
+// LoadSignerPolicy reads a SignerPolicy from a file.
+func LoadSignerPolicy(path string) (*SignerPolicy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw RawSignerPolicy
+	err = yaml.Unmarshal(data, &raw)
+	if err != nil {
+		return nil, util.Errorf("could not parse signer policy %s: %s", path, err)
+	}
+	policy, err := NewSignerPolicy(raw.Pods)
+	if err != nil {
+		return nil, util.Errorf("invalid signer policy %s: %s", path, err)
+	}
+	return policy, nil
+}
+
+// NewSignerPolicy returns a SignerPolicy authorizing the keys with the given
+// fingerprints for each pod ID or glob. Fingerprints are hex, and may contain
+// spaces as printed by gpg --fingerprint.
+func NewSignerPolicy(pods map[string][]string) (*SignerPolicy, error) {
+	policy := &SignerPolicy{pods: make(map[string]map[string]bool)}
+	for pattern, fingerprints := range pods {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, util.Errorf("invalid pod glob %q: %s", pattern, err)
+		}
+		fingerprintSet := make(map[string]bool)
+		for _, fingerprint := range fingerprints {
+			fingerprint = strings.ToUpper(strings.Replace(fingerprint, " ", "", -1))
+			if fingerprint == "" {
+				return nil, util.Errorf("empty fingerprint listed for %q", pattern)
+			}
+			fingerprintSet[fingerprint] = true
+		}
+		policy.pods[pattern] = fingerprintSet
+	}
+	return policy, nil
+}
+
+// AuthorizeSigner returns an error unless signer is authorized to sign the
+// artifacts of the pod podID.
+func (p *SignerPolicy) AuthorizeSigner(podID types.PodID, signer *openpgp.Entity) error {
+	if p == nil {
+		return nil
+	}
+	signerID := fmt.Sprintf("%X", signer.PrimaryKey.Fingerprint)
+
+	var patterns []string
+	for pattern, fingerprints := range p.pods {
+		matched, _ := filepath.Match(pattern, podID.String())
+		if !matched {
+			continue
+		}
+		if fingerprints[signerID] {
+			return nil
+		}
+		patterns = append(patterns, pattern)
+	}
+	if len(patterns) == 0 {
+		return nil
+	}
+	sort.Strings(patterns)
+	return Error{
+		util.Errorf("artifact signer %s not authorized for %s by signer policy entries %s", signerID, podID, strings.Join(patterns, ", ")),
+		map[string]interface{}{"signer_key": signerID},
+	}
+}
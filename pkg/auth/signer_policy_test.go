@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/types"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+func TestSignerPolicy(t *testing.T) {
+	teamA := newTestEntity(t, "teamA", time.Now().Add(-time.Hour), 365*24*time.Hour)
+	teamB := newTestEntity(t, "teamB", time.Now().Add(-time.Hour), 365*24*time.Hour)
+	teamAID := fmt.Sprintf("%X", teamA.PrimaryKey.Fingerprint)
+	teamBID := fmt.Sprintf("%X", teamB.PrimaryKey.Fingerprint)
+
+	tempDir, err := ioutil.TempDir("", "signer_policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	policyPath := filepath.Join(tempDir, "signers.yaml")
+	policyYAML := fmt.Sprintf(`pods:
+  web:
+  - %s
+  "billing-*":
+  - %s
+  billing-shared:
+  - %s
+`, strings.ToLower(teamAID), teamBID, teamAID)
+	err = ioutil.WriteFile(policyPath, []byte(policyYAML), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err := LoadSignerPolicy(policyPath)
+	if err != nil {
+		t.Fatalf("Could not load signer policy: %s", err)
+	}
+
+	for _, test := range []struct {
+		podID      types.PodID
+		signer     *openpgp.Entity
+		authorized bool
+	}{
+		{"web", teamA, true},
+		{"web", teamB, false},
+		{"billing-api", teamB, true},
+		{"billing-api", teamA, false},
+		// Matches both billing entries
+		{"billing-shared", teamA, true},
+		{"billing-shared", teamB, true},
+		// Matches no entry
+		{"other", teamA, true},
+		{"other", teamB, true},
+	} {
+		err := policy.AuthorizeSigner(test.podID, test.signer)
+		if test.authorized && err != nil {
+			t.Errorf("Expected %s to be authorized for %s, got: %s", test.signer.PrimaryKey.KeyIdString(), test.podID, err)
+		}
+		if !test.authorized && err == nil {
+			t.Errorf("Expected %s not to be authorized for %s", test.signer.PrimaryKey.KeyIdString(), test.podID)
+		}
+	}
+
+	var nilPolicy *SignerPolicy
+	if err = nilPolicy.AuthorizeSigner("web", teamB); err != nil {
+		t.Errorf("Expected a nil policy to authorize every signer, got: %s", err)
+	}
+
+	_, err = NewSignerPolicy(map[string][]string{"[web": {teamAID}})
+	if err == nil {
+		t.Error("Expected an invalid glob to be rejected")
+	}
+}
+
+func TestManifestEmbeddedVerifierSignerPolicy(t *testing.T) {
+	teamA := newTestEntity(t, "teamA", time.Now().Add(-time.Hour), 365*24*time.Hour)
+	teamB := newTestEntity(t, "teamB", time.Now().Add(-time.Hour), 365*24*time.Hour)
+	policy, err := NewSignerPolicy(map[string][]string{
+		"web": {fmt.Sprintf("%X", teamA.PrimaryKey.Fingerprint)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := &ManifestEmbeddedVerifier{
+		keyring:      openpgp.EntityList{teamA, teamB},
+		logger:       &logging.DefaultLogger,
+		SignerPolicy: policy,
+	}
+
+	tempDir, err := ioutil.TempDir("", "test-signer-policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	artifact := []byte("artifact contents")
+	artifactPath := filepath.Join(tempDir, "web_abc123.tar.gz")
+	err = ioutil.WriteFile(artifactPath, artifact, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(artifact)
+	digest := hex.EncodeToString(sum[:])
+
+	verify := func(podID types.PodID, signer *openpgp.Entity) error {
+		var signature bytes.Buffer
+		err := openpgp.ArmoredDetachSign(&signature, signer, strings.NewReader(digest), nil)
+		if err != nil {
+			t.Fatalf("Could not sign digest: %s", err)
+		}
+		localCopy, err := os.Open(artifactPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer localCopy.Close()
+		return verifier.VerifyHoistArtifact(localCopy, VerificationData{
+			PodID:             podID,
+			ArtifactDigest:    digest,
+			ArtifactSignature: signature.String(),
+		})
+	}
+
+	if err = verify("web", teamA); err != nil {
+		t.Errorf("Expected an artifact signed by an authorized key to pass verification, got: %s", err)
+	}
+	if err = verify("web", teamB); err == nil {
+		t.Error("Expected an artifact signed by a key not authorized for the pod to fail verification")
+	}
+	if err = verify("api", teamB); err != nil {
+		t.Errorf("Expected any key to be authorized for a pod without a policy entry, got: %s", err)
+	}
+}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/openpgp"
+
+	"github.com/square/p2/pkg/util"
+)
+
+// LoadSigningKey returns the secret key in the keyring at path to sign pod
+// manifests with. If keyID is set, it is the fingerprint or key ID of the key
+// to use, and otherwise the keyring must contain exactly one secret key. An
+// encrypted key is decrypted with passphrase.
+//
+// The keyring may be a file or a directory of files, see LoadKeyring().
+func LoadSigningKey(path string, keyID string, passphrase []byte) (*openpgp.Entity, error) {
+	keyring, err := LoadKeyring(path)
+	if err != nil {
+		return nil, util.Errorf("could not load signing keyring %s: %s", path, err)
+	}
+	keyID = strings.ToUpper(strings.Replace(keyID, " ", "", -1))
+
+	var candidates []*openpgp.Entity
+	var fingerprints []string
+	for _, entity := range keyring {
+		if entity.PrivateKey == nil {
+			continue
+		}
+		fingerprint := fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint)
+		if keyID != "" && !strings.HasSuffix(fingerprint, keyID) {
+			continue
+		}
+		candidates = append(candidates, entity)
+		fingerprints = append(fingerprints, fingerprint)
+	}
+	switch {
+	case len(candidates) == 0 && keyID != "":
+		return nil, util.Errorf("no secret key %s found in %s", keyID, path)
+	case len(candidates) == 0:
+		return nil, util.Errorf("no secret keys found in %s", path)
+	case len(candidates) > 1:
+		return nil, util.Errorf("%s has several secret keys, choose one of %s", path, strings.Join(fingerprints, ", "))
+	}
+
+	signer := candidates[0]
+	if signer.PrivateKey.Encrypted {
+		if len(passphrase) == 0 {
+			return nil, util.Errorf("secret key %s is encrypted, but no passphrase was given", fingerprints[0])
+		}
+		err = signer.PrivateKey.Decrypt(passphrase)
+		if err != nil {
+			return nil, util.Errorf("could not decrypt secret key %s: %s", fingerprints[0], err)
+		}
+	}
+	return signer, nil
+}
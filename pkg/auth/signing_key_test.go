@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"fmt"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+
+	"github.com/square/p2/pkg/logging"
+)
+
+func TestLoadSigningKey(t *testing.T) {
+	h := testHarness{}
+	ents := h.loadEntities()
+	keyfile := h.tempFile()
+	defer rm(t, keyfile)
+	h.saveKeys(ents[:2], keyfile)
+	if h.Err != nil {
+		t.Fatal(h.Err)
+	}
+
+	_, err := LoadSigningKey(keyfile, "", nil)
+	if err == nil {
+		t.Error("Expected a keyring with several secret keys to need --signing-key")
+	}
+
+	fingerprint := fmt.Sprintf("%X", ents[1].PrimaryKey.Fingerprint)
+	for _, keyID := range []string{fingerprint, fingerprint[len(fingerprint)-16:]} {
+		signer, err := LoadSigningKey(keyfile, keyID, nil)
+		if err != nil {
+			t.Errorf("Unexpected error loading signing key %s: %s", keyID, err)
+			continue
+		}
+		if signer.PrimaryKey.KeyId != ents[1].PrimaryKey.KeyId {
+			t.Errorf("Expected key %s to select %X, got %X", keyID, ents[1].PrimaryKey.KeyId, signer.PrimaryKey.KeyId)
+		}
+	}
+
+	_, err = LoadSigningKey(keyfile, "0123456789ABCDEF", nil)
+	if err == nil {
+		t.Error("Expected an unknown key ID to be refused")
+	}
+}
+
+func TestLoadSigningKeyWithOneKey(t *testing.T) {
+	h := testHarness{}
+	ents := h.loadEntities()
+	keyfile := h.tempFile()
+	defer rm(t, keyfile)
+	h.saveKeys(ents[:1], keyfile)
+	msg := []byte("id: hello\n")
+	if h.Err != nil {
+		t.Fatal(h.Err)
+	}
+
+	signer, err := LoadSigningKey(keyfile, "", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error loading signing key: %s", err)
+	}
+	sigs := h.signMessage(msg, []*openpgp.Entity{signer})
+	if h.Err != nil {
+		t.Fatal(h.Err)
+	}
+
+	policy := FixedKeyringPolicy{Keyring: openpgp.EntityList(ents[:1])}
+	err = policy.AuthorizeApp(TestSigned{Id: "hello", Plaintext: msg, Signature: sigs[0]}, logging.DefaultLogger)
+	if err != nil {
+		t.Errorf("Expected a message signed with the loaded key to be authorized, got %s", err)
+	}
+}
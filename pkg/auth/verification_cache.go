@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/util"
+)
+
+// CachingVerifier remembers on disk which artifacts another verifier has
+// accepted, so that an artifact that was already verified, e.g. before the
+// preparer restarted, isn't verified again. Artifacts are identified by their
+// SHA-256 digest together with their verification data, so a cached result is
+// only reused for the same signature. Every entry is invalidated when one of
+// the configuration files the verifier depends on, such as its keyring or
+// signer policy, changes. Failed verifications are never cached.
+type CachingVerifier struct {
+	verifier ArtifactVerifier
+	dir      string
+	// Keyrings, keyring directories or other files whose modification
+	// invalidates the cache
+	configPaths []string
+	logger      *logging.Logger
+}
+
+var _ ArtifactVerifier = &CachingVerifier{}
+
+// NewCachingVerifier caches the results of verifier in dir, which is created
+// if necessary. The results are invalidated whenever one of configPaths
+// changes.
+func NewCachingVerifier(verifier ArtifactVerifier, dir string, configPaths []string, logger *logging.Logger) (*CachingVerifier, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, util.Errorf("Could not create artifact verification cache %v: %v", dir, err)
+	}
+	return &CachingVerifier{
+		verifier:    verifier,
+		dir:         dir,
+		configPaths: configPaths,
+		logger:      logger,
+	}, nil
+}
+
+func (c *CachingVerifier) VerifyHoistArtifact(localCopy *os.File, verificationData VerificationData) error {
+	key, err := c.cacheKey(localCopy, verificationData)
+	if err != nil {
+		return err
+	}
+	_, err = localCopy.Seek(0, os.SEEK_SET)
+	if err != nil {
+		return util.Errorf("Could not rewind localCopy %v back to start of file: %v", localCopy.Name(), err)
+	}
+
+	entryPath := filepath.Join(c.dir, key)
+	if _, err = os.Stat(entryPath); err == nil {
+		if c.logger != nil {
+			c.logger.WithField("artifact", localCopy.Name()).Debugln("Artifact verification found in cache")
+		}
+		return nil
+	}
+
+	err = c.verifier.VerifyHoistArtifact(localCopy, verificationData)
+	if err != nil {
+		return err
+	}
+
+	// A cache that can't be written only costs another verification later
+	err = ioutil.WriteFile(entryPath, []byte(time.Now().UTC().Format(time.RFC3339)+"\n"), 0600)
+	if err != nil && c.logger != nil {
+		c.logger.WithError(err).WithField("artifact", localCopy.Name()).Warnln("Could not cache artifact verification")
+	}
+	return nil
+}
+
+// cacheKey digests the artifact, its verification data and the state of the
+// configuration files into the name of a cache entry.
+func (c *CachingVerifier) cacheKey(localCopy *os.File, verificationData VerificationData) (string, error) {
+	artifactHasher := sha256.New()
+	_, err := io.Copy(artifactHasher, localCopy)
+	if err != nil {
+		return "", util.Errorf("Could not read given local copy of the artifact: %v", err)
+	}
+
+	keyHasher := sha256.New()
+	write := func(field string) {
+		// Fields are separated by a byte that can't appear in them
+		_, _ = io.WriteString(keyHasher, field+"\x00")
+	}
+	writeURL := func(u *url.URL) {
+		if u == nil {
+			write("")
+		} else {
+			write(u.String())
+		}
+	}
+	write(hex.EncodeToString(artifactHasher.Sum(nil)))
+	write(verificationData.PodID.String())
+	writeURL(verificationData.ArtifactLocation)
+	writeURL(verificationData.ManifestLocation)
+	writeURL(verificationData.ManifestSignatureLocation)
+	writeURL(verificationData.BuildSignatureLocation)
+	writeURL(verificationData.ChecksumLocation)
+	write(verificationData.ArtifactDigest)
+	write(verificationData.ArtifactSignature)
+	for _, path := range c.configPaths {
+		state, err := keyringState(path)
+		if err != nil {
+			return "", util.Errorf("Could not check %v for changes: %v", path, err)
+		}
+		write(fmt.Sprintf("%s=%s", path, state))
+	}
+	return hex.EncodeToString(keyHasher.Sum(nil)), nil
+}
@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCachingVerifier(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "verification_cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	keyringPath := filepath.Join(tempDir, "keyring")
+	err = ioutil.WriteFile(keyringPath, []byte("keyring"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	artifactPath := filepath.Join(tempDir, "artifact.tar.gz")
+	err = ioutil.WriteFile(artifactPath, []byte("artifact contents"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inner := &countingVerifier{}
+	cacheDir := filepath.Join(tempDir, "cache")
+	verifier, err := NewCachingVerifier(inner, cacheDir, []string{keyringPath}, nil)
+	if err != nil {
+		t.Fatalf("Could not create caching verifier: %s", err)
+	}
+
+	verify := func(verificationData VerificationData) error {
+		localCopy, err := os.Open(artifactPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer localCopy.Close()
+		return verifier.VerifyHoistArtifact(localCopy, verificationData)
+	}
+	data := VerificationData{PodID: "myapp", ArtifactDigest: "abc123", ArtifactSignature: "signature"}
+
+	if err = verify(data); err != nil {
+		t.Fatalf("Expected verification to pass, got %s", err)
+	}
+	if err = verify(data); err != nil {
+		t.Fatalf("Expected cached verification to pass, got %s", err)
+	}
+	if inner.calls != 1 {
+		t.Errorf("Expected the second verification to be cached, but the verifier was called %d times", inner.calls)
+	}
+
+	// A cache in the same directory, e.g. after a restart, has the same entries
+	verifier, err = NewCachingVerifier(inner, cacheDir, []string{keyringPath}, nil)
+	if err != nil {
+		t.Fatalf("Could not create caching verifier: %s", err)
+	}
+	if err = verify(data); err != nil || inner.calls != 1 {
+		t.Errorf("Expected the verification to still be cached, got %v after %d calls", err, inner.calls)
+	}
+
+	otherData := data
+	otherData.ArtifactSignature = "other signature"
+	if err = verify(otherData); err != nil || inner.calls != 2 {
+		t.Errorf("Expected a different signature to be verified, got %v after %d calls", err, inner.calls)
+	}
+
+	// Changing the keyring invalidates every entry
+	err = ioutil.WriteFile(keyringPath, []byte("rotated keyring"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	err = os.Chtimes(keyringPath, later, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = verify(data); err != nil || inner.calls != 3 {
+		t.Errorf("Expected the verification to be repeated after the keyring changed, got %v after %d calls", err, inner.calls)
+	}
+
+	// Failures aren't cached
+	inner.err = errors.New("bad signature")
+	if err = verify(data); err != nil {
+		t.Errorf("Expected a cached verification to pass, got %s", err)
+	}
+	if err = verify(VerificationData{PodID: "other"}); err == nil {
+		t.Error("Expected a failed verification to fail")
+	}
+	if err = verify(VerificationData{PodID: "other"}); err == nil || inner.calls != 5 {
+		t.Errorf("Expected a failed verification to be repeated, got %v after %d calls", err, inner.calls)
+	}
+}
@@ -15,7 +15,13 @@ import (
 type Subsystems struct {
 	CPU    string
 	Memory string
+	Pids   string
+	Blkio  string
 	Prefix string
+
+	// Set on hosts with an unified (cgroup v2) hierarchy, in which case every
+	// subsystem is its mountpoint
+	Unified bool
 }
 
 var DefaultSubsystems = Subsystems{
@@ -57,6 +63,9 @@ func (subsys Subsystems) SetCPU(name CgroupID, cpus int) error {
 	if err != nil && !os.IsExist(err) {
 		return err
 	}
+	if subsys.Unified {
+		return subsys.setUnifiedCPU(name, quota, period)
+	}
 
 	_, err = util.WriteIfChanged(
 		filepath.Join(subsys.CPU, name.String(), "cpu.cfs_period_us"),
@@ -102,6 +111,9 @@ func (subsys Subsystems) SetMemory(name CgroupID, bytes int) error {
 	if err != nil && !os.IsExist(err) {
 		return err
 	}
+	if subsys.Unified {
+		return subsys.setUnifiedMemory(name, hardLimit)
+	}
 
 	// the hard memory limit must be set BEFORE the mem+swap limit
 	// so we must clear the swap limit at the start
@@ -128,20 +140,47 @@ func (subsys Subsystems) SetMemory(name CgroupID, bytes int) error {
 	return nil
 }
 
+// Write sets every limit in the config. The pids and IO limits are only
+// required to be supported by the host when they are set.
 func (subsys Subsystems) Write(config Config) error {
 	err := subsys.SetCPU(config.Name, config.CPUs)
 	if err != nil {
 		return err
 	}
-	return subsys.SetMemory(config.Name, int(config.Memory))
+	err = subsys.SetMemory(config.Name, int(config.Memory))
+	if err != nil {
+		return err
+	}
+	err = subsys.SetCPUShares(config.Name, config.CPUShares)
+	if err != nil {
+		return err
+	}
+	if config.Pids != 0 || subsys.Pids != "" {
+		err = subsys.SetPids(config.Name, config.Pids)
+		if err != nil {
+			return err
+		}
+	}
+	if config.IOWeight != 0 || subsys.Blkio != "" {
+		return subsys.SetIOWeight(config.Name, config.IOWeight)
+	}
+	return nil
 }
 
 func (subsys Subsystems) AddPID(name string, pid int) error {
-	err := appendIntToFile(filepath.Join(subsys.Memory, name, "cgroup.procs"), pid)
-	if err != nil {
-		return err
+	if subsys.Unified {
+		return appendIntToFile(filepath.Join(subsys.CPU, name, "cgroup.procs"), pid)
+	}
+	for _, mountPoint := range []string{subsys.Memory, subsys.CPU, subsys.Pids, subsys.Blkio} {
+		if mountPoint == "" {
+			continue
+		}
+		err := appendIntToFile(filepath.Join(mountPoint, name, "cgroup.procs"), pid)
+		if err != nil {
+			return err
+		}
 	}
-	return appendIntToFile(filepath.Join(subsys.CPU, name, "cgroup.procs"), pid)
+	return nil
 }
 
 func appendIntToFile(filename string, data int) error {
@@ -172,16 +211,8 @@ func CreatePodCgroup(podID types.PodID, hostname types.NodeName, c Config, s Sub
 	if err != nil {
 		return err
 	}
-	err = ss.SetCPU(*cgroupID, c.CPUs)
-	if err != nil {
-		return err
-	}
-	err = ss.SetMemory(*cgroupID, int(c.Memory))
-	if err != nil {
-		return err
-	}
-
-	return nil
+	c.Name = *cgroupID
+	return ss.Write(c)
 }
 
 // CgroupIDForLaunchable encapsulates the cgroup path for launchable cgroups.
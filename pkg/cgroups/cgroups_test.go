@@ -11,7 +11,8 @@ import (
 )
 
 type FakeSubsystemer struct {
-	tmpdir string
+	tmpdir  string
+	unified bool
 }
 
 func (fs *FakeSubsystemer) Find() (Subsystems, error) {
@@ -25,7 +26,15 @@ func (fs *FakeSubsystemer) Find() (Subsystems, error) {
 	if err = os.Chmod(fs.tmpdir, os.ModePerm); err != nil {
 		return Subsystems{}, err
 	}
-	return Subsystems{CPU: filepath.Join(fs.tmpdir, "cpu"), Memory: filepath.Join(fs.tmpdir, "memory")}, nil
+	if fs.unified {
+		return Subsystems{CPU: fs.tmpdir, Memory: fs.tmpdir, Pids: fs.tmpdir, Blkio: fs.tmpdir, Unified: true}, nil
+	}
+	return Subsystems{
+		CPU:    filepath.Join(fs.tmpdir, "cpu"),
+		Memory: filepath.Join(fs.tmpdir, "memory"),
+		Pids:   filepath.Join(fs.tmpdir, "pids"),
+		Blkio:  filepath.Join(fs.tmpdir, "blkio"),
+	}, nil
 }
 
 // createTmpDir is useful only for tests, it creates the tmpdir
@@ -57,6 +66,74 @@ func TestCreatePodCgroup(t *testing.T) {
 	expectCgroupFileToContain(t, "1024\n", filepath.Join(fs.tmpdir, "memory", "p2", hostname.String(), podID.String(), "memory.soft_limit_in_bytes"))
 }
 
+func TestCreatePodCgroupUnified(t *testing.T) {
+	c := Config{CPUs: 2, Memory: size.ByteCount(1024)}
+	podID := types.PodID("podID")
+	hostname := types.NodeName("abc123.example")
+	fs := &FakeSubsystemer{unified: true}
+	defer fs.cleanupTmpdir()
+	if err := CreatePodCgroup(podID, hostname, c, fs); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	podCgroup := filepath.Join(fs.tmpdir, "p2", hostname.String(), podID.String())
+	expectCgroupFileToContain(t, "2000000 1000000\n", filepath.Join(podCgroup, "cpu.max"))
+	expectCgroupFileToContain(t, "2048\n", filepath.Join(podCgroup, "memory.max"))
+	for _, dir := range []string{fs.tmpdir, filepath.Join(fs.tmpdir, "p2"), filepath.Join(fs.tmpdir, "p2", hostname.String())} {
+		expectCgroupFileToContain(t, "+cpu +memory\n", filepath.Join(dir, "cgroup.subtree_control"))
+	}
+
+	// Unrestricted
+	if err := CreatePodCgroup(podID, hostname, Config{}, fs); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expectCgroupFileToContain(t, "max 1000000\n", filepath.Join(podCgroup, "cpu.max"))
+	expectCgroupFileToContain(t, "max\n", filepath.Join(podCgroup, "memory.max"))
+}
+
+func TestWriteLimits(t *testing.T) {
+	c := Config{Name: "p2/node/pod/app", CPUShares: 512, Pids: 100, IOWeight: 200}
+	fs := &FakeSubsystemer{}
+	defer fs.cleanupTmpdir()
+	ss, err := fs.Find()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ss.Write(c); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	expectCgroupFileToContain(t, "512\n", filepath.Join(fs.tmpdir, "cpu", "p2/node/pod/app", "cpu.shares"))
+	expectCgroupFileToContain(t, "100\n", filepath.Join(fs.tmpdir, "pids", "p2/node/pod/app", "pids.max"))
+	expectCgroupFileToContain(t, "200\n", filepath.Join(fs.tmpdir, "blkio", "p2/node/pod/app", "blkio.weight"))
+}
+
+func TestWriteLimitsUnified(t *testing.T) {
+	c := Config{Name: "p2/node/pod/app", CPUShares: 512, Pids: 100, IOWeight: 200}
+	fs := &FakeSubsystemer{unified: true}
+	defer fs.cleanupTmpdir()
+	ss, err := fs.Find()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ss.Write(c); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	cgroup := filepath.Join(fs.tmpdir, "p2/node/pod/app")
+	expectCgroupFileToContain(t, "20\n", filepath.Join(cgroup, "cpu.weight"))
+	expectCgroupFileToContain(t, "100\n", filepath.Join(cgroup, "pids.max"))
+	expectCgroupFileToContain(t, "default 1920\n", filepath.Join(cgroup, "io.weight"))
+
+	// Removing the limits restores the defaults
+	c = Config{Name: c.Name}
+	if err := ss.Write(c); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expectCgroupFileToContain(t, "max\n", filepath.Join(cgroup, "pids.max"))
+	expectCgroupFileToContain(t, "default 4950\n", filepath.Join(cgroup, "io.weight"))
+}
+
 func expectCgroupFileToContain(t *testing.T, s string, file string) {
 	actual, err := ioutil.ReadFile(filepath.Join(file))
 	if err != nil {
@@ -9,4 +9,14 @@ type Config struct {
 	Name   CgroupID       `yaml:"-"`                // The name of the cgroup in cgroupfs
 	CPUs   int            `yaml:"cpus,omitempty"`   // The number of logical CPUs
 	Memory size.ByteCount `yaml:"memory,omitempty"` // The number of bytes of memory
+
+	// The CPU weight relative to other cgroups, from MinCPUShares to
+	// MaxCPUShares. Unlike cpus, it only limits the cgroup when the CPUs are
+	// busy. Defaults to 1024
+	CPUShares int `yaml:"cpu_shares,omitempty"`
+	// The most processes and threads the cgroup may run at once
+	Pids int `yaml:"pids,omitempty"`
+	// The block IO weight relative to other cgroups, from MinIOWeight to
+	// MaxIOWeight. Defaults to 500
+	IOWeight int `yaml:"io_weight,omitempty"`
 }
@@ -0,0 +1,126 @@
+package cgroups
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/square/p2/pkg/util"
+)
+
+const (
+	// The v1 defaults, used when no weight is configured
+	defaultCPUShares = 1024
+	defaultIOWeight  = 500
+
+	MinCPUShares = 2
+	MaxCPUShares = 262144
+	MinIOWeight  = 10
+	MaxIOWeight  = 1000
+)
+
+// unifiedWeight converts a v1 weight in [min, max] to a weight in the
+// [1, 10000] range that the unified hierarchy uses for both CPU and IO.
+func unifiedWeight(weight int, min int, max int) int {
+	return 1 + ((weight-min)*9999)/(max-min)
+}
+
+// SetCPUShares sets the CPU weight of the cgroup relative to its siblings,
+// which only matters when they compete for CPU. Unlike the quota set by
+// SetCPU, a cgroup may use idle CPUs beyond its share. A value of 0 restores
+// the default weight.
+func (subsys Subsystems) SetCPUShares(name CgroupID, shares int) error {
+	if subsys.CPU == "" {
+		return UnsupportedError("cpu")
+	}
+	if shares == 0 {
+		shares = defaultCPUShares
+	}
+
+	err := os.MkdirAll(filepath.Join(subsys.CPU, name.String()), 0755)
+	if err != nil && !os.IsExist(err) {
+		return err
+	}
+	if subsys.Unified {
+		_, err = util.WriteIfChanged(
+			filepath.Join(subsys.CPU, name.String(), "cpu.weight"),
+			[]byte(strconv.Itoa(unifiedWeight(shares, MinCPUShares, MaxCPUShares))+"\n"),
+			0,
+		)
+		return err
+	}
+	_, err = util.WriteIfChanged(
+		filepath.Join(subsys.CPU, name.String(), "cpu.shares"),
+		[]byte(strconv.Itoa(shares)+"\n"),
+		0,
+	)
+	return err
+}
+
+// SetPids limits how many processes and threads the cgroup may run at once.
+// A sentinel value of 0 removes the limit.
+func (subsys Subsystems) SetPids(name CgroupID, pids int) error {
+	if subsys.Pids == "" {
+		return UnsupportedError("pids")
+	}
+
+	err := os.MkdirAll(filepath.Join(subsys.Pids, name.String()), 0755)
+	if err != nil && !os.IsExist(err) {
+		return err
+	}
+
+	maxPath := filepath.Join(subsys.Pids, name.String(), "pids.max")
+	max := "max"
+	if pids > 0 {
+		max = strconv.Itoa(pids)
+		if subsys.Unified {
+			err = subsys.enableUnifiedControllers(name, "+pids\n")
+			if err != nil {
+				return err
+			}
+		}
+	} else if _, err := os.Stat(maxPath); os.IsNotExist(err) {
+		// e.g. the controller isn't enabled in the unified hierarchy
+		return nil
+	}
+	_, err = util.WriteIfChanged(maxPath, []byte(max+"\n"), 0)
+	return err
+}
+
+// SetIOWeight sets the block IO weight of the cgroup relative to its siblings,
+// from MinIOWeight to MaxIOWeight. A value of 0 restores the default weight if
+// the host's IO scheduler supports weights at all.
+func (subsys Subsystems) SetIOWeight(name CgroupID, weight int) error {
+	if subsys.Blkio == "" {
+		return UnsupportedError("blkio")
+	}
+
+	err := os.MkdirAll(filepath.Join(subsys.Blkio, name.String()), 0755)
+	if err != nil && !os.IsExist(err) {
+		return err
+	}
+
+	reset := weight == 0
+	if reset {
+		weight = defaultIOWeight
+	}
+	weightFile := "blkio.weight"
+	value := strconv.Itoa(weight)
+	if subsys.Unified {
+		weightFile = "io.weight"
+		value = "default " + strconv.Itoa(unifiedWeight(weight, MinIOWeight, MaxIOWeight))
+	}
+	weightPath := filepath.Join(subsys.Blkio, name.String(), weightFile)
+	if reset {
+		if _, err := os.Stat(weightPath); os.IsNotExist(err) {
+			return nil
+		}
+	} else if subsys.Unified {
+		err = subsys.enableUnifiedControllers(name, "+io\n")
+		if err != nil {
+			return err
+		}
+	}
+	_, err = util.WriteIfChanged(weightPath, []byte(value+"\n"), 0)
+	return err
+}
@@ -3,6 +3,7 @@ package cgroups
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 )
@@ -18,15 +19,30 @@ func (ps *ProcSubsystemer) Find() (Subsystems, error) {
 	if ps.CachedSubsystems != nil {
 		return *ps.CachedSubsystems, nil
 	}
-	// For details about how this file is structured, refer to `man proc` or
-	// https://www.kernel.org/doc/Documentation/filesystems/proc.txt section 3.5
 	mountInfo, err := os.Open("/proc/self/mountinfo")
 	if err != nil {
 		return Subsystems{}, err
 	}
 	defer mountInfo.Close()
 
+	ret, err := parseMountInfo(mountInfo)
+	if err != nil {
+		return Subsystems{}, err
+	}
+	ps.CachedSubsystems = &ret
+
+	return ret, nil
+}
+
+// parseMountInfo finds the cgroup mountpoints in the contents of
+// /proc/self/mountinfo. The unified (v2) hierarchy is only used if the cpu
+// and memory controllers aren't mounted as v1 hierarchies, since hosts in
+// "hybrid" mode mount an unified hierarchy without any controllers.
+func parseMountInfo(mountInfo io.Reader) (Subsystems, error) {
+	// For details about how this file is structured, refer to `man proc` or
+	// https://www.kernel.org/doc/Documentation/filesystems/proc.txt section 3.5
 	var ret Subsystems
+	unified := ""
 	scanner := bufio.NewScanner(mountInfo)
 	for scanner.Scan() {
 		lineSegs := strings.Fields(scanner.Text())
@@ -38,6 +54,10 @@ func (ps *ProcSubsystemer) Find() (Subsystems, error) {
 		fsType := lineSegs[nSegs-3]
 		superOptions := strings.Split(lineSegs[nSegs-1], ",")
 
+		if fsType == "cgroup2" {
+			unified = mountPoint
+			continue
+		}
 		if fsType != "cgroup" {
 			// filesystem type is not "cgroup", skip
 			continue
@@ -49,10 +69,23 @@ func (ps *ProcSubsystemer) Find() (Subsystems, error) {
 				ret.CPU = mountPoint
 			case "memory":
 				ret.Memory = mountPoint
+			case "pids":
+				ret.Pids = mountPoint
+			case "blkio":
+				ret.Blkio = mountPoint
 			}
 		}
 	}
-	ps.CachedSubsystems = &ret
+	if err := scanner.Err(); err != nil {
+		return Subsystems{}, err
+	}
 
+	if ret.CPU == "" && ret.Memory == "" && unified != "" {
+		ret.CPU = unified
+		ret.Memory = unified
+		ret.Pids = unified
+		ret.Blkio = unified
+		ret.Unified = true
+	}
 	return ret, nil
 }
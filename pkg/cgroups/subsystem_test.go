@@ -0,0 +1,43 @@
+package cgroups
+
+import (
+	"strings"
+	"testing"
+)
+
+const v1MountInfo = `22 28 0:20 / /sys rw,nosuid,nodev,noexec,relatime shared:7 - sysfs sysfs rw
+25 22 0:23 / /sys/fs/cgroup ro,nosuid,nodev,noexec shared:8 - tmpfs tmpfs ro,mode=755
+26 25 0:24 / /sys/fs/cgroup/unified rw,nosuid,nodev,noexec,relatime shared:9 - cgroup2 cgroup2 rw
+30 25 0:28 / /sys/fs/cgroup/cpu,cpuacct rw,nosuid,nodev,noexec,relatime shared:13 - cgroup cgroup rw,cpu,cpuacct
+31 25 0:29 / /sys/fs/cgroup/memory rw,nosuid,nodev,noexec,relatime shared:14 - cgroup cgroup rw,memory
+`
+
+const v2MountInfo = `22 28 0:20 / /sys rw,nosuid,nodev,noexec,relatime shared:7 - sysfs sysfs rw
+25 22 0:23 / /sys/fs/cgroup rw,nosuid,nodev,noexec,relatime shared:8 - cgroup2 cgroup2 rw,nsdelegate,memory_recursiveprot
+`
+
+func TestParseMountInfoV1(t *testing.T) {
+	subsys, err := parseMountInfo(strings.NewReader(v1MountInfo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subsys.Unified {
+		t.Error("expected a hybrid host with v1 controllers not to use the unified hierarchy")
+	}
+	if subsys.CPU != "/sys/fs/cgroup/cpu,cpuacct" || subsys.Memory != "/sys/fs/cgroup/memory" {
+		t.Errorf("unexpected subsystems %+v", subsys)
+	}
+}
+
+func TestParseMountInfoV2(t *testing.T) {
+	subsys, err := parseMountInfo(strings.NewReader(v2MountInfo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !subsys.Unified {
+		t.Error("expected a v2-only host to use the unified hierarchy")
+	}
+	if subsys.CPU != "/sys/fs/cgroup" || subsys.Memory != "/sys/fs/cgroup" {
+		t.Errorf("unexpected subsystems %+v", subsys)
+	}
+}
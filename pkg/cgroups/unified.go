@@ -0,0 +1,87 @@
+package cgroups
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/square/p2/pkg/util"
+)
+
+// In the unified hierarchy a cgroup only has the files of the controllers
+// that its parent enables in cgroup.subtree_control.
+const unifiedControllers = "+cpu +memory\n"
+
+// enableUnifiedControllers enables controllers, e.g. "+cpu +memory\n", for the
+// cgroup by enabling them in every cgroup above it.
+func (subsys Subsystems) enableUnifiedControllers(name CgroupID, controllers string) error {
+	parent := subsys.CPU
+	for _, dir := range splitCgroupID(name) {
+		err := ioutil.WriteFile(filepath.Join(parent, "cgroup.subtree_control"), []byte(controllers), 0644)
+		if err != nil {
+			return util.Errorf("Could not enable the %s controllers in %s: %s", strings.TrimSpace(controllers), parent, err)
+		}
+		parent = filepath.Join(parent, dir)
+	}
+	return nil
+}
+
+// splitCgroupID returns the names of the cgroup and the cgroups above it, from
+// the top of the hierarchy down, e.g. [p2 node pod] for "/p2/node/pod".
+func splitCgroupID(name CgroupID) []string {
+	var dirs []string
+	for dir := filepath.Clean("/" + name.String()); dir != "/"; dir = filepath.Dir(dir) {
+		dirs = append([]string{filepath.Base(dir)}, dirs...)
+	}
+	return dirs
+}
+
+// setUnifiedCPU is SetCPU for the unified hierarchy, where the quota and
+// period are both written to cpu.max.
+// https://www.kernel.org/doc/Documentation/admin-guide/cgroup-v2.rst
+func (subsys Subsystems) setUnifiedCPU(name CgroupID, quota int, period int) error {
+	err := subsys.enableUnifiedControllers(name, unifiedControllers)
+	if err != nil {
+		return err
+	}
+
+	max := "max"
+	if quota >= 0 {
+		max = strconv.Itoa(quota)
+	}
+	_, err = util.WriteIfChanged(
+		filepath.Join(subsys.CPU, name.String(), "cpu.max"),
+		[]byte(max+" "+strconv.Itoa(period)+"\n"),
+		0,
+	)
+	return err
+}
+
+// setUnifiedMemory is SetMemory for the unified hierarchy. There is no
+// equivalent of the v1 soft limit, so only the hard limit is written to
+// memory.max. Like the v1 mem+swap limit, swap is disabled for limited cgroups
+// if swap accounting is enabled.
+func (subsys Subsystems) setUnifiedMemory(name CgroupID, hardLimit int) error {
+	err := subsys.enableUnifiedControllers(name, unifiedControllers)
+	if err != nil {
+		return err
+	}
+
+	max, swapMax := "max", "max"
+	if hardLimit >= 0 {
+		max, swapMax = strconv.Itoa(hardLimit), "0"
+	}
+	_, err = util.WriteIfChanged(filepath.Join(subsys.Memory, name.String(), "memory.max"), []byte(max+"\n"), 0600)
+	if err != nil {
+		return err
+	}
+
+	swapPath := filepath.Join(subsys.Memory, name.String(), "memory.swap.max")
+	if _, err := os.Stat(swapPath); os.IsNotExist(err) {
+		return nil
+	}
+	_, err = util.WriteIfChanged(swapPath, []byte(swapMax+"\n"), 0600)
+	return err
+}
@@ -0,0 +1,352 @@
+// Package docker implements support for launching services packaged as
+// container images. Images can be used by specifying "type: docker" in a
+// launchable's configuration in a pod manifest, with a location naming an
+// image pinned to a digest:
+//
+//	launchables:
+//	  web:
+//	    launchable_type: docker
+//	    location: registry.example.com/team/web@sha256:<hex>
+//
+// The preparer pulls the image with the docker client rather than downloading
+// an artifact, and runit supervises a `docker run` of it.
+package docker
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/square/p2/pkg/cgroups"
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/p2exec"
+	"github.com/square/p2/pkg/runit"
+	"github.com/square/p2/pkg/user"
+	"github.com/square/p2/pkg/util"
+	"github.com/square/p2/pkg/util/param"
+	"github.com/square/p2/pkg/util/size"
+)
+
+// The name of the file in the install directory that records the pulled image.
+const ImageFilename = "image"
+
+// DockerPath is the full path of the "docker" client binary.
+var DockerPath = param.String("docker_path", "/usr/bin/docker")
+
+// DockerConfigDir is the directory holding the docker client's config.json,
+// including the credentials used to pull from private registries. If empty,
+// the client's default (~/.docker of the preparer's user) is used.
+var DockerConfigDir = param.String("docker_config_dir", "")
+
+// Pod environment variables passed through to the container. Variables that
+// hold host paths, like CONFIG_PATH, are meaningless inside the container and
+// are left out. See the pods package.
+var podEnvVars = []string{"LAUNCHABLE_ID", "POD_ID", "POD_UNIQUE_KEY"}
+
+// Launchable represents an installation of a container image.
+type Launchable struct {
+	ID_             launch.LaunchableID   // A (pod-wise) unique identifier for this launchable, used to distinguish it from other launchables in the pod
+	ServiceID_      string                // A (host-wise) unique identifier for this launchable, used when creating runit services
+	Image           launch.ImageReference // The image to pull and run
+	RunAs           string                // The user to assume inside the container
+	OwnAs           string                // The user that owns the install directory
+	RootDir         string                // The root directory of the launchable, containing N:N>=1 installs.
+	P2Exec          string                // The path to p2-exec
+	RestartTimeout  time.Duration         // How long to wait when restarting the services in this launchable.
+	RestartPolicy_  runit.RestartPolicy   // Dictates whether the container should be automatically restarted upon exit.
+	RestartBackoff_ *runit.RestartBackoff // How restarts of the container are delayed, if not by the fixed sleep.
+	CgroupConfig    cgroups.Config        // Resource limits passed to docker, since the container doesn't run in p2-exec's cgroup
+	SuppliedEnvVars map[string]string     // User-supplied env variables
+	PodEnvDir       string                // The pod's environment directory, read by the docker client
+	ExecNoLimit     bool                  // If set, execute with the -n (--no-limit) argument to p2-exec
+}
+
+var _ launch.Launchable = &Launchable{}
+
+// ID implements the launch.Launchable interface. It returns the name of this launchable.
+func (l *Launchable) ID() launch.LaunchableID {
+	return l.ID_
+}
+
+func (l *Launchable) ServiceID() string {
+	return l.ServiceID_
+}
+
+func (l *Launchable) EnvVars() map[string]string {
+	return l.SuppliedEnvVars
+}
+
+// The version of an image launchable is derived from its digest.
+func (l *Launchable) Version() string {
+	return l.Image.Version().String()
+}
+
+func (*Launchable) Type() string {
+	return "docker"
+}
+
+func (l *Launchable) EnvDir() string {
+	return filepath.Join(l.RootDir, "env")
+}
+
+// InstallDir is the directory where this launchable should be installed.
+func (l *Launchable) InstallDir() string {
+	return filepath.Join(l.RootDir, "installs", l.Version())
+}
+
+// serviceName is used both for the runit service and the container, so that
+// a container left behind by a killed client can be found and removed.
+func (l *Launchable) serviceName() string {
+	return l.ServiceID_ + "__container"
+}
+
+// docker returns a command running the docker client with the configured
+// credentials.
+func docker(args ...string) *exec.Cmd {
+	return exec.Command(*DockerPath, dockerArgs(args...)...)
+}
+
+func dockerArgs(args ...string) []string {
+	var ret []string
+	if *DockerConfigDir != "" {
+		ret = append(ret, "--config", *DockerConfigDir)
+	}
+	return append(ret, args...)
+}
+
+// Pull installs the launchable. The image is pulled by digest, which the
+// docker client verifies, and the install directory records which image was
+// pulled.
+func (l *Launchable) Pull() error {
+	output, err := docker("pull", l.Image.String()).CombinedOutput()
+	if err != nil {
+		return util.Errorf("%s: could not pull %s: %s\n%s", l.ServiceID_, l.Image, err, output)
+	}
+
+	uid, gid, err := user.IDs(l.OwnAs)
+	if err != nil {
+		return util.Errorf("%s: unknown owner: %s", l.ServiceID_, l.OwnAs)
+	}
+	err = util.MkdirChownAll(l.InstallDir(), uid, gid, 0755)
+	if err != nil {
+		return util.Errorf("%s: could not create install directory: %s", l.ServiceID_, err)
+	}
+	imagePath := filepath.Join(l.InstallDir(), ImageFilename)
+	err = ioutil.WriteFile(imagePath, []byte(l.Image.String()+"\n"), 0644)
+	if err != nil {
+		return util.Errorf("%s: could not record the pulled image: %s", l.ServiceID_, err)
+	}
+	return os.Chown(imagePath, uid, gid)
+}
+
+// Installed returns true if this launchable's image has already been pulled.
+func (l *Launchable) Installed() bool {
+	_, err := os.Stat(filepath.Join(l.InstallDir(), ImageFilename))
+	return err == nil
+}
+
+// runArgs returns the docker client command line that runs the container in
+// the foreground, so that runit supervises it through the client.
+func (l *Launchable) runArgs(uid int, gid int) []string {
+	args := []string{
+		"run",
+		"--rm",
+		"--name", l.serviceName(),
+		"--user", fmt.Sprintf("%d:%d", uid, gid),
+	}
+	if l.CgroupConfig.CPUs > 0 {
+		args = append(args, "--cpus", strconv.Itoa(l.CgroupConfig.CPUs))
+	}
+	if l.CgroupConfig.Memory > 0 {
+		args = append(args, "--memory", fmt.Sprintf("%db", int64(l.CgroupConfig.Memory)))
+	}
+	if l.CgroupConfig.CPUShares > 0 {
+		args = append(args, "--cpu-shares", strconv.Itoa(l.CgroupConfig.CPUShares))
+	}
+	if l.CgroupConfig.Pids > 0 {
+		args = append(args, "--pids-limit", strconv.Itoa(l.CgroupConfig.Pids))
+	}
+	if l.CgroupConfig.IOWeight > 0 {
+		args = append(args, "--blkio-weight", strconv.Itoa(l.CgroupConfig.IOWeight))
+	}
+
+	// The values are read by the client from the env dirs given to
+	// p2-exec, so only the names appear on the command line
+	envNames := append([]string{}, podEnvVars...)
+	for name := range l.SuppliedEnvVars {
+		envNames = append(envNames, name)
+	}
+	sort.Strings(envNames)
+	for _, name := range envNames {
+		args = append(args, "--env", name)
+	}
+
+	args = append(args, l.Image.String())
+	return append([]string{*DockerPath}, dockerArgs(args...)...)
+}
+
+// Executables gets a list of the runit services that will be built for this launchable.
+func (l *Launchable) Executables(serviceBuilder runit.Builder) ([]launch.Executable, error) {
+	if !l.Installed() {
+		return []launch.Executable{}, util.Errorf("%s is not installed", l.ServiceID_)
+	}
+
+	uid, gid, err := user.IDs(l.RunAs)
+	if err != nil {
+		return nil, util.Errorf("%s: unknown runas user: %s", l.ServiceID_, l.RunAs)
+	}
+
+	serviceName := l.serviceName()
+	return []launch.Executable{{
+		Service: runit.Service{
+			Path: serviceBuilder.ServicePath(serviceName),
+			Name: serviceName,
+		},
+		Exec: append(
+			[]string{l.P2Exec},
+			p2exec.P2ExecArgs{
+				NoLimits: l.ExecNoLimit,
+				WorkDir:  l.InstallDir(),
+				EnvDirs:  []string{l.PodEnvDir, l.EnvDir()},
+				Command:  l.runArgs(uid, gid),
+			}.CommandLine()...,
+		),
+	}}, nil
+}
+
+func (l *Launchable) PostInstall() (string, error) {
+	return "", nil
+}
+
+// PostActive runs a Hoist-specific "post-activate" script in the launchable.
+func (l *Launchable) PostActivate() (string, error) {
+	// Not supported for images
+	return "", nil
+}
+
+func (l *Launchable) flipSymlink(newLinkPath string) error {
+	dir, err := ioutil.TempDir(l.RootDir, l.ServiceID_)
+	if err != nil {
+		return util.Errorf("Couldn't create temporary directory for symlink: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	tempLinkPath := filepath.Join(dir, l.ServiceID_)
+	err = os.Symlink(l.InstallDir(), tempLinkPath)
+	if err != nil {
+		return util.Errorf("Couldn't create symlink for docker launchable %s: %s", l.ServiceID_, err)
+	}
+
+	uid, gid, err := user.IDs(l.OwnAs)
+	if err != nil {
+		return util.Errorf("Couldn't retrieve UID/GID for docker launchable %s user %s: %s", l.ServiceID_, l.OwnAs, err)
+	}
+	err = os.Lchown(tempLinkPath, uid, gid)
+	if err != nil {
+		return util.Errorf("Couldn't lchown symlink for docker launchable %s: %s", l.ServiceID_, err)
+	}
+
+	return os.Rename(tempLinkPath, newLinkPath)
+}
+
+// MakeCurrent adjusts a "current" symlink for this launchable name to point to this
+// launchable's version.
+func (l *Launchable) MakeCurrent() error {
+	return l.flipSymlink(filepath.Join(l.RootDir, "current"))
+}
+
+func (l *Launchable) makeLast() error {
+	return l.flipSymlink(filepath.Join(l.RootDir, "last"))
+}
+
+// Launch allows the launchable to begin execution.
+func (l *Launchable) Launch(serviceBuilder runit.Builder, sv runit.SV) error {
+	err := l.start(serviceBuilder, sv)
+	if err != nil {
+		return launch.StartError{Inner: err}
+	}
+	// No "enable" for images
+	return nil
+}
+
+func (l *Launchable) start(serviceBuilder runit.Builder, sv runit.SV) error {
+	executables, err := l.Executables(serviceBuilder)
+	if err != nil {
+		return err
+	}
+
+	for _, executable := range executables {
+		var err error
+		if l.RestartPolicy_.Restarts() {
+			_, err = sv.Restart(&executable.Service, l.RestartTimeout)
+		} else {
+			_, err = sv.Once(&executable.Service)
+		}
+		if err != nil && err != runit.SuperviseOkMissing {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (l *Launchable) stop(serviceBuilder runit.Builder, sv runit.SV) error {
+	executables, err := l.Executables(serviceBuilder)
+	if err != nil {
+		return err
+	}
+
+	for _, executable := range executables {
+		_, err := sv.Stop(&executable.Service, l.RestartTimeout)
+		if err != nil {
+			// The client may be gone while the container, which
+			// belongs to the docker daemon, keeps running
+			output, err := docker("rm", "--force", l.serviceName()).CombinedOutput()
+			if err != nil {
+				return util.Errorf("%s: error stopping container: %s\n%s", l.ServiceID_, err, output)
+			}
+		}
+	}
+	return nil
+}
+
+func (l *Launchable) Disable() error {
+	// "disable" script not supported for images
+	return nil
+}
+
+// Halt causes the launchable to halt execution if it is running.
+func (l *Launchable) Stop(serviceBuilder runit.Builder, sv runit.SV, _ bool) error {
+	err := l.stop(serviceBuilder, sv)
+	if err != nil {
+		return launch.StopError{Inner: err}
+	}
+
+	return l.makeLast()
+}
+
+func (l *Launchable) Prune(max size.ByteCount) error {
+	// No-op for now
+	return nil
+}
+
+func (l *Launchable) RestartPolicy() runit.RestartPolicy {
+	return l.RestartPolicy_
+}
+
+func (l *Launchable) RestartBackoff() *runit.RestartBackoff {
+	return l.RestartBackoff_
+}
+
+// Sockets returns nil, passing sockets to containers isn't supported
+func (l *Launchable) Sockets() []string {
+	return nil
+}
+
+func (l *Launchable) GetRestartTimeout() time.Duration {
+	return l.RestartTimeout
+}
@@ -0,0 +1,104 @@
+package docker
+
+import (
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/square/p2/pkg/cgroups"
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/util/size"
+)
+
+var testImage = launch.ImageReference{
+	Name:   "registry.example.com/team/web",
+	Digest: "sha256:" + strings.Repeat("ab", 32),
+}
+
+func TestRunArgs(t *testing.T) {
+	oldConfigDir := *DockerConfigDir
+	defer func() { *DockerConfigDir = oldConfigDir }()
+	*DockerConfigDir = "/etc/p2/docker"
+
+	l := &Launchable{
+		ServiceID_:      "web__web",
+		Image:           testImage,
+		CgroupConfig:    cgroups.Config{CPUs: 2, Memory: 512 * size.Mebibyte, Pids: 100},
+		SuppliedEnvVars: map[string]string{"PORT": "8080"},
+	}
+	expected := []string{
+		*DockerPath, "--config", "/etc/p2/docker",
+		"run", "--rm", "--name", "web__web__container", "--user", "1234:1234",
+		"--cpus", "2", "--memory", "536870912b", "--pids-limit", "100",
+		"--env", "LAUNCHABLE_ID", "--env", "POD_ID", "--env", "POD_UNIQUE_KEY", "--env", "PORT",
+		testImage.String(),
+	}
+	args := l.runArgs(1234, 1234)
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected docker to be run with\n%v\ngot\n%v", expected, args)
+	}
+}
+
+func TestPull(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker_pull")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A fake client that records its arguments
+	argsPath := filepath.Join(dir, "args")
+	fakeDocker := filepath.Join(dir, "docker")
+	err = ioutil.WriteFile(fakeDocker, []byte("#!/bin/sh\necho \"$@\" > "+argsPath+"\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldDockerPath := *DockerPath
+	defer func() { *DockerPath = oldDockerPath }()
+	*DockerPath = fakeDocker
+
+	currentUser, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &Launchable{
+		ServiceID_: "web__web",
+		Image:      testImage,
+		OwnAs:      currentUser.Username,
+		RootDir:    filepath.Join(dir, "web"),
+	}
+	if l.Installed() {
+		t.Fatal("expected the image not to be installed before it is pulled")
+	}
+	err = l.Pull()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !l.Installed() {
+		t.Error("expected the image to be installed once it was pulled")
+	}
+	args, err := ioutil.ReadFile(argsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(args) != "pull "+testImage.String()+"\n" {
+		t.Errorf("expected the image to be pulled by digest, docker was run with %q", args)
+	}
+	if filepath.Base(l.InstallDir()) != "sha256_"+strings.Repeat("ab", 32) {
+		t.Errorf("expected the install directory to be named after the digest, got %s", l.InstallDir())
+	}
+
+	*DockerPath = "/bin/false"
+	l.Image.Digest = "sha256:" + strings.Repeat("cd", 32)
+	err = l.Pull()
+	if err == nil {
+		t.Error("expected an error when the pull fails")
+	}
+	if l.Installed() {
+		t.Error("expected an image that failed to pull not to be installed")
+	}
+}
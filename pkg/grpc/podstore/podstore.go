@@ -243,7 +243,7 @@ func (s store) MarkPodFailed(ctx context.Context, req *podstore_protos.MarkPodFa
 	}
 
 	mutator := func(podStatus podstatus.PodStatus) (podstatus.PodStatus, error) {
-		podStatus.PodStatus = podstatus.PodFailed
+		podStatus.SetState(podstatus.PodFailed, podStatus.LastError)
 		return podStatus, nil
 	}
 
@@ -0,0 +1,71 @@
+package gzip
+
+import (
+	"bytes"
+	"io"
+	"os"
+
+	"github.com/square/p2/pkg/util"
+)
+
+// Compression identifies how a tarball is compressed
+type Compression string
+
+const (
+	CompressionNone Compression = "none"
+	CompressionGzip Compression = "gzip"
+	CompressionXz   Compression = "xz"
+
+	// Extracting zstd tarballs requires the zstd binary
+	CompressionZstd Compression = "zstd"
+)
+
+// The magic numbers that begin each compressed format
+var compressionMagic = []struct {
+	compression Compression
+	magic       []byte
+}{
+	{CompressionGzip, []byte{0x1f, 0x8b}},
+	{CompressionXz, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+	{CompressionZstd, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+}
+
+// DetectCompression returns the compression of the tarball at filename. It is
+// detected from the file's contents rather than its name, which for a
+// downloaded artifact is a temporary file. Files that are not compressed in
+// a known format are assumed to be uncompressed tarballs.
+func DetectCompression(filename string) (Compression, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", util.Errorf("could not open %s to detect its compression: %s", filename, err)
+	}
+	defer file.Close()
+
+	header := make([]byte, 8)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", util.Errorf("could not read %s to detect its compression: %s", filename, err)
+	}
+	header = header[:n]
+
+	for _, format := range compressionMagic {
+		if bytes.HasPrefix(header, format.magic) {
+			return format.compression, nil
+		}
+	}
+	return CompressionNone, nil
+}
+
+// tarFlags returns the flags that make tar decompress the tarball
+func (c Compression) tarFlags() []string {
+	switch c {
+	case CompressionGzip:
+		return []string{"-z"}
+	case CompressionXz:
+		return []string{"-J"}
+	case CompressionZstd:
+		return []string{"--use-compress-program", "zstd"}
+	default:
+		return nil
+	}
+}
@@ -12,7 +12,21 @@ import (
 
 // ExtractTarGz extracts the specified tarball to the specified destination,
 // as the specified user.
-func ExtractTarGz(owner string, filename string, dest string) (err error) {
+func ExtractTarGz(owner string, filename string, dest string) error {
+	return extractTar(owner, filename, dest, CompressionGzip)
+}
+
+// ExtractTarball is ExtractTarGz for a tarball that may be compressed with
+// gzip, xz or zstd, or not compressed at all. See DetectCompression()
+func ExtractTarball(owner string, filename string, dest string) error {
+	compression, err := DetectCompression(filename)
+	if err != nil {
+		return err
+	}
+	return extractTar(owner, filename, dest, compression)
+}
+
+func extractTar(owner string, filename string, dest string, compression Compression) (err error) {
 	ownerUID, ownerGID, err := p2user.IDs(owner)
 	if err != nil {
 		return err
@@ -36,7 +50,8 @@ func ExtractTarGz(owner string, filename string, dest string) (err error) {
 	// this is default if extracting as non-root, but --same-owner is default if root.
 	// For run_as root apps, we DO want the files to end up owned by root,
 	// instead of an unknown user dictated by the build system that produced the artifact.
-	cmd := exec.Command("tar", "xpzf", filename, "--no-same-owner", "-C", dest)
+	args := append([]string{"-xp"}, compression.tarFlags()...)
+	cmd := exec.Command("tar", append(args, "-f", filename, "--no-same-owner", "-C", dest)...)
 	if currentUser.Username != owner {
 		// If we are running as a non-root user (e.g. in tests), don't change user.
 		// Non-root users are understandably not allowed to change to other users...
@@ -15,6 +15,12 @@ import (
 
 func testExtraction(t *testing.T, tarfile string,
 	check func(error, string),
+) {
+	testExtractionWith(t, ExtractTarGz, tarfile, check)
+}
+
+func testExtractionWith(t *testing.T, extract func(owner string, filename string, dest string) error, tarfile string,
+	check func(error, string),
 ) {
 	tarfile = path.Join("testdata", tarfile) // prefix with testdata so this is ignored by downstream dep management
 	tarPath := util.From(runtime.Caller(0)).ExpandPath(tarfile)
@@ -30,7 +36,7 @@ func testExtraction(t *testing.T, tarfile string,
 	user, err := user.Current()
 	Assert(t).IsNil(err, "expected no error getting current user")
 
-	err = ExtractTarGz(user.Username, tarPath, dest)
+	err = extract(user.Username, tarPath, dest)
 
 	check(err, dest)
 }
@@ -74,3 +80,39 @@ func TestEscapingSymlink(t *testing.T) {
 		Assert(t).IsTrue(os.IsNotExist(err), "expected extracted file not to exist")
 	})
 }
+
+func TestExtractTarballDetectsCompression(t *testing.T) {
+	for _, tarfile := range []string{"file_without_dir.tar.gz", "file_without_dir.tar.xz", "file_without_dir.tar"} {
+		testExtractionWith(t, ExtractTarball, tarfile, func(tarErr error, dest string) {
+			Assert(t).IsNil(tarErr, "expected no error extracting "+tarfile)
+
+			_, err := os.Stat(filepath.Join(dest, "a", "b"))
+			Assert(t).IsNil(err, "expected no error statting file extracted from "+tarfile)
+		})
+	}
+}
+
+func TestDetectCompression(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "gziptest")
+	Assert(t).IsNil(err, "expected no error creating tempdir")
+	defer os.RemoveAll(tmpdir)
+
+	zstdPath := filepath.Join(tmpdir, "artifact")
+	err = ioutil.WriteFile(zstdPath, []byte{0x28, 0xb5, 0x2f, 0xfd, 0x00}, 0644)
+	Assert(t).IsNil(err, "expected no error writing file")
+
+	compression, err := DetectCompression(zstdPath)
+	Assert(t).IsNil(err, "expected no error detecting compression")
+	Assert(t).AreEqual(compression, CompressionZstd, "expected zstd magic to be detected")
+
+	for tarfile, expected := range map[string]Compression{
+		"file_without_dir.tar.gz": CompressionGzip,
+		"file_without_dir.tar.xz": CompressionXz,
+		"file_without_dir.tar":    CompressionNone,
+	} {
+		tarPath := util.From(runtime.Caller(0)).ExpandPath(path.Join("testdata", tarfile))
+		compression, err = DetectCompression(tarPath)
+		Assert(t).IsNil(err, "expected no error detecting compression")
+		Assert(t).AreEqual(compression, expected, "unexpected compression detected for "+tarfile)
+	}
+}
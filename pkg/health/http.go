@@ -0,0 +1,82 @@
+package health
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/square/p2/pkg/util"
+)
+
+// HTTPHealthChecker checks the health of a service by issuing a GET request
+// against its status endpoint.
+type HTTPHealthChecker struct {
+	// The client used to make requests. http.DefaultClient is used if nil.
+	Client *http.Client
+
+	// The full URL of the status endpoint, e.g. http://localhost:8080/_status
+	URL string
+
+	// Headers added to every request, e.g. for services that require an
+	// Authorization header on their status endpoint.
+	CustomHeaders map[string]string
+
+	// The status codes that are considered healthy. Defaults to [200] if
+	// empty.
+	ExpectedStatusCodes []int
+
+	// If non-empty, the response body must contain this substring for the
+	// check to pass.
+	BodyContains string
+}
+
+// Check performs a single health check. A non-nil error is returned along with
+// Critical if the endpoint could not be reached or did not respond as expected.
+func (c HTTPHealthChecker) Check() (HealthState, error) {
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequest("GET", c.URL, nil)
+	if err != nil {
+		return Critical, util.Errorf("could not build health check request for %s: %s", c.URL, err)
+	}
+	for key, value := range c.CustomHeaders {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return Critical, util.Errorf("health check request to %s failed: %s", c.URL, err)
+	}
+	defer resp.Body.Close()
+
+	if !c.expectedStatusCode(resp.StatusCode) {
+		return Critical, util.Errorf("health check to %s returned unexpected status %s", c.URL, resp.Status)
+	}
+
+	if c.BodyContains != "" {
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return Critical, util.Errorf("could not read health check response from %s: %s", c.URL, err)
+		}
+		if !bytes.Contains(body, []byte(c.BodyContains)) {
+			return Critical, util.Errorf("health check response from %s did not contain %q", c.URL, c.BodyContains)
+		}
+	}
+
+	return Passing, nil
+}
+
+func (c HTTPHealthChecker) expectedStatusCode(code int) bool {
+	if len(c.ExpectedStatusCodes) == 0 {
+		return code == http.StatusOK
+	}
+	for _, expected := range c.ExpectedStatusCodes {
+		if code == expected {
+			return true
+		}
+	}
+	return false
+}
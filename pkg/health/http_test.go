@@ -0,0 +1,76 @@
+package health
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func authServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, "status: ok")
+	}))
+}
+
+func TestHTTPHealthCheckerCustomHeaders(t *testing.T) {
+	server := authServer()
+	defer server.Close()
+
+	checker := HTTPHealthChecker{
+		URL:           server.URL,
+		CustomHeaders: map[string]string{"Authorization": "Bearer test"},
+	}
+	state, err := checker.Check()
+	if err != nil {
+		t.Fatalf("expected check with auth header to succeed: %s", err)
+	}
+	if state != Passing {
+		t.Errorf("expected %s, got %s", Passing, state)
+	}
+
+	checker.CustomHeaders = nil
+	state, err = checker.Check()
+	if err == nil {
+		t.Fatal("expected check without auth header to fail")
+	}
+	if state != Critical {
+		t.Errorf("expected %s, got %s", Critical, state)
+	}
+}
+
+func TestHTTPHealthCheckerExpectedStatusCodes(t *testing.T) {
+	server := authServer()
+	defer server.Close()
+
+	checker := HTTPHealthChecker{
+		URL:                 server.URL,
+		ExpectedStatusCodes: []int{http.StatusOK, http.StatusUnauthorized},
+	}
+	if _, err := checker.Check(); err != nil {
+		t.Fatalf("expected 401 to be accepted: %s", err)
+	}
+}
+
+func TestHTTPHealthCheckerBodyContains(t *testing.T) {
+	server := authServer()
+	defer server.Close()
+
+	checker := HTTPHealthChecker{
+		URL:           server.URL,
+		CustomHeaders: map[string]string{"Authorization": "Bearer test"},
+		BodyContains:  "ok",
+	}
+	if _, err := checker.Check(); err != nil {
+		t.Fatalf("expected body match to succeed: %s", err)
+	}
+
+	checker.BodyContains = "degraded"
+	if _, err := checker.Check(); err == nil {
+		t.Fatal("expected body mismatch to fail the check")
+	}
+}
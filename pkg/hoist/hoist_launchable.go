@@ -57,6 +57,8 @@ type Launchable struct {
 	RequireFile      string                     // Do not run this launchable until this file exists
 	RestartTimeout   time.Duration              // How long to wait when restarting the services in this launchable.
 	RestartPolicy_   runit.RestartPolicy        // Dictates whether the launchable should be automatically restarted upon exit.
+	RestartBackoff_  *runit.RestartBackoff      // How restarts of the launchable are delayed, if not by the fixed sleep.
+	Sockets_         []string                   // Addresses of the sockets passed to the launchable by the supervisor.
 	NoHaltOnUpdate_  bool                       // If set, the launchable's process(es) should not be stopped if the pod is being updated (it will arrange for its own signaling)
 	SuppliedEnvVars  map[string]string          // A map of user-supplied environment variables to be exported for this launchable
 	Location         *url.URL                   // URL to download the artifact from
@@ -118,7 +120,7 @@ func (hl *Launchable) Disable() error {
 	return nil
 }
 
-func (hl *Launchable) Stop(serviceBuilder *runit.ServiceBuilder, sv runit.SV, force bool) error {
+func (hl *Launchable) Stop(serviceBuilder runit.Builder, sv runit.SV, force bool) error {
 	if hl.NoHaltOnUpdate_ && !force {
 		return nil
 	}
@@ -138,7 +140,7 @@ func (hl *Launchable) Stop(serviceBuilder *runit.ServiceBuilder, sv runit.SV, fo
 	return nil
 }
 
-func (hl *Launchable) Launch(serviceBuilder *runit.ServiceBuilder, sv runit.SV) error {
+func (hl *Launchable) Launch(serviceBuilder runit.Builder, sv runit.SV) error {
 	startErr := hl.start(serviceBuilder, sv)
 	if startErr != nil && !IsMissingEntryPoints(startErr) {
 		return launch.StartError{Inner: startErr}
@@ -237,7 +239,7 @@ func (hl *Launchable) InvokeBinScript(script string) (string, error) {
 	return buffer.String(), nil
 }
 
-func (hl *Launchable) stop(serviceBuilder *runit.ServiceBuilder, sv runit.SV) error {
+func (hl *Launchable) stop(serviceBuilder runit.Builder, sv runit.SV) error {
 	executables, err := hl.Executables(serviceBuilder)
 	if err != nil {
 		return err
@@ -257,7 +259,7 @@ func (hl *Launchable) stop(serviceBuilder *runit.ServiceBuilder, sv runit.SV) er
 
 // Start will take a launchable and start every runit service associated with the launchable.
 // All services will attempt to be started.
-func (hl *Launchable) start(serviceBuilder *runit.ServiceBuilder, sv runit.SV) error {
+func (hl *Launchable) start(serviceBuilder runit.Builder, sv runit.SV) error {
 	executables, err := hl.Executables(serviceBuilder)
 	if err != nil {
 		return err
@@ -265,7 +267,7 @@ func (hl *Launchable) start(serviceBuilder *runit.ServiceBuilder, sv runit.SV) e
 
 	for _, executable := range executables {
 		var err error
-		if hl.RestartPolicy_ == runit.RestartPolicyAlways {
+		if hl.RestartPolicy_.Restarts() {
 			// TODO: can we use start always?
 			if hl.NoHaltOnUpdate_ {
 				_, err = sv.Start(&executable.Service)
@@ -315,7 +317,7 @@ func IsMissingEntryPoints(err error) bool {
 // slashes exchanged for double underscores):
 // /var/service/some-pod-<uuid>__some-launchable__bin__launch/
 func (hl *Launchable) Executables(
-	serviceBuilder *runit.ServiceBuilder,
+	serviceBuilder runit.Builder,
 ) ([]launch.Executable, error) {
 	if !hl.Installed() {
 		return []launch.Executable{}, util.Errorf("%s is not installed", hl.ServiceId)
@@ -401,11 +403,11 @@ func (hl *Launchable) Executables(
 				ServiceName:  entryPointName,
 				RelativePath: relativePath,
 				Service: runit.Service{
-					Path: filepath.Join(serviceBuilder.RunitRoot, serviceName),
+					Path: serviceBuilder.ServicePath(serviceName),
 					Name: serviceName,
 				},
 				LogAgent: runit.Service{
-					Path: filepath.Join(serviceBuilder.RunitRoot, serviceName, "log"),
+					Path: filepath.Join(serviceBuilder.ServicePath(serviceName), "log"),
 					Name: serviceName + " logAgent",
 				},
 				Exec: execCmd,
@@ -434,7 +436,7 @@ func (hl *Launchable) PostInstall() (string, error) {
 // The version of the artifact is determined from the artifact location. If the
 // version tag is set in the location's query, that is returned. Otherwise, the
 // version is derived from the location, using the naming scheme
-// <the-app>_<unique-version-string>.tar.gz
+// <the-app>_<unique-version-string>.tar.gz (or .tar.xz, .tar.zst or .tar)
 func (hl *Launchable) Name() string {
 	name := hl.Id.String()
 	if hl.Version != "" {
@@ -531,6 +533,14 @@ func (hl *Launchable) RestartPolicy() runit.RestartPolicy {
 	return hl.RestartPolicy_
 }
 
+func (hl *Launchable) RestartBackoff() *runit.RestartBackoff {
+	return hl.RestartBackoff_
+}
+
+func (hl *Launchable) Sockets() []string {
+	return hl.Sockets_
+}
+
 func (hl *Launchable) GetRestartTimeout() time.Duration {
 	return hl.RestartTimeout
 }
@@ -69,7 +69,11 @@ func AddKVPToMap(result consul.ManifestResult, source int, filterNode types.Node
 			return fmt.Errorf("Two intent manifests for node %s pod %s", nodeName, podId)
 		}
 		old.IntentManifestSHA = manifestSHA
-		for launchableID, launchable := range result.Manifest.GetLaunchableStanzas() {
+		for _, launchableID := range result.Manifest.LaunchableIDs() {
+			launchable, err := result.Manifest.LaunchableByID(launchableID)
+			if err != nil {
+				return err
+			}
 			var version launch.LaunchableVersion
 			if launchable.Version.ID != "" {
 				version = launchable.Version
@@ -87,7 +91,11 @@ func AddKVPToMap(result consul.ManifestResult, source int, filterNode types.Node
 			return fmt.Errorf("Two reality manifests for node %s pod %s", nodeName, podId)
 		}
 		old.RealityManifestSHA = manifestSHA
-		for launchableID, launchable := range result.Manifest.GetLaunchableStanzas() {
+		for _, launchableID := range result.Manifest.LaunchableIDs() {
+			launchable, err := result.Manifest.LaunchableByID(launchableID)
+			if err != nil {
+				return err
+			}
 			var version launch.LaunchableVersion
 
 			if launchable.Version.ID != "" {
@@ -3,8 +3,10 @@ package launch
 import (
 	"fmt"
 	"io"
+	"net/url"
 	"path"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
@@ -24,6 +26,16 @@ type LaunchableID string
 
 func (l LaunchableID) String() string { return string(l) }
 
+// Implements sort.Interface to make a list of launchable ids sortable
+// lexicographically
+type LaunchableIDs []LaunchableID
+
+var _ sort.Interface = make(LaunchableIDs, 0)
+
+func (ids LaunchableIDs) Len() int           { return len(ids) }
+func (ids LaunchableIDs) Less(i, j int) bool { return ids[i] < ids[j] }
+func (ids LaunchableIDs) Swap(i, j int)      { ids[i], ids[j] = ids[j], ids[i] }
+
 type LaunchableVersionID string
 
 func (l LaunchableVersionID) String() string { return string(l) }
@@ -45,10 +57,20 @@ type LaunchableStanza struct {
 	Env                     map[string]string `yaml:"env,omitempty"`
 
 	// Indicates whether the processes started for the launchable should be
-	// restarted when they terminate.  When unspecified, the default is
-	// "always".
+	// restarted when they terminate: "always", "on-failure" or "never".
+	// When unspecified, the default is "always".
 	RestartPolicy_ runit.RestartPolicy `yaml:"restart_policy,omitempty"`
 
+	// If set, restarts of the launchable's processes are delayed
+	// exponentially rather than by a fixed couple of seconds
+	RestartBackoff *runit.RestartBackoff `yaml:"restart_backoff,omitempty"`
+
+	// Addresses, e.g. "8080" or "/run/app.sock", that the supervisor
+	// listens on and passes to the launchable's process when it starts
+	// (socket activation). Only launchables of type "hoist" with a single
+	// entry point make use of this field, under the systemd supervisor
+	Sockets []string `yaml:"sockets,omitempty"`
+
 	// NoHaltOnUpdate instructs the preparer to skip stopping the
 	// launchable's processes when it is being updated. This is useful for
 	// processes that are designed to be updated via binary overwrite and
@@ -66,23 +88,141 @@ type LaunchableStanza struct {
 	EntryPoints []string `yaml:"entry_points,omitempty"`
 
 	// The URL from which the launchable can be downloaded. May not be used
-	// in conjunction with Version
+	// in conjunction with Version. For launchables of type "docker" this is
+	// an image pinned to a digest instead, see ImageReference()
 	Location string `yaml:"location,omitempty"`
 
 	// An alternative to using Location to inform artifact downloading. Version information
 	// can be used to query a configured artifact registry which will provide the artifact
 	// URL. Version may not be used in conjunction with Location
 	Version LaunchableVersion `yaml:"version,omitempty"`
+
+	// If set, the hex-encoded SHA-256 Merkle tree checksum that the
+	// launchable's install directory must match after the artifact is
+	// unpacked. See pods.DirChecksum()
+	ExpectedDirChecksum string `yaml:"expected_dir_checksum,omitempty"`
+
+	// If set, the hex-encoded SHA-256 digest of the artifact and a detached
+	// (optionally armored) signature of that digest. These are used by the
+	// "embedded" artifact verification type in place of fetching a build
+	// manifest and signature from the artifact server
+	ArtifactDigest    string `yaml:"artifact_digest,omitempty"`
+	ArtifactSignature string `yaml:"artifact_signature,omitempty"`
 }
 
 func (l LaunchableStanza) LaunchableVersion() (LaunchableVersionID, error) {
 	if l.Version.ID != "" {
 		return l.Version.ID, nil
 	}
+	if l.LaunchableType == "docker" {
+		image, err := l.ImageReference()
+		if err != nil {
+			return "", err
+		}
+		return image.Version(), nil
+	}
 
 	return versionFromLocation(l.Location)
 }
 
+// The schemes that launchable locations may use. A location without a scheme
+// is a path to a local file. See uri.Fetcher
+var SupportedArtifactSchemes = []string{"", "file", "http", "https", "data", "az", "s3"}
+
+// ArtifactURL parses and validates the stanza's location. The scheme is
+// lowercased and trailing slashes are removed from the path, since a location
+// always names a single artifact.
+func (l LaunchableStanza) ArtifactURL() (*url.URL, error) {
+	if l.Location == "" {
+		return nil, util.Errorf("Launchable has no location")
+	}
+	u, err := url.Parse(l.Location)
+	if err != nil {
+		return nil, util.Errorf("Couldn't parse launchable url '%s': %s", l.Location, err)
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	if len(u.Path) > 1 {
+		u.Path = strings.TrimRight(u.Path, "/")
+		if u.Path == "" {
+			u.Path = "/"
+		}
+		u.RawPath = ""
+	}
+
+	supported := false
+	for _, scheme := range SupportedArtifactSchemes {
+		if u.Scheme == scheme {
+			supported = true
+			break
+		}
+	}
+	if !supported {
+		return nil, util.Errorf("Launchable url '%s' has unsupported scheme %q, expected one of %s", l.Location, u.Scheme, strings.Join(SupportedArtifactSchemes[1:], ", "))
+	}
+
+	switch u.Scheme {
+	case "http", "https", "az", "s3":
+		if u.Host == "" {
+			return nil, util.Errorf("Launchable url '%s' has no host", l.Location)
+		}
+		if u.Path == "" || u.Path == "/" {
+			return nil, util.Errorf("Launchable url '%s' has no path", l.Location)
+		}
+	case "file":
+		// The host is ignored when fetching, so file://relative/path
+		// would silently read /path
+		if u.Host != "" && u.Host != "localhost" {
+			return nil, util.Errorf("Launchable url '%s' must be on the local host", l.Location)
+		}
+		if !path.IsAbs(u.Path) {
+			return nil, util.Errorf("Launchable url '%s' must use an absolute path", l.Location)
+		}
+	case "data":
+		if u.Opaque == "" {
+			return nil, util.Errorf("Launchable url '%s' has no data", l.Location)
+		}
+	case "":
+		if u.Path == "" {
+			return nil, util.Errorf("Launchable url '%s' has no path", l.Location)
+		}
+	}
+	return u, nil
+}
+
+// ImageReference is a container image pinned to a content digest, e.g.
+// registry.example.com/team/app@sha256:<hex>. Pinning takes the place of
+// artifact verification for image launchables: the container runtime refuses
+// to pull an image whose content doesn't match its digest.
+type ImageReference struct {
+	Name   string // The repository, optionally with a registry host and tag
+	Digest string // e.g. "sha256:<hex>"
+}
+
+func (i ImageReference) String() string { return i.Name + "@" + i.Digest }
+
+// Version identifies the installed image by its digest, since image names
+// carry no version.
+func (i ImageReference) Version() LaunchableVersionID {
+	return LaunchableVersionID(strings.Replace(i.Digest, ":", "_", 1))
+}
+
+var imageReferenceRegex = regexp.MustCompile(`^([a-z0-9][a-zA-Z0-9._:-]*(?:/[a-zA-Z0-9._:-]+)*)@(sha256:[a-f0-9]{64})$`)
+
+// ImageReference parses the stanza's location as an image reference for
+// launchables of type "docker". Images must be pinned to a digest; a tag
+// alone could be moved to different content after the manifest was signed.
+func (l LaunchableStanza) ImageReference() (ImageReference, error) {
+	if l.Location == "" {
+		return ImageReference{}, util.Errorf("Launchable has no location")
+	}
+	matches := imageReferenceRegex.FindStringSubmatch(l.Location)
+	if matches == nil {
+		return ImageReference{}, util.Errorf("Launchable image '%s' must be a repository pinned to a digest, e.g. registry.example.com/app@sha256:<hex>", l.Location)
+	}
+	return ImageReference{Name: matches[1], Digest: matches[2]}, nil
+}
+
 func (l LaunchableStanza) RestartPolicy() runit.RestartPolicy {
 	if l.RestartPolicy_ == "" {
 		return runit.DefaultRestartPolicy
@@ -95,9 +235,10 @@ func (l LaunchableStanza) RestartPolicy() runit.RestartPolicy {
 // /<launchable_id>_<version>.tar.gz, which is intended to be phased out in
 // favor of explicit launchable versions specified in pod manifests.
 // The version expected to be a 40 character hexadecimal string with an
-// optional hexadecimal suffix after a hyphen
+// optional hexadecimal suffix after a hyphen. Artifacts may also be
+// .tar.xz, .tar.zst or uncompressed .tar files.
 
-var locationBaseRegex = regexp.MustCompile(`^[a-z0-9-_]+_([a-f0-9]{40}(\-[a-z0-9]+)?)\.tar\.gz$`)
+var locationBaseRegex = regexp.MustCompile(`^[a-z0-9-_]+_([a-f0-9]{40}(\-[a-z0-9]+)?)\.tar(\.gz|\.xz|\.zst)?$`)
 
 func versionFromLocation(location string) (LaunchableVersionID, error) {
 	filename := path.Base(location)
@@ -146,7 +287,7 @@ type Launchable interface {
 	// will be expressed as files
 	EnvDir() string
 	// Executables gets a list of the commands that are part of this launchable.
-	Executables(serviceBuilder *runit.ServiceBuilder) ([]Executable, error)
+	Executables(serviceBuilder runit.Builder) ([]Executable, error)
 	// Installed returns true if this launchable is already installed.
 	Installed() bool
 	// Executes any necessary post-install steps to ready the launchable for launch
@@ -155,11 +296,11 @@ type Launchable interface {
 	// PostActive runs a Hoist-specific "post-activate" script in the launchable.
 	PostActivate() (string, error)
 	// Launch begins execution.
-	Launch(serviceBuilder *runit.ServiceBuilder, sv runit.SV) error
+	Launch(serviceBuilder runit.Builder, sv runit.SV) error
 	// Disable allows a launchable to stop work and do cleanup prior to Stop
 	Disable() error
 	// Stop stops execution.
-	Stop(serviceBuilder *runit.ServiceBuilder, sv runit.SV, force bool) error
+	Stop(serviceBuilder runit.Builder, sv runit.SV, force bool) error
 	// MakeCurrent adjusts a "current" symlink for this launchable name to point to this
 	// launchable's version.
 	MakeCurrent() error
@@ -175,6 +316,13 @@ type Launchable interface {
 	EnvVars() map[string]string
 
 	RestartPolicy() runit.RestartPolicy
+
+	// RestartBackoff returns the RestartBackoff, or nil for the fixed delay
+	RestartBackoff() *runit.RestartBackoff
+
+	// Sockets returns the addresses the launchable's process is passed
+	// listening sockets for, if any
+	Sockets() []string
 }
 
 // Executable describes a command and its arguments that should be executed to start a
@@ -1,6 +1,7 @@
 package launch
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -27,6 +28,26 @@ func TestVersionFromLocation(t *testing.T) {
 			ExpectedVersion: "3c021aff048ca8117593f9c71e03b87cf72fd440-suffix",
 			ExpectError:     false,
 		},
+		{
+			Location:        "/download/test-launchable_3c021aff048ca8117593f9c71e03b87cf72fd440.tar.zst",
+			ExpectedVersion: "3c021aff048ca8117593f9c71e03b87cf72fd440",
+			ExpectError:     false,
+		},
+		{
+			Location:        "/download/test-launchable_3c021aff048ca8117593f9c71e03b87cf72fd440.tar.xz",
+			ExpectedVersion: "3c021aff048ca8117593f9c71e03b87cf72fd440",
+			ExpectError:     false,
+		},
+		{
+			Location:        "/download/test-launchable_3c021aff048ca8117593f9c71e03b87cf72fd440.tar",
+			ExpectedVersion: "3c021aff048ca8117593f9c71e03b87cf72fd440",
+			ExpectError:     false,
+		},
+		{
+			Location:        "/download/test-launchable_3c021aff048ca8117593f9c71e03b87cf72fd440.tar.bz2",
+			ExpectedVersion: "",
+			ExpectError:     true,
+		},
 		{
 			Location:        "/download/afb1.2.00.tar.gz",
 			ExpectedVersion: "",
@@ -54,3 +75,86 @@ func TestVersionFromLocation(t *testing.T) {
 		}
 	}
 }
+
+func TestArtifactURL(t *testing.T) {
+	for _, test := range []struct {
+		location string
+		expected string
+	}{
+		{"https://localhost:4444/foo/bar_abc123.tar.gz", "https://localhost:4444/foo/bar_abc123.tar.gz"},
+		{"HTTP://localhost/bar_abc123.tar.gz", "http://localhost/bar_abc123.tar.gz"},
+		{"https://localhost/foo/bar_abc123.tar.gz//", "https://localhost/foo/bar_abc123.tar.gz"},
+		{"file:///download/bar_abc123.tar.gz", "file:///download/bar_abc123.tar.gz"},
+		{"data:application/octet-stream;base64,aGVsbG8=", "data:application/octet-stream;base64,aGVsbG8="},
+		{"az://artifacts/bar_abc123.tar.gz", "az://artifacts/bar_abc123.tar.gz"},
+		{"s3://artifacts/bar_abc123.tar.gz", "s3://artifacts/bar_abc123.tar.gz"},
+		{"/download/bar_abc123.tar.gz", "/download/bar_abc123.tar.gz"},
+		{"bar_abc123.tar.gz", "bar_abc123.tar.gz"},
+	} {
+		u, err := LaunchableStanza{Location: test.location}.ArtifactURL()
+		if err != nil {
+			t.Errorf("unexpected error for %q: %s", test.location, err)
+			continue
+		}
+		if u.String() != test.expected {
+			t.Errorf("expected %q to normalize to %q, got %q", test.location, test.expected, u.String())
+		}
+	}
+
+	for _, location := range []string{
+		"",
+		"ftp://localhost/bar_abc123.tar.gz",
+		"https://localhost:4444/%zz.tar.gz",
+		"https:///bar_abc123.tar.gz",
+		"https://localhost",
+		"https://localhost/",
+		"file://relative/bar_abc123.tar.gz",
+		"data:",
+		"az://artifacts",
+		"s3://artifacts",
+	} {
+		_, err := LaunchableStanza{Location: location}.ArtifactURL()
+		if err == nil {
+			t.Errorf("expected an error for %q", location)
+		}
+	}
+}
+
+func TestImageReference(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("ab", 32)
+	for _, location := range []string{
+		"hello@" + digest,
+		"registry.example.com:5000/team/hello@" + digest,
+		"registry.example.com/team/hello:v1@" + digest,
+	} {
+		stanza := LaunchableStanza{LaunchableType: "docker", Location: location}
+		image, err := stanza.ImageReference()
+		if err != nil {
+			t.Errorf("unexpected error for %q: %s", location, err)
+			continue
+		}
+		if image.String() != location || image.Digest != digest {
+			t.Errorf("expected %q to round trip with digest %s, got %+v", location, digest, image)
+		}
+		version, err := stanza.LaunchableVersion()
+		if err != nil {
+			t.Errorf("unexpected error parsing the version of %q: %s", location, err)
+		}
+		if version != LaunchableVersionID("sha256_"+strings.Repeat("ab", 32)) {
+			t.Errorf("expected the version of %q to be its digest, got %s", location, version)
+		}
+	}
+
+	for _, location := range []string{
+		"",
+		"registry.example.com/team/hello",
+		"registry.example.com/team/hello:latest",
+		"registry.example.com/team/hello@sha256:abc123",
+		"https://registry.example.com/team/hello@" + digest,
+	} {
+		_, err := LaunchableStanza{LaunchableType: "docker", Location: location}.ImageReference()
+		if err == nil {
+			t.Errorf("expected an error for unpinned or malformed image %q", location)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+// Package lint checks pod manifests for settings that are valid but likely
+// to be mistakes, such as running as root or disabling artifact verification.
+package lint
+
+import (
+	"sync"
+
+	"github.com/square/p2/pkg/manifest"
+)
+
+type Severity string
+
+const (
+	SeverityWarning Severity = "warning"
+	SeverityError   Severity = "error"
+)
+
+// Violation is a single problem a Linter found in a manifest
+type Violation struct {
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+}
+
+// Linter is a single lint rule
+type Linter interface {
+	// The name of the rule, reported with each of its violations
+	Name() string
+	Lint(m manifest.Manifest) []Violation
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []Linter
+)
+
+// Register adds a rule to those returned by Linters(). The built in rules are
+// registered by this package.
+func Register(l Linter) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, l)
+}
+
+// Linters returns every registered rule, in the order they were registered.
+func Linters() []Linter {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	ret := make([]Linter, len(registry))
+	copy(ret, registry)
+	return ret
+}
+
+// Lint runs every linter against the manifest and returns all of their
+// violations.
+func Lint(m manifest.Manifest, linters []Linter) []Violation {
+	var violations []Violation
+	for _, l := range linters {
+		violations = append(violations, l.Lint(m)...)
+	}
+	return violations
+}
+
+// HasSeverity returns true if any of the violations are at least as severe
+// as severity.
+func HasSeverity(violations []Violation, severity Severity) bool {
+	for _, v := range violations {
+		if v.Severity == SeverityError || v.Severity == severity {
+			return true
+		}
+	}
+	return false
+}
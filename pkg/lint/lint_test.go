@@ -0,0 +1,58 @@
+package lint
+
+import (
+	"testing"
+
+	"github.com/square/p2/pkg/auth"
+	"github.com/square/p2/pkg/manifest"
+)
+
+func TestBuiltInRules(t *testing.T) {
+	builder := manifest.NewBuilder()
+	builder.SetID("hello")
+	builder.SetStatusPort(8000)
+	if violations := Lint(builder.GetManifest(), Linters()); len(violations) != 0 {
+		t.Errorf("expected no violations, got %+v", violations)
+	}
+
+	builder.SetRunAsUser("root")
+	builder.SetArtifactVerification(auth.VerifyNone)
+	builder.SetStatusPort(0)
+	violations := Lint(builder.GetManifest(), Linters())
+
+	severities := make(map[string]Severity)
+	for _, v := range violations {
+		severities[v.Rule] = v.Severity
+	}
+	expected := map[string]Severity{
+		"artifact-verification": SeverityError,
+		"run-as-root":           SeverityWarning,
+		"status-port":           SeverityWarning,
+	}
+	if len(severities) != len(expected) {
+		t.Fatalf("expected violations of %v, got %+v", expected, violations)
+	}
+	for rule, severity := range expected {
+		if severities[rule] != severity {
+			t.Errorf("expected a %s violation of %s, got %q", severity, rule, severities[rule])
+		}
+	}
+}
+
+func TestHasSeverity(t *testing.T) {
+	warnings := []Violation{{Rule: "a", Severity: SeverityWarning}}
+	if HasSeverity(warnings, SeverityError) {
+		t.Error("expected warnings not to count as errors")
+	}
+	if !HasSeverity(warnings, SeverityWarning) {
+		t.Error("expected a warning to be found")
+	}
+
+	errors := []Violation{{Rule: "a", Severity: SeverityError}}
+	if !HasSeverity(errors, SeverityWarning) {
+		t.Error("expected errors to count as at least a warning")
+	}
+	if HasSeverity(nil, SeverityWarning) {
+		t.Error("expected no violations to have no severity")
+	}
+}
@@ -0,0 +1,64 @@
+package lint
+
+import (
+	"fmt"
+
+	"github.com/square/p2/pkg/auth"
+	"github.com/square/p2/pkg/manifest"
+)
+
+func init() {
+	Register(rule{"artifact-verification", lintArtifactVerification})
+	Register(rule{"run-as-root", lintRunAsRoot})
+	Register(rule{"status-port", lintStatusPort})
+}
+
+// rule adapts a function to the Linter interface
+type rule struct {
+	name string
+	lint func(m manifest.Manifest) []Violation
+}
+
+func (r rule) Name() string {
+	return r.name
+}
+
+func (r rule) Lint(m manifest.Manifest) []Violation {
+	violations := r.lint(m)
+	for i := range violations {
+		violations[i].Rule = r.name
+	}
+	return violations
+}
+
+// Manifests scheduled with p2-schedule --no-verify are meant for development
+// and should never be left in a cluster
+func lintArtifactVerification(m manifest.Manifest) []Violation {
+	if m.GetArtifactVerification() != auth.VerifyNone {
+		return nil
+	}
+	return []Violation{{
+		Severity: SeverityError,
+		Message:  "artifact verification is disabled",
+	}}
+}
+
+func lintRunAsRoot(m manifest.Manifest) []Violation {
+	if m.RunAsUser() != "root" {
+		return nil
+	}
+	return []Violation{{
+		Severity: SeverityWarning,
+		Message:  fmt.Sprintf("%s runs as root", m.ID()),
+	}}
+}
+
+func lintStatusPort(m manifest.Manifest) []Violation {
+	if m.GetStatusPort() != 0 {
+		return nil
+	}
+	return []Violation{{
+		Severity: SeverityWarning,
+		Message:  "no status_port is set, so the pod's health cannot be checked",
+	}}
+}
@@ -55,6 +55,19 @@ func (l Logger) SubLogger(fields logrus.Fields) Logger {
 	return l.WithFields(fields)
 }
 
+// NewRequestLogger returns a logger that adds the given request ID to every
+// entry as the "request_id" field, so that entries from concurrent operations
+// can be grouped by request. A nil parent uses DefaultLogger.
+func NewRequestLogger(parent *Logger, requestID string) *Logger {
+	if parent == nil {
+		parent = &DefaultLogger
+	}
+	logger := parent.SubLogger(logrus.Fields{
+		"request_id": requestID,
+	})
+	return &logger
+}
+
 func (l Logger) NoFields() Logger {
 	return l
 }
@@ -2,6 +2,7 @@ package logging
 
 import (
 	"encoding/json"
+	"io/ioutil"
 	"net"
 	"os"
 	"sync"
@@ -176,3 +177,68 @@ func TestConcurrent(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+func TestRequestLoggersAreDistinguishable(t *testing.T) {
+	parent := NewLogger(logrus.Fields{"app": "test"})
+	hook := &recordingHook{}
+	parent.Logger.Hooks.Add(hook)
+	parent.Logger.Out = ioutil.Discard
+
+	requestIDs := []string{"request-1", "request-2"}
+	const entriesPerRequest = 10
+	var wg sync.WaitGroup
+	for _, requestID := range requestIDs {
+		wg.Add(1)
+		go func(requestID string) {
+			defer wg.Done()
+			logger := NewRequestLogger(&parent, requestID)
+			for i := 0; i < entriesPerRequest; i++ {
+				logger.Infoln(requestID)
+			}
+		}(requestID)
+	}
+	wg.Wait()
+
+	entries := hook.entries()
+	Assert(t).AreEqual(len(entries), len(requestIDs)*entriesPerRequest, "unexpected number of log entries")
+	for _, entry := range entries {
+		Assert(t).AreEqual(entry.Data["request_id"], entry.Message, "entry logged with the wrong request_id")
+		Assert(t).AreEqual(entry.Data["app"], "test", "request logger should keep the parent's fields")
+	}
+
+	_, hasRequestID := parent.NoFields().Data["request_id"]
+	Assert(t).IsFalse(hasRequestID, "should not have modified the parent logger")
+}
+
+func TestRequestLoggerDefaultsToDefaultLogger(t *testing.T) {
+	logger := NewRequestLogger(nil, "abc")
+	Assert(t).AreEqual(logger.Data["request_id"], "abc", "expected request_id to be set")
+	Assert(t).AreEqual(logger.Logger, DefaultLogger.Logger, "expected a nil parent to use DefaultLogger")
+}
+
+// recordingHook keeps a copy of every entry it fires for
+type recordingHook struct {
+	mu  sync.Mutex
+	all []logrus.Entry
+}
+
+func (h *recordingHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *recordingHook) Fire(entry *logrus.Entry) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	data := make(logrus.Fields, len(entry.Data))
+	for k, v := range entry.Data {
+		data[k] = v
+	}
+	h.all = append(h.all, logrus.Entry{Data: data, Message: entry.Message})
+	return nil
+}
+
+func (h *recordingHook) entries() []logrus.Entry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.all
+}
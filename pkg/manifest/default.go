@@ -0,0 +1,134 @@
+package manifest
+
+import (
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// The ID of the launchable in a DefaultManifest
+const DefaultLaunchableID launch.LaunchableID = "main"
+
+// DefaultManifest returns the smallest valid manifest with the given ID: a
+// single hoist launchable named "main" at version "0" with an empty
+// environment. It is intended for tests and tooling that don't care about the
+// manifest's contents.
+func DefaultManifest(id types.PodID) Manifest {
+	builder := NewBuilder()
+	builder.SetID(id)
+	builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{
+		DefaultLaunchableID: defaultLaunchable(),
+	})
+	return builder.GetManifest()
+}
+
+func defaultLaunchable() launch.LaunchableStanza {
+	return launch.LaunchableStanza{
+		LaunchableType: "hoist",
+		Version: launch.LaunchableVersion{
+			ID: "0",
+		},
+		Env: map[string]string{},
+	}
+}
+
+// ManifestBuilder builds manifests with chained calls, e.g.
+//
+//	m, err := NewManifestBuilder("app").
+//		WithLaunchable("web", webStanza).
+//		WithEnv("web", map[string]string{"PORT": "8080"}).
+//		Build()
+//
+// The first error encountered is returned by Build().
+type ManifestBuilder struct {
+	id          types.PodID
+	runAs       string
+	launchables map[launch.LaunchableID]launch.LaunchableStanza
+	config      map[interface{}]interface{}
+	err         error
+}
+
+func NewManifestBuilder(id types.PodID) *ManifestBuilder {
+	return &ManifestBuilder{
+		id:          id,
+		launchables: make(map[launch.LaunchableID]launch.LaunchableStanza),
+	}
+}
+
+// WithLaunchable adds a launchable to the manifest. It is an error to add two
+// launchables with the same ID.
+func (b *ManifestBuilder) WithLaunchable(id launch.LaunchableID, stanza launch.LaunchableStanza) *ManifestBuilder {
+	if b.err != nil {
+		return b
+	}
+	if _, ok := b.launchables[id]; ok {
+		b.err = util.Errorf("launchable %s was added twice", id)
+		return b
+	}
+	b.launchables[id] = stanza
+	return b
+}
+
+// WithEnv merges env into the environment of a launchable that has already
+// been added.
+func (b *ManifestBuilder) WithEnv(id launch.LaunchableID, env map[string]string) *ManifestBuilder {
+	if b.err != nil {
+		return b
+	}
+	stanza, ok := b.launchables[id]
+	if !ok {
+		b.err = util.Errorf("cannot set the environment of launchable %s before adding it", id)
+		return b
+	}
+	merged := make(map[string]string, len(stanza.Env)+len(env))
+	for k, v := range stanza.Env {
+		merged[k] = v
+	}
+	for k, v := range env {
+		merged[k] = v
+	}
+	stanza.Env = merged
+	b.launchables[id] = stanza
+	return b
+}
+
+func (b *ManifestBuilder) WithRunAsUser(user string) *ManifestBuilder {
+	b.runAs = user
+	return b
+}
+
+func (b *ManifestBuilder) WithConfig(config map[interface{}]interface{}) *ManifestBuilder {
+	b.config = config
+	return b
+}
+
+// Build returns the manifest, or an error if any of the chained calls failed
+// or the result is not a valid manifest (see ValidManifest()).
+func (b *ManifestBuilder) Build() (Manifest, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	builder := NewBuilder()
+	builder.SetID(b.id)
+	builder.SetRunAsUser(b.runAs)
+	// copy so that later calls on b don't modify the built manifest
+	launchables := make(map[launch.LaunchableID]launch.LaunchableStanza, len(b.launchables))
+	for id, stanza := range b.launchables {
+		launchables[id] = stanza
+	}
+	builder.SetLaunchables(launchables)
+	if b.config != nil {
+		err := builder.SetConfig(b.config)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	m := builder.GetManifest()
+	err := ValidManifest(m)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
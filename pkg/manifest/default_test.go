@@ -0,0 +1,89 @@
+package manifest
+
+import (
+	"testing"
+
+	"github.com/square/p2/pkg/launch"
+)
+
+func TestDefaultManifestIsValid(t *testing.T) {
+	m := DefaultManifest("foo")
+	if err := ValidManifest(m); err != nil {
+		t.Fatalf("expected the default manifest to be valid: %s", err)
+	}
+	if m.ID() != "foo" {
+		t.Errorf("expected ID foo, got %s", m.ID())
+	}
+
+	ids := m.LaunchableIDs()
+	if len(ids) != 1 || ids[0] != DefaultLaunchableID {
+		t.Fatalf("expected a single launchable named %s, got %v", DefaultLaunchableID, ids)
+	}
+	stanza, err := m.LaunchableByID(DefaultLaunchableID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stanza.LaunchableType != "hoist" {
+		t.Errorf("expected a hoist launchable, got %s", stanza.LaunchableType)
+	}
+	if stanza.Env == nil || len(stanza.Env) != 0 {
+		t.Errorf("expected an empty env map, got %v", stanza.Env)
+	}
+	if m.GetStatusPort() != 0 {
+		t.Errorf("expected status port to be zero, got %d", m.GetStatusPort())
+	}
+}
+
+func TestManifestBuilderTwoLaunchables(t *testing.T) {
+	m, err := NewManifestBuilder("foo").
+		WithLaunchable("web", launch.LaunchableStanza{
+			LaunchableType: "hoist",
+			Location:       "https://localhost:4444/web_abc.tar.gz",
+		}).
+		WithLaunchable("worker", launch.LaunchableStanza{
+			LaunchableType: "hoist",
+			Version:        launch.LaunchableVersion{ID: "1.0.0"},
+		}).
+		WithEnv("web", map[string]string{"PORT": "8080"}).
+		WithRunAsUser("foo-user").
+		Build()
+	if err != nil {
+		t.Fatalf("unexpected error building manifest: %s", err)
+	}
+	if err := ValidManifest(m); err != nil {
+		t.Fatalf("expected built manifest to be valid: %s", err)
+	}
+
+	if len(m.LaunchableIDs()) != 2 {
+		t.Errorf("expected 2 launchables, got %v", m.LaunchableIDs())
+	}
+	web, err := m.LaunchableByID("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if web.Env["PORT"] != "8080" {
+		t.Errorf("expected web to have PORT=8080, got %v", web.Env)
+	}
+	if m.RunAsUser() != "foo-user" {
+		t.Errorf("expected run_as foo-user, got %s", m.RunAsUser())
+	}
+}
+
+func TestManifestBuilderErrors(t *testing.T) {
+	stanza := launch.LaunchableStanza{LaunchableType: "hoist", Location: "https://localhost:4444/web_abc.tar.gz"}
+
+	_, err := NewManifestBuilder("foo").WithLaunchable("web", stanza).WithLaunchable("web", stanza).Build()
+	if err == nil {
+		t.Error("expected an error adding the same launchable twice")
+	}
+
+	_, err = NewManifestBuilder("foo").WithEnv("web", map[string]string{"PORT": "8080"}).Build()
+	if err == nil {
+		t.Error("expected an error setting the env of a missing launchable")
+	}
+
+	_, err = NewManifestBuilder("foo").WithLaunchable("web", launch.LaunchableStanza{LaunchableType: "hoist"}).Build()
+	if err == nil {
+		t.Error("expected an error building an invalid manifest")
+	}
+}
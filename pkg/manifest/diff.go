@@ -0,0 +1,88 @@
+package manifest
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// FieldChange is a single difference between two manifests, as found by
+// Diff().
+type FieldChange struct {
+	// The dotted path of the changed field, e.g. launchables.app.location
+	Path string
+	// The field's value in each manifest, nil if the field is unset in it
+	From interface{}
+	To   interface{}
+}
+
+func (c FieldChange) String() string {
+	switch {
+	case c.From == nil:
+		return fmt.Sprintf("+ %s: %v", c.Path, c.To)
+	case c.To == nil:
+		return fmt.Sprintf("- %s: %v", c.Path, c.From)
+	default:
+		return fmt.Sprintf("~ %s: %v -> %v", c.Path, c.From, c.To)
+	}
+}
+
+type fieldChanges []FieldChange
+
+func (c fieldChanges) Len() int           { return len(c) }
+func (c fieldChanges) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c fieldChanges) Less(i, j int) bool { return c[i].Path < c[j].Path }
+
+// Diff returns every field that differs between the from and to manifests,
+// sorted by path. Maps are compared key by key, recursively, so that a change
+// to a single env var of a launchable is reported as such. Any other value,
+// including a list, is compared as a whole. Signatures are ignored. A nil
+// from manifest is treated as empty, so every field of to is reported.
+func Diff(from Manifest, to Manifest) ([]FieldChange, error) {
+	var fromFields map[interface{}]interface{}
+	if from != nil {
+		var err error
+		fromFields, err = from.GetBuilder().GetManifest().(*manifest).genericFields()
+		if err != nil {
+			return nil, err
+		}
+	}
+	toFields, err := to.GetBuilder().GetManifest().(*manifest).genericFields()
+	if err != nil {
+		return nil, err
+	}
+
+	var changes fieldChanges
+	diffValue("", fromFields, toFields, &changes)
+	sort.Sort(changes)
+	return changes, nil
+}
+
+// diffValue appends the differences between from and to, found at path, to
+// changes, recursing into maps.
+func diffValue(path string, from interface{}, to interface{}, changes *fieldChanges) {
+	fromMap, fromIsMap := from.(map[interface{}]interface{})
+	toMap, toIsMap := to.(map[interface{}]interface{})
+	if (fromIsMap || from == nil) && (toIsMap || to == nil) && (fromIsMap || toIsMap) {
+		for key, value := range fromMap {
+			diffValue(joinFieldPath(path, key), value, toMap[key], changes)
+		}
+		for key, value := range toMap {
+			if _, ok := fromMap[key]; !ok {
+				diffValue(joinFieldPath(path, key), nil, value, changes)
+			}
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(from, to) {
+		*changes = append(*changes, FieldChange{Path: path, From: from, To: to})
+	}
+}
+
+func joinFieldPath(path string, key interface{}) string {
+	if path == "" {
+		return fmt.Sprint(key)
+	}
+	return fmt.Sprintf("%s.%v", path, key)
+}
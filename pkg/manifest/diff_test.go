@@ -0,0 +1,72 @@
+package manifest
+
+import (
+	"testing"
+
+	"github.com/square/p2/pkg/launch"
+)
+
+func TestDiff(t *testing.T) {
+	builder := NewBuilder()
+	builder.SetID("myapp")
+	builder.SetRunAsUser("myapp")
+	builder.SetStatusPort(8080)
+	builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{
+		"app": {
+			LaunchableType: "hoist",
+			Location:       "https://localhost/myapp_abc123.tar.gz",
+			Env:            map[string]string{"LOG_LEVEL": "debug"},
+		},
+	})
+	from := builder.GetManifest()
+
+	builder = from.GetBuilder()
+	builder.SetStatusPort(0)
+	builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{
+		"app": {
+			LaunchableType: "hoist",
+			Location:       "https://localhost/myapp_def456.tar.gz",
+			Env:            map[string]string{"LOG_LEVEL": "debug", "PORT": "8080"},
+		},
+	})
+	to := builder.GetManifest()
+
+	changes, err := Diff(from, to)
+	if err != nil {
+		t.Fatalf("Unexpected error diffing: %s", err)
+	}
+	expected := []string{
+		"+ launchables.app.env.PORT: 8080",
+		"~ launchables.app.location: https://localhost/myapp_abc123.tar.gz -> https://localhost/myapp_def456.tar.gz",
+		"- status.port: 8080",
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected %d changes, got %v", len(expected), changes)
+	}
+	for i, change := range changes {
+		if change.String() != expected[i] {
+			t.Errorf("Expected change %d to be %q, was %q", i, expected[i], change.String())
+		}
+	}
+
+	changes, err = Diff(from, from)
+	if err != nil {
+		t.Fatalf("Unexpected error diffing: %s", err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("Expected no changes between a manifest and itself, got %v", changes)
+	}
+}
+
+func TestDiffFromNil(t *testing.T) {
+	builder := NewBuilder()
+	builder.SetID("myapp")
+
+	changes, err := Diff(nil, builder.GetManifest())
+	if err != nil {
+		t.Fatalf("Unexpected error diffing: %s", err)
+	}
+	if len(changes) != 1 || changes[0].String() != "+ id: myapp" {
+		t.Errorf("Expected only the ID to be added, got %v", changes)
+	}
+}
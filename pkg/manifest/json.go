@@ -0,0 +1,143 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"unicode"
+
+	"github.com/square/p2/pkg/util"
+
+	"gopkg.in/yaml.v2"
+)
+
+// FromJSON constructs a Manifest from a JSON document, with the same keys as
+// the YAML form. FromBytes() also accepts JSON, but falls back to parsing
+// anything that isn't valid JSON as YAML, whereas FromJSON reports the JSON
+// syntax error.
+//
+// The manifest is stored, and written, as YAML.
+func FromJSON(jsonBytes []byte) (Manifest, error) {
+	yamlBytes, err := jsonToYAML(jsonBytes)
+	if err != nil {
+		return nil, util.Errorf("Could not read pod manifest: %s", err)
+	}
+	return FromBytes(yamlBytes)
+}
+
+// fromJSONPath reads a manifest from a file whose name ends in .json.
+func fromJSONPath(path string) (Manifest, error) {
+	jsonBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return FromJSON(jsonBytes)
+}
+
+func isJSONPath(path string) bool {
+	return strings.HasSuffix(strings.ToLower(path), ".json")
+}
+
+// looksLikeJSON returns true if data starts with a JSON object. It may also
+// be a YAML flow mapping, e.g. {id: myapp}
+func looksLikeJSON(data []byte) bool {
+	trimmed := bytes.TrimLeftFunc(data, unicode.IsSpace)
+	return len(trimmed) > 0 && trimmed[0] == '{'
+}
+
+// jsonToYAML converts a JSON object to YAML. Integers remain integers, rather
+// than becoming floats.
+func jsonToYAML(jsonBytes []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(jsonBytes))
+	decoder.UseNumber()
+	var fields map[string]interface{}
+	err := decoder.Decode(&fields)
+	if err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, util.Errorf("unexpected data after the manifest's JSON object")
+	}
+	converted, err := fromJSONValue(fields)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(converted)
+}
+
+// fromJSONValue replaces the json.Numbers in a decoded JSON value with ints or
+// floats, so that they are marshaled as YAML numbers.
+func fromJSONValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, nil
+		}
+		return v.Float64()
+	case map[string]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key, elem := range v {
+			convertedElem, err := fromJSONValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			converted[key] = convertedElem
+		}
+		return converted, nil
+	case []interface{}:
+		converted := make([]interface{}, len(v))
+		for i, elem := range v {
+			convertedElem, err := fromJSONValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			converted[i] = convertedElem
+		}
+		return converted, nil
+	default:
+		return v, nil
+	}
+}
+
+// toJSONValue replaces the map[interface{}]interface{}s in a generic YAML
+// value, which encoding/json can't marshal, with map[string]interface{}s.
+func toJSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key, elem := range v {
+			converted[fmt.Sprint(key)] = toJSONValue(elem)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, len(v))
+		for i, elem := range v {
+			converted[i] = toJSONValue(elem)
+		}
+		return converted
+	default:
+		return v
+	}
+}
+
+// MarshalJSON returns the manifest as a JSON object with the same keys as its
+// YAML form. The signature of a signed manifest is not included.
+func (m *manifest) MarshalJSON() ([]byte, error) {
+	fields, err := m.genericFields()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(toJSONValue(fields))
+}
+
+// UnmarshalJSON parses a manifest marshaled by MarshalJSON(), see FromJSON().
+func (m *manifest) UnmarshalJSON(jsonBytes []byte) error {
+	parsed, err := FromJSON(jsonBytes)
+	if err != nil {
+		return err
+	}
+	*m = *parsed.(*manifest)
+	return nil
+}
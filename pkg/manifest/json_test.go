@@ -0,0 +1,131 @@
+package manifest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/util/size"
+)
+
+const jsonManifest = `{
+  "id": "myapp",
+  "status_port": 8080,
+  "launchables": {
+    "app": {
+      "launchable_type": "hoist",
+      "location": "https://localhost/myapp_abc123.tar.gz",
+      "cgroup": {"cpus": 2, "memory": "1G"},
+      "env": {"PORT": "8080"}
+    }
+  },
+  "config": {"ratio": 0.5, "hosts": ["a", "b"]}
+}`
+
+func checkJSONManifest(t *testing.T, m Manifest) {
+	if m.ID() != "myapp" {
+		t.Errorf("Expected ID myapp, got %s", m.ID())
+	}
+	if m.GetStatusPort() != 8080 {
+		t.Errorf("Expected status port 8080, got %d", m.GetStatusPort())
+	}
+	stanza, err := m.LaunchableByID(launch.LaunchableID("app"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stanza.CgroupConfig.CPUs != 2 || stanza.CgroupConfig.Memory != size.Gibibyte {
+		t.Errorf("Expected a cgroup of 2 CPUs and 1G, got %+v", stanza.CgroupConfig)
+	}
+	if m.GetConfig()["ratio"] != 0.5 {
+		t.Errorf("Expected config ratio 0.5, got %v", m.GetConfig()["ratio"])
+	}
+}
+
+func TestFromBytesDetectsJSON(t *testing.T) {
+	m, err := FromBytes([]byte(jsonManifest))
+	if err != nil {
+		t.Fatalf("Unexpected error parsing JSON manifest: %s", err)
+	}
+	checkJSONManifest(t, m)
+
+	// It is stored as YAML
+	marshaled, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if looksLikeJSON(marshaled) {
+		t.Errorf("Expected the manifest to be marshaled as YAML, got:\n%s", marshaled)
+	}
+}
+
+func TestFromBytesAcceptsYAMLFlowMapping(t *testing.T) {
+	m, err := FromBytes([]byte("{id: myapp, launchables: {}}"))
+	if err != nil {
+		t.Fatalf("Unexpected error parsing a YAML flow mapping: %s", err)
+	}
+	if m.ID() != "myapp" {
+		t.Errorf("Expected ID myapp, got %s", m.ID())
+	}
+}
+
+func TestFromPathJSON(t *testing.T) {
+	dir, err := ioutil.TempDir("", "json_manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "myapp.json")
+	err = ioutil.WriteFile(path, []byte(jsonManifest), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := FromPath(path)
+	if err != nil {
+		t.Fatalf("Unexpected error reading %s: %s", path, err)
+	}
+	checkJSONManifest(t, m)
+
+	// .json files must be valid JSON
+	err = ioutil.WriteFile(path, []byte("{id: myapp}"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = FromPath(path)
+	if err == nil {
+		t.Error("Expected a .json file that isn't JSON to be refused")
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	m, err := FromBytes([]byte(jsonManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonBytes, err := json.Marshal(m)
+	if err != nil {
+		t.Fatalf("Unexpected error marshaling manifest as JSON: %s", err)
+	}
+
+	var parsed manifest
+	err = json.Unmarshal(jsonBytes, &parsed)
+	if err != nil {
+		t.Fatalf("Unexpected error unmarshaling manifest from JSON: %s", err)
+	}
+	checkJSONManifest(t, &parsed)
+
+	originalSHA, err := m.SHA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsedSHA, err := parsed.SHA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if originalSHA != parsedSHA {
+		t.Errorf("Expected the round tripped manifest to have the same SHA, %s != %s", originalSHA, parsedSHA)
+	}
+}
@@ -1,23 +1,26 @@
 // Package pods borrows heavily from the Kubernetes definition of pods to provide
 // p2 with a convenient way to colocate several related launchable artifacts, as well
-// as basic shared runtime configuration. Pod manifests are written as YAML files
+// as basic shared runtime configuration. Pod manifests are written as YAML (or JSON) files
 // that describe what to launch.
 package manifest
 
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/url"
 	"os"
 	"path"
+	"sort"
 
 	"github.com/square/p2/pkg/artifact"
 	"github.com/square/p2/pkg/cgroups"
 	"github.com/square/p2/pkg/launch"
 	"github.com/square/p2/pkg/logging"
+	manifest_protos "github.com/square/p2/pkg/manifest/protos"
 	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/uri"
 	"github.com/square/p2/pkg/util"
@@ -25,11 +28,41 @@ import (
 	"gopkg.in/yaml.v2"
 )
 
+// ErrLaunchableNotFound is returned by LaunchableByID when the manifest has no
+// launchable with the requested ID.
+var ErrLaunchableNotFound = errors.New("launchable not found in manifest")
+
+// The kinds of health check a status stanza can configure, see
+// StatusStanza.CheckType()
+const (
+	// Requests the status path on the status port, over HTTPS unless http
+	// is set. The default
+	StatusCheckHTTP = "http"
+	// Connects to the status port
+	StatusCheckTCP = "tcp"
+	// Runs the command as the pod's user. Exiting 0 is passing, 1 is
+	// warning and anything else is critical
+	StatusCheckExec = "exec"
+)
+
 type StatusStanza struct {
 	HTTP          bool   `yaml:"http,omitempty"`
 	Path          string `yaml:"path,omitempty"`
 	Port          int    `yaml:"port,omitempty"`
 	LocalhostOnly bool   `yaml:"localhost_only,omitempty"`
+
+	// One of the StatusCheck* constants. Command is the shell command of
+	// an exec check
+	Type    string `yaml:"type,omitempty"`
+	Command string `yaml:"command,omitempty"`
+}
+
+// CheckType returns the kind of health check the stanza configures.
+func (status StatusStanza) CheckType() string {
+	if status.Type == "" {
+		return StatusCheckHTTP
+	}
+	return status.Type
 }
 
 type Builder interface {
@@ -42,6 +75,9 @@ type Builder interface {
 	SetStatusPort(port int)
 	SetLaunchables(launchableStanzas map[launch.LaunchableID]launch.LaunchableStanza)
 	SetResourceLimits(limits ResourceLimitsStanza)
+	SetArtifactVerification(verification string)
+	SetNodeRequirements(nodeRequirements map[string]string)
+	SetTemplateVars(templateVars map[string]string)
 }
 
 var _ Builder = builder{}
@@ -71,6 +107,10 @@ type Manifest interface {
 	WritePlatformConfig(out io.Writer) error
 	WriteResourceLimitsConfig(out io.Writer) error
 	GetLaunchableStanzas() map[launch.LaunchableID]launch.LaunchableStanza
+	LaunchableByID(id launch.LaunchableID) (launch.LaunchableStanza, error)
+	LaunchableIDs() []launch.LaunchableID
+	WithLaunchable(id launch.LaunchableID, stanza launch.LaunchableStanza) Manifest
+	WithoutLaunchable(id launch.LaunchableID) Manifest
 	GetResourceLimits() ResourceLimitsStanza
 	ResourceLimitsConfigFileName() (string, error)
 	GetConfig() map[interface{}]interface{}
@@ -86,6 +126,13 @@ type Manifest interface {
 	Marshal() ([]byte, error)
 	SignatureData() (plaintext, signature []byte)
 	GetNodeRequirements() map[string]string
+	GetArtifactVerification() string
+	ToProto() (*manifest_protos.PodManifest, error)
+	GetTemplateVars() map[string]string
+	RenderTemplate(vars map[string]string) (Manifest, error)
+	Scrub() Manifest
+	Merge(overlay []byte) (Manifest, error)
+	Validate() error
 
 	GetBuilder() Builder
 }
@@ -110,6 +157,16 @@ type manifest struct {
 	ArtifactRegistryURL string                                          `yaml:"artifact_registry,omitempty"`
 	NodeRequirements    map[string]string                               `yaml:"node_requirements,omitempty"`
 
+	// ArtifactVerification overrides the preparer's artifact verification
+	// for this pod. The only supported value is auth.VerifyNone ("none"),
+	// intended for development manifests whose artifacts are not signed.
+	// Preparers only honor it for pods in their no_verify_whitelist.
+	ArtifactVerification string `yaml:"artifact_verification,omitempty"`
+
+	// Variables that are substituted into the manifest at deploy time, with
+	// their default values. See RenderTemplate()
+	TemplateVars map[string]string `yaml:"template_vars,omitempty"`
+
 	// Used to track the original bytes so that we don't reorder them when
 	// doing a yaml.Unmarshal and a yaml.Marshal in succession
 	raw []byte
@@ -155,6 +212,56 @@ func (manifest *manifest) GetLaunchableStanzas() map[launch.LaunchableID]launch.
 	return manifest.LaunchableStanzas
 }
 
+// LaunchableByID returns the launchable stanza with the given ID, or
+// ErrLaunchableNotFound if there is none.
+func (manifest *manifest) LaunchableByID(id launch.LaunchableID) (launch.LaunchableStanza, error) {
+	stanza, ok := manifest.LaunchableStanzas[id]
+	if !ok {
+		return launch.LaunchableStanza{}, ErrLaunchableNotFound
+	}
+	return stanza, nil
+}
+
+// LaunchableIDs returns the IDs of all launchables in the manifest, sorted so
+// that iteration over them is deterministic.
+func (manifest *manifest) LaunchableIDs() []launch.LaunchableID {
+	ids := make([]launch.LaunchableID, 0, len(manifest.LaunchableStanzas))
+	for id := range manifest.LaunchableStanzas {
+		ids = append(ids, id)
+	}
+	sort.Sort(launch.LaunchableIDs(ids))
+	return ids
+}
+
+// WithLaunchable returns a copy of the manifest with the launchable added, or
+// replaced if the manifest already has one with the same ID. The manifest
+// itself is not modified. The copy is unsigned.
+func (manifest *manifest) WithLaunchable(id launch.LaunchableID, stanza launch.LaunchableStanza) Manifest {
+	launchables := manifest.copyLaunchableStanzas()
+	launchables[id] = stanza
+	builder := manifest.GetBuilder()
+	builder.SetLaunchables(launchables)
+	return builder.GetManifest()
+}
+
+// WithoutLaunchable returns a copy of the manifest without the launchable with
+// the given ID. The manifest itself is not modified. The copy is unsigned.
+func (manifest *manifest) WithoutLaunchable(id launch.LaunchableID) Manifest {
+	launchables := manifest.copyLaunchableStanzas()
+	delete(launchables, id)
+	builder := manifest.GetBuilder()
+	builder.SetLaunchables(launchables)
+	return builder.GetManifest()
+}
+
+func (manifest *manifest) copyLaunchableStanzas() map[launch.LaunchableID]launch.LaunchableStanza {
+	launchables := make(map[launch.LaunchableID]launch.LaunchableStanza, len(manifest.LaunchableStanzas)+1)
+	for id, stanza := range manifest.LaunchableStanzas {
+		launchables[id] = stanza
+	}
+	return launchables
+}
+
 func (manifest *manifest) SetLaunchables(launchableStanzas map[launch.LaunchableID]launch.LaunchableStanza) {
 	manifest.LaunchableStanzas = launchableStanzas
 }
@@ -298,8 +405,11 @@ func (mb builder) SetReadonly(readonly bool) {
 }
 
 // FromPath constructs a Manifest from a local file. This function is a helper for
-// FromBytes().
+// FromBytes(), or for FromJSON() if the file name ends in .json
 func FromPath(path string) (Manifest, error) {
+	if isJSONPath(path) {
+		return fromJSONPath(path)
+	}
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, err
@@ -331,8 +441,9 @@ func FromReader(reader io.Reader) (Manifest, error) {
 }
 
 // FromBytes constructs a Manifest by parsing its serialized representation. The
-// manifest can be a raw YAML document or a PGP clearsigned YAML document. If signed, the
-// signature components will be stored inside the Manifest instance.
+// manifest can be a raw YAML or JSON document or a PGP clearsigned one. If signed, the
+// signature components will be stored inside the Manifest instance. Unsigned JSON
+// manifests are converted to YAML, see FromJSON().
 func FromBytes(bytes []byte) (Manifest, error) {
 	manifest := &manifest{}
 
@@ -357,6 +468,16 @@ func FromBytes(bytes []byte) (Manifest, error) {
 		bytes = signed.Plaintext
 	}
 
+	if looksLikeJSON(bytes) {
+		// Anything that isn't valid JSON may still be a YAML flow mapping
+		if yamlBytes, err := jsonToYAML(bytes); err == nil {
+			bytes = yamlBytes
+			if signed == nil {
+				manifest.raw = yamlBytes
+			}
+		}
+	}
+
 	if err := yaml.Unmarshal(bytes, manifest); err != nil {
 		return nil, util.Errorf("Could not read pod manifest: %s", err)
 	}
@@ -506,25 +627,60 @@ func (m manifest) SignatureData() (plaintext, signature []byte) {
 	return m.plaintext, m.signature
 }
 
+// GetNodeRequirements returns the labels that a node must have, with the
+// given values, for the pod to be scheduled on it.
 func (m manifest) GetNodeRequirements() map[string]string {
 	return m.NodeRequirements
 }
 
+func (mb builder) SetNodeRequirements(nodeRequirements map[string]string) {
+	mb.manifest.NodeRequirements = nodeRequirements
+}
+
+func (m manifest) GetArtifactVerification() string {
+	return m.ArtifactVerification
+}
+
+func (mb builder) SetArtifactVerification(verification string) {
+	mb.manifest.ArtifactVerification = verification
+}
+
+func (m manifest) GetTemplateVars() map[string]string {
+	return m.TemplateVars
+}
+
+func (mb builder) SetTemplateVars(templateVars map[string]string) {
+	mb.manifest.TemplateVars = templateVars
+}
+
 // ValidManifest checks the internal consistency of a manifest. Returns an error if the
-// data is inconsistent or "nil" otherwise.
+// data is inconsistent or "nil" otherwise. Every problem found is reported, as
+// a *util.MultiError.
 func ValidManifest(m Manifest) error {
+	errs := &util.MultiError{}
 	if m.ID() == "" {
-		return fmt.Errorf("manifest must contain an 'id'")
+		errs.Add(fmt.Errorf("manifest must contain an 'id'"))
 	}
-	for launchableID, stanza := range m.GetLaunchableStanzas() {
+	for _, launchableID := range m.LaunchableIDs() {
+		stanza, err := m.LaunchableByID(launchableID)
+		if err != nil {
+			errs.Add(err)
+			continue
+		}
+		if stanza.LaunchableType == "" {
+			errs.Add(fmt.Errorf("'%s': launchable must contain a 'launchable_type'", launchableID))
+		}
 		switch {
-		case stanza.LaunchableType == "":
-			return fmt.Errorf("'%s': launchable must contain a 'launchable_type'", launchableID)
 		case stanza.Location == "" && stanza.Version.ID == "":
-			return fmt.Errorf("'%s': launchable must contain a 'location' or 'version'", launchableID)
+			errs.Add(fmt.Errorf("'%s': launchable must contain a 'location' or 'version'", launchableID))
 		case stanza.Location != "" && stanza.Version.ID != "":
-			return fmt.Errorf("'%s': launchable must not contain both 'location' and 'version'", launchableID)
+			errs.Add(fmt.Errorf("'%s': launchable must not contain both 'location' and 'version'", launchableID))
+		}
+		if stanza.LaunchableType == "docker" {
+			if _, err := stanza.ImageReference(); err != nil {
+				errs.Add(fmt.Errorf("'%s': invalid location: %s", launchableID, err))
+			}
 		}
 	}
-	return nil
+	return errs.ErrorOrNil()
 }
@@ -5,11 +5,13 @@ import (
 	"errors"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/square/p2/pkg/cgroups"
 	"github.com/square/p2/pkg/launch"
 	"github.com/square/p2/pkg/uri"
+	"github.com/square/p2/pkg/util"
 	"github.com/square/p2/pkg/util/size"
 
 	"net/http"
@@ -174,6 +176,42 @@ func TestPodManifestLaunchablesCGroups(t *testing.T) {
 	}
 }
 
+func TestLaunchableByID(t *testing.T) {
+	builder := NewBuilder()
+	builder.SetID("thepod")
+	builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{
+		"web":    {LaunchableType: "hoist", Location: "https://localhost:4444/web.tar.gz"},
+		"worker": {LaunchableType: "hoist", Location: "https://localhost:4444/worker.tar.gz"},
+	})
+	manifest := builder.GetManifest()
+
+	stanza, err := manifest.LaunchableByID("worker")
+	Assert(t).IsNil(err, "Should have found the worker launchable")
+	Assert(t).AreEqual(stanza.Location, "https://localhost:4444/worker.tar.gz", "Returned the wrong launchable")
+
+	_, err = manifest.LaunchableByID("missing")
+	Assert(t).AreEqual(err, ErrLaunchableNotFound, "Expected ErrLaunchableNotFound for a missing launchable")
+
+	_, err = NewBuilder().GetManifest().LaunchableByID("web")
+	Assert(t).AreEqual(err, ErrLaunchableNotFound, "Expected ErrLaunchableNotFound on an empty manifest")
+}
+
+func TestLaunchableIDsAreSorted(t *testing.T) {
+	builder := NewBuilder()
+	builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{
+		"c": {LaunchableType: "hoist"},
+		"a": {LaunchableType: "hoist"},
+		"b": {LaunchableType: "hoist"},
+	})
+	ids := builder.GetManifest().LaunchableIDs()
+	Assert(t).AreEqual(len(ids), 3, "Expected three launchable IDs")
+	for i, expected := range []launch.LaunchableID{"a", "b", "c"} {
+		Assert(t).AreEqual(ids[i], expected, "Launchable IDs were not sorted")
+	}
+
+	Assert(t).AreEqual(len(NewBuilder().GetManifest().LaunchableIDs()), 0, "Expected no IDs for an empty manifest")
+}
+
 func TestNilPodManifestHasEmptySHA(t *testing.T) {
 	var manifest *manifest
 	content, err := manifest.SHA()
@@ -386,3 +424,112 @@ func TestArtifactRegistryOverride(t *testing.T) {
 		t.Error("Expected registry override to occur, but didn't find one")
 	}
 }
+
+func TestNodeRequirements(t *testing.T) {
+	manifest, err := FromBytes([]byte("id: thepod\nnode_requirements:\n  gpu: \"true\"\n"))
+	Assert(t).IsNil(err, "Should have parsed the manifest")
+	Assert(t).AreEqual(manifest.GetNodeRequirements()["gpu"], "true", "Should have read node_requirements")
+}
+
+func TestValidManifestReportsEveryProblem(t *testing.T) {
+	builder := NewBuilder()
+	builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{
+		"app": {
+			LaunchableType: "hoist",
+			Location:       "https://localhost/app_abc123.tar.gz",
+			Version:        launch.LaunchableVersion{ID: "abc123"},
+		},
+		"worker": {
+			Location: "https://localhost/worker_abc123.tar.gz",
+		},
+	})
+
+	// no id, both location and version on app, and no type on worker
+	err := ValidManifest(builder.GetManifest())
+	multiErr, ok := err.(*util.MultiError)
+	if !ok {
+		t.Fatalf("expected a *util.MultiError, got %v", err)
+	}
+	if len(multiErr.Errors) != 3 {
+		t.Errorf("expected 3 errors, got %d: %s", len(multiErr.Errors), multiErr)
+	}
+}
+
+func TestValidManifestRequiresPinnedImages(t *testing.T) {
+	builder := NewBuilder()
+	builder.SetID("web")
+	builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{
+		"web": {
+			LaunchableType: "docker",
+			Location:       "registry.example.com/team/web@sha256:" + strings.Repeat("ab", 32),
+		},
+	})
+	err := ValidManifest(builder.GetManifest())
+	if err != nil {
+		t.Errorf("expected an image pinned to a digest to be valid, got %s", err)
+	}
+
+	builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{
+		"web": {
+			LaunchableType: "docker",
+			Location:       "registry.example.com/team/web:latest",
+		},
+	})
+	err = ValidManifest(builder.GetManifest())
+	if err == nil {
+		t.Error("expected an image pinned only to a tag to be invalid")
+	}
+}
+
+func TestWithLaunchable(t *testing.T) {
+	builder := NewBuilder()
+	builder.SetID("hello")
+	builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{
+		"app": {LaunchableType: "hoist", Location: "https://localhost/app_abc123.tar.gz"},
+	})
+	original := builder.GetManifest()
+
+	added := original.WithLaunchable("worker", launch.LaunchableStanza{LaunchableType: "hoist", Location: "https://localhost/worker_abc123.tar.gz"})
+	if len(added.GetLaunchableStanzas()) != 2 {
+		t.Errorf("expected 2 launchables after adding one, got %d", len(added.GetLaunchableStanzas()))
+	}
+	replaced := added.WithLaunchable("app", launch.LaunchableStanza{LaunchableType: "hoist", Location: "https://localhost/app_def456.tar.gz"})
+	if len(replaced.GetLaunchableStanzas()) != 2 {
+		t.Errorf("expected 2 launchables after replacing one, got %d", len(replaced.GetLaunchableStanzas()))
+	}
+	if location := replaced.GetLaunchableStanzas()["app"].Location; location != "https://localhost/app_def456.tar.gz" {
+		t.Errorf("expected app to be replaced, its location is %s", location)
+	}
+
+	if len(original.GetLaunchableStanzas()) != 1 {
+		t.Errorf("expected the original manifest to be unmodified, it has %d launchables", len(original.GetLaunchableStanzas()))
+	}
+	if location := added.GetLaunchableStanzas()["app"].Location; location != "https://localhost/app_abc123.tar.gz" {
+		t.Errorf("expected replacing app not to modify the manifest it was replaced in, its location is %s", location)
+	}
+}
+
+func TestWithoutLaunchable(t *testing.T) {
+	builder := NewBuilder()
+	builder.SetID("hello")
+	builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{
+		"app":    {LaunchableType: "hoist", Location: "https://localhost/app_abc123.tar.gz"},
+		"worker": {LaunchableType: "hoist", Location: "https://localhost/worker_abc123.tar.gz"},
+	})
+	original := builder.GetManifest()
+
+	removed := original.WithoutLaunchable("worker")
+	if len(removed.GetLaunchableStanzas()) != 1 {
+		t.Errorf("expected 1 launchable after removing one, got %d", len(removed.GetLaunchableStanzas()))
+	}
+	if _, err := removed.LaunchableByID("worker"); err != ErrLaunchableNotFound {
+		t.Errorf("expected worker to be removed, got %v", err)
+	}
+	if len(original.GetLaunchableStanzas()) != 2 {
+		t.Errorf("expected the original manifest to be unmodified, it has %d launchables", len(original.GetLaunchableStanzas()))
+	}
+
+	if len(removed.WithoutLaunchable("missing").GetLaunchableStanzas()) != 1 {
+		t.Error("expected removing a missing launchable to leave the others")
+	}
+}
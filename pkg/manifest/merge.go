@@ -0,0 +1,49 @@
+package manifest
+
+import (
+	"github.com/square/p2/pkg/util"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Merge returns the manifest with overlay, a partial manifest in YAML, merged
+// on top of it, e.g. to apply environment specific settings to a base
+// manifest. Maps are merged key by key, recursively, so that an overlay can
+// change a single env var of a launchable. Any other value in the overlay,
+// including a list, replaces the base's value. The merged manifest is
+// unsigned.
+func (manifest *manifest) Merge(overlay []byte) (Manifest, error) {
+	fields, err := manifest.genericFields()
+	if err != nil {
+		return nil, err
+	}
+	var overlayFields map[interface{}]interface{}
+	err = yaml.Unmarshal(overlay, &overlayFields)
+	if err != nil {
+		return nil, util.Errorf("Could not unmarshal overlay for %s: %s", manifest.ID(), err)
+	}
+
+	mergedBytes, err := yaml.Marshal(mergeValue(fields, overlayFields))
+	if err != nil {
+		return nil, util.Errorf("Could not marshal merged manifest for %s: %s", manifest.ID(), err)
+	}
+	return FromBytes(mergedBytes)
+}
+
+// mergeValue merges overlay on top of base, recursing into maps.
+func mergeValue(base interface{}, overlay interface{}) interface{} {
+	baseMap, baseIsMap := base.(map[interface{}]interface{})
+	overlayMap, overlayIsMap := overlay.(map[interface{}]interface{})
+	if !baseIsMap || !overlayIsMap {
+		return overlay
+	}
+
+	merged := make(map[interface{}]interface{}, len(baseMap)+len(overlayMap))
+	for key, value := range baseMap {
+		merged[key] = value
+	}
+	for key, value := range overlayMap {
+		merged[key] = mergeValue(baseMap[key], value)
+	}
+	return merged
+}
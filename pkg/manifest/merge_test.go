@@ -0,0 +1,55 @@
+package manifest
+
+import (
+	"testing"
+
+	"github.com/square/p2/pkg/launch"
+)
+
+func TestMerge(t *testing.T) {
+	builder := NewBuilder()
+	builder.SetID("myapp")
+	builder.SetRunAsUser("myapp")
+	builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{
+		"app": {
+			LaunchableType: "hoist",
+			Location:       "https://localhost/myapp_abc123.tar.gz",
+			Env:            map[string]string{"LOG_LEVEL": "debug", "PORT": "8080"},
+		},
+	})
+	base := builder.GetManifest()
+
+	merged, err := base.Merge([]byte(`
+launchables:
+  app:
+    env:
+      LOG_LEVEL: info
+status_port: 8081
+`))
+	if err != nil {
+		t.Fatalf("Unexpected error merging: %s", err)
+	}
+
+	app := merged.GetLaunchableStanzas()["app"]
+	if app.Env["LOG_LEVEL"] != "info" {
+		t.Errorf("Expected the overlay to set LOG_LEVEL to info, was %q", app.Env["LOG_LEVEL"])
+	}
+	if app.Env["PORT"] != "8080" || app.Location != "https://localhost/myapp_abc123.tar.gz" {
+		t.Errorf("Expected the rest of the launchable to be kept, got %+v", app)
+	}
+	if merged.GetStatusPort() != 8081 || merged.RunAsUser() != "myapp" {
+		t.Errorf("Expected the overlay's status port and the base's run_as, got %d and %s", merged.GetStatusPort(), merged.RunAsUser())
+	}
+
+	if base.GetLaunchableStanzas()["app"].Env["LOG_LEVEL"] != "debug" {
+		t.Error("Expected the base manifest to be unmodified")
+	}
+}
+
+func TestMergeInvalidOverlay(t *testing.T) {
+	builder := NewBuilder()
+	builder.SetID("myapp")
+	if _, err := builder.GetManifest().Merge([]byte("- not a map")); err == nil {
+		t.Error("Expected an error merging an overlay that isn't a map")
+	}
+}
@@ -0,0 +1,219 @@
+package manifest
+
+import (
+	"time"
+
+	"github.com/square/p2/pkg/cgroups"
+	"github.com/square/p2/pkg/launch"
+	manifest_protos "github.com/square/p2/pkg/manifest/protos"
+	"github.com/square/p2/pkg/runit"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+	"github.com/square/p2/pkg/util/size"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ToProto converts the manifest to its protocol buffer representation. The
+// manifest's signature, if any, is not included.
+func (manifest *manifest) ToProto() (*manifest_protos.PodManifest, error) {
+	pb := &manifest_protos.PodManifest{
+		Id:                   manifest.Id.String(),
+		RunAs:                manifest.RunAs,
+		StatusPort:           int64(manifest.StatusPort),
+		StatusHttp:           manifest.StatusHTTP,
+		ArtifactRegistry:     manifest.ArtifactRegistryURL,
+		NodeRequirements:     copyStringMap(manifest.NodeRequirements),
+		ArtifactVerification: manifest.ArtifactVerification,
+		TemplateVars:         copyStringMap(manifest.TemplateVars),
+		Status: &manifest_protos.StatusStanza{
+			Http:          manifest.Status.HTTP,
+			Path:          manifest.Status.Path,
+			Port:          int64(manifest.Status.Port),
+			LocalhostOnly: manifest.Status.LocalhostOnly,
+			Type:          manifest.Status.Type,
+			Command:       manifest.Status.Command,
+		},
+		ResourceLimits: &manifest_protos.ResourceLimitsStanza{},
+	}
+
+	if manifest.Config != nil {
+		config, err := yaml.Marshal(manifest.Config)
+		if err != nil {
+			return nil, util.Errorf("Could not marshal config of %s: %s", manifest.Id, err)
+		}
+		pb.Config = string(config)
+	}
+
+	if manifest.ResourceLimits.Cgroup != nil {
+		pb.ResourceLimits.Cgroup = cgroupToProto(*manifest.ResourceLimits.Cgroup)
+	}
+
+	if manifest.ReadOnly != nil {
+		pb.Readonly = &manifest_protos.OptionalBool{Value: *manifest.ReadOnly}
+	}
+
+	if manifest.LaunchableStanzas != nil {
+		pb.Launchables = make(map[string]*manifest_protos.LaunchableStanza, len(manifest.LaunchableStanzas))
+		for id, stanza := range manifest.LaunchableStanzas {
+			pb.Launchables[id.String()] = launchableToProto(stanza)
+		}
+	}
+
+	return pb, nil
+}
+
+// FromProto converts a protocol buffer manifest, such as one produced by
+// ToProto(), back into a Manifest.
+func FromProto(pb *manifest_protos.PodManifest) (Manifest, error) {
+	if pb == nil {
+		return nil, util.Errorf("Cannot convert a nil proto to a manifest")
+	}
+
+	manifest := &manifest{
+		Id:                   types.PodID(pb.GetId()),
+		RunAs:                pb.GetRunAs(),
+		StatusPort:           int(pb.GetStatusPort()),
+		StatusHTTP:           pb.GetStatusHttp(),
+		ArtifactRegistryURL:  pb.GetArtifactRegistry(),
+		NodeRequirements:     copyStringMap(pb.GetNodeRequirements()),
+		ArtifactVerification: pb.GetArtifactVerification(),
+		TemplateVars:         copyStringMap(pb.GetTemplateVars()),
+	}
+
+	if pb.GetConfig() != "" {
+		err := yaml.Unmarshal([]byte(pb.GetConfig()), &manifest.Config)
+		if err != nil {
+			return nil, util.Errorf("Could not unmarshal config of %s: %s", pb.GetId(), err)
+		}
+	}
+
+	if status := pb.GetStatus(); status != nil {
+		manifest.Status = StatusStanza{
+			HTTP:          status.GetHttp(),
+			Path:          status.GetPath(),
+			Port:          int(status.GetPort()),
+			LocalhostOnly: status.GetLocalhostOnly(),
+			Type:          status.GetType(),
+			Command:       status.GetCommand(),
+		}
+	}
+
+	if cgroup := pb.GetResourceLimits().GetCgroup(); cgroup != nil {
+		config := cgroupFromProto(cgroup)
+		manifest.ResourceLimits.Cgroup = &config
+	}
+
+	if readonly := pb.GetReadonly(); readonly != nil {
+		value := readonly.GetValue()
+		manifest.ReadOnly = &value
+	}
+
+	if pb.GetLaunchables() != nil {
+		manifest.LaunchableStanzas = make(map[launch.LaunchableID]launch.LaunchableStanza, len(pb.GetLaunchables()))
+		for id, stanza := range pb.GetLaunchables() {
+			manifest.LaunchableStanzas[launch.LaunchableID(id)] = launchableFromProto(stanza)
+		}
+	}
+
+	return manifest, nil
+}
+
+func launchableToProto(stanza launch.LaunchableStanza) *manifest_protos.LaunchableStanza {
+	pb := &manifest_protos.LaunchableStanza{
+		LaunchableType:          stanza.LaunchableType,
+		DigestLocation:          stanza.DigestLocation,
+		DigestSignatureLocation: stanza.DigestSignatureLocation,
+		RestartTimeout:          stanza.RestartTimeout,
+		Cgroup:                  cgroupToProto(stanza.CgroupConfig),
+		Env:                     copyStringMap(stanza.Env),
+		RestartPolicy:           string(stanza.RestartPolicy_),
+		NoHaltOnUpdate:          stanza.NoHaltOnUpdate,
+		EntryPoints:             stanza.EntryPoints,
+		Location:                stanza.Location,
+		Version: &manifest_protos.LaunchableVersion{
+			ArtifactName: stanza.Version.ArtifactOverride.String(),
+			Id:           stanza.Version.ID.String(),
+			Tags:         copyStringMap(stanza.Version.Tags),
+		},
+		ExpectedDirChecksum: stanza.ExpectedDirChecksum,
+		Sockets:             stanza.Sockets,
+		ArtifactDigest:      stanza.ArtifactDigest,
+		ArtifactSignature:   stanza.ArtifactSignature,
+	}
+	if backoff := stanza.RestartBackoff; backoff != nil {
+		pb.RestartBackoff = &manifest_protos.RestartBackoff{
+			Initial:    int64(backoff.Initial),
+			Max:        int64(backoff.Max),
+			ResetAfter: int64(backoff.ResetAfter),
+		}
+	}
+	return pb
+}
+
+func launchableFromProto(pb *manifest_protos.LaunchableStanza) launch.LaunchableStanza {
+	stanza := launch.LaunchableStanza{
+		LaunchableType:          pb.GetLaunchableType(),
+		DigestLocation:          pb.GetDigestLocation(),
+		DigestSignatureLocation: pb.GetDigestSignatureLocation(),
+		RestartTimeout:          pb.GetRestartTimeout(),
+		Env:                     copyStringMap(pb.GetEnv()),
+		RestartPolicy_:          runit.RestartPolicy(pb.GetRestartPolicy()),
+		NoHaltOnUpdate:          pb.GetNoHaltOnUpdate(),
+		EntryPoints:             pb.GetEntryPoints(),
+		Location:                pb.GetLocation(),
+		ExpectedDirChecksum:     pb.GetExpectedDirChecksum(),
+		Sockets:                 pb.GetSockets(),
+		ArtifactDigest:          pb.GetArtifactDigest(),
+		ArtifactSignature:       pb.GetArtifactSignature(),
+	}
+	if cgroup := pb.GetCgroup(); cgroup != nil {
+		stanza.CgroupConfig = cgroupFromProto(cgroup)
+	}
+	if backoff := pb.GetRestartBackoff(); backoff != nil {
+		stanza.RestartBackoff = &runit.RestartBackoff{
+			Initial:    time.Duration(backoff.GetInitial()),
+			Max:        time.Duration(backoff.GetMax()),
+			ResetAfter: time.Duration(backoff.GetResetAfter()),
+		}
+	}
+	if version := pb.GetVersion(); version != nil {
+		stanza.Version = launch.LaunchableVersion{
+			ArtifactOverride: launch.ArtifactName(version.GetArtifactName()),
+			ID:               launch.LaunchableVersionID(version.GetId()),
+			Tags:             copyStringMap(version.GetTags()),
+		}
+	}
+	return stanza
+}
+
+func cgroupToProto(config cgroups.Config) *manifest_protos.CgroupConfig {
+	return &manifest_protos.CgroupConfig{
+		Cpus:      int64(config.CPUs),
+		Memory:    int64(config.Memory),
+		CpuShares: int64(config.CPUShares),
+		Pids:      int64(config.Pids),
+		IoWeight:  int64(config.IOWeight),
+	}
+}
+
+func cgroupFromProto(pb *manifest_protos.CgroupConfig) cgroups.Config {
+	return cgroups.Config{
+		CPUs:      int(pb.GetCpus()),
+		Memory:    size.ByteCount(pb.GetMemory()),
+		CPUShares: int(pb.GetCpuShares()),
+		Pids:      int(pb.GetPids()),
+		IOWeight:  int(pb.GetIoWeight()),
+	}
+}
+
+func copyStringMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	ret := make(map[string]string, len(m))
+	for k, v := range m {
+		ret[k] = v
+	}
+	return ret
+}
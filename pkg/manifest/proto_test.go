@@ -0,0 +1,187 @@
+package manifest
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/cgroups"
+	"github.com/square/p2/pkg/launch"
+	manifest_protos "github.com/square/p2/pkg/manifest/protos"
+	"github.com/square/p2/pkg/runit"
+	"github.com/square/p2/pkg/util/size"
+
+	"github.com/golang/protobuf/proto"
+)
+
+func TestProtoRoundTrip(t *testing.T) {
+	builder := NewBuilder()
+	builder.SetID("hello")
+	builder.SetRunAsUser("hello-user")
+	builder.SetStatusHTTP(true)
+	builder.SetStatusPath("/_status")
+	builder.SetStatusPort(8000)
+	builder.SetArtifactVerification("none")
+	builder.SetNodeRequirements(map[string]string{"environment": "staging"})
+	builder.SetTemplateVars(map[string]string{"REPLICAS": "3"})
+	builder.SetResourceLimits(ResourceLimitsStanza{
+		Cgroup: &cgroups.Config{CPUs: 4, Memory: 2 * size.Gibibyte, CPUShares: 2048, Pids: 1000, IOWeight: 100},
+	})
+	err := builder.SetConfig(map[interface{}]interface{}{
+		"port":  8080,
+		"names": []interface{}{"a", "b"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{
+		"app": {
+			LaunchableType:          "hoist",
+			DigestLocation:          "https://example.com/app.digest",
+			DigestSignatureLocation: "https://example.com/app.digest.sig",
+			RestartTimeout:          "10s",
+			CgroupConfig:            cgroups.Config{CPUs: 2, Memory: size.Gibibyte, CPUShares: 512, Pids: 100, IOWeight: 200},
+			Env:                     map[string]string{"FOO": "bar"},
+			RestartPolicy_:          runit.RestartPolicyNever,
+			RestartBackoff:          &runit.RestartBackoff{Initial: time.Second, Max: time.Minute, ResetAfter: time.Hour},
+			Sockets:                 []string{"8080"},
+			NoHaltOnUpdate:          true,
+			EntryPoints:             []string{"bin/launch", "bin/worker"},
+			Location:                "https://example.com/app_abc.tar.gz",
+			ExpectedDirChecksum:     "abc123",
+			ArtifactDigest:          "def456",
+			ArtifactSignature:       "signature",
+			Version: launch.LaunchableVersion{
+				ArtifactOverride: "app-artifact",
+				ID:               "1.2.3",
+				Tags:             map[string]string{"branch": "master"},
+			},
+		},
+	})
+	original := builder.GetManifest()
+	original.SetReadOnlyIfUnset(true)
+	// These have no builder methods
+	original.(*manifest).StatusPort = 8001
+	original.(*manifest).StatusHTTP = true
+	original.(*manifest).Status.LocalhostOnly = true
+	original.(*manifest).Status.Type = StatusCheckExec
+	original.(*manifest).Status.Command = "curl -f localhost:8000/_status"
+	original.(*manifest).ArtifactRegistryURL = "https://registry.example.com"
+	assertEveryFieldSet(t, reflect.ValueOf(*original.(*manifest)), "manifest")
+
+	pb, err := original.ToProto()
+	if err != nil {
+		t.Fatalf("Could not convert manifest to proto: %s", err)
+	}
+	// Also round trip the wire format to make sure nothing is lost in
+	// the encoding itself
+	data, err := proto.Marshal(pb)
+	if err != nil {
+		t.Fatalf("Could not marshal proto: %s", err)
+	}
+	decoded := &manifest_protos.PodManifest{}
+	err = proto.Unmarshal(data, decoded)
+	if err != nil {
+		t.Fatalf("Could not unmarshal proto: %s", err)
+	}
+
+	roundTripped, err := FromProto(decoded)
+	if err != nil {
+		t.Fatalf("Could not convert proto to manifest: %s", err)
+	}
+
+	if roundTripped.ID() != original.ID() {
+		t.Errorf("expected ID %s, got %s", original.ID(), roundTripped.ID())
+	}
+	if roundTripped.RunAsUser() != original.RunAsUser() {
+		t.Errorf("expected run_as %s, got %s", original.RunAsUser(), roundTripped.RunAsUser())
+	}
+	if roundTripped.GetStatusStanza() != original.GetStatusStanza() {
+		t.Errorf("expected status %+v, got %+v", original.GetStatusStanza(), roundTripped.GetStatusStanza())
+	}
+	if roundTripped.GetStatusPort() != original.GetStatusPort() || roundTripped.GetStatusHTTP() != original.GetStatusHTTP() {
+		t.Errorf("expected status port %d and http %t, got %d and %t", original.GetStatusPort(), original.GetStatusHTTP(), roundTripped.GetStatusPort(), roundTripped.GetStatusHTTP())
+	}
+	if roundTripped.GetArtifactVerification() != original.GetArtifactVerification() {
+		t.Errorf("expected artifact verification %q, got %q", original.GetArtifactVerification(), roundTripped.GetArtifactVerification())
+	}
+	if !roundTripped.GetReadOnly() {
+		t.Error("expected readonly to be preserved")
+	}
+	if !reflect.DeepEqual(roundTripped.GetNodeRequirements(), original.GetNodeRequirements()) {
+		t.Errorf("expected node requirements %v, got %v", original.GetNodeRequirements(), roundTripped.GetNodeRequirements())
+	}
+	if !reflect.DeepEqual(roundTripped.GetResourceLimits(), original.GetResourceLimits()) {
+		t.Errorf("expected resource limits %+v, got %+v", original.GetResourceLimits(), roundTripped.GetResourceLimits())
+	}
+	if !reflect.DeepEqual(roundTripped.GetConfig(), original.GetConfig()) {
+		t.Errorf("expected config %v, got %v", original.GetConfig(), roundTripped.GetConfig())
+	}
+	if !reflect.DeepEqual(roundTripped.GetLaunchableStanzas(), original.GetLaunchableStanzas()) {
+		t.Errorf("expected launchables %+v, got %+v", original.GetLaunchableStanzas(), roundTripped.GetLaunchableStanzas())
+	}
+
+	// Compare everything, so that fields added to the manifest later are
+	// covered too
+	expected := *original.(*manifest)
+	actual := *roundTripped.(*manifest)
+	expected.raw, actual.raw = nil, nil
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected the round tripped manifest to equal\n%+v\ngot\n%+v", expected, actual)
+	}
+
+	originalSHA, err := original.SHA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	roundTrippedSHA, err := roundTripped.SHA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if originalSHA != roundTrippedSHA {
+		t.Errorf("expected the round tripped manifest to have the same SHA")
+	}
+}
+
+// assertEveryFieldSet fails the test if any exported field of v, or of the
+// structs it contains, has its zero value. Fields that aren't part of the
+// manifest, i.e. are tagged yaml:"-", are skipped.
+func assertEveryFieldSet(t *testing.T, v reflect.Value, path string) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			t.Errorf("%s is not set, the round trip test should set every field", path)
+			return
+		}
+		assertEveryFieldSet(t, v.Elem(), path)
+	case reflect.Map:
+		if v.Len() == 0 {
+			t.Errorf("%s is not set, the round trip test should set every field", path)
+		}
+		if v.Type().Elem().Kind() == reflect.Struct {
+			for _, key := range v.MapKeys() {
+				assertEveryFieldSet(t, v.MapIndex(key), fmt.Sprintf("%s[%v]", path, key))
+			}
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" || field.Tag.Get("yaml") == "-" {
+				continue
+			}
+			assertEveryFieldSet(t, v.Field(i), path+"."+field.Name)
+		}
+	default:
+		if reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface()) {
+			t.Errorf("%s is not set, the round trip test should set every field", path)
+		}
+	}
+}
+
+func TestFromProtoRejectsNil(t *testing.T) {
+	_, err := FromProto(nil)
+	if err == nil {
+		t.Error("expected an error converting a nil proto")
+	}
+}
@@ -0,0 +1,570 @@
+// Code generated by protoc-gen-go.
+// source: pkg/manifest/protos/manifest.proto
+// DO NOT EDIT!
+
+/*
+Package manifest_protos is a generated protocol buffer package.
+
+It is generated from these files:
+
+	pkg/manifest/protos/manifest.proto
+
+It has these top-level messages:
+
+	PodManifest
+	LaunchableStanza
+	LaunchableVersion
+	StatusStanza
+	ResourceLimitsStanza
+	CgroupConfig
+	OptionalBool
+	RestartBackoff
+*/
+package manifest_protos
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+
+type PodManifest struct {
+	Id                   string                       `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	RunAs                string                       `protobuf:"bytes,2,opt,name=run_as,json=runAs" json:"run_as,omitempty"`
+	Launchables          map[string]*LaunchableStanza `protobuf:"bytes,3,rep,name=launchables" json:"launchables,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Config               string                       `protobuf:"bytes,4,opt,name=config" json:"config,omitempty"`
+	StatusPort           int64                        `protobuf:"varint,5,opt,name=status_port,json=statusPort" json:"status_port,omitempty"`
+	StatusHttp           bool                         `protobuf:"varint,6,opt,name=status_http,json=statusHttp" json:"status_http,omitempty"`
+	Status               *StatusStanza                `protobuf:"bytes,7,opt,name=status" json:"status,omitempty"`
+	ResourceLimits       *ResourceLimitsStanza        `protobuf:"bytes,8,opt,name=resource_limits,json=resourceLimits" json:"resource_limits,omitempty"`
+	Readonly             *OptionalBool                `protobuf:"bytes,9,opt,name=readonly" json:"readonly,omitempty"`
+	ArtifactRegistry     string                       `protobuf:"bytes,10,opt,name=artifact_registry,json=artifactRegistry" json:"artifact_registry,omitempty"`
+	NodeRequirements     map[string]string            `protobuf:"bytes,11,rep,name=node_requirements,json=nodeRequirements" json:"node_requirements,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	ArtifactVerification string                       `protobuf:"bytes,12,opt,name=artifact_verification,json=artifactVerification" json:"artifact_verification,omitempty"`
+	TemplateVars         map[string]string            `protobuf:"bytes,13,rep,name=template_vars,json=templateVars" json:"template_vars,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+}
+
+func (m *PodManifest) Reset()                    { *m = PodManifest{} }
+func (m *PodManifest) String() string            { return proto.CompactTextString(m) }
+func (*PodManifest) ProtoMessage()               {}
+func (*PodManifest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+
+func (m *PodManifest) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *PodManifest) GetRunAs() string {
+	if m != nil {
+		return m.RunAs
+	}
+	return ""
+}
+
+func (m *PodManifest) GetLaunchables() map[string]*LaunchableStanza {
+	if m != nil {
+		return m.Launchables
+	}
+	return nil
+}
+
+func (m *PodManifest) GetConfig() string {
+	if m != nil {
+		return m.Config
+	}
+	return ""
+}
+
+func (m *PodManifest) GetStatusPort() int64 {
+	if m != nil {
+		return m.StatusPort
+	}
+	return 0
+}
+
+func (m *PodManifest) GetStatusHttp() bool {
+	if m != nil {
+		return m.StatusHttp
+	}
+	return false
+}
+
+func (m *PodManifest) GetStatus() *StatusStanza {
+	if m != nil {
+		return m.Status
+	}
+	return nil
+}
+
+func (m *PodManifest) GetResourceLimits() *ResourceLimitsStanza {
+	if m != nil {
+		return m.ResourceLimits
+	}
+	return nil
+}
+
+func (m *PodManifest) GetReadonly() *OptionalBool {
+	if m != nil {
+		return m.Readonly
+	}
+	return nil
+}
+
+func (m *PodManifest) GetArtifactRegistry() string {
+	if m != nil {
+		return m.ArtifactRegistry
+	}
+	return ""
+}
+
+func (m *PodManifest) GetNodeRequirements() map[string]string {
+	if m != nil {
+		return m.NodeRequirements
+	}
+	return nil
+}
+
+func (m *PodManifest) GetArtifactVerification() string {
+	if m != nil {
+		return m.ArtifactVerification
+	}
+	return ""
+}
+
+func (m *PodManifest) GetTemplateVars() map[string]string {
+	if m != nil {
+		return m.TemplateVars
+	}
+	return nil
+}
+
+type LaunchableStanza struct {
+	LaunchableType          string             `protobuf:"bytes,1,opt,name=launchable_type,json=launchableType" json:"launchable_type,omitempty"`
+	DigestLocation          string             `protobuf:"bytes,2,opt,name=digest_location,json=digestLocation" json:"digest_location,omitempty"`
+	DigestSignatureLocation string             `protobuf:"bytes,3,opt,name=digest_signature_location,json=digestSignatureLocation" json:"digest_signature_location,omitempty"`
+	RestartTimeout          string             `protobuf:"bytes,4,opt,name=restart_timeout,json=restartTimeout" json:"restart_timeout,omitempty"`
+	Cgroup                  *CgroupConfig      `protobuf:"bytes,5,opt,name=cgroup" json:"cgroup,omitempty"`
+	Env                     map[string]string  `protobuf:"bytes,6,rep,name=env" json:"env,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	RestartPolicy           string             `protobuf:"bytes,7,opt,name=restart_policy,json=restartPolicy" json:"restart_policy,omitempty"`
+	NoHaltOnUpdate          bool               `protobuf:"varint,8,opt,name=no_halt_on_update,json=noHaltOnUpdate" json:"no_halt_on_update,omitempty"`
+	EntryPoints             []string           `protobuf:"bytes,9,rep,name=entry_points,json=entryPoints" json:"entry_points,omitempty"`
+	Location                string             `protobuf:"bytes,10,opt,name=location" json:"location,omitempty"`
+	Version                 *LaunchableVersion `protobuf:"bytes,11,opt,name=version" json:"version,omitempty"`
+	ExpectedDirChecksum     string             `protobuf:"bytes,12,opt,name=expected_dir_checksum,json=expectedDirChecksum" json:"expected_dir_checksum,omitempty"`
+	RestartBackoff          *RestartBackoff    `protobuf:"bytes,13,opt,name=restart_backoff,json=restartBackoff" json:"restart_backoff,omitempty"`
+	Sockets                 []string           `protobuf:"bytes,14,rep,name=sockets" json:"sockets,omitempty"`
+	ArtifactDigest          string             `protobuf:"bytes,15,opt,name=artifact_digest,json=artifactDigest" json:"artifact_digest,omitempty"`
+	ArtifactSignature       string             `protobuf:"bytes,16,opt,name=artifact_signature,json=artifactSignature" json:"artifact_signature,omitempty"`
+}
+
+func (m *LaunchableStanza) Reset()                    { *m = LaunchableStanza{} }
+func (m *LaunchableStanza) String() string            { return proto.CompactTextString(m) }
+func (*LaunchableStanza) ProtoMessage()               {}
+func (*LaunchableStanza) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
+func (m *LaunchableStanza) GetLaunchableType() string {
+	if m != nil {
+		return m.LaunchableType
+	}
+	return ""
+}
+
+func (m *LaunchableStanza) GetDigestLocation() string {
+	if m != nil {
+		return m.DigestLocation
+	}
+	return ""
+}
+
+func (m *LaunchableStanza) GetDigestSignatureLocation() string {
+	if m != nil {
+		return m.DigestSignatureLocation
+	}
+	return ""
+}
+
+func (m *LaunchableStanza) GetRestartTimeout() string {
+	if m != nil {
+		return m.RestartTimeout
+	}
+	return ""
+}
+
+func (m *LaunchableStanza) GetCgroup() *CgroupConfig {
+	if m != nil {
+		return m.Cgroup
+	}
+	return nil
+}
+
+func (m *LaunchableStanza) GetEnv() map[string]string {
+	if m != nil {
+		return m.Env
+	}
+	return nil
+}
+
+func (m *LaunchableStanza) GetRestartPolicy() string {
+	if m != nil {
+		return m.RestartPolicy
+	}
+	return ""
+}
+
+func (m *LaunchableStanza) GetNoHaltOnUpdate() bool {
+	if m != nil {
+		return m.NoHaltOnUpdate
+	}
+	return false
+}
+
+func (m *LaunchableStanza) GetEntryPoints() []string {
+	if m != nil {
+		return m.EntryPoints
+	}
+	return nil
+}
+
+func (m *LaunchableStanza) GetLocation() string {
+	if m != nil {
+		return m.Location
+	}
+	return ""
+}
+
+func (m *LaunchableStanza) GetVersion() *LaunchableVersion {
+	if m != nil {
+		return m.Version
+	}
+	return nil
+}
+
+func (m *LaunchableStanza) GetExpectedDirChecksum() string {
+	if m != nil {
+		return m.ExpectedDirChecksum
+	}
+	return ""
+}
+
+func (m *LaunchableStanza) GetRestartBackoff() *RestartBackoff {
+	if m != nil {
+		return m.RestartBackoff
+	}
+	return nil
+}
+
+func (m *LaunchableStanza) GetSockets() []string {
+	if m != nil {
+		return m.Sockets
+	}
+	return nil
+}
+
+func (m *LaunchableStanza) GetArtifactDigest() string {
+	if m != nil {
+		return m.ArtifactDigest
+	}
+	return ""
+}
+
+func (m *LaunchableStanza) GetArtifactSignature() string {
+	if m != nil {
+		return m.ArtifactSignature
+	}
+	return ""
+}
+
+type LaunchableVersion struct {
+	ArtifactName string            `protobuf:"bytes,1,opt,name=artifact_name,json=artifactName" json:"artifact_name,omitempty"`
+	Id           string            `protobuf:"bytes,2,opt,name=id" json:"id,omitempty"`
+	Tags         map[string]string `protobuf:"bytes,3,rep,name=tags" json:"tags,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+}
+
+func (m *LaunchableVersion) Reset()                    { *m = LaunchableVersion{} }
+func (m *LaunchableVersion) String() string            { return proto.CompactTextString(m) }
+func (*LaunchableVersion) ProtoMessage()               {}
+func (*LaunchableVersion) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+
+func (m *LaunchableVersion) GetArtifactName() string {
+	if m != nil {
+		return m.ArtifactName
+	}
+	return ""
+}
+
+func (m *LaunchableVersion) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *LaunchableVersion) GetTags() map[string]string {
+	if m != nil {
+		return m.Tags
+	}
+	return nil
+}
+
+type StatusStanza struct {
+	Http          bool   `protobuf:"varint,1,opt,name=http" json:"http,omitempty"`
+	Path          string `protobuf:"bytes,2,opt,name=path" json:"path,omitempty"`
+	Port          int64  `protobuf:"varint,3,opt,name=port" json:"port,omitempty"`
+	LocalhostOnly bool   `protobuf:"varint,4,opt,name=localhost_only,json=localhostOnly" json:"localhost_only,omitempty"`
+	Type          string `protobuf:"bytes,5,opt,name=type" json:"type,omitempty"`
+	Command       string `protobuf:"bytes,6,opt,name=command" json:"command,omitempty"`
+}
+
+func (m *StatusStanza) Reset()                    { *m = StatusStanza{} }
+func (m *StatusStanza) String() string            { return proto.CompactTextString(m) }
+func (*StatusStanza) ProtoMessage()               {}
+func (*StatusStanza) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+
+func (m *StatusStanza) GetHttp() bool {
+	if m != nil {
+		return m.Http
+	}
+	return false
+}
+
+func (m *StatusStanza) GetPath() string {
+	if m != nil {
+		return m.Path
+	}
+	return ""
+}
+
+func (m *StatusStanza) GetPort() int64 {
+	if m != nil {
+		return m.Port
+	}
+	return 0
+}
+
+func (m *StatusStanza) GetLocalhostOnly() bool {
+	if m != nil {
+		return m.LocalhostOnly
+	}
+	return false
+}
+
+func (m *StatusStanza) GetType() string {
+	if m != nil {
+		return m.Type
+	}
+	return ""
+}
+
+func (m *StatusStanza) GetCommand() string {
+	if m != nil {
+		return m.Command
+	}
+	return ""
+}
+
+type ResourceLimitsStanza struct {
+	Cgroup *CgroupConfig `protobuf:"bytes,1,opt,name=cgroup" json:"cgroup,omitempty"`
+}
+
+func (m *ResourceLimitsStanza) Reset()                    { *m = ResourceLimitsStanza{} }
+func (m *ResourceLimitsStanza) String() string            { return proto.CompactTextString(m) }
+func (*ResourceLimitsStanza) ProtoMessage()               {}
+func (*ResourceLimitsStanza) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+
+func (m *ResourceLimitsStanza) GetCgroup() *CgroupConfig {
+	if m != nil {
+		return m.Cgroup
+	}
+	return nil
+}
+
+type CgroupConfig struct {
+	Cpus      int64 `protobuf:"varint,1,opt,name=cpus" json:"cpus,omitempty"`
+	Memory    int64 `protobuf:"varint,2,opt,name=memory" json:"memory,omitempty"`
+	CpuShares int64 `protobuf:"varint,3,opt,name=cpu_shares,json=cpuShares" json:"cpu_shares,omitempty"`
+	Pids      int64 `protobuf:"varint,4,opt,name=pids" json:"pids,omitempty"`
+	IoWeight  int64 `protobuf:"varint,5,opt,name=io_weight,json=ioWeight" json:"io_weight,omitempty"`
+}
+
+func (m *CgroupConfig) Reset()                    { *m = CgroupConfig{} }
+func (m *CgroupConfig) String() string            { return proto.CompactTextString(m) }
+func (*CgroupConfig) ProtoMessage()               {}
+func (*CgroupConfig) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+
+func (m *CgroupConfig) GetCpus() int64 {
+	if m != nil {
+		return m.Cpus
+	}
+	return 0
+}
+
+func (m *CgroupConfig) GetMemory() int64 {
+	if m != nil {
+		return m.Memory
+	}
+	return 0
+}
+
+func (m *CgroupConfig) GetCpuShares() int64 {
+	if m != nil {
+		return m.CpuShares
+	}
+	return 0
+}
+
+func (m *CgroupConfig) GetPids() int64 {
+	if m != nil {
+		return m.Pids
+	}
+	return 0
+}
+
+func (m *CgroupConfig) GetIoWeight() int64 {
+	if m != nil {
+		return m.IoWeight
+	}
+	return 0
+}
+
+type OptionalBool struct {
+	Value bool `protobuf:"varint,1,opt,name=value" json:"value,omitempty"`
+}
+
+func (m *OptionalBool) Reset()                    { *m = OptionalBool{} }
+func (m *OptionalBool) String() string            { return proto.CompactTextString(m) }
+func (*OptionalBool) ProtoMessage()               {}
+func (*OptionalBool) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
+
+func (m *OptionalBool) GetValue() bool {
+	if m != nil {
+		return m.Value
+	}
+	return false
+}
+
+type RestartBackoff struct {
+	Initial    int64 `protobuf:"varint,1,opt,name=initial" json:"initial,omitempty"`
+	Max        int64 `protobuf:"varint,2,opt,name=max" json:"max,omitempty"`
+	ResetAfter int64 `protobuf:"varint,3,opt,name=reset_after,json=resetAfter" json:"reset_after,omitempty"`
+}
+
+func (m *RestartBackoff) Reset()                    { *m = RestartBackoff{} }
+func (m *RestartBackoff) String() string            { return proto.CompactTextString(m) }
+func (*RestartBackoff) ProtoMessage()               {}
+func (*RestartBackoff) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+
+func (m *RestartBackoff) GetInitial() int64 {
+	if m != nil {
+		return m.Initial
+	}
+	return 0
+}
+
+func (m *RestartBackoff) GetMax() int64 {
+	if m != nil {
+		return m.Max
+	}
+	return 0
+}
+
+func (m *RestartBackoff) GetResetAfter() int64 {
+	if m != nil {
+		return m.ResetAfter
+	}
+	return 0
+}
+
+func init() {
+	proto.RegisterType((*PodManifest)(nil), "manifest_protos.PodManifest")
+	proto.RegisterType((*LaunchableStanza)(nil), "manifest_protos.LaunchableStanza")
+	proto.RegisterType((*LaunchableVersion)(nil), "manifest_protos.LaunchableVersion")
+	proto.RegisterType((*StatusStanza)(nil), "manifest_protos.StatusStanza")
+	proto.RegisterType((*ResourceLimitsStanza)(nil), "manifest_protos.ResourceLimitsStanza")
+	proto.RegisterType((*CgroupConfig)(nil), "manifest_protos.CgroupConfig")
+	proto.RegisterType((*OptionalBool)(nil), "manifest_protos.OptionalBool")
+	proto.RegisterType((*RestartBackoff)(nil), "manifest_protos.RestartBackoff")
+}
+
+func init() { proto.RegisterFile("pkg/manifest/protos/manifest.proto", fileDescriptor0) }
+
+var fileDescriptor0 = []byte{
+	// 1068 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x56, 0xef, 0x6e, 0xdb, 0x36,
+	0x10, 0x87, 0xe3, 0xc4, 0xb1, 0xcf, 0x7f, 0xe2, 0x70, 0xc9, 0xa6, 0x65, 0x28, 0xea, 0x7a, 0x2b,
+	0xea, 0xfd, 0xa9, 0x0b, 0xa4, 0xd8, 0xba, 0x15, 0x05, 0xb6, 0x36, 0x2d, 0x90, 0x0f, 0x69, 0x12,
+	0x28, 0x59, 0xf6, 0x69, 0x10, 0x18, 0x89, 0xb6, 0x89, 0x48, 0xa4, 0x46, 0x52, 0x5e, 0xbd, 0x47,
+	0xd8, 0x4b, 0x0c, 0xd8, 0x3b, 0xec, 0x09, 0xf6, 0x62, 0x03, 0x4f, 0x94, 0xac, 0xc5, 0x69, 0x8a,
+	0x7c, 0xe3, 0xfd, 0xee, 0x0f, 0x8f, 0xbc, 0xfb, 0xf1, 0x08, 0xc3, 0xf4, 0x6a, 0xfa, 0x24, 0xa1,
+	0x82, 0x4f, 0x98, 0x36, 0x4f, 0x52, 0x25, 0x8d, 0xd4, 0xa5, 0x3c, 0x46, 0x99, 0x6c, 0x15, 0x72,
+	0x90, 0xeb, 0x87, 0x7f, 0x6f, 0x42, 0xfb, 0x54, 0x46, 0x6f, 0x1d, 0x4c, 0x7a, 0xb0, 0xc6, 0x23,
+	0xaf, 0x36, 0xa8, 0x8d, 0x5a, 0xfe, 0x1a, 0x8f, 0xc8, 0x2e, 0x34, 0x54, 0x26, 0x02, 0xaa, 0xbd,
+	0x35, 0xc4, 0x36, 0x54, 0x26, 0x5e, 0x6a, 0x72, 0x02, 0xed, 0x98, 0x66, 0x22, 0x9c, 0xd1, 0xcb,
+	0x98, 0x69, 0xaf, 0x3e, 0xa8, 0x8f, 0xda, 0xfb, 0x8f, 0xc7, 0xd7, 0xa2, 0x8f, 0x2b, 0x91, 0xc7,
+	0x47, 0x4b, 0xfb, 0x37, 0xc2, 0xa8, 0x85, 0x5f, 0x8d, 0x40, 0x3e, 0x86, 0x46, 0x28, 0xc5, 0x84,
+	0x4f, 0xbd, 0x75, 0xdc, 0xc7, 0x49, 0xe4, 0x3e, 0xb4, 0xb5, 0xa1, 0x26, 0xd3, 0x41, 0x2a, 0x95,
+	0xf1, 0x36, 0x06, 0xb5, 0x51, 0xdd, 0x87, 0x1c, 0x3a, 0x95, 0xca, 0x54, 0x0c, 0x66, 0xc6, 0xa4,
+	0x5e, 0x63, 0x50, 0x1b, 0x35, 0x0b, 0x83, 0x43, 0x63, 0x52, 0xf2, 0x2d, 0x34, 0x72, 0xc9, 0xdb,
+	0x1c, 0xd4, 0x46, 0xed, 0xfd, 0x7b, 0x2b, 0x59, 0x9e, 0xa1, 0xfa, 0xcc, 0x50, 0xf1, 0x07, 0xf5,
+	0x9d, 0x31, 0x39, 0x86, 0x2d, 0xc5, 0xb4, 0xcc, 0x54, 0xc8, 0x82, 0x98, 0x27, 0xdc, 0x68, 0xaf,
+	0x89, 0xfe, 0x0f, 0x57, 0xfc, 0x7d, 0x67, 0x77, 0x84, 0x66, 0x2e, 0x4e, 0x4f, 0xfd, 0x0f, 0x25,
+	0x3f, 0x40, 0x53, 0x31, 0x1a, 0x49, 0x11, 0x2f, 0xbc, 0xd6, 0x7b, 0x12, 0x39, 0x49, 0x0d, 0x97,
+	0x82, 0xc6, 0xaf, 0xa4, 0x8c, 0xfd, 0xd2, 0x9c, 0x7c, 0x0d, 0xdb, 0x54, 0x19, 0x3e, 0xa1, 0xa1,
+	0x09, 0x14, 0x9b, 0x72, 0x6d, 0xd4, 0xc2, 0x03, 0xbc, 0xa6, 0x7e, 0xa1, 0xf0, 0x1d, 0x4e, 0x02,
+	0xd8, 0x16, 0x32, 0x62, 0x81, 0x62, 0xbf, 0x65, 0x5c, 0xb1, 0x84, 0x09, 0xa3, 0xbd, 0x36, 0xd6,
+	0x67, 0xff, 0xd6, 0xfa, 0x1c, 0xcb, 0x88, 0xf9, 0x15, 0xa7, 0xbc, 0x48, 0x7d, 0x71, 0x0d, 0x26,
+	0x4f, 0x61, 0xb7, 0xcc, 0x66, 0xce, 0x14, 0x9f, 0xf0, 0x90, 0xda, 0xb4, 0xbd, 0x0e, 0x66, 0xb4,
+	0x53, 0x28, 0x2f, 0x2a, 0x3a, 0x72, 0x06, 0x5d, 0xc3, 0x92, 0x34, 0xa6, 0x86, 0x05, 0x73, 0xaa,
+	0xb4, 0xd7, 0xc5, 0x8c, 0xc6, 0xb7, 0x66, 0x74, 0xee, 0x3c, 0x2e, 0xa8, 0x72, 0xd9, 0x74, 0x4c,
+	0x05, 0xda, 0xa3, 0xd0, 0xbf, 0xde, 0x54, 0xa4, 0x0f, 0xf5, 0x2b, 0xb6, 0x70, 0x0d, 0x6c, 0x97,
+	0xe4, 0x19, 0x6c, 0xcc, 0x69, 0x9c, 0x31, 0x6c, 0xe0, 0xf6, 0xfe, 0x83, 0x95, 0x2d, 0x97, 0x31,
+	0x5c, 0xe9, 0x72, 0xfb, 0xe7, 0x6b, 0xdf, 0xd7, 0xf6, 0x0e, 0x60, 0xf7, 0xc6, 0x7b, 0xb9, 0x61,
+	0x9f, 0x9d, 0xea, 0x3e, 0xad, 0x6a, 0x90, 0x1f, 0x61, 0x7b, 0xe5, 0x28, 0x77, 0x09, 0x30, 0xfc,
+	0xa7, 0x01, 0xfd, 0xeb, 0x59, 0x92, 0x47, 0xb0, 0xb5, 0x24, 0x50, 0x60, 0x16, 0x29, 0x73, 0xc1,
+	0x7a, 0x4b, 0xf8, 0x7c, 0x91, 0x32, 0x6b, 0x18, 0xf1, 0xa9, 0x3d, 0x70, 0x2c, 0x5d, 0xa9, 0xf2,
+	0x1d, 0x7a, 0x39, 0x7c, 0xe4, 0x50, 0xf2, 0x1c, 0x3e, 0x75, 0x86, 0x9a, 0x4f, 0x05, 0x35, 0x99,
+	0x62, 0x4b, 0x97, 0x3a, 0xba, 0x7c, 0x92, 0x1b, 0x9c, 0x15, 0xfa, 0xd2, 0xf7, 0x11, 0xd2, 0xc5,
+	0x50, 0x65, 0x02, 0xc3, 0x13, 0x26, 0x33, 0xe3, 0x88, 0xdc, 0x73, 0xf0, 0x79, 0x8e, 0x5a, 0x3a,
+	0x86, 0x53, 0x25, 0xb3, 0xd4, 0xdb, 0x78, 0x0f, 0x0b, 0x0e, 0x50, 0x7d, 0x80, 0xfc, 0xf7, 0x9d,
+	0x31, 0x79, 0x01, 0x75, 0x26, 0xe6, 0x5e, 0x03, 0xdb, 0xe6, 0xab, 0x0f, 0xd6, 0x70, 0xfc, 0x46,
+	0xcc, 0xf3, 0x96, 0xb1, 0x6e, 0xe4, 0x21, 0x14, 0x69, 0x04, 0xa9, 0x8c, 0x79, 0xb8, 0xc0, 0xb7,
+	0xa0, 0xe5, 0x77, 0x1d, 0x7a, 0x8a, 0x20, 0xf9, 0xd2, 0x72, 0x27, 0x98, 0xd1, 0xd8, 0x04, 0x52,
+	0x04, 0x59, 0x1a, 0x51, 0xc3, 0x90, 0xf5, 0x4d, 0xbf, 0x27, 0xe4, 0x21, 0x8d, 0xcd, 0x89, 0xf8,
+	0x19, 0x51, 0xf2, 0x00, 0x3a, 0xcc, 0xc6, 0x0f, 0x52, 0xc9, 0x2d, 0xc3, 0x5a, 0x83, 0xfa, 0xa8,
+	0xe5, 0xb7, 0x11, 0x3b, 0x45, 0x88, 0xec, 0x41, 0xb3, 0xbc, 0xbd, 0x9c, 0xad, 0xa5, 0x4c, 0x5e,
+	0xc0, 0xe6, 0x9c, 0x29, 0x6d, 0x55, 0x6d, 0xbc, 0x86, 0xe1, 0x2d, 0x47, 0xba, 0xc8, 0x2d, 0xfd,
+	0xc2, 0x85, 0xec, 0xc3, 0x2e, 0x7b, 0x97, 0xb2, 0xd0, 0xb0, 0x28, 0x88, 0xb8, 0x0a, 0xc2, 0x19,
+	0x0b, 0xaf, 0x74, 0x96, 0x38, 0x0a, 0x7e, 0x54, 0x28, 0x5f, 0x73, 0x75, 0xe0, 0x54, 0xe4, 0x70,
+	0x59, 0xa0, 0x4b, 0x1a, 0x5e, 0xc9, 0xc9, 0xc4, 0xeb, 0xe2, 0xce, 0xf7, 0x6f, 0x7a, 0xcf, 0xac,
+	0xdd, 0xab, 0xdc, 0xac, 0xac, 0xa0, 0x93, 0x89, 0x07, 0x9b, 0x5a, 0x86, 0x57, 0xcc, 0x68, 0xaf,
+	0x87, 0xa7, 0x2e, 0x44, 0xdb, 0x04, 0xe5, 0xd3, 0x90, 0x37, 0x8a, 0xb7, 0x95, 0x37, 0x41, 0x01,
+	0xbf, 0x46, 0x94, 0x3c, 0x06, 0x52, 0x1a, 0x96, 0xbd, 0xe6, 0xf5, 0xd1, 0xb6, 0x7c, 0xeb, 0xca,
+	0x26, 0xdb, 0xfb, 0x0e, 0x9a, 0x45, 0x3d, 0xef, 0xc4, 0x9b, 0x7f, 0x6b, 0xb0, 0xbd, 0x72, 0x8d,
+	0xe4, 0x73, 0xe8, 0x96, 0x9b, 0x0b, 0x9a, 0x14, 0xb4, 0xe9, 0x14, 0xe0, 0x31, 0x4d, 0x98, 0x9b,
+	0x83, 0x6b, 0xe5, 0x1c, 0xfc, 0x09, 0xd6, 0x0d, 0x9d, 0x16, 0x93, 0xee, 0x9b, 0x0f, 0x57, 0x6b,
+	0x7c, 0x4e, 0xa7, 0xee, 0xd5, 0x42, 0xcf, 0xbd, 0x67, 0xd0, 0x2a, 0xa1, 0x3b, 0x9d, 0xe2, 0xaf,
+	0x1a, 0x74, 0xaa, 0x23, 0x8a, 0x10, 0x58, 0xc7, 0x59, 0x57, 0xc3, 0xce, 0xc4, 0xb5, 0xc5, 0x52,
+	0x6a, 0x66, 0xce, 0x1b, 0xd7, 0x88, 0xd9, 0xa1, 0x59, 0xc7, 0xa1, 0x89, 0x6b, 0xcb, 0x04, 0xdb,
+	0x84, 0xf1, 0x4c, 0x6a, 0xdb, 0xe4, 0xf1, 0x02, 0x69, 0xda, 0xf4, 0xbb, 0x25, 0x7a, 0x62, 0x47,
+	0x0e, 0x81, 0x75, 0x7c, 0x51, 0x36, 0xf2, 0x70, 0x76, 0x6d, 0xeb, 0x1e, 0xca, 0x24, 0xa1, 0x22,
+	0xc2, 0x29, 0xdb, 0xf2, 0x0b, 0x71, 0xf8, 0x16, 0x76, 0x6e, 0x9a, 0x81, 0x15, 0xae, 0xd7, 0xee,
+	0xc0, 0xf5, 0xe1, 0x9f, 0x35, 0xe8, 0x54, 0x15, 0x36, 0x9b, 0x30, 0xcd, 0x34, 0x46, 0xa9, 0xfb,
+	0xb8, 0xb6, 0x1f, 0x86, 0x84, 0x25, 0x52, 0x2d, 0xf0, 0xc8, 0x75, 0xdf, 0x49, 0xe4, 0x1e, 0x40,
+	0x98, 0x66, 0x81, 0x9e, 0x51, 0x85, 0x1f, 0x13, 0xab, 0x6b, 0x85, 0x69, 0x76, 0x86, 0x00, 0xde,
+	0x09, 0x8f, 0xb4, 0xb7, 0xee, 0xee, 0x84, 0x47, 0x9a, 0x7c, 0x06, 0x2d, 0x2e, 0x83, 0xdf, 0x19,
+	0x9f, 0xce, 0x8a, 0x1f, 0x46, 0x93, 0xcb, 0x5f, 0x50, 0x1e, 0x7e, 0x01, 0x9d, 0xea, 0x58, 0x5e,
+	0xd6, 0x29, 0xbf, 0xfd, 0x5c, 0x18, 0xfe, 0x0a, 0x3d, 0x7f, 0x85, 0x25, 0x5c, 0x70, 0xc3, 0x69,
+	0xec, 0xd2, 0x2e, 0x44, 0x5b, 0xfb, 0x84, 0xbe, 0x73, 0x69, 0xdb, 0xa5, 0xfd, 0xc3, 0x28, 0xa6,
+	0x99, 0x09, 0xe8, 0xc4, 0x30, 0xe5, 0x92, 0x06, 0x84, 0x5e, 0x5a, 0xe4, 0xb2, 0x81, 0xd7, 0xf5,
+	0xf4, 0xbf, 0x01, 0x00, 0xfe, 0xa0, 0xca, 0x66, 0xe3, 0x09, 0x00, 0x00,
+}
@@ -0,0 +1,38 @@
+package manifest
+
+import (
+	"bytes"
+
+	"github.com/square/p2/pkg/util"
+
+	"golang.org/x/crypto/openpgp/clearsign"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// Sign returns a copy of the manifest clearsigned with key, as a preparer
+// using "keyring" or "user" auth requires. A manifest that is already signed
+// is signed again, replacing its signature.
+func Sign(m Manifest, key *packet.PrivateKey) (Manifest, error) {
+	if _, signature := m.SignatureData(); signature != nil {
+		m = m.GetBuilder().GetManifest()
+	}
+	plaintext, err := m.Marshal()
+	if err != nil {
+		return nil, util.Errorf("Could not marshal manifest for %s: %s", m.ID(), err)
+	}
+
+	var buf bytes.Buffer
+	signer, err := clearsign.Encode(&buf, key, nil)
+	if err != nil {
+		return nil, util.Errorf("Could not sign manifest for %s: %s", m.ID(), err)
+	}
+	_, err = signer.Write(plaintext)
+	if err != nil {
+		return nil, util.Errorf("Could not sign manifest for %s: %s", m.ID(), err)
+	}
+	err = signer.Close()
+	if err != nil {
+		return nil, util.Errorf("Could not sign manifest for %s: %s", m.ID(), err)
+	}
+	return FromBytes(buf.Bytes())
+}
@@ -0,0 +1,45 @@
+package manifest
+
+import (
+	"bytes"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+func TestSign(t *testing.T) {
+	signer, err := openpgp.NewEntity("p2", "test", "p2@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder := NewBuilder()
+	builder.SetID("myapp")
+	builder.SetStatusPort(8080)
+
+	signed, err := Sign(builder.GetManifest(), signer.PrivateKey)
+	if err != nil {
+		t.Fatalf("Unexpected error signing manifest: %s", err)
+	}
+	plaintext, signature := signed.SignatureData()
+	if signature == nil {
+		t.Fatal("Expected the manifest to be signed")
+	}
+	_, err = openpgp.CheckDetachedSignature(openpgp.EntityList{signer}, bytes.NewReader(plaintext), bytes.NewReader(signature))
+	if err != nil {
+		t.Errorf("Expected a valid signature, got %s", err)
+	}
+	if signed.ID() != "myapp" || signed.GetStatusPort() != 8080 {
+		t.Errorf("Expected the signed manifest to keep its fields, got:\n%s", plaintext)
+	}
+
+	// A signed manifest can be signed again, e.g. by another key
+	resigned, err := Sign(signed, signer.PrivateKey)
+	if err != nil {
+		t.Fatalf("Unexpected error signing a signed manifest: %s", err)
+	}
+	plaintext, signature = resigned.SignatureData()
+	_, err = openpgp.CheckDetachedSignature(openpgp.EntityList{signer}, bytes.NewReader(plaintext), bytes.NewReader(signature))
+	if err != nil {
+		t.Errorf("Expected a valid signature after signing again, got %s", err)
+	}
+}
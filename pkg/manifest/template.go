@@ -0,0 +1,148 @@
+package manifest
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+
+	"github.com/square/p2/pkg/util"
+
+	"gopkg.in/yaml.v2"
+)
+
+// templateData is the data passed to the templates in a manifest, so that
+// {{ .Var "NAME" }} looks up NAME
+type templateData struct {
+	vars map[string]string
+}
+
+func (d templateData) Var(name string) (string, error) {
+	value, ok := d.vars[name]
+	if !ok {
+		return "", util.Errorf("unknown template variable %q", name)
+	}
+	return value, nil
+}
+
+// RenderTemplate substitutes variables that are only known at deploy time,
+// such as the node's IP address, into every string in the manifest that uses
+// the {{ .Var "NAME" }} syntax. The values in vars take precedence over the
+// manifest's template_vars, which act as defaults. Referring to a variable
+// that is in neither is an error.
+//
+// The rendered manifest is unsigned, and is returned as is if no strings
+// were changed.
+func (manifest *manifest) RenderTemplate(vars map[string]string) (Manifest, error) {
+	data := templateData{vars: make(map[string]string)}
+	for name, value := range manifest.TemplateVars {
+		data.vars[name] = value
+	}
+	for name, value := range vars {
+		data.vars[name] = value
+	}
+
+	// Render the fields as generic yaml so that every string is covered,
+	// including those nested in the config
+	fields, err := manifest.genericFields()
+	if err != nil {
+		return nil, err
+	}
+
+	changed := false
+	for key, value := range fields {
+		if key == "template_vars" {
+			continue
+		}
+		rendered, err := renderValue(value, data, &changed)
+		if err != nil {
+			return nil, util.Errorf("Could not render %s of %s: %s", key, manifest.ID(), err)
+		}
+		fields[key] = rendered
+	}
+	if !changed {
+		return manifest, nil
+	}
+
+	renderedBytes, err := yaml.Marshal(fields)
+	if err != nil {
+		return nil, util.Errorf("Could not marshal rendered manifest for %s: %s", manifest.ID(), err)
+	}
+	return FromBytes(renderedBytes)
+}
+
+// genericFields returns the manifest's fields as generic yaml.
+func (manifest *manifest) genericFields() (map[interface{}]interface{}, error) {
+	plain, err := yaml.Marshal(manifest)
+	if err != nil {
+		return nil, util.Errorf("Could not marshal manifest for %s: %s", manifest.ID(), err)
+	}
+	var fields map[interface{}]interface{}
+	err = yaml.Unmarshal(plain, &fields)
+	if err != nil {
+		return nil, util.Errorf("Could not unmarshal manifest for %s: %s", manifest.ID(), err)
+	}
+	return fields, nil
+}
+
+// Scrub returns a copy of the manifest without the fields that only matter
+// while it is being prepared for deployment: at the moment, its
+// template_vars. A signed manifest is copied unchanged, since removing fields
+// would invalidate its signature.
+//
+// The consul store doesn't scrub the manifests it writes, since the preparer
+// needs the template_vars in the intent tree to render them. Scrub a manifest
+// once it has been rendered, or when its templates won't be rendered again.
+func (manifest *manifest) Scrub() Manifest {
+	if manifest.signature != nil {
+		signed := *manifest
+		return &signed
+	}
+
+	builder := manifest.GetBuilder()
+	builder.SetTemplateVars(nil)
+	return builder.GetManifest()
+}
+
+// renderValue renders every string in value, recursing into maps and slices,
+// and sets *changed if any of them differ from the original.
+func renderValue(value interface{}, data templateData, changed *bool) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		if !strings.Contains(v, "{{") {
+			return v, nil
+		}
+		tmpl, err := template.New("").Parse(v)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		err = tmpl.Execute(&buf, data)
+		if err != nil {
+			return nil, err
+		}
+		if buf.String() != v {
+			*changed = true
+		}
+		return buf.String(), nil
+	case map[interface{}]interface{}:
+		for key, elem := range v {
+			rendered, err := renderValue(elem, data, changed)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = rendered
+		}
+		return v, nil
+	case []interface{}:
+		for i, elem := range v {
+			rendered, err := renderValue(elem, data, changed)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = rendered
+		}
+		return v, nil
+	default:
+		return v, nil
+	}
+}
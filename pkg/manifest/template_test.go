@@ -0,0 +1,171 @@
+package manifest
+
+import (
+	"strings"
+	"testing"
+)
+
+const templateManifest = `id: hello
+launchables:
+  app:
+    launchable_type: hoist
+    location: https://example.com/hello_abc123.tar.gz
+    env:
+      LISTEN_ADDR: '{{ .Var "LOCAL_IP" }}:8080'
+      DATACENTER: '{{ .Var "DC" }}'
+config:
+  upstreams:
+  - '{{ .Var "LOCAL_IP" }}:9090'
+template_vars:
+  DC: default-dc
+`
+
+func TestRenderTemplateSubstitutesVars(t *testing.T) {
+	original, err := FromBytes([]byte(templateManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rendered, err := original.RenderTemplate(map[string]string{"LOCAL_IP": "10.0.0.5"})
+	if err != nil {
+		t.Fatalf("Could not render manifest: %s", err)
+	}
+
+	env := rendered.GetLaunchableStanzas()["app"].Env
+	if env["LISTEN_ADDR"] != "10.0.0.5:8080" {
+		t.Errorf("expected LISTEN_ADDR to be 10.0.0.5:8080, was %q", env["LISTEN_ADDR"])
+	}
+	if env["DATACENTER"] != "default-dc" {
+		t.Errorf("expected DATACENTER to use the template_vars default, was %q", env["DATACENTER"])
+	}
+	upstreams, ok := rendered.GetConfig()["upstreams"].([]interface{})
+	if !ok || len(upstreams) != 1 || upstreams[0] != "10.0.0.5:9090" {
+		t.Errorf("expected the config to be rendered, got %v", rendered.GetConfig()["upstreams"])
+	}
+
+	if original.GetLaunchableStanzas()["app"].Env["LISTEN_ADDR"] != `{{ .Var "LOCAL_IP" }}:8080` {
+		t.Error("expected the original manifest to be left unrendered")
+	}
+}
+
+func TestRenderTemplateOverridesDefaults(t *testing.T) {
+	original, err := FromBytes([]byte(templateManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rendered, err := original.RenderTemplate(map[string]string{"LOCAL_IP": "10.0.0.5", "DC": "us-west"})
+	if err != nil {
+		t.Fatalf("Could not render manifest: %s", err)
+	}
+	if dc := rendered.GetLaunchableStanzas()["app"].Env["DATACENTER"]; dc != "us-west" {
+		t.Errorf("expected DATACENTER to be us-west, was %q", dc)
+	}
+}
+
+func TestRenderTemplateUnknownVar(t *testing.T) {
+	original, err := FromBytes([]byte(templateManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = original.RenderTemplate(nil)
+	if err == nil {
+		t.Fatal("expected an error rendering a manifest with an unknown variable")
+	}
+	if !strings.Contains(err.Error(), "LOCAL_IP") {
+		t.Errorf("expected the error to name the unknown variable, got %s", err)
+	}
+}
+
+func TestRenderTemplateWithoutTemplates(t *testing.T) {
+	builder := NewBuilder()
+	builder.SetID("hello")
+	original := builder.GetManifest()
+
+	rendered, err := original.RenderTemplate(map[string]string{"LOCAL_IP": "10.0.0.5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rendered != original {
+		t.Error("expected a manifest without templates to be returned unchanged")
+	}
+}
+
+func TestScrubRemovesRenderedTemplateVars(t *testing.T) {
+	original, err := FromBytes([]byte(templateManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rendered, err := original.RenderTemplate(map[string]string{"LOCAL_IP": "10.0.0.5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rendered.GetTemplateVars() == nil {
+		t.Fatal("expected the rendered manifest to still have its template_vars before scrubbing")
+	}
+
+	scrubbed := rendered.Scrub()
+	if scrubbed.GetTemplateVars() != nil {
+		t.Errorf("expected template_vars to be scrubbed, got %v", scrubbed.GetTemplateVars())
+	}
+	marshaled, err := scrubbed.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(marshaled), "template_vars") {
+		t.Errorf("expected the scrubbed manifest to be marshaled without template_vars:\n%s", marshaled)
+	}
+
+	// Everything else is preserved
+	if scrubbed.ID() != rendered.ID() {
+		t.Errorf("expected ID %s, got %s", rendered.ID(), scrubbed.ID())
+	}
+	if env := scrubbed.GetLaunchableStanzas()["app"].Env; env["LISTEN_ADDR"] != "10.0.0.5:8080" {
+		t.Errorf("expected the rendered env to be preserved, got %v", env)
+	}
+	if upstreams, ok := scrubbed.GetConfig()["upstreams"].([]interface{}); !ok || len(upstreams) != 1 {
+		t.Errorf("expected the config to be preserved, got %v", scrubbed.GetConfig())
+	}
+	if rendered.GetTemplateVars() == nil {
+		t.Error("expected Scrub to leave the original manifest unmodified")
+	}
+}
+
+func TestScrubRemovesUnrenderedTemplateVars(t *testing.T) {
+	original, err := FromBytes([]byte(templateManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scrubbed := original.Scrub()
+	if scrubbed == original {
+		t.Fatal("expected Scrub to return a copy")
+	}
+	if scrubbed.GetTemplateVars() != nil {
+		t.Errorf("expected template_vars to be scrubbed, got %v", scrubbed.GetTemplateVars())
+	}
+	if original.GetTemplateVars() == nil {
+		t.Error("expected Scrub to leave the original manifest unmodified")
+	}
+}
+
+func TestScrubCopiesSignedManifests(t *testing.T) {
+	signed, err := FromBytes([]byte(testSignedPod()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scrubbed := signed.Scrub()
+	if scrubbed == signed {
+		t.Fatal("expected Scrub to return a copy")
+	}
+	expectedSHA, _ := signed.SHA()
+	sha, _ := scrubbed.SHA()
+	if sha != expectedSHA {
+		t.Errorf("expected the signed manifest to be unchanged, SHA %s became %s", expectedSHA, sha)
+	}
+	if _, signature := scrubbed.SignatureData(); signature == nil {
+		t.Error("expected the copy to keep its signature")
+	}
+}
@@ -0,0 +1,423 @@
+package manifest
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/square/p2/pkg/cgroups"
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/runit"
+	"github.com/square/p2/pkg/util"
+	"github.com/square/p2/pkg/util/size"
+
+	"golang.org/x/crypto/openpgp/clearsign"
+	"gopkg.in/yaml.v2"
+)
+
+// FieldError is a problem with a single field of a manifest, found by
+// Validate().
+type FieldError struct {
+	// The dotted path of the field, e.g. launchables.app.cgroup.memory
+	Path    string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// Cgroup memory limits below this are almost certainly a size written
+// without a unit, which is read as bytes
+const minCgroupMemory = size.Mebibyte
+
+// Validate checks the manifest more strictly than FromBytes(), which accepts
+// anything that ValidManifest() does. In addition it rejects:
+//
+//   - keys that no field of the manifest reads, e.g. a misspelt "status_prot"
+//   - status ports outside 1-65535, or status_port and status.port disagreeing
+//   - status stanzas with an unknown type, or missing what their type needs
+//   - launchables whose PORT or *_PORT env vars are invalid or collide
+//   - negative cgroup limits, memory limits too small to be intentional and
+//     launchable limits that exceed the pod's resource_limits
+//   - artifact locations that ArtifactURL() can't resolve, e.g. a relative
+//     file:// path or an unknown scheme, and digest locations that aren't
+//     valid URLs
+//   - unknown restart policies, and restart backoffs that don't back off
+//
+// Every problem is reported, as a *util.MultiError. Problems with a single
+// field are FieldErrors.
+func (manifest *manifest) Validate() error {
+	errs := &util.MultiError{}
+	if err := ValidManifest(manifest); err != nil {
+		if multiErr, ok := err.(*util.MultiError); ok {
+			errs.Errors = append(errs.Errors, multiErr.Errors...)
+		} else {
+			errs.Add(err)
+		}
+	}
+
+	raw, err := manifest.rawYAML()
+	if err != nil {
+		errs.Add(err)
+	} else {
+		validateKeys(raw, errs)
+	}
+	manifest.validatePorts(errs)
+	manifest.validateCgroups(errs)
+	manifest.validateLocations(errs)
+	manifest.validateRestarts(errs)
+	manifest.validateSockets(errs)
+	return errs.ErrorOrNil()
+}
+
+// rawYAML returns the YAML the manifest was parsed from, or its serialization
+// if it was built.
+func (manifest *manifest) rawYAML() (map[interface{}]interface{}, error) {
+	bytes := manifest.raw
+	if bytes == nil {
+		var err error
+		bytes, err = yaml.Marshal(manifest)
+		if err != nil {
+			return nil, util.Errorf("Could not marshal manifest for %s: %s", manifest.ID(), err)
+		}
+	} else if signed, _ := clearsign.Decode(bytes); signed != nil {
+		bytes = signed.Plaintext
+	}
+	var fields map[interface{}]interface{}
+	err := yaml.Unmarshal(bytes, &fields)
+	if err != nil {
+		return nil, util.Errorf("Could not read pod manifest: %s", err)
+	}
+	return fields, nil
+}
+
+// validateKeys reports every key of the raw manifest that no field reads.
+func validateKeys(raw map[interface{}]interface{}, errs *util.MultiError) {
+	checkKeys("", raw, reflect.TypeOf(manifest{}), errs)
+	if status, ok := raw["status"].(map[interface{}]interface{}); ok {
+		checkKeys("status", status, reflect.TypeOf(StatusStanza{}), errs)
+	}
+	if limits, ok := raw["resource_limits"].(map[interface{}]interface{}); ok {
+		checkKeys("resource_limits", limits, reflect.TypeOf(ResourceLimitsStanza{}), errs)
+		if cgroup, ok := limits["cgroup"].(map[interface{}]interface{}); ok {
+			checkKeys("resource_limits.cgroup", cgroup, reflect.TypeOf(cgroups.Config{}), errs)
+		}
+	}
+
+	launchables, _ := raw["launchables"].(map[interface{}]interface{})
+	for launchableID, value := range launchables {
+		stanza, ok := value.(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+		path := joinFieldPath("launchables", launchableID)
+		checkKeys(path, stanza, reflect.TypeOf(launch.LaunchableStanza{}), errs)
+		if cgroup, ok := stanza["cgroup"].(map[interface{}]interface{}); ok {
+			checkKeys(joinFieldPath(path, "cgroup"), cgroup, reflect.TypeOf(cgroups.Config{}), errs)
+		}
+		if version, ok := stanza["version"].(map[interface{}]interface{}); ok {
+			checkKeys(joinFieldPath(path, "version"), version, reflect.TypeOf(launch.LaunchableVersion{}), errs)
+		}
+		if backoff, ok := stanza["restart_backoff"].(map[interface{}]interface{}); ok {
+			checkKeys(joinFieldPath(path, "restart_backoff"), backoff, reflect.TypeOf(runit.RestartBackoff{}), errs)
+		}
+	}
+}
+
+// checkKeys reports the keys of fields, found at path, that aren't read by
+// any field of the struct type t, suggesting the closest key that is.
+func checkKeys(path string, fields map[interface{}]interface{}, t reflect.Type, errs *util.MultiError) {
+	known := yamlKeys(t)
+	var unknown []string
+	for key := range fields {
+		name := fmt.Sprint(key)
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		message := "unknown key"
+		if suggestion := closestKey(name, known); suggestion != "" {
+			message = fmt.Sprintf("unknown key, did you mean %q?", suggestion)
+		}
+		errs.Add(FieldError{Path: joinFieldPath(path, name), Message: message})
+	}
+}
+
+// yamlKeys returns the keys that yaml.Unmarshal() reads into the fields of
+// the struct type t.
+func yamlKeys(t reflect.Type) map[string]bool {
+	keys := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			// unexported
+			continue
+		}
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = strings.ToLower(field.Name)
+		}
+		keys[name] = true
+	}
+	return keys
+}
+
+// closestKey returns the known key within two edits of name, if any.
+func closestKey(name string, known map[string]bool) string {
+	best := ""
+	bestDistance := 3
+	for key := range known {
+		distance := editDistance(name, key)
+		if distance < bestDistance || (distance == bestDistance && key < best) {
+			best = key
+			bestDistance = distance
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+func minInt(values ...int) int {
+	min := values[0]
+	for _, value := range values[1:] {
+		if value < min {
+			min = value
+		}
+	}
+	return min
+}
+
+func validPort(port int) bool {
+	return port > 0 && port <= 65535
+}
+
+func (manifest *manifest) validatePorts(errs *util.MultiError) {
+	if manifest.StatusPort != 0 && !validPort(manifest.StatusPort) {
+		errs.Add(FieldError{Path: "status_port", Message: fmt.Sprintf("%d is not a valid port", manifest.StatusPort)})
+	}
+	if manifest.Status.Port != 0 && !validPort(manifest.Status.Port) {
+		errs.Add(FieldError{Path: "status.port", Message: fmt.Sprintf("%d is not a valid port", manifest.Status.Port)})
+	}
+	switch manifest.Status.CheckType() {
+	case StatusCheckHTTP, StatusCheckTCP:
+		if manifest.Status.Command != "" {
+			errs.Add(FieldError{Path: "status.command", Message: fmt.Sprintf("only used by %s checks", StatusCheckExec)})
+		}
+	case StatusCheckExec:
+		if manifest.Status.Command == "" {
+			errs.Add(FieldError{Path: "status.command", Message: fmt.Sprintf("must be set for %s checks", StatusCheckExec)})
+		}
+	default:
+		errs.Add(FieldError{
+			Path:    "status.type",
+			Message: fmt.Sprintf("unknown check type %q, must be one of %s, %s or %s", manifest.Status.Type, StatusCheckHTTP, StatusCheckTCP, StatusCheckExec),
+		})
+	}
+	if manifest.Status.CheckType() == StatusCheckTCP && manifest.GetStatusPort() == 0 {
+		errs.Add(FieldError{Path: "status.port", Message: fmt.Sprintf("must be set for %s checks", StatusCheckTCP)})
+	}
+	if manifest.StatusPort != 0 && manifest.Status.Port != 0 && manifest.StatusPort != manifest.Status.Port {
+		errs.Add(FieldError{
+			Path:    "status.port",
+			Message: fmt.Sprintf("%d conflicts with status_port %d, set only one of them", manifest.Status.Port, manifest.StatusPort),
+		})
+	}
+
+	// Launchables of a pod share the node's network, so no two may listen on
+	// the same port
+	users := make(map[int]string)
+	for _, launchableID := range manifest.LaunchableIDs() {
+		stanza := manifest.LaunchableStanzas[launchableID]
+		var names []string
+		for name := range stanza.Env {
+			if name == "PORT" || strings.HasSuffix(name, "_PORT") {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			path := joinFieldPath(joinFieldPath(joinFieldPath("launchables", launchableID), "env"), name)
+			port, err := strconv.Atoi(stanza.Env[name])
+			if err != nil {
+				// e.g. a template variable, or a port of another service
+				continue
+			}
+			if !validPort(port) {
+				errs.Add(FieldError{Path: path, Message: fmt.Sprintf("%d is not a valid port", port)})
+				continue
+			}
+			if user, ok := users[port]; ok && !strings.HasPrefix(user, joinFieldPath("launchables", launchableID)+".") {
+				errs.Add(FieldError{Path: path, Message: fmt.Sprintf("port %d is also used by %s", port, user)})
+				continue
+			}
+			users[port] = path
+		}
+	}
+}
+
+func (manifest *manifest) validateCgroups(errs *util.MultiError) {
+	podLimits := manifest.ResourceLimits.Cgroup
+	if podLimits != nil {
+		validateCgroup("resource_limits.cgroup", *podLimits, errs)
+	}
+	for _, launchableID := range manifest.LaunchableIDs() {
+		path := joinFieldPath(joinFieldPath("launchables", launchableID), "cgroup")
+		limits := manifest.LaunchableStanzas[launchableID].CgroupConfig
+		validateCgroup(path, limits, errs)
+		if podLimits == nil {
+			continue
+		}
+		if podLimits.CPUs > 0 && limits.CPUs > podLimits.CPUs {
+			errs.Add(FieldError{
+				Path:    joinFieldPath(path, "cpus"),
+				Message: fmt.Sprintf("%d exceeds the pod's limit of %d in resource_limits.cgroup.cpus", limits.CPUs, podLimits.CPUs),
+			})
+		}
+		if podLimits.Memory > 0 && limits.Memory > podLimits.Memory {
+			errs.Add(FieldError{
+				Path:    joinFieldPath(path, "memory"),
+				Message: fmt.Sprintf("%s exceeds the pod's limit of %s in resource_limits.cgroup.memory", strings.TrimSpace(limits.Memory.String()), strings.TrimSpace(podLimits.Memory.String())),
+			})
+		}
+		if podLimits.Pids > 0 && limits.Pids > podLimits.Pids {
+			errs.Add(FieldError{
+				Path:    joinFieldPath(path, "pids"),
+				Message: fmt.Sprintf("%d exceeds the pod's limit of %d in resource_limits.cgroup.pids", limits.Pids, podLimits.Pids),
+			})
+		}
+	}
+}
+
+func validateCgroup(path string, limits cgroups.Config, errs *util.MultiError) {
+	if limits.CPUs < 0 {
+		errs.Add(FieldError{Path: joinFieldPath(path, "cpus"), Message: fmt.Sprintf("%d must not be negative", limits.CPUs)})
+	}
+	switch {
+	case limits.Memory < 0:
+		errs.Add(FieldError{Path: joinFieldPath(path, "memory"), Message: fmt.Sprintf("%v must not be negative", float64(limits.Memory))})
+	case limits.Memory > 0 && limits.Memory < minCgroupMemory:
+		errs.Add(FieldError{
+			Path:    joinFieldPath(path, "memory"),
+			Message: fmt.Sprintf("%v bytes is too small to run anything; sizes without a unit are bytes, e.g. use 512M", float64(limits.Memory)),
+		})
+	}
+	if limits.CPUShares != 0 && (limits.CPUShares < cgroups.MinCPUShares || limits.CPUShares > cgroups.MaxCPUShares) {
+		errs.Add(FieldError{
+			Path:    joinFieldPath(path, "cpu_shares"),
+			Message: fmt.Sprintf("%d must be between %d and %d", limits.CPUShares, cgroups.MinCPUShares, cgroups.MaxCPUShares),
+		})
+	}
+	if limits.Pids < 0 {
+		errs.Add(FieldError{Path: joinFieldPath(path, "pids"), Message: fmt.Sprintf("%d must not be negative", limits.Pids)})
+	}
+	if limits.IOWeight != 0 && (limits.IOWeight < cgroups.MinIOWeight || limits.IOWeight > cgroups.MaxIOWeight) {
+		errs.Add(FieldError{
+			Path:    joinFieldPath(path, "io_weight"),
+			Message: fmt.Sprintf("%d must be between %d and %d", limits.IOWeight, cgroups.MinIOWeight, cgroups.MaxIOWeight),
+		})
+	}
+}
+
+func (manifest *manifest) validateLocations(errs *util.MultiError) {
+	for _, launchableID := range manifest.LaunchableIDs() {
+		path := joinFieldPath("launchables", launchableID)
+		stanza := manifest.LaunchableStanzas[launchableID]
+		// docker locations are image references, checked by ValidManifest()
+		if stanza.Location != "" && stanza.LaunchableType != "docker" {
+			if _, err := stanza.ArtifactURL(); err != nil {
+				errs.Add(FieldError{Path: joinFieldPath(path, "location"), Message: fmt.Sprintf("invalid location: %s", err)})
+			}
+		}
+		for key, location := range map[string]string{
+			"digest_location":           stanza.DigestLocation,
+			"digest_signature_location": stanza.DigestSignatureLocation,
+		} {
+			if location == "" {
+				continue
+			}
+			if _, err := url.Parse(location); err != nil {
+				errs.Add(FieldError{Path: joinFieldPath(path, key), Message: fmt.Sprintf("invalid URL: %s", err)})
+			}
+		}
+		if stanza.DigestLocation != "" && stanza.DigestSignatureLocation == "" {
+			errs.Add(FieldError{Path: joinFieldPath(path, "digest_signature_location"), Message: "must be set with digest_location"})
+		}
+	}
+}
+
+func (manifest *manifest) validateRestarts(errs *util.MultiError) {
+	for _, launchableID := range manifest.LaunchableIDs() {
+		path := joinFieldPath("launchables", launchableID)
+		stanza := manifest.LaunchableStanzas[launchableID]
+		switch stanza.RestartPolicy_ {
+		case "", runit.RestartPolicyAlways, runit.RestartPolicyOnFailure, runit.RestartPolicyNever:
+		default:
+			errs.Add(FieldError{
+				Path:    joinFieldPath(path, "restart_policy"),
+				Message: fmt.Sprintf("%q must be one of %q, %q or %q", stanza.RestartPolicy_, runit.RestartPolicyAlways, runit.RestartPolicyOnFailure, runit.RestartPolicyNever),
+			})
+		}
+
+		backoff := stanza.RestartBackoff
+		if backoff == nil {
+			continue
+		}
+		path = joinFieldPath(path, "restart_backoff")
+		if backoff.Initial <= 0 {
+			errs.Add(FieldError{Path: joinFieldPath(path, "initial"), Message: fmt.Sprintf("%s must be positive", backoff.Initial)})
+		}
+		if backoff.Max < backoff.Initial {
+			errs.Add(FieldError{Path: joinFieldPath(path, "max"), Message: fmt.Sprintf("%s must be at least restart_backoff.initial", backoff.Max)})
+		}
+		if backoff.ResetAfter < 0 {
+			errs.Add(FieldError{Path: joinFieldPath(path, "reset_after"), Message: fmt.Sprintf("%s must not be negative", backoff.ResetAfter)})
+		}
+	}
+}
+
+func (manifest *manifest) validateSockets(errs *util.MultiError) {
+	for _, launchableID := range manifest.LaunchableIDs() {
+		path := joinFieldPath(joinFieldPath("launchables", launchableID), "sockets")
+		stanza := manifest.LaunchableStanzas[launchableID]
+		if len(stanza.Sockets) == 0 {
+			continue
+		}
+		if stanza.LaunchableType != "hoist" {
+			errs.Add(FieldError{Path: path, Message: fmt.Sprintf("not supported for %q launchables", stanza.LaunchableType)})
+		}
+		for _, address := range stanza.Sockets {
+			if strings.TrimSpace(address) == "" {
+				errs.Add(FieldError{Path: path, Message: "must not contain empty addresses"})
+			}
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package manifest
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/square/p2/pkg/util"
+)
+
+const validManifest = `id: myapp
+status_port: 8080
+resource_limits:
+  cgroup:
+    cpus: 4
+    memory: 2G
+launchables:
+  app:
+    launchable_type: hoist
+    location: https://localhost/myapp_abc123.tar.gz
+    cgroup:
+      cpus: 2
+      memory: 1G
+    env:
+      PORT: 8080
+      ADMIN_PORT: 8081
+  sidecar:
+    launchable_type: hoist
+    version:
+      id: abc123
+    env:
+      PORT: 9090
+      UPSTREAM_PORT: "${UPSTREAM_PORT}"
+`
+
+func validationErrors(t *testing.T, manifestYAML string) []string {
+	m, err := FromBytes([]byte(manifestYAML))
+	if err != nil {
+		t.Fatalf("Unexpected error parsing manifest: %s", err)
+	}
+	err = m.Validate()
+	if err == nil {
+		return nil
+	}
+	multiErr, ok := err.(*util.MultiError)
+	if !ok {
+		t.Fatalf("Expected a *util.MultiError, got %T", err)
+	}
+	var messages []string
+	for _, err := range multiErr.Errors {
+		messages = append(messages, err.Error())
+	}
+	sort.Strings(messages)
+	return messages
+}
+
+func TestValidateAcceptsValidManifest(t *testing.T) {
+	if errs := validationErrors(t, validManifest); errs != nil {
+		t.Errorf("Expected no validation errors, got %v", errs)
+	}
+}
+
+func TestValidateAcceptsBuiltManifest(t *testing.T) {
+	builder := NewBuilder()
+	builder.SetID("myapp")
+	builder.SetStatusPort(8080)
+	err := builder.GetManifest().Validate()
+	if err != nil {
+		t.Errorf("Expected a built manifest to be valid, got %s", err)
+	}
+}
+
+func TestValidateUnknownKeys(t *testing.T) {
+	errs := validationErrors(t, `id: myapp
+status_prot: 8080
+resource_limits:
+  cgroup:
+    memroy: 1G
+launchables:
+  app:
+    launchable_type: hoist
+    location: https://localhost/myapp_abc123.tar.gz
+    restart_polciy: never
+    frobnicate: true
+    version_:
+      id: abc123
+`)
+	expected := []string{
+		`launchables.app.frobnicate: unknown key`,
+		`launchables.app.restart_polciy: unknown key, did you mean "restart_policy"?`,
+		`launchables.app.version_: unknown key, did you mean "version"?`,
+		`resource_limits.cgroup.memroy: unknown key, did you mean "memory"?`,
+		`status_prot: unknown key, did you mean "status_port"?`,
+	}
+	if !reflect.DeepEqual(errs, expected) {
+		t.Errorf("Expected errors:\n%v\ngot:\n%v", expected, errs)
+	}
+}
+
+func TestValidatePorts(t *testing.T) {
+	errs := validationErrors(t, `id: myapp
+status_port: 8080
+status:
+  port: 70000
+launchables:
+  app:
+    launchable_type: hoist
+    location: https://localhost/myapp_abc123.tar.gz
+    env:
+      PORT: 8080
+  other:
+    launchable_type: hoist
+    location: https://localhost/other_abc123.tar.gz
+    env:
+      PORT: 8080
+      ADMIN_PORT: 0
+`)
+	expected := []string{
+		"launchables.other.env.ADMIN_PORT: 0 is not a valid port",
+		"launchables.other.env.PORT: port 8080 is also used by launchables.app.env.PORT",
+		"status.port: 70000 conflicts with status_port 8080, set only one of them",
+		"status.port: 70000 is not a valid port",
+	}
+	if !reflect.DeepEqual(errs, expected) {
+		t.Errorf("Expected errors:\n%v\ngot:\n%v", expected, errs)
+	}
+}
+
+func TestValidateCgroups(t *testing.T) {
+	errs := validationErrors(t, `id: myapp
+resource_limits:
+  cgroup:
+    cpus: 2
+    memory: 1G
+    pids: 100
+launchables:
+  app:
+    launchable_type: hoist
+    location: https://localhost/myapp_abc123.tar.gz
+    cgroup:
+      cpus: 4
+      memory: 2G
+      pids: 200
+      cpu_shares: 512
+      io_weight: 100
+  other:
+    launchable_type: hoist
+    location: https://localhost/other_abc123.tar.gz
+    cgroup:
+      cpus: -1
+      memory: 512
+      pids: -1
+      cpu_shares: 1
+      io_weight: 5000
+`)
+	expected := []string{
+		"launchables.app.cgroup.cpus: 4 exceeds the pod's limit of 2 in resource_limits.cgroup.cpus",
+		"launchables.app.cgroup.memory: 2.0G exceeds the pod's limit of 1.0G in resource_limits.cgroup.memory",
+		"launchables.app.cgroup.pids: 200 exceeds the pod's limit of 100 in resource_limits.cgroup.pids",
+		"launchables.other.cgroup.cpu_shares: 1 must be between 2 and 262144",
+		"launchables.other.cgroup.cpus: -1 must not be negative",
+		"launchables.other.cgroup.io_weight: 5000 must be between 10 and 1000",
+		"launchables.other.cgroup.memory: 512 bytes is too small to run anything; sizes without a unit are bytes, e.g. use 512M",
+		"launchables.other.cgroup.pids: -1 must not be negative",
+	}
+	if !reflect.DeepEqual(errs, expected) {
+		t.Errorf("Expected errors:\n%v\ngot:\n%v", expected, errs)
+	}
+}
+
+func TestValidateRestarts(t *testing.T) {
+	errs := validationErrors(t, `id: myapp
+launchables:
+  app:
+    launchable_type: hoist
+    location: https://localhost/myapp_abc123.tar.gz
+    restart_policy: sometimes
+    restart_backoff:
+      initial: 10s
+      max: 1s
+      reste_after: 1m
+  other:
+    launchable_type: hoist
+    location: https://localhost/other_abc123.tar.gz
+    restart_policy: on-failure
+    restart_backoff:
+      initial: 1s
+      max: 5m
+`)
+	expected := []string{
+		`launchables.app.restart_backoff.max: 1s must be at least restart_backoff.initial`,
+		`launchables.app.restart_backoff.reste_after: unknown key, did you mean "reset_after"?`,
+		`launchables.app.restart_policy: "sometimes" must be one of "always", "on-failure" or "never"`,
+	}
+	if !reflect.DeepEqual(errs, expected) {
+		t.Errorf("Expected errors:\n%v\ngot:\n%v", expected, errs)
+	}
+}
+
+func TestValidateSockets(t *testing.T) {
+	errs := validationErrors(t, `id: myapp
+launchables:
+  app:
+    launchable_type: hoist
+    location: https://localhost/myapp_abc123.tar.gz
+    sockets: ["0.0.0.0:8080", ""]
+  container:
+    launchable_type: opencontainer
+    location: https://localhost/container_abc123.tar.gz
+    sockets: ["0.0.0.0:9090"]
+`)
+	expected := []string{
+		`launchables.app.sockets: must not contain empty addresses`,
+		`launchables.container.sockets: not supported for "opencontainer" launchables`,
+	}
+	if !reflect.DeepEqual(errs, expected) {
+		t.Errorf("Expected errors:\n%v\ngot:\n%v", expected, errs)
+	}
+}
+
+func TestValidateLocations(t *testing.T) {
+	errs := validationErrors(t, `id: myapp
+launchables:
+  app:
+    launchable_type: hoist
+    location: https://localhost/myapp_abc123.tar.gz
+    digest_location: "https://localhost/%zz"
+`)
+	if len(errs) != 2 {
+		t.Fatalf("Expected 2 errors, got %v", errs)
+	}
+	if !strings.HasPrefix(errs[0], "launchables.app.digest_location: invalid URL: ") {
+		t.Errorf("Expected an invalid digest_location, got %s", errs[0])
+	}
+	if errs[1] != "launchables.app.digest_signature_location: must be set with digest_location" {
+		t.Errorf("Expected a missing digest_signature_location, got %s", errs[1])
+	}
+}
+
+func TestValidateArtifactLocations(t *testing.T) {
+	// each of these parses, since FromBytes() doesn't resolve locations
+	errs := validationErrors(t, `id: myapp
+launchables:
+  relative:
+    launchable_type: hoist
+    location: file://relative/myapp_abc123.tar.gz
+  scheme:
+    launchable_type: hoist
+    location: ftp://localhost/myapp_abc123.tar.gz
+  templated:
+    launchable_type: hoist
+    location: https://{{.HOST}}/myapp_abc123.tar.gz
+`)
+	if len(errs) != 3 {
+		t.Fatalf("Expected 3 errors, got %v", errs)
+	}
+	for i, launchableID := range []string{"relative", "scheme", "templated"} {
+		prefix := "launchables." + launchableID + ".location: invalid location: "
+		if !strings.HasPrefix(errs[i], prefix) {
+			t.Errorf("Expected an invalid location for %s, got %s", launchableID, errs[i])
+		}
+	}
+}
+
+func TestValidateIncludesValidManifestErrors(t *testing.T) {
+	m := &manifest{}
+	err := m.Validate()
+	if err == nil {
+		t.Fatal("Expected a manifest without an id to be invalid")
+	}
+	if err.Error() != "manifest must contain an 'id'" {
+		t.Errorf("Unexpected error: %s", err)
+	}
+}
+
+func TestValidateStatusCheckType(t *testing.T) {
+	errs := validationErrors(t, `id: myapp
+status:
+  type: exec
+`)
+	expected := []string{"status.command: must be set for exec checks"}
+	if !reflect.DeepEqual(errs, expected) {
+		t.Errorf("Expected errors:\n%v\ngot:\n%v", expected, errs)
+	}
+
+	errs = validationErrors(t, `id: myapp
+status:
+  type: grpc
+  port: 8080
+`)
+	expected = []string{`status.type: unknown check type "grpc", must be one of http, tcp or exec`}
+	if !reflect.DeepEqual(errs, expected) {
+		t.Errorf("Expected errors:\n%v\ngot:\n%v", expected, errs)
+	}
+}
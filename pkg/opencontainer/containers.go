@@ -42,6 +42,7 @@ type Launchable struct {
 	P2Exec            string                     // The path to p2-exec
 	RestartTimeout    time.Duration              // How long to wait when restarting the services in this launchable.
 	RestartPolicy_    runit.RestartPolicy        // Dictates whether the container should be automatically restarted upon exit.
+	RestartBackoff_   *runit.RestartBackoff      // How restarts of the container are delayed, if not by the fixed sleep.
 	CgroupConfig      cgroups.Config             // Cgroup parameters to use with p2-exec
 	Version_          launch.LaunchableVersionID // Version of the specified launchable
 	SuppliedEnvVars   map[string]string          // User-supplied env variables
@@ -94,7 +95,7 @@ func (l *Launchable) EnvVars() map[string]string {
 }
 
 // The version of the artifact is currently derived from the location, using
-// the naming scheme <the-app>_<unique-version-string>.tar.gz
+// the naming scheme <the-app>_<unique-version-string>.tar.gz (or .tar.xz, .tar.zst or .tar)
 func (hl *Launchable) Version() string {
 	return hl.Version_.String()
 }
@@ -119,7 +120,7 @@ func (l *Launchable) InstallDir() string {
 }
 
 // Executables gets a list of the runit services that will be built for this launchable.
-func (l *Launchable) Executables(serviceBuilder *runit.ServiceBuilder) ([]launch.Executable, error) {
+func (l *Launchable) Executables(serviceBuilder runit.Builder) ([]launch.Executable, error) {
 	if !l.Installed() {
 		return []launch.Executable{}, util.Errorf("%s is not installed", l.ServiceID_)
 	}
@@ -170,7 +171,7 @@ func (l *Launchable) Executables(serviceBuilder *runit.ServiceBuilder) ([]launch
 	// containerized process
 	return []launch.Executable{{
 		Service: runit.Service{
-			Path: filepath.Join(serviceBuilder.RunitRoot, serviceName),
+			Path: serviceBuilder.ServicePath(serviceName),
 			Name: serviceName,
 		},
 		Exec: append(
@@ -291,7 +292,7 @@ func (l *Launchable) makeLast() error {
 }
 
 // Launch allows the launchable to begin execution.
-func (l *Launchable) Launch(serviceBuilder *runit.ServiceBuilder, sv runit.SV) error {
+func (l *Launchable) Launch(serviceBuilder runit.Builder, sv runit.SV) error {
 	output, err := l.preLaunch()
 	if err != nil {
 		return util.Errorf("error running pre-launch script: %s\n%s", err, output)
@@ -322,7 +323,7 @@ func (l *Launchable) Launch(serviceBuilder *runit.ServiceBuilder, sv runit.SV) e
 	return nil
 }
 
-func (l *Launchable) start(serviceBuilder *runit.ServiceBuilder, sv runit.SV) error {
+func (l *Launchable) start(serviceBuilder runit.Builder, sv runit.SV) error {
 	executables, err := l.Executables(serviceBuilder)
 	if err != nil {
 		return err
@@ -330,7 +331,7 @@ func (l *Launchable) start(serviceBuilder *runit.ServiceBuilder, sv runit.SV) er
 
 	for _, executable := range executables {
 		var err error
-		if l.RestartPolicy_ == runit.RestartPolicyAlways {
+		if l.RestartPolicy_.Restarts() {
 			_, err = sv.Restart(&executable.Service, l.RestartTimeout)
 		} else {
 			_, err = sv.Once(&executable.Service)
@@ -343,7 +344,7 @@ func (l *Launchable) start(serviceBuilder *runit.ServiceBuilder, sv runit.SV) er
 	return nil
 }
 
-func (l *Launchable) stop(serviceBuilder *runit.ServiceBuilder, sv runit.SV) error {
+func (l *Launchable) stop(serviceBuilder runit.Builder, sv runit.SV) error {
 	executables, err := l.Executables(serviceBuilder)
 	if err != nil {
 		return err
@@ -374,7 +375,7 @@ func (l *Launchable) Disable() error {
 }
 
 // Halt causes the launchable to halt execution if it is running.
-func (l *Launchable) Stop(serviceBuilder *runit.ServiceBuilder, sv runit.SV, _ bool) error {
+func (l *Launchable) Stop(serviceBuilder runit.Builder, sv runit.SV, _ bool) error {
 	err := l.stop(serviceBuilder, sv)
 	if err != nil {
 		return launch.StopError{Inner: err}
@@ -396,6 +397,15 @@ func (l *Launchable) RestartPolicy() runit.RestartPolicy {
 	return l.RestartPolicy_
 }
 
+func (l *Launchable) RestartBackoff() *runit.RestartBackoff {
+	return l.RestartBackoff_
+}
+
+// Sockets returns nil, passing sockets to containers isn't supported
+func (l *Launchable) Sockets() []string {
+	return nil
+}
+
 func (l *Launchable) GetRestartTimeout() time.Duration {
 	return l.RestartTimeout
 }
@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/square/p2/pkg/artifact"
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/osversion"
 	"github.com/square/p2/pkg/p2exec"
@@ -32,6 +33,8 @@ type Factory interface {
 	NewUUIDPod(id types.PodID, uniqueKey types.PodUniqueKey) (*Pod, error)
 	NewLegacyPod(id types.PodID) *Pod
 	SetOSVersionDetector(osversion.Detector)
+	SetDownloadPool(*artifact.DownloadPool)
+	SetSupervisor(runit.Builder, runit.SV)
 }
 
 type HookFactory interface {
@@ -47,6 +50,11 @@ type factory struct {
 	fetcher           uri.Fetcher
 	requireFile       string
 	osVersionDetector osversion.Detector
+	downloadPool      *artifact.DownloadPool
+
+	// If nil, pods are supervised by runit
+	serviceBuilder runit.Builder
+	sv             runit.SV
 }
 
 type hookFactory struct {
@@ -75,6 +83,27 @@ func (f *factory) SetOSVersionDetector(osVersionDetector osversion.Detector) {
 	f.osVersionDetector = osVersionDetector
 }
 
+// SetDownloadPool makes every pod from the factory download its artifacts
+// through pool, which bounds how many are downloaded at once across pods.
+func (f *factory) SetDownloadPool(pool *artifact.DownloadPool) {
+	f.downloadPool = pool
+}
+
+// SetSupervisor makes every pod from the factory install its services with
+// builder and control them with sv, e.g. to supervise them with systemd
+// rather than runit.
+func (f *factory) SetSupervisor(builder runit.Builder, sv runit.SV) {
+	f.serviceBuilder = builder
+	f.sv = sv
+}
+
+func (f *factory) applySupervisor(pod *Pod) {
+	if f.serviceBuilder != nil {
+		pod.ServiceBuilder = f.serviceBuilder
+		pod.SV = f.sv
+	}
+}
+
 func NewHookFactory(hookRoot string, node types.NodeName, fetcher uri.Fetcher) HookFactory {
 	if hookRoot == "" {
 		hookRoot = filepath.Join(DefaultPath, "hooks")
@@ -105,12 +134,18 @@ func (f *factory) NewUUIDPod(id types.PodID, uniqueKey types.PodUniqueKey) (*Pod
 		return nil, util.Errorf("uniqueKey cannot be empty")
 	}
 	home := filepath.Join(f.podRoot, ComputeUniqueName(id, uniqueKey))
-	return newPodWithHome(id, uniqueKey, home, f.node, f.requireFile, f.fetcher, f.osVersionDetector, f.readOnlyPolicy.IsReadOnly(id)), nil
+	pod := newPodWithHome(id, uniqueKey, home, f.node, f.requireFile, f.fetcher, f.osVersionDetector, f.readOnlyPolicy.IsReadOnly(id))
+	pod.DownloadPool = f.downloadPool
+	f.applySupervisor(pod)
+	return pod, nil
 }
 
 func (f *factory) NewLegacyPod(id types.PodID) *Pod {
 	home := filepath.Join(f.podRoot, id.String())
-	return newPodWithHome(id, "", home, f.node, f.requireFile, f.fetcher, f.osVersionDetector, f.readOnlyPolicy.IsReadOnly(id))
+	pod := newPodWithHome(id, "", home, f.node, f.requireFile, f.fetcher, f.osVersionDetector, f.readOnlyPolicy.IsReadOnly(id))
+	pod.DownloadPool = f.downloadPool
+	f.applySupervisor(pod)
+	return pod
 }
 
 func (f *hookFactory) NewHookPod(id types.PodID) *Pod {
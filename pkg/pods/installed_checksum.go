@@ -0,0 +1,108 @@
+package pods
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/square/p2/pkg/launch"
+	"github.com/square/p2/pkg/util"
+)
+
+// VerifyInstalledLaunchable checks that the contents of an installed
+// launchable's directory match the stanza's expected_dir_checksum. Stanzas
+// without an expected checksum always pass.
+func VerifyInstalledLaunchable(dir string, stanza launch.LaunchableStanza) error {
+	if stanza.ExpectedDirChecksum == "" {
+		return nil
+	}
+
+	checksum, err := DirChecksum(dir)
+	if err != nil {
+		return util.Errorf("Could not compute checksum of %s: %s", dir, err)
+	}
+	if checksum != stanza.ExpectedDirChecksum {
+		return util.Errorf("Installed launchable at %s has checksum %s, expected %s", dir, checksum, stanza.ExpectedDirChecksum)
+	}
+	return nil
+}
+
+// DirChecksum returns the hex-encoded root of a SHA-256 Merkle tree of the
+// directory's contents. A file's hash covers its contents, a symlink's hash
+// covers its target, and a directory's hash covers the name, type and hash of
+// each of its entries in lexical order. File modes and ownership are ignored,
+// since installation changes them.
+func DirChecksum(dir string) (string, error) {
+	sum, err := hashDir(dir)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sum), nil
+}
+
+func hashDir(dir string) ([]byte, error) {
+	// ReadDir returns entries sorted by name, which makes the traversal
+	// deterministic
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	hasher := sha256.New()
+	for _, entry := range entries {
+		entryPath := filepath.Join(dir, entry.Name())
+
+		var entryType string
+		var entrySum []byte
+		switch {
+		case entry.Mode()&os.ModeSymlink != 0:
+			entryType = "symlink"
+			entrySum, err = hashSymlink(entryPath)
+		case entry.IsDir():
+			entryType = "dir"
+			entrySum, err = hashDir(entryPath)
+		case entry.Mode().IsRegular():
+			entryType = "file"
+			entrySum, err = hashFile(entryPath)
+		default:
+			return nil, util.Errorf("%s is not a regular file, directory or symlink", entryPath)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		_, _ = io.WriteString(hasher, entry.Name())
+		_, _ = hasher.Write([]byte{0})
+		_, _ = io.WriteString(hasher, entryType)
+		_, _ = hasher.Write([]byte{0})
+		_, _ = hasher.Write(entrySum)
+	}
+	return hasher.Sum(nil), nil
+}
+
+func hashFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	_, err = io.Copy(hasher, f)
+	if err != nil {
+		return nil, err
+	}
+	return hasher.Sum(nil), nil
+}
+
+func hashSymlink(path string) ([]byte, error) {
+	target, err := os.Readlink(path)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(target))
+	return sum[:], nil
+}
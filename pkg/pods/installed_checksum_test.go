@@ -0,0 +1,85 @@
+package pods
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/square/p2/pkg/launch"
+)
+
+func buildInstallDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "installed_checksum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.MkdirAll(filepath.Join(dir, "bin"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "bin", "launch"), []byte("#!/bin/sh\necho hello\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "README"), []byte("hello"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Symlink("bin/launch", filepath.Join(dir, "start"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestVerifyInstalledLaunchable(t *testing.T) {
+	dir := buildInstallDir(t)
+	defer os.RemoveAll(dir)
+
+	checksum, err := DirChecksum(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stanza := launch.LaunchableStanza{ExpectedDirChecksum: checksum}
+	err = VerifyInstalledLaunchable(dir, stanza)
+	if err != nil {
+		t.Fatalf("expected install dir to match its own checksum, got %s", err)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(dir, "bin", "launch"), []byte("#!/bin/sh\necho tampered\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = VerifyInstalledLaunchable(dir, stanza)
+	if err == nil {
+		t.Fatal("expected verification to fail after a file changed")
+	}
+}
+
+func TestVerifyInstalledLaunchableDetectsNewFiles(t *testing.T) {
+	dir := buildInstallDir(t)
+	defer os.RemoveAll(dir)
+
+	checksum, err := DirChecksum(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(dir, "bin", "extra"), nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = VerifyInstalledLaunchable(dir, launch.LaunchableStanza{ExpectedDirChecksum: checksum})
+	if err == nil {
+		t.Fatal("expected verification to fail after a file was added")
+	}
+}
+
+func TestVerifyInstalledLaunchableNoChecksum(t *testing.T) {
+	err := VerifyInstalledLaunchable("/does/not/exist", launch.LaunchableStanza{})
+	if err != nil {
+		t.Fatalf("expected a stanza without a checksum to pass, got %s", err)
+	}
+}
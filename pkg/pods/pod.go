@@ -15,6 +15,7 @@ import (
 	"github.com/square/p2/pkg/auth"
 	"github.com/square/p2/pkg/cgroups"
 	"github.com/square/p2/pkg/digest"
+	"github.com/square/p2/pkg/docker"
 	"github.com/square/p2/pkg/hoist"
 	"github.com/square/p2/pkg/launch"
 	"github.com/square/p2/pkg/logging"
@@ -66,7 +67,7 @@ type Pod struct {
 	home              string
 	logger            logging.Logger
 	SV                runit.SV
-	ServiceBuilder    *runit.ServiceBuilder
+	ServiceBuilder    runit.Builder
 	P2Exec            string
 	DefaultTimeout    time.Duration // this is the default timeout for stopping and restarting services in this pod
 	LogExec           runit.Exec
@@ -75,6 +76,10 @@ type Pod struct {
 	ManifestFinder    ManifestFinder
 	OSVersionDetector osversion.Detector
 
+	// Bounds how many of the pod's artifacts are downloaded at once. If nil
+	// they are downloaded one at a time
+	DownloadPool *artifact.DownloadPool
+
 	// Pod will not start if file is not present
 	RequireFile string
 
@@ -154,7 +159,7 @@ func (pod *Pod) Halt(manifest manifest.Manifest, force bool) (bool, error) {
 		}
 	}
 	for _, launchable := range launchables {
-		err = launchable.Stop(runit.DefaultBuilder, runit.DefaultSV, force) // TODO: make these configurable
+		err = launchable.Stop(pod.ServiceBuilder, pod.SV, force)
 		if err != nil {
 			pod.logLaunchableError(launchable.ServiceID(), err, "Could not stop launchable")
 			success = false
@@ -217,7 +222,7 @@ func (pod *Pod) Launch(manifest manifest.Manifest) (bool, error) {
 
 	success := true
 	for _, launchable := range launchables {
-		err = launchable.Launch(pod.ServiceBuilder, pod.SV) // TODO: make these configurable
+		err = launchable.Launch(pod.ServiceBuilder, pod.SV)
 		switch err.(type) {
 		case nil:
 			// noop
@@ -285,15 +290,20 @@ func (pod *Pod) buildRunitServices(launchables []launch.Launchable, newManifest
 			pod.logLaunchableError(launchable.ServiceID(), err, "Unable to list executables")
 			continue
 		}
+		if len(executables) > 1 && len(launchable.Sockets()) > 0 {
+			return util.Errorf("Launchable %q has sockets but %d entry points, sockets can only be passed to one", launchable.ServiceID(), len(executables))
+		}
 		for _, executable := range executables {
 			if _, ok := sbTemplate[executable.Service.Name]; ok {
 				return util.Errorf("Duplicate executable %q for launchable %q", executable.Service.Name, launchable.ServiceID())
 			}
 			sbTemplate[executable.Service.Name] = runit.ServiceTemplate{
-				Log:           pod.LogExec,
-				Run:           executable.Exec,
-				Finish:        pod.FinishExecForExecutable(launchable, executable),
-				RestartPolicy: launchable.RestartPolicy(),
+				Log:            pod.LogExec,
+				Run:            executable.Exec,
+				Finish:         pod.FinishExecForExecutable(launchable, executable),
+				RestartPolicy:  launchable.RestartPolicy(),
+				RestartBackoff: launchable.RestartBackoff(),
+				Sockets:        launchable.Sockets(),
 			}
 		}
 	}
@@ -400,8 +410,8 @@ func (pod *Pod) Uninstall() error {
 
 	// remove services for this pod, then prune the old
 	// service dirs away
-	err = os.Remove(filepath.Join(pod.ServiceBuilder.ConfigRoot, pod.UniqueName()+".yaml"))
-	if err != nil && !os.IsNotExist(err) {
+	err = pod.ServiceBuilder.Deactivate(pod.UniqueName())
+	if err != nil {
 		return err
 	}
 	err = pod.ServiceBuilder.Prune()
@@ -431,6 +441,13 @@ func (pod *Pod) SetSubsystemer(s cgroups.Subsystemer) {
 	pod.subsystemer = s
 }
 
+// A launchable that installs itself by pulling a container image, in place of
+// downloading and verifying an artifact. See docker.Launchable
+type imageLaunchable interface {
+	launch.Launchable
+	Pull() error
+}
+
 // Install will ensure that executables for all required services are present on the host
 // machine and are set up to run. In the case of Hoist artifacts (which is the only format
 // supported currently, this will set up runit services.).
@@ -453,8 +470,23 @@ func (pod *Pod) Install(manifest manifest.Manifest, verifier auth.ArtifactVerifi
 		return err
 	}
 
-	downloader := artifact.NewLocationDownloader(pod.Fetcher, verifier)
-	for launchableID, stanza := range manifest.GetLaunchableStanzas() {
+	downloadPool := pod.DownloadPool
+	if downloadPool == nil {
+		downloadPool = artifact.NewDownloadPool(1, 0)
+	}
+
+	// Find the launchables that need to be downloaded before downloading them
+	// all at once, then finish installing each in order. Images are pulled
+	// instead of downloaded
+	var toInstall []launch.Launchable
+	var toPull []imageLaunchable
+	var stanzas []launch.LaunchableStanza
+	var requests []artifact.DownloadRequest
+	for _, launchableID := range manifest.LaunchableIDs() {
+		stanza, err := manifest.LaunchableByID(launchableID)
+		if err != nil {
+			return err
+		}
 		// TODO: investigate passing in necessary fields to InstallDir()
 		launchable, err := pod.getLaunchable(launchableID, stanza, manifest.RunAsUser(), manifest.UnpackAsUser())
 		if err != nil {
@@ -465,6 +497,10 @@ func (pod *Pod) Install(manifest manifest.Manifest, verifier auth.ArtifactVerifi
 		if launchable.Installed() {
 			continue
 		}
+		if image, ok := launchable.(imageLaunchable); ok {
+			toPull = append(toPull, image)
+			continue
+		}
 
 		launchableURL, verificationData, err := artifactRegistry.LocationDataForLaunchable(pod.Id, launchableID, stanza)
 		if err != nil {
@@ -472,17 +508,54 @@ func (pod *Pod) Install(manifest manifest.Manifest, verifier auth.ArtifactVerifi
 			return err
 		}
 
-		err = downloader.Download(launchableURL, verificationData, launchable.InstallDir(), manifest.UnpackAsUser())
+		toInstall = append(toInstall, launchable)
+		stanzas = append(stanzas, stanza)
+		requests = append(requests, artifact.DownloadRequest{
+			Location:         launchableURL,
+			VerificationData: verificationData,
+			Destination:      launchable.InstallDir(),
+			Owner:            manifest.UnpackAsUser(),
+		})
+	}
+
+	// A launchable downloaded in this attempt counts as installed from then
+	// on, so every download that hasn't been verified and post-installed is
+	// removed when the attempt fails, to be checked again on the next one
+	downloadErrs := artifact.DownloadAll(downloadPool.Downloader(pod.Fetcher, verifier), requests)
+	var downloadErr util.MultiError
+	for i, err := range downloadErrs {
+		if err != nil {
+			pod.logLaunchableError(toInstall[i].ServiceID(), err, "Unable to install launchable")
+			downloadErr.Add(util.Errorf("%s: %s", toInstall[i].ServiceID(), err))
+		}
+	}
+	if downloadErr.HasErrors() {
+		removeInstallDirs(toInstall)
+		return &downloadErr
+	}
+
+	for _, launchable := range toPull {
+		err = launchable.Pull()
 		if err != nil {
 			pod.logLaunchableError(launchable.ServiceID(), err, "Unable to install launchable")
-			_ = os.Remove(launchable.InstallDir())
+			_ = os.RemoveAll(launchable.InstallDir())
+			removeInstallDirs(toInstall)
+			return err
+		}
+	}
+
+	for i, launchable := range toInstall {
+		err = VerifyInstalledLaunchable(launchable.InstallDir(), stanzas[i])
+		if err != nil {
+			pod.logLaunchableError(launchable.ServiceID(), err, "Unable to install launchable")
+			removeInstallDirs(toInstall[i:])
 			return err
 		}
 
 		output, err := launchable.PostInstall()
 		if err != nil {
 			pod.logLaunchableError(launchable.ServiceID(), err, fmt.Sprintf("Unable to install launchable: script output:\n%s", output))
-			_ = os.Remove(launchable.InstallDir())
+			removeInstallDirs(toInstall[i:])
 			return err
 		}
 	}
@@ -500,8 +573,20 @@ func (pod *Pod) Install(manifest manifest.Manifest, verifier auth.ArtifactVerifi
 	return nil
 }
 
+// removeInstallDirs removes the install directories of launchables whose
+// install didn't complete.
+func removeInstallDirs(launchables []launch.Launchable) {
+	for _, launchable := range launchables {
+		_ = os.RemoveAll(launchable.InstallDir())
+	}
+}
+
 func (pod *Pod) Verify(manifest manifest.Manifest, authPolicy auth.Policy) error {
-	for launchableID, stanza := range manifest.GetLaunchableStanzas() {
+	for _, launchableID := range manifest.LaunchableIDs() {
+		stanza, err := manifest.LaunchableByID(launchableID)
+		if err != nil {
+			return err
+		}
 		if stanza.DigestLocation == "" {
 			continue
 		}
@@ -714,10 +799,14 @@ func writeFileChown(filename string, data []byte, uid, gid int) error {
 }
 
 func (pod *Pod) Launchables(manifest manifest.Manifest) ([]launch.Launchable, error) {
-	launchableStanzas := manifest.GetLaunchableStanzas()
-	launchables := make([]launch.Launchable, 0, len(launchableStanzas))
+	launchableIDs := manifest.LaunchableIDs()
+	launchables := make([]launch.Launchable, 0, len(launchableIDs))
 
-	for launchableID, launchableStanza := range launchableStanzas {
+	for _, launchableID := range launchableIDs {
+		launchableStanza, err := manifest.LaunchableByID(launchableID)
+		if err != nil {
+			return nil, err
+		}
 		launchable, err := pod.getLaunchable(launchableID, launchableStanza, manifest.RunAsUser(), manifest.UnpackAsUser())
 		if err != nil {
 			return nil, err
@@ -825,6 +914,8 @@ func (pod *Pod) getLaunchable(launchableID launch.LaunchableID, launchableStanza
 			ExecNoLimit:      true,
 			RestartTimeout:   restartTimeout,
 			RestartPolicy_:   launchableStanza.RestartPolicy(),
+			RestartBackoff_:  launchableStanza.RestartBackoff,
+			Sockets_:         launchableStanza.Sockets,
 			CgroupConfig:     launchableStanza.CgroupConfig,
 			CgroupConfigName: launchableID.String(),
 			CgroupName:       cgroupName,
@@ -846,6 +937,7 @@ func (pod *Pod) getLaunchable(launchableID launch.LaunchableID, launchableStanza
 			P2Exec:            pod.P2Exec,
 			RestartTimeout:    restartTimeout,
 			RestartPolicy_:    launchableStanza.RestartPolicy(),
+			RestartBackoff_:   launchableStanza.RestartBackoff,
 			CgroupConfig:      launchableStanza.CgroupConfig,
 			SuppliedEnvVars:   launchableStanza.Env,
 			OSVersionDetector: pod.OSVersionDetector,
@@ -856,6 +948,28 @@ func (pod *Pod) getLaunchable(launchableID launch.LaunchableID, launchableStanza
 		}
 		ret.CgroupConfig.Name = cgroups.CgroupID(serviceId)
 		return ret, nil
+	} else if launchableStanza.LaunchableType == "docker" {
+		image, err := launchableStanza.ImageReference()
+		if err != nil {
+			return nil, err
+		}
+		ret := &docker.Launchable{
+			ID_:             launchableID,
+			ServiceID_:      serviceId,
+			Image:           image,
+			RunAs:           runAsUser,
+			OwnAs:           ownAsUser,
+			RootDir:         launchableRootDir,
+			P2Exec:          pod.P2Exec,
+			RestartTimeout:  restartTimeout,
+			RestartPolicy_:  launchableStanza.RestartPolicy(),
+			RestartBackoff_: launchableStanza.RestartBackoff,
+			CgroupConfig:    launchableStanza.CgroupConfig,
+			SuppliedEnvVars: launchableStanza.Env,
+			PodEnvDir:       pod.EnvDir(),
+			ExecNoLimit:     true,
+		}
+		return ret, nil
 	} else {
 		err := fmt.Errorf("launchable type '%s' is not supported", launchableStanza.LaunchableType)
 		pod.logLaunchableError(launchableID.String(), err, "Unknown launchable type")
@@ -885,7 +999,7 @@ func (pod *Pod) disableAndForceHaltLaunchables(currentManifest manifest.Manifest
 		// This function has "force" in the name, and also it's only called
 		// when uninstalling a pod, so we should force processes to stop
 		force := true
-		err = launchable.Stop(runit.DefaultBuilder, runit.DefaultSV, force) // TODO: make these configurable
+		err = launchable.Stop(pod.ServiceBuilder, pod.SV, force)
 		if err != nil {
 			pod.logLaunchableWarning(launchable.ServiceID(), err, "Could not stop launchable during uninstallation")
 		}
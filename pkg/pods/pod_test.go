@@ -408,6 +408,51 @@ func TestInstall(t *testing.T) {
 	}
 }
 
+func TestInstallRemovesDownloadsOfFailedAttempt(t *testing.T) {
+	testContext := util.From(runtime.Caller(0))
+
+	currentUser, err := user.Current()
+	Assert(t).IsNil(err, "test setup: couldn't get current user")
+
+	launchables := map[launch.LaunchableID]launch.LaunchableStanza{
+		"hello": {
+			Location:       testContext.ExpandPath("testdata/hoisted-hello_3c021aff048ca8117593f9c71e03b87cf72fd440.tar.gz"),
+			LaunchableType: "hoist",
+		},
+		"missing": {
+			Location:       testContext.ExpandPath("testdata/missing_abc123.tar.gz"),
+			LaunchableType: "hoist",
+		},
+	}
+
+	builder := manifest.NewBuilder()
+	builder.SetID("hello")
+	builder.SetLaunchables(launchables)
+	builder.SetRunAsUser(currentUser.Username)
+	manifest := builder.GetManifest()
+
+	testPodDir, err := ioutil.TempDir("", "testPodDir")
+	Assert(t).IsNil(err, "Got an unexpected error creating a temp directory")
+	defer os.RemoveAll(testPodDir)
+
+	pod := Pod{
+		Id:      "testPod",
+		home:    testPodDir,
+		logger:  Log.SubLogger(logrus.Fields{"pod": "testPod"}),
+		Fetcher: uri.DefaultFetcher,
+	}
+	pod.subsystemer = &FakeSubsystemer{}
+
+	err = pod.Install(manifest, auth.NopVerifier(), artifact.NewRegistry(nil, uri.DefaultFetcher, osversion.DefaultDetector))
+	Assert(t).IsNotNil(err, "expected the install to fail when an artifact is missing")
+
+	// Otherwise the next attempt would consider it installed and skip
+	// verifying it
+	hoistedHelloUnpacked := filepath.Join(testPodDir, "hello", "installs", "hello_3c021aff048ca8117593f9c71e03b87cf72fd440")
+	_, err = os.Stat(hoistedHelloUnpacked)
+	Assert(t).IsTrue(os.IsNotExist(err), "expected the launchable downloaded in the failed attempt to be removed")
+}
+
 func TestUninstall(t *testing.T) {
 	fakeSB := runit.FakeServiceBuilder()
 	defer fakeSB.Cleanup()
@@ -0,0 +1,91 @@
+package preparer
+
+import (
+	"strings"
+
+	"github.com/square/p2/pkg/cgroups"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// CapacityStore is the subset of the consul store used to read the capacity
+// that the node advertises.
+type CapacityStore interface {
+	NodeCapacity(nodeName types.NodeName) (consul.NodeCapacity, error)
+}
+
+// podLimits returns the cgroup limits of a pod: its resource_limits if set,
+// otherwise the sum of its launchables' limits. Launchables without a limit
+// don't count towards the sum.
+func podLimits(podManifest manifest.Manifest) cgroups.Config {
+	if limits := podManifest.GetResourceLimits().Cgroup; limits != nil {
+		return *limits
+	}
+	var total cgroups.Config
+	for _, launchableID := range podManifest.LaunchableIDs() {
+		stanza, err := podManifest.LaunchableByID(launchableID)
+		if err != nil {
+			continue
+		}
+		total.CPUs += stanza.CgroupConfig.CPUs
+		total.Memory += stanza.CgroupConfig.Memory
+		total.Pids += stanza.CgroupConfig.Pids
+	}
+	return total
+}
+
+// checkCapacity returns an error if installing the pod would make the limits
+// of the pods in the node's intent exceed the capacity it advertises. The
+// rendered manifest replaces the pod's own entry in the totals. Nothing is
+// checked if the node hasn't advertised its capacity.
+func (p *Preparer) checkCapacity(pair ManifestPair, rendered manifest.Manifest) error {
+	if p.capacityStore == nil {
+		return nil
+	}
+	capacity, err := p.capacityStore.NodeCapacity(p.node)
+	if err == consul.NoNodeCapacity {
+		return nil
+	} else if err != nil {
+		return util.Errorf("Could not read the node's capacity: %s", err)
+	}
+
+	intents, _, err := p.store.ListPods(consul.INTENT_TREE, p.node)
+	if err != nil {
+		return util.Errorf("Could not list the node's pods: %s", err)
+	}
+	total := podLimits(rendered)
+	for _, intent := range intents {
+		if intent.Manifest == nil {
+			continue
+		}
+		if intent.PodUniqueKey == pair.PodUniqueKey && intent.Manifest.ID() == pair.ID {
+			continue
+		}
+		limits := podLimits(intent.Manifest)
+		total.CPUs += limits.CPUs
+		total.Memory += limits.Memory
+		total.Pids += limits.Pids
+	}
+
+	var exceeded []string
+	if capacity.CPUs > 0 && total.CPUs > capacity.CPUs {
+		exceeded = append(exceeded, "cpus")
+	}
+	if capacity.Memory > 0 && total.Memory > capacity.Memory {
+		exceeded = append(exceeded, "memory")
+	}
+	if capacity.Pids > 0 && total.Pids > capacity.Pids {
+		exceeded = append(exceeded, "pids")
+	}
+	if len(exceeded) > 0 {
+		return util.Errorf(
+			"The cgroup limits of the node's pods (%d cpus, %s memory, %d pids) would exceed its capacity (%d cpus, %s memory, %d pids) in %s",
+			total.CPUs, strings.TrimSpace(total.Memory.String()), total.Pids,
+			capacity.CPUs, strings.TrimSpace(capacity.Memory.String()), capacity.Pids,
+			strings.Join(exceeded, ", "),
+		)
+	}
+	return nil
+}
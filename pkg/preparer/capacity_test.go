@@ -0,0 +1,67 @@
+package preparer
+
+import (
+	"os"
+	"testing"
+
+	. "github.com/anthonybishopric/gotcha"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/util/size"
+)
+
+func testLimitedManifest(t *testing.T, yaml string) manifest.Manifest {
+	m, err := manifest.FromBytes([]byte(yaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func testCapacity(t *testing.T, capacity consul.NodeCapacity) (*TestPod, bool) {
+	scheduled := testLimitedManifest(t, `id: other
+resource_limits:
+  cgroup:
+    cpus: 2
+    memory: 3G
+`)
+	intent := testLimitedManifest(t, `id: hello
+launchables:
+  app:
+    launchable_type: hoist
+    location: http://localhost:8000/foo/bar/baz/hello_abc123_vagrant.tar.gz
+    cgroup:
+      cpus: 1
+      memory: 1G
+  worker:
+    launchable_type: hoist
+    location: http://localhost:8000/foo/bar/baz/worker_abc123_vagrant.tar.gz
+    cgroup:
+      cpus: 1
+      memory: 1G
+`)
+	testPod := &TestPod{launchSuccess: true}
+	store := &FakeStore{currentManifest: scheduled, nodeCapacity: &capacity}
+	p, _, fakePodRoot := testPreparer(t, store)
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+	success := p.installAndLaunchPod(ManifestPair{ID: intent.ID(), Intent: intent}, testPod, logging.DefaultLogger)
+	return testPod, success
+}
+
+func TestPreparerInstallsPodsThatFitTheNode(t *testing.T) {
+	testPod, success := testCapacity(t, consul.NodeCapacity{CPUs: 4, Memory: 8 * size.Gibibyte})
+
+	Assert(t).IsTrue(success, "should have succeeded")
+	Assert(t).IsTrue(testPod.installed, "should have installed")
+	Assert(t).IsTrue(testPod.launched, "should have launched")
+}
+
+func TestPreparerRejectsPodsExceedingTheNodeCapacity(t *testing.T) {
+	testPod, success := testCapacity(t, consul.NodeCapacity{CPUs: 4, Memory: 4 * size.Gibibyte})
+
+	Assert(t).IsFalse(success, "should have failed")
+	Assert(t).IsFalse(testPod.installed, "should not have installed a pod exceeding the node's memory")
+	Assert(t).IsFalse(testPod.launched, "should not have launched")
+}
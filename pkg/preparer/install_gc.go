@@ -0,0 +1,296 @@
+package preparer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/util"
+	"github.com/square/p2/pkg/util/size"
+)
+
+// DefaultInstallGCInterval is how often old installs are removed if
+// InstallGCConfig.Interval isn't set.
+const DefaultInstallGCInterval = 1 * time.Hour
+
+// InstallGCConfig is the "install_gc" section of the preparer config, e.g.
+//
+//	install_gc:
+//	  keep_versions: 3
+//	  disk_budget: 200G
+//
+// The installs that the "current" and "last" links of a launchable point to,
+// and its newest install, are never removed.
+type InstallGCConfig struct {
+	// If positive, only this many of the newest installs of each launchable
+	// are kept
+	KeepVersions int `yaml:"keep_versions,omitempty"`
+	// If set, the oldest installs across every pod are removed until the
+	// installs in the pod root take up no more than this, e.g. "200G"
+	DiskBudget string `yaml:"disk_budget,omitempty"`
+	// Defaults to DefaultInstallGCInterval
+	Interval time.Duration `yaml:"interval,omitempty"`
+}
+
+// InstallGC periodically removes old installs of the launchables in a pod
+// root, complementing the per launchable max_launchable_disk_usage which is
+// only enforced when a pod is launched.
+type InstallGC struct {
+	podRoot      string
+	keepVersions int
+	diskBudget   size.ByteCount
+	interval     time.Duration
+	locks        *installLocks
+	logger       logging.Logger
+}
+
+func newInstallGC(config InstallGCConfig, podRoot string, locks *installLocks, logger logging.Logger) (*InstallGC, error) {
+	gc := &InstallGC{
+		podRoot:      podRoot,
+		keepVersions: config.KeepVersions,
+		interval:     config.Interval,
+		locks:        locks,
+		logger:       logger,
+	}
+	if config.DiskBudget != "" {
+		var err error
+		gc.diskBudget, err = size.Parse(config.DiskBudget)
+		if err != nil {
+			return nil, util.Errorf("Unparseable value for install_gc disk_budget %v, %v", config.DiskBudget, err)
+		}
+	}
+	if gc.keepVersions <= 0 && gc.diskBudget <= 0 {
+		return nil, util.Errorf("install_gc must set keep_versions or disk_budget")
+	}
+	if gc.interval <= 0 {
+		gc.interval = DefaultInstallGCInterval
+	}
+	return gc, nil
+}
+
+// install is an installed version of a launchable.
+type install struct {
+	launchableRoot string
+	name           string
+	modTime        time.Time
+	size           size.ByteCount
+	// Set for the installs that are never removed
+	inUse bool
+}
+
+func (i install) path() string {
+	return filepath.Join(i.launchableRoot, "installs", i.name)
+}
+
+type installsOldestFirst []install
+
+func (in installsOldestFirst) Len() int           { return len(in) }
+func (in installsOldestFirst) Swap(i, j int)      { in[i], in[j] = in[j], in[i] }
+func (in installsOldestFirst) Less(i, j int) bool { return in[i].modTime.Before(in[j].modTime) }
+
+// Run removes old installs every interval until quit is closed.
+func (gc *InstallGC) Run(quit <-chan struct{}) {
+	for {
+		err := gc.Collect()
+		if err != nil {
+			gc.logger.WithError(err).Errorln("Could not remove old installs")
+		}
+		select {
+		case <-quit:
+			return
+		case <-time.After(gc.interval):
+		}
+	}
+}
+
+// Collect removes the installs of each launchable beyond the newest
+// keep_versions, then the oldest remaining installs until the rest fit in the
+// disk budget.
+func (gc *InstallGC) Collect() error {
+	launchables, err := gc.findInstalls()
+	if err != nil {
+		return err
+	}
+
+	var toRemove, kept []install
+	var total size.ByteCount
+	for _, installs := range launchables {
+		sort.Sort(sort.Reverse(installsOldestFirst(installs)))
+		for i, inst := range installs {
+			if !inst.inUse && gc.keepVersions > 0 && i >= gc.keepVersions {
+				toRemove = append(toRemove, inst)
+				continue
+			}
+			kept = append(kept, inst)
+			total += inst.size
+		}
+	}
+
+	if gc.diskBudget > 0 && total > gc.diskBudget {
+		sort.Sort(installsOldestFirst(kept))
+		for _, inst := range kept {
+			if total <= gc.diskBudget {
+				break
+			}
+			if inst.inUse {
+				continue
+			}
+			toRemove = append(toRemove, inst)
+			total -= inst.size
+		}
+		if total > gc.diskBudget {
+			gc.logger.WithFields(logrus.Fields{
+				"total":       total.String(),
+				"disk_budget": gc.diskBudget.String(),
+			}).Warnln("Installs in use exceed the disk budget")
+		}
+	}
+
+	return gc.remove(toRemove)
+}
+
+// findInstalls returns the installs of every launchable in the pod root.
+func (gc *InstallGC) findInstalls() ([][]install, error) {
+	podHomes, err := ioutil.ReadDir(gc.podRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	var launchables [][]install
+	for _, podHome := range podHomes {
+		if !podHome.IsDir() || strings.HasPrefix(podHome.Name(), ".") {
+			continue
+		}
+		entries, err := ioutil.ReadDir(filepath.Join(gc.podRoot, podHome.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+			launchableRoot := filepath.Join(gc.podRoot, podHome.Name(), entry.Name())
+			installs, err := findLaunchableInstalls(launchableRoot)
+			if err != nil {
+				return nil, err
+			}
+			if len(installs) > 0 {
+				launchables = append(launchables, installs)
+			}
+		}
+	}
+	return launchables, nil
+}
+
+// findLaunchableInstalls returns the installs of the launchable, or none if
+// the directory isn't a launchable.
+func findLaunchableInstalls(launchableRoot string) ([]install, error) {
+	infos, err := ioutil.ReadDir(filepath.Join(launchableRoot, "installs"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	linked, err := linkedInstalls(launchableRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	var installs []install
+	newest := -1
+	for _, info := range infos {
+		if !info.IsDir() {
+			continue
+		}
+		inst := install{
+			launchableRoot: launchableRoot,
+			name:           info.Name(),
+			modTime:        info.ModTime(),
+			inUse:          linked[info.Name()],
+		}
+		inst.size, err = sizeOfDir(inst.path())
+		if err != nil {
+			return nil, err
+		}
+		installs = append(installs, inst)
+		if newest == -1 || inst.modTime.After(installs[newest].modTime) {
+			newest = len(installs) - 1
+		}
+	}
+	// The newest install may be about to be launched, or prefetched
+	if newest != -1 {
+		installs[newest].inUse = true
+	}
+	return installs, nil
+}
+
+// linkedInstalls returns the names of the installs that the launchable's
+// "current" and "last" links point to.
+func linkedInstalls(launchableRoot string) (map[string]bool, error) {
+	linked := make(map[string]bool)
+	for _, link := range []string{"current", "last"} {
+		target, err := os.Readlink(filepath.Join(launchableRoot, link))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		linked[filepath.Base(target)] = true
+	}
+	return linked, nil
+}
+
+func sizeOfDir(dir string) (size.ByteCount, error) {
+	var total int64
+	err := filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			// e.g. removed by an install replacing it
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			total += info.Size()
+		}
+		return nil
+	})
+	return size.ByteCount(total), err
+}
+
+// remove deletes the installs while no pod is being installed or launched.
+// Installs that were linked since they were found are kept.
+func (gc *InstallGC) remove(installs []install) error {
+	if len(installs) == 0 {
+		return nil
+	}
+	gc.locks.gc.Lock()
+	defer gc.locks.gc.Unlock()
+
+	var lastErr error
+	for _, inst := range installs {
+		linked, err := linkedInstalls(inst.launchableRoot)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if linked[inst.name] {
+			continue
+		}
+		err = os.RemoveAll(inst.path())
+		if err != nil {
+			gc.logger.WithError(err).WithField("install", inst.path()).Errorln("Could not remove old install")
+			lastErr = err
+			continue
+		}
+		gc.logger.WithFields(logrus.Fields{
+			"install": inst.path(),
+			"size":    inst.size.String(),
+		}).Infoln("Removed old install")
+	}
+	return lastErr
+}
@@ -0,0 +1,118 @@
+package preparer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/logging"
+)
+
+// writeInstall creates an install of size bytes, modified age ago.
+func writeInstall(t *testing.T, launchableRoot string, name string, bytes int, age time.Duration) {
+	dir := filepath.Join(launchableRoot, "installs", name)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "bin"), []byte(strings.Repeat("x", bytes)), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Now().Add(-age)
+	err = os.Chtimes(dir, modTime, modTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func installed(launchableRoot string, name string) bool {
+	_, err := os.Stat(filepath.Join(launchableRoot, "installs", name))
+	return err == nil
+}
+
+func testPodRoot(t *testing.T) (string, string, string) {
+	podRoot, err := ioutil.TempDir("", "install_gc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := filepath.Join(podRoot, "app", "web")
+	writeInstall(t, app, "v1", 100, 5*time.Hour)
+	writeInstall(t, app, "v2", 100, 4*time.Hour)
+	writeInstall(t, app, "v3", 100, 3*time.Hour)
+	writeInstall(t, app, "v4", 100, 2*time.Hour)
+	err = os.Symlink(filepath.Join(app, "installs", "v1"), filepath.Join(app, "current"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other := filepath.Join(podRoot, "other", "worker")
+	writeInstall(t, other, "a", 1000, 10*time.Hour)
+	writeInstall(t, other, "b", 1000, time.Hour)
+	return podRoot, app, other
+}
+
+func TestInstallGCKeepsVersions(t *testing.T) {
+	podRoot, app, other := testPodRoot(t)
+	defer os.RemoveAll(podRoot)
+
+	gc, err := newInstallGC(InstallGCConfig{KeepVersions: 2}, podRoot, &installLocks{}, logging.TestLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = gc.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !installed(app, "v1") {
+		t.Error("expected the current install to be kept")
+	}
+	if installed(app, "v2") {
+		t.Error("expected an unused install beyond keep_versions to be removed")
+	}
+	if !installed(app, "v3") || !installed(app, "v4") {
+		t.Error("expected the newest installs to be kept")
+	}
+	if !installed(other, "a") || !installed(other, "b") {
+		t.Error("expected installs of other launchables to be kept")
+	}
+}
+
+func TestInstallGCEnforcesDiskBudget(t *testing.T) {
+	podRoot, app, other := testPodRoot(t)
+	defer os.RemoveAll(podRoot)
+
+	gc, err := newInstallGC(InstallGCConfig{DiskBudget: "1300B"}, podRoot, &installLocks{}, logging.TestLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = gc.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2400 bytes are installed, the oldest unused ones go first
+	if installed(other, "a") {
+		t.Error("expected the oldest install to be removed")
+	}
+	if installed(app, "v2") {
+		t.Error("expected the next oldest unused install to be removed")
+	}
+	if !installed(app, "v3") {
+		t.Error("expected installs to be kept once the budget was met")
+	}
+	if !installed(app, "v1") || !installed(app, "v4") || !installed(other, "b") {
+		t.Error("expected the current and newest installs to be kept")
+	}
+}
+
+func TestInstallGCRequiresALimit(t *testing.T) {
+	_, err := newInstallGC(InstallGCConfig{}, "/data/pods", &installLocks{}, logging.TestLogger())
+	if err == nil {
+		t.Fatal("expected an error when neither keep_versions nor disk_budget is set")
+	}
+}
@@ -48,8 +48,9 @@ type Hooks interface {
 
 type Store interface {
 	ListPods(podPrefix consul.PodPrefix, nodeName types.NodeName) ([]consul.ManifestResult, time.Duration, error)
-	SetPod(podPrefix consul.PodPrefix, nodeName types.NodeName, podManifest manifest.Manifest) (time.Duration, error)
 	Pod(podPrefix consul.PodPrefix, nodeName types.NodeName, podId types.PodID) (manifest.Manifest, time.Duration, error)
+	SetRealityManifest(nodeName types.NodeName, podManifest manifest.Manifest) (time.Duration, error)
+	DeleteRealityManifest(nodeName types.NodeName, podId types.PodID) (time.Duration, error)
 	DeletePod(podPrefix consul.PodPrefix, nodeName types.NodeName, podId types.PodID) (time.Duration, error)
 	WatchPods(
 		podPrefix consul.PodPrefix,
@@ -284,6 +285,9 @@ func (p *Preparer) handlePods(podChan <-chan ManifestPair, quit <-chan struct{})
 						break
 					case statusstore.IsNoStatus(err):
 						nextLaunch.Reality = nil
+					case status.Manifest == "":
+						// the pod is still being installed for the first time
+						nextLaunch.Reality = nil
 					default:
 						manifest, err := manifest.FromBytes([]byte(status.Manifest))
 						if err != nil {
@@ -380,6 +384,39 @@ func (p *Preparer) resolvePair(pair ManifestPair, pod Pod, logger logging.Logger
 
 }
 
+// renderTemplate substitutes the preparer's template variables into manifests
+// that declare template_vars. Other manifests are returned as is, so that
+// "{{" in e.g. their config is left alone.
+func (p *Preparer) renderTemplate(manifest manifest.Manifest) (manifest.Manifest, error) {
+	if manifest.GetTemplateVars() == nil {
+		return manifest, nil
+	}
+	return manifest.RenderTemplate(p.templateVars)
+}
+
+// renderPair renders both manifests of the pair with renderTemplate, so that
+// a pod is halted and uninstalled from the same manifest it was launched
+// from. SHAs are still compared, and reality and the pod status store still
+// written, using the manifests as scheduled, since other tools compare intent
+// and reality by SHA.
+func (p *Preparer) renderPair(pair ManifestPair) (ManifestPair, error) {
+	rendered := pair
+	var err error
+	if pair.Intent != nil {
+		rendered.Intent, err = p.renderTemplate(pair.Intent)
+		if err != nil {
+			return ManifestPair{}, util.Errorf("Could not render the intended manifest: %s", err)
+		}
+	}
+	if pair.Reality != nil {
+		rendered.Reality, err = p.renderTemplate(pair.Reality)
+		if err != nil {
+			return ManifestPair{}, util.Errorf("Could not render the current manifest: %s", err)
+		}
+	}
+	return rendered, nil
+}
+
 // artifactRegistryFor allows for overriding the artifact registry for
 // installation (or otherwise) on a per manifest basis
 func (p *Preparer) artifactRegistryFor(manifest manifest.Manifest) artifact.Registry {
@@ -395,36 +432,78 @@ func (p *Preparer) artifactRegistryFor(manifest manifest.Manifest) artifact.Regi
 	return p.artifactRegistry
 }
 
+// artifactVerifierFor returns the verifier to use for the launchables in the
+// given manifest. Manifests scheduled with p2-schedule --no-verify opt out of
+// artifact verification, but only if the pod is in the node's
+// no_verify_whitelist, as anyone who can write the intent tree can set it.
+func (p *Preparer) artifactVerifierFor(manifest manifest.Manifest) auth.ArtifactVerifier {
+	if manifest.GetArtifactVerification() != auth.VerifyNone {
+		return p.artifactVerifier
+	}
+	for _, podID := range p.noVerifyWhitelist {
+		if podID == manifest.ID() {
+			return auth.NopVerifier()
+		}
+	}
+	p.Logger.WithField("pod", manifest.ID()).Warnln("Ignoring artifact_verification: none for a pod that isn't in no_verify_whitelist")
+	return p.artifactVerifier
+}
+
 func (p *Preparer) installAndLaunchPod(pair ManifestPair, pod Pod, logger logging.Logger) bool {
-	p.tryRunHooks(hooks.BeforeInstall, pod, pair.Intent, logger)
+	// Everything is installed, launched, halted and hooked from the rendered
+	// pair, but the intent as scheduled is what is written to reality
+	rendered, err := p.renderPair(pair)
+	if err != nil {
+		logger.WithError(err).Errorln("Could not render manifest template")
+		p.reportPodState(pair, podstatus.PodInstalling, err, logger)
+		return false
+	}
+
+	p.tryRunHooks(hooks.BeforeInstall, pod, rendered.Intent, logger)
 
 	logger.NoFields().Infoln("Installing pod and launchables")
+	p.reportPodState(pair, podstatus.PodInstalling, nil, logger)
+
+	err = p.checkCapacity(pair, rendered.Intent)
+	if err != nil {
+		logger.WithError(err).Errorln("Pod does not fit on the node")
+		p.reportPodState(pair, podstatus.PodInstalling, err, logger)
+		return false
+	}
 
-	registry := p.artifactRegistryFor(pair.Intent)
-	err := pod.Install(pair.Intent, p.artifactVerifier, registry)
+	registry := p.artifactRegistryFor(rendered.Intent)
+	// Held until the pod is launched, since the InstallGC may remove the
+	// installs that Install found already installed, e.g. when rolling back,
+	// until the launch links them as current
+	unlock := p.installLocks.lock(podWorkerID{podID: pair.ID, podUniqueKey: pair.PodUniqueKey})
+	err = pod.Install(rendered.Intent, p.artifactVerifierFor(rendered.Intent), registry)
 	if err != nil {
+		unlock()
 		// install failed, abort and retry
 		logger.WithError(err).Errorln("Install failed")
+		p.reportPodState(pair, podstatus.PodInstalling, err, logger)
 		return false
 	}
 
-	err = pod.Verify(pair.Intent, p.authPolicy)
+	err = pod.Verify(rendered.Intent, p.authPolicy)
 	if err != nil {
+		unlock()
 		logger.WithError(err).
 			Errorln("Pod digest verification failed")
-		p.tryRunHooks(hooks.AfterAuthFail, pod, pair.Intent, logger)
+		p.reportPodState(pair, podstatus.PodInstalling, err, logger)
+		p.tryRunHooks(hooks.AfterAuthFail, pod, rendered.Intent, logger)
 		return false
 	}
 
-	p.tryRunHooks(hooks.AfterInstall, pod, pair.Intent, logger)
+	p.tryRunHooks(hooks.AfterInstall, pod, rendered.Intent, logger)
 
-	if pair.Reality != nil {
+	if rendered.Reality != nil {
 		// installAndLaunchPod implies that something was in intent, so let
 		// launchables decide whether they want to be halted
 		force := false
 
 		logger.NoFields().Infoln("Invoking the disable hook and halting runit services")
-		success, err := pod.Halt(pair.Reality, force)
+		success, err := pod.Halt(rendered.Reality, force)
 		if err != nil {
 			logger.WithError(err).
 				Errorln("Pod halt failed")
@@ -433,18 +512,21 @@ func (p *Preparer) installAndLaunchPod(pair ManifestPair, pod Pod, logger loggin
 		}
 	}
 
-	p.tryRunHooks(hooks.BeforeLaunch, pod, pair.Intent, logger)
+	p.tryRunHooks(hooks.BeforeLaunch, pod, rendered.Intent, logger)
 
 	logger.NoFields().Infoln("Setting up new runit services and running the enable hook")
+	p.reportPodState(pair, podstatus.PodLaunching, nil, logger)
 
-	ok, err := pod.Launch(pair.Intent)
+	ok, err := pod.Launch(rendered.Intent)
+	unlock()
 	if err != nil {
 		logger.WithError(err).
 			Errorln("Launch failed")
+		p.reportPodState(pair, podstatus.PodLaunching, err, logger)
 	} else {
 		if pair.PodUniqueKey == "" {
 			// legacy pod, write the manifest back to reality tree
-			duration, err := p.store.SetPod(consul.REALITY_TREE, p.node, pair.Intent)
+			duration, err := p.store.SetRealityManifest(p.node, pair.Intent)
 			if err != nil {
 				logger.WithErrorAndFields(err, logrus.Fields{
 					"duration": duration}).
@@ -461,13 +543,38 @@ func (p *Preparer) installAndLaunchPod(pair ManifestPair, pod Pod, logger loggin
 			}
 		}
 
-		p.tryRunHooks(hooks.AfterLaunch, pod, pair.Intent, logger)
+		p.tryRunHooks(hooks.AfterLaunch, pod, rendered.Intent, logger)
 
-		pod.Prune(p.maxLaunchableDiskUsage, pair.Intent) // errors are logged internally
+		pod.Prune(p.maxLaunchableDiskUsage, rendered.Intent) // errors are logged internally
 	}
 	return err == nil && ok
 }
 
+// reportPodState records the preparer's progress installing and launching a
+// uuid pod, and the error that interrupted it if any, in the pod status store.
+// Legacy pods only record that they are running, in the reality tree. Errors
+// are logged rather than retried, since the next state will be reported soon.
+func (p *Preparer) reportPodState(pair ManifestPair, state podstatus.PodState, lastErr error, logger logging.Logger) {
+	if pair.PodUniqueKey == "" {
+		return
+	}
+
+	var lastError string
+	if lastErr != nil {
+		lastError = lastErr.Error()
+	}
+	ctx, cancelFunc := transaction.New(context.Background())
+	defer cancelFunc()
+	err := p.podStatusStore.SetPodState(ctx, pair.PodUniqueKey, state, lastError)
+	if err == nil {
+		err = transaction.MustCommit(ctx, p.client.KV())
+	}
+	if err != nil {
+		logger.WithErrorAndFields(err, logrus.Fields{"state": state}).
+			Warnln("Could not update pod status")
+	}
+}
+
 func (p *Preparer) writeStatusRecord(pair ManifestPair, logger logging.Logger) error {
 	ctx, cancelFunc := transaction.New(context.Background())
 	defer cancelFunc()
@@ -485,7 +592,7 @@ func (p *Preparer) writeStatusRecord(pair ManifestPair, logger logging.Logger) e
 			return ps, util.Errorf("Could not convert manifest to string to update pod status")
 		}
 
-		ps.PodStatus = podstatus.PodLaunched
+		ps.SetState(podstatus.PodLaunched, "")
 		ps.Manifest = string(manifestBytes)
 		return ps, nil
 	}
@@ -512,16 +619,24 @@ func (p *Preparer) writeStatusRecord(pair ManifestPair, logger logging.Logger) e
 }
 
 func (p *Preparer) stopAndUninstallPod(pair ManifestPair, pod Pod, logger logging.Logger) bool {
+	rendered, err := p.renderPair(pair)
+	if err != nil {
+		// Don't keep a removed pod running because its template can no
+		// longer be rendered, e.g. after a template variable was dropped
+		logger.WithError(err).Warnln("Could not render manifest template, halting the pod as scheduled")
+		rendered = pair
+	}
+
 	// We're uninstalling a pod from the system, so force the process(es) to be stopped
 	force := true
-	success, err := pod.Halt(pair.Reality, force)
+	success, err := pod.Halt(rendered.Reality, force)
 	if err != nil {
 		logger.WithError(err).Errorln("Pod halt failed")
 	} else if !success {
 		logger.NoFields().Warnln("One or more launchables did not halt successfully")
 	}
 
-	p.tryRunHooks(hooks.BeforeUninstall, pod, pair.Reality, logger)
+	p.tryRunHooks(hooks.BeforeUninstall, pod, rendered.Reality, logger)
 
 	err = pod.Uninstall()
 	if err != nil {
@@ -531,7 +646,7 @@ func (p *Preparer) stopAndUninstallPod(pair ManifestPair, pod Pod, logger loggin
 	logger.NoFields().Infoln("Successfully uninstalled")
 
 	if pair.PodUniqueKey == "" {
-		dur, err := p.store.DeletePod(consul.REALITY_TREE, p.node, pair.ID)
+		dur, err := p.store.DeleteRealityManifest(p.node, pair.ID)
 		if err != nil {
 			logger.WithErrorAndFields(err, logrus.Fields{"duration": dur}).
 				Errorln("Could not delete pod from reality store")
@@ -557,7 +672,7 @@ func (p *Preparer) markUninstalled(pair ManifestPair, pod Pod, logger logging.Lo
 	ctx, cancelFunc := transaction.New(context.Background())
 	defer cancelFunc()
 	err := p.podStatusStore.MutateStatus(ctx, pair.PodUniqueKey, func(podStatus podstatus.PodStatus) (podstatus.PodStatus, error) {
-		podStatus.PodStatus = podstatus.PodRemoved
+		podStatus.SetState(podstatus.PodRemoved, "")
 		return podStatus, nil
 	})
 	if err != nil {
@@ -14,6 +14,7 @@ import (
 	"github.com/square/p2/pkg/auth"
 	"github.com/square/p2/pkg/constants"
 	"github.com/square/p2/pkg/hooks"
+	"github.com/square/p2/pkg/launch"
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/manifest"
 	"github.com/square/p2/pkg/store/consul"
@@ -30,6 +31,12 @@ type TestPod struct {
 	installed, uninstalled, launched, launchSuccess, halted, haltSuccess, forceHalted bool
 	installErr, uninstallErr, launchErr, haltError, currentManifestError              error
 	configDir, envDir                                                                 string
+
+	// If set, called by Launch
+	onLaunch func()
+
+	// The manifest passed to the last call to Halt
+	haltedManifest manifest.Manifest
 }
 
 func (t *TestPod) Prune(_ size.ByteCount, _ manifest.Manifest) {
@@ -43,6 +50,9 @@ func (t *TestPod) ManifestSHA() (string, error) {
 func (t *TestPod) Launch(manifest manifest.Manifest) (bool, error) {
 	t.currentManifest = manifest
 	t.launched = true
+	if t.onLaunch != nil {
+		t.onLaunch()
+	}
 	if t.launchErr != nil {
 		return false, t.launchErr
 	}
@@ -64,6 +74,7 @@ func (t *TestPod) Verify(manifest manifest.Manifest, authPolicy auth.Policy) err
 }
 
 func (t *TestPod) Halt(manifest manifest.Manifest, forceHalt bool) (bool, error) {
+	t.haltedManifest = manifest
 	t.halted = true
 	t.forceHalted = forceHalt
 	return t.haltSuccess, t.haltError
@@ -174,6 +185,21 @@ func testSignedManifest(t *testing.T, modify func(manifest.Builder, *openpgp.Ent
 type FakeStore struct {
 	currentManifest      manifest.Manifest
 	currentManifestError error
+
+	deletedPods []types.PodID
+
+	// The manifest last written to reality
+	realityManifest manifest.Manifest
+
+	// If nil the node hasn't advertised its capacity
+	nodeCapacity *consul.NodeCapacity
+}
+
+func (f *FakeStore) NodeCapacity(types.NodeName) (consul.NodeCapacity, error) {
+	if f.nodeCapacity == nil {
+		return consul.NodeCapacity{}, consul.NoNodeCapacity
+	}
+	return *f.nodeCapacity, nil
 }
 
 func (f *FakeStore) ListPods(consul.PodPrefix, types.NodeName) ([]consul.ManifestResult, time.Duration, error) {
@@ -188,15 +214,24 @@ func (f *FakeStore) ListPods(consul.PodPrefix, types.NodeName) ([]consul.Manifes
 	}, 0, nil
 }
 
-func (f *FakeStore) SetPod(consul.PodPrefix, types.NodeName, manifest.Manifest) (time.Duration, error) {
+func (f *FakeStore) Pod(consul.PodPrefix, types.NodeName, types.PodID) (manifest.Manifest, time.Duration, error) {
+	if f.currentManifest != nil {
+		return f.currentManifest, 0, f.currentManifestError
+	}
+	return nil, 0, fmt.Errorf("not implemented")
+}
+
+func (f *FakeStore) SetRealityManifest(_ types.NodeName, manifest manifest.Manifest) (time.Duration, error) {
+	f.realityManifest = manifest
 	return 0, nil
 }
 
-func (f *FakeStore) Pod(consul.PodPrefix, types.NodeName, types.PodID) (manifest.Manifest, time.Duration, error) {
-	return nil, 0, fmt.Errorf("not implemented")
+func (f *FakeStore) DeleteRealityManifest(types.NodeName, types.PodID) (time.Duration, error) {
+	return 0, nil
 }
 
-func (f *FakeStore) DeletePod(consul.PodPrefix, types.NodeName, types.PodID) (time.Duration, error) {
+func (f *FakeStore) DeletePod(_ consul.PodPrefix, _ types.NodeName, podID types.PodID) (time.Duration, error) {
+	f.deletedPods = append(f.deletedPods, podID)
 	return 0, nil
 }
 
@@ -218,6 +253,7 @@ func testPreparer(t *testing.T, f *FakeStore) (*Preparer, *fakeHooks, string) {
 	hooks := &fakeHooks{}
 	p.hooks = hooks
 	p.store = f
+	p.capacityStore = f
 	return p, hooks, podRoot
 }
 
@@ -243,6 +279,45 @@ func TestPreparerLaunchesNewPodsThatArentInstalledYet(t *testing.T) {
 	Assert(t).AreEqual(testPod.currentManifest, newManifest, "The manifest should be the new one")
 }
 
+func TestPreparerKeepsInstallGCOutUntilLaunched(t *testing.T) {
+	newManifest := testManifest(t)
+	newPair := ManifestPair{
+		ID:     newManifest.ID(),
+		Intent: newManifest,
+	}
+
+	p, _, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+
+	collected := make(chan struct{})
+	var collectedDuringLaunch bool
+	testPod := &TestPod{
+		launchSuccess: true,
+		onLaunch: func() {
+			go func() {
+				p.installLocks.gc.Lock()
+				p.installLocks.gc.Unlock()
+				close(collected)
+			}()
+			select {
+			case <-collected:
+				collectedDuringLaunch = true
+			case <-time.After(50 * time.Millisecond):
+			}
+		},
+	}
+	success := p.resolvePair(newPair, testPod, logging.DefaultLogger)
+	Assert(t).IsTrue(success, "should have succeeded")
+	Assert(t).IsFalse(collectedDuringLaunch, "the InstallGC should not have run while the pod was launched")
+
+	select {
+	case <-collected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the InstallGC should have run once the pod was launched")
+	}
+}
+
 func TestPreparerLaunchesPodsThatHaveDifferentSHAs(t *testing.T) {
 	builder := manifest.NewBuilder()
 	builder.SetID("hello")
@@ -275,6 +350,88 @@ func TestPreparerLaunchesPodsThatHaveDifferentSHAs(t *testing.T) {
 	Assert(t).AreEqual(newManifest, testPod.currentManifest, "the current manifest should now be the new manifest")
 }
 
+func TestPreparerLaunchesRenderedTemplate(t *testing.T) {
+	testPod := &TestPod{
+		launchSuccess: true,
+	}
+	newManifest := templatedManifest("hello", "https://example.com/hello_abc123.tar.gz")
+	newPair := ManifestPair{
+		ID:     newManifest.ID(),
+		Intent: newManifest,
+	}
+
+	p, _, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+	success := p.resolvePair(newPair, testPod, logging.DefaultLogger)
+
+	Assert(t).IsTrue(success, "should have succeeded")
+	Assert(t).IsTrue(testPod.launched, "Should have launched")
+	env := testPod.currentManifest.GetLaunchableStanzas()["app"].Env
+	Assert(t).AreEqual(env["NODE"], "hostname", "The launched manifest should have been rendered")
+}
+
+// templatedManifest returns a manifest whose app launchable's NODE env var is
+// the node's name once rendered
+func templatedManifest(id types.PodID, location string) manifest.Manifest {
+	builder := manifest.NewBuilder()
+	builder.SetID(id)
+	builder.SetTemplateVars(map[string]string{})
+	builder.SetLaunchables(map[launch.LaunchableID]launch.LaunchableStanza{
+		"app": {
+			LaunchableType: "hoist",
+			Location:       location,
+			Env:            map[string]string{"NODE": `{{ .Var "NODE_NAME" }}`},
+		},
+	})
+	return builder.GetManifest()
+}
+
+func TestPreparerHaltsRenderedReality(t *testing.T) {
+	existing := templatedManifest("hello", "https://example.com/hello_abc123.tar.gz")
+	newManifest := templatedManifest("hello", "https://example.com/hello_def456.tar.gz")
+	testPod := &TestPod{
+		launchSuccess: true,
+		haltSuccess:   true,
+	}
+	newPair := ManifestPair{
+		ID:      newManifest.ID(),
+		Reality: existing,
+		Intent:  newManifest,
+	}
+
+	store := &FakeStore{}
+	p, _, fakePodRoot := testPreparer(t, store)
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+	success := p.resolvePair(newPair, testPod, logging.DefaultLogger)
+
+	Assert(t).IsTrue(success, "should have succeeded")
+	halted := testPod.haltedManifest.GetLaunchableStanzas()["app"].Env
+	Assert(t).AreEqual(halted["NODE"], "hostname", "The halted manifest should have been rendered")
+	Assert(t).AreEqual(store.realityManifest, newManifest, "Reality should be the intent as scheduled")
+}
+
+func TestPreparerUninstallsRenderedReality(t *testing.T) {
+	existing := templatedManifest("hello", "https://example.com/hello_abc123.tar.gz")
+	testPod := &TestPod{
+		haltSuccess: true,
+	}
+	newPair := ManifestPair{
+		ID:      existing.ID(),
+		Reality: existing,
+	}
+
+	p, _, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+	success := p.resolvePair(newPair, testPod, logging.DefaultLogger)
+
+	Assert(t).IsTrue(success, "should have uninstalled the pod")
+	halted := testPod.haltedManifest.GetLaunchableStanzas()["app"].Env
+	Assert(t).AreEqual(halted["NODE"], "hostname", "The halted manifest should have been rendered")
+}
+
 func TestPreparerFailsIfInstallFails(t *testing.T) {
 	testPod := &TestPod{
 		installErr: fmt.Errorf("There was an error installing"),
@@ -466,3 +623,30 @@ func TestPreparerWillAcceptSignatureWhenKeyringIsNil(t *testing.T) {
 		"expected the preparer to verify the signature when no keyring given",
 	)
 }
+
+type rejectingVerifier struct{}
+
+func (rejectingVerifier) VerifyHoistArtifact(_ *os.File, _ auth.VerificationData) error {
+	return util.Errorf("rejected")
+}
+
+func TestPreparerOnlySkipsVerificationForWhitelistedPods(t *testing.T) {
+	builder := testManifest(t).GetBuilder()
+	builder.SetArtifactVerification(auth.VerifyNone)
+	noVerify := builder.GetManifest()
+
+	p, _, fakePodRoot := testPreparer(t, &FakeStore{})
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+	p.artifactVerifier = rejectingVerifier{}
+
+	_, verified := p.artifactVerifierFor(noVerify).(rejectingVerifier)
+	Assert(t).IsTrue(verified, "expected pods outside no_verify_whitelist to be verified")
+
+	p.noVerifyWhitelist = []types.PodID{noVerify.ID()}
+	_, verified = p.artifactVerifierFor(noVerify).(rejectingVerifier)
+	Assert(t).IsFalse(verified, "expected a whitelisted pod to skip verification")
+
+	_, verified = p.artifactVerifierFor(testManifest(t)).(rejectingVerifier)
+	Assert(t).IsTrue(verified, "expected a whitelisted pod that doesn't opt out to be verified")
+}
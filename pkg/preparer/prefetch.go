@@ -0,0 +1,177 @@
+package preparer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+)
+
+// installLocks serializes the installs of a pod by the intent and prefetch
+// watches, which would otherwise extract the same artifacts at once, and keeps
+// the InstallGC from removing installs while any pod is being installed or,
+// for the intent watch, launched.
+type installLocks struct {
+	mu    sync.Mutex
+	locks map[podWorkerID]*sync.Mutex
+
+	// Held for reading by installs and for writing by the InstallGC
+	gc sync.RWMutex
+}
+
+// lock blocks until the pod may be installed, returning the function that
+// releases it.
+func (l *installLocks) lock(id podWorkerID) func() {
+	l.gc.RLock()
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[podWorkerID]*sync.Mutex)
+	}
+	podLock, ok := l.locks[id]
+	if !ok {
+		podLock = &sync.Mutex{}
+		l.locks[id] = podLock
+	}
+	l.mu.Unlock()
+
+	podLock.Lock()
+	return func() {
+		podLock.Unlock()
+		l.gc.RUnlock()
+	}
+}
+
+// WatchForPrefetchManifests installs the legacy pods staged for this node in
+// the prefetch tree, e.g. by p2-schedule --prefetch-only, without launching
+// them. Once a pod is installed its staged manifest is removed, which tells
+// the deployer it is ready: scheduling the same manifest in the intent tree
+// then only has to halt the old version and launch the installed one.
+func (p *Preparer) WatchForPrefetchManifests(quit <-chan struct{}) {
+	quitChan := make(chan struct{})
+	errChan := make(chan error)
+	podChan := make(chan []consul.ManifestResult, 1)
+
+	go p.store.WatchPods(consul.PREFETCH_TREE, p.node, quitChan, errChan, podChan)
+
+	manifestChanMap := make(map[types.PodID]chan manifest.Manifest)
+	for {
+		select {
+		case err := <-errChan:
+			p.Logger.WithError(err).
+				Errorln("there was an error reading the prefetch manifests")
+		case results := <-podChan:
+			for _, result := range results {
+				if result.PodUniqueKey != "" {
+					continue
+				}
+				podID := result.Manifest.ID()
+				if _, ok := manifestChanMap[podID]; !ok {
+					// buffered so that the latest staged manifest
+					// replaces one the worker hasn't started yet
+					manifestChanMap[podID] = make(chan manifest.Manifest, 1)
+					go p.handlePrefetches(podID, manifestChanMap[podID], quitChan)
+				}
+				select {
+				case <-manifestChanMap[podID]:
+				default:
+				}
+				manifestChanMap[podID] <- result.Manifest
+			}
+		case <-quit:
+			close(quitChan)
+			return
+		}
+	}
+}
+
+// handlePrefetches installs each manifest staged for the pod, retrying with a
+// backoff until it succeeds or a newer manifest is staged.
+func (p *Preparer) handlePrefetches(podID types.PodID, manifestChan <-chan manifest.Manifest, quit <-chan struct{}) {
+	var next manifest.Manifest
+	backoffTime := minimumBackoffTime
+	for {
+		select {
+		case <-quit:
+			return
+		case next = <-manifestChan:
+			backoffTime = minimumBackoffTime
+		case <-time.After(backoffTime):
+			if next == nil {
+				break
+			}
+			sha, _ := next.SHA()
+			logger := p.Logger.SubLogger(logrus.Fields{
+				"pod":      podID,
+				"sha":      sha,
+				"prefetch": true,
+			})
+			if p.prefetchPod(next, p.podFactory.NewLegacyPod(podID), logger) {
+				next = nil
+				backoffTime = minimumBackoffTime
+			} else {
+				// Double the backoff time with a maximum of 1 minute
+				backoffTime = backoffTime * 2
+				if backoffTime > 1*time.Minute {
+					backoffTime = 1 * time.Minute
+				}
+			}
+		}
+	}
+}
+
+// prefetchPod installs and verifies a staged manifest without halting or
+// launching anything, then removes it from the prefetch tree. It returns false
+// if the install should be retried.
+func (p *Preparer) prefetchPod(staged manifest.Manifest, pod Pod, logger logging.Logger) bool {
+	if !p.authorize(staged, logger) {
+		// prevent future unnecessary loops, the manifest won't become
+		// authorized. It is left staged so the failure can be inspected
+		return true
+	}
+
+	rendered, err := p.renderTemplate(staged)
+	if err != nil {
+		logger.WithError(err).Errorln("Could not render manifest template")
+		return false
+	}
+
+	logger.NoFields().Infoln("Prefetching pod launchables")
+	unlock := p.installLocks.lock(podWorkerID{podID: staged.ID()})
+	err = pod.Install(rendered, p.artifactVerifierFor(rendered), p.artifactRegistryFor(rendered))
+	unlock()
+	if err != nil {
+		logger.WithError(err).Errorln("Prefetch failed")
+		return false
+	}
+	err = pod.Verify(rendered, p.authPolicy)
+	if err != nil {
+		logger.WithError(err).Errorln("Prefetched pod digest verification failed")
+		return false
+	}
+	logger.NoFields().Infoln("Prefetched pod, it will launch when scheduled in the intent tree")
+
+	// Leave a manifest that was staged in the meantime for the next
+	// prefetch
+	sha, _ := staged.SHA()
+	current, _, err := p.store.Pod(consul.PREFETCH_TREE, p.node, staged.ID())
+	if err == pods.NoCurrentManifest {
+		return true
+	} else if err != nil {
+		logger.WithError(err).Errorln("Could not read the staged manifest")
+		return false
+	}
+	if currentSHA, _ := current.SHA(); currentSHA != sha {
+		return true
+	}
+	_, err = p.store.DeletePod(consul.PREFETCH_TREE, p.node, staged.ID())
+	if err != nil {
+		logger.WithError(err).Errorln("Could not remove the prefetched manifest")
+		return false
+	}
+	return true
+}
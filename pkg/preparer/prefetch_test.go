@@ -0,0 +1,45 @@
+package preparer
+
+import (
+	"os"
+	"testing"
+
+	. "github.com/anthonybishopric/gotcha"
+	"github.com/square/p2/pkg/logging"
+)
+
+func TestPrefetchInstallsWithoutLaunching(t *testing.T) {
+	testPod := &TestPod{}
+	staged := testManifest(t)
+
+	store := &FakeStore{currentManifest: staged}
+	p, hooks, fakePodRoot := testPreparer(t, store)
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+	success := p.prefetchPod(staged, testPod, logging.DefaultLogger)
+
+	Assert(t).IsTrue(success, "should have succeeded")
+	Assert(t).IsTrue(testPod.installed, "should have installed")
+	Assert(t).IsFalse(testPod.launched, "should not have launched")
+	Assert(t).IsFalse(testPod.halted, "should not have halted the running version")
+	Assert(t).IsFalse(hooks.ranBeforeInstall, "should not have run install hooks")
+	Assert(t).AreEqual(len(store.deletedPods), 1, "should have removed the staged manifest")
+}
+
+func TestPrefetchLeavesNewerStagedManifest(t *testing.T) {
+	testPod := &TestPod{}
+	staged := testManifest(t)
+	builder := staged.GetBuilder()
+	builder.SetRunAsUser("someone_else")
+	newer := builder.GetManifest()
+
+	store := &FakeStore{currentManifest: newer}
+	p, _, fakePodRoot := testPreparer(t, store)
+	defer p.Close()
+	defer os.RemoveAll(fakePodRoot)
+	success := p.prefetchPod(staged, testPod, logging.DefaultLogger)
+
+	Assert(t).IsTrue(success, "should have succeeded")
+	Assert(t).IsTrue(testPod.installed, "should have installed")
+	Assert(t).AreEqual(len(store.deletedPods), 0, "should not have removed the newer staged manifest")
+}
@@ -21,6 +21,7 @@ import (
 	"gopkg.in/yaml.v2"
 
 	"github.com/square/p2/pkg/artifact"
+	"github.com/square/p2/pkg/artifactcache"
 	"github.com/square/p2/pkg/auth"
 	"github.com/square/p2/pkg/constants"
 	"github.com/square/p2/pkg/hooks"
@@ -32,11 +33,13 @@ import (
 	"github.com/square/p2/pkg/preparer/podprocess"
 	"github.com/square/p2/pkg/runit"
 	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/store/consul/artifactcachestore"
 	"github.com/square/p2/pkg/store/consul/consulutil"
 	"github.com/square/p2/pkg/store/consul/podstore"
 	"github.com/square/p2/pkg/store/consul/statusstore"
 	"github.com/square/p2/pkg/store/consul/statusstore/podstatus"
 	"github.com/square/p2/pkg/store/consul/transaction"
+	"github.com/square/p2/pkg/systemd"
 	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/uri"
 	"github.com/square/p2/pkg/util"
@@ -67,6 +70,7 @@ type LogDestination struct {
 type PodStatusStore interface {
 	Get(key types.PodUniqueKey) (podstatus.PodStatus, *api.QueryMeta, error)
 	MutateStatus(ctx context.Context, key types.PodUniqueKey, mutator func(podstatus.PodStatus) (podstatus.PodStatus, error)) error
+	SetPodState(ctx context.Context, key types.PodUniqueKey, state podstatus.PodState, lastError string) error
 }
 
 type Preparer struct {
@@ -92,6 +96,20 @@ type Preparer struct {
 	// and quit channel conditially created
 	PodProcessReporter *podprocess.Reporter
 
+	// Exported so that it can be served by the caller if configured
+	ArtifactCache *artifactcache.Cache
+
+	// Serializes installs of a pod staged in the prefetch tree with installs
+	// of its intent
+	installLocks installLocks
+
+	// Exported so it can be checked for nil (it only runs if configured)
+	InstallGC *InstallGC
+
+	// Pods that would exceed the capacity the node advertises here aren't
+	// installed. Nil if the capacity isn't checked
+	capacityStore CapacityStore
+
 	// The pod manifest to use for hooks
 	hooksManifest manifest.Manifest
 
@@ -100,6 +118,14 @@ type Preparer struct {
 
 	// The directory that will actually be executed by the HookDir
 	hooksExecDir string
+
+	// The variables to render manifests' templates with, see
+	// PreparerConfig.TemplateVars
+	templateVars map[string]string
+
+	// The pods whose manifests may opt out of artifact verification, see
+	// PreparerConfig.NoVerifyWhitelist
+	noVerifyWhitelist []types.PodID
 }
 
 type store interface {
@@ -152,10 +178,47 @@ type PreparerConfig struct {
 
 	OSVersionFile string `yaml:"os_version_file,omitempty"`
 
+	// The number of artifacts fetched and verified at once, across every pod.
+	// Defaults to artifact.DefaultDownloadConcurrency
+	ArtifactDownloadConcurrency int `yaml:"artifact_download_concurrency,omitempty"`
+	// The longest an artifact may take to be fetched and verified before its
+	// install fails. Zero means no limit
+	ArtifactDownloadTimeout time.Duration `yaml:"artifact_download_timeout,omitempty"`
+	// How artifact downloads over HTTP are retried and, if interrupted,
+	// resumed from where they stopped. By default a download is attempted
+	// once
+	ArtifactDownloadRetry uri.RetryPolicy `yaml:"artifact_download_retry,omitempty"`
+	// If positive, the most bytes per second read by every artifact
+	// download combined
+	ArtifactDownloadBandwidth int `yaml:"artifact_download_bandwidth,omitempty"`
+	// Credentials for downloading "s3://" artifact URIs. Credentials and
+	// the region that are not set are read from the AWS_* environment
+	// variables, so "s3: {}" configures S3 from the environment alone
+	S3 *uri.S3FetcherOptions `yaml:"s3,omitempty"`
+	// Credentials for downloading "az://" artifact URIs
+	Azure *uri.AzureFetcherOptions `yaml:"azure,omitempty"`
+	// If set, verified artifacts are shared with other nodes, and artifacts
+	// whose digest is pinned are fetched from nodes sharing them first
+	ArtifactCache *artifactcache.Config `yaml:"artifact_cache,omitempty"`
+	// If set, old installs of every pod are removed periodically rather than
+	// only when the pod is launched
+	InstallGC *InstallGCConfig `yaml:"install_gc,omitempty"`
+	// If set, advertised as the node's capacity when the preparer starts.
+	// Either way pods are only installed if the totals of the cgroup limits
+	// of the node's pods fit in the capacity advertised for the node, if any
+	NodeCapacity *consul.NodeCapacity `yaml:"node_capacity,omitempty"`
+	// How the services of pods are supervised: "runit" (the default) or
+	// "systemd" for hosts without runit
+	Supervisor string `yaml:"supervisor,omitempty"`
+
 	ReadOnlyDeploys   bool          `yaml:"read_only_deploys"`
 	ReadOnlyWhitelist []types.PodID `yaml:"read_only_whitelist"`
 	ReadOnlyBlacklist []types.PodID `yaml:"read_only_blacklist"`
 
+	// The pods whose manifests may set artifact_verification: none. The
+	// launchables of any other pod are verified regardless of the setting
+	NoVerifyWhitelist []types.PodID `yaml:"no_verify_whitelist,omitempty"`
+
 	// The pod manifest to use for hooks. If no hooks are desired, use the
 	// NoHooksSentinelValue constant to indicate that there aren't any
 	HooksManifest string `yaml:"hooks_manifest,omitempty"`
@@ -173,6 +236,11 @@ type PreparerConfig struct {
 	// clients, e.g. consul client vs artifact downloader
 	HTTPTimeout time.Duration `yaml:"http_timeout"`
 
+	// TemplateVars are substituted into pod manifests that declare
+	// template_vars at deploy time. NODE_NAME is always set to the node's
+	// name.
+	TemplateVars map[string]string `yaml:"template_vars,omitempty"`
+
 	// Use a single Store so that all requests go through the same HTTP client.
 	consulClientMux sync.Mutex
 	consulClient    consulutil.ConsulClient
@@ -206,11 +274,47 @@ type UserAuth struct {
 // "type: manifest" - checks that builds have corresponding digest manifest and
 //  						      manifest signature files.
 // "type: either"   - checks that one of "build" or "manifest" strategies pass.
+// "type: sigstore" - checks that builds have a corresponding cosign signature,
+//                    see SigstoreVerification.
 //
 type ManifestVerification struct {
-	Type           string
+	Type string
+	// A keyring file, or a directory of keyring files whose keys are merged.
+	// The keyring is re-read whenever its files change.
 	KeyringPath    string   `yaml:"keyring,omitempty"`
 	AllowedSigners []string `yaml:"allowed_signers"`
+	// The path of an auth.SignerPolicy file restricting which keys of the
+	// keyring may sign the artifacts of each pod. Optional.
+	SignerPolicyPath string `yaml:"signer_policy,omitempty"`
+	// If set, artifacts that pass verification are remembered in this
+	// directory and not verified again, until the keyring, signer policy or
+	// sigstore keys change. Optional.
+	CacheDirectory string `yaml:"cache_dir,omitempty"`
+}
+
+// Configuration fields for the "sigstore" artifact verification type
+type SigstoreVerification struct {
+	Type string
+	// A file of PEM encoded public keys, e.g. a cosign.pub
+	PublicKeyPath string `yaml:"public_key"`
+	// If set, signatures must also be logged in this Rekor transparency log,
+	// e.g. https://rekor.sigstore.dev
+	RekorURL string `yaml:"rekor_url,omitempty"`
+	// The PEM encoded public key of the Rekor log. Required with rekor_url
+	RekorPublicKeyPath string `yaml:"rekor_public_key,omitempty"`
+}
+
+// loadSignerPolicy returns the configured signer policy, or nil if there is
+// none.
+func (v ManifestVerification) loadSignerPolicy() (*auth.SignerPolicy, error) {
+	if v.SignerPolicyPath == "" {
+		return nil, nil
+	}
+	policy, err := auth.LoadSignerPolicy(v.SignerPolicyPath)
+	if err != nil {
+		return nil, util.Errorf("error configuring artifact verification: %v", err)
+	}
+	return policy, nil
 }
 
 // LoadConfig reads the preparer's configuration from a file.
@@ -415,6 +519,10 @@ func New(preparerConfig *PreparerConfig, logger logging.Logger) (*Preparer, erro
 	if err != nil {
 		return nil, err
 	}
+	artifactVerifier, err = cacheArtifactVerification(preparerConfig, artifactVerifier, &logger)
+	if err != nil {
+		return nil, err
+	}
 
 	artifactRegistry, err := getArtifactRegistry(preparerConfig)
 	if err != nil {
@@ -496,8 +604,16 @@ func New(preparerConfig *PreparerConfig, logger logging.Logger) (*Preparer, erro
 	if err != nil {
 		return nil, err
 	}
-	fetcher := uri.BasicFetcher{
+	basicFetcher := uri.BasicFetcher{
 		Client: httpClient,
+		Retry:  preparerConfig.ArtifactDownloadRetry,
+	}
+	if preparerConfig.ArtifactDownloadBandwidth > 0 {
+		basicFetcher.BandwidthLimit = uri.NewBandwidthLimit(preparerConfig.ArtifactDownloadBandwidth)
+	}
+	fetcher, err := preparerConfig.artifactFetcher(basicFetcher)
+	if err != nil {
+		return nil, err
 	}
 
 	var hooksManifest manifest.Manifest
@@ -545,7 +661,34 @@ func New(preparerConfig *PreparerConfig, logger logging.Logger) (*Preparer, erro
 
 	podFactory := pods.NewFactory(preparerConfig.PodRoot, preparerConfig.NodeName, fetcher, preparerConfig.RequireFile, readOnlyPolicy)
 	podFactory.SetOSVersionDetector(osVersionDetector)
-	return &Preparer{
+	switch preparerConfig.Supervisor {
+	case "", "runit":
+	case "systemd":
+		podFactory.SetSupervisor(systemd.DefaultBuilder, systemd.DefaultSV)
+	default:
+		return nil, util.Errorf("Unknown supervisor %q, expected runit or systemd", preparerConfig.Supervisor)
+	}
+	downloadPool := artifact.NewDownloadPool(preparerConfig.ArtifactDownloadConcurrency, preparerConfig.ArtifactDownloadTimeout)
+	var artifactCache *artifactcache.Cache
+	if preparerConfig.ArtifactCache != nil {
+		artifactCacheLogger := logger.SubLogger(logrus.Fields{
+			"component": "ArtifactCache",
+		})
+		artifactCache, err = artifactcache.New(*preparerConfig.ArtifactCache, preparerConfig.NodeName, artifactcachestore.NewConsul(client.KV()), httpClient, artifactCacheLogger)
+		if err != nil {
+			return nil, err
+		}
+		downloadPool.SetPeerCache(artifactCache)
+	}
+	podFactory.SetDownloadPool(downloadPool)
+	templateVars := map[string]string{
+		"NODE_NAME": preparerConfig.NodeName.String(),
+	}
+	for name, value := range preparerConfig.TemplateVars {
+		templateVars[name] = value
+	}
+
+	prep := &Preparer{
 		node:                   preparerConfig.NodeName,
 		store:                  store,
 		hooks:                  hooks.NewContext(preparerConfig.HooksDirectory, preparerConfig.PodRoot, &logger, auditLogger),
@@ -563,11 +706,35 @@ func New(preparerConfig *PreparerConfig, logger logging.Logger) (*Preparer, erro
 		artifactVerifier:       artifactVerifier,
 		artifactRegistry:       artifactRegistry,
 		PodProcessReporter:     podProcessReporter,
+		ArtifactCache:          artifactCache,
 		hooksManifest:          hooksManifest,
 		hooksPod:               hooksPod,
 		hooksExecDir:           preparerConfig.HooksDirectory,
 		fetcher:                fetcher,
-	}, nil
+		templateVars:           templateVars,
+		capacityStore:          store,
+		noVerifyWhitelist:      preparerConfig.NoVerifyWhitelist,
+	}
+
+	if preparerConfig.NodeCapacity != nil {
+		// The capacity is only read when pods are installed, so a failure
+		// here shouldn't keep already installed pods from running
+		err = store.SetNodeCapacity(preparerConfig.NodeName, *preparerConfig.NodeCapacity)
+		if err != nil {
+			logger.WithError(err).Errorln("Could not advertise the node's capacity")
+		}
+	}
+
+	if preparerConfig.InstallGC != nil {
+		installGCLogger := logger.SubLogger(logrus.Fields{
+			"component": "InstallGC",
+		})
+		prep.InstallGC, err = newInstallGC(*preparerConfig.InstallGC, preparerConfig.PodRoot, &prep.installLocks, installGCLogger)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return prep, nil
 }
 
 func getDeployerAuth(preparerConfig *PreparerConfig) (auth.Policy, error) {
@@ -629,8 +796,9 @@ func getArtifactVerifier(preparerConfig *PreparerConfig, logger *logging.Logger)
 		return nil, err
 	}
 
-	fetcher := uri.BasicFetcher{
-		Client: httpClient,
+	fetcher, err := preparerConfig.artifactFetcher(uri.BasicFetcher{Client: httpClient})
+	if err != nil {
+		return nil, err
 	}
 	var verif ManifestVerification
 	switch t, _ := preparerConfig.ArtifactAuth["type"].(string); t {
@@ -641,32 +809,181 @@ func getArtifactVerifier(preparerConfig *PreparerConfig, logger *logging.Logger)
 		if err != nil {
 			return nil, util.Errorf("error configuring artifact verification: %v", err)
 		}
-		return auth.NewBuildManifestVerifier(verif.KeyringPath, fetcher, logger)
+		signerPolicy, err := verif.loadSignerPolicy()
+		if err != nil {
+			return nil, err
+		}
+		verifier, err := auth.NewBuildManifestVerifier(verif.KeyringPath, fetcher, logger)
+		if err != nil {
+			return nil, err
+		}
+		verifier.SignerPolicy = signerPolicy
+		return verifier, nil
 	case auth.VerifyBuild:
 		err = castYaml(preparerConfig.ArtifactAuth, &verif)
 		if err != nil {
 			return nil, util.Errorf("error configuring artifact verification: %v", err)
 		}
-		return auth.NewBuildVerifier(verif.KeyringPath, fetcher, logger)
+		signerPolicy, err := verif.loadSignerPolicy()
+		if err != nil {
+			return nil, err
+		}
+		verifier, err := auth.NewBuildVerifier(verif.KeyringPath, fetcher, logger)
+		if err != nil {
+			return nil, err
+		}
+		verifier.SignerPolicy = signerPolicy
+		return verifier, nil
 	case auth.VerifyEither:
 		err = castYaml(preparerConfig.ArtifactAuth, &verif)
 		if err != nil {
 			return nil, util.Errorf("error configuring artifact verification: %v", err)
 		}
-		return auth.NewCompositeVerifier(verif.KeyringPath, fetcher, logger)
+		signerPolicy, err := verif.loadSignerPolicy()
+		if err != nil {
+			return nil, err
+		}
+		verifier, err := auth.NewCompositeVerifier(verif.KeyringPath, fetcher, logger)
+		if err != nil {
+			return nil, err
+		}
+		verifier.SetSignerPolicy(signerPolicy)
+		return verifier, nil
+	case auth.VerifyEmbedded:
+		err = castYaml(preparerConfig.ArtifactAuth, &verif)
+		if err != nil {
+			return nil, util.Errorf("error configuring artifact verification: %v", err)
+		}
+		signerPolicy, err := verif.loadSignerPolicy()
+		if err != nil {
+			return nil, err
+		}
+		verifier, err := auth.NewManifestEmbeddedVerifier(verif.KeyringPath, logger)
+		if err != nil {
+			return nil, err
+		}
+		verifier.SignerPolicy = signerPolicy
+		return verifier, nil
+	case auth.VerifyChecksum:
+		return auth.NewChecksumVerifier(fetcher, logger), nil
+	case auth.VerifySigstore:
+		var sigstoreConfig SigstoreVerification
+		err = castYaml(preparerConfig.ArtifactAuth, &sigstoreConfig)
+		if err != nil {
+			return nil, util.Errorf("error configuring artifact verification: %v", err)
+		}
+		return newCosignVerifier(sigstoreConfig, fetcher, httpClient, logger)
 	default:
 		return nil, util.Errorf("Unrecognized artifact verification type: %v", t)
 	}
 }
 
+// cacheArtifactVerification wraps verifier in an auth.CachingVerifier if the
+// artifact verification config has a cache_dir.
+func cacheArtifactVerification(preparerConfig *PreparerConfig, verifier auth.ArtifactVerifier, logger *logging.Logger) (auth.ArtifactVerifier, error) {
+	var verif ManifestVerification
+	switch t, _ := preparerConfig.ArtifactAuth["type"].(string); t {
+	case "", auth.VerifyNone:
+		// Nothing to cache
+		return verifier, nil
+	}
+	err := castYaml(preparerConfig.ArtifactAuth, &verif)
+	if err != nil {
+		return nil, util.Errorf("error configuring artifact verification: %v", err)
+	}
+	if verif.CacheDirectory == "" {
+		return verifier, nil
+	}
+
+	paths := []string{verif.KeyringPath, verif.SignerPolicyPath}
+	if verif.Type == auth.VerifySigstore {
+		// so that rotating or revoking the cosign key invalidates the cache
+		var sigstoreConfig SigstoreVerification
+		err = castYaml(preparerConfig.ArtifactAuth, &sigstoreConfig)
+		if err != nil {
+			return nil, util.Errorf("error configuring artifact verification: %v", err)
+		}
+		paths = append(paths, sigstoreConfig.PublicKeyPath, sigstoreConfig.RekorPublicKeyPath)
+	}
+	var configPaths []string
+	for _, path := range paths {
+		if path != "" {
+			configPaths = append(configPaths, path)
+		}
+	}
+	return auth.NewCachingVerifier(verifier, verif.CacheDirectory, configPaths, logger)
+}
+
+func newCosignVerifier(config SigstoreVerification, fetcher uri.Fetcher, httpClient *http.Client, logger *logging.Logger) (*auth.CosignVerifier, error) {
+	if config.PublicKeyPath == "" {
+		return nil, util.Errorf("sigstore artifact verification must contain a path to the public key")
+	}
+	verifier, err := auth.NewCosignVerifier(config.PublicKeyPath, fetcher, logger)
+	if err != nil {
+		return nil, err
+	}
+	if config.RekorURL == "" {
+		return verifier, nil
+	}
+
+	rekorURL, err := url.Parse(config.RekorURL)
+	if err != nil {
+		return nil, util.Errorf("Could not parse 'rekor_url': %s", err)
+	}
+	if config.RekorPublicKeyPath == "" {
+		return nil, util.Errorf("sigstore artifact verification with a rekor_url must contain a path to the rekor public key")
+	}
+	rekorKeys, err := auth.LoadPublicKeys(config.RekorPublicKeyPath)
+	if err != nil {
+		return nil, util.Errorf("Could not load the rekor public key: %s", err)
+	}
+	verifier.Rekor = &auth.RekorLog{
+		URL:       rekorURL,
+		PublicKey: rekorKeys[0],
+		Client:    httpClient,
+	}
+	return verifier, nil
+}
+
+// artifactFetcher returns a fetcher for every scheme in
+// launch.SupportedArtifactSchemes. basic fetches the schemes that need no
+// credentials, while "s3" and "az" URIs can only be fetched when the preparer
+// is configured with credentials for them.
+func (c *PreparerConfig) artifactFetcher(basic uri.BasicFetcher) (uri.Fetcher, error) {
+	router := uri.NewMultiSchemeRouter()
+	for _, scheme := range []string{"", "file", "http", "https", "data"} {
+		router.Register(scheme, basic)
+	}
+	if c.S3 != nil {
+		opts := *c.S3
+		opts.Client = basic.Client
+		fetcher, err := uri.NewS3Fetcher(opts)
+		if err != nil {
+			return nil, util.Errorf("Could not configure S3 artifact downloads: %s", err)
+		}
+		router.Register("s3", fetcher)
+	}
+	if c.Azure != nil {
+		opts := *c.Azure
+		opts.Client = basic.Client
+		fetcher, err := uri.NewAzureFetcher(opts)
+		if err != nil {
+			return nil, util.Errorf("Could not configure Azure artifact downloads: %s", err)
+		}
+		router.Register("az", fetcher)
+	}
+	return router, nil
+}
+
 func getArtifactRegistry(preparerConfig *PreparerConfig) (artifact.Registry, error) {
 	httpClient, err := preparerConfig.GetClient(30 * time.Second)
 	if err != nil {
 		return nil, err
 	}
 
-	fetcher := uri.BasicFetcher{
-		Client: httpClient,
+	fetcher, err := preparerConfig.artifactFetcher(uri.BasicFetcher{Client: httpClient})
+	if err != nil {
+		return nil, err
 	}
 
 	if preparerConfig.ArtifactRegistryURL == "" {
@@ -748,7 +1065,7 @@ func (p *Preparer) BuildRealityAtLaunch() error {
 					sub.WithError(err).Errorln("Could not read manifest from path: %s", err)
 					return err
 				}
-				_, err = p.store.SetPod(consul.REALITY_TREE, p.node, diskManifest)
+				_, err = p.store.SetRealityManifest(p.node, diskManifest)
 				if err != nil {
 					sub.WithError(err).Errorln("Could not set pod in reality tree: %s", err)
 					return err
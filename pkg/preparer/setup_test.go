@@ -4,11 +4,16 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"os/user"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	. "github.com/anthonybishopric/gotcha"
 	"github.com/pborman/uuid"
@@ -168,6 +173,104 @@ func TestBuildRealityAtLaunch(t *testing.T) {
 	}
 }
 
+type countingVerifier struct {
+	calls int
+}
+
+func (v *countingVerifier) VerifyHoistArtifact(_ *os.File, _ auth.VerificationData) error {
+	v.calls++
+	return nil
+}
+
+func TestCacheArtifactVerificationWatchesSigstoreKeys(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "sigstore_cache")
+	Assert(t).IsNil(err, "should have created a temp dir")
+	defer os.RemoveAll(tempDir)
+
+	publicKeyPath := filepath.Join(tempDir, "cosign.pub")
+	rekorKeyPath := filepath.Join(tempDir, "rekor.pub")
+	artifactPath := filepath.Join(tempDir, "artifact.tar.gz")
+	for _, path := range []string{publicKeyPath, rekorKeyPath, artifactPath} {
+		err = ioutil.WriteFile(path, []byte(filepath.Base(path)), 0644)
+		Assert(t).IsNil(err, "should have written "+path)
+	}
+
+	inner := &countingVerifier{}
+	config := &PreparerConfig{
+		ArtifactAuth: map[string]interface{}{
+			"type":             auth.VerifySigstore,
+			"public_key":       publicKeyPath,
+			"rekor_public_key": rekorKeyPath,
+			"cache_dir":        filepath.Join(tempDir, "cache"),
+		},
+	}
+	verifier, err := cacheArtifactVerification(config, inner, &logging.DefaultLogger)
+	Assert(t).IsNil(err, "should have created a caching verifier")
+
+	verify := func() {
+		localCopy, err := os.Open(artifactPath)
+		Assert(t).IsNil(err, "should have opened the artifact")
+		defer localCopy.Close()
+		err = verifier.VerifyHoistArtifact(localCopy, auth.VerificationData{PodID: "myapp", ArtifactDigest: "abc123"})
+		Assert(t).IsNil(err, "should have verified the artifact")
+	}
+
+	verify()
+	verify()
+	Assert(t).AreEqual(inner.calls, 1, "expected the second verification to be cached")
+
+	for i, path := range []string{publicKeyPath, rekorKeyPath} {
+		err = ioutil.WriteFile(path, []byte("rotated"), 0644)
+		Assert(t).IsNil(err, "should have rotated "+path)
+		later := time.Now().Add(time.Duration(i+1) * time.Minute)
+		err = os.Chtimes(path, later, later)
+		Assert(t).IsNil(err, "should have touched "+path)
+
+		verify()
+		Assert(t).AreEqual(inner.calls, i+2, "expected rotating "+path+" to invalidate the cache")
+	}
+}
+
+func TestArtifactFetcherRoutesConfiguredSchemes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/artifacts/app_abc123.tar.gz" || !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte("from s3"))
+	}))
+	defer server.Close()
+
+	preparerConfig, err := UnmarshalConfig([]byte(fmt.Sprintf(`preparer:
+  node_name: foohost
+  s3:
+    region: us-west-2
+    access_key_id: key-id
+    secret_access_key: secret
+    endpoint: %s
+`, server.URL)))
+	Assert(t).IsNil(err, "should have read the config")
+	fetcher, err := preparerConfig.artifactFetcher(uri.BasicFetcher{Client: http.DefaultClient})
+	Assert(t).IsNil(err, "should have configured the fetcher")
+
+	s3URL, _ := url.Parse("s3://artifacts/app_abc123.tar.gz")
+	body, err := fetcher.Open(s3URL)
+	Assert(t).IsNil(err, "should have fetched the s3 artifact")
+	defer body.Close()
+	contents, err := ioutil.ReadAll(body)
+	Assert(t).IsNil(err, "should have read the s3 artifact")
+	Assert(t).AreEqual(string(contents), "from s3", "unexpected s3 artifact")
+
+	dataURL, _ := url.Parse("data:;base64,aW5saW5l")
+	body, err = fetcher.Open(dataURL)
+	Assert(t).IsNil(err, "should have fetched the data artifact")
+	defer body.Close()
+
+	azureURL, _ := url.Parse("az://artifacts/app_abc123.tar.gz")
+	_, err = fetcher.Open(azureURL)
+	Assert(t).IsNotNil(err, "should not have fetched from Azure without credentials")
+}
+
 type FakeSubsystemer struct {
 	tmpdir string
 }
@@ -914,7 +914,7 @@ func (rc *replicationController) updateAllocations(rcFields fields.RC, ineligibl
 func (rc *replicationController) scheduleNewNodeForTransfer(rcFields fields.RC, newNode types.NodeName, current types.PodLocations, logger logging.Logger) error {
 	logger.NoFields().Infof("Scheduling %s as part of node transfer", newNode)
 
-	key, err := consul.PodPath(consul.INTENT_TREE, newNode, rcFields.Manifest.ID())
+	key, err := consul.PodPathForManifest(consul.INTENT_TREE, newNode, rcFields.Manifest)
 	if err != nil {
 		return err
 	}
@@ -1188,8 +1188,12 @@ func (rc *replicationController) checkMissingArtifacts(rcFields fields.RC) {
 		return
 	}
 	podID := rcFields.Manifest.ID()
-	launchableStanzas := rcFields.Manifest.GetLaunchableStanzas()
-	for launchableID, launchableStanza := range launchableStanzas {
+	for _, launchableID := range rcFields.Manifest.LaunchableIDs() {
+		launchableStanza, err := rcFields.Manifest.LaunchableByID(launchableID)
+		if err != nil {
+			rc.logger.WithError(err).Errorln("Unable to read launchable")
+			continue
+		}
 		artifactUrl, _, err := rc.artifactRegistry.LocationDataForLaunchable(podID, launchableID, launchableStanza)
 		if err != nil {
 			rc.logger.WithError(err).Errorln("Unable to retrieve location for launchable")
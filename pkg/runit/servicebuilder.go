@@ -25,6 +25,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/square/p2/pkg/p2exec"
 	"github.com/square/p2/pkg/util"
@@ -40,11 +41,57 @@ const (
 	RestartPolicyAlways RestartPolicy = "always"
 	RestartPolicyNever  RestartPolicy = "never"
 
+	// Like RestartPolicyAlways, except that the service isn't restarted
+	// after it exits 0
+	RestartPolicyOnFailure RestartPolicy = "on-failure"
+
 	DefaultRestartPolicy = RestartPolicyAlways
 
 	DOWN_FILE_NAME = "down"
 )
 
+// Restarts reports whether runit should restart services with the policy when
+// they exit, rather than running them once.
+func (p RestartPolicy) Restarts() bool {
+	return p == RestartPolicyAlways || p == RestartPolicyOnFailure
+}
+
+// RestartBackoff delays the restarts of a service that keeps exiting soon
+// after it starts, so that a crash looping service doesn't hammer its
+// dependencies. Each start is delayed by Initial, doubled for every
+// consecutive restart up to Max, e.g.
+//
+//	restart_backoff:
+//	  initial: 1s
+//	  max: 5m
+//
+// The delay goes back to Initial once the service stays up for ResetAfter,
+// and whenever the service is activated again.
+type RestartBackoff struct {
+	Initial time.Duration `yaml:"initial"`
+	Max     time.Duration `yaml:"max"`
+
+	// Defaults to Max
+	ResetAfter time.Duration `yaml:"reset_after,omitempty"`
+}
+
+// The run script of a service with a RestartBackoff records its restarts in
+// this file of the service directory
+const restartBackoffFileName = "restart_backoff"
+
+// sleepScript returns ruby that sleeps for the backoff's delay.
+func (b RestartBackoff) sleepScript() string {
+	resetAfter := b.ResetAfter
+	if resetAfter <= 0 {
+		resetAfter = b.Max
+	}
+	return fmt.Sprintf(`restarts, started = (File.read('%s').split.map { |n| n.to_f } rescue [])
+restarts = (started && Time.now.to_f - started < %g) ? restarts.to_i + 1 : 0
+sleep [%g * 2 ** restarts, %g].min
+File.open('%s', 'w') { |f| f.write("#{restarts} #{Time.now.to_f}") }`,
+		restartBackoffFileName, resetAfter.Seconds(), b.Initial.Seconds(), b.Max.Seconds(), restartBackoffFileName)
+}
+
 // To maintain compatibility with Ruby1.8's YAML serializer, a document separator with a
 // trailing space must be used.
 const yamlSeparator = "--- "
@@ -71,6 +118,15 @@ type ServiceTemplate struct {
 	// TODO: write this to the servicebuilder file and use it to determine
 	// how the service should be started
 	RestartPolicy RestartPolicy `yaml:"-"`
+
+	// If set, replaces the fixed sleep before each start. Like the restart
+	// policy, this determines how the stage directory is written
+	RestartBackoff *RestartBackoff `yaml:"-"`
+
+	// Addresses that the supervisor listens on and passes to the service
+	// when it starts, e.g. "8080" or "/run/app.sock". Runit can't do this,
+	// so only a Builder that supports socket activation accepts them
+	Sockets []string `yaml:"-"`
 }
 
 func (s ServiceTemplate) runScript() ([]byte, error) {
@@ -88,17 +144,21 @@ func (s ServiceTemplate) runScript() ([]byte, error) {
 	if s.Sleep != nil && *s.Sleep >= 0 {
 		sleep = *s.Sleep
 	}
+	sleepScript := fmt.Sprintf("sleep %d", sleep)
+	if s.RestartBackoff != nil {
+		sleepScript = s.RestartBackoff.sleepScript()
+	}
 
 	ret := fmt.Sprintf(`#!/usr/bin/ruby
 $stderr.reopen(STDOUT)
 require 'yaml'
-sleep %d
+%s
 exec *YAML.load(DATA.read)
 sleep 2
 __END__
 %s
 %s
-`, sleep, yamlSeparator, args)
+`, sleepScript, yamlSeparator, args)
 	return []byte(ret), nil
 }
 
@@ -141,10 +201,37 @@ func (s ServiceTemplate) finishScript() ([]byte, error) {
 	finishScript := fmt.Sprintf(`#!/bin/bash
 %s
 `, strings.Join(finish_exec, " "))
+	if s.RestartPolicy == RestartPolicyOnFailure {
+		// runit passes the exit code, or -1 if the service was killed by
+		// a signal. Asking runsv to keep the service down while it runs
+		// the finish script keeps it from being restarted
+		finishScript += `if [ "$1" = 0 ]; then
+  printf d > supervise/control
+fi
+`
+	}
 
 	return []byte(finishScript), nil
 }
 
+// Builder installs the services that a process supervisor runs, in named
+// groups such as the services of a pod. ServiceBuilder installs them for
+// runit; the services are then controlled with an SV for the same supervisor.
+type Builder interface {
+	// Activate installs the services of the group, replacing its previous
+	// services. Services that are no longer in any group are only removed
+	// by Prune
+	Activate(name string, templates map[string]ServiceTemplate) error
+	// Deactivate removes every service from the group
+	Deactivate(name string) error
+	// Prune removes the services that aren't in any group
+	Prune() error
+	// ServicePath returns the Path of the Service with the given name
+	ServicePath(serviceName string) string
+}
+
+var _ Builder = &ServiceBuilder{}
+
 type ServiceBuilder struct {
 	ConfigRoot  string // directory to generate YAML files
 	StagingRoot string // directory to place staged runit services
@@ -205,6 +292,10 @@ func (s *ServiceBuilder) stage(templates map[string]ServiceTemplate) error {
 	}
 
 	for serviceName, template := range templates {
+		if len(template.Sockets) > 0 {
+			return util.Errorf("%s: runit does not support socket activation", serviceName)
+		}
+
 		stageDir := filepath.Join(s.StagingRoot, serviceName)
 		// create the default log directory
 		logDir := filepath.Join(stageDir, "log")
@@ -234,6 +325,11 @@ func (s *ServiceBuilder) stage(templates map[string]ServiceTemplate) error {
 		if _, err := util.WriteIfChanged(filepath.Join(stageDir, "run"), runScript, 0755); err != nil {
 			return err
 		}
+		// Activating the service again starts its backoff over
+		err = os.Remove(filepath.Join(stageDir, restartBackoffFileName))
+		if err != nil && !os.IsNotExist(err) {
+			return util.Errorf("Unable to remove restart backoff file: %s", err)
+		}
 
 		logScript, err := template.logScript()
 		if err != nil {
@@ -253,9 +349,9 @@ func (s *ServiceBuilder) stage(templates map[string]ServiceTemplate) error {
 
 		// If a "down" file is not present, runit will restart the process
 		// whenever it finishes. Prevent that if the requested restart policy
-		// is not RestartAlways
+		// doesn't restart the process
 		downPath := filepath.Join(stageDir, DOWN_FILE_NAME)
-		if template.RestartPolicy != RestartPolicyAlways {
+		if !template.RestartPolicy.Restarts() {
 			file, err := os.Create(downPath)
 			if err != nil {
 				return err
@@ -326,6 +422,21 @@ func (s *ServiceBuilder) Activate(name string, templates map[string]ServiceTempl
 	return s.activate(templates)
 }
 
+// Deactivate removes the servicebuilder yaml file of the group, so that its
+// services are removed by the next Prune
+func (s *ServiceBuilder) Deactivate(name string) error {
+	err := os.Remove(filepath.Join(s.ConfigRoot, name+".yaml"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// ServicePath returns the directory that runsvdir supervises the service in
+func (s *ServiceBuilder) ServicePath(serviceName string) string {
+	return filepath.Join(s.RunitRoot, serviceName)
+}
+
 // using the servicebuilder yaml files, find any extraneous runit services and
 // remove them
 // runsvdir automatically stops services that no longer exist, explicit stop is
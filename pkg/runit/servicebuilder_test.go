@@ -8,6 +8,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	. "github.com/anthonybishopric/gotcha"
 	"gopkg.in/yaml.v2"
@@ -122,6 +123,50 @@ func TestDownFile(t *testing.T) {
 	Assert(t).IsTrue(os.IsNotExist(err), "down file should not have existed when restart policy is 'always'")
 }
 
+func TestOnFailureRestartPolicy(t *testing.T) {
+	sb := FakeServiceBuilder()
+	defer sb.Cleanup()
+
+	err := sb.stage(fakeTemplate(RestartPolicyOnFailure))
+	Assert(t).IsNil(err, "should have staged")
+
+	// runit should restart the process, except after a clean exit
+	_, err = os.Stat(filepath.Join(sb.StagingRoot, "foo", "down"))
+	Assert(t).IsTrue(os.IsNotExist(err), "down file should not have existed when restart policy is 'on-failure'")
+	finish, err := ioutil.ReadFile(filepath.Join(sb.StagingRoot, "foo", "finish"))
+	Assert(t).IsNil(err, "should have read finish script")
+	Assert(t).IsTrue(strings.Contains(string(finish), "printf d > supervise/control"), "finish script should have kept the service down after a clean exit")
+}
+
+func TestRestartBackoff(t *testing.T) {
+	sb := FakeServiceBuilder()
+	defer sb.Cleanup()
+
+	templates := fakeTemplate(RestartPolicyAlways)
+	template := templates["foo"]
+	template.RestartBackoff = &RestartBackoff{Initial: 500 * time.Millisecond, Max: 5 * time.Minute}
+	templates["foo"] = template
+
+	backoffPath := filepath.Join(sb.StagingRoot, "foo", restartBackoffFileName)
+	err := os.MkdirAll(filepath.Dir(backoffPath), 0755)
+	Assert(t).IsNil(err, "should have created staging dir")
+	err = ioutil.WriteFile(backoffPath, []byte("5 1500000000"), 0644)
+	Assert(t).IsNil(err, "should have written restart backoff file")
+
+	err = sb.stage(templates)
+	Assert(t).IsNil(err, "should have staged")
+
+	run, err := ioutil.ReadFile(filepath.Join(sb.StagingRoot, "foo", "run"))
+	Assert(t).IsNil(err, "should have read run script")
+	Assert(t).IsTrue(strings.Contains(string(run), "Time.now.to_f - started < 300)"), "run script should have reset the backoff after max by default")
+	Assert(t).IsTrue(strings.Contains(string(run), "sleep [0.5 * 2 ** restarts, 300].min"), "run script should have backed off exponentially")
+	Assert(t).IsFalse(strings.Contains(string(run), "sleep 2\nexec"), "run script should not have slept for the fixed time")
+
+	_, err = os.Stat(backoffPath)
+	Assert(t).IsTrue(os.IsNotExist(err), "staging should have reset the backoff")
+	verifyRuby18(t, filepath.Join(sb.StagingRoot, "foo", "run"), "run script")
+}
+
 func verifyRuby18(t *testing.T, filename, displayName string) {
 	binData, err := ioutil.ReadFile(filename)
 	Assert(t).IsNil(err, fmt.Sprintf("should have been able to read %s", displayName))
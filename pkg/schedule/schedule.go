@@ -10,4 +10,7 @@ import (
 type Output struct {
 	PodID        types.PodID        `json:"pod_id"`
 	PodUniqueKey types.PodUniqueKey `json:"pod_unique_key"`
+	// True if the manifest was already scheduled, so nothing was written.
+	// Only set when p2-schedule is run with --idempotent
+	Unchanged bool `json:"unchanged,omitempty"`
 }
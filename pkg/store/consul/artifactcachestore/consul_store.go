@@ -0,0 +1,78 @@
+package artifactcachestore
+
+import (
+	"path"
+	"strings"
+
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/types"
+
+	"github.com/hashicorp/consul/api"
+)
+
+const artifactCacheTree string = "artifact_cache"
+
+// A Peer is a node with a copy of an artifact, and the URL it is served from.
+type Peer struct {
+	Node types.NodeName
+	URL  string
+}
+
+type consulKV interface {
+	List(prefix string, opts *api.QueryOptions) (api.KVPairs, *api.QueryMeta, error)
+	Put(pair *api.KVPair, opts *api.WriteOptions) (*api.WriteMeta, error)
+	Delete(key string, opts *api.WriteOptions) (*api.WriteMeta, error)
+}
+
+// ConsulStore records which nodes have a copy of each artifact in the
+// artifact_cache tree: artifact_cache/<digest>/<node> holds the URL the node
+// serves the artifact with that hex-encoded SHA-256 digest from.
+type ConsulStore struct {
+	kv consulKV
+}
+
+func NewConsul(kv consulKV) ConsulStore {
+	return ConsulStore{kv: kv}
+}
+
+func artifactPath(digest string) string {
+	return path.Join(artifactCacheTree, strings.ToLower(digest))
+}
+
+// Advertise records that node serves the artifact with digest from url.
+func (s ConsulStore) Advertise(digest string, node types.NodeName, url string) error {
+	key := path.Join(artifactPath(digest), node.String())
+	_, err := s.kv.Put(&api.KVPair{Key: key, Value: []byte(url)}, nil)
+	if err != nil {
+		return consulutil.NewKVError("put", key, err)
+	}
+	return nil
+}
+
+// Withdraw removes node's advertisement of the artifact with digest, e.g.
+// once it has been evicted from the node's cache.
+func (s ConsulStore) Withdraw(digest string, node types.NodeName) error {
+	key := path.Join(artifactPath(digest), node.String())
+	_, err := s.kv.Delete(key, nil)
+	if err != nil {
+		return consulutil.NewKVError("delete", key, err)
+	}
+	return nil
+}
+
+// Peers returns every node that has advertised the artifact with digest.
+func (s ConsulStore) Peers(digest string) ([]Peer, error) {
+	prefix := artifactPath(digest) + "/"
+	pairs, _, err := s.kv.List(prefix, nil)
+	if err != nil {
+		return nil, consulutil.NewKVError("list", prefix, err)
+	}
+	peers := make([]Peer, 0, len(pairs))
+	for _, pair := range pairs {
+		peers = append(peers, Peer{
+			Node: types.NodeName(strings.TrimPrefix(pair.Key, prefix)),
+			URL:  string(pair.Value),
+		})
+	}
+	return peers, nil
+}
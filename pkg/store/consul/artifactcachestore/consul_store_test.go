@@ -0,0 +1,44 @@
+package artifactcachestore
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/square/p2/pkg/store/consul/consulutil"
+)
+
+func TestAdvertiseAndWithdraw(t *testing.T) {
+	f := consulutil.NewFixture(t)
+	defer f.Stop()
+	store := NewConsul(f.Client.KV())
+	digest := strings.Repeat("ab", 32)
+
+	err := store.Advertise(digest, "node1", "http://node1:4141/artifacts/"+digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Advertise(strings.Repeat("cd", 32), "node2", "http://node2:4141/artifacts/other")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	peers, err := store.Peers(strings.ToUpper(digest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 1 || peers[0].Node != "node1" || peers[0].URL != "http://node1:4141/artifacts/"+digest {
+		t.Errorf("expected only node1 to have the artifact, got %+v", peers)
+	}
+
+	err = store.Withdraw(digest, "node1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	peers, err = store.Peers(digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 0 {
+		t.Errorf("expected no peers once node1 withdrew, got %+v", peers)
+	}
+}
@@ -0,0 +1,120 @@
+package consul
+
+import (
+	"context"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/square/p2/pkg/audit"
+	"github.com/square/p2/pkg/store/consul/transaction"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// BulkDeleteResult reports which keys BulkDelete removed. Every key passed to
+// BulkDelete is in exactly one of the two lists.
+type BulkDeleteResult struct {
+	Deleted []string
+	Failed  []string
+}
+
+// BulkDelete deletes every key in paths, e.g. all of the pods on a
+// decommissioned node, using as few consul transactions as possible. As with
+// DeletePod(), a pod in the intent tree is deleted along with its scheduling
+// metadata (and its audit log, if the store audits the intent tree) in the
+// same transaction. A failed transaction doesn't stop later
+// ones from being attempted, and the returned error is non-nil if any
+// transaction failed. Keys that don't exist are considered deleted.
+func (c consulStore) BulkDelete(paths []string) (_ BulkDeleteResult, _ time.Duration, err error) {
+	defer c.emit("BulkDelete", "", time.Now(), &err)
+
+	return c.bulkDelete(c.client.KV(), paths)
+}
+
+func (c consulStore) bulkDelete(txner transaction.Txner, paths []string) (BulkDeleteResult, time.Duration, error) {
+	start := time.Now()
+	var result BulkDeleteResult
+	var errs []error
+	for len(paths) > 0 {
+		// a path's operations are never split across transactions
+		batchSize, ops := 0, 0
+		for batchSize < len(paths) && ops+c.bulkDeleteOps(paths[batchSize]) <= transaction.MaxOperations {
+			ops += c.bulkDeleteOps(paths[batchSize])
+			batchSize++
+		}
+		batch := paths[:batchSize]
+		paths = paths[batchSize:]
+
+		err := c.deleteKeysTxn(txner, batch)
+		if err != nil {
+			result.Failed = append(result.Failed, batch...)
+			errs = append(errs, err)
+			continue
+		}
+		result.Deleted = append(result.Deleted, batch...)
+	}
+
+	if len(errs) > 0 {
+		return result, time.Since(start), util.Errorf("Could not delete %d of %d keys: %s", len(result.Failed), len(result.Failed)+len(result.Deleted), errs[0])
+	}
+	return result, time.Since(start), nil
+}
+
+// intentPodFromPath returns the node and pod of a key in the intent tree, or
+// false if key is not a pod in the intent tree.
+func intentPodFromPath(key string) (types.NodeName, types.PodID, bool) {
+	parts := strings.Split(key, "/")
+	if len(parts) != 3 || parts[0] != INTENT_TREE.String() {
+		return "", "", false
+	}
+	return types.NodeName(parts[1]), types.PodID(parts[2]), true
+}
+
+// bulkDeleteOps returns how many transaction operations deleting key takes:
+// one, plus one for the scheduling metadata of a pod in the intent tree and
+// one for its audit log.
+func (c consulStore) bulkDeleteOps(key string) int {
+	if _, _, ok := intentPodFromPath(key); !ok {
+		return 1
+	}
+	if c.auditsIntent(INTENT_TREE) {
+		return 3
+	}
+	return 2
+}
+
+func (c consulStore) deleteKeysTxn(txner transaction.Txner, keys []string) error {
+	ctx, cancel := transaction.New(context.Background())
+	defer cancel()
+	for _, key := range keys {
+		deleted := []string{key}
+		node, podID, isIntent := intentPodFromPath(key)
+		if isIntent {
+			deleted = append(deleted, path.Join(SCHEDULING_METADATA_TREE, key))
+		}
+		for _, deletedKey := range deleted {
+			err := transaction.Add(ctx, api.KVTxnOp{
+				Verb: string(api.KVDelete),
+				Key:  deletedKey,
+			})
+			if err != nil {
+				return util.Errorf("Could not add deletion of %s to transaction: %s", deletedKey, err)
+			}
+		}
+		if isIntent && c.auditsIntent(INTENT_TREE) {
+			err := c.auditPodTxn(ctx, audit.PodUnscheduledEvent, node, podID, "")
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err := transaction.MustCommit(ctx, txner)
+	if err != nil {
+		return util.Errorf("Could not delete %s through %s: %s", keys[0], keys[len(keys)-1], err)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+// +build !race
+
+package consul
+
+import (
+	"fmt"
+	"path"
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+)
+
+func putTestKeys(t *testing.T, f *ConsulTestFixture, tree PodPrefix, n int) []string {
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("%s/node/pod%d", tree, i)
+		_, err := f.Client.KV().Put(&api.KVPair{Key: keys[i], Value: []byte("manifest")}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return keys
+}
+
+func TestBulkDeleteSplitsTransactions(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+
+	keys := putTestKeys(t, f, REALITY_TREE, 70)
+
+	txner := &countingTxner{txner: f.Client.KV(), failOn: -1}
+	result, _, err := f.Store.bulkDelete(txner, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txner.count != 2 {
+		t.Errorf("expected 70 keys to take 2 transactions (64 + 6), took %d", txner.count)
+	}
+	if len(result.Deleted) != 70 || len(result.Failed) != 0 {
+		t.Errorf("expected all 70 keys to be deleted, got %d deleted and %d failed", len(result.Deleted), len(result.Failed))
+	}
+	for _, key := range keys {
+		kvp, _, err := f.Client.KV().Get(key, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if kvp != nil {
+			t.Errorf("expected %s to be deleted", key)
+		}
+	}
+}
+
+func TestBulkDeleteReportsFailedBatch(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+
+	keys := putTestKeys(t, f, REALITY_TREE, 70)
+
+	// fail the second transaction, holding the last 6 keys
+	txner := &countingTxner{txner: f.Client.KV(), failOn: 1}
+	result, _, err := f.Store.bulkDelete(txner, keys)
+	if err == nil {
+		t.Fatal("expected the failed transaction to return an error")
+	}
+	if len(result.Deleted) != 64 || len(result.Failed) != 6 {
+		t.Fatalf("expected 64 keys deleted and 6 failed, got %d and %d", len(result.Deleted), len(result.Failed))
+	}
+	for _, key := range result.Failed {
+		kvp, _, err := f.Client.KV().Get(key, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if kvp == nil {
+			t.Errorf("expected %s to remain after its transaction failed", key)
+		}
+	}
+}
+
+func TestBulkDeleteRemovesIntentSchedulingMetadata(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+
+	keys := putTestKeys(t, f, INTENT_TREE, 40)
+	for _, key := range keys {
+		pair := &api.KVPair{Key: path.Join(SCHEDULING_METADATA_TREE, key), Value: []byte("{}")}
+		if _, err := f.Client.KV().Put(pair, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	txner := &countingTxner{txner: f.Client.KV(), failOn: -1}
+	result, _, err := f.Store.bulkDelete(txner, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txner.count != 2 {
+		t.Errorf("expected 40 pods and their metadata to take 2 transactions (32 + 8 pods), took %d", txner.count)
+	}
+	if len(result.Deleted) != 40 || len(result.Failed) != 0 {
+		t.Errorf("expected all 40 keys to be deleted, got %d deleted and %d failed", len(result.Deleted), len(result.Failed))
+	}
+	for _, key := range keys {
+		for _, deleted := range []string{key, path.Join(SCHEDULING_METADATA_TREE, key)} {
+			kvp, _, err := f.Client.KV().Get(deleted, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if kvp != nil {
+				t.Errorf("expected %s to be deleted", deleted)
+			}
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package consul
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// PodManifestMismatch is returned by CompareAndSetPod when the pod's current
+// manifest is not the expected one.
+var PodManifestMismatch error = errors.New("The current pod manifest is not the expected one")
+
+// CompareAndSetPod replaces a pod's manifest with next, but only if the
+// manifest currently stored has the same SHA as expected. A nil expected
+// means the pod must not be scheduled yet. This lets callers do a
+// read-modify-write of a pod without handling consul modify indexes
+// themselves: if the pod is written by someone else in between,
+// PodManifestMismatch is returned and nothing is written.
+func (c consulStore) CompareAndSetPod(podPrefix PodPrefix, nodename types.NodeName, expected manifest.Manifest, next manifest.Manifest) (_ time.Duration, err error) {
+	defer c.emit("CompareAndSetPod", eventPath(PodPathForManifest(podPrefix, nodename, next)), time.Now(), &err)
+
+	if expected != nil && expected.ID() != next.ID() {
+		return 0, util.Errorf("Cannot replace pod %s with pod %s", expected.ID(), next.ID())
+	}
+	key, err := PodPathForManifest(podPrefix, nodename, next)
+	if err != nil {
+		return 0, err
+	}
+
+	kvPair, queryMeta, err := c.client.KV().Get(key, nil)
+	if err != nil {
+		return 0, consulutil.NewKVError("get", key, err)
+	}
+	retDur := queryMeta.RequestTime
+
+	// An index of zero makes the CAS succeed only if the key doesn't exist
+	var modifyIndex uint64
+	switch {
+	case kvPair == nil && expected != nil:
+		return retDur, PodManifestMismatch
+	case kvPair != nil && expected == nil:
+		return retDur, PodManifestMismatch
+	case kvPair != nil:
+		current, err := manifest.FromBytes(kvPair.Value)
+		if err != nil {
+			return retDur, util.Errorf("Could not parse the current manifest at %s: %s", key, err)
+		}
+		match, err := sameSHA(current, expected)
+		if err != nil {
+			return retDur, err
+		}
+		if !match {
+			return retDur, PodManifestMismatch
+		}
+		modifyIndex = kvPair.ModifyIndex
+	}
+
+	buf := bytes.Buffer{}
+	err = next.Write(&buf)
+	if err != nil {
+		return retDur, err
+	}
+	var nextSHA string
+	if c.auditsIntent(podPrefix) {
+		nextSHA, err = next.SHA()
+		if err != nil {
+			return retDur, util.Errorf("Could not compute the SHA of %s: %s", next.ID(), err)
+		}
+	}
+
+	ok, writeDur, err := c.casPod(podPrefix, nodename, next.ID(), buf.Bytes(), modifyIndex, nextSHA)
+	retDur += writeDur
+	if err != nil {
+		return retDur, err
+	}
+	if !ok {
+		// written by someone else between the read and the CAS
+		return retDur, PodManifestMismatch
+	}
+	return retDur, nil
+}
+
+func sameSHA(a manifest.Manifest, b manifest.Manifest) (bool, error) {
+	aSHA, err := a.SHA()
+	if err != nil {
+		return false, util.Errorf("Could not compute the SHA of %s: %s", a.ID(), err)
+	}
+	bSHA, err := b.SHA()
+	if err != nil {
+		return false, util.Errorf("Could not compute the SHA of %s: %s", b.ID(), err)
+	}
+	return aSHA == bSHA, nil
+}
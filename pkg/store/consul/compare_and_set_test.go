@@ -0,0 +1,82 @@
+// +build !race
+
+package consul
+
+import (
+	"testing"
+
+	"github.com/square/p2/pkg/manifest"
+)
+
+func casTestManifest(runAs string) manifest.Manifest {
+	builder := manifest.NewBuilder()
+	builder.SetID("foo")
+	builder.SetRunAsUser(runAs)
+	return builder.GetManifest()
+}
+
+func TestCompareAndSetPod(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+
+	// Creating the pod requires that it doesn't exist yet
+	_, err := f.Store.CompareAndSetPod(INTENT_TREE, "node1", nil, casTestManifest("v1"))
+	if err != nil {
+		t.Fatalf("Unexpected error creating pod: %s", err)
+	}
+
+	current, _, err := f.Store.Pod(INTENT_TREE, "node1", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Store.CompareAndSetPod(INTENT_TREE, "node1", current, casTestManifest("v2"))
+	if err != nil {
+		t.Fatalf("Unexpected error replacing pod: %s", err)
+	}
+
+	updated, _, err := f.Store.Pod(INTENT_TREE, "node1", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.RunAsUser() != "v2" {
+		t.Errorf("Expected the pod to be replaced with v2, found %s", updated.RunAsUser())
+	}
+
+	_, err = f.Store.CompareAndSetPod(INTENT_TREE, "node1", nil, casTestManifest("v3"))
+	if err != PodManifestMismatch {
+		t.Errorf("Expected PodManifestMismatch creating a pod that exists, got %v", err)
+	}
+}
+
+func TestCompareAndSetPodInterleavedWrite(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+
+	_, err := f.Store.SetPod(INTENT_TREE, "node1", casTestManifest("v1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, _, err := f.Store.Pod(INTENT_TREE, "node1", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Someone else writes the pod after it was read
+	_, err = f.Store.SetPod(INTENT_TREE, "node1", casTestManifest("other"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = f.Store.CompareAndSetPod(INTENT_TREE, "node1", read, casTestManifest("v2"))
+	if err != PodManifestMismatch {
+		t.Fatalf("Expected PodManifestMismatch after an interleaved write, got %v", err)
+	}
+
+	current, _, err := f.Store.Pod(INTENT_TREE, "node1", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.RunAsUser() != "other" {
+		t.Errorf("Expected the interleaved write to be kept, found %s", current.RunAsUser())
+	}
+}
@@ -2,47 +2,130 @@ package consul
 
 import (
 	"net/http"
+	"os"
+	"strconv"
 	"time"
 
 	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/util"
+	netutil "github.com/square/p2/pkg/util/net"
 
 	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/go-cleanhttp"
 )
 
+// Options configure the consul client. Address, HTTPS, Token and the TLS files
+// default to the environment variables used by the consul CLI, see
+// DefaultOptions().
 type Options struct {
 	// The hostname and port of Consul (eg "example.com:8500"), or a unix socket
 	// (eg "unix:///var/run/consul.sock"). The empty string defaults to
-	// "127.0.0.1:8500".
+	// $CONSUL_HTTP_ADDR, or "127.0.0.1:8500" if that is unset.
 	Address string
 	// Set to true to use HTTPS.
 	HTTPS bool
 	// The ACL token to pass to Consul.
 	Token string
+	// Files containing the x509 PEM-encoded CA, client certificate and
+	// client private key to use with HTTPS. The CA defaults to the system
+	// bundle. Ignored if Client is set.
+	CAFile   string
+	CertFile string
+	KeyFile  string
 	// If non-nil, this http.Client will be used for Consul communication.
 	Client *http.Client
 	// If provided, the wait time to be used on queries from this client.
 	// See the "wait" parameter:
 	// https://consul.io/intro/getting-started/kv.html
 	WaitTime time.Duration
+	// If non-nil, a store created with NewConsulStoreWithOptions calls this
+	// after each operation, e.g. to export latency metrics.
+	ObserveLatency LatencyObserver
+	// If non-zero, a store created with NewConsulStoreWithOptions pings
+	// consul at this interval in the background and reports the result
+	// from Healthy().
+	HealthCheckInterval time.Duration
+	// If AuditUser is set, a store created with NewConsulStoreWithOptions
+	// records an audit log of every change it makes to the intent tree,
+	// attributed to AuditUser on AuditHostname (by default, this host). Every
+	// command that writes intent should set it. See AuditIntent().
+	AuditUser     string
+	AuditHostname string
+}
+
+// LatencyObserver receives the name of a store method, e.g. "SetPod", how long
+// the call took and the error it returned (nil on success).
+type LatencyObserver func(method string, duration time.Duration, err error)
+
+// DefaultOptions returns opts with every unset field that has a consul CLI
+// environment variable set from it: CONSUL_HTTP_ADDR, CONSUL_HTTP_SSL,
+// CONSUL_HTTP_TOKEN, CONSUL_CACERT, CONSUL_CLIENT_CERT and CONSUL_CLIENT_KEY.
+func DefaultOptions(opts Options) Options {
+	setFromEnv := func(field *string, envar string) {
+		if *field == "" {
+			*field = os.Getenv(envar)
+		}
+	}
+	setFromEnv(&opts.Address, "CONSUL_HTTP_ADDR")
+	setFromEnv(&opts.Token, "CONSUL_HTTP_TOKEN")
+	setFromEnv(&opts.CAFile, "CONSUL_CACERT")
+	setFromEnv(&opts.CertFile, "CONSUL_CLIENT_CERT")
+	setFromEnv(&opts.KeyFile, "CONSUL_CLIENT_KEY")
+	if !opts.HTTPS {
+		opts.HTTPS, _ = strconv.ParseBool(os.Getenv("CONSUL_HTTP_SSL"))
+	}
+	return opts
 }
 
 func NewConsulClient(opts Options) consulutil.ConsulClient {
+	return consulutil.ConsulClientFromRaw(NewAPIClient(opts))
+}
+
+// NewAPIClient returns an unwrapped consul client, for the endpoints that
+// consulutil.ConsulClient does not expose (e.g. prepared queries). If the TLS
+// files can't be loaded, every request made by the client fails with the
+// error.
+func NewAPIClient(opts Options) *api.Client {
+	opts = DefaultOptions(opts)
 	conf := api.DefaultConfig()
 	if opts.Address != "" {
 		conf.Address = opts.Address
 	}
 	if opts.Client != nil {
 		conf.HttpClient = opts.Client
+	} else if opts.CAFile != "" || opts.CertFile != "" || opts.KeyFile != "" {
+		conf.HttpClient = tlsClient(opts)
 	}
 	if opts.HTTPS {
 		conf.Scheme = "https"
 	}
-	conf.Token = opts.Token
+	if opts.Token != "" {
+		conf.Token = opts.Token
+	}
 	if opts.WaitTime != 0 {
 		conf.WaitTime = opts.WaitTime
 	}
 
 	// error is always nil
 	client, _ := api.NewClient(conf)
-	return consulutil.ConsulClientFromRaw(client)
+	return client
+}
+
+func tlsClient(opts Options) *http.Client {
+	tlsConfig, err := netutil.GetTLSConfig(opts.CertFile, opts.KeyFile, opts.CAFile)
+	if err != nil {
+		return &http.Client{Transport: errTransport{util.Errorf("Could not load the consul TLS configuration: %s", err)}}
+	}
+	transport := cleanhttp.DefaultPooledTransport()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: transport}
+}
+
+// errTransport fails every request with err
+type errTransport struct {
+	err error
+}
+
+func (t errTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, t.err
 }
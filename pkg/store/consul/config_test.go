@@ -0,0 +1,44 @@
+package consul
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDefaultOptionsFromEnvironment(t *testing.T) {
+	env := map[string]string{
+		"CONSUL_HTTP_ADDR":  "consul.example.com:8501",
+		"CONSUL_HTTP_TOKEN": "env-token",
+		"CONSUL_HTTP_SSL":   "true",
+		"CONSUL_CACERT":     "/etc/consul/ca.pem",
+	}
+	for name, value := range env {
+		old, wasSet := os.LookupEnv(name)
+		os.Setenv(name, value)
+		if wasSet {
+			defer os.Setenv(name, old)
+		} else {
+			defer os.Unsetenv(name)
+		}
+	}
+
+	opts := DefaultOptions(Options{Token: "flag-token"})
+	if opts.Address != "consul.example.com:8501" || !opts.HTTPS || opts.CAFile != "/etc/consul/ca.pem" {
+		t.Errorf("expected the address, HTTPS and CA file from the environment, got %+v", opts)
+	}
+	if opts.Token != "flag-token" {
+		t.Errorf("expected an explicit token to take precedence over CONSUL_HTTP_TOKEN, got %q", opts.Token)
+	}
+	if opts = DefaultOptions(Options{}); opts.Token != "env-token" {
+		t.Errorf("expected the token from CONSUL_HTTP_TOKEN, got %q", opts.Token)
+	}
+}
+
+func TestNewAPIClientWithInvalidTLSFiles(t *testing.T) {
+	client := NewAPIClient(Options{CAFile: "/no/such/ca.pem"})
+	_, _, err := client.KV().Get("foo", nil)
+	if err == nil || !strings.Contains(err.Error(), "TLS configuration") {
+		t.Errorf("expected requests to fail with the TLS error, got %v", err)
+	}
+}
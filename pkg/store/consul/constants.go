@@ -3,6 +3,7 @@ package consul
 import (
 	"path"
 
+	"github.com/square/p2/pkg/manifest"
 	"github.com/square/p2/pkg/types"
 	"github.com/square/p2/pkg/util"
 )
@@ -18,6 +19,13 @@ const (
 	REALITY_TREE PodPrefix = "reality"
 	HOOK_TREE    PodPrefix = "hooks"
 	LOCK_TREE              = "lock"
+
+	// Pods staged here are installed by the preparer but not launched, so
+	// that scheduling them in the intent tree later launches them quickly
+	PREFETCH_TREE PodPrefix = "prefetch"
+
+	SCHEDULING_METADATA_TREE = "scheduling_metadata"
+	NODE_CAPACITY_TREE       = "node_capacity"
 )
 
 func nodePath(podPrefix PodPrefix, nodeName types.NodeName) (string, error) {
@@ -36,6 +44,8 @@ func nodePath(podPrefix PodPrefix, nodeName types.NodeName) (string, error) {
 	return path.Join(string(podPrefix), nodeName.String()), nil
 }
 
+// PodPath returns the path of a legacy pod, e.g. intent/some_host/some_pod.
+// Prefer PodPathForManifest when the manifest is available.
 func PodPath(podPrefix PodPrefix, nodeName types.NodeName, podId types.PodID) (string, error) {
 	nodePath, err := nodePath(podPrefix, nodeName)
 	if err != nil {
@@ -49,6 +59,12 @@ func PodPath(podPrefix PodPrefix, nodeName types.NodeName, podId types.PodID) (s
 	return path.Join(nodePath, string(podId)), nil
 }
 
+// PodPathForManifest returns the path the manifest is written to on the given
+// node, e.g. intent/some_host/some_pod.
+func PodPathForManifest(podPrefix PodPrefix, nodeName types.NodeName, manifest manifest.Manifest) (string, error) {
+	return PodPath(podPrefix, nodeName, manifest.ID())
+}
+
 // Returns the consul path to use when intending to lock a pod, e.g.
 // lock/intent/some_host/some_pod
 func PodLockPath(podPrefix PodPrefix, nodeName types.NodeName, podId types.PodID) (string, error) {
@@ -3,6 +3,8 @@ package consul
 import (
 	"fmt"
 	"testing"
+
+	"github.com/square/p2/pkg/manifest"
 )
 
 const (
@@ -76,3 +78,27 @@ func TestPodPathErrorNoHostname(t *testing.T) {
 		t.Errorf("should have errored retrieving pod path with empty nodeName")
 	}
 }
+
+func TestPodPathForManifest(t *testing.T) {
+	builder := manifest.NewBuilder()
+	builder.SetID(testPodId)
+	podPath, err := PodPathForManifest(INTENT_TREE, testHostname, builder.GetManifest())
+	if err != nil {
+		t.Errorf("should not have errored retrieving pod path: %s", err)
+	}
+
+	expected := fmt.Sprintf("%s/%s/%s", INTENT_TREE, testHostname, testPodId)
+	if podPath != expected {
+		t.Errorf("Unexpected value for podPath, wanted '%s' got '%s'",
+			expected,
+			podPath,
+		)
+	}
+}
+
+func TestPodPathForManifestErrorNoPodID(t *testing.T) {
+	_, err := PodPathForManifest(INTENT_TREE, testHostname, manifest.NewBuilder().GetManifest())
+	if err == nil {
+		t.Errorf("should have errored retrieving pod path for a manifest without an ID")
+	}
+}
@@ -0,0 +1,79 @@
+package consultest
+
+import (
+	"sync"
+
+	"github.com/square/p2/pkg/store/consul"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// fakeHealthManager publishes health results directly to a FakePodStore. As
+// with the real manager, each updater is bound to a single pod and service on
+// the manager's node, and closing an updater (or the manager) removes the
+// results it published.
+type fakeHealthManager struct {
+	store *FakePodStore
+	node  types.NodeName
+
+	mu sync.Mutex
+	// health paths written by updaters that have not been closed
+	published map[string]bool
+}
+
+var _ consul.HealthManager = &fakeHealthManager{}
+
+type fakeHealthUpdater struct {
+	manager *fakeHealthManager
+	pod     types.PodID
+	service string
+}
+
+func (m *fakeHealthManager) NewUpdater(pod types.PodID, service string) consul.HealthUpdater {
+	return &fakeHealthUpdater{
+		manager: m,
+		pod:     pod,
+		service: service,
+	}
+}
+
+func (m *fakeHealthManager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key := range m.published {
+		m.store.deleteHealth(key)
+	}
+	m.published = make(map[string]bool)
+}
+
+func (u *fakeHealthUpdater) PutHealth(health consul.WatchResult) error {
+	if health.Node != u.manager.node || health.Id != u.pod || health.Service != u.service {
+		return util.Errorf(
+			"this updater is bound to %s/%s/%s and cannot update %s/%s/%s",
+			u.manager.node,
+			u.pod,
+			u.service,
+			health.Node,
+			health.Id,
+			health.Service,
+		)
+	}
+	if _, _, err := u.manager.store.PutHealth(health); err != nil {
+		return err
+	}
+
+	u.manager.mu.Lock()
+	defer u.manager.mu.Unlock()
+	u.manager.published[consul.HealthPath(u.service, u.manager.node)] = true
+	return nil
+}
+
+func (u *fakeHealthUpdater) Close() {
+	key := consul.HealthPath(u.service, u.manager.node)
+	u.manager.mu.Lock()
+	defer u.manager.mu.Unlock()
+	if u.manager.published[key] {
+		u.manager.store.deleteHealth(key)
+		delete(u.manager.published, key)
+	}
+}
@@ -1,6 +1,11 @@
 package consultest
 
 import (
+	"errors"
+	"time"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
 	"github.com/square/p2/pkg/store/consul"
 	"github.com/square/p2/pkg/types"
 
@@ -39,3 +44,243 @@ func TestFakeServiceHealth(t *testing.T) {
 		t.Fatalf("Status didn't match expected: %v", watchResult.Status)
 	}
 }
+
+func fakeManifest(id types.PodID) manifest.Manifest {
+	builder := manifest.NewBuilder()
+	builder.SetID(id)
+	return builder.GetManifest()
+}
+
+func TestFakePodStoreRecordsCalls(t *testing.T) {
+	fake := NewFakePodStore(nil, nil)
+	_, err := fake.SetPod(consul.INTENT_TREE, "node1", fakeManifest("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = fake.Pod(consul.INTENT_TREE, "node1", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = fake.DeletePod(consul.INTENT_TREE, "node1", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Call{
+		{Method: "SetPod", Path: "intent/node1/foo"},
+		{Method: "Pod", Path: "intent/node1/foo"},
+		{Method: "DeletePod", Path: "intent/node1/foo"},
+	}
+	calls := fake.RecordedCalls()
+	if len(calls) != len(expected) {
+		t.Fatalf("expected %d calls, got %d: %v", len(expected), len(calls), calls)
+	}
+	for i := range expected {
+		if calls[i] != expected[i] {
+			t.Errorf("call %d: expected %+v, got %+v", i, expected[i], calls[i])
+		}
+	}
+}
+
+func TestFakePodStoreInjectError(t *testing.T) {
+	fake := NewFakePodStore(nil, nil)
+	injected := errors.New("consul is down")
+	fake.InjectError("intent/node1/foo", injected)
+
+	_, err := fake.SetPod(consul.INTENT_TREE, "node1", fakeManifest("foo"))
+	if err != injected {
+		t.Fatalf("expected injected error, got %v", err)
+	}
+	_, err = fake.SetPod(consul.INTENT_TREE, "node2", fakeManifest("foo"))
+	if err != nil {
+		t.Fatalf("error should only be injected for the given path: %s", err)
+	}
+
+	fake.InjectError("intent/node1/foo", nil)
+	_, err = fake.SetPod(consul.INTENT_TREE, "node1", fakeManifest("foo"))
+	if err != nil {
+		t.Fatalf("expected error to be cleared: %s", err)
+	}
+}
+
+func TestFakePodStoreWatchPod(t *testing.T) {
+	fake := NewFakePodStore(nil, nil)
+	quitCh := make(chan struct{})
+	defer close(quitCh)
+	errCh := make(chan error)
+	podCh := make(chan consul.ManifestResult)
+	go fake.WatchPod(consul.INTENT_TREE, "node1", "foo", quitCh, errCh, podCh)
+
+	select {
+	case res := <-podCh:
+		if res.Manifest != nil {
+			t.Fatalf("expected nil manifest before the pod is written, got %s", res.Manifest.ID())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for initial watch result")
+	}
+
+	_, err := fake.SetPod(consul.INTENT_TREE, "node1", fakeManifest("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case res := <-podCh:
+		if res.Manifest == nil || res.Manifest.ID() != "foo" {
+			t.Fatalf("expected watch to emit pod foo, got %+v", res)
+		}
+	case err := <-errCh:
+		t.Fatalf("unexpected watch error: %s", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for watch to observe the write")
+	}
+}
+
+func TestFakePodStorePutHealth(t *testing.T) {
+	fake := NewFakePodStore(nil, nil)
+	written, _, err := fake.PutHealth(consul.WatchResult{
+		Id:      "foo",
+		Node:    "node1",
+		Service: "foo",
+		Status:  "passing",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := fake.GetHealth("foo", "node1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != "passing" || !res.Time.Equal(written) {
+		t.Errorf("expected a passing result written at %s, got %+v", written, res)
+	}
+	if !res.Expires.Equal(written.Add(consul.TTL)) {
+		t.Errorf("expected the result to expire after %s, got %s", consul.TTL, res.Expires)
+	}
+
+	serviceRes, err := fake.GetServiceHealth("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(serviceRes) != 1 {
+		t.Errorf("expected a single health entry for foo, got %v", serviceRes)
+	}
+}
+
+func TestFakePodStoreWatchAllPods(t *testing.T) {
+	fake := NewFakePodStore(nil, nil)
+	_, err := fake.SetPod(consul.INTENT_TREE, "node1", fakeManifest("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	quitCh := make(chan struct{})
+	defer close(quitCh)
+	errCh := make(chan error)
+	podCh := make(chan []consul.ManifestResult)
+	go fake.WatchAllPods(consul.INTENT_TREE, quitCh, errCh, podCh, 0)
+
+	select {
+	case results := <-podCh:
+		if len(results) != 1 || results[0].PodLocation.Node != "node1" {
+			t.Fatalf("expected the watch to emit the pod on node1, got %+v", results)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for initial watch result")
+	}
+
+	_, err = fake.SetPod(consul.INTENT_TREE, "node2", fakeManifest("bar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case results := <-podCh:
+		if len(results) != 2 {
+			t.Fatalf("expected the watch to emit the pods on both nodes, got %+v", results)
+		}
+	case err := <-errCh:
+		t.Fatalf("unexpected watch error: %s", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for watch to observe the write")
+	}
+
+	fake.InjectError(string(consul.INTENT_TREE), errors.New("fail"))
+	_, err = fake.DeletePod(consul.INTENT_TREE, "node2", "bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case results := <-podCh:
+		t.Fatalf("expected an error, got %+v", results)
+	case <-errCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for injected error")
+	}
+}
+
+func TestFakePodStorePing(t *testing.T) {
+	if err := NewFakePodStore(nil, nil).Ping(); err != nil {
+		t.Errorf("expected ping to succeed, got %s", err)
+	}
+}
+
+func TestFakePodStoreUnmanagedSession(t *testing.T) {
+	fake := NewFakePodStore(nil, nil)
+	managed, _, err := fake.NewSession("managed", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := managed.Lock("some/key"); err != nil {
+		t.Fatal(err)
+	}
+
+	unmanaged := fake.NewUnmanagedSession("existing-session", "unmanaged")
+	if unmanaged.Session() != "existing-session" {
+		t.Errorf("expected the session ID to be existing-session, got %s", unmanaged.Session())
+	}
+	if _, err := unmanaged.Lock("some/key"); !consul.IsAlreadyLocked(err) {
+		t.Errorf("expected the unmanaged session to see the managed session's lock, got %v", err)
+	}
+	if _, err := unmanaged.Lock("other/key"); err != nil {
+		t.Errorf("expected to lock an unheld key, got %s", err)
+	}
+}
+
+func TestFakePodStoreHealthManager(t *testing.T) {
+	fake := NewFakePodStore(nil, nil)
+	manager := fake.NewHealthManager("node1", logging.TestLogger())
+
+	foo := manager.NewUpdater("foo", "foo")
+	err := foo.PutHealth(consul.WatchResult{Id: "foo", Node: "node1", Service: "foo", Status: "passing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, _ := fake.GetHealth("foo", "node1")
+	if res.Status != "passing" {
+		t.Errorf("expected the updater to publish a passing result, got %+v", res)
+	}
+
+	err = foo.PutHealth(consul.WatchResult{Id: "foo", Node: "node2", Service: "foo", Status: "passing"})
+	if err == nil {
+		t.Error("expected an error updating health for a different node")
+	}
+
+	foo.Close()
+	if res, _ := fake.GetHealth("foo", "node1"); res.Status != "" {
+		t.Errorf("expected closing the updater to remove its result, got %+v", res)
+	}
+
+	bar := manager.NewUpdater("bar", "bar")
+	err = bar.PutHealth(consul.WatchResult{Id: "bar", Node: "node1", Service: "bar", Status: "critical"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.Close()
+	if res, _ := fake.GetHealth("bar", "node1"); res.Status != "" {
+		t.Errorf("expected closing the manager to remove its results, got %+v", res)
+	}
+}
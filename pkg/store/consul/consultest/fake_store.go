@@ -13,11 +13,24 @@ import (
 	"github.com/square/p2/pkg/types"
 )
 
-// In memory consul store useful in tests. Currently does not implement the entire
-// consul.Store interface
+// FakePodStore is an in memory consul store and is the canonical testing
+// double for code that reads and writes pods through the consul package. It
+// records every call made against it (see RecordedCalls), can be made to fail
+// operations on a particular path (see InjectError), and notifies WatchPod,
+// WatchPods and WatchAllPods callers when a watched key changes. Sessions hold
+// their locks in memory, and health managers write through PutHealth.
 type FakePodStore struct {
 	podResults    map[FakePodStoreKey]manifest.Manifest
 	healthResults map[string]consul.WatchResult
+	metadata      map[FakePodStoreKey]consul.SchedulingMetadata
+
+	// errors to be returned for operations on a given path, see InjectError()
+	injectedErrors map[string]error
+	calls          []Call
+
+	// closed and replaced every time a pod is written or deleted, so that
+	// watches can block until something changes
+	changed chan struct{}
 
 	// represents locks that are held. Will be shared between any
 	// fakeSessions returned by NewSession().  It is the session
@@ -29,6 +42,8 @@ type FakePodStore struct {
 	podLock sync.Mutex
 }
 
+var _ consul.Store = &FakePodStore{}
+
 func NewFakePodStore(podResults map[FakePodStoreKey]manifest.Manifest, healthResults map[string]consul.WatchResult) *FakePodStore {
 	if podResults == nil {
 		podResults = make(map[FakePodStoreKey]manifest.Manifest)
@@ -43,6 +58,65 @@ func NewFakePodStore(podResults map[FakePodStoreKey]manifest.Manifest, healthRes
 	}
 }
 
+// Call records a single operation performed against a FakePodStore.
+type Call struct {
+	Method string
+	Path   string
+}
+
+// InjectError causes every subsequent operation on path (e.g.
+// "intent/node1/mypod") to fail with err. Operations on a node, such as
+// ListPods, use the node's path (e.g. "intent/node1"). Pass a nil err to
+// remove a previously injected error.
+func (f *FakePodStore) InjectError(path string, err error) {
+	f.podLock.Lock()
+	defer f.podLock.Unlock()
+	if f.injectedErrors == nil {
+		f.injectedErrors = make(map[string]error)
+	}
+	if err == nil {
+		delete(f.injectedErrors, path)
+		return
+	}
+	f.injectedErrors[path] = err
+}
+
+// RecordedCalls returns every call made against the store, in order.
+func (f *FakePodStore) RecordedCalls() []Call {
+	f.podLock.Lock()
+	defer f.podLock.Unlock()
+	ret := make([]Call, len(f.calls))
+	copy(ret, f.calls)
+	return ret
+}
+
+// record must be called with podLock held. It returns any error injected for
+// the path.
+func (f *FakePodStore) record(method string, path string) error {
+	f.calls = append(f.calls, Call{Method: method, Path: path})
+	return f.injectedErrors[path]
+}
+
+// notifyChanged must be called with podLock held
+func (f *FakePodStore) notifyChanged() {
+	if f.changed != nil {
+		close(f.changed)
+	}
+	f.changed = make(chan struct{})
+}
+
+// changedCh must be called with podLock held
+func (f *FakePodStore) changedCh() <-chan struct{} {
+	if f.changed == nil {
+		f.changed = make(chan struct{})
+	}
+	return f.changed
+}
+
+func fakePodPath(podPrefix consul.PodPrefix, hostname types.NodeName, podId types.PodID) string {
+	return path.Join(string(podPrefix), hostname.String(), string(podId))
+}
+
 type FakePodStoreKey struct {
 	podPrefix consul.PodPrefix
 	hostname  types.NodeName
@@ -57,16 +131,26 @@ func FakePodStoreKeyFor(podPrefix consul.PodPrefix, hostname types.NodeName, pod
 	}
 }
 
-func (f *FakePodStore) SetPod(podPrefix consul.PodPrefix, hostname types.NodeName, manifest manifest.Manifest) (time.Duration, error) {
+func (f *FakePodStore) SetPod(podPrefix consul.PodPrefix, hostname types.NodeName, podManifest manifest.Manifest) (time.Duration, error) {
 	f.podLock.Lock()
 	defer f.podLock.Unlock()
-	f.podResults[FakePodStoreKeyFor(podPrefix, hostname, manifest.ID())] = manifest
+	if err := f.record("SetPod", fakePodPath(podPrefix, hostname, podManifest.ID())); err != nil {
+		return 0, err
+	}
+	if f.podResults == nil {
+		f.podResults = make(map[FakePodStoreKey]manifest.Manifest)
+	}
+	f.podResults[FakePodStoreKeyFor(podPrefix, hostname, podManifest.ID())] = podManifest
+	f.notifyChanged()
 	return 0, nil
 }
 
 func (f *FakePodStore) Pod(podPrefix consul.PodPrefix, hostname types.NodeName, podId types.PodID) (manifest.Manifest, time.Duration, error) {
 	f.podLock.Lock()
 	defer f.podLock.Unlock()
+	if err := f.record("Pod", fakePodPath(podPrefix, hostname, podId)); err != nil {
+		return nil, 0, err
+	}
 	if pod, ok := f.podResults[FakePodStoreKeyFor(podPrefix, hostname, podId)]; !ok {
 		return nil, 0, pods.NoCurrentManifest
 	} else {
@@ -74,9 +158,27 @@ func (f *FakePodStore) Pod(podPrefix consul.PodPrefix, hostname types.NodeName,
 	}
 }
 
+func (f *FakePodStore) PodExists(podPrefix consul.PodPrefix, hostname types.NodeName, podId types.PodID) (bool, time.Duration, error) {
+	f.podLock.Lock()
+	defer f.podLock.Unlock()
+	if err := f.record("PodExists", fakePodPath(podPrefix, hostname, podId)); err != nil {
+		return false, 0, err
+	}
+	_, ok := f.podResults[FakePodStoreKeyFor(podPrefix, hostname, podId)]
+	return ok, 0, nil
+}
+
 func (f *FakePodStore) ListPods(podPrefix consul.PodPrefix, hostname types.NodeName) ([]consul.ManifestResult, time.Duration, error) {
 	f.podLock.Lock()
 	defer f.podLock.Unlock()
+	if err := f.record("ListPods", path.Join(string(podPrefix), hostname.String())); err != nil {
+		return nil, 0, err
+	}
+	return f.listPods(podPrefix, hostname)
+}
+
+// listPods must be called with podLock held
+func (f *FakePodStore) listPods(podPrefix consul.PodPrefix, hostname types.NodeName) ([]consul.ManifestResult, time.Duration, error) {
 	res := make([]consul.ManifestResult, 0)
 	for key, manifest := range f.podResults {
 		if key.podPrefix == podPrefix && key.hostname == hostname {
@@ -103,6 +205,14 @@ func (f *FakePodStore) ListPods(podPrefix consul.PodPrefix, hostname types.NodeN
 func (f *FakePodStore) AllPods(podPrefix consul.PodPrefix) ([]consul.ManifestResult, time.Duration, error) {
 	f.podLock.Lock()
 	defer f.podLock.Unlock()
+	if err := f.record("AllPods", string(podPrefix)); err != nil {
+		return nil, 0, err
+	}
+	return f.allPods(podPrefix)
+}
+
+// allPods must be called with podLock held
+func (f *FakePodStore) allPods(podPrefix consul.PodPrefix) ([]consul.ManifestResult, time.Duration, error) {
 	res := make([]consul.ManifestResult, 0)
 	for key, manifest := range f.podResults {
 		if key.podPrefix != podPrefix {
@@ -129,11 +239,58 @@ func (f *FakePodStore) AllPods(podPrefix consul.PodPrefix) ([]consul.ManifestRes
 func (f *FakePodStore) DeletePod(podPrefix consul.PodPrefix, hostname types.NodeName, podId types.PodID) (time.Duration, error) {
 	f.podLock.Lock()
 	defer f.podLock.Unlock()
+	if err := f.record("DeletePod", fakePodPath(podPrefix, hostname, podId)); err != nil {
+		return 0, err
+	}
 	delete(f.podResults, FakePodStoreKeyFor(podPrefix, hostname, podId))
+	delete(f.metadata, FakePodStoreKeyFor(podPrefix, hostname, podId))
+	f.notifyChanged()
+	return 0, nil
+}
+
+func (f *FakePodStore) SetRealityManifest(hostname types.NodeName, podManifest manifest.Manifest) (time.Duration, error) {
+	return f.SetPod(consul.REALITY_TREE, hostname, podManifest)
+}
+
+func (f *FakePodStore) DeleteRealityManifest(hostname types.NodeName, podId types.PodID) (time.Duration, error) {
+	return f.DeletePod(consul.REALITY_TREE, hostname, podId)
+}
+
+func (f *FakePodStore) SetSchedulingMetadata(podPrefix consul.PodPrefix, hostname types.NodeName, podId types.PodID, metadata consul.SchedulingMetadata) (time.Duration, error) {
+	f.podLock.Lock()
+	defer f.podLock.Unlock()
+	if err := f.record("SetSchedulingMetadata", fakePodPath(podPrefix, hostname, podId)); err != nil {
+		return 0, err
+	}
+	if f.metadata == nil {
+		f.metadata = make(map[FakePodStoreKey]consul.SchedulingMetadata)
+	}
+	f.metadata[FakePodStoreKeyFor(podPrefix, hostname, podId)] = metadata
+	return 0, nil
+}
+
+func (f *FakePodStore) DeleteSchedulingMetadata(podPrefix consul.PodPrefix, hostname types.NodeName, podId types.PodID) (time.Duration, error) {
+	f.podLock.Lock()
+	defer f.podLock.Unlock()
+	if err := f.record("DeleteSchedulingMetadata", fakePodPath(podPrefix, hostname, podId)); err != nil {
+		return 0, err
+	}
+	delete(f.metadata, FakePodStoreKeyFor(podPrefix, hostname, podId))
 	return 0, nil
 }
 
+// SchedulingMetadata returns the metadata last written with
+// SetSchedulingMetadata for a pod, if any. It is not recorded as a call.
+func (f *FakePodStore) SchedulingMetadata(podPrefix consul.PodPrefix, hostname types.NodeName, podId types.PodID) (consul.SchedulingMetadata, bool) {
+	f.podLock.Lock()
+	defer f.podLock.Unlock()
+	metadata, ok := f.metadata[FakePodStoreKeyFor(podPrefix, hostname, podId)]
+	return metadata, ok
+}
+
 func (f *FakePodStore) GetHealth(service string, node types.NodeName) (consul.WatchResult, error) {
+	f.podLock.Lock()
+	defer f.podLock.Unlock()
 	return f.healthResults[consul.HealthPath(service, node)], nil
 }
 
@@ -142,11 +299,36 @@ func (f *FakePodStore) NewSession(name string, renewalCh <-chan time.Time) (cons
 	return newFakeSession(f.locks, &f.locksMu, renewalErrCh), renewalErrCh, nil
 }
 
-func (*FakePodStore) PutHealth(res consul.WatchResult) (time.Time, time.Duration, error) {
-	panic("not implemented")
+// PutHealth stores res so that GetHealth and GetServiceHealth return it. As
+// with the real implementation, its Time and Expires are set to the time of
+// the write.
+func (f *FakePodStore) PutHealth(res consul.WatchResult) (time.Time, time.Duration, error) {
+	f.podLock.Lock()
+	defer f.podLock.Unlock()
+	key := consul.HealthPath(res.Service, res.Node)
+	if err := f.record("PutHealth", key); err != nil {
+		return time.Time{}, 0, err
+	}
+	now := time.Now()
+	res.Time = now
+	res.Expires = now.Add(consul.TTL)
+	if f.healthResults == nil {
+		f.healthResults = make(map[string]consul.WatchResult)
+	}
+	f.healthResults[key] = res
+	return now, 0, nil
+}
+
+// deleteHealth removes the health result at key
+func (f *FakePodStore) deleteHealth(key string) {
+	f.podLock.Lock()
+	defer f.podLock.Unlock()
+	delete(f.healthResults, key)
 }
 
 func (f *FakePodStore) GetServiceHealth(service string) (map[string]consul.WatchResult, error) {
+	f.podLock.Lock()
+	defer f.podLock.Unlock()
 	// Is this the best way to emulate recursive Consul queries?
 	ret := map[string]consul.WatchResult{}
 	prefix := consul.HealthPath(service, "")
@@ -158,20 +340,131 @@ func (f *FakePodStore) GetServiceHealth(service string) (map[string]consul.Watch
 	return ret, nil
 }
 
-func (*FakePodStore) WatchPod(podPrefix consul.PodPrefix, nodename types.NodeName, podId types.PodID, quitChan <-chan struct{}, errChan chan<- error, podChan chan<- consul.ManifestResult) {
-	panic("not implemented")
+// WatchPod emits the current value of the key, and then a new value every time
+// the store is written to, until quitChan is closed. As with the real
+// implementation, results with a nil Manifest are emitted when the key does not
+// exist.
+func (f *FakePodStore) WatchPod(podPrefix consul.PodPrefix, nodename types.NodeName, podId types.PodID, quitChan <-chan struct{}, errChan chan<- error, podChan chan<- consul.ManifestResult) {
+	defer close(podChan)
+
+	podPath := fakePodPath(podPrefix, nodename, podId)
+	for {
+		f.podLock.Lock()
+		err := f.record("WatchPod", podPath)
+		out := consul.ManifestResult{}
+		if pod, ok := f.podResults[FakePodStoreKeyFor(podPrefix, nodename, podId)]; ok {
+			out = consul.ManifestResult{
+				Manifest: pod,
+				PodLocation: types.PodLocation{
+					Node:  nodename,
+					PodID: podId,
+				},
+			}
+		}
+		changed := f.changedCh()
+		f.podLock.Unlock()
+
+		if err != nil {
+			select {
+			case <-quitChan:
+				return
+			case errChan <- err:
+			}
+		} else {
+			select {
+			case <-quitChan:
+				return
+			case podChan <- out:
+			}
+		}
+
+		select {
+		case <-quitChan:
+			return
+		case <-changed:
+		}
+	}
 }
 
-func (*FakePodStore) WatchPods(podPrefix consul.PodPrefix, nodename types.NodeName, quitChan <-chan struct{}, errChan chan<- error, podChan chan<- []consul.ManifestResult) {
-	panic("not implemented")
+// WatchPods emits every pod for the node, and then the new set of pods every
+// time the store is written to, until quitChan is closed.
+func (f *FakePodStore) WatchPods(podPrefix consul.PodPrefix, nodename types.NodeName, quitChan <-chan struct{}, errChan chan<- error, podChan chan<- []consul.ManifestResult) {
+	defer close(podChan)
+
+	nodePath := path.Join(string(podPrefix), nodename.String())
+	for {
+		f.podLock.Lock()
+		err := f.record("WatchPods", nodePath)
+		var results []consul.ManifestResult
+		if err == nil {
+			results, _, err = f.listPods(podPrefix, nodename)
+		}
+		changed := f.changedCh()
+		f.podLock.Unlock()
+
+		if err != nil {
+			select {
+			case <-quitChan:
+				return
+			case errChan <- err:
+			}
+		} else {
+			select {
+			case <-quitChan:
+				return
+			case podChan <- results:
+			}
+		}
+
+		select {
+		case <-quitChan:
+			return
+		case <-changed:
+		}
+	}
 }
 
-func (*FakePodStore) WatchAllPods(podPrefix consul.PodPrefix, quitChan <-chan struct{}, errChan chan<- error, podChan chan<- []consul.ManifestResult, pauseTime time.Duration) {
-	panic("not implemented")
+// WatchAllPods emits every pod in the tree, and then the new set of pods every
+// time the store is written to, until quitChan is closed. pauseTime is ignored,
+// since the fake never has to rate limit its queries.
+func (f *FakePodStore) WatchAllPods(podPrefix consul.PodPrefix, quitChan <-chan struct{}, errChan chan<- error, podChan chan<- []consul.ManifestResult, pauseTime time.Duration) {
+	defer close(podChan)
+
+	for {
+		f.podLock.Lock()
+		err := f.record("WatchAllPods", string(podPrefix))
+		var results []consul.ManifestResult
+		if err == nil {
+			results, _, err = f.allPods(podPrefix)
+		}
+		changed := f.changedCh()
+		f.podLock.Unlock()
+
+		if err != nil {
+			select {
+			case <-quitChan:
+				return
+			case errChan <- err:
+			}
+		} else {
+			select {
+			case <-quitChan:
+				return
+			case podChan <- results:
+			}
+		}
+
+		select {
+		case <-quitChan:
+			return
+		case <-changed:
+		}
+	}
 }
 
+// Ping always succeeds, the fake store is always reachable.
 func (*FakePodStore) Ping() error {
-	panic("not implemented")
+	return nil
 }
 
 func (*FakePodStore) LockHolder(key string) (string, string, error) {
@@ -184,10 +477,20 @@ func (*FakePodStore) DestroyLockHolder(id string) error {
 	return nil
 }
 
-func (*FakePodStore) NewUnmanagedSession(session string, name string) consul.Session {
-	panic("not implemented")
+// NewUnmanagedSession returns a fake session with the given ID. Like the
+// sessions returned by NewSession, it shares the store's locks.
+func (f *FakePodStore) NewUnmanagedSession(session string, name string) consul.Session {
+	sess := newFakeSession(f.locks, &f.locksMu, make(chan error)).(*fakeSession)
+	sess.session = session
+	return sess
 }
 
-func (*FakePodStore) NewHealthManager(node types.NodeName, logger logging.Logger) consul.HealthManager {
-	panic("not implemented")
+// NewHealthManager returns a health manager whose updaters write to this
+// store's health results.
+func (f *FakePodStore) NewHealthManager(node types.NodeName, logger logging.Logger) consul.HealthManager {
+	return &fakeHealthManager{
+		store:     f,
+		node:      node,
+		published: make(map[string]bool),
+	}
 }
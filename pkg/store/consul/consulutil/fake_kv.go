@@ -2,6 +2,7 @@ package consulutil
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 
@@ -48,7 +49,28 @@ func (f *FakeKV) Get(key string, q *api.QueryOptions) (*api.KVPair, *api.QueryMe
 }
 
 func (f *FakeKV) Keys(prefix, separator string, q *api.QueryOptions) ([]string, *api.QueryMeta, error) {
-	return nil, nil, fmt.Errorf("not yet implemented in FakeKV")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	seen := make(map[string]bool)
+	var keys []string
+	for key := range f.Entries {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		// Like consul, keys nested below the separator are collapsed
+		// into their common prefix
+		if separator != "" {
+			if i := strings.Index(key[len(prefix):], separator); i >= 0 {
+				key = key[:len(prefix)+i+len(separator)]
+			}
+		}
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, &api.QueryMeta{}, nil
 }
 
 func (f *FakeKV) Put(pair *api.KVPair, q *api.WriteOptions) (*api.WriteMeta, error) {
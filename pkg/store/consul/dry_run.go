@@ -0,0 +1,69 @@
+package consul
+
+import (
+	"time"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/types"
+
+	"github.com/Sirupsen/logrus"
+)
+
+type dryRunStore struct {
+	Store
+	logger logging.Logger
+}
+
+// NewDryRunStore returns a Store that logs the writes it would make instead of
+// making them, and otherwise delegates to inner. Reads therefore return what
+// is really in the store, not what a write would have changed. This makes it
+// safe to exercise scheduling code against a real cluster, e.g. in staging.
+func NewDryRunStore(inner Store, logger logging.Logger) Store {
+	return dryRunStore{
+		Store:  inner,
+		logger: logger,
+	}
+}
+
+func (s dryRunStore) SetPod(podPrefix PodPrefix, nodename types.NodeName, manifest manifest.Manifest) (time.Duration, error) {
+	fields := logrus.Fields{
+		"pod_prefix": podPrefix,
+		"node":       nodename,
+		"pod":        manifest.ID(),
+	}
+	sha, err := manifest.SHA()
+	if err == nil {
+		fields["sha"] = sha
+	}
+	s.logger.WithFields(fields).Infoln("Dry run: would have written pod")
+	return 0, nil
+}
+
+func (s dryRunStore) DeletePod(podPrefix PodPrefix, nodename types.NodeName, podId types.PodID) (time.Duration, error) {
+	s.logger.WithFields(logrus.Fields{
+		"pod_prefix": podPrefix,
+		"node":       nodename,
+		"pod":        podId,
+	}).Infoln("Dry run: would have deleted pod")
+	return 0, nil
+}
+
+func (s dryRunStore) SetSchedulingMetadata(podPrefix PodPrefix, nodename types.NodeName, podId types.PodID, metadata SchedulingMetadata) (time.Duration, error) {
+	s.logger.WithFields(logrus.Fields{
+		"pod_prefix": podPrefix,
+		"node":       nodename,
+		"pod":        podId,
+		"metadata":   metadata,
+	}).Infoln("Dry run: would have written scheduling metadata")
+	return 0, nil
+}
+
+func (s dryRunStore) DeleteSchedulingMetadata(podPrefix PodPrefix, nodename types.NodeName, podId types.PodID) (time.Duration, error) {
+	s.logger.WithFields(logrus.Fields{
+		"pod_prefix": podPrefix,
+		"node":       nodename,
+		"pod":        podId,
+	}).Infoln("Dry run: would have deleted scheduling metadata")
+	return 0, nil
+}
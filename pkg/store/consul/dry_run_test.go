@@ -0,0 +1,80 @@
+package consul
+
+import (
+	"testing"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/types"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// writeCountingKV counts the writes made to the underlying fake KV
+type writeCountingKV struct {
+	*consulutil.FakeKV
+	writes int
+}
+
+func (kv *writeCountingKV) Put(pair *api.KVPair, q *api.WriteOptions) (*api.WriteMeta, error) {
+	kv.writes++
+	return kv.FakeKV.Put(pair, q)
+}
+
+func (kv *writeCountingKV) Delete(key string, w *api.WriteOptions) (*api.WriteMeta, error) {
+	kv.writes++
+	return kv.FakeKV.Delete(key, w)
+}
+
+func (kv *writeCountingKV) CAS(p *api.KVPair, q *api.WriteOptions) (bool, *api.WriteMeta, error) {
+	kv.writes++
+	return kv.FakeKV.CAS(p, q)
+}
+
+func TestDryRunStoreDoesNotWrite(t *testing.T) {
+	kv := &writeCountingKV{FakeKV: consulutil.NewKVWithEntries(nil)}
+	inner := NewConsulStore(&consulutil.FakeConsulClient{KV_: kv})
+
+	existing := manifest.NewBuilder()
+	existing.SetID("existing")
+	_, err := inner.SetPod(INTENT_TREE, "node1", existing.GetManifest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	kv.writes = 0
+
+	store := NewDryRunStore(inner, logging.TestLogger())
+
+	builder := manifest.NewBuilder()
+	builder.SetID("foo")
+	_, err = store.SetPod(INTENT_TREE, "node1", builder.GetManifest())
+	if err != nil {
+		t.Fatalf("Unexpected error from dry run SetPod: %s", err)
+	}
+	_, err = store.DeletePod(INTENT_TREE, "node1", "existing")
+	if err != nil {
+		t.Fatalf("Unexpected error from dry run DeletePod: %s", err)
+	}
+	_, err = store.SetSchedulingMetadata(INTENT_TREE, "node1", "existing", SchedulingMetadata{})
+	if err != nil {
+		t.Fatalf("Unexpected error from dry run SetSchedulingMetadata: %s", err)
+	}
+
+	if kv.writes != 0 {
+		t.Errorf("Expected the inner store to receive no writes, got %d", kv.writes)
+	}
+
+	// Reads still see the real contents of the store
+	_, _, err = store.Pod(INTENT_TREE, "node1", "foo")
+	if err == nil {
+		t.Error("Expected foo not to have been written")
+	}
+	pod, _, err := store.Pod(INTENT_TREE, "node1", "existing")
+	if err != nil {
+		t.Fatalf("Expected existing to still be readable through the dry run store: %s", err)
+	}
+	if pod.ID() != types.PodID("existing") {
+		t.Errorf("Expected to read existing, got %s", pod.ID())
+	}
+}
@@ -0,0 +1,82 @@
+package consul
+
+import (
+	"sync"
+	"time"
+)
+
+// StoreEvent describes a single completed store operation.
+type StoreEvent struct {
+	// The name of the store method, e.g. "SetPod"
+	Method string
+	// The consul key or prefix the method operated on. Empty if the
+	// method operated on several, or the path was invalid
+	Path     string
+	Duration time.Duration
+	// The error the method returned, nil on success
+	Error error
+}
+
+// EventEmitter passes a StoreEvent to every registered handler after each
+// store operation, so that metrics, auditing and the like can observe the
+// store without wrapping it.
+type EventEmitter struct {
+	mu       sync.RWMutex
+	nextID   int
+	handlers map[int]func(StoreEvent)
+}
+
+func NewEventEmitter() *EventEmitter {
+	return &EventEmitter{handlers: make(map[int]func(StoreEvent))}
+}
+
+// On registers handler to receive every event. Handlers are called
+// synchronously by the goroutine that made the store call, so they should
+// return quickly. The returned function deregisters the handler; functions
+// can't be compared, so there is no Off(handler).
+func (e *EventEmitter) On(handler func(StoreEvent)) func() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	id := e.nextID
+	e.nextID++
+	e.handlers[id] = handler
+
+	return func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		delete(e.handlers, id)
+	}
+}
+
+func (e *EventEmitter) emitEvent(event StoreEvent) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	for _, handler := range e.handlers {
+		handler(event)
+	}
+}
+
+// emit reports an operation on path that began at start to the store's event
+// handlers. It is meant to be deferred with a pointer to the operation's named
+// error result.
+func (c consulStore) emit(method string, path string, start time.Time, err *error) {
+	if c.EventEmitter == nil {
+		return
+	}
+	c.emitEvent(StoreEvent{
+		Method:   method,
+		Path:     path,
+		Duration: time.Since(start),
+		Error:    *err,
+	})
+}
+
+// eventPath returns path, or "" if it could not be computed. Invalid paths
+// are reported by the store method itself, once the deferred emit() has been
+// set up.
+func eventPath(path string, err error) string {
+	if err != nil {
+		return ""
+	}
+	return path
+}
@@ -0,0 +1,43 @@
+package consul
+
+import (
+	"testing"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+)
+
+func TestEventsReachEveryHandler(t *testing.T) {
+	store := NewConsulStore(consulutil.NewFakeClient())
+	var first, second []StoreEvent
+	store.On(func(event StoreEvent) { first = append(first, event) })
+	removeSecond := store.On(func(event StoreEvent) { second = append(second, event) })
+
+	builder := manifest.NewBuilder()
+	builder.SetID("foo")
+	_, err := store.SetPod(INTENT_TREE, "node1", builder.GetManifest())
+	if err != nil {
+		t.Fatalf("Unexpected error setting pod: %s", err)
+	}
+
+	for name, events := range map[string][]StoreEvent{"first": first, "second": second} {
+		if len(events) != 1 {
+			t.Fatalf("Expected the %s handler to receive 1 event, got %+v", name, events)
+		}
+		if events[0].Method != "SetPod" || events[0].Path != "intent/node1/foo" || events[0].Error != nil {
+			t.Errorf("Expected the %s handler to receive a successful SetPod of intent/node1/foo, got %+v", name, events[0])
+		}
+	}
+
+	removeSecond()
+	_, _, err = store.Pod(INTENT_TREE, "node1", "foo")
+	if err != nil {
+		t.Fatalf("Unexpected error reading pod: %s", err)
+	}
+	if len(first) != 2 || first[1].Method != "Pod" {
+		t.Errorf("Expected the first handler to receive the Pod event, got %+v", first)
+	}
+	if len(second) != 1 {
+		t.Errorf("Expected the removed handler to receive no more events, got %+v", second)
+	}
+}
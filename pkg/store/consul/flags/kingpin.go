@@ -4,36 +4,59 @@ package flags
 
 import (
 	"io/ioutil"
-	"log"
 	"net"
 	"net/http"
+	"os"
 	"strings"
 	"time"
 
 	"github.com/square/p2/pkg/labels"
+	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/store/consul"
 	netutil "github.com/square/p2/pkg/util/net"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
 func ParseWithConsulOptions() (string, consul.Options, labels.ApplicatorWithoutWatches) {
-	consulURL := kingpin.Flag("consul", "The hostname and port of a consul agent in the p2 cluster. Defaults to 0.0.0.0:8500.").String()
-	httpApplicatorURL := kingpin.Flag("http-applicator-url", "The URL of an labels.httpApplicator target, including the protocol and port. For example, https://consul-server.io:9999").URL()
-	token := kingpin.Flag("token", "The consul ACL token to use. Empty by default.").String()
-	tokenFile := kingpin.Flag("token-file", "The file containing the Consul ACL token").ExistingFile()
-	headers := kingpin.Flag("header", "An HTTP header to add to requests, in KEY=VALUE form. Can be specified multiple times.").StringMap()
-	https := kingpin.Flag("https", "Use HTTPS").Bool()
-	wait := kingpin.Flag("wait", "Maximum duration for Consul watches, before resetting and starting again.").Default("30s").Duration()
-	caFile := kingpin.Flag("tls-ca-file", "File containing the x509 PEM-encoded CA ").ExistingFile()
-	keyFile := kingpin.Flag("tls-key-file", "File containing the x509 PEM-encoded private key").ExistingFile()
-	certFile := kingpin.Flag("tls-cert-file", "File containing the x509 PEM-encoded public key certificate").ExistingFile()
+	cmd, consulOpts, applicator, err := ParseAppWithConsulOptions(kingpin.CommandLine, os.Args[1:])
+	kingpin.FatalIfError(err, "")
+	return cmd, consulOpts, applicator
+}
 
-	cmd := kingpin.Parse()
+// ParseAppWithConsulOptions is like ParseWithConsulOptions but adds the flags
+// to app and parses args, returning any error instead of exiting. This allows
+// tools to be run more than once in the same process, e.g. from tests.
+func ParseAppWithConsulOptions(app *kingpin.Application, args []string) (string, consul.Options, labels.ApplicatorWithoutWatches, error) {
+	consulURL := app.Flag("consul", "The hostname and port of a consul agent in the p2 cluster. Defaults to 0.0.0.0:8500.").Envar("CONSUL_HTTP_ADDR").String()
+	httpApplicatorURL := app.Flag("http-applicator-url", "The URL of an labels.httpApplicator target, including the protocol and port. For example, https://consul-server.io:9999").URL()
+	token := app.Flag("token", "The consul ACL token to use. Empty by default.").Envar("CONSUL_HTTP_TOKEN").String()
+	tokenFile := app.Flag("token-file", "The file containing the Consul ACL token").ExistingFile()
+	tokenRefreshInterval := app.Flag("token-refresh-interval", "If positive, check --token-file for a new token at this interval, for long running processes whose token may be rotated.").Duration()
+	headers := app.Flag("header", "An HTTP header to add to requests, in KEY=VALUE form. Can be specified multiple times.").StringMap()
+	https := app.Flag("https", "Use HTTPS").Envar("CONSUL_HTTP_SSL").Bool()
+	wait := app.Flag("wait", "Maximum duration for Consul watches, before resetting and starting again.").Default("30s").Duration()
+	caFile := app.Flag("tls-ca-file", "File containing the x509 PEM-encoded CA ").Envar("CONSUL_CACERT").ExistingFile()
+	keyFile := app.Flag("tls-key-file", "File containing the x509 PEM-encoded private key").Envar("CONSUL_CLIENT_KEY").ExistingFile()
+	certFile := app.Flag("tls-cert-file", "File containing the x509 PEM-encoded public key certificate").Envar("CONSUL_CLIENT_CERT").ExistingFile()
+
+	cmd, err := app.Parse(args)
+	if err != nil {
+		return "", consul.Options{}, nil, err
+	}
 
-	if *tokenFile != "" {
+	var rotatingToken *consul.TokenFile
+	if *tokenFile != "" && *tokenRefreshInterval > 0 {
+		rotatingToken, err = consul.NewTokenFile(*tokenFile)
+		if err != nil {
+			return "", consul.Options{}, nil, err
+		}
+		go rotatingToken.RefreshEvery(*tokenRefreshInterval, nil, logging.DefaultLogger)
+		// The token is added by the transport instead
+		*token = ""
+	} else if *tokenFile != "" {
 		tokenBytes, err := ioutil.ReadFile(*tokenFile)
 		if err != nil {
-			log.Fatalln(err)
+			return "", consul.Options{}, nil, err
 		}
 		*token = strings.TrimSpace(string(tokenBytes))
 	}
@@ -41,7 +64,7 @@ func ParseWithConsulOptions() (string, consul.Options, labels.ApplicatorWithoutW
 	if *caFile != "" || *keyFile != "" || *certFile != "" {
 		tlsConfig, err := netutil.GetTLSConfig(*certFile, *keyFile, *caFile)
 		if err != nil {
-			log.Fatalln(err)
+			return "", consul.Options{}, nil, err
 		}
 
 		transport = &http.Transport{
@@ -55,6 +78,9 @@ func ParseWithConsulOptions() (string, consul.Options, labels.ApplicatorWithoutW
 	} else {
 		transport = http.DefaultTransport
 	}
+	if rotatingToken != nil {
+		transport = rotatingToken.Transport(transport)
+	}
 	httpClient := netutil.NewHeaderClient(*headers, transport)
 
 	consulOpts := consul.Options{
@@ -62,19 +88,21 @@ func ParseWithConsulOptions() (string, consul.Options, labels.ApplicatorWithoutW
 		Token:    *token,
 		Client:   httpClient,
 		HTTPS:    *https,
+		CAFile:   *caFile,
+		CertFile: *certFile,
+		KeyFile:  *keyFile,
 		WaitTime: *wait,
 	}
 
 	var applicator labels.ApplicatorWithoutWatches
-	var err error
 	if *httpApplicatorURL != nil {
 		applicator, err = labels.NewHTTPApplicator(httpClient, *httpApplicatorURL)
 		if err != nil {
-			log.Fatalln(err)
+			return "", consul.Options{}, nil, err
 		}
 	} else {
 		jitterWindow := 0 * time.Second // we don't initiate watches in CLIs so this doesn't matter
 		applicator = labels.NewConsulApplicator(consul.NewConsulClient(consulOpts), 0, jitterWindow)
 	}
-	return cmd, consulOpts, applicator
+	return cmd, consulOpts, applicator, nil
 }
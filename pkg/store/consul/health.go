@@ -0,0 +1,53 @@
+package consul
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/square/p2/pkg/store/consul/consulutil"
+)
+
+// The key read by Ping(). It does not need to exist: consul answers a read of
+// a missing key as long as it is reachable and has a leader.
+const pingKey = "p2-ping"
+
+// Ping makes a single read from consul and returns an error if it fails.
+func (c consulStore) Ping() (err error) {
+	defer c.emit("Ping", pingKey, time.Now(), &err)
+
+	_, _, err = c.client.KV().Get(pingKey, nil)
+	if err != nil {
+		return consulutil.NewKVError("get", pingKey, err)
+	}
+	return nil
+}
+
+// Healthy returns whether the most recent background Ping() succeeded,
+// without blocking. It always returns true unless Options.HealthCheckInterval
+// was set, and is true until the first ping completes.
+func (c consulStore) Healthy() bool {
+	if c.healthy == nil {
+		return true
+	}
+	return atomic.LoadInt32(c.healthy) == 1
+}
+
+// monitorHealth pings consul every interval for the lifetime of the process,
+// recording the outcome for Healthy().
+func (c *consulStore) monitorHealth(interval time.Duration) {
+	healthy := int32(1)
+	c.healthy = &healthy
+
+	store := *c
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if store.Ping() == nil {
+				atomic.StoreInt32(store.healthy, 1)
+			} else {
+				atomic.StoreInt32(store.healthy, 0)
+			}
+		}
+	}()
+}
@@ -0,0 +1,61 @@
+package consul
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/store/consul/consulutil"
+)
+
+func TestHealthyDetectsUnavailableConsul(t *testing.T) {
+	var unavailable int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&unavailable) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		// consul responds to reads of missing keys with a 404
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	store := NewConsulStoreFromOptions(Options{
+		Address:             strings.TrimPrefix(server.URL, "http://"),
+		HealthCheckInterval: 50 * time.Millisecond,
+	})
+	if !store.Healthy() {
+		t.Fatal("expected the store to be healthy before the first ping")
+	}
+
+	atomic.StoreInt32(&unavailable, 1)
+	if !waitForHealthy(store, false, 150*time.Millisecond) {
+		t.Fatal("expected the store to become unhealthy within 150ms of consul becoming unavailable")
+	}
+
+	atomic.StoreInt32(&unavailable, 0)
+	if !waitForHealthy(store, true, 150*time.Millisecond) {
+		t.Fatal("expected the store to become healthy again within 150ms of consul recovering")
+	}
+}
+
+func TestHealthyWithoutHealthChecks(t *testing.T) {
+	store := NewConsulStore(consulutil.NewFakeClient())
+	if !store.Healthy() {
+		t.Error("expected a store without health checks to always be healthy")
+	}
+}
+
+func waitForHealthy(store *consulStore, expected bool, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if store.Healthy() == expected {
+			return true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return store.Healthy() == expected
+}
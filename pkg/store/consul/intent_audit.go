@@ -0,0 +1,138 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/square/p2/pkg/audit"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/store/consul/transaction"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// Subset of auditlogstore.ConsulStore used to record changes to the intent
+// tree
+type AuditLogStore interface {
+	Create(ctx context.Context, eventType audit.EventType, eventDetails json.RawMessage) error
+}
+
+type intentAuditor struct {
+	auditLogStore AuditLogStore
+	user          string
+	hostname      string
+}
+
+// AuditIntent returns a copy of the store that records an audit log for every
+// pod it writes to or deletes from the intent tree, as part of the same
+// transaction as the change, so that a change is never made without its
+// audit log. user and hostname identify who made the changes, and from where.
+//
+// Every method that changes the intent tree is audited: writes, deletes,
+// check-and-sets, mutations, touches and bulk deletes. Those that are not
+// already transactional become transactions, and each write takes two of a
+// transaction's operations and each delete three, see MaxTxnPodWrites(). The
+// hook and reality trees are not audited.
+func (c consulStore) AuditIntent(auditLogStore AuditLogStore, user string, hostname string) *consulStore {
+	c.intentAuditor = &intentAuditor{
+		auditLogStore: auditLogStore,
+		user:          user,
+		hostname:      hostname,
+	}
+	return &c
+}
+
+// MaxTxnPodWrites returns how many pods can be written to the tree in a single
+// transaction. Fewer pods can be deleted, since each delete also deletes the
+// pod's scheduling metadata.
+func (c consulStore) MaxTxnPodWrites(podPrefix PodPrefix) int {
+	if c.auditsIntent(podPrefix) {
+		return transaction.MaxOperations / 2
+	}
+	return transaction.MaxOperations
+}
+
+func (c consulStore) auditsIntent(podPrefix PodPrefix) bool {
+	return c.intentAuditor != nil && podPrefix == INTENT_TREE
+}
+
+// auditPodTxn adds the audit log of a change to the node's pod to the
+// transaction. manifestSHA is empty for deletes.
+func (c consulStore) auditPodTxn(ctx context.Context, eventType audit.EventType, nodename types.NodeName, podID types.PodID, manifestSHA string) error {
+	details, err := audit.NewPodEventDetails(podID, nodename, manifestSHA, c.intentAuditor.user, c.intentAuditor.hostname)
+	if err != nil {
+		return err
+	}
+	err = c.intentAuditor.auditLogStore.Create(ctx, eventType, details)
+	if err != nil {
+		return util.Errorf("could not create audit log record for %s on %s: %s", podID, nodename, err)
+	}
+	return nil
+}
+
+// casPod writes value to the pod's key if the key's modify index is still
+// modifyIndex (zero meaning the key must not exist), setting its modify time.
+// If the tree is audited, the write and a PodScheduledEvent for manifestSHA
+// are made in one transaction. Returns false, and writes nothing, if the key
+// was modified concurrently.
+func (c consulStore) casPod(podPrefix PodPrefix, nodename types.NodeName, podID types.PodID, value []byte, modifyIndex uint64, manifestSHA string) (bool, time.Duration, error) {
+	key, err := PodPath(podPrefix, nodename, podID)
+	if err != nil {
+		return false, 0, err
+	}
+
+	if !c.auditsIntent(podPrefix) {
+		ok, writeMeta, err := c.client.KV().CAS(&api.KVPair{
+			Key:         key,
+			Value:       value,
+			Flags:       modifiedAtFlags(time.Now()),
+			ModifyIndex: modifyIndex,
+		}, nil)
+		var retDur time.Duration
+		if writeMeta != nil {
+			retDur = writeMeta.RequestTime
+		}
+		if err != nil {
+			return false, retDur, consulutil.NewKVError("cas", key, err)
+		}
+		return ok, retDur, nil
+	}
+
+	start := time.Now()
+	ctx, cancel := transaction.New(context.Background())
+	defer cancel()
+	err = transaction.Add(ctx, api.KVTxnOp{
+		Verb:  api.KVCAS,
+		Key:   key,
+		Value: value,
+		Flags: modifiedAtFlags(time.Now()),
+		Index: modifyIndex,
+	})
+	if err != nil {
+		return false, 0, err
+	}
+	err = c.auditPodTxn(ctx, audit.PodScheduledEvent, nodename, podID, manifestSHA)
+	if err != nil {
+		return false, 0, err
+	}
+	// creating the audit log can't conflict, so a rollback means the CAS
+	// failed
+	ok, _, err := transaction.Commit(ctx, c.client.KV())
+	return ok, time.Since(start), err
+}
+
+// commitTxn makes the operations that addOps adds to a new transaction.
+func (c consulStore) commitTxn(addOps func(ctx context.Context) error) (time.Duration, error) {
+	start := time.Now()
+	ctx, cancel := transaction.New(context.Background())
+	defer cancel()
+	err := addOps(ctx)
+	if err != nil {
+		return time.Since(start), err
+	}
+	err = transaction.MustCommit(ctx, c.client.KV())
+	return time.Since(start), err
+}
@@ -0,0 +1,157 @@
+// +build !race
+
+package consul
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/square/p2/pkg/audit"
+	"github.com/square/p2/pkg/store/consul/auditlogstore"
+	"github.com/square/p2/pkg/types"
+)
+
+func podEvents(t *testing.T, auditLogStore auditlogstore.ConsulStore) map[audit.EventType][]audit.PodEventDetails {
+	logs, err := auditLogStore.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := make(map[audit.EventType][]audit.PodEventDetails)
+	for _, log := range logs {
+		var details audit.PodEventDetails
+		err = json.Unmarshal(*log.EventDetails, &details)
+		if err != nil {
+			t.Fatal(err)
+		}
+		events[log.EventType] = append(events[log.EventType], details)
+	}
+	return events
+}
+
+func TestAuditIntentRecordsSetsAndDeletes(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+	auditLogStore := auditlogstore.NewConsulStore(f.Client.KV())
+	store := f.Store.AuditIntent(auditLogStore, "alice", "bastion1")
+
+	foo := testManifest("foo")
+	_, err := store.SetPod(INTENT_TREE, "node1", foo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.DeletePod(INTENT_TREE, "node1", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the intent tree is audited
+	_, err = store.SetPod(REALITY_TREE, "node1", foo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := podEvents(t, auditLogStore)
+	sha, err := foo.SHA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := audit.PodEventDetails{PodID: "foo", Node: "node1", ManifestSHA: sha, User: "alice", Hostname: "bastion1"}
+	if len(events[audit.PodScheduledEvent]) != 1 || events[audit.PodScheduledEvent][0] != expected {
+		t.Errorf("expected one %s event %+v, got %+v", audit.PodScheduledEvent, expected, events[audit.PodScheduledEvent])
+	}
+	expected.ManifestSHA = ""
+	if len(events[audit.PodUnscheduledEvent]) != 1 || events[audit.PodUnscheduledEvent][0] != expected {
+		t.Errorf("expected one %s event %+v, got %+v", audit.PodUnscheduledEvent, expected, events[audit.PodUnscheduledEvent])
+	}
+	if len(events) != 2 {
+		t.Errorf("expected only the intent tree changes to be audited, got %+v", events)
+	}
+}
+
+func TestAuditIntentSetManyNodes(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+	auditLogStore := auditlogstore.NewConsulStore(f.Client.KV())
+	store := f.Store.AuditIntent(auditLogStore, "alice", "bastion1")
+
+	// More nodes than fit in one transaction with their audit logs
+	nodes := manyNodes(store.MaxTxnPodWrites(INTENT_TREE) + 1)
+	_, err := store.SetManyNodes(INTENT_TREE, nodes, testManifest("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	audited := make(map[types.NodeName]bool)
+	for _, details := range podEvents(t, auditLogStore)[audit.PodScheduledEvent] {
+		audited[details.Node] = true
+	}
+	for _, node := range nodes {
+		if !audited[node] {
+			t.Errorf("expected the write to %s to be audited", node)
+		}
+	}
+}
+
+func TestAuditIntentFromOptions(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+	store := NewConsulStoreWithOptions(f.Client, Options{AuditUser: "alice", AuditHostname: "bastion1"})
+
+	foo := testManifest("foo")
+	_, err := store.CompareAndSetPod(INTENT_TREE, "node1", nil, foo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.TouchPod(INTENT_TREE, "node1", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A failed check-and-set is not audited
+	_, err = store.CompareAndSetPod(INTENT_TREE, "node1", nil, foo)
+	if err != PodManifestMismatch {
+		t.Fatalf("expected a mismatch scheduling foo twice, got %v", err)
+	}
+
+	events := podEvents(t, auditlogstore.NewConsulStore(f.Client.KV()))
+	sha, err := foo.SHA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := audit.PodEventDetails{PodID: "foo", Node: "node1", ManifestSHA: sha, User: "alice", Hostname: "bastion1"}
+	scheduled := events[audit.PodScheduledEvent]
+	if len(scheduled) != 2 || scheduled[0] != expected || scheduled[1] != expected {
+		t.Errorf("expected two %s events %+v, got %+v", audit.PodScheduledEvent, expected, scheduled)
+	}
+}
+
+func TestAuditIntentBulkDelete(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+	auditLogStore := auditlogstore.NewConsulStore(f.Client.KV())
+	store := f.Store.AuditIntent(auditLogStore, "alice", "bastion1")
+
+	for _, node := range []types.NodeName{"node1", "node2"} {
+		if _, err := f.Store.SetPod(INTENT_TREE, node, testManifest("foo")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, _, err := store.BulkDelete([]string{"intent/node1/foo", "intent/node2/foo", "reality/node1/foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := podEvents(t, auditLogStore)
+	unscheduled := events[audit.PodUnscheduledEvent]
+	if len(unscheduled) != 2 {
+		t.Fatalf("expected a %s event for each intent pod, got %+v", audit.PodUnscheduledEvent, events)
+	}
+	nodes := map[types.NodeName]bool{}
+	for _, details := range unscheduled {
+		if details.PodID != "foo" || details.User != "alice" {
+			t.Errorf("unexpected %s event %+v", audit.PodUnscheduledEvent, details)
+		}
+		nodes[details.Node] = true
+	}
+	if !nodes["node1"] || !nodes["node2"] {
+		t.Errorf("expected events for node1 and node2, got %+v", unscheduled)
+	}
+}
@@ -0,0 +1,142 @@
+package consul
+
+import (
+	"sort"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/types"
+)
+
+// IntentTree is a structured view of a pod tree, e.g. /intent, keyed by node
+// and then by pod ID. Only legacy pods are included, since uuid pods are not
+// uniquely identified by their pod ID.
+type IntentTree struct {
+	Nodes map[types.NodeName]*NodeTree
+}
+
+// NodeTree holds the manifests scheduled on a single node.
+type NodeTree struct {
+	Pods map[types.PodID]manifest.Manifest
+}
+
+type TreeDiffType string
+
+const (
+	// The pod is in the other tree but not this one
+	PodAdded TreeDiffType = "added"
+	// The pod is in this tree but not the other one
+	PodRemoved TreeDiffType = "removed"
+	// The pod is in both trees with different manifests
+	PodChanged TreeDiffType = "changed"
+)
+
+// TreeDiff describes a single pod that differs between two IntentTrees.
+type TreeDiff struct {
+	Node  types.NodeName
+	PodID types.PodID
+	Type  TreeDiffType
+}
+
+// Implements sort.Interface to order diffs by node and then by pod ID
+type treeDiffs []TreeDiff
+
+func (d treeDiffs) Len() int      { return len(d) }
+func (d treeDiffs) Swap(i, j int) { d[i], d[j] = d[j], d[i] }
+func (d treeDiffs) Less(i, j int) bool {
+	if d[i].Node != d[j].Node {
+		return d[i].Node < d[j].Node
+	}
+	return d[i].PodID < d[j].PodID
+}
+
+// NewIntentTree builds an IntentTree out of a list of pods, such as the output
+// of AllPods().
+func NewIntentTree(results []ManifestResult) *IntentTree {
+	tree := &IntentTree{
+		Nodes: make(map[types.NodeName]*NodeTree),
+	}
+	for _, result := range results {
+		if result.PodUniqueKey != "" {
+			continue
+		}
+
+		node := result.PodLocation.Node
+		if tree.Nodes[node] == nil {
+			tree.Nodes[node] = &NodeTree{
+				Pods: make(map[types.PodID]manifest.Manifest),
+			}
+		}
+		tree.Nodes[node].Pods[result.PodLocation.PodID] = result.Manifest
+	}
+	return tree
+}
+
+// ListIntentTree returns every legacy pod in the intent tree, grouped by node.
+func (c consulStore) ListIntentTree() (*IntentTree, error) {
+	return c.listPodTree(INTENT_TREE)
+}
+
+// ListRealityTree returns every legacy pod in the reality tree, grouped by
+// node.
+func (c consulStore) ListRealityTree() (*IntentTree, error) {
+	return c.listPodTree(REALITY_TREE)
+}
+
+func (c consulStore) listPodTree(podPrefix PodPrefix) (*IntentTree, error) {
+	results, _, err := c.AllPods(podPrefix)
+	if err != nil {
+		return nil, err
+	}
+	return NewIntentTree(results), nil
+}
+
+// Diff returns the pods that differ between this tree and other, ordered by
+// node and pod ID. Manifests are compared by SHA, and a manifest whose SHA
+// cannot be computed is reported as changed.
+func (t *IntentTree) Diff(other *IntentTree) []TreeDiff {
+	var diffs []TreeDiff
+	for node, nodeTree := range t.Nodes {
+		for podID, podManifest := range nodeTree.Pods {
+			otherManifest := other.pod(node, podID)
+			if otherManifest == nil {
+				diffs = append(diffs, TreeDiff{Node: node, PodID: podID, Type: PodRemoved})
+				continue
+			}
+
+			if !sameManifest(podManifest, otherManifest) {
+				diffs = append(diffs, TreeDiff{Node: node, PodID: podID, Type: PodChanged})
+			}
+		}
+	}
+
+	for node, nodeTree := range other.Nodes {
+		for podID := range nodeTree.Pods {
+			if t.pod(node, podID) == nil {
+				diffs = append(diffs, TreeDiff{Node: node, PodID: podID, Type: PodAdded})
+			}
+		}
+	}
+
+	sort.Sort(treeDiffs(diffs))
+	return diffs
+}
+
+func (t *IntentTree) pod(node types.NodeName, podID types.PodID) manifest.Manifest {
+	nodeTree, ok := t.Nodes[node]
+	if !ok {
+		return nil
+	}
+	return nodeTree.Pods[podID]
+}
+
+func sameManifest(a manifest.Manifest, b manifest.Manifest) bool {
+	aSHA, err := a.SHA()
+	if err != nil {
+		return false
+	}
+	bSHA, err := b.SHA()
+	if err != nil {
+		return false
+	}
+	return aSHA == bSHA
+}
@@ -0,0 +1,58 @@
+package consul
+
+import (
+	"testing"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/types"
+)
+
+func intentTreeManifest(id types.PodID, runAs string) manifest.Manifest {
+	builder := manifest.NewBuilder()
+	builder.SetID(id)
+	builder.SetRunAsUser(runAs)
+	return builder.GetManifest()
+}
+
+func TestIntentTreeDiff(t *testing.T) {
+	before := NewIntentTree([]ManifestResult{
+		{Manifest: intentTreeManifest("foo", "foo"), PodLocation: types.PodLocation{Node: "node1", PodID: "foo"}},
+		{Manifest: intentTreeManifest("bar", "bar"), PodLocation: types.PodLocation{Node: "node2", PodID: "bar"}},
+	})
+	after := NewIntentTree([]ManifestResult{
+		{Manifest: intentTreeManifest("foo", "foo"), PodLocation: types.PodLocation{Node: "node1", PodID: "foo"}},
+		{Manifest: intentTreeManifest("bar", "root"), PodLocation: types.PodLocation{Node: "node2", PodID: "bar"}},
+	})
+
+	diffs := before.Diff(after)
+	if len(diffs) != 1 {
+		t.Fatalf("expected exactly one diff, got %d: %+v", len(diffs), diffs)
+	}
+	expected := TreeDiff{Node: "node2", PodID: "bar", Type: PodChanged}
+	if diffs[0] != expected {
+		t.Errorf("expected diff %+v, got %+v", expected, diffs[0])
+	}
+}
+
+func TestIntentTreeDiffAddedAndRemoved(t *testing.T) {
+	before := NewIntentTree([]ManifestResult{
+		{Manifest: intentTreeManifest("foo", "foo"), PodLocation: types.PodLocation{Node: "node1", PodID: "foo"}},
+	})
+	after := NewIntentTree([]ManifestResult{
+		{Manifest: intentTreeManifest("bar", "bar"), PodLocation: types.PodLocation{Node: "node1", PodID: "bar"}},
+	})
+
+	diffs := before.Diff(after)
+	expected := []TreeDiff{
+		{Node: "node1", PodID: "bar", Type: PodAdded},
+		{Node: "node1", PodID: "foo", Type: PodRemoved},
+	}
+	if len(diffs) != len(expected) {
+		t.Fatalf("expected %d diffs, got %d: %+v", len(expected), len(diffs), diffs)
+	}
+	for i := range expected {
+		if diffs[i] != expected[i] {
+			t.Errorf("expected diff %d to be %+v, got %+v", i, expected[i], diffs[i])
+		}
+	}
+}
@@ -7,14 +7,17 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"os"
 	"strings"
 	"time"
 
 	"github.com/hashicorp/consul/api"
 
+	"github.com/square/p2/pkg/audit"
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/manifest"
 	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/store/consul/auditlogstore"
 	"github.com/square/p2/pkg/store/consul/consulutil"
 	"github.com/square/p2/pkg/store/consul/podstore"
 	"github.com/square/p2/pkg/store/consul/statusstore"
@@ -106,6 +109,22 @@ type consulStore struct {
 	// The /reality tree can now contain pods that have UUID keys, which
 	// means the reality manifest must be fetched from the pod status store
 	podStatusStore PodStatusStore
+
+	// Receives an event after each store operation. Shared by every copy
+	// of the store. See On()
+	*EventEmitter
+
+	// 1 if the last background ping succeeded, 0 if it failed. Nil unless
+	// Options.HealthCheckInterval was set. See Healthy()
+	healthy *int32
+
+	// Shared by every copy of the store so that all notifiers use the
+	// same watch. See RegisterChangeNotifier()
+	changeNotifier *changeNotifier
+
+	// Records an audit log for every change to the intent tree. Nil
+	// unless the store was returned by AuditIntent()
+	intentAuditor *intentAuditor
 }
 
 func NewConsulStore(client consulutil.ConsulClient) *consulStore {
@@ -116,10 +135,45 @@ func NewConsulStore(client consulutil.ConsulClient) *consulStore {
 		client:         client,
 		podStore:       podStore,
 		podStatusStore: podStatusStore,
+		changeNotifier: newChangeNotifier(client.KV()),
+		EventEmitter:   NewEventEmitter(),
+	}
+}
+
+// NewConsulStoreFromOptions creates a consul client from opts and returns a
+// store that uses it. See NewConsulStoreWithOptions().
+func NewConsulStoreFromOptions(opts Options) *consulStore {
+	return NewConsulStoreWithOptions(NewConsulClient(opts), opts)
+}
+
+// NewConsulStoreWithOptions returns a store that uses client, for callers that
+// share the client with other stores. It reports latency to
+// opts.ObserveLatency if it is set, monitors consul's health if
+// opts.HealthCheckInterval is set, and audits changes to the intent tree if
+// opts.AuditUser is set. The client's own options are ignored.
+func NewConsulStoreWithOptions(client consulutil.ConsulClient, opts Options) *consulStore {
+	store := NewConsulStore(client)
+	if opts.AuditUser != "" {
+		hostname := opts.AuditHostname
+		if hostname == "" {
+			hostname, _ = os.Hostname()
+		}
+		store = store.AuditIntent(auditlogstore.NewConsulStore(client.KV()), opts.AuditUser, hostname)
+	}
+	if opts.ObserveLatency != nil {
+		store.On(func(event StoreEvent) {
+			opts.ObserveLatency(event.Method, event.Duration, event.Error)
+		})
+	}
+	if opts.HealthCheckInterval > 0 {
+		store.monitorHealth(opts.HealthCheckInterval)
 	}
+	return store
 }
 
-func (c consulStore) PutHealth(res WatchResult) (time.Time, time.Duration, error) {
+func (c consulStore) PutHealth(res WatchResult) (_ time.Time, _ time.Duration, err error) {
+	defer c.emit("PutHealth", HealthPath(res.Service, res.Node), time.Now(), &err)
+
 	key := HealthPath(res.Service, res.Node)
 
 	now := time.Now()
@@ -145,7 +199,9 @@ func (c consulStore) PutHealth(res WatchResult) (time.Time, time.Duration, error
 	return now, retDur, nil
 }
 
-func (c consulStore) GetHealth(service string, node types.NodeName) (WatchResult, error) {
+func (c consulStore) GetHealth(service string, node types.NodeName) (_ WatchResult, err error) {
+	defer c.emit("GetHealth", HealthPath(service, node), time.Now(), &err)
+
 	healthRes := &WatchResult{}
 	key := HealthPath(service, node)
 	res, _, err := c.client.KV().Get(key, nil)
@@ -164,7 +220,9 @@ func (c consulStore) GetHealth(service string, node types.NodeName) (WatchResult
 	return *healthRes, nil
 }
 
-func (c consulStore) GetServiceHealth(service string) (map[string]WatchResult, error) {
+func (c consulStore) GetServiceHealth(service string) (_ map[string]WatchResult, err error) {
+	defer c.emit("GetServiceHealth", HealthPath(service, "/"), time.Now(), &err)
+
 	healthRes := make(map[string]WatchResult)
 	key := HealthPath(service, "/")
 	res, _, err := c.client.KV().List(key, nil)
@@ -186,21 +244,32 @@ func (c consulStore) GetServiceHealth(service string) (map[string]WatchResult, e
 	return healthRes, nil
 }
 
-// SetPod writes a pod manifest into the consul key-value store.
-func (c consulStore) SetPod(podPrefix PodPrefix, nodename types.NodeName, manifest manifest.Manifest) (time.Duration, error) {
+// SetPod writes a pod manifest into the consul key-value store. The manifest
+// is written as is, including its template_vars, since the preparer renders
+// them at deploy time.
+func (c consulStore) SetPod(podPrefix PodPrefix, nodename types.NodeName, manifest manifest.Manifest) (_ time.Duration, err error) {
+	defer c.emit("SetPod", eventPath(PodPathForManifest(podPrefix, nodename, manifest)), time.Now(), &err)
+
+	if c.auditsIntent(podPrefix) {
+		return c.commitTxn(func(ctx context.Context) error {
+			return c.setPodTxn(ctx, podPrefix, nodename, manifest)
+		})
+	}
+
 	buf := bytes.Buffer{}
-	err := manifest.Write(&buf)
+	err = manifest.Write(&buf)
 	if err != nil {
 		return 0, err
 	}
 
-	key, err := PodPath(podPrefix, nodename, manifest.ID())
+	key, err := PodPathForManifest(podPrefix, nodename, manifest)
 	if err != nil {
 		return 0, err
 	}
 	keyPair := &api.KVPair{
 		Key:   key,
 		Value: buf.Bytes(),
+		Flags: modifiedAtFlags(time.Now()),
 	}
 
 	writeMeta, err := c.client.KV().Put(keyPair, nil)
@@ -214,49 +283,128 @@ func (c consulStore) SetPod(podPrefix PodPrefix, nodename types.NodeName, manife
 	return retDur, nil
 }
 
-func (c consulStore) SetPodTxn(ctx context.Context, podPrefix PodPrefix, nodename types.NodeName, manifest manifest.Manifest) error {
+func (c consulStore) SetPodTxn(ctx context.Context, podPrefix PodPrefix, nodename types.NodeName, manifest manifest.Manifest) (err error) {
+	defer c.emit("SetPodTxn", eventPath(PodPathForManifest(podPrefix, nodename, manifest)), time.Now(), &err)
+
+	return c.setPodTxn(ctx, podPrefix, nodename, manifest)
+}
+
+func (c consulStore) setPodTxn(ctx context.Context, podPrefix PodPrefix, nodename types.NodeName, manifest manifest.Manifest) error {
 	manifestBytes, err := manifest.Marshal()
 	if err != nil {
 		return err
 	}
 
-	key, err := PodPath(podPrefix, nodename, manifest.ID())
+	key, err := PodPathForManifest(podPrefix, nodename, manifest)
 	if err != nil {
 		return err
 	}
 
-	return transaction.Add(ctx, api.KVTxnOp{
+	err = transaction.Add(ctx, api.KVTxnOp{
 		Verb:  string(api.KVSet),
 		Key:   key,
 		Value: manifestBytes,
+		Flags: modifiedAtFlags(time.Now()),
 	})
-}
+	if err != nil || !c.auditsIntent(podPrefix) {
+		return err
+	}
 
-// DeletePod deletes a pod manifest from the key-value store. No error will be
-// returned if the key didn't exist.
-func (c consulStore) DeletePod(podPrefix PodPrefix, nodename types.NodeName, podId types.PodID) (time.Duration, error) {
-	key, err := PodPath(podPrefix, nodename, podId)
+	sha, err := manifest.SHA()
 	if err != nil {
-		return 0, err
+		return err
 	}
+	return c.auditPodTxn(ctx, audit.PodScheduledEvent, nodename, manifest.ID(), sha)
+}
+
+// SetManyNodes writes the same manifest to every node, using as few consul
+// transactions as possible. Each transaction holds at most
+// transaction.MaxOperations writes and is all-or-nothing, but the
+// transactions are committed one after another: if one fails, the nodes in
+// earlier transactions will already have been written.
+func (c consulStore) SetManyNodes(podPrefix PodPrefix, nodes []types.NodeName, manifest manifest.Manifest) (_ time.Duration, err error) {
+	defer c.emit("SetManyNodes", "", time.Now(), &err)
+
+	return c.setManyNodes(c.client.KV(), podPrefix, nodes, manifest)
+}
 
-	writeMeta, err := c.client.KV().Delete(key, nil)
+func (c consulStore) setManyNodes(txner transaction.Txner, podPrefix PodPrefix, nodes []types.NodeName, manifest manifest.Manifest) (time.Duration, error) {
+	start := time.Now()
+	for len(nodes) > 0 {
+		batch := nodes
+		if len(batch) > c.MaxTxnPodWrites(podPrefix) {
+			batch = nodes[:c.MaxTxnPodWrites(podPrefix)]
+		}
+		nodes = nodes[len(batch):]
+
+		err := c.setNodesTxn(txner, podPrefix, batch, manifest)
+		if err != nil {
+			return time.Since(start), err
+		}
+	}
+	return time.Since(start), nil
+}
+
+func (c consulStore) setNodesTxn(txner transaction.Txner, podPrefix PodPrefix, nodes []types.NodeName, manifest manifest.Manifest) error {
+	ctx, cancel := transaction.New(context.Background())
+	defer cancel()
+	for _, node := range nodes {
+		err := c.setPodTxn(ctx, podPrefix, node, manifest)
+		if err != nil {
+			return util.Errorf("Could not add %s on %s to transaction: %s", manifest.ID(), node, err)
+		}
+	}
+
+	err := transaction.MustCommit(ctx, txner)
 	if err != nil {
-		return 0, consulutil.NewKVError("delete", key, err)
+		return util.Errorf("Could not write %s to %s through %s: %s", manifest.ID(), nodes[0], nodes[len(nodes)-1], err)
 	}
-	return writeMeta.RequestTime, nil
+	return nil
 }
 
-func (c consulStore) DeletePodTxn(ctx context.Context, podPrefix PodPrefix, nodename types.NodeName, podId types.PodID) error {
+// DeletePod deletes a pod manifest, and its scheduling metadata, from the
+// key-value store. No error will be returned if the key didn't exist.
+func (c consulStore) DeletePod(podPrefix PodPrefix, nodename types.NodeName, podId types.PodID) (_ time.Duration, err error) {
+	defer c.emit("DeletePod", eventPath(PodPath(podPrefix, nodename, podId)), time.Now(), &err)
+
+	return c.commitTxn(func(ctx context.Context) error {
+		return c.deletePodTxn(ctx, podPrefix, nodename, podId)
+	})
+}
+
+func (c consulStore) DeletePodTxn(ctx context.Context, podPrefix PodPrefix, nodename types.NodeName, podId types.PodID) (err error) {
+	defer c.emit("DeletePodTxn", eventPath(PodPath(podPrefix, nodename, podId)), time.Now(), &err)
+
+	return c.deletePodTxn(ctx, podPrefix, nodename, podId)
+}
+
+func (c consulStore) deletePodTxn(ctx context.Context, podPrefix PodPrefix, nodename types.NodeName, podId types.PodID) error {
 	key, err := PodPath(podPrefix, nodename, podId)
 	if err != nil {
 		return err
 	}
 
-	return transaction.Add(ctx, api.KVTxnOp{
+	err = transaction.Add(ctx, api.KVTxnOp{
 		Verb: api.KVDelete,
 		Key:  key,
 	})
+	if err != nil {
+		return err
+	}
+
+	// Otherwise ListPodsByTag would still find the pod
+	metadataKey, err := SchedulingMetadataPath(podPrefix, nodename, podId)
+	if err != nil {
+		return err
+	}
+	err = transaction.Add(ctx, api.KVTxnOp{
+		Verb: api.KVDelete,
+		Key:  metadataKey,
+	})
+	if err != nil || !c.auditsIntent(podPrefix) {
+		return err
+	}
+	return c.auditPodTxn(ctx, audit.PodUnscheduledEvent, nodename, podId, "")
 }
 
 // MutatePod mutates the input context in such a way
@@ -268,7 +416,9 @@ func (c consulStore) MutatePod(
 	nodes []types.NodeName,
 	podID types.PodID,
 	mutate func(manifest.Manifest) (manifest.Manifest, error),
-) error {
+) (err error) {
+	defer c.emit("MutatePod", "", time.Now(), &err)
+
 	for _, node := range nodes {
 		path, err := PodPath(INTENT_TREE, node, podID)
 		if err != nil {
@@ -302,11 +452,23 @@ func (c consulStore) MutatePod(
 			Verb:  api.KVCAS,
 			Key:   path,
 			Value: bytes,
+			Flags: modifiedAtFlags(time.Now()),
 			Index: queryMeta.LastIndex,
 		})
 		if err != nil {
 			return util.Errorf("can't add mutated %s to transaction: %s", path, err)
 		}
+
+		if c.auditsIntent(INTENT_TREE) {
+			sha, err := mutated.SHA()
+			if err != nil {
+				return util.Errorf("can't compute SHA of mutated %s: %s", path, err)
+			}
+			err = c.auditPodTxn(ctx, audit.PodScheduledEvent, node, podID, sha)
+			if err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
@@ -315,7 +477,9 @@ func (c consulStore) MutatePod(
 // Pod reads a pod manifest from the key-value store. If the given key does not
 // exist, a nil *PodManifest will be returned, along with a pods.NoCurrentManifest
 // error.
-func (c consulStore) Pod(podPrefix PodPrefix, nodename types.NodeName, podId types.PodID) (manifest.Manifest, time.Duration, error) {
+func (c consulStore) Pod(podPrefix PodPrefix, nodename types.NodeName, podId types.PodID) (_ manifest.Manifest, _ time.Duration, err error) {
+	defer c.emit("Pod", eventPath(PodPath(podPrefix, nodename, podId)), time.Now(), &err)
+
 	key, err := PodPath(podPrefix, nodename, podId)
 	if err != nil {
 		return nil, 0, err
@@ -332,12 +496,39 @@ func (c consulStore) Pod(podPrefix PodPrefix, nodename types.NodeName, podId typ
 	return manifest, writeMeta.RequestTime, err
 }
 
+// PodExists reports whether a pod manifest is stored for the given pod. Only
+// keys are requested from consul, so unlike Pod() the manifest is neither
+// transferred nor decoded.
+func (c consulStore) PodExists(podPrefix PodPrefix, nodename types.NodeName, podId types.PodID) (_ bool, _ time.Duration, err error) {
+	defer c.emit("PodExists", eventPath(PodPath(podPrefix, nodename, podId)), time.Now(), &err)
+
+	key, err := PodPath(podPrefix, nodename, podId)
+	if err != nil {
+		return false, 0, err
+	}
+
+	// Keys() matches by prefix, so e.g. the pod "foo" also matches
+	// "foo-bar"
+	keys, queryMeta, err := c.client.KV().Keys(key, "", nil)
+	if err != nil {
+		return false, 0, consulutil.NewKVError("keys", key, err)
+	}
+	for _, k := range keys {
+		if k == key {
+			return true, queryMeta.RequestTime, nil
+		}
+	}
+	return false, queryMeta.RequestTime, nil
+}
+
 // ListPods reads all the pod manifests from the key-value store for a
 // specified host under a given tree. In the event of an error, the nil slice
 // is returned.
 //
 // All the values under the given path must be pod manifests.
-func (c consulStore) ListPods(podPrefix PodPrefix, nodename types.NodeName) ([]ManifestResult, time.Duration, error) {
+func (c consulStore) ListPods(podPrefix PodPrefix, nodename types.NodeName) (_ []ManifestResult, _ time.Duration, err error) {
+	defer c.emit("ListPods", eventPath(nodePath(podPrefix, nodename)), time.Now(), &err)
+
 	keyPrefix, err := nodePath(podPrefix, nodename)
 	if err != nil {
 		return nil, 0, err
@@ -347,7 +538,9 @@ func (c consulStore) ListPods(podPrefix PodPrefix, nodename types.NodeName) ([]M
 }
 
 // Lists all pods under a tree regardless of node name
-func (c consulStore) AllPods(podPrefix PodPrefix) ([]ManifestResult, time.Duration, error) {
+func (c consulStore) AllPods(podPrefix PodPrefix) (_ []ManifestResult, _ time.Duration, err error) {
+	defer c.emit("AllPods", podPrefix.String(), time.Now(), &err)
+
 	keyPrefix := string(podPrefix) + "/"
 	return c.listPods(keyPrefix)
 }
@@ -467,7 +660,10 @@ func (c consulStore) WatchPods(
 	}
 }
 
-// Does the same thing as WatchPods, but does so on all the nodes instead
+// WatchAllPods is like WatchPods, but watches every node under the given tree,
+// e.g. all of intent/ or reality/. Changes are found with consul blocking
+// queries rather than polling; pauseTime is the least time between two
+// queries (at least 250ms), which bounds the load a busy tree puts on consul.
 func (c consulStore) WatchAllPods(
 	podPrefix PodPrefix,
 	quitChan <-chan struct{},
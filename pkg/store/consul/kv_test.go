@@ -101,6 +101,11 @@ func TestMutate(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	written, _, err := f.Store.GetPodModifyTime(INTENT_TREE, "node1", "pod")
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	ctx, cancel := transaction.New(context.Background())
 	defer cancel()
 
@@ -131,6 +136,14 @@ func TestMutate(t *testing.T) {
 			t.Fatalf("Expected mutated manifest to have status port 1000. Manifest: %s", marshaled)
 		}
 	}
+
+	mutated, _, err := f.Store.GetPodModifyTime(INTENT_TREE, "node1", "pod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !mutated.After(written) {
+		t.Errorf("Expected the mutation to update the modify time from %s, got %s", written, mutated)
+	}
 }
 
 func TestMutateError(t *testing.T) {
@@ -357,6 +370,29 @@ func TestAllPods(t *testing.T) {
 	}
 }
 
+func TestSetPodKeepsTemplateVars(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+
+	// the preparer renders template_vars at deploy time, so they must be
+	// written to the intent tree as scheduled
+	builder := testManifest("some_pod").GetBuilder()
+	builder.SetTemplateVars(map[string]string{"LOCAL_IP": "127.0.0.1"})
+	templated := builder.GetManifest()
+
+	_, err := f.Store.SetPod(INTENT_TREE, "some_node", templated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	written, _, err := f.Store.Pod(INTENT_TREE, "some_node", "some_pod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written.GetTemplateVars()["LOCAL_IP"] != "127.0.0.1" {
+		t.Errorf("expected the written manifest to keep its template_vars, got %v", written.GetTemplateVars())
+	}
+}
+
 func TestSetPodTxn(t *testing.T) {
 	f := NewConsulTestFixture(t)
 	defer f.Close()
@@ -0,0 +1,101 @@
+package consul
+
+import (
+	"time"
+
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/util"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// LockHandle represents a lock acquired with Lock() or TryLock(). Each handle
+// owns a consul session that is never renewed, so if the holder dies without
+// calling Unlock() the lock is released once the session's TTL expires.
+type LockHandle struct {
+	client   consulutil.ConsulClient
+	session  string
+	unlocker Unlocker
+}
+
+// Lock blocks until it acquires the lock on path. The lock lasts for at most
+// ttl, which consul requires to be between 10s and 24h.
+func (c consulStore) Lock(path string, ttl time.Duration) (LockHandle, error) {
+	for {
+		handle, acquired, err := c.TryLock(path, ttl)
+		if err != nil {
+			return LockHandle{}, err
+		}
+		if acquired {
+			return handle, nil
+		}
+
+		// Wait for the holder to release the lock (which deletes the
+		// key) before trying again
+		err = c.waitForLockRelease(path)
+		if err != nil {
+			return LockHandle{}, err
+		}
+	}
+}
+
+// TryLock attempts to acquire the lock on path without blocking. The boolean
+// return is false if another session holds the lock.
+func (c consulStore) TryLock(path string, ttl time.Duration) (LockHandle, bool, error) {
+	sessionID, _, err := c.client.Session().CreateNoChecks(&api.SessionEntry{
+		Name:      "p2-lock:" + path,
+		LockDelay: lockDelay,
+		// locks should only be used with ephemeral keys
+		Behavior: api.SessionBehaviorDelete,
+		TTL:      ttl.String(),
+	}, nil)
+	if err != nil {
+		return LockHandle{}, false, util.Errorf("Could not create session to lock %s: %s", path, err)
+	}
+
+	unlocker, err := NewUnmanagedSession(c.client, sessionID, path).Lock(path)
+	if err != nil {
+		_, _ = c.client.Session().Destroy(sessionID, nil)
+		if _, ok := err.(AlreadyLockedError); ok {
+			return LockHandle{}, false, nil
+		}
+		return LockHandle{}, false, err
+	}
+
+	return LockHandle{
+		client:   c.client,
+		session:  sessionID,
+		unlocker: unlocker,
+	}, true, nil
+}
+
+func (c consulStore) waitForLockRelease(path string) error {
+	kvp, meta, err := c.client.KV().Get(path, nil)
+	if err != nil {
+		return consulutil.NewKVError("get", path, err)
+	}
+	if kvp == nil || kvp.Session == "" {
+		return nil
+	}
+
+	_, _, err = c.client.KV().Get(path, &api.QueryOptions{WaitIndex: meta.LastIndex})
+	if err != nil {
+		return consulutil.NewKVError("get", path, err)
+	}
+	return nil
+}
+
+// Unlock releases the lock and destroys its session. It returns an
+// AlreadyLockedError if the lock had already expired and was acquired by
+// someone else.
+func (h LockHandle) Unlock() error {
+	err := h.unlocker.Unlock()
+	_, destroyErr := h.client.Session().Destroy(h.session, nil)
+	if err != nil {
+		return err
+	}
+	if destroyErr != nil {
+		return util.Errorf("Could not destroy session for lock %s: %s", h.unlocker.Key(), destroyErr)
+	}
+	return nil
+}
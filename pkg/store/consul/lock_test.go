@@ -0,0 +1,82 @@
+// +build !race
+
+package consul
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTryLock(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+
+	handle, acquired, err := f.Store.TryLock("lock/foo", 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !acquired {
+		t.Fatal("expected to acquire an unheld lock")
+	}
+
+	_, acquired, err = f.Store.TryLock("lock/foo", 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acquired {
+		t.Fatal("expected not to acquire a held lock")
+	}
+
+	err = handle.Unlock()
+	if err != nil {
+		t.Fatalf("could not unlock: %s", err)
+	}
+
+	handle, acquired, err = f.Store.TryLock("lock/foo", 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !acquired {
+		t.Fatal("expected to acquire a lock after it was released")
+	}
+	_ = handle.Unlock()
+}
+
+func TestLockIsExclusive(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+
+	var holders int32
+	var wg sync.WaitGroup
+	errCh := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handle, err := f.Store.Lock("lock/foo", 10*time.Second)
+			if err != nil {
+				errCh <- err
+				return
+			}
+
+			if n := atomic.AddInt32(&holders, 1); n != 1 {
+				t.Errorf("expected one lock holder, found %d", n)
+			}
+			time.Sleep(100 * time.Millisecond)
+			atomic.AddInt32(&holders, -1)
+
+			err = handle.Unlock()
+			if err != nil {
+				errCh <- err
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errCh)
+	for err := range errCh {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,72 @@
+package consul
+
+import (
+	"encoding/json"
+	"errors"
+	"path"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+	"github.com/square/p2/pkg/util/size"
+)
+
+// NoNodeCapacity is returned by NodeCapacity when the node hasn't advertised
+// its capacity.
+var NoNodeCapacity error = errors.New("The node has not advertised its capacity")
+
+// NodeCapacity is the resources a node offers to the pods scheduled on it,
+// compared against the totals of their cgroup limits. A zero field is not
+// limited.
+type NodeCapacity struct {
+	CPUs   int            `json:"cpus,omitempty" yaml:"cpus,omitempty"`
+	Memory size.ByteCount `json:"memory,omitempty" yaml:"memory,omitempty"`
+	Pids   int            `json:"pids,omitempty" yaml:"pids,omitempty"`
+}
+
+// NodeCapacityPath returns the consul path of a node's capacity, e.g.
+// node_capacity/some_host
+func NodeCapacityPath(nodeName types.NodeName) string {
+	return path.Join(NODE_CAPACITY_TREE, nodeName.String())
+}
+
+// SetNodeCapacity advertises the capacity of a node.
+func (c consulStore) SetNodeCapacity(nodename types.NodeName, capacity NodeCapacity) (err error) {
+	key := NodeCapacityPath(nodename)
+	defer c.emit("SetNodeCapacity", key, time.Now(), &err)
+
+	data, err := json.Marshal(capacity)
+	if err != nil {
+		return util.Errorf("could not marshal node capacity for %s: %s", key, err)
+	}
+
+	_, err = c.client.KV().Put(&api.KVPair{Key: key, Value: data}, nil)
+	if err != nil {
+		return consulutil.NewKVError("put", key, err)
+	}
+	return nil
+}
+
+// NodeCapacity returns the capacity a node has advertised, or NoNodeCapacity.
+func (c consulStore) NodeCapacity(nodename types.NodeName) (_ NodeCapacity, err error) {
+	key := NodeCapacityPath(nodename)
+	defer c.emit("NodeCapacity", key, time.Now(), &err)
+
+	pair, _, err := c.client.KV().Get(key, nil)
+	if err != nil {
+		return NodeCapacity{}, consulutil.NewKVError("get", key, err)
+	}
+	if pair == nil {
+		return NodeCapacity{}, NoNodeCapacity
+	}
+
+	var capacity NodeCapacity
+	err = json.Unmarshal(pair.Value, &capacity)
+	if err != nil {
+		return NodeCapacity{}, util.Errorf("could not unmarshal node capacity at %s: %s", key, err)
+	}
+	return capacity, nil
+}
@@ -0,0 +1,33 @@
+// +build !race
+
+package consul
+
+import (
+	"testing"
+
+	"github.com/square/p2/pkg/util/size"
+)
+
+func TestNodeCapacity(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+
+	_, err := f.Store.NodeCapacity("node1")
+	if err != NoNodeCapacity {
+		t.Fatalf("expected NoNodeCapacity before the capacity was set, got %v", err)
+	}
+
+	capacity := NodeCapacity{CPUs: 8, Memory: 16 * size.Gibibyte}
+	err = f.Store.SetNodeCapacity("node1", capacity)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := f.Store.NodeCapacity("node1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored != capacity {
+		t.Errorf("expected capacity %+v, got %+v", capacity, stored)
+	}
+}
@@ -0,0 +1,190 @@
+package consul
+
+import (
+	"sync"
+
+	"github.com/square/p2/pkg/store/consul/consulutil"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// PathFilter selects the consul keys a change notifier is interested in.
+type PathFilter func(path string) bool
+
+type ChangeType string
+
+const (
+	ChangeCreated ChangeType = "created"
+	ChangeUpdated ChangeType = "updated"
+	ChangeDeleted ChangeType = "deleted"
+)
+
+// ChangeNotification describes a single key in the pod trees that changed.
+type ChangeNotification struct {
+	Path string
+	Type ChangeType
+	// The new value of the key, or the last value seen if it was deleted
+	Value []byte
+}
+
+// The trees watched for changes by RegisterChangeNotifier()
+var changeNotifierPrefixes = []PodPrefix{INTENT_TREE, REALITY_TREE}
+
+type changeRegistration struct {
+	filter PathFilter
+	ch     chan<- ChangeNotification
+	// closed when the registration is removed, so that a send to a
+	// notifier that stopped reading does not block forever
+	done chan struct{}
+}
+
+// changeNotifier shares a single watch of the pod trees between every
+// registered notifier. The watch runs only while there is at least one.
+type changeNotifier struct {
+	kv consulutil.ConsulLister
+
+	mu            sync.Mutex
+	registrations map[*changeRegistration]struct{}
+	quit          chan struct{}
+}
+
+func newChangeNotifier(kv consulutil.ConsulLister) *changeNotifier {
+	return &changeNotifier{
+		kv:            kv,
+		registrations: make(map[*changeRegistration]struct{}),
+	}
+}
+
+// RegisterChangeNotifier sends a notification on ch for every key in the
+// intent and reality trees that is created, updated or deleted and matches
+// filter. Keys that exist when the watch starts are not reported. Sends on ch
+// block, so ch should be read promptly; a slow reader delays notifications to
+// every other notifier.
+//
+// Call the returned function to stop notifications. ch is not closed.
+func (c consulStore) RegisterChangeNotifier(filter PathFilter, ch chan<- ChangeNotification) (func(), error) {
+	if filter == nil {
+		filter = func(string) bool { return true }
+	}
+	reg := &changeRegistration{
+		filter: filter,
+		ch:     ch,
+		done:   make(chan struct{}),
+	}
+	c.changeNotifier.register(reg)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { c.changeNotifier.deregister(reg) })
+	}, nil
+}
+
+func (n *changeNotifier) register(reg *changeRegistration) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.registrations[reg] = struct{}{}
+	if n.quit == nil {
+		n.quit = make(chan struct{})
+		go n.watch(n.quit)
+	}
+}
+
+func (n *changeNotifier) deregister(reg *changeRegistration) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	delete(n.registrations, reg)
+	close(reg.done)
+	if len(n.registrations) == 0 && n.quit != nil {
+		close(n.quit)
+		n.quit = nil
+	}
+}
+
+func (n *changeNotifier) watch(quit chan struct{}) {
+	type diff struct {
+		changes *consulutil.WatchedChanges
+		initial bool
+	}
+	diffs := make(chan diff)
+	var wg sync.WaitGroup
+	for _, prefix := range changeNotifierPrefixes {
+		changesCh, errCh := consulutil.WatchDiff(prefix.String(), n.kv, quit)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			initial := true
+			for {
+				select {
+				case changes, ok := <-changesCh:
+					if !ok {
+						return
+					}
+					select {
+					case diffs <- diff{changes, initial}:
+					case <-quit:
+						return
+					}
+					initial = false
+				case _, ok := <-errCh:
+					// WatchDiff retries on its own
+					if !ok {
+						return
+					}
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(diffs)
+	}()
+
+	for d := range diffs {
+		if d.initial {
+			// the first listing reports every existing key as created
+			continue
+		}
+		select {
+		case <-quit:
+			// every notifier was deregistered, a new watch may already
+			// be notifying any that registered since
+			continue
+		default:
+		}
+		n.notify(d.changes.Created, ChangeCreated)
+		n.notify(d.changes.Updated, ChangeUpdated)
+		n.notify(d.changes.Deleted, ChangeDeleted)
+	}
+}
+
+func (n *changeNotifier) notify(pairs api.KVPairs, changeType ChangeType) {
+	if len(pairs) == 0 {
+		return
+	}
+
+	n.mu.Lock()
+	registrations := make([]*changeRegistration, 0, len(n.registrations))
+	for reg := range n.registrations {
+		registrations = append(registrations, reg)
+	}
+	n.mu.Unlock()
+
+	for _, pair := range pairs {
+		notification := ChangeNotification{
+			Path:  pair.Key,
+			Type:  changeType,
+			Value: pair.Value,
+		}
+		for _, reg := range registrations {
+			if !reg.filter(pair.Key) {
+				continue
+			}
+			select {
+			case reg.ch <- notification:
+			case <-reg.done:
+			}
+		}
+	}
+}
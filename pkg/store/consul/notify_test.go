@@ -0,0 +1,104 @@
+package consul
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/types"
+)
+
+func TestRegisterChangeNotifierFiltersEvents(t *testing.T) {
+	store := NewConsulStore(consulutil.NewFakeClient())
+
+	node1Ch := make(chan ChangeNotification, 10)
+	deregister1, err := store.RegisterChangeNotifier(func(path string) bool {
+		return strings.HasPrefix(path, "intent/node1/")
+	}, node1Ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer deregister1()
+
+	node2Ch := make(chan ChangeNotification, 10)
+	deregister2, err := store.RegisterChangeNotifier(func(path string) bool {
+		return strings.HasPrefix(path, "intent/node2/")
+	}, node2Ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer deregister2()
+
+	// Let the watch make its initial listing, which is not reported
+	time.Sleep(100 * time.Millisecond)
+
+	builder := manifest.NewBuilder()
+	builder.SetID("foo")
+	for _, node := range []types.NodeName{"node1", "node2"} {
+		_, err = store.SetPod(INTENT_TREE, node, builder.GetManifest())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expectNotification(t, node1Ch, "intent/node1/foo")
+	expectNotification(t, node2Ch, "intent/node2/foo")
+
+	// Neither notifier should have received the other's change
+	select {
+	case n := <-node1Ch:
+		t.Errorf("unexpected notification for the node1 notifier: %+v", n)
+	case n := <-node2Ch:
+		t.Errorf("unexpected notification for the node2 notifier: %+v", n)
+	case <-time.After(500 * time.Millisecond):
+	}
+}
+
+func TestDeregisterChangeNotifierStopsNotifications(t *testing.T) {
+	store := NewConsulStore(consulutil.NewFakeClient())
+
+	ch := make(chan ChangeNotification)
+	deregister, err := store.RegisterChangeNotifier(nil, ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	builder := manifest.NewBuilder()
+	builder.SetID("foo")
+	_, err = store.SetPod(INTENT_TREE, "node1", builder.GetManifest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectNotification(t, ch, "intent/node1/foo")
+
+	deregister()
+	// calling it again is harmless
+	deregister()
+
+	_, err = store.SetPod(INTENT_TREE, "node2", builder.GetManifest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case n := <-ch:
+		t.Errorf("unexpected notification after deregistering: %+v", n)
+	case <-time.After(500 * time.Millisecond):
+	}
+}
+
+func expectNotification(t *testing.T, ch <-chan ChangeNotification, path string) {
+	select {
+	case n := <-ch:
+		if n.Path != path {
+			t.Errorf("expected a notification for %s, got %s", path, n.Path)
+		}
+		if n.Type != ChangeCreated {
+			t.Errorf("expected %s to be created, got %s", path, n.Type)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timed out waiting for a notification for %s", path)
+	}
+}
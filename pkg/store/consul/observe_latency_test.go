@@ -0,0 +1,75 @@
+package consul
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+)
+
+type observation struct {
+	method   string
+	duration time.Duration
+	err      error
+}
+
+func TestObserveLatencyIsCalledForSetPod(t *testing.T) {
+	var observed []observation
+	store := NewConsulStore(consulutil.NewFakeClient())
+	store.On(func(event StoreEvent) {
+		observed = append(observed, observation{event.Method, event.Duration, event.Error})
+	})
+
+	builder := manifest.NewBuilder()
+	builder.SetID("foo")
+	_, err := store.SetPod(INTENT_TREE, "node1", builder.GetManifest())
+	if err != nil {
+		t.Fatalf("Unexpected error setting pod: %s", err)
+	}
+
+	if len(observed) != 1 {
+		t.Fatalf("Expected 1 observation, got %d: %+v", len(observed), observed)
+	}
+	if observed[0].method != "SetPod" {
+		t.Errorf("Expected method to be SetPod, was %s", observed[0].method)
+	}
+	if observed[0].err != nil {
+		t.Errorf("Expected a nil error, got %s", observed[0].err)
+	}
+	if observed[0].duration < 0 {
+		t.Errorf("Expected a non-negative duration, got %s", observed[0].duration)
+	}
+}
+
+func TestObserveLatencyReceivesErrors(t *testing.T) {
+	var observed []observation
+	store := NewConsulStore(consulutil.NewFakeClient())
+	store.On(func(event StoreEvent) {
+		observed = append(observed, observation{event.Method, event.Duration, event.Error})
+	})
+
+	// An empty node name is not a valid pod path
+	builder := manifest.NewBuilder()
+	builder.SetID("foo")
+	_, err := store.SetPod(INTENT_TREE, "", builder.GetManifest())
+	if err == nil {
+		t.Fatal("Expected an error setting a pod without a node")
+	}
+
+	if len(observed) != 1 || observed[0].err != err {
+		t.Errorf("Expected the observer to receive the returned error, got %+v", observed)
+	}
+}
+
+func TestNewConsulStoreFromOptionsSetsObserver(t *testing.T) {
+	called := false
+	store := NewConsulStoreFromOptions(Options{
+		ObserveLatency: func(string, time.Duration, error) { called = true },
+	})
+	var err error
+	store.emit("SetPod", "", time.Now(), &err)
+	if !called {
+		t.Error("Expected the observer from the options to be called")
+	}
+}
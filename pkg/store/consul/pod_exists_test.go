@@ -0,0 +1,63 @@
+package consul
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/types"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// keysOnlyKV fails any attempt to read a value, so that tests can be sure
+// only keys were requested
+type keysOnlyKV struct {
+	*consulutil.FakeKV
+}
+
+func (kv keysOnlyKV) Get(key string, q *api.QueryOptions) (*api.KVPair, *api.QueryMeta, error) {
+	return nil, nil, fmt.Errorf("unexpected Get of %s", key)
+}
+
+func (kv keysOnlyKV) List(prefix string, q *api.QueryOptions) (api.KVPairs, *api.QueryMeta, error) {
+	return nil, nil, fmt.Errorf("unexpected List of %s", prefix)
+}
+
+func TestPodExists(t *testing.T) {
+	key, err := PodPath(INTENT_TREE, "node1", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The value isn't a valid manifest, which PodExists shouldn't notice
+	kv := keysOnlyKV{consulutil.NewKVWithEntries(map[string]*api.KVPair{
+		key: {Key: key, Value: []byte("{not a manifest")},
+	})}
+	store := NewConsulStore(&consulutil.FakeConsulClient{KV_: kv})
+
+	exists, _, err := store.PodExists(INTENT_TREE, "node1", "foo")
+	if err != nil {
+		t.Fatalf("Unexpected error checking for an existing pod: %s", err)
+	}
+	if !exists {
+		t.Error("Expected foo to exist on node1")
+	}
+
+	for _, test := range []struct {
+		node types.NodeName
+		pod  types.PodID
+	}{
+		{"node1", "bar"},
+		{"node2", "foo"},
+		// a prefix of an existing pod's key
+		{"node1", "fo"},
+	} {
+		exists, _, err = store.PodExists(INTENT_TREE, test.node, test.pod)
+		if err != nil {
+			t.Fatalf("Unexpected error checking for %s on %s: %s", test.pod, test.node, err)
+		}
+		if exists {
+			t.Errorf("Expected %s not to exist on %s", test.pod, test.node)
+		}
+	}
+}
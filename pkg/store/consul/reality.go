@@ -0,0 +1,22 @@
+package consul
+
+import (
+	"time"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/types"
+)
+
+// SetRealityManifest records that the manifest is now running on the node,
+// i.e. it writes it to the reality tree. The preparer calls it once a legacy
+// pod has launched. Pods with a unique key record their reality in the pod
+// status store instead, see podstatus.PodStatus.
+func (c consulStore) SetRealityManifest(nodename types.NodeName, manifest manifest.Manifest) (time.Duration, error) {
+	return c.SetPod(REALITY_TREE, nodename, manifest)
+}
+
+// DeleteRealityManifest records that the pod is no longer running on the
+// node. No error will be returned if the pod wasn't in the reality tree.
+func (c consulStore) DeleteRealityManifest(nodename types.NodeName, podID types.PodID) (time.Duration, error) {
+	return c.DeletePod(REALITY_TREE, nodename, podID)
+}
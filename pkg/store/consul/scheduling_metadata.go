@@ -0,0 +1,137 @@
+package consul
+
+import (
+	"encoding/json"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// SchedulingMetadata records information about how a pod came to be scheduled.
+// It is written alongside a pod's intent, but in a separate tree so that the
+// intent tree only contains pod manifests.
+type SchedulingMetadata struct {
+	// Arbitrary key/value pairs, e.g. "release=2017-06-01", used to group
+	// related schedule operations
+	Tags map[string]string `json:"tags,omitempty"`
+
+	ScheduledAt time.Time `json:"scheduled_at"`
+
+	// Set when the pod was copied from another node with p2-clone
+	ClonedFrom types.NodeName `json:"cloned_from,omitempty"`
+}
+
+// SchedulingMetadataPath returns the consul path of the scheduling metadata
+// for a pod, e.g. scheduling_metadata/intent/some_host/some_pod
+func SchedulingMetadataPath(podPrefix PodPrefix, nodeName types.NodeName, podId types.PodID) (string, error) {
+	podPath, err := PodPath(podPrefix, nodeName, podId)
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(SCHEDULING_METADATA_TREE, podPath), nil
+}
+
+// SetSchedulingMetadata writes the scheduling metadata for a pod. It does not
+// check that the pod itself has been scheduled.
+func (c consulStore) SetSchedulingMetadata(podPrefix PodPrefix, nodename types.NodeName, podId types.PodID, metadata SchedulingMetadata) (_ time.Duration, err error) {
+	defer c.emit("SetSchedulingMetadata", eventPath(SchedulingMetadataPath(podPrefix, nodename, podId)), time.Now(), &err)
+
+	key, err := SchedulingMetadataPath(podPrefix, nodename, podId)
+	if err != nil {
+		return 0, err
+	}
+
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return 0, util.Errorf("could not marshal scheduling metadata for %s: %s", key, err)
+	}
+
+	writeMeta, err := c.client.KV().Put(&api.KVPair{Key: key, Value: data}, nil)
+	var retDur time.Duration
+	if writeMeta != nil {
+		retDur = writeMeta.RequestTime
+	}
+	if err != nil {
+		return retDur, consulutil.NewKVError("put", key, err)
+	}
+	return retDur, nil
+}
+
+// DeleteSchedulingMetadata deletes the scheduling metadata for a pod, e.g.
+// when it is rescheduled without tags. DeletePod deletes it along with the
+// pod. No error is returned if there was no metadata.
+func (c consulStore) DeleteSchedulingMetadata(podPrefix PodPrefix, nodename types.NodeName, podId types.PodID) (_ time.Duration, err error) {
+	defer c.emit("DeleteSchedulingMetadata", eventPath(SchedulingMetadataPath(podPrefix, nodename, podId)), time.Now(), &err)
+
+	key, err := SchedulingMetadataPath(podPrefix, nodename, podId)
+	if err != nil {
+		return 0, err
+	}
+
+	writeMeta, err := c.client.KV().Delete(key, nil)
+	var retDur time.Duration
+	if writeMeta != nil {
+		retDur = writeMeta.RequestTime
+	}
+	if err != nil {
+		return retDur, consulutil.NewKVError("delete", key, err)
+	}
+	return retDur, nil
+}
+
+// ListPodsByTag scans all scheduling metadata and returns the location of every
+// pod that was scheduled with the given tag.
+func (c consulStore) ListPodsByTag(key string, value string) (_ []types.PodLocation, err error) {
+	defer c.emit("ListPodsByTag", "", time.Now(), &err)
+
+	prefix := SCHEDULING_METADATA_TREE + "/"
+	pairs, _, err := c.client.KV().List(prefix, nil)
+	if err != nil {
+		return nil, consulutil.NewKVError("list", prefix, err)
+	}
+
+	var ret []types.PodLocation
+	for _, pair := range pairs {
+		var metadata SchedulingMetadata
+		err = json.Unmarshal(pair.Value, &metadata)
+		if err != nil {
+			return nil, util.Errorf("could not parse scheduling metadata at %s: %s", pair.Key, err)
+		}
+
+		if tagValue, ok := metadata.Tags[key]; !ok || tagValue != value {
+			continue
+		}
+
+		location, err := podLocationFromMetadataKey(pair.Key)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, location)
+	}
+
+	return ret, nil
+}
+
+// Converts scheduling_metadata/<prefix>/<node>/<pod_id> (or
+// scheduling_metadata/hooks/<pod_id>) into a pod location
+func podLocationFromMetadataKey(key string) (types.PodLocation, error) {
+	keyParts := strings.Split(strings.TrimPrefix(key, SCHEDULING_METADATA_TREE+"/"), "/")
+	switch {
+	case len(keyParts) == 2 && keyParts[0] == HOOK_TREE.String():
+		return types.PodLocation{PodID: types.PodID(keyParts[1])}, nil
+	case len(keyParts) == 3:
+		return types.PodLocation{
+			Node:  types.NodeName(keyParts[1]),
+			PodID: types.PodID(keyParts[2]),
+		}, nil
+	default:
+		return types.PodLocation{}, util.Errorf("Malformed scheduling metadata key '%s'", key)
+	}
+}
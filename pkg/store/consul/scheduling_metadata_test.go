@@ -0,0 +1,115 @@
+// +build !race
+
+package consul
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/square/p2/pkg/types"
+)
+
+func TestListPodsByTag(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+
+	tagged := SchedulingMetadata{Tags: map[string]string{"release": "x"}}
+	other := SchedulingMetadata{Tags: map[string]string{"release": "y"}}
+
+	_, err := f.Store.SetSchedulingMetadata(INTENT_TREE, "node1", "foo", tagged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Store.SetSchedulingMetadata(INTENT_TREE, "node2", "bar", tagged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Store.SetSchedulingMetadata(INTENT_TREE, "node3", "baz", other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	locations, err := f.Store.ListPodsByTag("release", "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locations) != 2 {
+		t.Fatalf("expected 2 pods tagged release=x, got %d: %v", len(locations), locations)
+	}
+
+	expected := map[types.PodLocation]bool{
+		{Node: "node1", PodID: "foo"}: true,
+		{Node: "node2", PodID: "bar"}: true,
+	}
+	for _, location := range locations {
+		if !expected[location] {
+			t.Errorf("unexpected pod location %v", location)
+		}
+	}
+}
+
+func TestDeletePodDeletesSchedulingMetadata(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+
+	tagged := SchedulingMetadata{Tags: map[string]string{"release": "x"}}
+	for _, node := range []types.NodeName{"node1", "node2"} {
+		_, err := f.Store.SetPod(INTENT_TREE, node, testManifest("foo"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = f.Store.SetSchedulingMetadata(INTENT_TREE, node, "foo", tagged)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := f.Store.DeletePod(INTENT_TREE, "node1", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	locations, err := f.Store.ListPodsByTag("release", "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []types.PodLocation{{Node: "node2", PodID: "foo"}}
+	if !reflect.DeepEqual(locations, expected) {
+		t.Errorf("expected only the pod that is still scheduled, got %v", locations)
+	}
+
+	_, err = f.Store.DeleteSchedulingMetadata(INTENT_TREE, "node2", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	locations, err = f.Store.ListPodsByTag("release", "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locations) != 0 {
+		t.Errorf("expected no tagged pods once the metadata was deleted, got %v", locations)
+	}
+}
+
+func TestPodLocationFromMetadataKey(t *testing.T) {
+	location, err := podLocationFromMetadataKey("scheduling_metadata/intent/node1/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location.Node != "node1" || location.PodID != "foo" {
+		t.Errorf("unexpected location %v", location)
+	}
+
+	location, err = podLocationFromMetadataKey("scheduling_metadata/hooks/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location.Node != "" || location.PodID != "foo" {
+		t.Errorf("unexpected hook location %v", location)
+	}
+
+	_, err = podLocationFromMetadataKey("scheduling_metadata/intent/foo")
+	if err == nil {
+		t.Error("expected an error for a malformed key")
+	}
+}
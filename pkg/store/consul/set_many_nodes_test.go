@@ -0,0 +1,105 @@
+// +build !race
+
+package consul
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul/transaction"
+	"github.com/square/p2/pkg/types"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// countingTxner counts transactions, and makes the transaction with index
+// failOn (if non-negative) fail by adding an operation that can't succeed
+type countingTxner struct {
+	txner  transaction.Txner
+	count  int
+	failOn int
+}
+
+func (c *countingTxner) Txn(txn api.KVTxnOps, q *api.QueryOptions) (bool, *api.KVTxnResponse, *api.QueryMeta, error) {
+	if c.count == c.failOn {
+		txn = append(txn, &api.KVTxnOp{
+			Verb:    api.KVCheckSession,
+			Key:     "no/such/lock",
+			Session: "00000000-0000-0000-0000-000000000000",
+		})
+	}
+	c.count++
+	return c.txner.Txn(txn, q)
+}
+
+func manyNodes(n int) []types.NodeName {
+	nodes := make([]types.NodeName, n)
+	for i := range nodes {
+		nodes[i] = types.NodeName(fmt.Sprintf("node%d", i))
+	}
+	return nodes
+}
+
+func TestSetManyNodesSplitsTransactions(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+
+	builder := manifest.NewBuilder()
+	builder.SetID("foo")
+	nodes := manyNodes(65)
+
+	txner := &countingTxner{txner: f.Client.KV(), failOn: -1}
+	_, err := f.Store.setManyNodes(txner, INTENT_TREE, nodes, builder.GetManifest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txner.count != 2 {
+		t.Errorf("expected 65 nodes to take 2 transactions, took %d", txner.count)
+	}
+	for _, node := range nodes {
+		_, _, err := f.Store.Pod(INTENT_TREE, node, "foo")
+		if err != nil {
+			t.Errorf("expected foo to be written to %s: %s", node, err)
+		}
+	}
+}
+
+func TestSetManyNodesRollsBackFailedBatch(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+
+	builder := manifest.NewBuilder()
+	builder.SetID("foo")
+	nodes := manyNodes(63)
+
+	txner := &countingTxner{txner: f.Client.KV(), failOn: 0}
+	_, err := f.Store.setManyNodes(txner, INTENT_TREE, nodes, builder.GetManifest())
+	if err == nil {
+		t.Fatal("expected the failed transaction to return an error")
+	}
+	for _, node := range nodes {
+		_, _, err := f.Store.Pod(INTENT_TREE, node, "foo")
+		if err == nil {
+			t.Errorf("expected the write to %s to have been rolled back", node)
+		}
+	}
+}
+
+func TestSetManyNodesEmitsOneEvent(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+
+	var events []StoreEvent
+	f.Store.On(func(event StoreEvent) { events = append(events, event) })
+
+	builder := manifest.NewBuilder()
+	builder.SetID("foo")
+	_, err := f.Store.SetManyNodes(INTENT_TREE, manyNodes(3), builder.GetManifest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Method != "SetManyNodes" {
+		t.Errorf("expected a single SetManyNodes event, got %+v", events)
+	}
+}
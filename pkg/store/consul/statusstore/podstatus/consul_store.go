@@ -150,6 +150,17 @@ func (c ConsulStore) SetLastExit(ctx context.Context, podUniqueKey types.PodUniq
 	return c.MutateStatus(ctx, podUniqueKey, mutator)
 }
 
+// A helper method for recording the preparer's progress installing and
+// launching a pod, see PodStatus.SetState()
+func (c ConsulStore) SetPodState(ctx context.Context, podUniqueKey types.PodUniqueKey, state PodState, lastError string) error {
+	mutator := func(p PodStatus) (PodStatus, error) {
+		p.SetState(state, lastError)
+		return p, nil
+	}
+
+	return c.MutateStatus(ctx, podUniqueKey, mutator)
+}
+
 // List lists all of the pod status entries in consul.
 func (c ConsulStore) List() (map[types.PodUniqueKey]PodStatus, error) {
 	allStatus, err := c.statusStore.GetAllStatusForResourceType(statusstore.POD)
@@ -93,3 +93,52 @@ func TestMutateStatusExistingKey(t *testing.T) {
 		t.Error("ProcessStatus field didn't go untouched when mutating PodStatus")
 	}
 }
+
+func TestSetPodState(t *testing.T) {
+	fixture := consulutil.NewFixture(t)
+	defer fixture.Stop()
+	consulStore := statusstore.NewConsul(fixture.Client)
+	podStore := NewConsul(consulStore, "test_namespace")
+
+	key := types.NewPodUUID()
+	setPodState := func(state PodState, lastError string) PodStatus {
+		ctx, cancelFunc := transaction.New(context.Background())
+		defer cancelFunc()
+		err := podStore.SetPodState(ctx, key, state, lastError)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = transaction.MustCommit(ctx, fixture.Client.KV())
+		if err != nil {
+			t.Fatal(err)
+		}
+		status, _, err := podStore.Get(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return status
+	}
+
+	installing := setPodState(PodInstalling, "")
+	if installing.PodStatus != PodInstalling || installing.LastTransition.IsZero() {
+		t.Fatalf("Expected the pod to be installing since a recorded time, got %+v", installing)
+	}
+
+	// A failed install attempt records the error without changing the
+	// transition time
+	failed := setPodState(PodInstalling, "artifact not found")
+	if failed.LastError != "artifact not found" {
+		t.Errorf("Expected the install error to be recorded, got %q", failed.LastError)
+	}
+	if !failed.LastTransition.Equal(installing.LastTransition) {
+		t.Errorf("Expected the transition time to stay %s, was %s", installing.LastTransition, failed.LastTransition)
+	}
+
+	launching := setPodState(PodLaunching, "")
+	if launching.PodStatus != PodLaunching || launching.LastError != "" {
+		t.Errorf("Expected the pod to be launching without an error, got %+v", launching)
+	}
+	if launching.LastTransition.Before(installing.LastTransition) {
+		t.Errorf("Expected the transition time to move forward from %s, was %s", installing.LastTransition, launching.LastTransition)
+	}
+}
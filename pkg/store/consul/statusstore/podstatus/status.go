@@ -14,7 +14,16 @@ type PodState string
 func (p PodState) String() string { return string(p) }
 
 const (
-	// Signifies that the pod has been launched
+	// Signifies that the preparer is installing the pod's launchables. A
+	// pod that is being updated keeps running the manifest in
+	// PodStatus.Manifest until it is launched again.
+	PodInstalling PodState = "installing"
+
+	// Signifies that the pod has been installed and the preparer is
+	// launching it
+	PodLaunching PodState = "launching"
+
+	// Signifies that the pod has been launched, i.e. it is running
 	PodLaunched PodState = "launched"
 
 	// Signifies that the pod has been unscheduled and removed from the machine
@@ -52,6 +61,24 @@ type PodStatus struct {
 	// String representing the pod manifest for the running pod. Will be
 	// empty if it hasn't yet been launched
 	Manifest string `json:"manifest"`
+
+	// When PodStatus last changed
+	LastTransition time.Time `json:"last_transition"`
+
+	// The preparer's most recent error installing or launching the pod.
+	// Cleared once the pod is launched, so a pod that is installing with a
+	// LastError is being retried by the preparer.
+	LastError string `json:"last_error,omitempty"`
+}
+
+// SetState changes the pod's state, recording the time of the transition if
+// the state changed. lastError replaces LastError.
+func (p *PodStatus) SetState(state PodState, lastError string) {
+	if p.PodStatus != state {
+		p.PodStatus = state
+		p.LastTransition = time.Now()
+	}
+	p.LastError = lastError
 }
 
 func statusToPodStatus(rawStatus statusstore.Status) (PodStatus, error) {
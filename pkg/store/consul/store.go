@@ -0,0 +1,31 @@
+package consul
+
+import (
+	"time"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/types"
+)
+
+// Store is the public interface to the pod operations of the consul store. It
+// is implemented by the store returned by NewConsulStore(), by the wrapper
+// returned by NewDryRunStore(), and by consultest.FakePodStore, so code that
+// reads and writes pods should depend on it (or a subset of it) rather than
+// on a concrete store.
+type Store interface {
+	Pod(podPrefix PodPrefix, nodename types.NodeName, podId types.PodID) (manifest.Manifest, time.Duration, error)
+	PodExists(podPrefix PodPrefix, nodename types.NodeName, podId types.PodID) (bool, time.Duration, error)
+	ListPods(podPrefix PodPrefix, nodename types.NodeName) ([]ManifestResult, time.Duration, error)
+	AllPods(podPrefix PodPrefix) ([]ManifestResult, time.Duration, error)
+	WatchPod(podPrefix PodPrefix, nodename types.NodeName, podId types.PodID, quitChan <-chan struct{}, errChan chan<- error, podChan chan<- ManifestResult)
+	WatchPods(podPrefix PodPrefix, nodename types.NodeName, quitChan <-chan struct{}, errChan chan<- error, podChan chan<- []ManifestResult)
+	GetHealth(service string, node types.NodeName) (WatchResult, error)
+	GetServiceHealth(service string) (map[string]WatchResult, error)
+
+	SetPod(podPrefix PodPrefix, nodename types.NodeName, manifest manifest.Manifest) (time.Duration, error)
+	DeletePod(podPrefix PodPrefix, nodename types.NodeName, podId types.PodID) (time.Duration, error)
+	SetSchedulingMetadata(podPrefix PodPrefix, nodename types.NodeName, podId types.PodID, metadata SchedulingMetadata) (time.Duration, error)
+	DeleteSchedulingMetadata(podPrefix PodPrefix, nodename types.NodeName, podId types.PodID) (time.Duration, error)
+}
+
+var _ Store = &consulStore{}
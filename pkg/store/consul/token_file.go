@@ -0,0 +1,126 @@
+package consul
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/square/p2/pkg/logging"
+	"github.com/square/p2/pkg/util"
+)
+
+// TokenFile is a consul ACL token read from a file, which is reloaded when
+// the file's modification time changes so that long running processes pick
+// up rotated tokens. Requests made through Transport() read the token
+// atomically, so a reload does not affect requests already in flight.
+type TokenFile struct {
+	path  string
+	token atomic.Value // string
+
+	// Guards modTime, so that concurrent Refresh() calls don't both reload
+	mu      sync.Mutex
+	modTime time.Time
+}
+
+// NewTokenFile reads the token in path.
+func NewTokenFile(path string) (*TokenFile, error) {
+	t := &TokenFile{path: path}
+	t.token.Store("")
+	_, err := t.Refresh()
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Token returns the most recently read token.
+func (t *TokenFile) Token() string {
+	return t.token.Load().(string)
+}
+
+// Refresh rereads the token if the file has been modified since it was last
+// read, and returns whether it did. The previous token is kept on error.
+func (t *TokenFile) Refresh() (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	info, err := os.Stat(t.path)
+	if err != nil {
+		return false, util.Errorf("Could not stat consul token file %s: %s", t.path, err)
+	}
+	if info.ModTime().Equal(t.modTime) {
+		return false, nil
+	}
+
+	tokenBytes, err := ioutil.ReadFile(t.path)
+	if err != nil {
+		return false, util.Errorf("Could not read consul token file %s: %s", t.path, err)
+	}
+	t.token.Store(strings.TrimSpace(string(tokenBytes)))
+	t.modTime = info.ModTime()
+	return true, nil
+}
+
+// RefreshEvery calls Refresh() at the given interval until quit is closed,
+// logging any errors. A nil quit channel refreshes for the life of the
+// process.
+func (t *TokenFile) RefreshEvery(interval time.Duration, quit <-chan struct{}, logger logging.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-quit:
+			return
+		case <-ticker.C:
+			reloaded, err := t.Refresh()
+			if err != nil {
+				logger.WithError(err).Errorln("Could not refresh the consul token")
+			} else if reloaded {
+				logger.WithField("path", t.path).Infoln("Reloaded the consul token")
+			}
+		}
+	}
+}
+
+// Transport returns an http.RoundTripper that sets the current token on each
+// request, then passes it to inner. The token replaces any the consul client
+// set, which may be a stale one from CONSUL_HTTP_TOKEN.
+func (t *TokenFile) Transport(inner http.RoundTripper) http.RoundTripper {
+	return tokenTransport{inner: inner, tokenFile: t}
+}
+
+type tokenTransport struct {
+	inner     http.RoundTripper
+	tokenFile *TokenFile
+}
+
+func (tt tokenTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if token := tt.tokenFile.Token(); token != "" {
+		// RoundTrippers must not modify the caller's request
+		r = cloneRequest(r)
+		r.Header.Set("X-Consul-Token", token)
+		// Older agents read the token from the query string instead
+		if query := r.URL.Query(); query.Get("token") != "" {
+			query.Set("token", token)
+			r.URL.RawQuery = query.Encode()
+		}
+	}
+	return tt.inner.RoundTrip(r)
+}
+
+// cloneRequest returns a shallow copy of r with its own header and URL.
+func cloneRequest(r *http.Request) *http.Request {
+	clone := new(http.Request)
+	*clone = *r
+	clone.Header = make(http.Header, len(r.Header))
+	for key, values := range r.Header {
+		clone.Header[key] = append([]string(nil), values...)
+	}
+	url := *r.URL
+	clone.URL = &url
+	return clone
+}
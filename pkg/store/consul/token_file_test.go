@@ -0,0 +1,129 @@
+package consul
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/logging"
+)
+
+func TestTokenFileRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "token-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tokenPath := filepath.Join(dir, "token")
+	err = ioutil.WriteFile(tokenPath, []byte("old-token\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var tokens []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		tokens = append(tokens, r.Header.Get("X-Consul-Token"))
+		mu.Unlock()
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	lastToken := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return tokens[len(tokens)-1]
+	}
+
+	tokenFile, err := NewTokenFile(tokenPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	quit := make(chan struct{})
+	defer close(quit)
+	go tokenFile.RefreshEvery(10*time.Millisecond, quit, logging.DefaultLogger)
+
+	store := NewConsulStore(NewConsulClient(Options{
+		Address: server.Listener.Addr().String(),
+		Client:  &http.Client{Transport: tokenFile.Transport(http.DefaultTransport)},
+	}))
+	err = store.Ping()
+	if err != nil {
+		t.Fatalf("Unexpected error pinging: %s", err)
+	}
+	if token := lastToken(); token != "old-token" {
+		t.Fatalf("Expected the request to use the token from the file, used %q", token)
+	}
+
+	// Make sure the modification time changes even on filesystems with a
+	// coarse resolution
+	err = ioutil.WriteFile(tokenPath, []byte("new-token\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Minute)
+	err = os.Chtimes(tokenPath, future, future)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for tokenFile.Token() != "new-token" {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the token to be reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	err = store.Ping()
+	if err != nil {
+		t.Fatalf("Unexpected error pinging: %s", err)
+	}
+	if token := lastToken(); token != "new-token" {
+		t.Errorf("Expected requests after the refresh to use the new token, used %q", token)
+	}
+}
+
+func TestTokenFileOverridesEnvToken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "token-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tokenPath := filepath.Join(dir, "token")
+	err = ioutil.WriteFile(tokenPath, []byte("file-token\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var token string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = r.Header.Get("X-Consul-Token")
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	oldEnv := os.Getenv("CONSUL_HTTP_TOKEN")
+	os.Setenv("CONSUL_HTTP_TOKEN", "stale-env-token")
+	defer os.Setenv("CONSUL_HTTP_TOKEN", oldEnv)
+
+	tokenFile, err := NewTokenFile(tokenPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewConsulStore(NewConsulClient(Options{
+		Address: server.Listener.Addr().String(),
+		Client:  &http.Client{Transport: tokenFile.Transport(http.DefaultTransport)},
+	}))
+	err = store.Ping()
+	if err != nil {
+		t.Fatalf("Unexpected error pinging: %s", err)
+	}
+	if token != "file-token" {
+		t.Errorf("Expected the token file to win over CONSUL_HTTP_TOKEN, used %q", token)
+	}
+}
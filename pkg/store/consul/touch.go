@@ -0,0 +1,129 @@
+package consul
+
+import (
+	"time"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/store/consul/consulutil"
+	"github.com/square/p2/pkg/types"
+	"github.com/square/p2/pkg/util"
+)
+
+// PodMetadata describes the consul key holding a pod's intent.
+type PodMetadata struct {
+	ModifyIndex uint64
+
+	// When the intent was last written by SetPod(), SetPodTxn(),
+	// CompareAndSetPod(), MutatePod() or TouchPod(). Zero if the intent was
+	// written some other way.
+	ModifiedAt time.Time
+}
+
+// The time a pod intent was written is kept in the key's flags rather than in
+// the manifest, since changing the manifest would change its SHA and cause
+// the preparer to reinstall the pod.
+func modifiedAtFlags(t time.Time) uint64 {
+	return uint64(t.UnixNano())
+}
+
+func modifiedAtFromFlags(flags uint64) time.Time {
+	if flags == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(flags))
+}
+
+// GetPodWithMetadata is like Pod() but also returns metadata about the intent
+// itself, such as when it was last modified.
+func (c consulStore) GetPodWithMetadata(podPrefix PodPrefix, nodename types.NodeName, podId types.PodID) (_ manifest.Manifest, _ PodMetadata, _ time.Duration, err error) {
+	defer c.emit("GetPodWithMetadata", eventPath(PodPath(podPrefix, nodename, podId)), time.Now(), &err)
+
+	key, err := PodPath(podPrefix, nodename, podId)
+	if err != nil {
+		return nil, PodMetadata{}, 0, err
+	}
+
+	kvPair, queryMeta, err := c.client.KV().Get(key, nil)
+	if err != nil {
+		return nil, PodMetadata{}, 0, consulutil.NewKVError("get", key, err)
+	}
+	if kvPair == nil {
+		return nil, PodMetadata{}, queryMeta.RequestTime, pods.NoCurrentManifest
+	}
+	manifest, err := manifest.FromBytes(kvPair.Value)
+	if err != nil {
+		return nil, PodMetadata{}, queryMeta.RequestTime, err
+	}
+	return manifest, PodMetadata{
+		ModifyIndex: kvPair.ModifyIndex,
+		ModifiedAt:  modifiedAtFromFlags(kvPair.Flags),
+	}, queryMeta.RequestTime, nil
+}
+
+// TouchPod updates the modification time of a pod's intent without changing
+// the manifest, e.g. to heartbeat a deploy that a watchdog would otherwise
+// consider stuck. The write is a check-and-set, so it fails rather than
+// clobbering the intent if it is modified concurrently. Returns
+// pods.NoCurrentManifest if the pod is not scheduled.
+func (c consulStore) TouchPod(podPrefix PodPrefix, nodename types.NodeName, podId types.PodID) (_ time.Duration, err error) {
+	defer c.emit("TouchPod", eventPath(PodPath(podPrefix, nodename, podId)), time.Now(), &err)
+
+	key, err := PodPath(podPrefix, nodename, podId)
+	if err != nil {
+		return 0, err
+	}
+
+	kvPair, queryMeta, err := c.client.KV().Get(key, nil)
+	if err != nil {
+		return 0, consulutil.NewKVError("get", key, err)
+	}
+	if kvPair == nil {
+		return queryMeta.RequestTime, pods.NoCurrentManifest
+	}
+
+	retDur := queryMeta.RequestTime
+	var sha string
+	if c.auditsIntent(podPrefix) {
+		current, err := manifest.FromBytes(kvPair.Value)
+		if err != nil {
+			return retDur, util.Errorf("Could not parse the manifest at %s: %s", key, err)
+		}
+		sha, err = current.SHA()
+		if err != nil {
+			return retDur, util.Errorf("Could not compute the SHA of the manifest at %s: %s", key, err)
+		}
+	}
+
+	ok, writeDur, err := c.casPod(podPrefix, nodename, podId, kvPair.Value, kvPair.ModifyIndex, sha)
+	retDur += writeDur
+	if err != nil {
+		return retDur, err
+	}
+	if !ok {
+		return retDur, util.Errorf("Could not touch %s: it was modified concurrently", key)
+	}
+	return retDur, nil
+}
+
+// GetPodModifyTime returns when a pod's intent was last written by the store
+// (see PodMetadata.ModifiedAt), without parsing the manifest. The time is zero
+// if the intent was written some other way. Returns pods.NoCurrentManifest if the
+// pod is not scheduled.
+func (c consulStore) GetPodModifyTime(podPrefix PodPrefix, nodename types.NodeName, podId types.PodID) (_ time.Time, _ time.Duration, err error) {
+	defer c.emit("GetPodModifyTime", eventPath(PodPath(podPrefix, nodename, podId)), time.Now(), &err)
+
+	key, err := PodPath(podPrefix, nodename, podId)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	kvPair, queryMeta, err := c.client.KV().Get(key, nil)
+	if err != nil {
+		return time.Time{}, 0, consulutil.NewKVError("get", key, err)
+	}
+	if kvPair == nil {
+		return time.Time{}, queryMeta.RequestTime, pods.NoCurrentManifest
+	}
+	return modifiedAtFromFlags(kvPair.Flags), queryMeta.RequestTime, nil
+}
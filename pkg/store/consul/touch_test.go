@@ -0,0 +1,85 @@
+// +build !race
+
+package consul
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/pods"
+)
+
+func TestTouchPod(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+
+	builder := manifest.NewBuilder()
+	builder.SetID("foo")
+	_, err := f.Store.SetPod(INTENT_TREE, "node1", builder.GetManifest())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	original, originalMeta, _, err := f.Store.GetPodWithMetadata(INTENT_TREE, "node1", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if originalMeta.ModifiedAt.IsZero() {
+		t.Error("Expected SetPod to record the modification time")
+	}
+
+	time.Sleep(time.Millisecond)
+	_, err = f.Store.TouchPod(INTENT_TREE, "node1", "foo")
+	if err != nil {
+		t.Fatalf("Unexpected error touching pod: %s", err)
+	}
+
+	touched, touchedMeta, _, err := f.Store.GetPodWithMetadata(INTENT_TREE, "node1", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !touchedMeta.ModifiedAt.After(originalMeta.ModifiedAt) {
+		t.Errorf("Expected the touched pod to be modified after %s, was %s", originalMeta.ModifiedAt, touchedMeta.ModifiedAt)
+	}
+	if touchedMeta.ModifyIndex <= originalMeta.ModifyIndex {
+		t.Errorf("Expected the modify index to increase from %d, was %d", originalMeta.ModifyIndex, touchedMeta.ModifyIndex)
+	}
+
+	originalSHA, _ := original.SHA()
+	touchedSHA, _ := touched.SHA()
+	if originalSHA != touchedSHA {
+		t.Error("Expected touching the pod not to change its manifest")
+	}
+
+	_, err = f.Store.TouchPod(INTENT_TREE, "node1", "missing")
+	if err != pods.NoCurrentManifest {
+		t.Errorf("Expected NoCurrentManifest touching a missing pod, got %v", err)
+	}
+}
+
+func TestGetPodModifyTime(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+
+	builder := manifest.NewBuilder()
+	builder.SetID("foo")
+	_, err := f.Store.SetPod(INTENT_TREE, "node1", builder.GetManifest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+
+	modifiedAt, _, err := f.Store.GetPodModifyTime(INTENT_TREE, "node1", "foo")
+	if err != nil {
+		t.Fatalf("Unexpected error getting modify time: %s", err)
+	}
+	if since := time.Since(modifiedAt); since < 0 || since > time.Second {
+		t.Errorf("Expected the pod to have been modified within the last second, was modified at %s", modifiedAt)
+	}
+
+	_, _, err = f.Store.GetPodModifyTime(INTENT_TREE, "node1", "missing")
+	if err != pods.NoCurrentManifest {
+		t.Errorf("Expected NoCurrentManifest for a missing pod, got %v", err)
+	}
+}
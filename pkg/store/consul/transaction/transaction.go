@@ -22,6 +22,10 @@ type contextKeyType struct{}
 // Per https://www.consul.io/api/txn.html
 const maxAllowedOperations = 64
 
+// MaxOperations is the largest number of operations a single transaction may
+// contain. Callers with more work should split it into several transactions.
+const MaxOperations = maxAllowedOperations
+
 var (
 	ErrTooManyOperations = errors.New("consul transactions cannot have more than 64 operations")
 	ErrAlreadyCommitted  = errors.New("this transaction has already been committed")
@@ -0,0 +1,68 @@
+package consul
+
+import (
+	"context"
+	"time"
+
+	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/store/consul/transaction"
+	"github.com/square/p2/pkg/types"
+)
+
+// Txn batches pod writes and deletes into a single consul transaction, so
+// that either all of them are made or none are. A Txn holds at most
+// transaction.MaxOperations operations, i.e. MaxTxnPodWrites() pod writes or
+// fewer deletes. It is not safe for concurrent use.
+type Txn struct {
+	store  consulStore
+	txner  transaction.Txner
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Txn returns an empty transaction. Its operations are made by Commit(), and
+// discarded if Cancel() is called first.
+func (c consulStore) Txn() *Txn {
+	return c.txn(c.client.KV())
+}
+
+func (c consulStore) txn(txner transaction.Txner) *Txn {
+	ctx, cancel := transaction.New(context.Background())
+	return &Txn{
+		store:  c,
+		txner:  txner,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// SetPod adds a write of the manifest to the node's pod to the transaction.
+func (t *Txn) SetPod(podPrefix PodPrefix, nodename types.NodeName, manifest manifest.Manifest) error {
+	return t.store.setPodTxn(t.ctx, podPrefix, nodename, manifest)
+}
+
+// DeletePod adds a delete of the node's pod to the transaction. As with
+// DeletePod() on the store, deleting a pod that doesn't exist is not an
+// error.
+func (t *Txn) DeletePod(podPrefix PodPrefix, nodename types.NodeName, podId types.PodID) error {
+	return t.store.deletePodTxn(t.ctx, podPrefix, nodename, podId)
+}
+
+// Commit makes every operation of the transaction. An error is returned if
+// the transaction could not be made or was rolled back, in which case none of
+// its operations were made. A single Txn.Commit event is emitted for the whole
+// transaction.
+func (t *Txn) Commit() (_ time.Duration, err error) {
+	defer t.store.emit("Txn.Commit", "", time.Now(), &err)
+	defer t.cancel()
+
+	start := time.Now()
+	err = transaction.MustCommit(t.ctx, t.txner)
+	return time.Since(start), err
+}
+
+// Cancel discards the transaction's operations. It does nothing once the
+// transaction has been committed.
+func (t *Txn) Cancel() {
+	t.cancel()
+}
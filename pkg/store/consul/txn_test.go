@@ -0,0 +1,97 @@
+// +build !race
+
+package consul
+
+import (
+	"testing"
+
+	"github.com/square/p2/pkg/pods"
+	"github.com/square/p2/pkg/types"
+)
+
+func TestTxnCommitsSetsAndDeletes(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+
+	_, err := f.Store.SetPod(INTENT_TREE, "node1", testManifest("old"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txn := f.Store.Txn()
+	if err = txn.SetPod(INTENT_TREE, "node1", testManifest("foo")); err != nil {
+		t.Fatal(err)
+	}
+	if err = txn.SetPod(INTENT_TREE, "node2", testManifest("foo")); err != nil {
+		t.Fatal(err)
+	}
+	if err = txn.DeletePod(INTENT_TREE, "node1", "old"); err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing is written until the transaction is committed
+	_, _, err = f.Store.Pod(INTENT_TREE, "node2", "foo")
+	if err != pods.NoCurrentManifest {
+		t.Fatalf("expected foo not to be written to node2 before commit, got %v", err)
+	}
+
+	_, err = txn.Commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, node := range []types.NodeName{"node1", "node2"} {
+		_, _, err = f.Store.Pod(INTENT_TREE, node, "foo")
+		if err != nil {
+			t.Errorf("expected foo to be written to %s: %s", node, err)
+		}
+	}
+	_, _, err = f.Store.Pod(INTENT_TREE, "node1", "old")
+	if err != pods.NoCurrentManifest {
+		t.Errorf("expected old to be deleted from node1, got %v", err)
+	}
+}
+
+func TestTxnRollsBackEveryOperation(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+
+	txn := f.Store.txn(&countingTxner{txner: f.Client.KV(), failOn: 0})
+	for _, node := range manyNodes(3) {
+		err := txn.SetPod(INTENT_TREE, node, testManifest("foo"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := txn.Commit()
+	if err == nil {
+		t.Fatal("expected the failed transaction to return an error")
+	}
+	for _, node := range manyNodes(3) {
+		_, _, err = f.Store.Pod(INTENT_TREE, node, "foo")
+		if err != pods.NoCurrentManifest {
+			t.Errorf("expected the write to %s to have been rolled back, got %v", node, err)
+		}
+	}
+}
+
+func TestTxnEmitsOnlyCommit(t *testing.T) {
+	f := NewConsulTestFixture(t)
+	defer f.Close()
+
+	var events []StoreEvent
+	f.Store.On(func(event StoreEvent) { events = append(events, event) })
+
+	txn := f.Store.Txn()
+	if err := txn.SetPod(INTENT_TREE, "node1", testManifest("foo")); err != nil {
+		t.Fatal(err)
+	}
+	if err := txn.DeletePod(INTENT_TREE, "node1", "bar"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := txn.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Method != "Txn.Commit" {
+		t.Errorf("expected a single Txn.Commit event, got %+v", events)
+	}
+}
@@ -0,0 +1,339 @@
+// Package systemd supervises the services of pods with systemd rather than
+// runit, for hosts that don't ship runit. UnitBuilder writes a unit file for
+// each service, and a socket unit if the service is socket activated, and SV
+// controls the units with systemctl.
+//
+// Unlike runit, the services' output goes to the journal rather than to a log
+// agent.
+package systemd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/square/p2/pkg/runit"
+	"github.com/square/p2/pkg/util"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Every unit written by p2 has this prefix, so that Prune leaves other units
+// alone
+const unitPrefix = "p2-"
+
+// DefaultSystemctlPath is the path to the default systemctl binary. Specified
+// as a var so you can override at build time.
+var DefaultSystemctlPath = "/bin/systemctl"
+
+// UnitBuilder is a runit.Builder that installs services as systemd units.
+type UnitBuilder struct {
+	UnitDir    string // directory to write unit files to
+	ConfigRoot string // directory to record the services of each group in
+	Systemctl  string
+}
+
+var _ runit.Builder = &UnitBuilder{}
+
+var DefaultBuilder *UnitBuilder
+
+func init() {
+	// Setup in init so if DefaultSystemctlPath is changed at build time we use the changed value
+	DefaultBuilder = &UnitBuilder{
+		UnitDir:    "/etc/systemd/system",
+		ConfigRoot: "/etc/p2/systemd.d",
+		Systemctl:  DefaultSystemctlPath,
+	}
+}
+
+func unitName(serviceName string, unitType string) string {
+	return unitPrefix + serviceName + unitType
+}
+
+// ServicePath returns the path of the service's unit file
+func (b *UnitBuilder) ServicePath(serviceName string) string {
+	return filepath.Join(b.UnitDir, unitName(serviceName, ".service"))
+}
+
+func (b *UnitBuilder) socketPath(serviceName string) string {
+	return filepath.Join(b.UnitDir, unitName(serviceName, ".socket"))
+}
+
+func (b *UnitBuilder) systemctl(args ...string) error {
+	cmd := exec.Command(b.Systemctl, args...)
+	buffer := bytes.Buffer{}
+	cmd.Stdout = &buffer
+	cmd.Stderr = &buffer
+	err := cmd.Run()
+	if err != nil {
+		return util.Errorf("Could not run %v - Error: %s, Output: %s", cmd.Args, err, buffer.String())
+	}
+	return nil
+}
+
+// Activate writes the units of the group's services. Services whose restart
+// policy restarts them are enabled, so that they are started at boot like
+// runit services, and socket units are started right away. The services
+// themselves are started by the SV.
+func (b *UnitBuilder) Activate(name string, templates map[string]runit.ServiceTemplate) error {
+	err := b.writeGroup(name, templates)
+	if err != nil {
+		return err
+	}
+
+	reload := false
+	var enable, listen []string
+	for serviceName, template := range templates {
+		unit, err := serviceUnit(name, serviceName, template)
+		if err != nil {
+			return err
+		}
+		changed, err := util.WriteIfChanged(b.ServicePath(serviceName), unit, 0644)
+		if err != nil {
+			return err
+		}
+		reload = reload || changed
+
+		if len(template.Sockets) > 0 {
+			changed, err = util.WriteIfChanged(b.socketPath(serviceName), socketUnit(name, serviceName, template.Sockets), 0644)
+			if err != nil {
+				return err
+			}
+			reload = reload || changed
+			listen = append(listen, unitName(serviceName, ".socket"))
+		} else {
+			// The service may have been socket activated before
+			err = os.Remove(b.socketPath(serviceName))
+			if err == nil {
+				reload = true
+			} else if !os.IsNotExist(err) {
+				return util.Errorf("Unable to remove socket unit: %s", err)
+			}
+		}
+
+		if template.RestartPolicy.Restarts() {
+			enable = append(enable, unitName(serviceName, ".service"))
+		}
+	}
+
+	if reload {
+		err = b.systemctl("daemon-reload")
+		if err != nil {
+			return err
+		}
+	}
+	if len(enable) > 0 {
+		err = b.systemctl(append([]string{"enable"}, enable...)...)
+		if err != nil {
+			return err
+		}
+	}
+	if len(listen) > 0 {
+		err = b.systemctl(append([]string{"enable", "--now"}, listen...)...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Deactivate removes the record of the group's services, so that their units
+// are removed by the next Prune
+func (b *UnitBuilder) Deactivate(name string) error {
+	err := os.Remove(b.groupPath(name))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Prune stops and removes the units of services that aren't in any group.
+func (b *UnitBuilder) Prune() error {
+	services, err := b.loadGroups()
+	if err != nil {
+		return err
+	}
+
+	entries, err := ioutil.ReadDir(b.UnitDir)
+	if err != nil {
+		return err
+	}
+	var remove []string
+	for _, entry := range entries {
+		unit := entry.Name()
+		unitType := filepath.Ext(unit)
+		if !strings.HasPrefix(unit, unitPrefix) || (unitType != ".service" && unitType != ".socket") {
+			continue
+		}
+		if !services[strings.TrimSuffix(strings.TrimPrefix(unit, unitPrefix), unitType)] {
+			remove = append(remove, unit)
+		}
+	}
+	if len(remove) == 0 {
+		return nil
+	}
+
+	err = b.systemctl(append([]string{"disable", "--now"}, remove...)...)
+	if err != nil {
+		return err
+	}
+	for _, unit := range remove {
+		err = os.Remove(filepath.Join(b.UnitDir, unit))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return b.systemctl("daemon-reload")
+}
+
+func (b *UnitBuilder) groupPath(name string) string {
+	return filepath.Join(b.ConfigRoot, name+".yaml")
+}
+
+// writeGroup records the services of the group, in the same format as the
+// runit servicebuilder files.
+func (b *UnitBuilder) writeGroup(name string, templates map[string]runit.ServiceTemplate) error {
+	if len(templates) == 0 {
+		return b.Deactivate(name)
+	}
+	text, err := yaml.Marshal(templates)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(b.ConfigRoot, 0755)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(b.groupPath(name), text, 0644)
+}
+
+// loadGroups returns the names of the services in every group.
+func (b *UnitBuilder) loadGroups() (map[string]bool, error) {
+	services := make(map[string]bool)
+	entries, err := ioutil.ReadDir(b.ConfigRoot)
+	if os.IsNotExist(err) {
+		return services, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		contents, err := ioutil.ReadFile(filepath.Join(b.ConfigRoot, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		group := make(map[string]runit.ServiceTemplate)
+		err = yaml.Unmarshal(contents, group)
+		if err != nil {
+			return nil, err
+		}
+		for name := range group {
+			if services[name] {
+				return nil, util.Errorf("service with name %s was defined twice (from %s)", name, entry.Name())
+			}
+			services[name] = true
+		}
+	}
+	return services, nil
+}
+
+// serviceUnit returns the unit file of a service. The restart policy maps to
+// Restart=, and a restart backoff to systemd's own exponential RestartSteps=
+// between RestartSec= and RestartMaxDelaySec= (systemd 254 and later). As
+// systemd only resets the backoff when the unit is started explicitly, the
+// backoff's reset_after isn't used.
+func serviceUnit(group string, serviceName string, template runit.ServiceTemplate) ([]byte, error) {
+	if len(template.Run) == 0 {
+		return nil, util.Errorf("empty run command")
+	}
+
+	restart := "no"
+	switch template.RestartPolicy {
+	case runit.RestartPolicyAlways:
+		restart = "always"
+	case runit.RestartPolicyOnFailure:
+		restart = "on-failure"
+	}
+
+	// Like the runit run script, wait a little before each restart to
+	// reduce spinning on a broken service
+	restartSec := "2s"
+	if template.Sleep != nil && *template.Sleep >= 0 {
+		restartSec = strconv.Itoa(*template.Sleep) + "s"
+	}
+	var backoff string
+	if b := template.RestartBackoff; b != nil {
+		restartSec = seconds(b.Initial.Seconds())
+		steps := 0
+		for delay := b.Initial; delay > 0 && delay < b.Max; delay *= 2 {
+			steps++
+		}
+		backoff = fmt.Sprintf("RestartSteps=%d\nRestartMaxDelaySec=%s\n", steps, seconds(b.Max.Seconds()))
+	}
+
+	var finish string
+	if len(template.Finish) > 0 {
+		finish = "ExecStopPost=" + execLine(template.Finish) + "\n"
+	}
+
+	// KillMode=process stops services like runit does, by signaling the
+	// main process only
+	return []byte(fmt.Sprintf(`# Generated by p2 for %s, changes will be overwritten
+[Unit]
+Description=p2 service %s
+StartLimitIntervalSec=0
+
+[Service]
+ExecStart=%s
+%sRestart=%s
+RestartSec=%s
+%sKillMode=process
+SyslogIdentifier=%s
+
+[Install]
+WantedBy=multi-user.target
+`, group, serviceName, execLine(template.Run), finish, restart, restartSec, backoff, serviceName)), nil
+}
+
+// socketUnit returns the unit file that listens on the addresses for the
+// service and starts it. systemd passes the sockets in LISTEN_FDS.
+func socketUnit(group string, serviceName string, addresses []string) []byte {
+	var listen string
+	for _, address := range addresses {
+		listen += "ListenStream=" + address + "\n"
+	}
+	return []byte(fmt.Sprintf(`# Generated by p2 for %s, changes will be overwritten
+[Unit]
+Description=p2 sockets for %s
+
+[Socket]
+%sService=%s
+
+[Install]
+WantedBy=sockets.target
+`, group, serviceName, listen, unitName(serviceName, ".service")))
+}
+
+func seconds(s float64) string {
+	return strconv.FormatFloat(s, 'f', -1, 64) + "s"
+}
+
+// execLine quotes the command for an Exec*= line, where systemd would
+// otherwise split arguments on spaces and expand specifiers and variables.
+func execLine(command []string) string {
+	args := make([]string, 0, len(command))
+	for _, arg := range command {
+		arg = strings.Replace(arg, "%", "%%", -1)
+		arg = strings.Replace(arg, "$", "$$", -1)
+		if arg == "" || arg == ";" || strings.ContainsAny(arg, " \t\n\"'\\") {
+			arg = strconv.Quote(arg)
+		}
+		args = append(args, arg)
+	}
+	return strings.Join(args, " ")
+}
@@ -0,0 +1,114 @@
+package systemd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/anthonybishopric/gotcha"
+	"github.com/square/p2/pkg/runit"
+)
+
+func fakeBuilder(t *testing.T) (*UnitBuilder, func()) {
+	root, err := ioutil.TempDir("", "systemd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &UnitBuilder{
+		UnitDir:    filepath.Join(root, "system"),
+		ConfigRoot: filepath.Join(root, "systemd.d"),
+		Systemctl:  "/bin/true",
+	}
+	err = os.MkdirAll(b.UnitDir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b, func() { os.RemoveAll(root) }
+}
+
+func TestServiceUnit(t *testing.T) {
+	sleep := 5
+	unit, err := serviceUnit("web", "web__server", runit.ServiceTemplate{
+		Run:           []string{"/usr/bin/server", "--name", "a b", "100%", "$HOME"},
+		Finish:        []string{"/usr/bin/finish"},
+		RestartPolicy: runit.RestartPolicyOnFailure,
+		Sleep:         &sleep,
+	})
+	Assert(t).IsNil(err, "should have rendered the unit")
+
+	contents := string(unit)
+	for _, line := range []string{
+		`ExecStart=/usr/bin/server --name "a b" 100%% $$HOME`,
+		"ExecStopPost=/usr/bin/finish",
+		"Restart=on-failure",
+		"RestartSec=5s",
+		"KillMode=process",
+		"SyslogIdentifier=web__server",
+	} {
+		if !strings.Contains(contents, line+"\n") {
+			t.Errorf("Expected the unit to contain %q but was:\n%s", line, contents)
+		}
+	}
+	if strings.Contains(contents, "RestartSteps") {
+		t.Errorf("Expected no backoff without a restart_backoff but was:\n%s", contents)
+	}
+}
+
+func TestServiceUnitBackoff(t *testing.T) {
+	unit, err := serviceUnit("web", "web__server", runit.ServiceTemplate{
+		Run:            []string{"/usr/bin/server"},
+		RestartPolicy:  runit.RestartPolicyAlways,
+		RestartBackoff: &runit.RestartBackoff{Initial: 500 * time.Millisecond, Max: 4 * time.Second},
+	})
+	Assert(t).IsNil(err, "should have rendered the unit")
+
+	contents := string(unit)
+	for _, line := range []string{"Restart=always", "RestartSec=0.5s", "RestartSteps=3", "RestartMaxDelaySec=4s"} {
+		if !strings.Contains(contents, line+"\n") {
+			t.Errorf("Expected the unit to contain %q but was:\n%s", line, contents)
+		}
+	}
+}
+
+func TestActivateAndPrune(t *testing.T) {
+	b, cleanup := fakeBuilder(t)
+	defer cleanup()
+
+	err := b.Activate("web", map[string]runit.ServiceTemplate{
+		"web__server": {
+			Run:           []string{"/usr/bin/server"},
+			RestartPolicy: runit.RestartPolicyAlways,
+			Sockets:       []string{"0.0.0.0:8080"},
+		},
+	})
+	Assert(t).IsNil(err, "should have activated the group")
+
+	socket, err := ioutil.ReadFile(filepath.Join(b.UnitDir, "p2-web__server.socket"))
+	Assert(t).IsNil(err, "should have written the socket unit")
+	Assert(t).IsTrue(strings.Contains(string(socket), "ListenStream=0.0.0.0:8080\n"), "should have listened on the socket")
+	Assert(t).AreEqual(filepath.Join(b.UnitDir, "p2-web__server.service"), b.ServicePath("web__server"), "unexpected service path")
+
+	// An existing unit that p2 didn't write is left alone
+	err = ioutil.WriteFile(filepath.Join(b.UnitDir, "sshd.service"), nil, 0644)
+	Assert(t).IsNil(err, "should have written an unrelated unit")
+
+	err = b.Prune()
+	Assert(t).IsNil(err, "should have pruned")
+	_, err = os.Stat(b.ServicePath("web__server"))
+	Assert(t).IsNil(err, "should have kept the unit of an active group")
+
+	err = b.Deactivate("web")
+	Assert(t).IsNil(err, "should have deactivated the group")
+	err = b.Prune()
+	Assert(t).IsNil(err, "should have pruned")
+
+	_, err = os.Stat(b.ServicePath("web__server"))
+	Assert(t).IsTrue(os.IsNotExist(err), "should have removed the service unit")
+	_, err = os.Stat(filepath.Join(b.UnitDir, "p2-web__server.socket"))
+	Assert(t).IsTrue(os.IsNotExist(err), "should have removed the socket unit")
+	_, err = os.Stat(filepath.Join(b.UnitDir, "sshd.service"))
+	Assert(t).IsNil(err, "should have kept the unrelated unit")
+}
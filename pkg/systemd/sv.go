@@ -0,0 +1,166 @@
+package systemd
+
+import (
+	"bytes"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/square/p2/pkg/runit"
+	"github.com/square/p2/pkg/util"
+)
+
+// SV is a runit.SV that controls the units written by UnitBuilder. Services
+// are identified by the path of their unit file. Other paths, such as the log
+// agents that hoist launchables expect runit to run, have no unit because the
+// journal collects the logs, so commands on them do nothing.
+type SV struct {
+	Systemctl string
+}
+
+var _ runit.SV = &SV{}
+
+var DefaultSV *SV
+
+func init() {
+	DefaultSV = &SV{Systemctl: DefaultSystemctlPath}
+}
+
+// The layout of the timestamps in systemctl show
+const timestampLayout = "Mon 2006-01-02 15:04:05 MST"
+
+func serviceUnitName(service *runit.Service) (string, bool) {
+	unit := filepath.Base(service.Path)
+	return unit, filepath.Ext(unit) == ".service"
+}
+
+func (sv *SV) exec(args ...string) (string, error) {
+	cmd := exec.Command(sv.Systemctl, args...)
+	buffer := bytes.Buffer{}
+	cmd.Stdout = &buffer
+	cmd.Stderr = &buffer
+	err := cmd.Run()
+	if err != nil {
+		return buffer.String(), util.Errorf("Could not run %v - Error: %s, Output: %s", cmd.Args, err, buffer.String())
+	}
+	return buffer.String(), nil
+}
+
+func (sv *SV) execOnService(service *runit.Service, verb string) (string, error) {
+	unit, ok := serviceUnitName(service)
+	if !ok {
+		return "", nil
+	}
+	return sv.exec(verb, unit)
+}
+
+func (sv *SV) Start(service *runit.Service) (string, error) {
+	return sv.execOnService(service, "start")
+}
+
+// Stop stops the service. If a timeout is passed and the service hasn't
+// stopped by then, it is sent a KILL and runit.Killed is returned, like the
+// force-stop command of sv.
+func (sv *SV) Stop(service *runit.Service, timeout time.Duration) (string, error) {
+	unit, ok := serviceUnitName(service)
+	if !ok {
+		return "", nil
+	}
+	if timeout <= 0 {
+		return sv.exec("stop", unit)
+	}
+
+	type result struct {
+		out string
+		err error
+	}
+	stopped := make(chan result, 1)
+	go func() {
+		out, err := sv.exec("stop", unit)
+		stopped <- result{out, err}
+	}()
+	select {
+	case res := <-stopped:
+		return res.out, res.err
+	case <-time.After(timeout):
+	}
+
+	out, err := sv.exec("kill", "--signal=SIGKILL", unit)
+	if err != nil {
+		return out, err
+	}
+	// The stop job finishes once the process is gone
+	res := <-stopped
+	if res.err != nil {
+		return res.out, res.err
+	}
+	return res.out, runit.Killed
+}
+
+// Stat returns the state of the service's main process. The log status is
+// always that of the service, as there is no separate log process.
+func (sv *SV) Stat(service *runit.Service) (*runit.StatResult, error) {
+	unit, ok := serviceUnitName(service)
+	if !ok {
+		return &runit.StatResult{ChildStatus: runit.STATUS_RUN, LogStatus: runit.STATUS_RUN}, nil
+	}
+	out, err := sv.exec("show", "--property=ActiveState,MainPID,ExecMainStartTimestamp", unit)
+	if err != nil {
+		return nil, err
+	}
+	return showToStatResult(out, time.Now())
+}
+
+func showToStatResult(out string, now time.Time) (*runit.StatResult, error) {
+	properties := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) == 2 {
+			properties[parts[0]] = parts[1]
+		}
+	}
+
+	result := &runit.StatResult{ChildStatus: runit.STATUS_DOWN}
+	if properties["ActiveState"] == "active" {
+		result.ChildStatus = runit.STATUS_RUN
+	}
+	result.LogStatus = result.ChildStatus
+
+	pid, err := strconv.ParseUint(properties["MainPID"], 0, 32)
+	if err != nil {
+		return nil, util.Errorf("Could not parse child PID from %q: %v", properties["MainPID"], err)
+	}
+	result.ChildPID = pid
+
+	if pid != 0 && properties["ExecMainStartTimestamp"] != "" {
+		started, err := time.Parse(timestampLayout, properties["ExecMainStartTimestamp"])
+		if err != nil {
+			return nil, util.Errorf("Could not parse child Time from %q: %v", properties["ExecMainStartTimestamp"], err)
+		}
+		// Round to seconds like sv stat
+		result.ChildTime = now.Sub(started) / time.Second * time.Second
+	}
+	return result, nil
+}
+
+// Restart stops the service, with the timeout of Stop, and starts it again.
+func (sv *SV) Restart(service *runit.Service, timeout time.Duration) (string, error) {
+	out, err := sv.Stop(service, timeout)
+	if err != nil && err != runit.Killed {
+		return out, err
+	}
+	startOut, startErr := sv.Start(service)
+	if startErr != nil {
+		return out + startOut, startErr
+	}
+	return out + startOut, err
+}
+
+// Once starts the service. systemd has no equivalent of sv once, so whether
+// the service is restarted when it exits is up to the restart policy in its
+// unit.
+func (sv *SV) Once(service *runit.Service) (string, error) {
+	return sv.Start(service)
+}
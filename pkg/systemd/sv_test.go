@@ -0,0 +1,23 @@
+package systemd
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/anthonybishopric/gotcha"
+	"github.com/square/p2/pkg/runit"
+)
+
+func TestShowToStatResult(t *testing.T) {
+	now := time.Date(2016, 10, 14, 10, 0, 0, 0, time.UTC)
+	statRes, err := showToStatResult("ActiveState=active\nMainPID=22807\nExecMainStartTimestamp=Fri 2016-10-14 09:56:40 UTC\n", now)
+	Assert(t).IsNil(err, "should not have failed to parse show output")
+
+	Assert(t).AreEqual(runit.STATUS_RUN, statRes.ChildStatus, "Should have had a running child")
+	Assert(t).AreEqual(uint64(22807), statRes.ChildPID, "Should have found the correct child PID")
+	Assert(t).AreEqual(200*time.Second, statRes.ChildTime, "Should have found the correct child PID Time")
+
+	statRes, err = showToStatResult("ActiveState=inactive\nMainPID=0\nExecMainStartTimestamp=\n", now)
+	Assert(t).IsNil(err, "should not have failed to parse show output")
+	Assert(t).AreEqual(runit.STATUS_DOWN, statRes.ChildStatus, "Should have had a stopped child")
+}
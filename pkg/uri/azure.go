@@ -0,0 +1,424 @@
+package uri
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/square/p2/pkg/util"
+)
+
+const (
+	// The Blob service REST API version requested. OAuth tokens require
+	// at least 2017-11-09
+	azureStorageVersion = "2017-11-09"
+	// The OAuth resource that grants access to Azure Storage
+	azureStorageResource = "https://storage.azure.com/"
+
+	defaultAzureAuthority   = "https://login.microsoftonline.com"
+	defaultAzureMSIEndpoint = "http://169.254.169.254/metadata/identity/oauth2/token"
+
+	// Tokens are refreshed this long before they expire
+	azureTokenRefreshWindow = 5 * time.Minute
+)
+
+// AzureServicePrincipal holds the credentials of an Azure AD application
+// granted access to the storage account.
+type AzureServicePrincipal struct {
+	TenantID     string `yaml:"tenant_id"`
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+
+	// Defaults to https://login.microsoftonline.com
+	AuthorityURL string `yaml:"authority_url,omitempty"`
+}
+
+// AzureFetcherOptions configure an AzureFetcher. Exactly one of
+// ConnectionString, ServicePrincipal and UseMSI must be set.
+type AzureFetcherOptions struct {
+	// The storage account to read from. Not needed with a
+	// ConnectionString, which names the account itself
+	AccountName string `yaml:"account_name,omitempty"`
+
+	// Overrides the blob endpoint, which defaults to
+	// https://<AccountName>.blob.core.windows.net
+	Endpoint string `yaml:"endpoint,omitempty"`
+
+	// A storage account connection string containing either an
+	// AccountKey or a SharedAccessSignature, as shown in the Azure portal
+	ConnectionString string `yaml:"connection_string,omitempty"`
+
+	ServicePrincipal *AzureServicePrincipal `yaml:"service_principal,omitempty"`
+
+	// Authenticate with the managed identity of the VM. MSIClientID
+	// selects a user-assigned identity, otherwise the system-assigned
+	// identity is used
+	UseMSI      bool   `yaml:"use_msi,omitempty"`
+	MSIClientID string `yaml:"msi_client_id,omitempty"`
+	// Defaults to the Azure instance metadata service
+	MSIEndpoint string `yaml:"msi_endpoint,omitempty"`
+
+	// Used for all requests. Defaults to http.DefaultClient
+	Client *http.Client `yaml:"-"`
+}
+
+// AzureFetcher fetches "az://container/blob" URIs from Azure Blob Storage.
+// URIs with any other scheme are handled by a BasicFetcher using the same
+// HTTP client, so an AzureFetcher can be used wherever a Fetcher is.
+type AzureFetcher struct {
+	client   *http.Client
+	endpoint *url.URL
+	account  string
+	fallback BasicFetcher
+
+	// Exactly one of these is set, depending on the credential
+	// configuration
+	accountKey   []byte
+	sasQuery     url.Values
+	tokenRequest func() (*http.Request, error)
+
+	tokenLock    sync.Mutex
+	token        string
+	tokenExpires time.Time
+}
+
+var _ Fetcher = &AzureFetcher{}
+
+func NewAzureFetcher(opts AzureFetcherOptions) (*AzureFetcher, error) {
+	client := opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	f := &AzureFetcher{
+		client:   client,
+		account:  opts.AccountName,
+		fallback: BasicFetcher{Client: client},
+	}
+
+	configured := 0
+	endpoint := opts.Endpoint
+	if opts.ConnectionString != "" {
+		configured++
+		var err error
+		endpoint, err = f.parseConnectionString(opts.ConnectionString, endpoint)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if opts.ServicePrincipal != nil {
+		configured++
+		f.tokenRequest = servicePrincipalTokenRequest(*opts.ServicePrincipal)
+	}
+	if opts.UseMSI {
+		configured++
+		f.tokenRequest = msiTokenRequest(opts.MSIEndpoint, opts.MSIClientID)
+	}
+	if configured != 1 {
+		return nil, util.Errorf("Exactly one of a connection string, service principal or MSI must be configured for Azure, got %d", configured)
+	}
+
+	if f.account == "" {
+		return nil, util.Errorf("No Azure storage account name configured")
+	}
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.blob.core.windows.net", f.account)
+	}
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, util.Errorf("Invalid Azure blob endpoint %q: %s", endpoint, err)
+	}
+	f.endpoint = endpointURL
+	return f, nil
+}
+
+// parseConnectionString configures the fetcher's credentials from a
+// connection string and returns the blob endpoint it names, if any. An
+// endpoint given in the options takes precedence.
+func (f *AzureFetcher) parseConnectionString(connectionString string, endpoint string) (string, error) {
+	settings := make(map[string]string)
+	for _, part := range strings.Split(connectionString, ";") {
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return "", util.Errorf("Invalid Azure connection string: %q is not in KEY=VALUE form", part)
+		}
+		settings[kv[0]] = kv[1]
+	}
+
+	if name := settings["AccountName"]; name != "" {
+		f.account = name
+	}
+	switch {
+	case settings["AccountKey"] != "":
+		key, err := base64.StdEncoding.DecodeString(settings["AccountKey"])
+		if err != nil {
+			return "", util.Errorf("Invalid AccountKey in Azure connection string: %s", err)
+		}
+		f.accountKey = key
+	case settings["SharedAccessSignature"] != "":
+		query, err := url.ParseQuery(strings.TrimPrefix(settings["SharedAccessSignature"], "?"))
+		if err != nil {
+			return "", util.Errorf("Invalid SharedAccessSignature in Azure connection string: %s", err)
+		}
+		f.sasQuery = query
+	default:
+		return "", util.Errorf("Azure connection string must contain an AccountKey or SharedAccessSignature")
+	}
+
+	if endpoint != "" {
+		return endpoint, nil
+	}
+	if blobEndpoint := settings["BlobEndpoint"]; blobEndpoint != "" {
+		return blobEndpoint, nil
+	}
+	if suffix := settings["EndpointSuffix"]; suffix != "" && f.account != "" {
+		protocol := settings["DefaultEndpointsProtocol"]
+		if protocol == "" {
+			protocol = "https"
+		}
+		return fmt.Sprintf("%s://%s.blob.%s", protocol, f.account, suffix), nil
+	}
+	return "", nil
+}
+
+func (f *AzureFetcher) Open(u *url.URL) (io.ReadCloser, error) {
+	if u.Scheme != "az" {
+		return f.fallback.Open(u)
+	}
+	resp, err := f.do("GET", u)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, util.Errorf("%q: Azure returned status: %s", u.String(), resp.Status)
+	}
+	return resp.Body, nil
+}
+
+func (f *AzureFetcher) Head(u *url.URL) (*http.Response, error) {
+	if u.Scheme != "az" {
+		return f.fallback.Head(u)
+	}
+	return f.do("HEAD", u)
+}
+
+func (f *AzureFetcher) CopyLocal(srcUri *url.URL, dstPath string) (err error) {
+	src, err := f.Open(srcUri)
+	if err != nil {
+		return
+	}
+	defer src.Close()
+	dest, err := os.Create(dstPath)
+	if err != nil {
+		return
+	}
+	defer func() {
+		// Return the Close() error unless another error happened first
+		if errC := dest.Close(); err == nil {
+			err = errC
+		}
+	}()
+	_, err = io.Copy(dest, src)
+	return
+}
+
+// blobURL returns the REST endpoint of the blob named by an az:// URI.
+func (f *AzureFetcher) blobURL(u *url.URL) (*url.URL, error) {
+	container := u.Host
+	blob := strings.TrimPrefix(u.Path, "/")
+	if container == "" || blob == "" {
+		return nil, util.Errorf("%q: Azure URIs must be of the form az://container/blob", u.String())
+	}
+
+	blobURL := &url.URL{}
+	*blobURL = *f.endpoint
+	blobURL.Path = strings.TrimSuffix(f.endpoint.Path, "/") + "/" + container + "/" + blob
+	blobURL.RawQuery = ""
+	if f.sasQuery != nil {
+		blobURL.RawQuery = f.sasQuery.Encode()
+	}
+	return blobURL, nil
+}
+
+func (f *AzureFetcher) do(method string, u *url.URL) (*http.Response, error) {
+	blobURL, err := f.blobURL(u)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, blobURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("x-ms-version", azureStorageVersion)
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+
+	switch {
+	case f.accountKey != nil:
+		req.Header.Set("Authorization", fmt.Sprintf("SharedKey %s:%s", f.account, f.sharedKeySignature(req)))
+	case f.tokenRequest != nil:
+		token, err := f.accessToken()
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return f.client.Do(req)
+}
+
+// sharedKeySignature signs a request with the account key as described at
+// https://docs.microsoft.com/en-us/rest/api/storageservices/authorize-with-shared-key
+func (f *AzureFetcher) sharedKeySignature(req *http.Request) string {
+	var msHeaders []string
+	for name := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-ms-") {
+			msHeaders = append(msHeaders, lower)
+		}
+	}
+	sort.Strings(msHeaders)
+	var canonicalHeaders string
+	for _, name := range msHeaders {
+		canonicalHeaders += name + ":" + strings.TrimSpace(req.Header.Get(name)) + "\n"
+	}
+
+	canonicalResource := "/" + f.account + req.URL.EscapedPath()
+	query := req.URL.Query()
+	var params []string
+	for name := range query {
+		params = append(params, name)
+	}
+	sort.Strings(params)
+	for _, name := range params {
+		values := query[name]
+		sort.Strings(values)
+		canonicalResource += "\n" + strings.ToLower(name) + ":" + strings.Join(values, ",")
+	}
+
+	stringToSign := strings.Join([]string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		"", // Content-Length, empty for requests without a body
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		"", // Date, superseded by x-ms-date
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+		canonicalHeaders + canonicalResource,
+	}, "\n")
+
+	mac := hmac.New(sha256.New, f.accountKey)
+	_, _ = mac.Write([]byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// accessToken returns a cached OAuth token for Azure Storage, requesting a
+// new one if it is about to expire.
+func (f *AzureFetcher) accessToken() (string, error) {
+	f.tokenLock.Lock()
+	defer f.tokenLock.Unlock()
+	if f.token != "" && time.Now().Add(azureTokenRefreshWindow).Before(f.tokenExpires) {
+		return f.token, nil
+	}
+
+	req, err := f.tokenRequest()
+	if err != nil {
+		return "", err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return "", util.Errorf("Could not request an Azure access token: %s", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", util.Errorf("Could not read Azure access token response: %s", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", util.Errorf("Azure access token request returned status %s: %s", resp.Status, body)
+	}
+
+	// expires_in is a string in MSI responses and a number in AAD v2
+	// responses, so it is decoded as raw JSON
+	var token struct {
+		AccessToken string          `json:"access_token"`
+		ExpiresIn   json.RawMessage `json:"expires_in"`
+	}
+	err = json.Unmarshal(body, &token)
+	if err != nil {
+		return "", util.Errorf("Could not decode Azure access token response: %s", err)
+	}
+	if token.AccessToken == "" {
+		return "", util.Errorf("Azure access token response contained no token")
+	}
+	expiresIn, err := strconv.Atoi(strings.Trim(string(token.ExpiresIn), `"`))
+	if err != nil {
+		// Don't cache tokens whose lifetime is unknown
+		expiresIn = 0
+	}
+
+	f.token = token.AccessToken
+	f.tokenExpires = time.Now().Add(time.Duration(expiresIn) * time.Second)
+	return f.token, nil
+}
+
+func servicePrincipalTokenRequest(sp AzureServicePrincipal) func() (*http.Request, error) {
+	return func() (*http.Request, error) {
+		authority := sp.AuthorityURL
+		if authority == "" {
+			authority = defaultAzureAuthority
+		}
+		form := url.Values{
+			"grant_type":    {"client_credentials"},
+			"client_id":     {sp.ClientID},
+			"client_secret": {sp.ClientSecret},
+			"scope":         {azureStorageResource + ".default"},
+		}
+		tokenURL := strings.TrimSuffix(authority, "/") + "/" + sp.TenantID + "/oauth2/v2.0/token"
+		req, err := http.NewRequest("POST", tokenURL, strings.NewReader(form.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req, nil
+	}
+}
+
+func msiTokenRequest(endpoint string, clientID string) func() (*http.Request, error) {
+	return func() (*http.Request, error) {
+		if endpoint == "" {
+			endpoint = defaultAzureMSIEndpoint
+		}
+		query := url.Values{
+			"api-version": {"2018-02-01"},
+			"resource":    {azureStorageResource},
+		}
+		if clientID != "" {
+			query.Set("client_id", clientID)
+		}
+		req, err := http.NewRequest("GET", endpoint+"?"+query.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Metadata", "true")
+		return req, nil
+	}
+}
@@ -0,0 +1,226 @@
+package uri
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	testAzureAccount = "p2test"
+	testAzureBlob    = "hello-server_abc123.tar.gz"
+)
+
+var (
+	testAzureKey      = []byte("not a real account key")
+	testAzureContents = []byte("the artifact")
+)
+
+// fakeBlobStorage serves testAzureContents at
+// /artifacts/hello-server_abc123.tar.gz to requests that authorize, and
+// access tokens at /token and /<tenant>/oauth2/v2.0/token
+type fakeBlobStorage struct {
+	authorize     func(r *http.Request) bool
+	tokenRequests int
+}
+
+func (s *fakeBlobStorage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/token" || strings.HasSuffix(r.URL.Path, "/oauth2/v2.0/token"):
+		s.tokenRequests++
+		fmt.Fprint(w, `{"access_token": "the-token", "expires_in": "3600"}`)
+	case r.URL.Path == "/artifacts/"+testAzureBlob:
+		if r.Header.Get("x-ms-version") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if !s.authorize(r) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write(testAzureContents)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func bearerAuthorized(r *http.Request) bool {
+	return r.Header.Get("Authorization") == "Bearer the-token"
+}
+
+func testAzureURI(t *testing.T, blob string) *url.URL {
+	u, err := url.Parse("az://artifacts/" + blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func testAzureCopyLocal(t *testing.T, fetcher *AzureFetcher) {
+	tempdir, err := ioutil.TempDir("", "azure-fetcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	dst := filepath.Join(tempdir, "artifact")
+	err = fetcher.CopyLocal(testAzureURI(t, testAzureBlob), dst)
+	if err != nil {
+		t.Fatalf("could not copy blob: %s", err)
+	}
+	copied, err := ioutil.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(copied) != string(testAzureContents) {
+		t.Errorf("expected to download %q, got %q", testAzureContents, copied)
+	}
+}
+
+func TestAzureFetcherConnectionStringAccountKey(t *testing.T) {
+	storage := &fakeBlobStorage{
+		authorize: func(r *http.Request) bool {
+			stringToSign := fmt.Sprintf(
+				"GET\n\n\n\n\n\n\n\n\n\n\n\nx-ms-date:%s\nx-ms-version:%s\n/%s/artifacts/%s",
+				r.Header.Get("x-ms-date"),
+				r.Header.Get("x-ms-version"),
+				testAzureAccount,
+				testAzureBlob,
+			)
+			mac := hmac.New(sha256.New, testAzureKey)
+			_, _ = mac.Write([]byte(stringToSign))
+			expected := fmt.Sprintf("SharedKey %s:%s", testAzureAccount, base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+			return r.Header.Get("Authorization") == expected
+		},
+	}
+	server := httptest.NewServer(storage)
+	defer server.Close()
+
+	fetcher, err := NewAzureFetcher(AzureFetcherOptions{
+		ConnectionString: fmt.Sprintf(
+			"DefaultEndpointsProtocol=http;AccountName=%s;AccountKey=%s;BlobEndpoint=%s",
+			testAzureAccount,
+			base64.StdEncoding.EncodeToString(testAzureKey),
+			server.URL,
+		),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testAzureCopyLocal(t, fetcher)
+}
+
+func TestAzureFetcherConnectionStringSAS(t *testing.T) {
+	storage := &fakeBlobStorage{
+		authorize: func(r *http.Request) bool {
+			return r.URL.Query().Get("sig") == "signed" && r.Header.Get("Authorization") == ""
+		},
+	}
+	server := httptest.NewServer(storage)
+	defer server.Close()
+
+	fetcher, err := NewAzureFetcher(AzureFetcherOptions{
+		ConnectionString: fmt.Sprintf("BlobEndpoint=%s;SharedAccessSignature=sv=2017-11-09&sig=signed", server.URL),
+		AccountName:      testAzureAccount,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testAzureCopyLocal(t, fetcher)
+}
+
+func TestAzureFetcherServicePrincipal(t *testing.T) {
+	storage := &fakeBlobStorage{authorize: bearerAuthorized}
+	server := httptest.NewServer(storage)
+	defer server.Close()
+
+	fetcher, err := NewAzureFetcher(AzureFetcherOptions{
+		AccountName: testAzureAccount,
+		Endpoint:    server.URL,
+		ServicePrincipal: &AzureServicePrincipal{
+			TenantID:     "tenant",
+			ClientID:     "client",
+			ClientSecret: "secret",
+			AuthorityURL: server.URL,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testAzureCopyLocal(t, fetcher)
+	testAzureCopyLocal(t, fetcher)
+	if storage.tokenRequests != 1 {
+		t.Errorf("expected the token to be requested once and cached, was requested %d times", storage.tokenRequests)
+	}
+}
+
+func TestAzureFetcherMSI(t *testing.T) {
+	storage := &fakeBlobStorage{authorize: bearerAuthorized}
+	server := httptest.NewServer(storage)
+	defer server.Close()
+
+	fetcher, err := NewAzureFetcher(AzureFetcherOptions{
+		AccountName: testAzureAccount,
+		Endpoint:    server.URL,
+		UseMSI:      true,
+		MSIEndpoint: server.URL + "/token",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testAzureCopyLocal(t, fetcher)
+}
+
+func TestAzureFetcherMissingBlob(t *testing.T) {
+	storage := &fakeBlobStorage{authorize: bearerAuthorized}
+	server := httptest.NewServer(storage)
+	defer server.Close()
+
+	fetcher, err := NewAzureFetcher(AzureFetcherOptions{
+		AccountName: testAzureAccount,
+		Endpoint:    server.URL,
+		UseMSI:      true,
+		MSIEndpoint: server.URL + "/token",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = fetcher.Open(testAzureURI(t, "missing.tar.gz"))
+	if err == nil {
+		t.Error("expected an error opening a missing blob")
+	}
+	resp, err := fetcher.Head(testAzureURI(t, "missing.tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected HEAD of a missing blob to return 404, got %d", resp.StatusCode)
+	}
+}
+
+func TestAzureFetcherRequiresOneCredential(t *testing.T) {
+	_, err := NewAzureFetcher(AzureFetcherOptions{AccountName: testAzureAccount})
+	if err == nil {
+		t.Error("expected an error with no credentials configured")
+	}
+
+	_, err = NewAzureFetcher(AzureFetcherOptions{
+		AccountName:      testAzureAccount,
+		UseMSI:           true,
+		ServicePrincipal: &AzureServicePrincipal{TenantID: "tenant"},
+	})
+	if err == nil {
+		t.Error("expected an error with two credentials configured")
+	}
+}
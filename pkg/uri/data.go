@@ -0,0 +1,83 @@
+package uri
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/square/p2/pkg/util"
+)
+
+// DataFetcher serves "data" URIs (RFC 2397) whose payload is base64 encoded,
+// e.g. data:application/octet-stream;base64,aGVsbG8=. The content is embedded
+// in the URI itself so no I/O is performed, which makes it useful for small
+// inline artifacts and for hermetic tests.
+type DataFetcher struct{}
+
+var _ Fetcher = DataFetcher{}
+
+func (f DataFetcher) Open(u *url.URL) (io.ReadCloser, error) {
+	_, data, err := parseDataURI(u)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (f DataFetcher) Head(u *url.URL) (*http.Response, error) {
+	mediaType, data, err := parseDataURI(u)
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{}
+	header.Set("Content-Type", mediaType)
+	header.Set("Content-Length", strconv.Itoa(len(data)))
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Header:        header,
+		ContentLength: int64(len(data)),
+		Body:          ioutil.NopCloser(bytes.NewReader(nil)),
+	}, nil
+}
+
+func (f DataFetcher) CopyLocal(srcUri *url.URL, dstPath string) error {
+	_, data, err := parseDataURI(srcUri)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dstPath, data, 0644)
+}
+
+// parseDataURI returns the media type and decoded payload of a data URI.
+func parseDataURI(u *url.URL) (string, []byte, error) {
+	if u.Scheme != "data" {
+		return "", nil, util.Errorf("%q: expected a data URI", u.String())
+	}
+
+	// data URIs have no "//", so url.Parse leaves everything after the
+	// scheme in Opaque
+	parts := strings.SplitN(u.Opaque, ",", 2)
+	if len(parts) != 2 {
+		return "", nil, util.Errorf("%q: data URI has no payload", u.String())
+	}
+	mediaType, payload := parts[0], parts[1]
+	if !strings.HasSuffix(mediaType, ";base64") {
+		return "", nil, util.Errorf("%q: only base64 encoded data URIs are supported", u.String())
+	}
+	mediaType = strings.TrimSuffix(mediaType, ";base64")
+	if mediaType == "" {
+		mediaType = "text/plain;charset=US-ASCII"
+	}
+
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return "", nil, util.Errorf("%q: could not decode data URI payload: %s", u.String(), err)
+	}
+	return mediaType, data, nil
+}
@@ -0,0 +1,93 @@
+package uri
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"math/rand"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDataFetcherCopyLocal(t *testing.T) {
+	blob := make([]byte, 1024)
+	_, err := rand.New(rand.NewSource(1)).Read(blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse("data:application/octet-stream;base64," + base64.StdEncoding.EncodeToString(blob))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tempdir, err := ioutil.TempDir("", "data-fetcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	dst := filepath.Join(tempdir, "blob")
+	err = DataFetcher{}.CopyLocal(u, dst)
+	if err != nil {
+		t.Fatalf("could not copy data URI: %s", err)
+	}
+
+	copied, err := ioutil.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(copied, blob) {
+		t.Error("decoded bytes did not match the original blob")
+	}
+
+	resp, err := DataFetcher{}.Head(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ContentLength != 1024 {
+		t.Errorf("expected content length 1024, got %d", resp.ContentLength)
+	}
+	if resp.Header.Get("Content-Type") != "application/octet-stream" {
+		t.Errorf("expected content type application/octet-stream, got %s", resp.Header.Get("Content-Type"))
+	}
+}
+
+func TestDataFetcherRejectsInvalidURIs(t *testing.T) {
+	for _, raw := range []string{
+		"data:text/plain,hello",
+		"data:application/octet-stream;base64",
+		"data:;base64,not-base64!",
+		"http://localhost/foo",
+	} {
+		u, err := url.Parse(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = DataFetcher{}.Open(u)
+		if err == nil {
+			t.Errorf("expected an error opening %s", raw)
+		}
+	}
+}
+
+func TestBasicFetcherOpensDataURIs(t *testing.T) {
+	u, err := url.Parse("data:;base64," + base64.StdEncoding.EncodeToString([]byte("hello")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := DefaultFetcher.Open(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "hello" {
+		t.Errorf("expected hello, got %q", content)
+	}
+}
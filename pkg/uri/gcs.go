@@ -0,0 +1,234 @@
+package uri
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/square/p2/pkg/util"
+)
+
+const (
+	defaultGCSEndpoint         = "https://storage.googleapis.com"
+	defaultGCSMetadataEndpoint = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+	// Tokens from the metadata server are refreshed this long before they
+	// expire
+	gcsTokenRefreshWindow = 5 * time.Minute
+)
+
+// GCSFetcherOptions configure a GCSFetcher. Exactly one of AccessToken and
+// UseMetadataServer must be set. AccessToken defaults to the
+// GOOGLE_OAUTH_ACCESS_TOKEN environment variable.
+type GCSFetcherOptions struct {
+	// An OAuth access token with read access to the buckets, e.g. from
+	// "gcloud auth print-access-token". It is never refreshed
+	AccessToken string `yaml:"access_token,omitempty"`
+
+	// Authenticate with the service account of the VM, requesting tokens
+	// from the GCE metadata server
+	UseMetadataServer bool `yaml:"use_metadata_server,omitempty"`
+	// Defaults to the token endpoint of the GCE metadata server
+	MetadataEndpoint string `yaml:"metadata_endpoint,omitempty"`
+
+	// Overrides the storage endpoint, which defaults to
+	// https://storage.googleapis.com
+	Endpoint string `yaml:"endpoint,omitempty"`
+
+	// Used for all requests. Defaults to http.DefaultClient
+	Client *http.Client `yaml:"-"`
+}
+
+// GCSFetcher fetches "gs://bucket/object" URIs from Google Cloud Storage, and
+// authenticates http and https URIs on the storage endpoint itself, such as
+// JSON API listings. Other URIs are handled by a BasicFetcher using the same
+// HTTP client, so a GCSFetcher can be used wherever a Fetcher is.
+type GCSFetcher struct {
+	client   *http.Client
+	endpoint *url.URL
+	fallback BasicFetcher
+
+	// Set to request tokens from the metadata server, otherwise token is
+	// used as is
+	metadataEndpoint string
+
+	tokenLock    sync.Mutex
+	token        string
+	tokenExpires time.Time
+}
+
+var _ Fetcher = &GCSFetcher{}
+
+func NewGCSFetcher(opts GCSFetcherOptions) (*GCSFetcher, error) {
+	client := opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if opts.AccessToken == "" && !opts.UseMetadataServer {
+		opts.AccessToken = os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN")
+	}
+	if (opts.AccessToken != "") == opts.UseMetadataServer {
+		return nil, util.Errorf("Exactly one of an access token or the metadata server must be configured for GCS")
+	}
+
+	f := &GCSFetcher{
+		client:   client,
+		fallback: BasicFetcher{Client: client},
+		token:    opts.AccessToken,
+	}
+	if opts.UseMetadataServer {
+		f.metadataEndpoint = opts.MetadataEndpoint
+		if f.metadataEndpoint == "" {
+			f.metadataEndpoint = defaultGCSMetadataEndpoint
+		}
+	}
+
+	endpoint := opts.Endpoint
+	if endpoint == "" {
+		endpoint = defaultGCSEndpoint
+	}
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, util.Errorf("Invalid GCS endpoint %q: %s", endpoint, err)
+	}
+	f.endpoint = endpointURL
+	return f, nil
+}
+
+// authenticates returns whether requests for a URI are sent with the
+// fetcher's credentials.
+func (f *GCSFetcher) authenticates(u *url.URL) bool {
+	return u.Scheme == "gs" || (u.Scheme == f.endpoint.Scheme && u.Host == f.endpoint.Host)
+}
+
+func (f *GCSFetcher) Open(u *url.URL) (io.ReadCloser, error) {
+	if !f.authenticates(u) {
+		return f.fallback.Open(u)
+	}
+	resp, err := f.do("GET", u)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, util.Errorf("%q: GCS returned status: %s", u.String(), resp.Status)
+	}
+	return resp.Body, nil
+}
+
+func (f *GCSFetcher) Head(u *url.URL) (*http.Response, error) {
+	if !f.authenticates(u) {
+		return f.fallback.Head(u)
+	}
+	return f.do("HEAD", u)
+}
+
+func (f *GCSFetcher) CopyLocal(srcUri *url.URL, dstPath string) (err error) {
+	src, err := f.Open(srcUri)
+	if err != nil {
+		return
+	}
+	defer src.Close()
+	dest, err := os.Create(dstPath)
+	if err != nil {
+		return
+	}
+	defer func() {
+		// Return the Close() error unless another error happened first
+		if errC := dest.Close(); err == nil {
+			err = errC
+		}
+	}()
+	_, err = io.Copy(dest, src)
+	return
+}
+
+// requestURL returns the URL on the storage endpoint of the object named by a
+// gs:// URI. Other URIs are requested as they are.
+func (f *GCSFetcher) requestURL(u *url.URL) (*url.URL, error) {
+	if u.Scheme != "gs" {
+		return u, nil
+	}
+	bucket := u.Host
+	object := strings.TrimPrefix(u.Path, "/")
+	if bucket == "" || object == "" {
+		return nil, util.Errorf("%q: GCS URIs must be of the form gs://bucket/object", u.String())
+	}
+
+	objectURL := &url.URL{}
+	*objectURL = *f.endpoint
+	objectURL.Path = strings.TrimSuffix(f.endpoint.Path, "/") + "/" + bucket + "/" + object
+	objectURL.RawPath = ""
+	objectURL.RawQuery = ""
+	return objectURL, nil
+}
+
+func (f *GCSFetcher) do(method string, u *url.URL) (*http.Response, error) {
+	requestURL, err := f.requestURL(u)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, requestURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	token, err := f.accessToken()
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return f.client.Do(req)
+}
+
+// accessToken returns the configured access token, or a cached token from the
+// metadata server, requesting a new one if it is about to expire.
+func (f *GCSFetcher) accessToken() (string, error) {
+	f.tokenLock.Lock()
+	defer f.tokenLock.Unlock()
+	if f.metadataEndpoint == "" {
+		return f.token, nil
+	}
+	if f.token != "" && time.Now().Add(gcsTokenRefreshWindow).Before(f.tokenExpires) {
+		return f.token, nil
+	}
+
+	req, err := http.NewRequest("GET", f.metadataEndpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return "", util.Errorf("Could not request a GCS access token: %s", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", util.Errorf("Could not read GCS access token response: %s", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", util.Errorf("GCS access token request returned status %s: %s", resp.Status, body)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	err = json.Unmarshal(body, &token)
+	if err != nil {
+		return "", util.Errorf("Could not decode GCS access token response: %s", err)
+	}
+	if token.AccessToken == "" {
+		return "", util.Errorf("GCS access token response contained no token")
+	}
+
+	f.token = token.AccessToken
+	f.tokenExpires = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	return f.token, nil
+}
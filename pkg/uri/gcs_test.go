@@ -0,0 +1,131 @@
+package uri
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// fakeGCS serves testAzureContents at /artifacts/<testAzureBlob> and a bucket
+// listing at /storage/v1/b/artifacts/o to requests with the token
+// "the-token", and serves that token from the metadata server at /token
+type fakeGCS struct {
+	tokenRequests int
+}
+
+func (s *fakeGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/token" {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		s.tokenRequests++
+		fmt.Fprint(w, `{"access_token": "the-token", "expires_in": 3600, "token_type": "Bearer"}`)
+		return
+	}
+	if !bearerAuthorized(r) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch r.URL.Path {
+	case "/artifacts/" + testAzureBlob:
+		_, _ = w.Write(testAzureContents)
+	case "/storage/v1/b/artifacts/o":
+		fmt.Fprint(w, `{"items": []}`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func testGCSOpen(t *testing.T, fetcher *GCSFetcher, uri string) []byte {
+	u, err := url.Parse(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := fetcher.Open(u)
+	if err != nil {
+		t.Fatalf("could not open %s: %s", uri, err)
+	}
+	defer data.Close()
+	contents, err := ioutil.ReadAll(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return contents
+}
+
+func TestGCSFetcherAccessToken(t *testing.T) {
+	gcs := &fakeGCS{}
+	server := httptest.NewServer(gcs)
+	defer server.Close()
+
+	fetcher, err := NewGCSFetcher(GCSFetcherOptions{
+		AccessToken: "the-token",
+		Endpoint:    server.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := testGCSOpen(t, fetcher, "gs://artifacts/"+testAzureBlob)
+	if string(contents) != string(testAzureContents) {
+		t.Errorf("expected the object to contain %q, got %q", testAzureContents, contents)
+	}
+	if gcs.tokenRequests != 0 {
+		t.Errorf("expected the configured token to be used, but %d were requested", gcs.tokenRequests)
+	}
+}
+
+func TestGCSFetcherMetadataServer(t *testing.T) {
+	gcs := &fakeGCS{}
+	server := httptest.NewServer(gcs)
+	defer server.Close()
+
+	fetcher, err := NewGCSFetcher(GCSFetcherOptions{
+		UseMetadataServer: true,
+		MetadataEndpoint:  server.URL + "/token",
+		Endpoint:          server.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testGCSOpen(t, fetcher, "gs://artifacts/"+testAzureBlob)
+	// URLs on the storage endpoint, such as listings, are authenticated too
+	testGCSOpen(t, fetcher, server.URL+"/storage/v1/b/artifacts/o?prefix=apps%2Fmyapp_")
+	if gcs.tokenRequests != 1 {
+		t.Errorf("expected the token to be requested once and cached, was requested %d times", gcs.tokenRequests)
+	}
+}
+
+func TestGCSFetcherMissingObject(t *testing.T) {
+	server := httptest.NewServer(&fakeGCS{})
+	defer server.Close()
+
+	fetcher, err := NewGCSFetcher(GCSFetcherOptions{
+		AccessToken: "the-token",
+		Endpoint:    server.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse("gs://artifacts/missing.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = fetcher.Open(u)
+	if err == nil {
+		t.Error("expected an error opening a missing object")
+	}
+}
+
+func TestGCSFetcherRequiresOneCredential(t *testing.T) {
+	_, err := NewGCSFetcher(GCSFetcherOptions{
+		AccessToken:       "the-token",
+		UseMetadataServer: true,
+	})
+	if err == nil {
+		t.Error("expected an error with two credentials configured")
+	}
+}
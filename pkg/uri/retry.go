@@ -0,0 +1,211 @@
+package uri
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/square/p2/pkg/util"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultInitialBackoff = 1 * time.Second
+	defaultMaxBackoff     = 1 * time.Minute
+
+	// The most bytes read from a response body between waits for the
+	// bandwidth limit
+	bandwidthChunkSize = 32 * 1024
+)
+
+// RetryPolicy controls how a BasicFetcher retries HTTP downloads that fail
+// with a network error or a 5xx or 429 status, and resumes downloads that are
+// interrupted part way through with a Range request. The zero value makes a
+// single attempt.
+type RetryPolicy struct {
+	// The most requests made for one download, counting the first request
+	// and every resume
+	MaxAttempts int `yaml:"max_attempts,omitempty"`
+	// How long to wait before the first retry. The wait doubles after each
+	// failed attempt, up to MaxBackoff. Default 1s
+	InitialBackoff time.Duration `yaml:"initial_backoff,omitempty"`
+	// Default 1m
+	MaxBackoff time.Duration `yaml:"max_backoff,omitempty"`
+}
+
+func (p RetryPolicy) maxAttempts() int {
+	if p.MaxAttempts < 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// backoff returns how long to wait after the given (1-indexed) attempt failed.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	backoff := p.InitialBackoff
+	if backoff <= 0 {
+		backoff = defaultInitialBackoff
+	}
+	maxBackoff := p.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = defaultMaxBackoff
+	}
+	for i := 1; i < attempt && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		return maxBackoff
+	}
+	return backoff
+}
+
+// BandwidthLimit caps the combined rate at which every BasicFetcher sharing it
+// reads HTTP response bodies.
+type BandwidthLimit struct {
+	limiter *rate.Limiter
+}
+
+func NewBandwidthLimit(bytesPerSecond int) *BandwidthLimit {
+	return &BandwidthLimit{
+		limiter: rate.NewLimiter(rate.Limit(bytesPerSecond), bandwidthChunkSize),
+	}
+}
+
+// wait blocks until n more bytes may be read.
+func (b *BandwidthLimit) wait(n int) {
+	time.Sleep(b.limiter.ReserveN(time.Now(), n).Delay())
+}
+
+// retriableError is a failed request that may succeed if it is made again.
+type retriableError struct{ error }
+
+// resumableBody is the body of an HTTP download. If reading it fails part way
+// through, the rest is requested from where it stopped.
+type resumableBody struct {
+	client *http.Client
+	url    *url.URL
+	retry  RetryPolicy
+	limit  *BandwidthLimit
+
+	body     io.ReadCloser
+	offset   int64
+	attempts int
+	// The ETag or Last-Modified time of the first response, so that a
+	// resume fails rather than splicing together two different artifacts
+	validator string
+	// Once the body can't be resumed, every read fails with this error
+	err error
+}
+
+func (f BasicFetcher) openHTTP(u *url.URL) (io.ReadCloser, error) {
+	b := &resumableBody{
+		client: f.Client,
+		url:    u,
+		retry:  f.Retry,
+		limit:  f.BandwidthLimit,
+	}
+	err := b.get()
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// get requests the rest of the body, retrying with backoff until the retry
+// policy's attempts are used up.
+func (b *resumableBody) get() error {
+	for {
+		b.attempts++
+		body, err := b.request()
+		if err == nil {
+			b.body = body
+			return nil
+		}
+		retriable, ok := err.(retriableError)
+		if !ok {
+			return err
+		}
+		if b.attempts >= b.retry.maxAttempts() {
+			return retriable.error
+		}
+		time.Sleep(b.retry.backoff(b.attempts))
+	}
+}
+
+func (b *resumableBody) request() (io.ReadCloser, error) {
+	req, err := http.NewRequest("GET", b.url.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if b.offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", b.offset))
+		if b.validator != "" {
+			req.Header.Set("If-Range", b.validator)
+		}
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, retriableError{err}
+	}
+	switch {
+	case b.offset == 0 && resp.StatusCode == http.StatusOK:
+		b.validator = resp.Header.Get("ETag")
+		if b.validator == "" {
+			b.validator = resp.Header.Get("Last-Modified")
+		}
+		return resp.Body, nil
+	case b.offset > 0 && resp.StatusCode == http.StatusPartialContent:
+		return resp.Body, nil
+	}
+
+	_ = resp.Body.Close()
+	if b.offset > 0 && resp.StatusCode == http.StatusOK {
+		return nil, util.Errorf("%q: could not resume download at byte %d: the server ignored the range or the file changed", b.url.String(), b.offset)
+	}
+	err = util.Errorf("%q: HTTP server returned status: %s", b.url.String(), resp.Status)
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return nil, retriableError{err}
+	}
+	return nil, err
+}
+
+func (b *resumableBody) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	if b.limit != nil && len(p) > bandwidthChunkSize {
+		p = p[:bandwidthChunkSize]
+	}
+
+	n, err := b.body.Read(p)
+	b.offset += int64(n)
+	if b.limit != nil && n > 0 {
+		b.limit.wait(n)
+	}
+	if err == nil || err == io.EOF {
+		return n, err
+	}
+
+	_ = b.body.Close()
+	b.body = nil
+	if b.attempts >= b.retry.maxAttempts() {
+		b.err = err
+	} else if resumeErr := b.get(); resumeErr != nil {
+		b.err = util.Errorf("%s, and could not resume: %s", err, resumeErr)
+	}
+	if b.err != nil && n == 0 {
+		return 0, b.err
+	}
+	return n, nil
+}
+
+func (b *resumableBody) Close() error {
+	if b.body == nil {
+		return nil
+	}
+	return b.body.Close()
+}
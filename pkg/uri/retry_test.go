@@ -0,0 +1,154 @@
+package uri
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var fastRetry = RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+// flakyServer serves body, failing the first failures requests with a 503
+// and cutting off the first successful response after cutAfter bytes.
+type flakyServer struct {
+	body     string
+	failures int
+	cutAfter int
+
+	mu     sync.Mutex
+	ranges []string
+}
+
+func (s *flakyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures > 0 {
+		s.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	s.ranges = append(s.ranges, r.Header.Get("Range"))
+	w.Header().Set("ETag", `"v1"`)
+
+	if r.Header.Get("Range") != "" {
+		var offset int
+		_, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &offset)
+		if err != nil || r.Header.Get("If-Range") != `"v1"` {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, len(s.body)-1, len(s.body)))
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write([]byte(s.body[offset:]))
+		return
+	}
+
+	if s.cutAfter > 0 {
+		cutAfter := s.cutAfter
+		s.cutAfter = 0
+		w.Header().Set("Content-Length", fmt.Sprint(len(s.body)))
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(s.body[:cutAfter]))
+		w.(http.Flusher).Flush()
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			_ = conn.Close()
+		}
+		return
+	}
+	_, _ = w.Write([]byte(s.body))
+}
+
+func fetchAll(t *testing.T, fetcher Fetcher, server *httptest.Server) (string, error) {
+	u, err := url.Parse(server.URL + "/artifact.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := fetcher.Open(u)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	data, err := ioutil.ReadAll(body)
+	return string(data), err
+}
+
+func TestRetryOnServerError(t *testing.T) {
+	handler := &flakyServer{body: "hello", failures: 2}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	data, err := fetchAll(t, BasicFetcher{Client: http.DefaultClient, Retry: fastRetry}, server)
+	if err != nil {
+		t.Fatalf("expected the download to succeed on the third attempt, got %s", err)
+	}
+	if data != "hello" {
+		t.Errorf("expected %q, got %q", "hello", data)
+	}
+
+	handler.failures = 3
+	_, err = fetchAll(t, BasicFetcher{Client: http.DefaultClient, Retry: fastRetry}, server)
+	if err == nil {
+		t.Error("expected the download to fail once its attempts were used up")
+	}
+}
+
+func TestResumeInterruptedDownload(t *testing.T) {
+	body := strings.Repeat("0123456789", 1000)
+	handler := &flakyServer{body: body, cutAfter: 4000}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	data, err := fetchAll(t, BasicFetcher{Client: http.DefaultClient, Retry: fastRetry}, server)
+	if err != nil {
+		t.Fatalf("expected the interrupted download to be resumed, got %s", err)
+	}
+	if data != body {
+		t.Errorf("expected the resumed download to have %d bytes, got %d", len(body), len(data))
+	}
+	if len(handler.ranges) != 2 || handler.ranges[1] != "bytes=4000-" {
+		t.Errorf("expected the download to be resumed at byte 4000, got the ranges %q", handler.ranges)
+	}
+
+	handler.cutAfter = 4000
+	_, err = fetchAll(t, BasicFetcher{Client: http.DefaultClient}, server)
+	if err == nil {
+		t.Error("expected an interrupted download to fail without a retry policy")
+	}
+}
+
+func TestBandwidthLimit(t *testing.T) {
+	body := strings.Repeat("x", 3*bandwidthChunkSize)
+	server := httptest.NewServer(&flakyServer{body: body})
+	defer server.Close()
+
+	// The first chunk is allowed as a burst, the other two take a second
+	// each
+	fetcher := BasicFetcher{Client: http.DefaultClient, BandwidthLimit: NewBandwidthLimit(bandwidthChunkSize)}
+	start := time.Now()
+	data, err := fetchAll(t, fetcher, server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != len(body) {
+		t.Errorf("expected %d bytes, got %d", len(body), len(data))
+	}
+	if elapsed := time.Since(start); elapsed < 1500*time.Millisecond {
+		t.Errorf("expected the download to be limited to %d bytes per second, it took %s", bandwidthChunkSize, elapsed)
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	for attempt, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if backoff := policy.backoff(attempt + 1); backoff != expected {
+			t.Errorf("expected a backoff of %s after attempt %d, got %s", expected, attempt+1, backoff)
+		}
+	}
+}
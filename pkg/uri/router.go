@@ -0,0 +1,82 @@
+package uri
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/square/p2/pkg/util"
+)
+
+// MultiSchemeRouter is a Fetcher that forwards each call to the Fetcher
+// registered for the URI's scheme, so that callers don't have to choose a
+// fetcher themselves. A schemeless URI is routed to the fetcher registered
+// for the empty scheme, if any.
+type MultiSchemeRouter struct {
+	mu       sync.RWMutex
+	fetchers map[string]Fetcher
+}
+
+var _ Fetcher = &MultiSchemeRouter{}
+
+func NewMultiSchemeRouter() *MultiSchemeRouter {
+	return &MultiSchemeRouter{fetchers: make(map[string]Fetcher)}
+}
+
+// DefaultRouter returns a router for the schemes that need no configuration:
+// local paths, "file", "http", "https" and "data". Fetchers that need
+// credentials, such as an AzureFetcher for "az" or an S3Fetcher for "s3", must
+// be registered by the caller.
+func DefaultRouter() *MultiSchemeRouter {
+	r := NewMultiSchemeRouter()
+	basic := BasicFetcher{Client: http.DefaultClient}
+	for _, scheme := range []string{"", "file", "http", "https"} {
+		r.Register(scheme, basic)
+	}
+	r.Register("data", DataFetcher{})
+	return r
+}
+
+// Register routes URIs with the given scheme to fetcher, replacing any
+// fetcher already registered for it. Schemes are case insensitive.
+func (r *MultiSchemeRouter) Register(scheme string, fetcher Fetcher) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fetchers[strings.ToLower(scheme)] = fetcher
+}
+
+func (r *MultiSchemeRouter) fetcherFor(u *url.URL) (Fetcher, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	fetcher, ok := r.fetchers[strings.ToLower(u.Scheme)]
+	if !ok {
+		return nil, util.Errorf("%q: no fetcher is registered for scheme %q", u.String(), u.Scheme)
+	}
+	return fetcher, nil
+}
+
+func (r *MultiSchemeRouter) Open(u *url.URL) (io.ReadCloser, error) {
+	fetcher, err := r.fetcherFor(u)
+	if err != nil {
+		return nil, err
+	}
+	return fetcher.Open(u)
+}
+
+func (r *MultiSchemeRouter) Head(u *url.URL) (*http.Response, error) {
+	fetcher, err := r.fetcherFor(u)
+	if err != nil {
+		return nil, err
+	}
+	return fetcher.Head(u)
+}
+
+func (r *MultiSchemeRouter) CopyLocal(srcUri *url.URL, dstPath string) error {
+	fetcher, err := r.fetcherFor(srcUri)
+	if err != nil {
+		return err
+	}
+	return fetcher.CopyLocal(srcUri, dstPath)
+}
@@ -0,0 +1,63 @@
+package uri
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// recordingFetcher records the URIs it is asked to copy
+type recordingFetcher struct {
+	copied []string
+}
+
+func (f *recordingFetcher) Open(u *url.URL) (io.ReadCloser, error) {
+	return nil, nil
+}
+
+func (f *recordingFetcher) Head(u *url.URL) (*http.Response, error) {
+	return nil, nil
+}
+
+func (f *recordingFetcher) CopyLocal(srcUri *url.URL, dstPath string) error {
+	f.copied = append(f.copied, srcUri.String())
+	return nil
+}
+
+func TestMultiSchemeRouterDispatchesByScheme(t *testing.T) {
+	s3 := &recordingFetcher{}
+	gs := &recordingFetcher{}
+	router := NewMultiSchemeRouter()
+	router.Register("s3", s3)
+	router.Register("gs", gs)
+
+	for _, raw := range []string{"s3://bucket/a.tar.gz", "gs://bucket/b.tar.gz", "S3://bucket/c.tar.gz"} {
+		u, err := url.Parse(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = router.CopyLocal(u, "/dev/null")
+		if err != nil {
+			t.Errorf("unexpected error copying %s: %s", raw, err)
+		}
+	}
+
+	if len(s3.copied) != 2 || s3.copied[0] != "s3://bucket/a.tar.gz" || s3.copied[1] != "s3://bucket/c.tar.gz" {
+		t.Errorf("expected the s3 fetcher to receive only the s3 URIs, got %v", s3.copied)
+	}
+	if len(gs.copied) != 1 || gs.copied[0] != "gs://bucket/b.tar.gz" {
+		t.Errorf("expected the gs fetcher to receive only the gs URI, got %v", gs.copied)
+	}
+}
+
+func TestMultiSchemeRouterUnknownScheme(t *testing.T) {
+	router := DefaultRouter()
+	u, err := url.Parse("s3://bucket/a.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if router.CopyLocal(u, "/dev/null") == nil {
+		t.Error("expected an error copying a URI with no registered fetcher")
+	}
+}
@@ -0,0 +1,287 @@
+package uri
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/square/p2/pkg/util"
+)
+
+const (
+	s3SigningAlgorithm = "AWS4-HMAC-SHA256"
+	s3AmzDateFormat    = "20060102T150405Z"
+	// The SHA256 of an empty request body, which every request has
+	s3EmptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// S3FetcherOptions configure an S3Fetcher. Credentials and the region that
+// are not set default to the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY,
+// AWS_SESSION_TOKEN and AWS_REGION environment variables.
+type S3FetcherOptions struct {
+	// The region of the buckets, e.g. us-west-2
+	Region string `yaml:"region,omitempty"`
+
+	AccessKeyID     string `yaml:"access_key_id,omitempty"`
+	SecretAccessKey string `yaml:"secret_access_key,omitempty"`
+	// Only needed with temporary credentials, e.g. from an assumed role
+	SessionToken string `yaml:"session_token,omitempty"`
+
+	// Overrides the S3 endpoint, e.g. for an S3 compatible store. Buckets
+	// are addressed by path under a custom endpoint, and by virtual host
+	// under the default https://s3.<Region>.amazonaws.com
+	Endpoint string `yaml:"endpoint,omitempty"`
+
+	// Used for all requests. Defaults to http.DefaultClient
+	Client *http.Client `yaml:"-"`
+}
+
+// S3Fetcher fetches "s3://bucket/key" URIs from Amazon S3, signing each
+// request with AWS Signature Version 4. URIs with any other scheme are
+// handled by a BasicFetcher using the same HTTP client, so an S3Fetcher can be
+// used wherever a Fetcher is. Presigned https URLs need no S3Fetcher.
+type S3Fetcher struct {
+	client   *http.Client
+	endpoint *url.URL
+	// Set to true when endpoint was configured, see S3FetcherOptions
+	pathStyle bool
+	region    string
+	fallback  BasicFetcher
+
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+
+	// Replaced in tests
+	now func() time.Time
+}
+
+var _ Fetcher = &S3Fetcher{}
+
+func NewS3Fetcher(opts S3FetcherOptions) (*S3Fetcher, error) {
+	client := opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	setFromEnv := func(field *string, envar string) {
+		if *field == "" {
+			*field = os.Getenv(envar)
+		}
+	}
+	setFromEnv(&opts.Region, "AWS_REGION")
+	setFromEnv(&opts.AccessKeyID, "AWS_ACCESS_KEY_ID")
+	setFromEnv(&opts.SecretAccessKey, "AWS_SECRET_ACCESS_KEY")
+	setFromEnv(&opts.SessionToken, "AWS_SESSION_TOKEN")
+
+	if opts.Region == "" {
+		return nil, util.Errorf("No AWS region configured for S3")
+	}
+	if opts.AccessKeyID == "" || opts.SecretAccessKey == "" {
+		return nil, util.Errorf("Both an AWS access key ID and secret access key must be configured for S3")
+	}
+
+	f := &S3Fetcher{
+		client:          client,
+		region:          opts.Region,
+		fallback:        BasicFetcher{Client: client},
+		accessKeyID:     opts.AccessKeyID,
+		secretAccessKey: opts.SecretAccessKey,
+		sessionToken:    opts.SessionToken,
+		now:             time.Now,
+	}
+	endpoint := opts.Endpoint
+	if endpoint != "" {
+		f.pathStyle = true
+	} else {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", opts.Region)
+	}
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, util.Errorf("Invalid S3 endpoint %q: %s", endpoint, err)
+	}
+	f.endpoint = endpointURL
+	return f, nil
+}
+
+func (f *S3Fetcher) Open(u *url.URL) (io.ReadCloser, error) {
+	if u.Scheme != "s3" {
+		return f.fallback.Open(u)
+	}
+	resp, err := f.do("GET", u)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, util.Errorf("%q: S3 returned status: %s", u.String(), resp.Status)
+	}
+	return resp.Body, nil
+}
+
+func (f *S3Fetcher) Head(u *url.URL) (*http.Response, error) {
+	if u.Scheme != "s3" {
+		return f.fallback.Head(u)
+	}
+	return f.do("HEAD", u)
+}
+
+func (f *S3Fetcher) CopyLocal(srcUri *url.URL, dstPath string) (err error) {
+	src, err := f.Open(srcUri)
+	if err != nil {
+		return
+	}
+	defer src.Close()
+	dest, err := os.Create(dstPath)
+	if err != nil {
+		return
+	}
+	defer func() {
+		// Return the Close() error unless another error happened first
+		if errC := dest.Close(); err == nil {
+			err = errC
+		}
+	}()
+	_, err = io.Copy(dest, src)
+	return
+}
+
+// objectURL returns the REST endpoint of the object named by an s3:// URI.
+func (f *S3Fetcher) objectURL(u *url.URL) (*url.URL, error) {
+	bucket := u.Host
+	key := strings.TrimPrefix(u.Path, "/")
+	if bucket == "" || key == "" {
+		return nil, util.Errorf("%q: S3 URIs must be of the form s3://bucket/key", u.String())
+	}
+
+	objectURL := &url.URL{}
+	*objectURL = *f.endpoint
+	objectURL.RawQuery = ""
+	basePath := strings.TrimSuffix(f.endpoint.Path, "/")
+	if f.pathStyle {
+		objectURL.Path = basePath + "/" + bucket + "/" + key
+	} else {
+		objectURL.Host = bucket + "." + f.endpoint.Host
+		objectURL.Path = basePath + "/" + key
+	}
+	objectURL.RawPath = s3URIEncode(objectURL.Path, false)
+	return objectURL, nil
+}
+
+func (f *S3Fetcher) do(method string, u *url.URL) (*http.Response, error) {
+	objectURL, err := f.objectURL(u)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, objectURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	f.sign(req)
+	return f.client.Do(req)
+}
+
+// sign adds the headers of AWS Signature Version 4 to a request without a
+// body, as described at
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html
+// Every header already set on the request is signed.
+func (f *S3Fetcher) sign(req *http.Request) {
+	now := f.now().UTC()
+	amzDate := now.Format(s3AmzDateFormat)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", s3EmptyPayloadHash)
+	if f.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", f.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(req.Header.Get(name))
+	}
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders string
+	for _, name := range names {
+		canonicalHeaders += name + ":" + headers[name] + "\n"
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3URIEncode(req.URL.Path, false),
+		s3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		s3EmptyPayloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{now.Format("20060102"), f.region, "s3", "aws4_request"}, "/")
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		s3SigningAlgorithm,
+		amzDate,
+		scope,
+		hex.EncodeToString(canonicalHash[:]),
+	}, "\n")
+
+	key := []byte("AWS4" + f.secretAccessKey)
+	for _, part := range []string{now.Format("20060102"), f.region, "s3", "aws4_request"} {
+		key = s3HMAC(key, part)
+	}
+	signature := hex.EncodeToString(s3HMAC(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3SigningAlgorithm,
+		f.accessKeyID,
+		scope,
+		signedHeaders,
+		signature,
+	))
+}
+
+func s3HMAC(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	var params []string
+	for name, values := range query {
+		for _, value := range values {
+			params = append(params, s3URIEncode(name, true)+"="+s3URIEncode(value, true))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// s3URIEncode percent-encodes every byte except the unreserved characters,
+// and also '/' unless encodeSlash is set, as AWS signatures require.
+func s3URIEncode(s string, encodeSlash bool) string {
+	var encoded []byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			encoded = append(encoded, c)
+		case c == '/' && !encodeSlash:
+			encoded = append(encoded, c)
+		default:
+			encoded = append(encoded, []byte(fmt.Sprintf("%%%02X", c))...)
+		}
+	}
+	return string(encoded)
+}
@@ -25,7 +25,7 @@ type Fetcher interface {
 }
 
 // A default fetcher, if the user doesn't want to set any options.
-var DefaultFetcher Fetcher = BasicFetcher{http.DefaultClient}
+var DefaultFetcher Fetcher = BasicFetcher{Client: http.DefaultClient}
 
 // URICopy Wraps opening and copying content from URIs. Will attempt
 // directly perform file copies if the uri is begins with file://, otherwise
@@ -33,9 +33,17 @@ var DefaultFetcher Fetcher = BasicFetcher{http.DefaultClient}
 var URICopy = DefaultFetcher.CopyLocal
 
 // BasicFetcher can access "file" and "http" schemes using the OS and
-// a provided HTTP client, respectively.
+// a provided HTTP client, respectively. "data" URIs are handled by
+// DataFetcher.
 type BasicFetcher struct {
 	Client *http.Client
+
+	// How HTTP downloads are retried and resumed. The zero value makes a
+	// single attempt
+	Retry RetryPolicy
+	// If non-nil, HTTP downloads are read no faster than this limit, which
+	// may be shared with other fetchers
+	BandwidthLimit *BandwidthLimit
 }
 
 func (f BasicFetcher) Open(u *url.URL) (io.ReadCloser, error) {
@@ -53,25 +61,18 @@ func (f BasicFetcher) Open(u *url.URL) (io.ReadCloser, error) {
 
 		return os.Open(u.Path)
 	case "http", "https":
-		resp, err := f.Client.Get(u.String())
-		if err != nil {
-			return nil, err
-		}
-		if resp.StatusCode != http.StatusOK {
-			_ = resp.Body.Close()
-			return nil, util.Errorf(
-				"%q: HTTP server returned status: %s",
-				u.String(),
-				resp.Status,
-			)
-		}
-		return resp.Body, nil
+		return f.openHTTP(u)
+	case "data":
+		return DataFetcher{}.Open(u)
 	default:
 		return nil, util.Errorf("%q: unknown scheme %s", u.String(), u.Scheme)
 	}
 }
 
 func (f BasicFetcher) Head(u *url.URL) (*http.Response, error) {
+	if u.Scheme == "data" {
+		return DataFetcher{}.Head(u)
+	}
 	return f.Client.Head(u.String())
 }
 
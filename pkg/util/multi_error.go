@@ -0,0 +1,41 @@
+package util
+
+import (
+	"strings"
+)
+
+// MultiError aggregates several errors so that they can be reported at once,
+// e.g. every problem found while validating a manifest rather than just the
+// first.
+type MultiError struct {
+	Errors []error
+}
+
+// Add appends err. nil errors are ignored.
+func (m *MultiError) Add(err error) {
+	if err != nil {
+		m.Errors = append(m.Errors, err)
+	}
+}
+
+func (m *MultiError) HasErrors() bool {
+	return len(m.Errors) > 0
+}
+
+// Error returns the message of each error, one per line.
+func (m *MultiError) Error() string {
+	messages := make([]string, 0, len(m.Errors))
+	for _, err := range m.Errors {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "\n")
+}
+
+// ErrorOrNil returns m if any errors were added, and otherwise nil. Returning
+// an empty *MultiError as an error would make it non-nil.
+func (m *MultiError) ErrorOrNil() error {
+	if !m.HasErrors() {
+		return nil
+	}
+	return m
+}
@@ -0,0 +1,29 @@
+package util
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMultiError(t *testing.T) {
+	errs := &MultiError{}
+	if errs.HasErrors() {
+		t.Error("expected an empty MultiError to have no errors")
+	}
+	if errs.ErrorOrNil() != nil {
+		t.Error("expected ErrorOrNil of an empty MultiError to be nil")
+	}
+
+	errs.Add(errors.New("first"))
+	errs.Add(nil)
+	errs.Add(errors.New("second"))
+	if !errs.HasErrors() || len(errs.Errors) != 2 {
+		t.Fatalf("expected 2 errors, got %v", errs.Errors)
+	}
+	if errs.Error() != "first\nsecond" {
+		t.Errorf("expected messages joined by newlines, got %q", errs.Error())
+	}
+	if errs.ErrorOrNil() == nil {
+		t.Error("expected ErrorOrNil to return the errors")
+	}
+}
@@ -20,7 +20,11 @@ type stackError struct {
 	filename   string
 	function   string
 	lineNumber int
-	stack      []byte
+
+	// Program counters captured when the error was created. They are only
+	// formatted if the stack is requested, since most errors are never
+	// inspected that closely.
+	pcs []uintptr
 }
 
 func (e *stackError) Error() string {
@@ -28,7 +32,7 @@ func (e *stackError) Error() string {
 }
 
 func (e *stackError) Stack() []byte {
-	return e.stack
+	return formatCallers(e.pcs)
 }
 
 func (e *stackError) LineNumber() int {
@@ -58,8 +62,56 @@ func Errorf(format string, a ...interface{}) error {
 		filename:   filepath.Base(file),
 		function:   function,
 		lineNumber: line,
-		stack:      stack(1),
+		pcs:        callers(1),
+	}
+}
+
+// StackTrace returns the stack trace captured when err was created, or the
+// empty string if err does not carry one.
+func StackTrace(err error) string {
+	stackErr, ok := err.(StackError)
+	if !ok {
+		return ""
+	}
+	return string(stackErr.Stack())
+}
+
+// callers returns the program counters of the calling goroutine's stack. The
+// argument skip is the number of stack frames to skip, with 0 identifying the
+// caller of callers.
+func callers(skip int) []uintptr {
+	pcs := make([]uintptr, 32)
+	for {
+		// +2 skips runtime.Callers and callers itself
+		n := runtime.Callers(skip+2, pcs)
+		if n < len(pcs) {
+			return pcs[:n]
+		}
+		pcs = make([]uintptr, len(pcs)*2)
+	}
+}
+
+// formatCallers formats program counters in the same layout as a goroutine
+// trace from runtime.Stack, minus the goroutine header and offsets:
+//
+//	<func1>
+//		<file1>:<line1>
+//	<func2>
+//		<file2>:<line2>
+//	...
+func formatCallers(pcs []uintptr) []byte {
+	var buf bytes.Buffer
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		if frame.Function != "" || frame.File != "" {
+			fmt.Fprintf(&buf, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		}
+		if !more {
+			break
+		}
 	}
+	return buf.Bytes()
 }
 
 // trimLine returns a subslice of b by slicing off the bytes up to and
@@ -0,0 +1,40 @@
+package util
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func failingHelper() error {
+	return Errorf("something went wrong: %d", 42)
+}
+
+func TestErrorfMessage(t *testing.T) {
+	err := failingHelper()
+	if !strings.HasSuffix(err.Error(), "something went wrong: 42") {
+		t.Errorf("unexpected error message %q", err.Error())
+	}
+	if !strings.HasPrefix(err.Error(), "stack_error_test.go:") {
+		t.Errorf("expected error message to be prefixed with the call site, was %q", err.Error())
+	}
+}
+
+func TestStackTraceIncludesCreator(t *testing.T) {
+	trace := StackTrace(failingHelper())
+	if !strings.Contains(trace, "util.failingHelper") {
+		t.Errorf("expected stack trace to include the function that created the error, got:\n%s", trace)
+	}
+	if !strings.Contains(trace, "util.TestStackTraceIncludesCreator") {
+		t.Errorf("expected stack trace to include the caller of the helper, got:\n%s", trace)
+	}
+	if strings.Contains(trace, "util.Errorf") || strings.Contains(trace, "util.callers") {
+		t.Errorf("expected stack trace to start at the caller of Errorf, got:\n%s", trace)
+	}
+}
+
+func TestStackTraceWithoutStack(t *testing.T) {
+	if trace := StackTrace(errors.New("plain")); trace != "" {
+		t.Errorf("expected empty stack trace for a plain error, got %q", trace)
+	}
+}
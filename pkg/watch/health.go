@@ -1,13 +1,19 @@
 package watch
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"net/http"
+	"os/exec"
+	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/square/p2/pkg/health"
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/p2exec"
 	"github.com/square/p2/pkg/preparer"
 	"github.com/square/p2/pkg/store/consul"
 	"github.com/square/p2/pkg/types"
@@ -52,6 +58,14 @@ type StatusChecker struct {
 	Node   types.NodeName
 	URI    string
 	Client *http.Client
+
+	// Set instead of URI for tcp checks, the host:port to connect to
+	TCPAddress string
+	// Set instead of URI for exec checks, the command line to run
+	Command []string
+	// How long a tcp or exec check may take. Defaults to
+	// HEALTHCHECK_TIMEOUT
+	Timeout time.Duration
 }
 
 // MonitorPodHealth is meant to be a long running go routine.
@@ -139,7 +153,10 @@ func updatePods(
 				man.Manifest.GetStatusHTTP() == pod.manifest.GetStatusHTTP() &&
 				man.Manifest.GetStatusLocalhostOnly() == pod.manifest.GetStatusLocalhostOnly() &&
 				man.Manifest.GetStatusPath() == pod.manifest.GetStatusPath() &&
-				man.Manifest.GetStatusPort() == pod.manifest.GetStatusPort() {
+				man.Manifest.GetStatusPort() == pod.manifest.GetStatusPort() &&
+				man.Manifest.GetStatusStanza().CheckType() == pod.manifest.GetStatusStanza().CheckType() &&
+				man.Manifest.GetStatusStanza().Command == pod.manifest.GetStatusStanza().Command &&
+				man.Manifest.RunAsUser() == pod.manifest.RunAsUser() {
 				inReality = true
 				break
 			}
@@ -187,8 +204,13 @@ func updatePods(
 				Node:   node,
 				Client: client,
 			}
-			if man.Manifest.GetStatusPort() == 0 {
+			status := man.Manifest.GetStatusStanza()
+			if status.CheckType() == manifest.StatusCheckExec {
+				sc.Command = execCheckCommand(man.Manifest.RunAsUser(), status.Command)
+			} else if man.Manifest.GetStatusPort() == 0 {
 				sc.URI = ""
+			} else if status.CheckType() == manifest.StatusCheckTCP {
+				sc.TCPAddress = net.JoinHostPort(statusHost.String(), strconv.Itoa(man.Manifest.GetStatusPort()))
 			} else if man.Manifest.GetStatusHTTP() {
 				sc.URI = fmt.Sprintf("http://%s:%d%s", statusHost, man.Manifest.GetStatusPort(), man.Manifest.GetStatusPath())
 			} else {
@@ -243,6 +265,10 @@ func (p *PodWatch) checkHealth() {
 func (sc *StatusChecker) Check() (health.Result, error) {
 	if sc.URI != "" {
 		return sc.resultFromCheck(sc.StatusCheck())
+	} else if sc.TCPAddress != "" {
+		return sc.tcpCheck(), nil
+	} else if len(sc.Command) > 0 {
+		return sc.execCheck(), nil
 	} else {
 		// "unknown" is probably more accurate, but automated tools can't handle an app that is
 		// always non-"passing". For instance, p2-replicate by default waits for a node to
@@ -285,6 +311,64 @@ func (sc *StatusChecker) StatusCheck() (*http.Response, error) {
 	return sc.Client.Head(sc.URI)
 }
 
+func (sc *StatusChecker) timeout() time.Duration {
+	if sc.Timeout > 0 {
+		return sc.Timeout
+	}
+	return time.Duration(*HEALTHCHECK_TIMEOUT) * time.Second
+}
+
+// tcpCheck is passing if a connection to TCPAddress can be opened
+func (sc *StatusChecker) tcpCheck() health.Result {
+	res := health.Result{
+		ID:      sc.ID,
+		Node:    sc.Node,
+		Service: string(sc.ID),
+		Status:  health.Critical,
+	}
+	conn, err := net.DialTimeout("tcp", sc.TCPAddress, sc.timeout())
+	if err == nil {
+		_ = conn.Close()
+		res.Status = health.Passing
+	}
+	return res
+}
+
+// execCheck runs Command. Like a Consul script check, it is passing if the
+// command exits 0, warning if it exits 1, and otherwise critical. A command
+// that doesn't finish within the timeout is critical.
+func (sc *StatusChecker) execCheck() health.Result {
+	res := health.Result{
+		ID:      sc.ID,
+		Node:    sc.Node,
+		Service: string(sc.ID),
+		Status:  health.Critical,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sc.timeout())
+	defer cancel()
+	err := exec.CommandContext(ctx, sc.Command[0], sc.Command[1:]...).Run()
+	if err == nil {
+		res.Status = health.Passing
+		return res
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok && ctx.Err() == nil {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.ExitStatus() == 1 {
+			res.Status = health.Warning
+		}
+	}
+	return res
+}
+
+// execCheckCommand returns the command line of an exec check, which runs
+// command with the shell as the pod's user.
+func execCheckCommand(user string, command string) []string {
+	args := p2exec.P2ExecArgs{
+		User:    user,
+		Command: []string{"/bin/sh", "-c", command},
+	}
+	return append([]string{p2exec.DefaultP2Exec}, args.CommandLine()...)
+}
+
 func resToConsulRes(res health.Result) consul.WatchResult {
 	return consul.WatchResult{
 		Service: res.Service,
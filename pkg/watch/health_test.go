@@ -4,15 +4,18 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"net"
 	"net/http"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	. "github.com/anthonybishopric/gotcha"
 	"github.com/square/p2/pkg/health"
 	"github.com/square/p2/pkg/logging"
 	"github.com/square/p2/pkg/manifest"
+	"github.com/square/p2/pkg/p2exec"
 	"github.com/square/p2/pkg/store/consul"
 	"github.com/square/p2/pkg/types"
 )
@@ -154,3 +157,62 @@ func newManifestResult(id types.PodID) consul.ManifestResult {
 		Manifest: builder.GetManifest(),
 	}
 }
+
+func TestUpdatePodsCheckTypes(t *testing.T) {
+	logger := logging.TestLogger()
+	healthManager := &MockHealthManager{}
+
+	tcpManifest, err := manifest.FromBytes([]byte("id: tcp\nstatus:\n  type: tcp\n  port: 8080\n"))
+	Assert(t).IsNil(err, "should have parsed the tcp manifest")
+	tcp := consul.ManifestResult{Manifest: tcpManifest}
+
+	execManifest, err := manifest.FromBytes([]byte("id: exec\nrun_as: app\nstatus:\n  type: exec\n  command: ./bin/check\n"))
+	Assert(t).IsNil(err, "should have parsed the exec manifest")
+	exec := consul.ManifestResult{Manifest: execManifest}
+
+	pods := updatePods(healthManager, nil, nil, []PodWatch{}, []consul.ManifestResult{tcp, exec}, "bobnode", &logger)
+	Assert(t).AreEqual(2, len(pods), "new pods were not added")
+	Assert(t).AreEqual("", pods[0].statusChecker.URI, "tcp checks should not request a URI")
+	Assert(t).AreEqual("bobnode:8080", pods[0].statusChecker.TCPAddress, "pod should be checking the status port")
+	Assert(t).AreEqual(
+		fmt.Sprint([]string{p2exec.DefaultP2Exec, "-u", "app", "--", "/bin/sh", "-c", "./bin/check"}),
+		fmt.Sprint(pods[1].statusChecker.Command),
+		"pod should be running its check command as its user",
+	)
+
+	// Changing the check type refreshes the pod
+	healthManager.Reset()
+	httpManifest, err := manifest.FromBytes([]byte("id: tcp\nstatus:\n  port: 8080\n"))
+	Assert(t).IsNil(err, "should have parsed the http manifest")
+	pods = updatePods(healthManager, nil, nil, pods, []consul.ManifestResult{{Manifest: httpManifest}, exec}, "bobnode", &logger)
+	Assert(t).AreEqual(1, healthManager.UpdaterCreated, "the pod whose check changed should have been refreshed")
+}
+
+func TestTCPCheck(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Assert(t).IsNil(err, "should have listened on a port")
+	defer listener.Close()
+
+	sc := StatusChecker{TCPAddress: listener.Addr().String(), Timeout: time.Second}
+	res, err := sc.Check()
+	Assert(t).IsNil(err, "tcp checks should not return errors")
+	Assert(t).AreEqual(health.Passing, res.Status, "a listening port should be passing")
+
+	listener.Close()
+	res, _ = sc.Check()
+	Assert(t).AreEqual(health.Critical, res.Status, "a closed port should be critical")
+}
+
+func TestExecCheck(t *testing.T) {
+	for command, expected := range map[string]health.HealthState{
+		"exit 0":  health.Passing,
+		"exit 1":  health.Warning,
+		"exit 2":  health.Critical,
+		"sleep 5": health.Critical,
+	} {
+		sc := StatusChecker{Command: []string{"/bin/sh", "-c", command}, Timeout: 100 * time.Millisecond}
+		res, err := sc.Check()
+		Assert(t).IsNil(err, "exec checks should not return errors")
+		Assert(t).AreEqual(expected, res.Status, fmt.Sprintf("unexpected status for %q", command))
+	}
+}